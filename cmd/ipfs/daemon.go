@@ -20,6 +20,9 @@ import (
 	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	nodeMount "github.com/ipfs/go-ipfs/fuse/node"
+	nfs "github.com/ipfs/go-ipfs/nfs"
+	p9 "github.com/ipfs/go-ipfs/p9"
+	repo "github.com/ipfs/go-ipfs/repo"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	migrate "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 
@@ -27,6 +30,7 @@ import (
 	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
 	"gx/ipfs/QmTQuFQWHAWy4wMH6ZyPfGiawA5u9T8rs79FENoV8yXaoS/client_golang/prometheus"
 	mprome "gx/ipfs/QmVMcMs6duiwLzvhF6xWM3yc4GgjpNoctKFhvtBch5tpgo/go-metrics-prometheus"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 )
@@ -34,10 +38,12 @@ import (
 const (
 	adjustFDLimitKwd          = "manage-fdlimit"
 	enableGCKwd               = "enable-gc"
+	enforceStorageMaxKwd      = "enforce-storage-max"
 	initOptionKwd             = "init"
 	initProfileOptionKwd      = "init-profile"
 	ipfsMountKwd              = "mount-ipfs"
 	ipnsMountKwd              = "mount-ipns"
+	mfsMountKwd               = "mount-mfs"
 	migrateKwd                = "migrate"
 	mountKwd                  = "mount"
 	offlineKwd                = "offline"
@@ -46,6 +52,7 @@ const (
 	routingOptionDHTClientKwd = "dhtclient"
 	routingOptionDHTKwd       = "dht"
 	routingOptionNoneKwd      = "none"
+	routingOptionCustomKwd    = "custom"
 	routingOptionDefaultKwd   = "default"
 	unencryptTransportKwd     = "disable-transport-encryption"
 	unrestrictedApiAccessKwd  = "unrestricted-api"
@@ -53,10 +60,14 @@ const (
 	enablePubSubKwd           = "enable-pubsub-experiment"
 	enableIPNSPubSubKwd       = "enable-namesys-pubsub"
 	enableMultiplexKwd        = "enable-mplex-experiment"
+	gatewayOnlyKwd            = "gateway-only"
 	// apiAddrKwd    = "address-api"
 	// swarmAddrKwd  = "address-swarm"
 )
 
+// gatewayOnlyConfigKey enables gateway-only mode from the config.
+const gatewayOnlyConfigKey = "Gateway.Only"
+
 var daemonCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Run a network-connected IPFS node.",
@@ -118,6 +129,18 @@ or send a SIGTERM signal to it (e.g. with 'kill'). It may take a while for the
 daemon to shutdown gracefully, but it can be killed forcibly by sending a
 second signal.
 
+The daemon can also be shut down with 'ipfs shutdown'. Use
+'ipfs shutdown --wait' to let in-flight commands finish and flush the MFS
+root and pin set to disk before exiting.
+
+Reloading the configuration
+
+Some sections of the config (e.g. Gateway.RateLimit and Gateway.Hosts) can be
+changed without restarting the daemon. After editing the config, apply the
+changes with:
+
+  ipfs daemon reload
+
 IPFS_PATH environment variable
 
 ipfs uses a repository in the local file system. By default, the repo is
@@ -126,6 +149,23 @@ environment variable:
 
   export IPFS_PATH=/path/to/ipfsrepo
 
+Gateway-only mode
+
+To run a hardened, public, read-only gateway, start the daemon with:
+
+  ipfs daemon --gateway-only
+
+or set it permanently with:
+
+  ipfs config --json Gateway.Only true
+
+In this mode the daemon serves nothing but the gateway. The HTTP API (and
+with it the webui and all commands that modify the repo) is not started,
+the gateway is never writable and does not expose the read-only API, and
+FUSE mounts are not allowed. The node only fetches the content it serves:
+the DHT runs in client mode, pubsub is not available and the blocks are
+never reprovided.
+
 Routing
 
 IPFS by default will use a DHT for content routing. There is a highly
@@ -137,6 +177,14 @@ can be enabled by running the daemon as:
 This will later be transitioned into a config option once it gets out of the
 'experimental' stage.
 
+The routing system can also be composed of several routers, queried in
+parallel, one after the other or by tiers, declared by the Routing.Routers
+config key and selected with:
+
+  ipfs daemon --routing=custom
+
+or by setting Routing.Type to "custom". See docs/config.md.
+
 DEPRECATION NOTICE
 
 Previously, ipfs used an environment variable as seen below:
@@ -157,21 +205,24 @@ Headers.
 		cmdkit.BoolOption(writableKwd, "Enable writing objects (with POST, PUT and DELETE)"),
 		cmdkit.StringOption(ipfsMountKwd, "Path to the mountpoint for IPFS (if using --mount). Defaults to config setting."),
 		cmdkit.StringOption(ipnsMountKwd, "Path to the mountpoint for IPNS (if using --mount). Defaults to config setting."),
+		cmdkit.StringOption(mfsMountKwd, "Path to the writable mountpoint for MFS (if using --mount). Defaults to config setting, not mounted if unset."),
 		cmdkit.BoolOption(unrestrictedApiAccessKwd, "Allow API access to unlisted hashes"),
 		cmdkit.BoolOption(unencryptTransportKwd, "Disable transport encryption (for debugging protocols)"),
-		cmdkit.BoolOption(enableGCKwd, "Enable automatic periodic repo garbage collection"),
+		cmdkit.BoolOption(enableGCKwd, "Enable automatic repo garbage collection. Default: Datastore.GCEnabled"),
+		cmdkit.BoolOption(enforceStorageMaxKwd, "Refuse to store new blocks over Datastore.StorageMax"),
 		cmdkit.BoolOption(adjustFDLimitKwd, "Check and raise file descriptor limits if needed").WithDefault(true),
 		cmdkit.BoolOption(offlineKwd, "Run offline. Do not connect to the rest of the network but provide local API."),
 		cmdkit.BoolOption(migrateKwd, "If true, assume yes at the migrate prompt. If false, assume no."),
 		cmdkit.BoolOption(enablePubSubKwd, "Instantiate the ipfs daemon with the experimental pubsub feature enabled."),
 		cmdkit.BoolOption(enableIPNSPubSubKwd, "Enable IPNS record distribution through pubsub; enables pubsub."),
 		cmdkit.BoolOption(enableMultiplexKwd, "Add the experimental 'go-multiplex' stream muxer to libp2p on construction.").WithDefault(true),
+		cmdkit.BoolOption(gatewayOnlyKwd, "Only serve a read-only gateway: do not start the API. Defaults to config setting."),
 
 		// TODO: add way to override addresses. tricky part: updating the config if also --init.
 		// cmdkit.StringOption(apiAddrKwd, "Address for the daemon rpc API (overrides config)"),
 		// cmdkit.StringOption(swarmAddrKwd, "Address for the swarm socket (overrides config)"),
 	},
-	Subcommands: map[string]*cmds.Command{},
+	Subcommands: commands.DaemonCmd.Subcommands,
 	Run:         daemonFunc,
 }
 
@@ -261,7 +312,13 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 			return fmt.Errorf("fs-repo requires migration")
 		}
 
-		err = migrate.RunMigration(fsrepo.RepoVersion)
+		if fsrepo.CanMigrate(cctx.ConfigRoot) {
+			err = fsrepo.Migrate(cctx.ConfigRoot, func(msg string) {
+				fmt.Printf("  => %s\n", msg)
+			})
+		} else {
+			err = migrate.RunMigration(fsrepo.RepoVersion)
+		}
 		if err != nil {
 			fmt.Println("The migrations of fs-repo failed:")
 			fmt.Printf("  %s\n", err)
@@ -288,6 +345,20 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	pubsub, _ := req.Options[enablePubSubKwd].(bool)
 	mplex, _ := req.Options[enableMultiplexKwd].(bool)
 
+	gatewayOnly, gatewayOnlyOptionFound := req.Options[gatewayOnlyKwd].(bool)
+	if !gatewayOnlyOptionFound {
+		gatewayOnly, err = configBool(repo, gatewayOnlyConfigKey)
+		if err != nil {
+			return err
+		}
+	}
+	if gatewayOnly && len(cfg.Addresses.Gateway) == 0 {
+		return cmdkit.Errorf(cmdkit.ErrClient, "gateway-only mode requires a gateway address (see 'ipfs config Addresses.Gateway')")
+	}
+	if gatewayOnly && (pubsub || ipnsps) {
+		return cmdkit.Errorf(cmdkit.ErrClient, "pubsub is not supported in gateway-only mode")
+	}
+
 	// Start assembling node config
 	ncfg := &core.BuildCfg{
 		Repo:                        repo,
@@ -314,17 +385,12 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 			routingOption = routingOptionDHTKwd
 		}
 	}
-	switch routingOption {
-	case routingOptionSupernodeKwd:
-		return errors.New("supernode routing was never fully implemented and has been removed")
-	case routingOptionDHTClientKwd:
-		ncfg.Routing = core.DHTClientOption
-	case routingOptionDHTKwd:
-		ncfg.Routing = core.DHTOption
-	case routingOptionNoneKwd:
-		ncfg.Routing = core.NilRouterOption
-	default:
-		return fmt.Errorf("unrecognized routing option: %s", routingOption)
+	if gatewayOnly {
+		routingOption = gatewayOnlyConfig(ncfg, routingOption)
+	}
+	ncfg.Routing, err = makeRoutingOption(routingOption, repo)
+	if err != nil {
+		return err
 	}
 
 	node, err := core.NewNode(req.Context, ncfg)
@@ -334,6 +400,14 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	}
 	node.SetLocal(false)
 
+	if enforce, _ := req.Options[enforceStorageMaxKwd].(bool); enforce {
+		if node.StorageQuota == nil {
+			node.Close()
+			return cmdkit.Errorf(cmdkit.ErrClient, "--%s requires Datastore.StorageMax to be set", enforceStorageMaxKwd)
+		}
+		node.StorageQuota.SetEnforce(true)
+	}
+
 	if node.PNetFingerprint != nil {
 		fmt.Println("Swarm is limited to private network of peers with the swarm key")
 		fmt.Printf("Swarm key fingerprint: %x\n", node.PNetFingerprint)
@@ -357,17 +431,29 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		return node, nil
 	}
 
-	// construct api endpoint - every time
-	apiErrc, err := serveHTTPApi(req, cctx)
-	if err != nil {
+	if err := openNamedRepos(node, cctx.ConfigRoot); err != nil {
 		return err
 	}
 
+	// construct api endpoint - unless we only serve the gateway
+	var apiErrc <-chan error
+	if gatewayOnly {
+		fmt.Println("Running in gateway-only mode, API server not started")
+	} else {
+		apiErrc, err = serveHTTPApi(req, cctx)
+		if err != nil {
+			return err
+		}
+	}
+
 	// construct fuse mountpoints - if the user provided the --mount flag
 	mount, _ := req.Options[mountKwd].(bool)
 	if mount && offline {
 		return cmdkit.Errorf(cmdkit.ErrClient, "mount is not currently supported in offline mode")
 	}
+	if mount && gatewayOnly {
+		return cmdkit.Errorf(cmdkit.ErrClient, "mount is not supported in gateway-only mode")
+	}
 	if mount {
 		if err := mountFuse(req, cctx); err != nil {
 			return err
@@ -384,7 +470,37 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	var gwErrc <-chan error
 	if len(cfg.Addresses.Gateway) > 0 {
 		var err error
-		gwErrc, err = serveHTTPGateway(req, cctx)
+		gwErrc, err = serveHTTPGateway(req, cctx, gatewayOnly)
+		if err != nil {
+			return err
+		}
+	}
+
+	// construct webdav server - if it is set in the config
+	var davErrc <-chan error
+	if !gatewayOnly {
+		var err error
+		davErrc, err = serveWebDAV(cctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// construct nfs server - if it is set in the config
+	var nfsErrc <-chan error
+	if !gatewayOnly {
+		var err error
+		nfsErrc, err = serveNFS(cctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// construct 9p server - if it is set in the config
+	var p9Errc <-chan error
+	if !gatewayOnly {
+		var err error
+		p9Errc, err = serve9P(cctx)
 		if err != nil {
 			return err
 		}
@@ -396,7 +512,7 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	fmt.Printf("Daemon is ready\n")
 	// collect long-running errors and block for shutdown
 	// TODO(cryptix): our fuse currently doesnt follow this pattern for graceful shutdown
-	for err := range merge(apiErrc, gwErrc, gcErrc) {
+	for err := range merge(apiErrc, gwErrc, davErrc, nfsErrc, p9Errc, gcErrc) {
 		if err != nil {
 			return err
 		}
@@ -439,11 +555,43 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 		listeners = append(listeners, apiLis)
 	}
 
+	unrestricted, _ := req.Options[unrestrictedApiAccessKwd].(bool)
+	opts := apiServeOptions(cctx, cfg, unrestricted)
+
+	node, err := cctx.ConstructNode()
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPApi: ConstructNode() failed: %s", err)
+	}
+
+	if err := node.Repo.SetAPIAddr(listeners[0].Multiaddr()); err != nil {
+		return nil, fmt.Errorf("serveHTTPApi: SetAPIAddr() failed: %s", err)
+	}
+
+	errc := make(chan error)
+	var wg sync.WaitGroup
+	for _, apiLis := range listeners {
+		wg.Add(1)
+		go func(lis manet.Listener) {
+			defer wg.Done()
+			errc <- corehttp.Serve(node, manet.NetListener(lis), opts...)
+		}(apiLis)
+	}
+
+	go func() {
+		wg.Wait()
+		close(errc)
+	}()
+
+	return errc, nil
+}
+
+// apiServeOptions returns the options of the HTTP API server, with its
+// access checks, shared by the daemon and the node of 'ipfs repl'.
+func apiServeOptions(cctx *oldcmds.Context, cfg *config.Config, unrestricted bool) []corehttp.ServeOption {
 	// by default, we don't let you load arbitrary ipfs objects through the api,
 	// because this would open up the api to scripting vulnerabilities.
 	// only the webui objects are allowed.
 	// if you know what you're doing, go ahead and pass --unrestricted-api.
-	unrestricted, _ := req.Options[unrestrictedApiAccessKwd].(bool)
 	gatewayOpt := corehttp.GatewayOption(false, corehttp.WebUIPaths...)
 	if unrestricted {
 		gatewayOpt = corehttp.GatewayOption(true, "/ipfs", "/ipns")
@@ -461,37 +609,38 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 		corehttp.MutexFractionOption("/debug/pprof-mutex/"),
 		corehttp.MetricsScrapingOption("/debug/metrics/prometheus"),
 		corehttp.LogOption(),
+		corehttp.HealthOption(),
 	}
 
 	if len(cfg.Gateway.RootRedirect) > 0 {
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
 	}
+	return opts
+}
 
-	node, err := cctx.ConstructNode()
+// openNamedRepos serves the named repos stored in the repo at repoPath.
+func openNamedRepos(node *core.IpfsNode, repoPath string) error {
+	names, err := fsrepo.NamedRepos(repoPath)
 	if err != nil {
-		return nil, fmt.Errorf("serveHTTPApi: ConstructNode() failed: %s", err)
-	}
-
-	if err := node.Repo.SetAPIAddr(listeners[0].Multiaddr()); err != nil {
-		return nil, fmt.Errorf("serveHTTPApi: SetAPIAddr() failed: %s", err)
+		return err
 	}
 
-	errc := make(chan error)
-	var wg sync.WaitGroup
-	for _, apiLis := range listeners {
-		wg.Add(1)
-		go func(lis manet.Listener) {
-			defer wg.Done()
-			errc <- corehttp.Serve(node, manet.NetListener(lis), opts...)
-		}(apiLis)
+	for _, name := range names {
+		path, err := fsrepo.NamedRepoPath(repoPath, name)
+		if err != nil {
+			return err
+		}
+		r, err := fsrepo.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening repo %q: %s", name, err)
+		}
+		if _, err := node.Repos.Add(node.Context(), name, r); err != nil {
+			r.Close()
+			return fmt.Errorf("opening repo %q: %s", name, err)
+		}
+		fmt.Printf("Serving repo %s\n", name)
 	}
-
-	go func() {
-		wg.Wait()
-		close(errc)
-	}()
-
-	return errc, nil
+	return nil
 }
 
 // printSwarmAddrs prints the addresses of the host
@@ -526,7 +675,7 @@ func printSwarmAddrs(node *core.IpfsNode) {
 }
 
 // serveHTTPGateway collects options, creates listener, prints status message and starts serving requests
-func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error) {
+func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context, gatewayOnly bool) (<-chan error, error) {
 	cfg, err := cctx.GetConfig()
 	if err != nil {
 		return nil, fmt.Errorf("serveHTTPGateway: GetConfig() failed: %s", err)
@@ -536,9 +685,16 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 	if !writableOptionFound {
 		writable = cfg.Gateway.Writable
 	}
+	if writable && gatewayOnly {
+		if writableOptionFound {
+			return nil, fmt.Errorf("serveHTTPGateway: --%s can't be used in gateway-only mode", writableKwd)
+		}
+		log.Warning("ignoring Gateway.Writable in gateway-only mode")
+		writable = false
+	}
 
 	gatewayAddrs := cfg.Addresses.Gateway
-	listeners := make([]manet.Listener, 0, len(gatewayAddrs))
+	listeners := make([]net.Listener, 0, len(gatewayAddrs))
 	for _, addr := range gatewayAddrs {
 		gatewayMaddr, err := ma.NewMultiaddr(addr)
 		if err != nil {
@@ -558,16 +714,54 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 			fmt.Printf("Gateway (readonly) server listening on %s\n", gatewayMaddr)
 		}
 
-		listeners = append(listeners, gwLis)
+		listeners = append(listeners, manet.NetListener(gwLis))
+	}
+
+	node, err := cctx.ConstructNode()
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err)
+	}
+
+	tlsCfg, err := corehttp.LoadTLSConfig(node.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("serveHTTPGateway: %s", err)
+	}
+	for _, addr := range tlsCfg.Addresses {
+		gatewayMaddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("serveHTTPGateway: invalid gateway TLS address: %q (err: %s)", addr, err)
+		}
+
+		gwLis, err := manet.Listen(gatewayMaddr)
+		if err != nil {
+			return nil, fmt.Errorf("serveHTTPGateway: manet.Listen(%s) failed: %s", gatewayMaddr, err)
+		}
+		gatewayMaddr = gwLis.Multiaddr()
+
+		tlsLis, err := corehttp.NewTLSListener(manet.NetListener(gwLis), tlsCfg)
+		if err != nil {
+			gwLis.Close()
+			return nil, fmt.Errorf("serveHTTPGateway: %s", err)
+		}
+		fmt.Printf("Gateway (TLS) server listening on %s\n", gatewayMaddr)
+
+		listeners = append(listeners, tlsLis)
 	}
 
 	var opts = []corehttp.ServeOption{
 		corehttp.MetricsCollectionOption("gateway"),
+		corehttp.RateLimitOption(),
 		corehttp.IPNSHostnameOption(),
 		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
 		corehttp.VersionOption(),
-		corehttp.CheckVersionOption(),
-		corehttp.CommandsROOption(*cctx),
+		corehttp.HealthOption(),
+	}
+
+	if !gatewayOnly {
+		opts = append(opts,
+			corehttp.CheckVersionOption(),
+			corehttp.CommandsROOption(*cctx),
+		)
 	}
 
 	if cfg.Experimental.P2pHttpProxy {
@@ -578,18 +772,178 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
 	}
 
+	errc := make(chan error)
+	var wg sync.WaitGroup
+	for _, lis := range listeners {
+		wg.Add(1)
+		go func(lis net.Listener) {
+			defer wg.Done()
+			errc <- corehttp.Serve(node, lis, opts...)
+		}(lis)
+	}
+
+	go func() {
+		wg.Wait()
+		close(errc)
+	}()
+
+	return errc, nil
+}
+
+// serveWebDAV serves MFS and /ipfs over WebDAV on the addresses set by the
+// optional Addresses.WebDAV key
+func serveWebDAV(cctx *oldcmds.Context) (<-chan error, error) {
 	node, err := cctx.ConstructNode()
 	if err != nil {
-		return nil, fmt.Errorf("serveHTTPGateway: ConstructNode() failed: %s", err)
+		return nil, fmt.Errorf("serveWebDAV: ConstructNode() failed: %s", err)
+	}
+
+	addrs, err := corehttp.WebDAVAddresses(node.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("serveWebDAV: %s", err)
+	}
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("serveWebDAV: invalid WebDAV address: %q (err: %s)", addr, err)
+		}
+
+		lis, err := manet.Listen(maddr)
+		if err != nil {
+			return nil, fmt.Errorf("serveWebDAV: manet.Listen(%s) failed: %s", maddr, err)
+		}
+		fmt.Printf("WebDAV server listening on %s\n", lis.Multiaddr())
+
+		listeners = append(listeners, manet.NetListener(lis))
+	}
+
+	opts := []corehttp.ServeOption{
+		corehttp.MetricsCollectionOption("webdav"),
+		corehttp.WebDAVOption(),
 	}
 
 	errc := make(chan error)
 	var wg sync.WaitGroup
 	for _, lis := range listeners {
 		wg.Add(1)
-		go func(lis manet.Listener) {
+		go func(lis net.Listener) {
 			defer wg.Done()
-			errc <- corehttp.Serve(node, manet.NetListener(lis), opts...)
+			errc <- corehttp.Serve(node, lis, opts...)
+		}(lis)
+	}
+
+	go func() {
+		wg.Wait()
+		close(errc)
+	}()
+
+	return errc, nil
+}
+
+// serveNFS serves MFS and /ipfs over NFSv3 on the addresses set by the
+// optional Addresses.NFS key
+func serveNFS(cctx *oldcmds.Context) (<-chan error, error) {
+	node, err := cctx.ConstructNode()
+	if err != nil {
+		return nil, fmt.Errorf("serveNFS: ConstructNode() failed: %s", err)
+	}
+
+	addrs, err := nfs.Addresses(node.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("serveNFS: %s", err)
+	}
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+
+	server, err := nfs.NewServer(node)
+	if err != nil {
+		return nil, fmt.Errorf("serveNFS: %s", err)
+	}
+
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("serveNFS: invalid NFS address: %q (err: %s)", addr, err)
+		}
+
+		lis, err := manet.Listen(maddr)
+		if err != nil {
+			return nil, fmt.Errorf("serveNFS: manet.Listen(%s) failed: %s", maddr, err)
+		}
+		fmt.Printf("NFS server listening on %s\n", lis.Multiaddr())
+
+		listeners = append(listeners, manet.NetListener(lis))
+	}
+
+	errc := make(chan error)
+	var wg sync.WaitGroup
+	for _, lis := range listeners {
+		wg.Add(1)
+		go func(lis net.Listener) {
+			defer wg.Done()
+			errc <- server.Serve(lis)
+		}(lis)
+	}
+
+	go func() {
+		wg.Wait()
+		close(errc)
+	}()
+
+	return errc, nil
+}
+
+// serve9P serves MFS and /ipfs over 9P on the addresses set by the
+// optional Addresses.9P key
+func serve9P(cctx *oldcmds.Context) (<-chan error, error) {
+	node, err := cctx.ConstructNode()
+	if err != nil {
+		return nil, fmt.Errorf("serve9P: ConstructNode() failed: %s", err)
+	}
+
+	addrs, err := p9.Addresses(node.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("serve9P: %s", err)
+	}
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+
+	server, err := p9.NewServer(node)
+	if err != nil {
+		return nil, fmt.Errorf("serve9P: %s", err)
+	}
+
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		maddr, err := ma.NewMultiaddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("serve9P: invalid 9P address: %q (err: %s)", addr, err)
+		}
+
+		lis, err := manet.Listen(maddr)
+		if err != nil {
+			return nil, fmt.Errorf("serve9P: manet.Listen(%s) failed: %s", maddr, err)
+		}
+		fmt.Printf("9P server listening on %s\n", lis.Multiaddr())
+
+		listeners = append(listeners, manet.NetListener(lis))
+	}
+
+	errc := make(chan error)
+	var wg sync.WaitGroup
+	for _, lis := range listeners {
+		wg.Add(1)
+		go func(lis net.Listener) {
+			defer wg.Done()
+			errc <- server.Serve(lis)
 		}(lis)
 	}
 
@@ -623,17 +977,37 @@ func mountFuse(req *cmds.Request, cctx *oldcmds.Context) error {
 		return fmt.Errorf("mountFuse: ConstructNode() failed: %s", err)
 	}
 
+	mfsdir, found := req.Options[mfsMountKwd].(string)
+	if !found {
+		if val, err := node.Repo.GetConfigKey("Mounts.MFS"); err == nil {
+			mfsdir, _ = val.(string)
+		}
+	}
+
 	err = nodeMount.Mount(node, fsdir, nsdir)
 	if err != nil {
 		return err
 	}
 	fmt.Printf("IPFS mounted at: %s\n", fsdir)
 	fmt.Printf("IPNS mounted at: %s\n", nsdir)
+
+	if mfsdir != "" {
+		if err := nodeMount.MountMFS(node, mfsdir); err != nil {
+			return err
+		}
+		fmt.Printf("MFS mounted at: %s\n", mfsdir)
+	}
 	return nil
 }
 
 func maybeRunGC(req *cmds.Request, node *core.IpfsNode) (<-chan error, error) {
-	enableGC, _ := req.Options[enableGCKwd].(bool)
+	enableGC, found := req.Options[enableGCKwd].(bool)
+	if !found {
+		var err error
+		if enableGC, err = configBool(node.Repo, "Datastore.GCEnabled"); err != nil {
+			return nil, err
+		}
+	}
 	if !enableGC {
 		return nil, nil
 	}
@@ -676,6 +1050,24 @@ func merge(cs ...<-chan error) <-chan error {
 	return out
 }
 
+// configBool reads an optional boolean key from the config. Missing keys
+// read as false.
+func configBool(r repo.Repo, key string) (bool, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return false, nil // not set
+	}
+
+	switch val := val.(type) {
+	case bool:
+		return val, nil
+	case string:
+		return val == "true", nil
+	default:
+		return false, fmt.Errorf("invalid value for %s: expected a boolean, got %v", key, val)
+	}
+}
+
 func YesNoPrompt(prompt string) bool {
 	var s string
 	for i := 0; i < 3; i++ {
@@ -701,3 +1093,39 @@ func printVersion() {
 	fmt.Printf("System version: %s\n", runtime.GOARCH+"/"+runtime.GOOS)
 	fmt.Printf("Golang version: %s\n", runtime.Version())
 }
+
+// gatewayOnlyConfig adjusts the config of a node that only serves the
+// gateway: it fetches content as a DHT client, without pubsub, and never
+// reprovides. It returns the routing option to use.
+func gatewayOnlyConfig(ncfg *core.BuildCfg, routingOption string) string {
+	ncfg.ExtraOpts["pubsub"] = false
+	ncfg.ExtraOpts["ipnsps"] = false
+	ncfg.ExtraOpts["noreprovide"] = true
+
+	if routingOption == routingOptionDHTKwd {
+		return routingOptionDHTClientKwd
+	}
+	return routingOption
+}
+
+// makeRoutingOption returns the routing of the node for the routing option.
+func makeRoutingOption(routingOption string, r repo.Repo) (core.RoutingOption, error) {
+	switch routingOption {
+	case routingOptionSupernodeKwd:
+		return nil, errors.New("supernode routing was never fully implemented and has been removed")
+	case routingOptionDHTClientKwd:
+		return core.DHTClientOption, nil
+	case routingOptionDHTKwd:
+		return core.DHTOption, nil
+	case routingOptionNoneKwd:
+		return core.NilRouterOption, nil
+	case routingOptionCustomKwd:
+		return core.CustomRoutingOption(r), nil
+	default:
+		opt, ok := core.RouterOption(routingOption)
+		if !ok {
+			return nil, fmt.Errorf("unrecognized routing option: %s", routingOption)
+		}
+		return opt, nil
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+
+	libp2p "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p"
+	mocknet "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/net/mock"
+	dht "gx/ipfs/QmXbPygnUKAPMwseE5U3hQA7Thn59GVm7pQrhkFV63umT8/go-libp2p-kad-dht"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+func TestGatewayOnlyConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	ncfg := &core.BuildCfg{
+		Online: true,
+		Host: func(ctx context.Context, id peer.ID, ps pstore.Peerstore, _ ...libp2p.Option) (p2phost.Host, error) {
+			return mn.AddPeerWithPeerstore(id, ps)
+		},
+		ExtraOpts: map[string]bool{
+			"pubsub": true,
+			"ipnsps": true,
+		},
+	}
+
+	routingOption := gatewayOnlyConfig(ncfg, routingOptionDHTKwd)
+	if routingOption != routingOptionDHTClientKwd {
+		t.Fatalf("expected the %s routing, got %s", routingOptionDHTClientKwd, routingOption)
+	}
+	var err error
+	ncfg.Routing, err = makeRoutingOption(routingOption, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := core.NewNode(ctx, ncfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+
+	if node.PubSub != nil {
+		t.Error("expected pubsub to be disabled")
+	}
+	for _, p := range node.PeerHost.Mux().Protocols() {
+		if p == string(dht.ProtocolDHT) {
+			t.Error("expected the DHT to run in client mode")
+		}
+	}
+
+	// give the reprovider the time to start
+	time.Sleep(100 * time.Millisecond)
+	if interval := node.Reprovider.Stat().Interval; interval != 0 {
+		t.Errorf("expected the blocks not to be reprovided, got an interval of %s", interval)
+	}
+}
@@ -25,6 +25,7 @@ var localCommands = map[string]*cmds.Command{
 	"daemon":   daemonCmd,
 	"init":     initCmd,
 	"commands": commandsClientCmd,
+	"repl":     replCmd,
 }
 
 func init() {
@@ -57,6 +58,11 @@ type cmdDetails struct {
 	// preemptsAutoUpdate describes commands that must be executed without the
 	// auto-update pre-command hook
 	preemptsAutoUpdate bool
+
+	// readOnly describes commands that don't modify the repo. When they run
+	// locally while another process, e.g. the daemon, has the repo locked,
+	// they open it read-only instead of failing.
+	readOnly bool
 }
 
 func (d *cmdDetails) String() string {
@@ -69,6 +75,7 @@ func (d *cmdDetails) Loggable() map[string]interface{} {
 		"canRunOnClient":     d.canRunOnClient(),
 		"canRunOnDaemon":     d.canRunOnDaemon(),
 		"preemptsAutoUpdate": d.preemptsAutoUpdate,
+		"readOnly":           d.readOnly,
 		"usesConfigAsInput":  d.usesConfigAsInput(),
 		"usesRepo":           d.usesRepo(),
 	}
@@ -84,13 +91,27 @@ func (d *cmdDetails) usesRepo() bool          { return !d.doesNotUseRepo }
 // properties so that other code can make decisions about whether to invoke a
 // command or return an error to the user.
 var cmdDetailsMap = map[string]cmdDetails{
-	"init":        {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
-	"daemon":      {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true},
-	"commands":    {doesNotUseRepo: true},
-	"version":     {doesNotUseConfigAsInput: true, doesNotUseRepo: true}, // must be permitted to run before init
-	"log":         {cannotRunOnClient: true},
-	"diag/cmds":   {cannotRunOnClient: true},
-	"repo/fsck":   {cannotRunOnDaemon: true},
-	"config/edit": {cannotRunOnDaemon: true, doesNotUseRepo: true},
-	"cid":         {doesNotUseRepo: true},
+	"init":          {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true, doesNotUseRepo: true},
+	"daemon":        {doesNotUseConfigAsInput: true, cannotRunOnDaemon: true},
+	"daemon/reload": {cannotRunOnClient: true},
+	"commands":      {doesNotUseRepo: true},
+	"version":       {doesNotUseConfigAsInput: true, doesNotUseRepo: true}, // must be permitted to run before init
+	"log":           {cannotRunOnClient: true},
+	"diag/cmds":     {cannotRunOnClient: true},
+	"repo/fsck":     {cannotRunOnDaemon: true},
+	"repo/convert":  {cannotRunOnDaemon: true},
+	"repo/compact":  {cannotRunOnDaemon: true},
+	"config/edit":   {cannotRunOnDaemon: true, doesNotUseRepo: true},
+	"cid":           {doesNotUseRepo: true},
+	"cat":           {readOnly: true},
+	"get":           {readOnly: true},
+	"ls":            {readOnly: true},
+	"refs":          {readOnly: true},
+	"block/get":     {readOnly: true},
+	"block/stat":    {readOnly: true},
+	"dag/get":       {readOnly: true},
+	"object/data":   {readOnly: true},
+	"object/get":    {readOnly: true},
+	"object/links":  {readOnly: true},
+	"object/stat":   {readOnly: true},
 }
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	commands "github.com/ipfs/go-ipfs/core/commands"
+
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+// Logging environment variables, read by go-log too
+const (
+	// envLoggingFmt selects the format of the log output: "color" (the
+	// default), "nocolor", or "json" for one JSON object per line.
+	envLoggingFmt = "IPFS_LOGGING_FMT"
+
+	// envLoggingFile names a file the log output is written to as well.
+	envLoggingFile = "GOLOG_FILE"
+)
+
+// go-log writes the log output to a pipe, in pipeLogFormat, and copyLog
+// formats it for stderr and GOLOG_FILE and mirrors it to 'ipfs log tail'
+// with the real level of the messages. The fields are separated by tabs and
+// the message is quoted as a Go string, so that every message fits on one
+// line.
+const (
+	pipeLogFormatName = "ipfs-pipe"
+	pipeLogFormat     = "%{time:" + time.RFC3339Nano + "}\t%{level}\t%{module}\t%{shortfile}\t%{message:q}"
+)
+
+var (
+	ansiGray  = "\033[0;37m"
+	ansiBlue  = "\033[0;34m"
+	ansiReset = "\033[0m"
+)
+
+// logColors are the colors of the levels in the "color" format, as set by
+// go-logging.
+var logColors = map[string]string{
+	"CRITICAL": "\033[35m",
+	"ERROR":    "\033[31m",
+	"WARNING":  "\033[33m",
+	"NOTICE":   "\033[32m",
+	"DEBUG":    "\033[36m",
+}
+
+// logRecord is a message of the log output.
+type logRecord struct {
+	Time    time.Time
+	Level   string
+	System  string
+	Caller  string
+	Message string
+}
+
+func parseLogRecord(line string) (*logRecord, error) {
+	fields := strings.SplitN(line, "\t", 5)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("malformed log record %q", line)
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return nil, err
+	}
+	msg, err := strconv.Unquote(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	return &logRecord{
+		Time:    t,
+		Level:   fields[1],
+		System:  fields[2],
+		Caller:  fields[3],
+		Message: msg,
+	}, nil
+}
+
+// logFormats write a log record in the formats of IPFS_LOGGING_FMT, those of
+// go-log and "json".
+var logFormats = map[string]func(w io.Writer, r *logRecord){
+	"color": func(w io.Writer, r *logRecord) {
+		fmt.Fprintf(w, "%s%s %s%5.5s %s%10.10s: %s%s %s%s%s\n",
+			ansiGray, r.Time.Format("15:04:05.000"), logColors[r.Level], r.Level,
+			ansiBlue, r.System, ansiReset, r.Message, ansiGray, r.Caller, ansiReset)
+	},
+	"nocolor": func(w io.Writer, r *logRecord) {
+		fmt.Fprintf(w, "%s %s %s %s: %s\n",
+			r.Time.Format("2006-01-02 15:04:05.000000"), r.Level, r.System, r.Caller, r.Message)
+	},
+	"json": writeJSONLogRecord,
+}
+
+// writeJSONLogRecord writes r as a JSON object with the time, level, system,
+// caller and message, on its own line. This is the format of the messages
+// mirrored to 'ipfs log tail'.
+func writeJSONLogRecord(w io.Writer, r *logRecord) {
+	b, err := json.Marshal(struct {
+		Time    string `json:"time"`
+		Level   string `json:"level"`
+		System  string `json:"system"`
+		Caller  string `json:"caller"`
+		Message string `json:"message"`
+	}{r.Time.Format("2006-01-02T15:04:05.000000Z07:00"), r.Level, r.System, r.Caller, r.Message})
+	if err != nil {
+		return
+	}
+	w.Write(append(b, '\n'))
+}
+
+// logDone is closed once copyLog copied the whole log output.
+var (
+	logPipe *os.File
+	logDone = make(chan struct{})
+)
+
+func init() {
+	format, ok := logFormats[os.Getenv(envLoggingFmt)]
+	if !ok {
+		format = logFormats["color"]
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR ipfs: %s: failed to set up the log output\n", err)
+		close(logDone)
+		return
+	}
+	outs := []io.Writer{os.Stderr}
+	if path := os.Getenv(envLoggingFile); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR ipfs: %s: failed to set the logging file\n", err)
+		} else {
+			outs = append(outs, f)
+		}
+	}
+	logPipe = w
+	go copyLog(r, format, io.MultiWriter(outs...))
+
+	// go-log set up the output on stderr before this ran, set it up again
+	// on the pipe. It reads the settings from the environment, restored
+	// afterwards so that the plugins and the commands run see them
+	// unchanged.
+	logging.LogFormats[pipeLogFormatName] = pipeLogFormat
+	restoreFmt := swapEnv(envLoggingFmt, pipeLogFormatName)
+	restoreFile := swapEnv(envLoggingFile, "")
+	stderr := os.Stderr
+	os.Stderr = w
+	logging.SetupLogging()
+	os.Stderr = stderr
+	restoreFile()
+	restoreFmt()
+}
+
+// swapEnv sets the environment variable key to value, unsetting it if value
+// is empty, and returns a function restoring it.
+func swapEnv(key, value string) func() {
+	old, set := os.LookupEnv(key)
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+	return func() {
+		if set {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// copyLog writes the log records read from r to out in format, and mirrors
+// them to commands.LogOutput while 'ipfs log tail' reads it.
+func copyLog(r io.Reader, format func(io.Writer, *logRecord), out io.Writer) {
+	defer close(logDone)
+
+	br := bufio.NewReader(r)
+	var buf bytes.Buffer
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			rec, perr := parseLogRecord(strings.TrimSuffix(line, "\n"))
+			if perr != nil {
+				// not written by go-log, pass it through
+				io.WriteString(out, line)
+			} else {
+				buf.Reset()
+				format(&buf, rec)
+				out.Write(buf.Bytes())
+
+				if commands.LogOutput.Active() {
+					buf.Reset()
+					writeJSONLogRecord(&buf, rec)
+					commands.LogOutput.Write(buf.Bytes())
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// flushLog waits for the log output written so far to be copied, before the
+// process exits. Nothing is logged afterwards.
+func flushLog() {
+	if logPipe != nil {
+		logPipe.Close()
+	}
+	<-logDone
+}
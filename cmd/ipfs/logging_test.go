@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLogRecord(t *testing.T) {
+	when := time.Date(2018, 9, 1, 12, 30, 15, 123456000, time.UTC)
+	for _, msg := range []string{
+		"plain message",
+		`a "quoted" message with \backslashes\`,
+		"a message\non several lines\twith tabs",
+		"non-ASCII é世 and control \x01 characters",
+	} {
+		line := strings.Join([]string{
+			when.Format(time.RFC3339Nano), "ERROR", "core", "core.go:42", strconv.Quote(msg),
+		}, "\t")
+		r, err := parseLogRecord(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		writeJSONLogRecord(&buf, r)
+		out := buf.String()
+		if strings.Count(out, "\n") != 1 || !strings.HasSuffix(out, "\n") {
+			t.Fatalf("expected a single line, got %q", out)
+		}
+
+		var rec map[string]string
+		if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+			t.Fatalf("%q: %s", out, err)
+		}
+		expected := map[string]string{
+			"time":    "2018-09-01T12:30:15.123456Z",
+			"level":   "ERROR",
+			"system":  "core",
+			"caller":  "core.go:42",
+			"message": msg,
+		}
+		for k, v := range expected {
+			if rec[k] != v {
+				t.Errorf("%q: expected %s %q, got %q", out, k, v, rec[k])
+			}
+		}
+	}
+}
+
+func TestParseLogRecordMalformed(t *testing.T) {
+	for _, line := range []string{
+		"panic: something went wrong",
+		"2018-09-01T12:30:15Z\tERROR\tcore\tcore.go:42",
+		"2018-09-01T12:30:15Z\tERROR\tcore\tcore.go:42\tunquoted message",
+	} {
+		if _, err := parseLogRecord(line); err == nil {
+			t.Errorf("expected %q not to parse", line)
+		}
+	}
+}
@@ -58,7 +58,9 @@ const (
 // - output the response
 // - if anything fails, print error, maybe with help
 func main() {
-	os.Exit(mainRet())
+	ret := mainRet()
+	flushLog()
+	os.Exit(ret)
 }
 
 func mainRet() int {
@@ -127,7 +129,28 @@ func mainRet() int {
 					return nil, errors.New("constructing node without a request")
 				}
 
+				repoPath := repoPath
+				if name, _ := req.Options[corecmds.RepoNameOption].(string); name != "" {
+					// without a daemon, named repos are used like
+					// any other repo.
+					repoPath, err = fsrepo.NamedRepoPath(repoPath, name)
+					if err != nil {
+						return nil, err
+					}
+					if !fsrepo.IsInitialized(repoPath) {
+						return nil, fmt.Errorf("no repo named %q", name)
+					}
+				}
+
 				r, err := fsrepo.Open(repoPath)
+				if err != nil && commandDetails(req.Path).readOnly {
+					// commands only reading the repo can share it with
+					// the process holding the lock.
+					if locked, _ := fsrepo.LockedByOtherProcess(repoPath); locked {
+						log.Debug("repo is locked, opening it read-only")
+						r, err = fsrepo.OpenReadOnly(repoPath)
+					}
+				}
 				if err != nil { // repo is owned by the node
 					return nil, err
 				}
@@ -392,6 +415,7 @@ func setupInterruptHandler(ctx context.Context) (io.Closer, context.Context) {
 
 		default:
 			fmt.Println("Received another interrupt before graceful shutdown, terminating...")
+			flushLog()
 			os.Exit(-1)
 		}
 	}
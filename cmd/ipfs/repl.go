@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	oldcmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
+	commands "github.com/ipfs/go-ipfs/core/commands"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	repo "github.com/ipfs/go-ipfs/repo"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+
+	manet "gx/ipfs/QmQVUtnrNGtCRkCMpXgpApfzQjc8FDaDVxHqWH8cnZQeh5/go-multiaddr-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	"gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds/cli"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+const (
+	replPrompt      = "ipfs> "
+	replHistoryFile = "repl_history"
+	replHistorySize = 1000
+)
+
+// Commands that make no sense inside of a repl session.
+var replDisabledCommands = map[string]bool{
+	"daemon": true,
+	"init":   true,
+	"repl":   true,
+}
+
+var replCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Run ipfs commands interactively.",
+		ShortDescription: `
+'ipfs repl' reads commands from the terminal and runs them, without the
+startup cost of a new 'ipfs' invocation for each of them. Commands are
+entered without the leading 'ipfs', e.g. 'id' or 'files ls /'.
+`,
+		LongDescription: `
+'ipfs repl' reads commands from the terminal and runs them, without the
+startup cost of a new 'ipfs' invocation for each of them. Commands are
+entered without the leading 'ipfs', e.g. 'id' or 'files ls /'.
+
+If a daemon is running, all commands are sent to it over a single HTTP API
+session. Otherwise the repl opens the repo once and starts an offline node
+that is used by all the commands of the session, until the repl exits.
+
+On a terminal, the usual line editing keys are available:
+
+  Tab             Complete command and option names
+  Up/Down         Browse the history, which is kept in $IPFS_PATH/repl_history
+  Ctrl-C          Cancel the current line, or interrupt the running command
+  Ctrl-D, 'exit'  End the session
+
+When the input is not a terminal, commands are read one per line, which
+allows running scripts without starting a new process per command:
+
+  ipfs repl < commands.txt
+`,
+	},
+	External: true,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cctx := env.(*oldcmds.Context)
+
+		s := &replSession{cctx: cctx}
+		if err := s.connect(req); err != nil {
+			return err
+		}
+
+		devNull, err := os.Open(os.DevNull)
+		if err != nil {
+			return err
+		}
+		defer devNull.Close()
+		s.stdin = devNull
+
+		if restore, err := makeRaw(int(os.Stdin.Fd())); err == nil {
+			defer restore()
+			return s.interactive(req.Context)
+		}
+		return s.script(req.Context, os.Stdin)
+	},
+}
+
+// replSession runs the commands of a repl against a single API endpoint.
+type replSession struct {
+	cctx    *oldcmds.Context
+	apiAddr string
+	stdin   *os.File
+}
+
+// connect finds the API to send commands to, starting a node serving it for
+// the session if no daemon is running.
+func (s *replSession) connect(req *cmds.Request) error {
+	if addr, _ := req.Options[commands.ApiOption].(string); addr != "" {
+		s.apiAddr = addr
+		return nil
+	}
+
+	addr, err := fsrepo.APIAddr(s.cctx.ConfigRoot)
+	switch err {
+	case nil:
+		s.apiAddr = addr.String()
+		return nil
+	case repo.ErrApiNotRunning:
+	default:
+		return err
+	}
+
+	cfg, err := s.cctx.GetConfig()
+	if err != nil {
+		return err
+	}
+	node, err := s.cctx.GetNode()
+	if err != nil {
+		return err
+	}
+
+	// The API is only meant for the commands of this session: listen on
+	// the loopback interface and don't advertise it in the repo.
+	maddr, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		return err
+	}
+	lis, err := manet.Listen(maddr)
+	if err != nil {
+		return err
+	}
+	s.apiAddr = lis.Multiaddr().String()
+
+	// It's served with the same options, and access checks, as the API of
+	// the daemon.
+	opts := apiServeOptions(s.cctx, cfg, false)
+	go func() {
+		// Serve returns once the node is closed at the end of the session.
+		err := corehttp.Serve(node, manet.NetListener(lis), opts...)
+		if err != nil {
+			log.Debugf("repl api server: %s", err)
+		}
+	}()
+	return nil
+}
+
+// buildEnv builds the environment of the commands of the session. They are
+// executed by the session's API, so no node is ever constructed for them.
+func (s *replSession) buildEnv(ctx context.Context, req *cmds.Request) (cmds.Environment, error) {
+	return &oldcmds.Context{
+		ConfigRoot: s.cctx.ConfigRoot,
+		LoadConfig: s.cctx.LoadConfig,
+		ReqLog:     &oldcmds.ReqLog{},
+		ConstructNode: func() (*core.IpfsNode, error) {
+			return nil, errors.New("this command can't run in the repl, run it with 'ipfs' directly")
+		},
+	}, nil
+}
+
+// run executes a single line of input. It returns false if the session
+// should end.
+func (s *replSession) run(ctx context.Context, line string) bool {
+	args, err := splitArgs(line)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return true
+	}
+	if len(args) > 0 && args[0] == "ipfs" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return true
+	}
+
+	switch {
+	case args[0] == "exit" || args[0] == "quit":
+		return false
+	case args[0] == "help":
+		args = append(args[1:], "--help")
+	case replDisabledCommands[args[0]]:
+		fmt.Fprintf(os.Stderr, "Error: 'ipfs %s' can't be run from the repl\n", args[0])
+		return true
+	}
+
+	cmdline := append([]string{"ipfs", "--" + commands.ApiOption + "=" + s.apiAddr}, args...)
+	// Errors are printed by cli.Run.
+	cli.Run(ctx, Root, cmdline, s.stdin, os.Stdout, os.Stderr, s.buildEnv, makeExecutor)
+	return true
+}
+
+// script runs the commands read from r, one per line.
+func (s *replSession) script(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !s.run(ctx, scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// interactive runs commands entered on the terminal, which is in raw mode.
+func (s *replSession) interactive(ctx context.Context) error {
+	keys := make(chan byte, 64)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			for _, b := range buf[:n] {
+				keys <- b
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	historyPath := filepath.Join(s.cctx.ConfigRoot, replHistoryFile)
+	ed := &lineEditor{
+		keys: keys,
+		out:  os.Stdout,
+		complete: func(line string) []string {
+			return replComplete(Root, line)
+		},
+		history: loadHistory(historyPath),
+	}
+	defer func() {
+		saveHistory(historyPath, ed.history)
+	}()
+
+	for ctx.Err() == nil {
+		line, err := ed.readLine(replPrompt)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Ctrl-C interrupts the running command, keys typed meanwhile are
+		// dropped.
+		lineCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			for {
+				select {
+				case k, ok := <-keys:
+					if !ok {
+						return
+					}
+					if k == keyCtrlC {
+						cancel()
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+		more := s.run(lineCtx, line)
+		close(done)
+		<-stopped
+		cancel()
+		if !more {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// replComplete returns the completions of the last word of line: the names
+// of the subcommands of the command being typed, or of its options when the
+// word starts with a dash.
+func replComplete(root *cmds.Command, line string) []string {
+	words := strings.Fields(line)
+	var word string
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	cmd := root
+	for _, w := range words {
+		if sub, ok := cmd.Subcommands[w]; ok {
+			cmd = sub
+		}
+	}
+
+	var candidates []string
+	if strings.HasPrefix(word, "-") {
+		for _, opts := range [][]cmdkit.Option{cmd.Options, root.Options} {
+			for _, opt := range opts {
+				for _, name := range opt.Names() {
+					if len(name) == 1 {
+						candidates = append(candidates, "-"+name)
+					} else {
+						candidates = append(candidates, "--"+name)
+					}
+				}
+			}
+		}
+	} else {
+		for name := range cmd.Subcommands {
+			if cmd == root && replDisabledCommands[name] {
+				continue
+			}
+			candidates = append(candidates, name)
+		}
+		if cmd == root {
+			candidates = append(candidates, "exit", "help")
+		}
+	}
+
+	seen := make(map[string]bool)
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) && !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func loadHistory(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var history []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		history = append(history, scanner.Text())
+	}
+	return history
+}
+
+func saveHistory(path string, history []string) {
+	if len(history) > replHistorySize {
+		history = history[len(history)-replHistorySize:]
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		log.Debugf("failed to save repl history: %s", err)
+		return
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, line := range history {
+		fmt.Fprintln(w, line)
+	}
+	if err := w.Flush(); err != nil {
+		log.Debugf("failed to save repl history: %s", err)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// lineEditor implements basic line editing on a terminal in raw mode, with
+// history and completion.
+type lineEditor struct {
+	keys     <-chan byte
+	out      io.Writer
+	complete func(line string) []string
+	history  []string
+
+	// state of the line being edited
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+// readLine reads a line, returning io.EOF when the input ends or Ctrl-D is
+// pressed on an empty line.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	hist := len(e.history)
+	var saved []rune
+
+	e.refresh()
+	for {
+		r, ok := e.readRune()
+		if !ok {
+			return "", io.EOF
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.buf)
+			if strings.TrimSpace(line) != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+				e.history = append(e.history, line)
+			}
+			return line, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			e.buf, e.pos = nil, 0
+			hist = len(e.history)
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+				e.pos--
+			}
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlB:
+			e.moveLeft()
+		case keyCtrlF:
+			e.moveRight()
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlU:
+			e.buf = append([]rune(nil), e.buf[e.pos:]...)
+			e.pos = 0
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP, keyCtrlN:
+			hist, saved = e.browseHistory(r == keyCtrlP, hist, saved)
+		case keyTab:
+			e.completeWord()
+		case keyEscape:
+			switch e.readEscape() {
+			case 'A':
+				hist, saved = e.browseHistory(true, hist, saved)
+			case 'B':
+				hist, saved = e.browseHistory(false, hist, saved)
+			case 'C':
+				e.moveRight()
+			case 'D':
+				e.moveLeft()
+			case 'H':
+				e.pos = 0
+			case 'F':
+				e.pos = len(e.buf)
+			case '~':
+				e.deleteForward()
+			}
+		default:
+			if r >= ' ' {
+				e.buf = append(e.buf, 0)
+				copy(e.buf[e.pos+1:], e.buf[e.pos:])
+				e.buf[e.pos] = r
+				e.pos++
+			}
+		}
+		e.refresh()
+	}
+}
+
+// refresh redraws the line and moves the cursor to its position.
+func (e *lineEditor) refresh() {
+	s := "\r" + e.prompt + string(e.buf) + "\x1b[K"
+	if back := len(e.buf) - e.pos; back > 0 {
+		s += fmt.Sprintf("\x1b[%dD", back)
+	}
+	fmt.Fprint(e.out, s)
+}
+
+func (e *lineEditor) moveLeft() {
+	if e.pos > 0 {
+		e.pos--
+	}
+}
+
+func (e *lineEditor) moveRight() {
+	if e.pos < len(e.buf) {
+		e.pos++
+	}
+}
+
+func (e *lineEditor) deleteForward() {
+	if e.pos < len(e.buf) {
+		e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	}
+}
+
+// browseHistory replaces the line with the previous (or next) history entry.
+// The line being edited is saved while browsing.
+func (e *lineEditor) browseHistory(back bool, hist int, saved []rune) (int, []rune) {
+	switch {
+	case back && hist > 0:
+		if hist == len(e.history) {
+			saved = e.buf
+		}
+		hist--
+		e.buf = []rune(e.history[hist])
+	case !back && hist < len(e.history):
+		hist++
+		if hist == len(e.history) {
+			e.buf = saved
+		} else {
+			e.buf = []rune(e.history[hist])
+		}
+	default:
+		return hist, saved
+	}
+	e.pos = len(e.buf)
+	return hist, saved
+}
+
+// completeWord completes the word before the cursor, when it is at the end
+// of the line. Candidates are listed if the word can't be completed further.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil || e.pos != len(e.buf) {
+		return
+	}
+
+	line := string(e.buf)
+	word := line[strings.LastIndex(line, " ")+1:]
+	candidates := e.complete(line)
+
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(e.out, "\a")
+	case 1:
+		e.insert(strings.TrimPrefix(candidates[0], word) + " ")
+	default:
+		prefix := commonPrefix(candidates)
+		if len(prefix) > len(word) {
+			e.insert(strings.TrimPrefix(prefix, word))
+			return
+		}
+		fmt.Fprint(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+	}
+}
+
+func (e *lineEditor) insert(s string) {
+	r := []rune(s)
+	e.buf = append(e.buf[:e.pos], append(r, e.buf[e.pos:]...)...)
+	e.pos += len(r)
+}
+
+// readRune reads a UTF-8 encoded character from the keys.
+func (e *lineEditor) readRune() (rune, bool) {
+	b, ok := <-e.keys
+	if !ok {
+		return 0, false
+	}
+	if b < utf8.RuneSelf {
+		return rune(b), true
+	}
+
+	p := []byte{b}
+	for !utf8.FullRune(p) {
+		b, ok := <-e.keys
+		if !ok {
+			return 0, false
+		}
+		p = append(p, b)
+	}
+	r, _ := utf8.DecodeRune(p)
+	return r, true
+}
+
+// readEscape reads the rest of an escape sequence, returning 'A' to 'D' for
+// the arrow keys, 'H' and 'F' for home and end, and '~' for delete.
+func (e *lineEditor) readEscape() byte {
+	b, ok := <-e.keys
+	if !ok || (b != '[' && b != 'O') {
+		return 0
+	}
+
+	var num byte
+	for {
+		b, ok := <-e.keys
+		if !ok {
+			return 0
+		}
+		if b >= '0' && b <= '9' {
+			num = b
+			continue
+		}
+		if b != '~' {
+			return b
+		}
+
+		// VT220 style sequences, e.g. "\x1b[3~" for delete.
+		switch num {
+		case '1', '7':
+			return 'H'
+		case '4', '8':
+			return 'F'
+		case '3':
+			return '~'
+		}
+		return 0
+	}
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// splitArgs splits a command line into arguments, following the quoting
+// rules of POSIX shells for single quotes, double quotes and backslashes.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args    []string
+		cur     []rune
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' && r != '$' && r != '`' {
+				cur = append(cur, '\\')
+			}
+			cur = append(cur, r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur = append(cur, r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, string(cur))
+				cur, inArg = nil, false
+			}
+		default:
+			cur = append(cur, r)
+			inArg = true
+		}
+	}
+
+	if escaped || quote != 0 {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, string(cur))
+	}
+	return args, nil
+}
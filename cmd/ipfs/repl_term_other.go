@@ -0,0 +1,11 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package main
+
+import "errors"
+
+// makeRaw is not supported on this platform, the repl reads its input line
+// by line.
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("terminal raw mode not supported")
+}
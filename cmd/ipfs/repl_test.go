@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+func TestSplitArgs(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		args []string
+		err  bool
+	}{
+		{"", nil, false},
+		{"  id  ", []string{"id"}, false},
+		{"files ls /", []string{"files", "ls", "/"}, false},
+		{`add "a b" 'c d'`, []string{"add", "a b", "c d"}, false},
+		{`echo a\ b "x\"y" 'x\y'`, []string{"echo", "a b", `x"y`, `x\y`}, false},
+		{`files write "" x`, []string{"files", "write", "", "x"}, false},
+		{`'unterminated`, nil, true},
+		{`trailing\`, nil, true},
+	} {
+		args, err := splitArgs(c.line)
+		if (err != nil) != c.err {
+			t.Errorf("%q: unexpected error: %v", c.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("%q: expected %q, got %q", c.line, c.args, args)
+		}
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	keys := make(chan byte, 256)
+	ed := &lineEditor{
+		keys: keys,
+		out:  &bytes.Buffer{},
+		complete: func(line string) []string {
+			return []string{"files", "filestore"}
+		},
+	}
+
+	readLine := func(input string) string {
+		for _, b := range []byte(input) {
+			keys <- b
+		}
+		line, err := ed.readLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return line
+	}
+
+	for _, c := range []struct {
+		input, expected string
+	}{
+		{"id\r", "id"},
+		{"ix\x7fd\r", "id"},
+		{"ab\x1b[Dx\r", "axb"},
+		{"bc\x01a\x05d\r", "abcd"},
+		{"abc\x1b[D\x1b[D\x1b[3~\r", "ac"},
+		{"xyz\x15version\r", "version"},
+		{"fi\t\r", "files"},
+		{"\x1b[A\x1b[A\r", "version"},
+		{"q\x1b[A\x1b[A\x1b[B\x1b[B\r", "q"},
+	} {
+		if line := readLine(c.input); line != c.expected {
+			t.Errorf("%q: expected %q, got %q", c.input, c.expected, line)
+		}
+	}
+
+	if !reflect.DeepEqual(ed.history, []string{"id", "axb", "abcd", "ac", "version", "files", "version", "q"}) {
+		t.Errorf("unexpected history: %q", ed.history)
+	}
+
+	keys <- keyCtrlD
+	if _, err := ed.readLine("> "); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestReplComplete(t *testing.T) {
+	root := &cmds.Command{
+		Options: []cmdkit.Option{
+			cmdkit.BoolOption("offline", "Run the command offline."),
+		},
+		Subcommands: map[string]*cmds.Command{
+			"files": {
+				Options: []cmdkit.Option{
+					cmdkit.BoolOption("flush", "f", "Flush the changes."),
+				},
+				Subcommands: map[string]*cmds.Command{
+					"ls": {},
+				},
+			},
+			"filestore": {},
+			"repl":      {},
+		},
+	}
+
+	for _, test := range []struct {
+		line     string
+		expected []string
+	}{
+		{"fi", []string{"files", "filestore"}},
+		{"re", nil},
+		{"files ", []string{"ls"}},
+		{"files --f", []string{"--flush"}},
+		{"files -", []string{"--flush", "--offline", "-f"}},
+		{"ex", []string{"exit"}},
+	} {
+		if out := replComplete(root, test.line); !reflect.DeepEqual(out, test.expected) {
+			t.Errorf("%q: expected %q, got %q", test.line, test.expected, out)
+		}
+	}
+}
@@ -17,6 +17,7 @@ func TestRunMain(t *testing.T) {
 	args := flag.Args()
 	os.Args = append([]string{os.Args[0]}, args...)
 	ret := mainRet()
+	flushLog()
 
 	p := os.Getenv("IPFS_COVER_RET_FILE")
 	if len(p) != 0 {
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	delegate "github.com/ipfs/go-ipfs/exchange/delegate"
+	rp "github.com/ipfs/go-ipfs/exchange/reprovide"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+)
+
+// newAnnouncer returns the content routing announcing the content of the
+// node: its routing system, and the indexers of the optional
+// Reprovider.Delegates config key.
+func (n *IpfsNode) newAnnouncer(ctx context.Context) (routing.ContentRouting, error) {
+	urls, err := configStrings(n.Repo, "Reprovider.Delegates")
+	if err != nil {
+		return nil, err
+	}
+	only, err := configBool(n.Repo, "Reprovider.DelegateOnly")
+	if err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		if only {
+			return nil, errors.New("Reprovider.DelegateOnly is set without Reprovider.Delegates")
+		}
+		return n.Routing, nil
+	}
+
+	clients := make([]*delegate.Client, len(urls))
+	for i, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for Reprovider.Delegates: %s", err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("invalid value for Reprovider.Delegates: expected an http or https URL, got %q", u)
+		}
+		clients[i] = delegate.NewClient(u, n.Identity, n.PeerHost.Addrs)
+	}
+	return delegate.Wrap(ctx, n.Routing, clients, only), nil
+}
+
+// provideFilter returns the filter of the keys announced set by the optional
+// Reprovider.Codecs and Reprovider.Prefixes config keys, nil if all the keys
+// are announced.
+func provideFilter(r repo.Repo) (*rp.Filter, error) {
+	codecs, err := configStrings(r, "Reprovider.Codecs")
+	if err != nil {
+		return nil, err
+	}
+	prefixes, err := configStrings(r, "Reprovider.Prefixes")
+	if err != nil {
+		return nil, err
+	}
+	if len(codecs) == 0 && len(prefixes) == 0 {
+		return nil, nil
+	}
+	f, err := rp.NewFilter(codecs, prefixes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for Reprovider.Codecs: %s", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,161 @@
+// Package audit records the operations changing the content or the state of
+// a node in an append-only log, for the deployments which must track what
+// was ingested, by whom and when.
+//
+// The log is a file of JSON entries, one per line. Once it reaches its
+// maximum size, it is renamed with the time of the rotation appended, e.g.
+// audit.log.20181016T120000Z, and a new one is started. The rotated files
+// are never removed nor written to again.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is an operation recorded.
+type Entry struct {
+	Time time.Time
+
+	// Who is the caller: the remote address of the API clients, the user
+	// running the command for the CLI
+	Who string
+
+	// Via is how the operation was called, "api" or "cli"
+	Via string
+
+	// Agent is the user agent of the API clients
+	Agent string `json:",omitempty"`
+
+	// Command is the path of the command, e.g. "pin/add"
+	Command string
+
+	Arguments []string               `json:",omitempty"`
+	Options   map[string]interface{} `json:",omitempty"`
+
+	// Results are the CIDs and paths the operation resulted in
+	Results []string `json:",omitempty"`
+
+	// Error is the error the operation failed with, if any
+	Error string `json:",omitempty"`
+
+	Duration time.Duration
+}
+
+// Log is an append-only log of entries.
+type Log struct {
+	path    string
+	maxSize int64
+
+	lk   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// Open opens the log at path, appending to it if it exists. It is rotated
+// once it is over maxSize bytes, never if maxSize is 0.
+func Open(path string, maxSize int64) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = st.Size()
+	return nil
+}
+
+// Record appends e to the log, and syncs it to the disk.
+func (l *Log) Record(e *Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.f == nil {
+		return os.ErrClosed
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(e.Time); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.f.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return l.f.Sync()
+}
+
+// rotate renames the log with the time t appended, and starts a new one.
+func (l *Log) rotate(t time.Time) error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+
+	name := fmt.Sprintf("%s.%s", l.path, t.UTC().Format("20060102T150405Z"))
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		// rotated twice within a second
+		name = fmt.Sprintf("%s.%s.%d", l.path, t.UTC().Format("20060102T150405Z"), i)
+	}
+	if err := os.Rename(l.path, name); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// Close closes the log.
+func (l *Log) Close() error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+type callerKey struct{}
+
+type caller struct {
+	who, via, agent string
+}
+
+// WithCaller returns a context recording who called an operation, via the
+// api or the cli, with the user agent of the API clients.
+func WithCaller(ctx context.Context, who, via, agent string) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller{who: who, via: via, agent: agent})
+}
+
+// Caller returns who called the operation of ctx, via what and with which
+// user agent, empty if unknown.
+func Caller(ctx context.Context) (who, via, agent string) {
+	c, _ := ctx.Value(callerKey{}).(caller)
+	return c.who, c.via, c.agent
+}
@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var out []Entry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, e)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Entry{
+		Time:      time.Now(),
+		Who:       "alice",
+		Via:       "cli",
+		Command:   "pin/add",
+		Arguments: []string{"QmFoo"},
+		Options:   map[string]interface{}{"recursive": true},
+		Results:   []string{"QmFoo"},
+	}
+	if err := l.Record(e); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if err := l.Record(e); err != os.ErrClosed {
+		t.Fatalf("expected ErrClosed once closed, got %v", err)
+	}
+
+	// reopening appends
+	l, err = Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Command = "pin/rm"
+	if err := l.Record(e); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	entries := readEntries(t, path)
+	if len(entries) != 2 || entries[0].Command != "pin/add" || entries[1].Command != "pin/rm" {
+		t.Fatalf("expected both entries, got %+v", entries)
+	}
+	if entries[0].Who != "alice" || entries[0].Results[0] != "QmFoo" || entries[0].Options["recursive"] != true {
+		t.Fatalf("unexpected entry %+v", entries[0])
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	now := time.Date(2018, 10, 16, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := l.Record(&Entry{Time: now, Who: "alice", Via: "cli", Command: "add"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 || rotated[0] != path+".20181016T120000Z" || rotated[1] != path+".20181016T120000Z.1" {
+		t.Fatalf("expected the log to be rotated twice, got %v", rotated)
+	}
+	for _, p := range append(rotated, path) {
+		if n := len(readEntries(t, p)); n != 1 {
+			t.Fatalf("expected one entry in %s, got %d", p, n)
+		}
+	}
+}
+
+func TestCaller(t *testing.T) {
+	ctx := context.Background()
+	if who, via, _ := Caller(ctx); who != "" || via != "" {
+		t.Fatal("expected no caller")
+	}
+	ctx = WithCaller(ctx, "127.0.0.1:1234", "api", "curl/7.0")
+	if who, via, agent := Caller(ctx); who != "127.0.0.1:1234" || via != "api" || agent != "curl/7.0" {
+		t.Fatalf("unexpected caller %q %q %q", who, via, agent)
+	}
+}
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+
+	audit "github.com/ipfs/go-ipfs/core/audit"
+	repo "github.com/ipfs/go-ipfs/repo"
+)
+
+// defaultAuditMaxSize is the size at which the audit log is rotated unless
+// Audit.MaxSize is set.
+const defaultAuditMaxSize = 100 << 20
+
+// setupAudit opens the audit log at Audit.Path, if set. The named repos
+// record their operations in the log of their parent.
+func (n *IpfsNode) setupAudit() error {
+	if n.parent != nil {
+		return nil
+	}
+
+	path, err := configString(n.Repo, "Audit.Path")
+	if err != nil || path == "" {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		pr, ok := n.Repo.(interface{ Path() string })
+		if !ok {
+			return errors.New("invalid value for Audit.Path: the path must be absolute, the repo is not on disk")
+		}
+		path = filepath.Join(pr.Path(), path)
+	}
+
+	maxSize, err := auditMaxSize(n.Repo)
+	if err != nil {
+		return err
+	}
+	n.audit, err = audit.Open(path, int64(maxSize))
+	return err
+}
+
+// auditMaxSize returns the size at which the audit log is rotated, set by the
+// optional Audit.MaxSize key, 0 disabling the rotation.
+func auditMaxSize(r repo.Repo) (uint64, error) {
+	if _, err := r.GetConfigKey("Audit.MaxSize"); err != nil {
+		return defaultAuditMaxSize, nil // not set
+	}
+	return configBytes(r, "Audit.MaxSize")
+}
+
+// AuditLog returns the log the operations on the node are recorded in, nil
+// unless Audit.Path is set.
+func (n *IpfsNode) AuditLog() *audit.Log {
+	if n.parent != nil {
+		return n.parent.AuditLog()
+	}
+	return n.audit
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	relaylimit "github.com/ipfs/go-ipfs/core/relaylimit"
+
+	circuit "gx/ipfs/QmNcNWuV38HBGYtRUi3okmfXSMEmXWwNgb82N3PzqqsHhY/go-libp2p-circuit"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	libp2p "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	record "gx/ipfs/QmfARXVCzpwFXQdepAJZuqyNDgV9doEsMnVCo1ssmuSe1U/go-libp2p-record"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+// autoRelayOptions returns the libp2p options of AutoRelay when
+// Swarm.EnableAutoRelay is set, and the routing option to build the routing
+// system of the node with.
+//
+// AutoRelay finds relays through the routing system, so the routing system
+// is built along the host, and the routing option returned returns it. The
+// node tells with AutoNAT whether it is reachable, and announces the
+// addresses of the relays it keeps connections to while it isn't. With
+// Swarm.EnableRelayHop, the node advertises itself as a relay instead.
+//
+// The relays limit the circuits they relay, to the nodes holding a
+// reservation, see setupRelayLimits, so the node reserves a slot at the
+// relays it announces addresses through, see reserveRelays.
+func (n *IpfsNode) autoRelayOptions(ctx context.Context, cfg *config.Config, routingOption RoutingOption) ([]libp2p.Option, RoutingOption, error) {
+	enabled, err := configBool(n.Repo, "Swarm.EnableAutoRelay")
+	if err != nil || !enabled {
+		return nil, routingOption, err
+	}
+	if cfg.Swarm.DisableRelay {
+		return nil, nil, errors.New("Swarm.EnableAutoRelay needs the relay transport, unset Swarm.DisableRelay")
+	}
+
+	var built routing.IpfsRouting
+	opts := []libp2p.Option{
+		libp2p.Routing(func(h p2phost.Host) (routing.PeerRouting, error) {
+			r, err := routingOption(ctx, h, n.Repo.Datastore(), n.RecordValidator)
+			if err != nil {
+				return nil, err
+			}
+			built = r
+			return r, nil
+		}),
+		libp2p.EnableAutoRelay(),
+	}
+	withHost := func(ctx context.Context, h p2phost.Host, d ds.Batching, v record.Validator) (routing.IpfsRouting, error) {
+		// hosts constructed without the libp2p options, such as those of
+		// mocknet, didn't build it
+		if built == nil {
+			return routingOption(ctx, h, d, v)
+		}
+		return built, nil
+	}
+	return opts, withHost, nil
+}
+
+// relayReservationInterval is the time between two checks of the relays the
+// node announces addresses through, to reserve a slot at the new ones.
+const relayReservationInterval = time.Minute
+
+// setupRelayLimits limits the circuits relayed with Swarm.EnableRelayHop to
+// the limits of Swarm.RelayLimits, the defaults of the relays of the version
+// 2 of the circuit relay protocol. The peers using relays that don't reserve
+// slots would lose their circuits, so the limits are only enforced with
+// Swarm.EnableRelayLimits.
+func (n *IpfsNode) setupRelayLimits(cfg *config.Config) error {
+	if cfg.Swarm.DisableRelay || !cfg.Swarm.EnableRelayHop {
+		return nil
+	}
+	enabled, err := configBool(n.Repo, "Swarm.EnableRelayLimits")
+	if err != nil || !enabled {
+		return err
+	}
+
+	limits := relaylimit.DefaultLimits
+	if limits.ReservationTTL, err = configDuration(n.Repo, "Swarm.RelayLimits.ReservationTTL", limits.ReservationTTL); err != nil {
+		return err
+	}
+	if limits.MaxReservations, err = configInt(n.Repo, "Swarm.RelayLimits.MaxReservations", limits.MaxReservations); err != nil {
+		return err
+	}
+	if limits.MaxCircuits, err = configInt(n.Repo, "Swarm.RelayLimits.MaxCircuits", limits.MaxCircuits); err != nil {
+		return err
+	}
+	if limits.Duration, err = configDuration(n.Repo, "Swarm.RelayLimits.Duration", limits.Duration); err != nil {
+		return err
+	}
+	data, err := configBytes(n.Repo, "Swarm.RelayLimits.Data")
+	if err != nil {
+		return err
+	}
+	if data > 0 {
+		limits.Data = int64(data)
+	}
+	if limits.ReservationTTL <= 0 || limits.Duration <= 0 {
+		return fmt.Errorf("invalid value for Swarm.RelayLimits: expected positive durations")
+	}
+
+	_, err = relaylimit.New(n.PeerHost, limits)
+	if err == relaylimit.ErrUnsupportedNetwork {
+		// hosts such as those of mocknet
+		log.Warning("the circuits relayed can't be limited on this network")
+		return nil
+	}
+	return err
+}
+
+// reserveRelays keeps a reservation at the relays the node announces
+// addresses through with AutoRelay, renewing them halfway through their ttl.
+func (n *IpfsNode) reserveRelays(proc goprocess.Process) {
+	ctx, cancel := context.WithCancel(n.Context())
+	defer cancel()
+
+	renew := make(map[peer.ID]time.Time)
+	t := time.NewTicker(relayReservationInterval)
+	defer t.Stop()
+	for {
+		now := time.Now()
+		relays := relaysOf(n.PeerHost.Addrs())
+		for relay := range renew {
+			if !relays[relay] {
+				delete(renew, relay)
+			}
+		}
+		for relay := range relays {
+			if now.Before(renew[relay]) {
+				continue
+			}
+			ttl, err := relaylimit.Reserve(ctx, n.PeerHost, relay)
+			if err != nil {
+				// relays which don't limit the circuits don't need any
+				log.Debugf("reserving a slot at relay %s: %s", relay.Pretty(), err)
+				renew[relay] = now.Add(relayReservationInterval)
+				continue
+			}
+			renew[relay] = now.Add(ttl / 2)
+		}
+
+		select {
+		case <-t.C:
+		case <-proc.Closing():
+			return
+		}
+	}
+}
+
+// relaysOf returns the relays of the circuit addresses of addrs.
+func relaysOf(addrs []ma.Multiaddr) map[peer.ID]bool {
+	relays := make(map[peer.ID]bool)
+	for _, addr := range addrs {
+		if _, err := addr.ValueForProtocol(circuit.P_CIRCUIT); err != nil {
+			continue
+		}
+		s, err := addr.ValueForProtocol(ma.P_IPFS)
+		if err != nil {
+			continue
+		}
+		if id, err := peer.IDB58Decode(s); err == nil {
+			relays[id] = true
+		}
+	}
+	return relays
+}
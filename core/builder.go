@@ -5,14 +5,24 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"os"
 	"syscall"
 	"time"
 
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+	tracing "github.com/ipfs/go-ipfs/core/tracing"
+	peerfilter "github.com/ipfs/go-ipfs/exchange/peerfilter"
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
+	providequeue "github.com/ipfs/go-ipfs/exchange/providequeue"
+	throttle "github.com/ipfs/go-ipfs/exchange/throttle"
 	filestore "github.com/ipfs/go-ipfs/filestore"
 	pin "github.com/ipfs/go-ipfs/pin"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
 	repo "github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/thirdparty/cachebs"
 	cidv0v1 "github.com/ipfs/go-ipfs/thirdparty/cidv0v1"
+	"github.com/ipfs/go-ipfs/thirdparty/quotabs"
 	"github.com/ipfs/go-ipfs/thirdparty/verifbs"
 	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
 	resolver "gx/ipfs/QmZErC2Ay6WuGi96CPg316PwitdwgLo6RxZRqVjJjRj2MR/go-path/resolver"
@@ -20,6 +30,7 @@ import (
 	uio "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs/io"
 
 	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	ipns "gx/ipfs/QmPrt2JqvtFcgMBmYBjtZ5jFzq6HoFXy8PTwLb2Dpm2cGf/go-ipns"
 	libp2p "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p"
 	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
@@ -37,6 +48,257 @@ import (
 	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
 )
 
+// newStorageQuota wraps bs to track the storage used by the repo, with the
+// limits set by Datastore.StorageMax and Datastore.StorageGCWatermark.
+func newStorageQuota(r repo.Repo, conf *cfg.Config, bs bstore.Blockstore) (*quotabs.Blockstore, error) {
+	max, err := humanize.ParseBytes(conf.Datastore.StorageMax)
+	if err != nil {
+		return nil, err
+	}
+	watermark := uint64(conf.Datastore.StorageGCWatermark)
+	if watermark == 0 {
+		watermark = 90
+	}
+
+	usage, err := r.GetStorageUsage()
+	if err != nil {
+		return nil, err
+	}
+	return quotabs.New(bs, usage, max, max*watermark/100), nil
+}
+
+// blockCacheOpts returns the options of the blockstore caches. Besides
+// Datastore.BloomFilterSize, they are set by the optional
+// Datastore.BloomFilterHashes and Datastore.ARCCacheSize keys, 0 disabling
+// the cache.
+func blockCacheOpts(r repo.Repo, conf *cfg.Config) (bstore.CacheOpts, error) {
+	opts := bstore.DefaultCacheOpts()
+	opts.HasBloomFilterSize = conf.Datastore.BloomFilterSize
+
+	var err error
+	opts.HasBloomFilterHashes, err = configInt(r, "Datastore.BloomFilterHashes", opts.HasBloomFilterHashes)
+	if err != nil {
+		return opts, err
+	}
+	opts.HasARCCacheSize, err = configInt(r, "Datastore.ARCCacheSize", opts.HasARCCacheSize)
+	return opts, err
+}
+
+// configInt reads an optional integer config key that has no counterpart in
+// the config struct. Missing keys read as def.
+func configInt(r repo.Repo, key string, def int) (int, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return def, nil // not set
+	}
+
+	switch val := val.(type) {
+	case float64:
+		return int(val), nil
+	case int:
+		return val, nil
+	default:
+		return 0, fmt.Errorf("invalid value for %s: expected a number, got %v", key, val)
+	}
+}
+
+// configBool reads an optional boolean config key that has no counterpart in
+// the config struct. Missing keys read as false.
+func configBool(r repo.Repo, key string) (bool, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return false, nil // not set
+	}
+
+	switch val := val.(type) {
+	case bool:
+		return val, nil
+	case string:
+		return val == "true", nil
+	default:
+		return false, fmt.Errorf("invalid value for %s: expected a boolean, got %v", key, val)
+	}
+}
+
+// configDuration reads an optional duration config key that has no
+// counterpart in the config struct. Missing keys read as def.
+func configDuration(r repo.Repo, key string, def time.Duration) (time.Duration, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return def, nil // not set
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid value for %s: expected a duration, got %v", key, val)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %s", key, err)
+	}
+	return d, nil
+}
+
+// configString reads an optional string config key that has no counterpart
+// in the config struct. Missing keys read as "".
+func configString(r repo.Repo, key string) (string, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil || val == nil {
+		return "", nil // not set
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid value for %s: expected a string, got %v", key, val)
+	}
+	return s, nil
+}
+
+// configStrings reads an optional list of strings config key that has no
+// counterpart in the config struct. Missing keys read as nil.
+func configStrings(r repo.Repo, key string) ([]string, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil || val == nil {
+		return nil, nil // not set
+	}
+
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid value for %s: expected a list of strings, got %v", key, val)
+	}
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s: expected a list of strings, got %v", key, val)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// configStringMap reads an optional object of strings config key that has no
+// counterpart in the config struct. Missing keys read as nil.
+func configStringMap(r repo.Repo, key string) (map[string]string, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil || val == nil {
+		return nil, nil // not set
+	}
+
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid value for %s: expected an object of strings, got %v", key, val)
+	}
+	out := make(map[string]string, len(obj))
+	for k, v := range obj {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s.%s: expected a string, got %v", key, k, v)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
+
+// configBytes reads an optional size config key that has no counterpart in
+// the config struct, either a number of bytes or a string like "1MB". Missing
+// keys read as 0.
+func configBytes(r repo.Repo, key string) (uint64, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil || val == nil {
+		return 0, nil // not set
+	}
+
+	switch val := val.(type) {
+	case float64:
+		if val < 0 {
+			return 0, fmt.Errorf("invalid value for %s: negative size", key)
+		}
+		return uint64(val), nil
+	case string:
+		size, err := humanize.ParseBytes(val)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %s: %s", key, err)
+		}
+		return size, nil
+	default:
+		return 0, fmt.Errorf("invalid value for %s: expected a size, got %v", key, val)
+	}
+}
+
+// filesShardSize returns the size of the block of the MFS directories
+// converted to HAMT shards, set by the optional Files.ShardingThreshold key.
+// The directories aren't converted without it.
+func filesShardSize(r repo.Repo) (uint64, error) {
+	if _, err := r.GetConfigKey("Files.ShardingThreshold"); err != nil {
+		return 0, nil // not set
+	}
+	return configBytes(r, "Files.ShardingThreshold")
+}
+
+// filesFlushPolicy returns the policy flushing the changes of MFS, set by the
+// optional Files.FlushInterval and Files.FlushOps keys. Without them, every
+// change is flushed.
+func filesFlushPolicy(r repo.Repo) (corefiles.FlushPolicy, error) {
+	var policy corefiles.FlushPolicy
+	var err error
+	policy.Interval, err = configDuration(r, "Files.FlushInterval", 0)
+	if err != nil {
+		return policy, err
+	}
+	policy.Ops, err = configInt(r, "Files.FlushOps", 0)
+	if err != nil {
+		return policy, err
+	}
+	if policy.Interval < 0 || policy.Ops < 0 {
+		return policy, fmt.Errorf("invalid MFS flush policy: negative Files.FlushInterval or Files.FlushOps")
+	}
+	return policy, nil
+}
+
+// bitswapLimits returns the rate limits of bitswap, in bytes per second, set
+// by the optional Bitswap.MaxUploadRate, Bitswap.MaxDownloadRate,
+// Bitswap.MaxPeerUploadRate and Bitswap.MaxPeerDownloadRate keys.
+func bitswapLimits(r repo.Repo) (throttle.Limits, error) {
+	var limits throttle.Limits
+	for key, rate := range map[string]*uint64{
+		"Bitswap.MaxUploadRate":       &limits.Upload,
+		"Bitswap.MaxDownloadRate":     &limits.Download,
+		"Bitswap.MaxPeerUploadRate":   &limits.PeerUpload,
+		"Bitswap.MaxPeerDownloadRate": &limits.PeerDownload,
+	} {
+		var err error
+		if *rate, err = configBytes(r, key); err != nil {
+			return limits, err
+		}
+	}
+	return limits, nil
+}
+
+// bitswapPeerFilter returns the filter of the peers served blocks, set by the
+// optional Bitswap.AllowPeers and Bitswap.DenyPeers keys, or nil if neither
+// is set.
+func bitswapPeerFilter(r repo.Repo) (*peerfilter.Filter, error) {
+	var lists [2][]peer.ID
+	for i, key := range []string{"Bitswap.AllowPeers", "Bitswap.DenyPeers"} {
+		ids, err := configStrings(r, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range ids {
+			p, err := peer.IDB58Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer ID in %s: %s", key, err)
+			}
+			lists[i] = append(lists[i], p)
+		}
+	}
+	if len(lists[0]) == 0 && len(lists[1]) == 0 {
+		return nil, nil
+	}
+	return peerfilter.New(lists[0], lists[1]), nil
+}
+
 type BuildCfg struct {
 	// If online is set, the node will have networking enabled
 	Online bool
@@ -58,6 +320,10 @@ type BuildCfg struct {
 	Routing RoutingOption
 	Host    HostOption
 	Repo    repo.Repo
+
+	// parent is the node serving the named repo of the node, whose
+	// network services the node uses
+	parent *IpfsNode
 }
 
 func (cfg *BuildCfg) getOpt(key string) bool {
@@ -155,6 +421,10 @@ func NewNode(ctx context.Context, cfg *BuildCfg) (*IpfsNode, error) {
 		n.mode = onlineMode
 	}
 
+	if cfg.parent == nil {
+		n.Repos = newNamedRepos(n)
+	}
+
 	// TODO: this is a weird circular-ish dependency, rework it
 	n.proc = goprocessctx.WithContextAndTeardown(ctx, n.teardown)
 
@@ -192,7 +462,6 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 	bs := bstore.NewBlockstore(rds)
 	bs = &verifbs.VerifBS{Blockstore: bs}
 
-	opts := bstore.DefaultCacheOpts()
 	conf, err := n.Repo.Config()
 	if err != nil {
 		return err
@@ -200,17 +469,35 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 
 	// TEMP: setting global sharding switch here
 	uio.UseHAMTSharding = conf.Experimental.ShardingEnabled
-
-	opts.HasBloomFilterSize = conf.Datastore.BloomFilterSize
-	if !cfg.Permanent {
-		opts.HasBloomFilterSize = 0
+	if !conf.Experimental.ShardingEnabled {
+		n.FilesShardSize, err = filesShardSize(n.Repo)
+		if err != nil {
+			return err
+		}
 	}
 
 	if !cfg.NilRepo {
-		bs, err = bstore.CachedBlockstore(ctx, bs, opts)
+		opts, err := blockCacheOpts(n.Repo, conf)
+		if err != nil {
+			return err
+		}
+		if !cfg.Permanent {
+			opts.HasBloomFilterSize = 0
+		}
+
+		n.BlockCache, err = cachebs.New(ctx, bs, opts)
 		if err != nil {
 			return err
 		}
+		bs = n.BlockCache
+
+		if conf.Datastore.StorageMax != "" {
+			n.StorageQuota, err = newStorageQuota(n.Repo, conf, bs)
+			if err != nil {
+				return err
+			}
+			bs = n.StorageQuota
+		}
 	}
 
 	bs = bstore.NewIdStore(bs)
@@ -228,6 +515,15 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		n.Blockstore = &verifbs.VerifBSGC{GCBlockstore: n.Blockstore}
 	}
 
+	// allow garbage collections to run concurrently with adds
+	tbs := gc.NewTrackingBlockstore(n.Blockstore)
+	grace, err := configDuration(n.Repo, "Datastore.GCGracePeriod", 0)
+	if err != nil {
+		return err
+	}
+	tbs.SetGracePeriod(grace)
+	n.Blockstore = tbs
+
 	rcfg, err := n.Repo.Config()
 	if err != nil {
 		return err
@@ -247,8 +543,16 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		You will not be able to connect to any nodes configured to use encrypted connections`)
 	}
 
-	if cfg.Online {
-		do := setupDiscoveryOption(rcfg.Discovery)
+	if cfg.Online && cfg.parent != nil {
+		if err := n.useParentServices(cfg.parent); err != nil {
+			return err
+		}
+	} else if cfg.Online {
+		tag, err := mdnsServiceTag(n.Repo)
+		if err != nil {
+			return err
+		}
+		do := setupDiscoveryOption(rcfg.Discovery, tag)
 		if err := n.startOnlineServices(ctx, cfg.Routing, hostOption, do, cfg.getOpt("pubsub"), cfg.getOpt("ipnsps"), cfg.getOpt("mplex")); err != nil {
 			return err
 		}
@@ -256,7 +560,23 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 		n.Exchange = offline.Exchange(n.Blockstore)
 	}
 
-	n.Blocks = bserv.New(n.Blockstore, n.Exchange)
+	// the fetches of the named repos are scheduled by the exchange of their
+	// parent, see childExchange
+	exch := n.Exchange
+	if cfg.parent == nil {
+		exch = priority.Wrap(n.Exchange, n.wantPriorities)
+	}
+	if cfg.Online && cfg.parent == nil {
+		n.Repos.exchange = exch
+		exch = &parentExchange{Interface: exch, wants: n.Repos.blocks}
+	}
+	if n.ProvideQueue != nil {
+		exch = providequeue.WrapExchange(exch, n.ProvideQueue)
+	}
+	if tracing.Enabled() {
+		exch = tracing.WrapExchange(exch)
+	}
+	n.Blocks = bserv.New(n.Blockstore, exch)
 	n.DAG = dag.NewDAGService(n.Blocks)
 
 	internalDag := dag.NewDAGService(bserv.New(n.Blockstore, offline.Exchange(n.Blockstore)))
@@ -270,11 +590,22 @@ func setupNode(ctx context.Context, n *IpfsNode, cfg *BuildCfg) error {
 	}
 	n.Resolver = resolver.NewBasicResolver(n.DAG)
 
-	if cfg.Online {
-		if err := n.startLateOnlineServices(ctx); err != nil {
+	if cfg.Online && cfg.parent == nil {
+		if err := n.startLateOnlineServices(ctx, !cfg.getOpt("noreprovide")); err != nil {
 			return err
 		}
 	}
 
-	return n.loadFilesRoot()
+	if err := n.loadFilesRoot(); err != nil {
+		return err
+	}
+	policy, err := filesFlushPolicy(n.Repo)
+	if err != nil {
+		return err
+	}
+	n.FilesFlusher = corefiles.NewFlusher(n.FilesRoot, policy)
+	if err := n.setupAudit(); err != nil {
+		return err
+	}
+	return n.setupWebhooks()
 }
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"context"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+)
+
+// clientOnlyBlockstore is the blockstore of the exchanges of the nodes set to
+// only fetch blocks, see Bitswap.ClientOnly. The blocks fetched are stored,
+// and Has answers so that the blocks already stored aren't fetched again, but
+// none is ever read: the wants of the other peers are left unanswered,
+// bitswap having no way to tell them we don't have a block.
+type clientOnlyBlockstore struct {
+	bstore.Blockstore
+}
+
+func (bs *clientOnlyBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	return nil, bstore.ErrNotFound
+}
+
+func (bs *clientOnlyBlockstore) GetSize(c cid.Cid) (int, error) {
+	return -1, bstore.ErrNotFound
+}
+
+// clientOnlyRouting is the announcer of the nodes set to only fetch blocks,
+// which never announce the blocks they have, since they don't serve them.
+type clientOnlyRouting struct {
+	routing.ContentRouting
+}
+
+func (r *clientOnlyRouting) Provide(context.Context, cid.Cid, bool) error {
+	return nil
+}
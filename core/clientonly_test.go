@@ -0,0 +1,86 @@
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	libp2p "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p"
+	mocknet "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/net/mock"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	datastore "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	syncds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+func TestClientOnly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	host := func(ctx context.Context, id peer.ID, ps pstore.Peerstore, _ ...libp2p.Option) (p2phost.Host, error) {
+		return mn.AddPeerWithPeerstore(id, ps)
+	}
+
+	server, err := NewNode(ctx, &BuildCfg{Online: true, Host: host})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	r := &keysRepo{
+		Mock: &repo.Mock{
+			C: config.Config{Identity: testIdentity},
+			D: syncds.MutexWrap(datastore.NewMapDatastore()),
+		},
+		keys: map[string]interface{}{"Bitswap.ClientOnly": true},
+	}
+	client, err := NewNode(ctx, &BuildCfg{Online: true, Host: host, Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.PeerHost.Connect(ctx, client.Peerstore.PeerInfo(client.Identity)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client fetches the blocks of the server
+	fetched := blocks.NewBlock([]byte("fetched by the client"))
+	if err := server.Blocks.AddBlock(fetched); err != nil {
+		t.Fatal(err)
+	}
+	fetchCtx, cancelFetch := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelFetch()
+	if _, err := client.Blocks.GetBlock(fetchCtx, fetched.Cid()); err != nil {
+		t.Fatalf("expected the client to fetch blocks: %s", err)
+	}
+	if has, err := client.Blockstore.Has(fetched.Cid()); err != nil || !has {
+		t.Fatalf("expected the client to store the blocks fetched: %v", err)
+	}
+
+	// but neither serves nor announces its own
+	kept := blocks.NewBlock([]byte("kept by the client"))
+	if err := client.Blocks.AddBlock(kept); err != nil {
+		t.Fatal(err)
+	}
+	serveCtx, cancelServe := context.WithTimeout(ctx, time.Second)
+	defer cancelServe()
+	if _, err := server.Blocks.GetBlock(serveCtx, kept.Cid()); err == nil {
+		t.Fatal("expected the client not to serve its blocks")
+	}
+
+	findCtx, cancelFind := context.WithTimeout(ctx, time.Second)
+	defer cancelFind()
+	for p := range server.Routing.FindProvidersAsync(findCtx, kept.Cid(), 1) {
+		t.Fatalf("expected the client not to announce its blocks, found %s", p.ID)
+	}
+}
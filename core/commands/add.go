@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -25,6 +26,7 @@ const (
 	quieterOptionName     = "quieter"
 	silentOptionName      = "silent"
 	progressOptionName    = "progress"
+	progressFmtOptionName = "progress-format"
 	trickleOptionName     = "trickle"
 	wrapOptionName        = "wrap-with-directory"
 	stdinPathName         = "stdin-name"
@@ -43,6 +45,12 @@ const (
 
 const adderOutChanSize = 8
 
+// Formats of the progress output.
+const (
+	progressFormatBar  = "bar"
+	progressFormatJSON = "json"
+)
+
 var AddCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Add a file or directory to ipfs.",
@@ -92,6 +100,18 @@ You can now check what blocks have been created by:
   QmY6yj1GsermExDXoosVE3aSPxdMNYr6aKuw3nA8LoWPRS 2059
   QmerURi9k4XzKCaaPbsK6BL5pMEjF7PGphjDvkkjDtsVf3 868
   QmQB28iwSriSUSMqG2nXDTLtdPHgWb4rebBrU7Q1j4vxPv 338
+
+Programs that want to track the progress of an add can pass
+'--progress-format=json'. Instead of drawing a progress bar and printing
+"added" lines, ipfs add then writes one JSON object per line to stdout:
+
+  {"Type":"progress","Name":"video.mp4","Bytes":262144,"Chunks":1,"Total":1048576}
+  {"Type":"added","Name":"video.mp4","Hash":"Qm...","Size":"1048832","Total":1048576}
+
+'Bytes' and 'Chunks' count what has been read from the current file so
+far and 'Total' is the size of all the input, if known. Over the HTTP API
+this option enables progress events, which are streamed as the usual
+JSON objects.
 `,
 	},
 
@@ -104,6 +124,7 @@ You can now check what blocks have been created by:
 		cmdkit.BoolOption(quieterOptionName, "Q", "Write only final hash."),
 		cmdkit.BoolOption(silentOptionName, "Write no output."),
 		cmdkit.BoolOption(progressOptionName, "p", "Stream progress data."),
+		cmdkit.StringOption(progressFmtOptionName, "Format of the progress output: bar or json. Default: bar."),
 		cmdkit.BoolOption(trickleOptionName, "t", "Use trickle-dag format for dag generation."),
 		cmdkit.BoolOption(onlyHashOptionName, "n", "Only chunk and hash - do not write to disk."),
 		cmdkit.BoolOption(wrapOptionName, "w", "Wrap files with a directory object."),
@@ -120,6 +141,16 @@ You can now check what blocks have been created by:
 		cmdkit.IntOption(inlineLimitOptionName, "Maximum block size to inline. (experimental)").WithDefault(32),
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		progressFmt, _ := req.Options[progressFmtOptionName].(string)
+		switch progressFmt {
+		case "", progressFormatBar:
+		case progressFormatJSON:
+			req.Options[progressOptionName] = true
+			return nil
+		default:
+			return fmt.Errorf("unrecognized progress format: %s", progressFmt)
+		}
+
 		quiet, _ := req.Options[quietOptionName].(bool)
 		quieter, _ := req.Options[quieterOptionName].(bool)
 		quiet = quiet || quieter
@@ -145,6 +176,7 @@ You can now check what blocks have been created by:
 		}
 
 		progress, _ := req.Options[progressOptionName].(bool)
+		progressFmt, _ := req.Options[progressFmtOptionName].(string)
 		trickle, _ := req.Options[trickleOptionName].(bool)
 		wrap, _ := req.Options[wrapOptionName].(bool)
 		hash, _ := req.Options[onlyHashOptionName].(bool)
@@ -162,6 +194,10 @@ You can now check what blocks have been created by:
 		pathName, _ := req.Options[stdinPathName].(string)
 		local, _ := req.Options["local"].(bool)
 
+		if progressFmt == progressFormatJSON {
+			progress = true
+		}
+
 		hashFunCode, ok := mh.Names[strings.ToLower(hashFunStr)]
 		if !ok {
 			return fmt.Errorf("unrecognized hash function: %s", strings.ToLower(hashFunStr))
@@ -221,29 +257,15 @@ You can now check what blocks have been created by:
 	},
 	PostRun: cmds.PostRunMap{
 		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
-			sizeChan := make(chan int64, 1)
-			outChan := make(chan interface{})
 			req := res.Request()
+			sizeChan := inputSize(req)
 
-			sizeFile, ok := req.Files.(files.SizeFile)
-			if ok {
-				// Could be slow.
-				go func() {
-					size, err := sizeFile.Size()
-					if err != nil {
-						log.Warningf("error getting files size: %s", err)
-						// see comment above
-						return
-					}
-
-					sizeChan <- size
-				}()
-			} else {
-				// we don't need to error, the progress bar just
-				// won't know how big the files are
-				log.Warning("cannot determine size of input file")
+			if progressFmt, _ := req.Options[progressFmtOptionName].(string); progressFmt == progressFormatJSON {
+				return addJSONProgress(res, sizeChan)
 			}
 
+			outChan := make(chan interface{})
+
 			progressBar := func(wait chan struct{}) {
 				defer close(wait)
 
@@ -368,3 +390,85 @@ You can now check what blocks have been created by:
 	},
 	Type: coreiface.AddEvent{},
 }
+
+// inputSize computes the size of the files being added in the background.
+// Nothing is sent on the returned channel if the size can't be determined.
+func inputSize(req *cmds.Request) <-chan int64 {
+	sizeChan := make(chan int64, 1)
+
+	sizeFile, ok := req.Files.(files.SizeFile)
+	if ok {
+		// Could be slow.
+		go func() {
+			size, err := sizeFile.Size()
+			if err != nil {
+				log.Warningf("error getting files size: %s", err)
+				// see comment above
+				return
+			}
+
+			sizeChan <- size
+		}()
+	} else {
+		// we don't need to error, the progress bar just
+		// won't know how big the files are
+		log.Warning("cannot determine size of input file")
+	}
+
+	return sizeChan
+}
+
+// addProgressEvent is written for every event with --progress-format=json.
+type addProgressEvent struct {
+	Type   string
+	Name   string
+	Hash   string `json:",omitempty"`
+	Size   string `json:",omitempty"`
+	Bytes  int64  `json:",omitempty"`
+	Chunks int64  `json:",omitempty"`
+	Total  int64  `json:",omitempty"`
+}
+
+// addJSONProgress writes the add events as JSON lines to stdout.
+func addJSONProgress(res cmds.Response, sizeChan <-chan int64) error {
+	if e := res.Error(); e != nil {
+		return e
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	var total int64
+	for {
+		v, err := res.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		select {
+		case total = <-sizeChan:
+		default:
+		}
+
+		output := v.(*coreiface.AddEvent)
+		ev := addProgressEvent{
+			Type:   "progress",
+			Name:   output.Name,
+			Bytes:  output.Bytes,
+			Chunks: output.Chunks,
+			Total:  total,
+		}
+		if len(output.Hash) > 0 {
+			ev.Type = "added"
+			ev.Hash = output.Hash
+			ev.Size = output.Size
+			ev.Bytes = 0
+			ev.Chunks = 0
+		}
+
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"encoding/json"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	audit "github.com/ipfs/go-ipfs/core/audit"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+)
+
+// auditedCommands are the paths of the commands changing the content or the
+// state of the node, recorded in its audit log when Audit.Path is set.
+var auditedCommands = []string{
+	"add",
+	"block/put",
+	"block/rm",
+	"bootstrap/add",
+	"bootstrap/add/default",
+	"bootstrap/rm",
+	"bootstrap/rm/all",
+	"config",
+	"config/profile/apply",
+	"config/replace",
+	"dag/put",
+	"dht/put",
+	"files/batch",
+	"files/chcid",
+	"files/chmod",
+	"files/cp",
+	"files/mkdir",
+	"files/mv",
+	"files/rm",
+	"files/shard",
+	"files/touch",
+	"files/write",
+	"filestore/dematerialize",
+	"filestore/materialize",
+	"filestore/remap",
+	"key/gen",
+	"key/rename",
+	"key/rm",
+	"name/publish",
+	"object/new",
+	"object/patch/add-link",
+	"object/patch/append-data",
+	"object/patch/rm-link",
+	"object/patch/set-data",
+	"object/put",
+	"p2p/acl/rm",
+	"p2p/acl/set",
+	"p2p/close",
+	"p2p/forward",
+	"p2p/listen",
+	"pin/add",
+	"pin/rm",
+	"pin/update",
+	"repo/gc",
+	"repo/named/create",
+	"repo/restore",
+	"swarm/filters/add",
+	"swarm/filters/rm",
+	"tar/add",
+	"urlstore/add",
+}
+
+// auditedWhen tells which runs of the audited commands change the node, the
+// others aren't recorded.
+var auditedWhen = map[string]func(req *cmds.Request) bool{
+	// 'ipfs config <key>' only reads the key
+	"config": func(req *cmds.Request) bool {
+		return len(req.Arguments) == 2
+	},
+	"config/profile/apply": func(req *cmds.Request) bool {
+		dryRun, _ := req.Options[configDryRunOptionName].(bool)
+		return !dryRun
+	},
+}
+
+// auditRedactedOptions are the options whose values are kept out of the audit
+// log, as they lead to the secrets of the node.
+var auditRedactedOptions = []string{
+	p2pTokenFileOptionName,
+	p2pTLSKeyOptionName,
+}
+
+// auditSecretConfigKeys are the config keys, lower case, whose values are kept
+// out of the audit log.
+var auditSecretConfigKeys = []string{
+	"identity",
+	strings.ToLower(webhooksConfigKey),
+}
+
+// auditRedacted replaces the secrets of logs.
+const auditRedacted = "<redacted>"
+
+// maxAuditResults bounds the number of results recorded for an operation,
+// e.g. the blocks removed by a garbage collection.
+const maxAuditResults = 1000
+
+// auditResultFields are the fields of the outputs of the commands holding
+// the CIDs and paths they result in.
+var auditResultFields = []string{"Hash", "Cid", "Key", "Pins", "Value"}
+
+// auditCommands records the runs of the audited commands of root.
+func auditCommands(root *cmds.Command) {
+	for _, path := range auditedCommands {
+		cmd := root
+		for _, name := range strings.Split(path, "/") {
+			cmd = cmd.Subcommands[name]
+			if cmd == nil {
+				panic("audited command not found: " + path)
+			}
+		}
+		cmd.Run = auditRun(path, cmd.Run)
+	}
+}
+
+// auditRun returns run recording its calls in the audit log of the node.
+func auditRun(path string, run func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error) func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error {
+	return func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if audited, ok := auditedWhen[path]; ok && !audited(req) {
+			return run(req, re, env)
+		}
+		n, err := cmdenv.GetNode(env)
+		if err != nil || n.AuditLog() == nil {
+			return run(req, re, env)
+		}
+
+		e := &audit.Entry{
+			Time:    time.Now(),
+			Command: path,
+		}
+		e.Arguments, e.Options = auditRedact(path, req)
+		e.Who, e.Via, e.Agent = audit.Caller(req.Context)
+		if e.Via == "" {
+			e.Who, e.Via = localUser(), "cli"
+		}
+
+		are := &auditEmitter{ResponseEmitter: re, entry: e}
+		err = run(req, are, env)
+
+		are.lk.Lock()
+		defer are.lk.Unlock()
+		e.Duration = time.Since(e.Time)
+		if err != nil {
+			e.Error = err.Error()
+		}
+		if aerr := n.AuditLog().Record(e); aerr != nil {
+			log.Errorf("recording %s in the audit log: %s", path, aerr)
+		}
+		return err
+	}
+}
+
+// auditRedact returns the arguments and the options of req, without the
+// secrets they hold.
+func auditRedact(path string, req *cmds.Request) ([]string, map[string]interface{}) {
+	args := req.Arguments
+	if path == "config" && len(args) == 2 {
+		key := strings.ToLower(args[0])
+		for _, secret := range auditSecretConfigKeys {
+			if key == secret || strings.HasPrefix(key, secret+".") {
+				args = []string{args[0], auditRedacted}
+				break
+			}
+		}
+	}
+
+	// the options of req are copied before they are redacted
+	opts := map[string]interface{}(req.Options)
+	copied := false
+	for _, name := range auditRedactedOptions {
+		if _, ok := opts[name]; !ok {
+			continue
+		}
+		if !copied {
+			opts = make(map[string]interface{}, len(req.Options))
+			for k, v := range req.Options {
+				opts[k] = v
+			}
+			copied = true
+		}
+		opts[name] = auditRedacted
+	}
+	return args, opts
+}
+
+// auditEmitter collects the results of the outputs emitted.
+type auditEmitter struct {
+	cmds.ResponseEmitter
+
+	lk    sync.Mutex
+	entry *audit.Entry
+}
+
+func (re *auditEmitter) Emit(v interface{}) error {
+	re.lk.Lock()
+	if len(re.entry.Results) < maxAuditResults {
+		re.entry.Results = append(re.entry.Results, auditResults(v)...)
+		if len(re.entry.Results) > maxAuditResults {
+			re.entry.Results = re.entry.Results[:maxAuditResults]
+		}
+	}
+	re.lk.Unlock()
+	return re.ResponseEmitter.Emit(v)
+}
+
+// auditResults returns the CIDs and paths of the top level fields of v in
+// auditResultFields, as encoded in JSON. The CIDs can be strings, or links
+// of the form {"/": "Qm..."}.
+func auditResults(v interface{}) []string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+
+	var out []string
+	var add func(v interface{})
+	add = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			if v != "" {
+				out = append(out, v)
+			}
+		case map[string]interface{}:
+			add(v["/"])
+		case []interface{}:
+			for _, e := range v {
+				add(e)
+			}
+		}
+	}
+	for _, name := range auditResultFields {
+		add(fields[name])
+	}
+	return out
+}
+
+// localUser returns the name of the user running the command.
+func localUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
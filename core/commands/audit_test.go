@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+func TestAuditResults(t *testing.T) {
+	c, err := cid.Decode("QmdfTbBqBPQ7VNxZEYEj14VmRuZBkqFbiwReogJgS1zR1n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		v   interface{}
+		out []string
+	}{
+		{&coreiface.AddEvent{Name: "foo", Hash: "QmFoo"}, []string{"QmFoo"}},
+		{&coreiface.AddEvent{Name: "foo", Bytes: 10}, nil},
+		{map[string]interface{}{"Cid": c}, []string{c.String()}},
+		{map[string]interface{}{"Pins": []string{"QmFoo", "QmBar"}}, []string{"QmFoo", "QmBar"}},
+		{map[string]interface{}{"Name": "QmKey", "Value": "/ipfs/QmFoo"}, []string{"/ipfs/QmFoo"}},
+		{map[string]interface{}{"Hash": "QmFoo", "Links": []map[string]string{{"Hash": "QmBar"}}}, []string{"QmFoo"}},
+		{"not an object", nil},
+	} {
+		if out := auditResults(tc.v); !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("expected %v for %v, got %v", tc.out, tc.v, out)
+		}
+	}
+}
+
+func TestAuditRedact(t *testing.T) {
+	for _, tc := range []struct {
+		path string
+		req  *cmds.Request
+		args []string
+		opts map[string]interface{}
+	}{
+		{
+			"config",
+			&cmds.Request{Arguments: []string{"Datastore.StorageMax", "10GB"}},
+			[]string{"Datastore.StorageMax", "10GB"},
+			nil,
+		},
+		{
+			"config",
+			&cmds.Request{Arguments: []string{"webhooks", `[{"Secret": "s"}]`}},
+			[]string{"webhooks", auditRedacted},
+			nil,
+		},
+		{
+			"p2p/forward",
+			&cmds.Request{
+				Arguments: []string{"/x/test", "/ip4/127.0.0.1/tcp/8080", "/ipfs/QmPeer"},
+				Options:   cmdkit.OptMap{"token-file": "/secrets/token", "tls-key": "key.pem", "tls-cert": "cert.pem"},
+			},
+			[]string{"/x/test", "/ip4/127.0.0.1/tcp/8080", "/ipfs/QmPeer"},
+			map[string]interface{}{"token-file": auditRedacted, "tls-key": auditRedacted, "tls-cert": "cert.pem"},
+		},
+	} {
+		args, opts := auditRedact(tc.path, tc.req)
+		if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("expected the arguments %v for %v, got %v", tc.args, tc.req.Arguments, args)
+		}
+		if len(opts) != 0 || len(tc.opts) != 0 {
+			if !reflect.DeepEqual(opts, tc.opts) {
+				t.Errorf("expected the options %v for %v, got %v", tc.opts, tc.req.Options, opts)
+			}
+		}
+		if tc.req.Options["token-file"] == auditRedacted {
+			t.Error("expected the options of the request to be left as is")
+		}
+	}
+}
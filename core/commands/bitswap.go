@@ -3,13 +3,15 @@ package commands
 import (
 	"fmt"
 	"io"
+	"sort"
+	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	bitswap "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap"
-	decision "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/decision"
 	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
 	cidutil "gx/ipfs/QmbfKu17LbMWyGUxHEUns9Wf5Dkm8PT6be4uPhTkk4YvaV/go-cidutil"
@@ -27,6 +29,7 @@ var BitswapCmd = &cmds.Command{
 		"wantlist":  showWantlistCmd,
 		"ledger":    ledgerCmd,
 		"reprovide": reprovideCmd,
+		"provides":  providesCmd,
 	},
 }
 
@@ -137,55 +140,211 @@ var bitswapStatCmd = &cmds.Command{
 	},
 }
 
+// BitswapLedger is the output of 'ipfs bitswap ledger', keeping the fields of
+// the bitswap receipts it used to print.
+type BitswapLedger struct {
+	Peer      string
+	Value     float64
+	Sent      uint64
+	Recv      uint64
+	Exchanged uint64
+
+	BlocksSent       uint64
+	BlocksReceived   uint64
+	MessagesSent     uint64
+	MessagesReceived uint64
+}
+
 var ledgerCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Show the current ledger for a peer.",
 		ShortDescription: `
 The Bitswap decision engine tracks the number of bytes exchanged between IPFS
 nodes, and stores this information as a collection of ledgers. This command
-prints the ledger associated with a given peer.
+prints the ledger associated with a given peer, or the ledgers of all the
+peers the node exchanges blocks with, the heaviest partners first.
+`,
+		LongDescription: `
+The Bitswap decision engine tracks the number of bytes exchanged between IPFS
+nodes, and stores this information as a collection of ledgers. This command
+prints the ledger associated with a given peer, or the ledgers of all the
+peers the node exchanges blocks with, the heaviest partners first.
+
+The debt ratio is the ratio of the bytes sent to the peer over the bytes
+received from it: peers with a high ratio take blocks without giving any
+back. The numbers of blocks and messages are counted since the daemon
+started.
 `,
 	},
 	Arguments: []cmdkit.Argument{
-		cmdkit.StringArg("peer", true, false, "The PeerID (B58) of the ledger to inspect."),
+		cmdkit.StringArg("peer", false, false, "The PeerID (B58) of the ledger to inspect. Default: all the partners."),
 	},
-	Type: decision.Receipt{},
+	Type: BitswapLedger{},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		nd, err := cmdenv.GetNode(env)
+		api, err := cmdenv.GetApi(env)
 		if err != nil {
 			return err
 		}
 
-		if !nd.OnlineMode() {
-			return ErrNotOnline
-		}
+		if len(req.Arguments) > 0 {
+			partner, err := peer.IDB58Decode(req.Arguments[0])
+			if err != nil {
+				return err
+			}
 
-		bs, ok := nd.Exchange.(*bitswap.Bitswap)
-		if !ok {
-			return e.TypeErr(bs, nd.Exchange)
+			l, err := api.Bitswap().Ledger(req.Context, partner)
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(res, ledgerOutput(l))
 		}
 
-		partner, err := peer.IDB58Decode(req.Arguments[0])
+		ledgers, err := api.Bitswap().Ledgers(req.Context)
 		if err != nil {
 			return err
 		}
-
-		return cmds.EmitOnce(res, bs.LedgerForPeer(partner))
+		sort.Slice(ledgers, func(i, j int) bool {
+			return ledgers[i].BytesSent+ledgers[i].BytesReceived > ledgers[j].BytesSent+ledgers[j].BytesReceived
+		})
+		for _, l := range ledgers {
+			if err := res.Emit(ledgerOutput(l)); err != nil {
+				return err
+			}
+		}
+		return nil
 	},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *decision.Receipt) error {
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BitswapLedger) error {
 			fmt.Fprintf(w, "Ledger for %s\n"+
 				"Debt ratio:\t%f\n"+
 				"Exchanges:\t%d\n"+
 				"Bytes sent:\t%d\n"+
-				"Bytes received:\t%d\n\n",
+				"Bytes received:\t%d\n"+
+				"Blocks sent:\t%d\n"+
+				"Blocks received:\t%d\n"+
+				"Messages sent:\t%d\n"+
+				"Messages received:\t%d\n\n",
 				out.Peer, out.Value, out.Exchanged,
-				out.Sent, out.Recv)
+				out.Sent, out.Recv,
+				out.BlocksSent, out.BlocksReceived,
+				out.MessagesSent, out.MessagesReceived)
+			return nil
+		}),
+	},
+}
+
+func ledgerOutput(l *coreiface.BitswapLedger) *BitswapLedger {
+	return &BitswapLedger{
+		Peer:             l.Peer.Pretty(),
+		Value:            l.DebtRatio,
+		Sent:             l.BytesSent,
+		Recv:             l.BytesReceived,
+		Exchanged:        l.BlocksSent + l.BlocksReceived,
+		BlocksSent:       l.BlocksSent,
+		BlocksReceived:   l.BlocksReceived,
+		MessagesSent:     l.MessagesSent,
+		MessagesReceived: l.MessagesReceived,
+	}
+}
+
+// ProvideQueueEntry is the output of 'ipfs bitswap provides'.
+type ProvideQueueEntry struct {
+	Cid      string
+	State    string
+	Age      time.Duration
+	Attempts int
+	Error    string `json:",omitempty"`
+}
+
+var providesCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the blocks waiting to be announced to the network.",
+		ShortDescription: `
+Prints the blocks added to the node since the daemon started which weren't
+announced to the routing system yet, the oldest first, with the number of
+failed announcements and the error of the last one. Given paths, prints
+whether their blocks were announced instead.
+`,
+		LongDescription: `
+Prints the blocks added to the node since the daemon started which weren't
+announced to the routing system yet, the oldest first, with the number of
+failed announcements and the error of the last one. Given paths, prints
+whether their blocks were announced instead.
+
+The state of a block is 'pending' until it's announced, and 'provided' once
+it is. The blocks not added since the daemon started, or announced too long
+ago to be remembered, are 'unknown'. The blocks whose announcement failed
+are retried later, with a delay doubled by each failure, and announced again
+by the reprovider, see 'ipfs bitswap reprovide'. The blocks waiting are kept
+across restarts.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", false, true, "The paths of the blocks to check. Default: the blocks pending."),
+	},
+	Type: ProvideQueueEntry{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		if len(req.Arguments) == 0 {
+			entries, err := api.Reprovider().Queue(req.Context)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if err := res.Emit(provideQueueOutput(&e)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for _, arg := range req.Arguments {
+			p, err := coreiface.ParsePath(arg)
+			if err != nil {
+				return err
+			}
+			e, err := api.Reprovider().QueueStatus(req.Context, p)
+			if err != nil {
+				return err
+			}
+			if err := res.Emit(provideQueueOutput(e)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ProvideQueueEntry) error {
+			fmt.Fprintf(w, "%s\t%s", out.Cid, out.State)
+			if out.State != "unknown" {
+				fmt.Fprintf(w, "\t%s", out.Age.Round(time.Second))
+			}
+			if out.Attempts > 0 {
+				fmt.Fprintf(w, "\t%d failed: %s", out.Attempts, out.Error)
+			}
+			fmt.Fprintln(w)
 			return nil
 		}),
 	},
 }
 
+func provideQueueOutput(e *coreiface.ProvideEntry) *ProvideQueueEntry {
+	out := &ProvideQueueEntry{
+		Cid:      e.Cid.String(),
+		State:    e.State,
+		Age:      e.Age,
+		Attempts: e.Attempts,
+	}
+	if e.LastErr != nil {
+		out.Error = e.LastErr.Error()
+	}
+	return out
+}
+
 var reprovideCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Trigger reprovider.",
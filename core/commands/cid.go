@@ -42,7 +42,22 @@ var cidFmtCmd = &cmds.Command{
 Format and converts <cid>'s in various useful ways.
 
 The optional format string is a printf style format string:
-` + cidutil.FormatRef,
+` + cidutil.FormatRef + `
+Examples:
+
+Convert a CIDv0 to a base32 CIDv1:
+
+  > ipfs cid format -v 1 -b base32 QmS4ustL54uo8FzR9455qaxZwuMiUhyvMcX9Ba8nUH4uVv
+  bafybeibxm2nsadl3fnxv2sxcxmxaco2jl53wpeorjdzidjwf5aqdg7wa6u
+
+Show the codec and multihash of a CID:
+
+  > ipfs cid format -f "%c %h" QmS4ustL54uo8FzR9455qaxZwuMiUhyvMcX9Ba8nUH4uVv
+  protobuf sha2-256
+
+Use 'ipfs cid bases', 'ipfs cid codecs' and 'ipfs cid hashes' to list the
+available multibases, codecs and multihashes.
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("cid", true, true, "Cids to format.").EnableStdin(),
@@ -109,6 +124,10 @@ type CidFormatRes struct {
 var base32Cmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Convert CIDs to Base32 CID version 1.",
+		ShortDescription: `
+Convert CIDs to version 1 and encode them in base32. This is shorthand for
+'ipfs cid format -v 1 -b base32'.
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("cid", true, true, "Cids to convert.").EnableStdin(),
@@ -22,6 +22,7 @@ func TestROCommands(t *testing.T) {
 		"/block/stat",
 		"/cat",
 		"/commands",
+		"/commands/completion",
 		"/dag",
 		"/dag/get",
 		"/dag/resolve",
@@ -71,6 +72,7 @@ func TestCommands(t *testing.T) {
 		"/add",
 		"/bitswap",
 		"/bitswap/ledger",
+		"/bitswap/provides",
 		"/bitswap/reprovide",
 		"/bitswap/stat",
 		"/bitswap/wantlist",
@@ -87,16 +89,20 @@ func TestCommands(t *testing.T) {
 		"/bootstrap/rm/all",
 		"/cat",
 		"/commands",
+		"/commands/completion",
 		"/config",
 		"/config/edit",
 		"/config/replace",
 		"/config/show",
 		"/config/profile",
 		"/config/profile/apply",
+		"/daemon",
+		"/daemon/reload",
 		"/dag",
 		"/dag/get",
 		"/dag/put",
 		"/dag/resolve",
+		"/dag/stat",
 		"/dht",
 		"/dht/findpeer",
 		"/dht/findprovs",
@@ -108,23 +114,35 @@ func TestCommands(t *testing.T) {
 		"/diag/cmds",
 		"/diag/cmds/clear",
 		"/diag/cmds/set-time",
+		"/diag/nat",
+		"/diag/nat/remap",
+		"/diag/profile",
 		"/diag/sys",
 		"/dns",
 		"/file",
 		"/file/ls",
 		"/files",
+		"/files/batch",
 		"/files/chcid",
+		"/files/chmod",
+		"/files/touch",
+		"/files/watch",
 		"/files/cp",
+		"/files/export",
 		"/files/flush",
 		"/files/ls",
 		"/files/mkdir",
 		"/files/mv",
 		"/files/read",
 		"/files/rm",
+		"/files/shard",
 		"/files/stat",
 		"/filestore",
+		"/filestore/dematerialize",
 		"/filestore/dups",
 		"/filestore/ls",
+		"/filestore/materialize",
+		"/filestore/remap",
 		"/filestore/verify",
 		"/files/write",
 		"/get",
@@ -161,6 +179,10 @@ func TestCommands(t *testing.T) {
 		"/object/put",
 		"/object/stat",
 		"/p2p",
+		"/p2p/acl",
+		"/p2p/acl/ls",
+		"/p2p/acl/rm",
+		"/p2p/acl/set",
 		"/p2p/close",
 		"/p2p/forward",
 		"/p2p/listen",
@@ -183,33 +205,54 @@ func TestCommands(t *testing.T) {
 		"/refs",
 		"/refs/local",
 		"/repo",
+		"/repo/backup",
+		"/repo/cache",
+		"/repo/compact",
+		"/repo/convert",
 		"/repo/fsck",
 		"/repo/gc",
+		"/repo/named",
+		"/repo/named/create",
+		"/repo/named/ls",
+		"/repo/restore",
 		"/repo/stat",
 		"/repo/verify",
 		"/repo/version",
 		"/resolve",
 		"/shutdown",
 		"/stats",
+		"/stats/all",
 		"/stats/bitswap",
 		"/stats/bw",
 		"/stats/repo",
 		"/swarm",
 		"/swarm/addrs",
 		"/swarm/addrs/listen",
+		"/swarm/addrs/listen/add",
+		"/swarm/addrs/listen/rm",
 		"/swarm/addrs/local",
 		"/swarm/connect",
 		"/swarm/disconnect",
+		"/swarm/events",
 		"/swarm/filters",
 		"/swarm/filters/add",
 		"/swarm/filters/rm",
+		"/swarm/mdns",
 		"/swarm/peers",
+		"/swarm/pnet",
+		"/swarm/pnet/cancel",
+		"/swarm/pnet/rotate",
+		"/swarm/rendezvous",
+		"/swarm/rendezvous/discover",
+		"/swarm/rendezvous/register",
+		"/swarm/rendezvous/unregister",
 		"/tar",
 		"/tar/add",
 		"/tar/cat",
 		"/update",
 		"/urlstore",
 		"/urlstore/add",
+		"/urlstore/verify",
 		"/version",
 		"/cid",
 		"/cid/format",
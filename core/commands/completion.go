@@ -0,0 +1,543 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+// Kinds of values a command argument or option can be completed with.
+const (
+	completeNone  = ""
+	completeFiles = "files"
+	completeKeys  = "keys"
+	completePins  = "pins"
+)
+
+// completionArgs lists the commands whose arguments can be completed with
+// values fetched from the node. Arguments of other commands are completed
+// with file names if they accept files.
+var completionArgs = map[string]string{
+	"ipfs key rename": completeKeys,
+	"ipfs key rm":     completeKeys,
+	"ipfs pin ls":     completePins,
+	"ipfs pin rm":     completePins,
+	"ipfs pin update": completePins,
+}
+
+// completionOptions lists the options whose values can be completed with
+// values fetched from the node, by option name.
+var completionOptions = map[string]string{
+	"key": completeKeys,
+}
+
+// completionCommand describes a command for the purpose of generating shell
+// completion scripts.
+type completionCommand struct {
+	Path        string
+	Tagline     string
+	Subcommands []completionCommand
+	Options     []completionOption
+	Arguments   string
+}
+
+type completionOption struct {
+	Names       []string
+	Description string
+	TakesValue  bool
+	Values      string
+}
+
+func (o completionOption) flags() []string {
+	flags := make([]string, len(o.Names))
+	for i, name := range o.Names {
+		if len(name) == 1 {
+			flags[i] = "-" + name
+		} else {
+			flags[i] = "--" + name
+		}
+	}
+	return flags
+}
+
+func cmd2completionCmd(path string, cmd *cmds.Command) completionCommand {
+	out := completionCommand{
+		Path:      path,
+		Tagline:   cmd.Helptext.Tagline,
+		Arguments: completionArgs[path],
+	}
+
+	for _, opt := range cmd.Options {
+		names := opt.Names()
+		out.Options = append(out.Options, completionOption{
+			Names:       names,
+			Description: opt.Description(),
+			TakesValue:  opt.Type() != reflect.Bool,
+			Values:      completionOptions[names[0]],
+		})
+	}
+
+	if out.Arguments == completeNone {
+		for _, arg := range cmd.Arguments {
+			if arg.Type == cmdkit.ArgFile {
+				out.Arguments = completeFiles
+				break
+			}
+		}
+	}
+
+	names := make([]string, 0, len(cmd.Subcommands))
+	for name := range cmd.Subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out.Subcommands = append(out.Subcommands, cmd2completionCmd(path+" "+name, cmd.Subcommands[name]))
+	}
+
+	return out
+}
+
+// walk calls f for cmd and all of its subcommands.
+func (c *completionCommand) walk(f func(*completionCommand)) {
+	f(c)
+	for i := range c.Subcommands {
+		c.Subcommands[i].walk(f)
+	}
+}
+
+func (c *completionCommand) subcommandNames() []string {
+	names := make([]string, len(c.Subcommands))
+	for i, sub := range c.Subcommands {
+		names[i] = strings.TrimPrefix(sub.Path, c.Path+" ")
+	}
+	return names
+}
+
+// valueFlags returns the flags of options that take a value and can be
+// completed with values of the given kind.
+func (c *completionCommand) valueFlags(values string) []string {
+	var flags []string
+	c.walk(func(cmd *completionCommand) {
+		for _, opt := range cmd.Options {
+			if opt.TakesValue && opt.Values == values {
+				flags = append(flags, opt.flags()...)
+			}
+		}
+	})
+	return uniqueSorted(flags)
+}
+
+func uniqueSorted(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	var out []string
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+const (
+	completionBash = "bash"
+	completionZsh  = "zsh"
+	completionFish = "fish"
+)
+
+func completionCmd(root *cmds.Command) *cmds.Command {
+	return &cmds.Command{
+		Helptext: cmdkit.HelpText{
+			Tagline: "Generate shell completion scripts.",
+			ShortDescription: `
+Prints a completion script for the given shell (bash, zsh or fish), generated
+from the available commands and their options. Key names and pinned CIDs are
+completed by querying ipfs when the completion is triggered.
+`,
+			LongDescription: `
+Prints a completion script for the given shell (bash, zsh or fish), generated
+from the available commands and their options. Key names and pinned CIDs are
+completed by querying ipfs when the completion is triggered.
+
+To enable completion for the current bash session:
+
+  > source <(ipfs commands completion bash)
+
+For zsh, write the script to a directory in your $fpath as '_ipfs':
+
+  > ipfs commands completion zsh > ~/.zfunc/_ipfs
+
+For fish:
+
+  > ipfs commands completion fish > ~/.config/fish/completions/ipfs.fish
+`,
+		},
+		Arguments: []cmdkit.Argument{
+			cmdkit.StringArg("shell", true, false, "Shell to generate the script for: bash, zsh or fish."),
+		},
+		Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+			switch req.Arguments[0] {
+			case completionBash, completionZsh, completionFish:
+			default:
+				return fmt.Errorf("unsupported shell %q, must be one of bash, zsh or fish", req.Arguments[0])
+			}
+
+			rootCmd := cmd2completionCmd("ipfs", root)
+			return cmds.EmitOnce(res, &rootCmd)
+		},
+		Encoders: cmds.EncoderMap{
+			cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, root *completionCommand) error {
+				switch req.Arguments[0] {
+				case completionBash:
+					return writeBashCompletion(w, root)
+				case completionZsh:
+					return writeZshCompletion(w, root)
+				case completionFish:
+					return writeFishCompletion(w, root)
+				}
+				return fmt.Errorf("unsupported shell %q", req.Arguments[0])
+			}),
+		},
+		Type: completionCommand{},
+	}
+}
+
+const bashCompletionHeader = `# bash completion for ipfs, generated by 'ipfs commands completion bash'.
+
+_ipfs_keys()
+{
+    ipfs key list 2>/dev/null
+}
+
+_ipfs_pins()
+{
+    ipfs pin ls --type=recursive --quiet 2>/dev/null
+}
+`
+
+const bashCompletionMain = `
+_ipfs()
+{
+    local word="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local path="ipfs"
+    local options="$(_ipfs_options ipfs)"
+    local value_options="$(_ipfs_value_options ipfs)"
+    local i w
+
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        w="${COMP_WORDS[i]}"
+        if [[ " $(_ipfs_subcommands "$path") " == *" $w "* ]]; then
+            path="$path $w"
+            options="$options $(_ipfs_options "$path")"
+            value_options="$value_options $(_ipfs_value_options "$path")"
+        fi
+    done
+
+    if [[ "$prev" == -* && " $value_options " == *" $prev "* ]]; then
+        if [[ " $(_ipfs_key_options) " == *" $prev "* ]]; then
+            COMPREPLY=( $(compgen -W "$(_ipfs_keys)" -- "$word") )
+        else
+            COMPREPLY=( $(compgen -f -- "$word") )
+        fi
+        return
+    fi
+
+    if [[ "$word" == -* ]]; then
+        COMPREPLY=( $(compgen -W "$options" -- "$word") )
+        return
+    fi
+
+    local subcommands="$(_ipfs_subcommands "$path")"
+    if [[ -n "$subcommands" ]]; then
+        COMPREPLY=( $(compgen -W "$subcommands" -- "$word") )
+        return
+    fi
+
+    case "$(_ipfs_arguments "$path")" in
+        files) COMPREPLY=( $(compgen -f -- "$word") ) ;;
+        keys)  COMPREPLY=( $(compgen -W "$(_ipfs_keys)" -- "$word") ) ;;
+        pins)  COMPREPLY=( $(compgen -W "$(_ipfs_pins)" -- "$word") ) ;;
+    esac
+}
+
+complete -o filenames -F _ipfs ipfs
+`
+
+// writeBashCase writes a shell function that maps command paths to the
+// words returned by f, omitting commands for which f returns nothing.
+func writeBashCase(w io.Writer, name string, root *completionCommand, f func(*completionCommand) []string) {
+	fmt.Fprintf(w, "\n%s()\n{\n    case \"$1\" in\n", name)
+	root.walk(func(cmd *completionCommand) {
+		if words := f(cmd); len(words) > 0 {
+			fmt.Fprintf(w, "        %q) echo %q ;;\n", cmd.Path, strings.Join(words, " "))
+		}
+	})
+	fmt.Fprintf(w, "    esac\n}\n")
+}
+
+func writeBashCompletion(w io.Writer, root *completionCommand) error {
+	fmt.Fprint(w, bashCompletionHeader)
+
+	fmt.Fprintf(w, "\n_ipfs_key_options()\n{\n    echo %q\n}\n", strings.Join(root.valueFlags(completeKeys), " "))
+
+	writeBashCase(w, "_ipfs_subcommands", root, (*completionCommand).subcommandNames)
+	writeBashCase(w, "_ipfs_options", root, func(cmd *completionCommand) []string {
+		var flags []string
+		for _, opt := range cmd.Options {
+			flags = append(flags, opt.flags()...)
+		}
+		return flags
+	})
+	writeBashCase(w, "_ipfs_value_options", root, func(cmd *completionCommand) []string {
+		var flags []string
+		for _, opt := range cmd.Options {
+			if opt.TakesValue {
+				flags = append(flags, opt.flags()...)
+			}
+		}
+		return flags
+	})
+	writeBashCase(w, "_ipfs_arguments", root, func(cmd *completionCommand) []string {
+		if cmd.Arguments == completeNone {
+			return nil
+		}
+		return []string{cmd.Arguments}
+	})
+
+	_, err := fmt.Fprint(w, bashCompletionMain)
+	return err
+}
+
+const zshCompletionHeader = `#compdef ipfs
+# zsh completion for ipfs, generated by 'ipfs commands completion zsh'.
+#
+# The file is autoloaded as _ipfs, the functions it defines are prefixed with
+# __ipfs_ so as not to clash with it.
+
+__ipfs_keys()
+{
+    compadd -- ${(f)"$(ipfs key list 2>/dev/null)"}
+}
+
+__ipfs_pins()
+{
+    compadd -- ${(f)"$(ipfs pin ls --type=recursive --quiet 2>/dev/null)"}
+}
+`
+
+const zshCompletionFooter = `
+if [[ "$funcstack[1]" == "_ipfs" ]]; then
+    __ipfs_cmd_ipfs "$@"
+else
+    compdef __ipfs_cmd_ipfs ipfs
+fi
+`
+
+// zshFunc returns the name of the zsh function completing the command at
+// path.
+func zshFunc(path string) string {
+	return "__ipfs_cmd_" + strings.Replace(path, " ", "_", -1)
+}
+
+// zshQuote quotes s as a single quoted zsh string.
+func zshQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// zshEscape escapes the characters of s that are special in the
+// descriptions of the option specs of _arguments.
+func zshEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(s)
+}
+
+// zshAction returns the action completing values of the given kind.
+func zshAction(values string) string {
+	switch values {
+	case completeKeys:
+		return "__ipfs_keys"
+	case completePins:
+		return "__ipfs_pins"
+	case completeFiles:
+		return "_files"
+	}
+	return ""
+}
+
+// zshOptionSpecs returns the specs of opt for _arguments, one for each of
+// its names, which exclude each other.
+func zshOptionSpecs(opt completionOption) []string {
+	flags := opt.flags()
+	exclusion := "(" + strings.Join(flags, " ") + ")"
+	desc := "[" + zshEscape(opt.Description) + "]"
+
+	specs := make([]string, len(flags))
+	for i, flag := range flags {
+		spec := exclusion + flag
+		if opt.TakesValue {
+			if strings.HasPrefix(flag, "--") {
+				spec += "="
+			} else {
+				spec += "+"
+			}
+			action := zshAction(opt.Values)
+			if action == "" {
+				action = "_files"
+			}
+			spec += desc + ": :" + action
+		} else {
+			spec += desc
+		}
+		specs[i] = zshQuote(spec)
+	}
+	return specs
+}
+
+func writeZshCompletion(w io.Writer, root *completionCommand) error {
+	fmt.Fprint(w, zshCompletionHeader)
+
+	root.walk(func(cmd *completionCommand) {
+		var specs []string
+		for _, opt := range cmd.Options {
+			specs = append(specs, zshOptionSpecs(opt)...)
+		}
+
+		fmt.Fprintf(w, "\n%s()\n{\n", zshFunc(cmd.Path))
+		if len(cmd.Subcommands) == 0 {
+			if action := zshAction(cmd.Arguments); action != "" {
+				specs = append(specs, zshQuote("*: :"+action))
+			}
+			fmt.Fprint(w, "    _arguments -s")
+			for _, spec := range specs {
+				fmt.Fprintf(w, " \\\n        %s", spec)
+			}
+			fmt.Fprint(w, "\n}\n")
+			return
+		}
+
+		specs = append(specs, zshQuote("1: :->command"), zshQuote("*:: :->args"))
+		fmt.Fprint(w, "    local curcontext=\"$curcontext\" state line\n")
+		fmt.Fprint(w, "    _arguments -C -s")
+		for _, spec := range specs {
+			fmt.Fprintf(w, " \\\n        %s", spec)
+		}
+		fmt.Fprint(w, "\n\n    case $state in\n    command)\n        local -a subcommands\n        subcommands=(\n")
+		names := cmd.subcommandNames()
+		for i, sub := range cmd.Subcommands {
+			fmt.Fprintf(w, "            %s\n", zshQuote(names[i]+":"+sub.Tagline))
+		}
+		fmt.Fprintf(w, "        )\n        _describe -t commands %s subcommands\n        ;;\n", zshQuote(cmd.Path+" command"))
+		fmt.Fprint(w, "    args)\n        case $line[1] in\n")
+		for i, sub := range cmd.Subcommands {
+			fmt.Fprintf(w, "        %s) %s ;;\n", zshQuote(names[i]), zshFunc(sub.Path))
+		}
+		fmt.Fprint(w, "        esac\n        ;;\n    esac\n}\n")
+	})
+
+	_, err := fmt.Fprint(w, zshCompletionFooter)
+	return err
+}
+
+const fishCompletionHeader = `# fish completion for ipfs, generated by 'ipfs commands completion fish'.
+
+function __fish_ipfs_path
+    set -l tokens (commandline -opc)
+    set -l path ipfs
+    for t in $tokens[2..-1]
+        if contains -- $t (__fish_ipfs_subcommands "$path")
+            set path "$path $t"
+        end
+    end
+    echo $path
+end
+
+# __fish_ipfs_using succeeds if the command being completed is the given
+# command or one of its subcommands.
+function __fish_ipfs_using
+    set -l path (__fish_ipfs_path)
+    test "$path" = "$argv[1]"; or string match -q -- "$argv[1] *" "$path"
+end
+
+function __fish_ipfs_is
+    test (__fish_ipfs_path) = "$argv[1]"
+end
+
+function __fish_ipfs_keys
+    ipfs key list 2>/dev/null
+end
+
+function __fish_ipfs_pins
+    ipfs pin ls --type=recursive --quiet 2>/dev/null
+end
+`
+
+// fishQuote quotes s as a single quoted fish string.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return "'" + s + "'"
+}
+
+func writeFishCompletion(w io.Writer, root *completionCommand) error {
+	fmt.Fprint(w, fishCompletionHeader)
+
+	fmt.Fprintf(w, "\nfunction __fish_ipfs_subcommands\n    switch $argv[1]\n")
+	root.walk(func(cmd *completionCommand) {
+		if len(cmd.Subcommands) > 0 {
+			fmt.Fprintf(w, "        case %s\n            printf '%%s\\n' %s\n", fishQuote(cmd.Path), strings.Join(cmd.subcommandNames(), " "))
+		}
+	})
+	fmt.Fprintf(w, "    end\nend\n\n")
+
+	fmt.Fprintln(w, "complete -c ipfs -e")
+	fmt.Fprintln(w, "complete -c ipfs -f")
+
+	root.walk(func(cmd *completionCommand) {
+		fmt.Fprintf(w, "\n# %s\n", cmd.Path)
+
+		is := fishQuote("__fish_ipfs_is " + fishQuote(cmd.Path))
+		for _, sub := range cmd.Subcommands {
+			fmt.Fprintf(w, "complete -c ipfs -n %s -a %s -d %s\n", is,
+				fishQuote(strings.TrimPrefix(sub.Path, cmd.Path+" ")), fishQuote(sub.Tagline))
+		}
+
+		switch cmd.Arguments {
+		case completeFiles:
+			fmt.Fprintf(w, "complete -c ipfs -n %s -F\n", is)
+		case completeKeys:
+			fmt.Fprintf(w, "complete -c ipfs -n %s -a '(__fish_ipfs_keys)'\n", is)
+		case completePins:
+			fmt.Fprintf(w, "complete -c ipfs -n %s -a '(__fish_ipfs_pins)'\n", is)
+		}
+
+		using := fishQuote("__fish_ipfs_using " + fishQuote(cmd.Path))
+		for _, opt := range cmd.Options {
+			line := "complete -c ipfs -n " + using
+			for _, name := range opt.Names {
+				if len(name) == 1 {
+					line += " -s " + name
+				} else {
+					line += " -l " + name
+				}
+			}
+			if opt.TakesValue {
+				line += " -r"
+				if opt.Values == completeKeys {
+					line += " -a '(__fish_ipfs_keys)'"
+				} else {
+					line += " -F"
+				}
+			}
+			line += " -d " + fishQuote(opt.Description)
+			fmt.Fprintln(w, line)
+		}
+	})
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"reflect"
+	"sort"
 	"strings"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
@@ -24,6 +26,11 @@ import (
 type ConfigUpdateOutput struct {
 	OldCfg map[string]interface{}
 	NewCfg map[string]interface{}
+
+	// Set when the profile is applied with --live: the changed keys that
+	// were applied to the running daemon, and the ones that need a restart.
+	Applied         []string `json:",omitempty"`
+	RestartRequired []string `json:",omitempty"`
 }
 
 type ConfigField struct {
@@ -36,6 +43,10 @@ const (
 	configJSONOptionName = "json"
 )
 
+// webhooksConfigKey is the config key of the webhooks, whose secrets are
+// never shown.
+const webhooksConfigKey = "Webhooks"
+
 var ConfigCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Get and set ipfs config values.",
@@ -118,6 +129,9 @@ Set the value of the 'Datastore.Path' key:
 		if err != nil {
 			return err
 		}
+		if output.Key == webhooksConfigKey {
+			scrubWebhookSecrets(output.Value)
+		}
 
 		return res.Emit(output)
 	},
@@ -144,7 +158,7 @@ var configShowCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Output config file contents.",
 		ShortDescription: `
-NOTE: For security reasons, this command will omit your private key. If you would like to make a full backup of your config (private key included), you must copy the config file from your repo.
+NOTE: For security reasons, this command will omit your private key and the secrets of your webhooks. If you would like to make a full backup of your config (private key included), you must copy the config file from your repo.
 `,
 	},
 	Type: map[string]interface{}{},
@@ -154,23 +168,7 @@ NOTE: For security reasons, this command will omit your private key. If you woul
 			return err
 		}
 
-		fname, err := config.Filename(cfgRoot)
-		if err != nil {
-			return err
-		}
-
-		data, err := ioutil.ReadFile(fname)
-		if err != nil {
-			return err
-		}
-
-		var cfg map[string]interface{}
-		err = json.Unmarshal(data, &cfg)
-		if err != nil {
-			return err
-		}
-
-		err = scrubValue(cfg, []string{config.IdentityTag, config.PrivKeyTag})
+		cfg, err := readScrubbedConfig(cfgRoot)
 		if err != nil {
 			return err
 		}
@@ -304,12 +302,24 @@ Available profiles:
 	},
 }
 
+const (
+	configDryRunOptionName = "dry-run"
+	configLiveOptionName   = "live"
+)
+
 var configProfileApplyCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Apply profile to config.",
+		ShortDescription: `
+Applies a profile to the config file. With --live, the profile is also applied
+to the running daemon: the changed settings that can be reloaded (see 'ipfs
+daemon reload') take effect immediately, and the ones that need a restart of
+the daemon are listed.
+`,
 	},
 	Options: []cmdkit.Option{
-		cmdkit.BoolOption("dry-run", "print difference between the current config and the config that would be generated"),
+		cmdkit.BoolOption(configDryRunOptionName, "print difference between the current config and the config that would be generated"),
+		cmdkit.BoolOption(configLiveOptionName, "apply the changes to the running daemon where possible"),
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("profile", true, false, "The profile to apply to the config."),
@@ -320,12 +330,29 @@ var configProfileApplyCmd = &cmds.Command{
 			return fmt.Errorf("%s is not a profile", req.Arguments[0])
 		}
 
-		dryRun, _ := req.Options["dry-run"].(bool)
+		dryRun, _ := req.Options[configDryRunOptionName].(bool)
+		live, _ := req.Options[configLiveOptionName].(bool)
+		if live && dryRun {
+			return cmdkit.Errorf(cmdkit.ErrClient, "--%s and --%s can't be used together", configLiveOptionName, configDryRunOptionName)
+		}
+
 		cfgRoot, err := cmdenv.GetConfigRoot(env)
 		if err != nil {
 			return err
 		}
 
+		var reload func() ([]string, error)
+		if live {
+			nd, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			if nd.LocalMode() {
+				return cmdkit.Errorf(cmdkit.ErrClient, "daemon not running")
+			}
+			reload = nd.ReloadConfig
+		}
+
 		oldCfg, newCfg, err := transformConfig(cfgRoot, req.Arguments[0], profile.Transform, dryRun)
 		if err != nil {
 			return err
@@ -341,10 +368,20 @@ var configProfileApplyCmd = &cmds.Command{
 			return err
 		}
 
-		return cmds.EmitOnce(res, &ConfigUpdateOutput{
+		out := &ConfigUpdateOutput{
 			OldCfg: oldCfgMap,
 			NewCfg: newCfgMap,
-		})
+		}
+
+		if reload != nil {
+			reloaded, err := reload()
+			if err != nil {
+				return err
+			}
+			out.Applied, out.RestartRequired = classifyConfigChanges(changedConfigKeys("", oldCfgMap, newCfgMap), reloaded)
+		}
+
+		return cmds.EmitOnce(res, out)
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ConfigUpdateOutput) error {
@@ -353,12 +390,68 @@ var configProfileApplyCmd = &cmds.Command{
 
 			w.Write(buf)
 
+			if live, _ := req.Options[configLiveOptionName].(bool); live {
+				fmt.Fprintln(w)
+				for _, k := range out.Applied {
+					fmt.Fprintf(w, "applied live: %s\n", k)
+				}
+				for _, k := range out.RestartRequired {
+					fmt.Fprintf(w, "restart required: %s\n", k)
+				}
+			}
+
 			return nil
 		}),
 	},
 	Type: ConfigUpdateOutput{},
 }
 
+// changedConfigKeys returns the dotted keys of the values that differ between
+// two config maps. Arrays are compared as a whole.
+func changedConfigKeys(prefix string, oldCfg, newCfg map[string]interface{}) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, m := range []map[string]interface{}{oldCfg, newCfg} {
+		for k := range m {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+
+			oldSub, oldIsMap := oldCfg[k].(map[string]interface{})
+			newSub, newIsMap := newCfg[k].(map[string]interface{})
+			switch {
+			case oldIsMap && newIsMap:
+				keys = append(keys, changedConfigKeys(prefix+k+".", oldSub, newSub)...)
+			case !reflect.DeepEqual(oldCfg[k], newCfg[k]):
+				keys = append(keys, prefix+k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// classifyConfigChanges splits changed keys into the ones covered by one of
+// the reloaded config sections and the ones that need a restart.
+func classifyConfigChanges(changed, reloaded []string) (applied, restart []string) {
+	for _, k := range changed {
+		live := false
+		for _, s := range reloaded {
+			if k == s || strings.HasPrefix(k, s+".") {
+				live = true
+				break
+			}
+		}
+		if live {
+			applied = append(applied, k)
+		} else {
+			restart = append(restart, k)
+		}
+	}
+	return applied, restart
+}
+
 func buildProfileHelp() string {
 	var out string
 
@@ -374,7 +467,52 @@ func buildProfileHelp() string {
 	return out
 }
 
-// scrubPrivKey scrubs private key for security reasons.
+// readScrubbedConfig reads the config file in cfgRoot, without the private
+// key and the secrets of the webhooks.
+func readScrubbedConfig(cfgRoot string) (map[string]interface{}, error) {
+	cfg, err := readConfigMap(cfgRoot)
+	if err != nil {
+		return nil, err
+	}
+	if err := scrubValue(cfg, []string{config.IdentityTag, config.PrivKeyTag}); err != nil {
+		return nil, err
+	}
+	scrubWebhookSecrets(cfg[webhooksConfigKey])
+	return cfg, nil
+}
+
+// readConfigMap reads the config file in cfgRoot as is.
+func readConfigMap(cfgRoot string) (map[string]interface{}, error) {
+	fname, err := config.Filename(cfgRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// scrubWebhookSecrets removes the secrets of hooks, the value of the Webhooks
+// config key.
+func scrubWebhookSecrets(hooks interface{}) {
+	list, _ := hooks.([]interface{})
+	for _, h := range list {
+		if h, ok := h.(map[string]interface{}); ok {
+			delete(h, "Secret")
+		}
+	}
+}
+
+// scrubPrivKey scrubs private key and the secrets of the webhooks for
+// security reasons.
 func scrubPrivKey(cfg *config.Config) (map[string]interface{}, error) {
 	cfgMap, err := config.ToMap(cfg)
 	if err != nil {
@@ -385,6 +523,7 @@ func scrubPrivKey(cfg *config.Config) (map[string]interface{}, error) {
 	if err != nil {
 		return nil, err
 	}
+	scrubWebhookSecrets(cfgMap[webhooksConfigKey])
 
 	return cfgMap, nil
 }
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+// DaemonCmd holds the commands controlling a running daemon. The daemon
+// itself is started by the 'ipfs daemon' command of the ipfs binary, which
+// exposes these as its subcommands.
+var DaemonCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Control a running daemon.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"reload": DaemonReloadCmd,
+	},
+}
+
+type ReloadOutput struct {
+	Reloaded []string
+}
+
+var DaemonReloadCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Reload the configuration of the running daemon.",
+		ShortDescription: `
+Re-reads the config file of the running daemon and applies the sections that
+can be changed without a restart:
+
+  Gateway.RateLimit     Gateway request and bandwidth limits
+  Gateway.Hosts         Per host gateway settings
+  Reprovider.Interval   Interval between reprovides
+  Discovery.MDNS        Local peer discovery with mDNS
+
+Changes to other sections still require restarting the daemon. The TLS
+certificates of the gateway are reloaded automatically when they change on
+disk.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if nd.LocalMode() {
+			return cmdkit.Errorf(cmdkit.ErrClient, "daemon not running")
+		}
+
+		reloaded, err := nd.ReloadConfig()
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &ReloadOutput{Reloaded: reloaded})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ReloadOutput) error {
+			for _, s := range out.Reloaded {
+				fmt.Fprintf(w, "reloaded %s\n", s)
+			}
+			return nil
+		}),
+	},
+	Type: ReloadOutput{},
+}
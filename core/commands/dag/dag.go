@@ -6,6 +6,8 @@ import (
 	"math"
 
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	iface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	"github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	"github.com/ipfs/go-ipfs/core/coredag"
 	"github.com/ipfs/go-ipfs/pin"
 
@@ -31,6 +33,7 @@ to deprecate and replace the existing 'ipfs object' command moving forward.
 		"put":     DagPutCmd,
 		"get":     DagGetCmd,
 		"resolve": DagResolveCmd,
+		"stat":    DagStatCmd,
 	},
 }
 
@@ -237,3 +240,73 @@ var DagResolveCmd = &cmds.Command{
 	},
 	Type: ResolveOutput{},
 }
+
+// StatOutput is the output type of 'dag stat' command
+type StatOutput struct {
+	Cid           cid.Cid
+	Size          uint64
+	WithLocality  bool   `json:",omitempty"`
+	LocalBlocks   uint64 `json:",omitempty"`
+	LocalBytes    uint64 `json:",omitempty"`
+	MissingBlocks uint64 `json:",omitempty"`
+	MissingBytes  uint64 `json:",omitempty"`
+}
+
+var DagStatCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Print the size of a dag.",
+		ShortDescription: `
+'ipfs dag stat' prints the size of a dag as recorded in its root. With
+--with-local, it also prints how much of the dag is stored locally, without
+fetching the blocks missing, for instance to check that a dag can be used
+offline.
+
+The size of the blocks missing is counted from the sizes recorded in the
+links to them, which some formats such as dag-cbor don't record.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ref", true, false, "The path of the dag root.").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption("with-local", "Report how much of the dag is stored locally."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		p, err := iface.ParsePath(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		withLocal, _ := req.Options["with-local"].(bool)
+		stat, err := api.Dag().Stat(req.Context, p, options.Dag.WithLocal(withLocal))
+		if err != nil {
+			return err
+		}
+
+		out := &StatOutput{Cid: stat.Cid, Size: stat.Size}
+		if loc := stat.Locality; loc != nil {
+			out.WithLocality = true
+			out.LocalBlocks = loc.LocalBlocks
+			out.LocalBytes = loc.LocalBytes
+			out.MissingBlocks = loc.MissingBlocks
+			out.MissingBytes = loc.MissingBytes
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *StatOutput) error {
+			fmt.Fprintf(w, "%s\nSize: %d\n", out.Cid, out.Size)
+			if out.WithLocality {
+				fmt.Fprintf(w, "Local: %d blocks, %d bytes\n", out.LocalBlocks, out.LocalBytes)
+				fmt.Fprintf(w, "Missing: %d blocks, at least %d bytes\n", out.MissingBlocks, out.MissingBytes)
+			}
+			return nil
+		}),
+	},
+	Type: StatOutput{},
+}
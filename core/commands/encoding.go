@@ -0,0 +1,296 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	cbor "gx/ipfs/QmRoARq3nkUb13HSKZGepCZSWe5GrVPwx7xURJGZ7KWv9V/go-ipld-cbor"
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+)
+
+// Output encodings supported by every command in addition to the ones
+// provided by go-ipfs-cmds.
+const (
+	// NDJSON emits one JSON value per line, which makes it easy to consume
+	// streaming commands.
+	NDJSON cmds.EncodingType = "ndjson"
+
+	// CBOR emits a sequence of CBOR data items (RFC 8742), one per value.
+	CBOR cmds.EncodingType = "cbor"
+)
+
+// MIMETypes maps encodings to the media types used for them in HTTP
+// responses.
+var MIMETypes = map[cmds.EncodingType]string{
+	cmds.JSON: "application/json",
+	cmds.XML:  "application/xml",
+	cmds.Text: "text/plain",
+	NDJSON:    "application/x-ndjson",
+	CBOR:      "application/cbor",
+}
+
+// negotiatedEncodings are the encodings selected by the Accept header of the
+// API requests, the others must be asked for with the encoding parameter:
+// the browsers list XML, and the text encoders are meant for the CLI.
+var negotiatedEncodings = []cmds.EncodingType{cmds.JSON, NDJSON, CBOR}
+
+func init() {
+	cmds.Encoders[NDJSON] = func(req *cmds.Request) func(io.Writer) cmds.Encoder {
+		return func(w io.Writer) cmds.Encoder { return &ndjsonEncoder{w: w} }
+	}
+	cmds.Decoders[NDJSON] = cmds.Decoders[cmds.JSON]
+
+	cmds.Encoders[CBOR] = func(req *cmds.Request) func(io.Writer) cmds.Encoder {
+		return func(w io.Writer) cmds.Encoder { return &cborEncoder{w: w} }
+	}
+	cmds.Decoders[CBOR] = func(r io.Reader) cmds.Decoder {
+		return &cborDecoder{r: bufio.NewReader(r)}
+	}
+}
+
+// EncodingForAccept returns the encoding of the media type the given Accept
+// header prefers, if it's one of the negotiated encodings. The header must
+// name the type: the wildcards, and the types listed after a type preferred
+// but unsupported, e.g. the text/html of the browsers, select nothing.
+func EncodingForAccept(accept string) (cmds.EncodingType, bool) {
+	type candidate struct {
+		mt string
+		q  float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{mt, q})
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+
+	// Ties are broken by order of appearance.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, enc := range negotiatedEncodings {
+		if MIMETypes[enc] == candidates[0].mt {
+			return enc, true
+		}
+	}
+	return "", false
+}
+
+// ndjsonEncoder writes each value as compact JSON on a line of its own.
+type ndjsonEncoder struct {
+	w io.Writer
+}
+
+func (e *ndjsonEncoder) Encode(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(buf, '\n'))
+	return err
+}
+
+// toGeneric converts v to the generic representation encoding/json would
+// decode its JSON form into, with the numbers as integers when they are. This
+// way CBOR output uses the same field names and formats as JSON output.
+func toGeneric(v interface{}) (interface{}, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return fromNumbers(out)
+}
+
+// fromNumbers replaces the json.Numbers of v with integers, or floats if they
+// have a fraction or don't fit.
+func fromNumbers(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u, nil
+		}
+		return v.Float64()
+	case []interface{}:
+		for i, e := range v {
+			var err error
+			if v[i], err = fromNumbers(e); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			var err error
+			if v[k], err = fromNumbers(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// cborEncoder writes each value as a CBOR data item, a sequence of them
+// (RFC 8742) for the streams.
+type cborEncoder struct {
+	w io.Writer
+}
+
+func (e *cborEncoder) Encode(v interface{}) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	buf, err := cbor.DumpObject(g)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(buf)
+	return err
+}
+
+// cborDecoder reads a sequence of CBOR data items, decoding each of them into
+// the given value through its JSON representation.
+type cborDecoder struct {
+	r *bufio.Reader
+}
+
+func (d *cborDecoder) Decode(v interface{}) error {
+	if _, err := d.r.Peek(1); err != nil {
+		return err // io.EOF at the end of the stream
+	}
+
+	var item bytes.Buffer
+	err := readCborItem(d.r, &item)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+
+	var g interface{}
+	if err := cbor.DecodeInto(item.Bytes(), &g); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// CBOR major types delimiting the data items.
+const (
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+)
+
+// cborBreak ends the indefinite length items.
+const cborBreak = 0xff
+
+// maxCborLength bounds the lengths of the strings we are willing to read.
+const maxCborLength = 1 << 30
+
+// readCborItem copies the next data item of r to buf, whose end the decoder
+// of the library can't tell in a sequence. Only the heads of the items are
+// read, the library decodes them.
+func readCborItem(r *bufio.Reader, buf *bytes.Buffer) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(b)
+	major, info := b>>5, b&0x1f
+
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if _, err := io.CopyN(buf, r, int64(size)); err != nil {
+			return err
+		}
+		var arg [8]byte
+		copy(arg[8-size:], buf.Bytes()[buf.Len()-size:])
+		n = binary.BigEndian.Uint64(arg[:])
+	case info == 31:
+		if major < cborBytes || major > cborMap {
+			return fmt.Errorf("cbor: unexpected break or indefinite length of major type %d", major)
+		}
+		// the chunks, elements or keys and values up to the break
+		for {
+			next, err := r.Peek(1)
+			if err != nil {
+				return err
+			}
+			if next[0] == cborBreak {
+				r.ReadByte()
+				buf.WriteByte(cborBreak)
+				return nil
+			}
+			if err := readCborItem(r, buf); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+
+	switch major {
+	case cborBytes, cborText:
+		if n > maxCborLength {
+			return fmt.Errorf("cbor: item too large (%d)", n)
+		}
+		_, err = io.CopyN(buf, r, int64(n))
+		return err
+	case cborArray, cborMap:
+		if major == cborMap {
+			n *= 2
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := readCborItem(r, buf); err != nil {
+				return err
+			}
+		}
+	case cborTag:
+		return readCborItem(r, buf)
+	}
+	return nil
+}
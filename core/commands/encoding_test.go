@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+)
+
+func TestCborEncoding(t *testing.T) {
+	type inner struct {
+		Name string
+	}
+	type value struct {
+		Hash  string
+		Size  int64
+		Neg   int
+		Ratio float64
+		Ok    bool
+		Links []inner
+		Extra map[string]int `json:",omitempty"`
+		Err   *string
+	}
+
+	var buf bytes.Buffer
+	enc := &cborEncoder{w: &buf}
+
+	for i, c := range []struct {
+		in  interface{}
+		hex string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{1.5, "fb3ff8000000000000"},
+		{"a", "6161"},
+		{[]int{1, 2}, "820102"},
+		{nil, "f6"},
+		{true, "f5"},
+		{map[string]int{"a": 2}, "a1616102"},
+	} {
+		buf.Reset()
+		if err := enc.Encode(c.in); err != nil {
+			t.Fatalf("case %d: %s", i, err)
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != c.hex {
+			t.Errorf("case %d: expected %s, got %s", i, c.hex, got)
+		}
+	}
+
+	// round trip a stream of values
+	buf.Reset()
+	values := []value{
+		{Hash: "QmFoo", Size: 1 << 40, Neg: -7, Ratio: 0.25, Ok: true, Links: []inner{{"a"}, {"b"}}},
+		{Hash: "QmBar", Extra: map[string]int{"x": 1}},
+	}
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := &cborDecoder{r: bufio.NewReader(&buf)}
+	for i, expected := range values {
+		var got value
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("value %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("value %d: expected %+v, got %+v", i, expected, got)
+		}
+	}
+	var v value
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestCborDecodeIndefinite(t *testing.T) {
+	// {_ "a": [_ 1, 2], "b": 1.5}, followed by another item
+	data, _ := hex.DecodeString("bf61619f0102ff6162fb3ff8000000000000ff" + "a1616101")
+	dec := &cborDecoder{r: bufio.NewReader(bytes.NewReader(data))}
+
+	var out struct {
+		A []int
+		B float64
+	}
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.A, []int{1, 2}) || out.B != 1.5 {
+		t.Fatalf("unexpected result: %+v", out)
+	}
+
+	var next struct{ A int }
+	if err := dec.Decode(&next); err != nil || next.A != 1 {
+		t.Fatalf("expected the next item to be decoded, got %+v: %v", next, err)
+	}
+}
+
+func TestNDJSONEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	enc := &ndjsonEncoder{w: &buf}
+	for _, v := range []interface{}{
+		map[string]interface{}{"Text": "a\nb", "List": []int{1, 2}},
+		json.RawMessage("{\n  \"Indented\": true\n}"),
+	} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := "{\"List\":[1,2],\"Text\":\"a\\nb\"}\n{\"Indented\":true}\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestEncodingForAccept(t *testing.T) {
+	for _, c := range []struct {
+		accept string
+		enc    cmds.EncodingType
+		ok     bool
+	}{
+		{"", "", false},
+		{"*/*", "", false},
+		{"application/json", cmds.JSON, true},
+		{"application/cbor", CBOR, true},
+		{"application/x-ndjson", NDJSON, true},
+		{"text/html, application/x-ndjson", "", false},
+		{"application/xml", "", false},
+		{"text/plain", "", false},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", false},
+		{"application/xml, application/json;q=0.9", "", false},
+		{"application/json;q=0.5, application/cbor", CBOR, true},
+		{"application/cbor;q=0, application/json;q=0.1", cmds.JSON, true},
+		{"application/cbor, application/json", CBOR, true},
+	} {
+		enc, ok := EncodingForAccept(c.accept)
+		if enc != c.enc || ok != c.ok {
+			t.Errorf("%q: expected (%q, %t), got (%q, %t)", c.accept, c.enc, c.ok, enc, ok)
+		}
+	}
+}
@@ -1,23 +1,28 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	gopath "path"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	iface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
-	bservice "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
-	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
 	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
@@ -46,25 +51,69 @@ of consistency guarantees. If the daemon is unexpectedly killed before running
 'ipfs files flush' on the files in question, then data may be lost. This also
 applies to running 'ipfs repo gc' concurrently with '--flush=false'
 operations.
+
+When the Files.FlushInterval or Files.FlushOps config keys are set, MFS is in
+write-back mode: '--flush' defaults to false, and the changes are flushed on
+that interval or after that number of operations. Run 'ipfs files flush' to
+flush them sooner.
 `,
 	},
 	Options: []cmdkit.Option{
-		cmdkit.BoolOption(filesFlushOptionName, "f", "Flush target and ancestors after write.").WithDefault(true),
+		cmdkit.BoolOption(filesFlushOptionName, "f", "Flush target and ancestors after write. Default: true, false when MFS is flushed in write-back mode."),
 	},
 	Subcommands: map[string]*cmds.Command{
-		"read":  filesReadCmd,
-		"write": filesWriteCmd,
-		"mv":    filesMvCmd,
-		"cp":    filesCpCmd,
-		"ls":    filesLsCmd,
-		"mkdir": filesMkdirCmd,
-		"stat":  filesStatCmd,
-		"rm":    filesRmCmd,
-		"flush": filesFlushCmd,
-		"chcid": filesChcidCmd,
+		"read":   filesReadCmd,
+		"write":  filesWriteCmd,
+		"mv":     filesMvCmd,
+		"cp":     filesCpCmd,
+		"ls":     filesLsCmd,
+		"mkdir":  filesMkdirCmd,
+		"stat":   filesStatCmd,
+		"rm":     filesRmCmd,
+		"flush":  filesFlushCmd,
+		"chcid":  filesChcidCmd,
+		"chmod":  filesChmodCmd,
+		"batch":  filesBatchCmd,
+		"export": filesExportCmd,
+		"shard":  filesShardCmd,
+		"touch":  filesTouchCmd,
+		"watch":  filesWatchCmd,
 	},
 }
 
+// filesChangeCmds are the subcommands changing MFS directly, rather than
+// through the CoreAPI.
+var filesChangeCmds = []*cmds.Command{
+	filesWriteCmd,
+	filesMvCmd,
+	filesCpCmd,
+	filesMkdirCmd,
+	filesRmCmd,
+	filesFlushCmd,
+	filesChcidCmd,
+	filesShardCmd,
+}
+
+func init() {
+	for _, cmd := range filesChangeCmds {
+		cmd.Run = lockFilesRoot(cmd.Run)
+	}
+}
+
+// lockFilesRoot holds the lock of the changes of MFS shared while run runs,
+// so that the root of a batch is never swapped in during a change.
+func lockFilesRoot(run func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error) func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error {
+	return func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		nd.FilesLock.RLock()
+		defer nd.FilesLock.RUnlock()
+		return run(req, res, env)
+	}
+}
+
 const (
 	filesCidVersionOptionName = "cid-version"
 	filesHashOptionName       = "hash"
@@ -84,6 +133,9 @@ type statOutput struct {
 	WithLocality   bool   `json:",omitempty"`
 	Local          bool   `json:",omitempty"`
 	SizeLocal      uint64 `json:",omitempty"`
+	Mode           uint32 `json:",omitempty"`
+	Mtime          int64  `json:",omitempty"`
+	MtimeNsecs     uint32 `json:",omitempty"`
 }
 
 const (
@@ -136,17 +188,6 @@ var filesStatCmd = &cmds.Command{
 
 		withLocal, _ := req.Options[filesWithLocalOptionName].(bool)
 
-		var dagserv ipld.DAGService
-		if withLocal {
-			// an offline DAGService will not fetch from the network
-			dagserv = dag.NewDAGService(bservice.New(
-				node.Blockstore,
-				offline.Exchange(node.Blockstore),
-			))
-		} else {
-			dagserv = node.DAG
-		}
-
 		nd, err := getNodeFromPath(req.Context, node, api, path)
 		if err != nil {
 			return err
@@ -161,11 +202,14 @@ var filesStatCmd = &cmds.Command{
 			return cmds.EmitOnce(res, o)
 		}
 
-		local, sizeLocal, err := walkBlock(req.Context, dagserv, nd)
+		stat, err := api.Dag().Stat(req.Context, iface.IpfsPath(nd.Cid()), options.Dag.WithLocal(true))
+		if err != nil {
+			return err
+		}
 
 		o.WithLocality = true
-		o.Local = local
-		o.SizeLocal = sizeLocal
+		o.Local = stat.Locality.Complete()
+		o.SizeLocal = stat.Locality.LocalBytes
 
 		return cmds.EmitOnce(res, o)
 	},
@@ -180,6 +224,15 @@ var filesStatCmd = &cmds.Command{
 
 			fmt.Fprintln(w, s)
 
+			if format, _ := req.Options[filesFormatOptionName].(string); format == defaultStatFormat {
+				if out.Mode != 0 {
+					fmt.Fprintf(w, "Mode: %04o\n", out.Mode)
+				}
+				if out.Mtime != 0 || out.MtimeNsecs != 0 {
+					fmt.Fprintf(w, "Mtime: %s\n", time.Unix(out.Mtime, int64(out.MtimeNsecs)).UTC().Format(time.RFC3339Nano))
+				}
+			}
+
 			if out.WithLocality {
 				fmt.Fprintf(w, "Local: %s of %s (%.2f%%)\n",
 					humanize.Bytes(out.SizeLocal),
@@ -225,6 +278,17 @@ func statNode(nd ipld.Node) (*statOutput, error) {
 		return nil, err
 	}
 
+	md, err := corefiles.ReadMetadata(nd)
+	if err != nil {
+		return nil, err
+	}
+	var mtime int64
+	var mtimeNsecs uint32
+	if !md.Mtime.IsZero() {
+		mtime = md.Mtime.Unix()
+		mtimeNsecs = uint32(md.Mtime.Nanosecond())
+	}
+
 	switch n := nd.(type) {
 	case *dag.ProtoNode:
 		d, err := ft.FSNodeFromBytes(n.Data())
@@ -248,6 +312,9 @@ func statNode(nd ipld.Node) (*statOutput, error) {
 			Size:           d.FileSize(),
 			CumulativeSize: cumulsize,
 			Type:           ndtype,
+			Mode:           md.Mode,
+			Mtime:          mtime,
+			MtimeNsecs:     mtimeNsecs,
 		}, nil
 	case *dag.RawNode:
 		return &statOutput{
@@ -262,46 +329,30 @@ func statNode(nd ipld.Node) (*statOutput, error) {
 	}
 }
 
-func walkBlock(ctx context.Context, dagserv ipld.DAGService, nd ipld.Node) (bool, uint64, error) {
-	// Start with the block data size
-	sizeLocal := uint64(len(nd.RawData()))
-
-	local := true
-
-	for _, link := range nd.Links() {
-		child, err := dagserv.Get(ctx, link.Cid)
-
-		if err == ipld.ErrNotFound {
-			local = false
-			continue
-		}
-
-		if err != nil {
-			return local, sizeLocal, err
-		}
-
-		childLocal, childLocalSize, err := walkBlock(ctx, dagserv, child)
-
-		if err != nil {
-			return local, sizeLocal, err
-		}
-
-		// Recursively add the child size
-		local = local && childLocal
-		sizeLocal += childLocalSize
-	}
-
-	return local, sizeLocal, nil
-}
-
 var filesCpCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Copy files into mfs.",
+		ShortDescription: `
+Copy an entry of MFS, or an object given by an /ipfs/, /ipns/ or /ipld/ path,
+to a path in MFS. IPNS names are resolved first. If the destination ends with
+a slash, the source is copied into it under its own name.
+
+If the '--parents' option is specified, the missing parent directories of the
+destination are created.
+
+EXAMPLE:
+
+    ipfs files cp /ipns/ipfs.io/index.html /sites/ipfs.io/index.html
+    ipfs files cp -p /ipfs/QmHash/docs /backup/2018/
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("source", true, false, "Source object to copy."),
 		cmdkit.StringArg("dest", true, false, "Destination to copy object to."),
 	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(filesParentsOptionName, "p", "Make parent directories as needed."),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -313,7 +364,8 @@ var filesCpCmd = &cmds.Command{
 			return err
 		}
 
-		flush, _ := req.Options[filesFlushOptionName].(bool)
+		flush := filesFlush(req, nd)
+		mkParents, _ := req.Options[filesParentsOptionName].(bool)
 
 		src, err := checkPath(req.Arguments[0])
 		if err != nil {
@@ -334,6 +386,19 @@ var filesCpCmd = &cmds.Command{
 		if err != nil {
 			return fmt.Errorf("cp: cannot get node from path %s: %s", src, err)
 		}
+		// mfs only holds unixfs nodes
+		switch node.(type) {
+		case *dag.ProtoNode, *dag.RawNode:
+		default:
+			return fmt.Errorf("cp: %s is not a unixfs node", src)
+		}
+
+		if mkParents {
+			err := ensureContainingDirectoryExists(nd.FilesRoot, dst, nil)
+			if err != nil {
+				return fmt.Errorf("cp: cannot create the parents of %s: %s", dst, err)
+			}
+		}
 
 		err = mfs.PutNode(nd.FilesRoot, dst, node)
 		if err != nil {
@@ -347,13 +412,16 @@ var filesCpCmd = &cmds.Command{
 			}
 		}
 
+		corefiles.AutoShardParents(req.Context, nd.FilesRoot, nd.DAG, nd.FilesShardSize, dst)
+		nd.FilesEvents.NotifyChange(nd.FilesRoot, corefiles.OpCopy, dst, "")
+		nd.FilesFlusher.Changed()
 		return nil
 	},
 }
 
 func getNodeFromPath(ctx context.Context, node *core.IpfsNode, api iface.CoreAPI, p string) (ipld.Node, error) {
 	switch {
-	case strings.HasPrefix(p, "/ipfs/"):
+	case strings.HasPrefix(p, "/ipfs/"), strings.HasPrefix(p, "/ipns/"), strings.HasPrefix(p, "/ipld/"):
 		np, err := iface.ParsePath(p)
 		if err != nil {
 			return nil, err
@@ -634,7 +702,13 @@ Example:
 			return err
 		}
 
-		return mfs.Mv(nd.FilesRoot, src, dst)
+		if err := mfs.Mv(nd.FilesRoot, src, dst); err != nil {
+			return err
+		}
+		corefiles.AutoShardParents(req.Context, nd.FilesRoot, nd.DAG, nd.FilesShardSize, src, dst)
+		nd.FilesEvents.NotifyChange(nd.FilesRoot, corefiles.OpMove, dst, src)
+		nd.FilesFlusher.Changed()
+		return nil
 	},
 }
 
@@ -703,7 +777,6 @@ stat' on the file or any of its ancestors.
 		create, _ := req.Options[filesCreateOptionName].(bool)
 		mkParents, _ := req.Options[filesParentsOptionName].(bool)
 		trunc, _ := req.Options[filesTruncateOptionName].(bool)
-		flush, _ := req.Options[filesFlushOptionName].(bool)
 		rawLeaves, rawLeavesDef := req.Options[filesRawLeavesOptionName].(bool)
 
 		prefix, err := getPrefixNew(req)
@@ -715,6 +788,7 @@ stat' on the file or any of its ancestors.
 		if err != nil {
 			return err
 		}
+		flush := filesFlush(req, nd)
 
 		offset, _ := req.Options[filesOffsetOptionName].(int64)
 		if offset < 0 {
@@ -750,6 +824,11 @@ stat' on the file or any of its ancestors.
 					log.Error("files: error closing file mfs file descriptor", err)
 				}
 			}
+			if retErr == nil {
+				corefiles.AutoShardParents(req.Context, nd.FilesRoot, nd.DAG, nd.FilesShardSize, path)
+				nd.FilesEvents.NotifyChange(nd.FilesRoot, corefiles.OpWrite, path, "")
+				nd.FilesFlusher.Changed()
+			}
 		}()
 
 		if trunc {
@@ -822,7 +901,7 @@ Examples:
 			return err
 		}
 
-		flush, _ := req.Options[filesFlushOptionName].(bool)
+		flush := filesFlush(req, n)
 
 		prefix, err := getPrefix(req)
 		if err != nil {
@@ -835,8 +914,14 @@ Examples:
 			Flush:      flush,
 			CidBuilder: prefix,
 		})
+		if err != nil {
+			return err
+		}
 
-		return err
+		corefiles.AutoShardParents(req.Context, n.FilesRoot, n.DAG, n.FilesShardSize, dirtomake)
+		n.FilesEvents.NotifyChange(n.FilesRoot, corefiles.OpMkdir, dirtomake, "")
+		n.FilesFlusher.Changed()
+		return nil
 	},
 }
 
@@ -845,7 +930,10 @@ var filesFlushCmd = &cmds.Command{
 		Tagline: "Flush a given path's data to disk.",
 		ShortDescription: `
 Flush a given path to disk. This is only useful when other commands
-are run with the '--flush=false'.
+are run with the '--flush=false', or when MFS is flushed in write-back mode.
+
+Flushing the root, the default, is the barrier of the write-back mode: the
+changes made before it are durable once it returns.
 `,
 	},
 	Arguments: []cmdkit.Argument{
@@ -862,6 +950,9 @@ are run with the '--flush=false'.
 			path = req.Arguments[0]
 		}
 
+		if gopath.Clean(path) == "/" {
+			return nd.FilesFlusher.Flush()
+		}
 		return mfs.FlushPath(nd.FilesRoot, path)
 	},
 }
@@ -891,14 +982,19 @@ Change the cid version or hash function of the root node of a given path.
 			path = req.Arguments[0]
 		}
 
-		flush, _ := req.Options[filesFlushOptionName].(bool)
+		flush := filesFlush(req, nd)
 
 		prefix, err := getPrefix(req)
 		if err != nil {
 			return err
 		}
 
-		return updatePath(nd.FilesRoot, path, prefix, flush)
+		if err := updatePath(nd.FilesRoot, path, prefix, flush); err != nil {
+			return err
+		}
+		nd.FilesEvents.NotifyChange(nd.FilesRoot, corefiles.OpChcid, path, "")
+		nd.FilesFlusher.Changed()
+		return nil
 	},
 }
 
@@ -982,37 +1078,449 @@ Remove files or directories.
 		// if '--force' specified, it will remove anything else,
 		// including file, directory, corrupted node, etc
 		force, _ := req.Options[forceOptionName].(bool)
-		if force {
-			err := pdir.Unlink(name)
+		if !force {
+			// get child node by name, when the node is corrupted and
+			// nonexistent, it will return specific error.
+			child, err := pdir.Child(name)
 			if err != nil {
 				return err
 			}
 
-			return pdir.Flush()
+			dashr, _ := req.Options[recursiveOptionName].(bool)
+
+			switch child.(type) {
+			case *mfs.Directory:
+				if !dashr {
+					return fmt.Errorf("%s is a directory, use -r to remove directories", path)
+				}
+			}
 		}
 
-		// get child node by name, when the node is corrupted and nonexistent,
-		// it will return specific error.
-		child, err := pdir.Child(name)
+		err = pdir.Unlink(name)
 		if err != nil {
 			return err
 		}
 
-		dashr, _ := req.Options[recursiveOptionName].(bool)
+		if filesFlush(req, nd) {
+			if err := pdir.Flush(); err != nil {
+				return err
+			}
+		}
+		corefiles.AutoShardParents(req.Context, nd.FilesRoot, nd.DAG, nd.FilesShardSize, path)
+		nd.FilesEvents.NotifyChange(nd.FilesRoot, corefiles.OpRemove, path, "")
+		nd.FilesFlusher.Changed()
+		return nil
+	},
+}
 
-		switch child.(type) {
-		case *mfs.Directory:
-			if !dashr {
-				return fmt.Errorf("%s is a directory, use -r to remove directories", path)
+var filesChmodCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Change the mode of a file or directory in mfs.",
+		ShortDescription: `
+Set the permission bits of the mode of a file or directory, given in octal.
+The mode is stored in the unixfs node of the entry and shown by 'ipfs files
+stat'.
+
+    $ ipfs files chmod 0644 /foo/bar
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("mode", true, false, "Mode to set, in octal."),
+		cmdkit.StringArg("path", true, false, "Path to the entry to change."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		mode, err := strconv.ParseUint(req.Arguments[0], 8, 32)
+		if err != nil || mode&^corefiles.ModeMask != 0 {
+			return cmdkit.Errorf(cmdkit.ErrClient, "invalid mode %q", req.Arguments[0])
+		}
+
+		path, err := checkPath(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+
+		return api.Files().Chmod(req.Context, path, uint32(mode))
+	},
+}
+
+const filesMtimeOptionName = "mtime"
+
+var filesTouchCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Change the modification time of a file or directory in mfs.",
+		ShortDescription: `
+Set the modification time of a file or directory to the current time, or to
+the time given with --mtime in seconds since the epoch, creating an empty
+file if the path doesn't exist. The time is stored in the unixfs node of the
+entry and shown by 'ipfs files stat'.
+
+    $ ipfs files touch --mtime=1500000000 /foo/bar
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("path", true, false, "Path to the entry to change."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Int64Option(filesMtimeOptionName, "Modification time in seconds since the epoch, now by default."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		path, err := checkPath(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		mtime := time.Now()
+		if secs, ok := req.Options[filesMtimeOptionName].(int64); ok {
+			mtime = time.Unix(secs, 0)
+		}
+
+		return api.Files().Touch(req.Context, path, mtime)
+	},
+}
+
+// filesBatchOp is an operation read by 'ipfs files batch'.
+type filesBatchOp struct {
+	Op   string
+	Path string
+	From string
+	Data []byte
+}
+
+type filesBatchOutput struct {
+	Hash string
+}
+
+var filesBatchCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Apply several changes to mfs at once.",
+		ShortDescription: `
+Apply a batch of operations to mfs in order, and print the hash of the new
+root. Either all the operations are applied or none is, and the root is
+flushed and published once, without the intermediate states.
+
+The operations are read as a stream of JSON objects, each having an 'Op', a
+'Path' and the fields of the operation:
+
+  write  replaces the content of the file at Path with Data, base64 encoded,
+         creating the file and its parents if needed
+  mv     moves the entry From to Path
+  rm     removes the entry at Path, recursively
+
+    $ cat ops.json
+    {"Op": "write", "Path": "/site/index.html", "Data": "PGgxPkhpPC9oMT4K"}
+    {"Op": "mv", "From": "/site/old.html", "Path": "/site/archive/old.html"}
+    {"Op": "rm", "Path": "/site/draft.html"}
+    $ ipfs files batch ops.json
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("ops", true, false, "The operations to apply.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		input, err := req.Files.NextFile()
+		if err != nil {
+			return err
+		}
+
+		var ops []iface.FilesOp
+		dec := json.NewDecoder(input)
+		for {
+			var op filesBatchOp
+			err := dec.Decode(&op)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return cmdkit.Errorf(cmdkit.ErrClient, "reading operation %d: %s", len(ops)+1, err)
 			}
+
+			p, err := checkPath(op.Path)
+			if err != nil {
+				return err
+			}
+			fop := iface.FilesOp{Op: op.Op, Path: p}
+			switch op.Op {
+			case corefiles.OpWrite:
+				fop.Data = bytes.NewReader(op.Data)
+			case corefiles.OpMove:
+				if fop.From, err = checkPath(op.From); err != nil {
+					return err
+				}
+			case corefiles.OpRemove:
+			default:
+				return cmdkit.Errorf(cmdkit.ErrClient, "unsupported operation %q", op.Op)
+			}
+			ops = append(ops, fop)
 		}
 
-		err = pdir.Unlink(name)
+		root, err := api.Files().Apply(req.Context, ops)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &filesBatchOutput{Hash: root.Cid().String()})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *filesBatchOutput) error {
+			fmt.Fprintln(w, out.Hash)
+			return nil
+		}),
+	},
+	Type: filesBatchOutput{},
+}
+
+type filesExportOutput struct {
+	Written uint64
+	Removed uint64
+	Error   string `json:",omitempty"`
+}
+
+const filesSyncOptionName = "sync"
+
+var filesExportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Write a file or directory of mfs to the local filesystem.",
+		ShortDescription: `
+Write the file or directory at the mfs path to the local path, a directory for
+directories. The files are written by the daemon, and the local path is made
+absolute relative to the current directory.
+
+With --sync, the changes of the mfs entry are written as they happen, until
+interrupted. Only the files and directories which changed are written again,
+and the ones removed from mfs are removed, leaving alone the local files
+which weren't exported.
+
+    $ ipfs files export /site ./site
+    $ ipfs files export --sync /site /var/www/site
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("path", true, false, "The mfs path to export."),
+		cmdkit.StringArg("local-path", true, false, "The local path to write to."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(filesSyncOptionName, "Keep writing the changes until interrupted."),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		dest, err := filepath.Abs(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		req.Arguments[1] = dest
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		path, err := checkPath(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		sync, _ := req.Options[filesSyncOptionName].(bool)
+		results, err := api.Files().Export(req.Context, path, req.Arguments[1], options.Files.Sync(sync))
+		if err != nil {
+			return err
+		}
+
+		for r := range results {
+			if !sync && r.Err != nil {
+				return r.Err
+			}
+			out := &filesExportOutput{Written: r.Written, Removed: r.Removed}
+			if r.Err != nil {
+				out.Error = r.Err.Error()
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *filesExportOutput) error {
+			if out.Error != "" {
+				fmt.Fprintf(w, "error: %s\n", out.Error)
+				return nil
+			}
+			fmt.Fprintf(w, "wrote %d, removed %d\n", out.Written, out.Removed)
+			return nil
+		}),
+	},
+	Type: filesExportOutput{},
+}
+
+type filesShardOutput struct {
+	Converted []string
+}
+
+const filesBasicOptionName = "basic"
+
+var filesShardCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Convert directories of mfs to or from HAMT shards.",
+		ShortDescription: `
+Convert the directory at the path to a HAMT shard, or to a basic directory
+with --basic, in place. Large directories are much faster to change as HAMT
+shards, since only the part of the shard holding the entries changed is
+rewritten.
+
+When Files.ShardingThreshold is set, the directories which entries are added
+to or removed from are converted automatically when the size of their block,
+or the size it would have as a basic directory, crosses it. With -r, the
+directories below the path, '/' by default, are converted according to the
+threshold, 256KB if it isn't set, such as the directories created before it
+was set. The root itself is never converted.
+
+    $ ipfs files shard /photos
+    $ ipfs files shard -r
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("path", false, false, "Path to the directory to convert."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(recursiveOptionName, "r", "Convert the directories below the path according to their size."),
+		cmdkit.BoolOption(filesBasicOptionName, "Convert to a basic directory."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		path := "/"
+		if len(req.Arguments) > 0 {
+			path = req.Arguments[0]
+		}
+		path, err = checkPath(path)
+		if err != nil {
+			return err
+		}
+
+		recursive, _ := req.Options[recursiveOptionName].(bool)
+		basic, _ := req.Options[filesBasicOptionName].(bool)
+		if !recursive {
+			converted, err := corefiles.Shard(req.Context, nd.FilesRoot, nd.DAG, path, !basic)
+			if err != nil {
+				return err
+			}
+			out := &filesShardOutput{}
+			if converted {
+				out.Converted = []string{path}
+			}
+			return cmds.EmitOnce(res, out)
+		}
+		if basic {
+			return cmdkit.Errorf(cmdkit.ErrClient, "--basic cannot be used with -r")
+		}
+
+		size := nd.FilesShardSize
+		if size == 0 {
+			size = corefiles.DefaultShardSize
+		}
+		converted, err := corefiles.AutoShardTree(req.Context, nd.FilesRoot, nd.DAG, path, size)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &filesShardOutput{Converted: converted})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *filesShardOutput) error {
+			for _, p := range out.Converted {
+				fmt.Fprintln(w, p)
+			}
+			return nil
+		}),
+	},
+	Type: filesShardOutput{},
+}
+
+type filesWatchOutput struct {
+	Op     string
+	Path   string
+	From   string `json:",omitempty"`
+	Hash   string `json:",omitempty"`
+	Missed uint64 `json:",omitempty"`
+}
+
+var filesWatchCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Watch the changes of mfs.",
+		ShortDescription: `
+Print the changes made to mfs by the files commands as they happen, until
+interrupted. Each change is printed as the operation, the path changed and
+its new hash, removals having no hash. Moves print the source path before the
+destination.
+
+A 'publish' of '/' is printed when a new root is published, which happens
+after the changes are flushed, whatever made them.
+
+Changes are missed when they aren't read fast enough. The next change printed
+says how many were missed, after which mfs should be scanned again.
+`,
+	},
+	Type: filesWatchOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
 		if err != nil {
 			return err
 		}
 
-		return pdir.Flush()
+		events, err := api.Files().Watch(req.Context)
+		if err != nil {
+			return err
+		}
+
+		for ev := range events {
+			out := &filesWatchOutput{
+				Op:     ev.Op,
+				Path:   ev.Path,
+				From:   ev.From,
+				Missed: ev.Missed,
+			}
+			if ev.Cid.Defined() {
+				out.Hash = ev.Cid.String()
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *filesWatchOutput) error {
+			if out.Missed > 0 {
+				fmt.Fprintf(w, "missed %d changes\n", out.Missed)
+			}
+			fields := []string{out.Op}
+			if out.From != "" {
+				fields = append(fields, out.From)
+			}
+			fields = append(fields, out.Path)
+			if out.Hash != "" {
+				fields = append(fields, out.Hash)
+			}
+			fmt.Fprintln(w, strings.Join(fields, " "))
+			return nil
+		}),
 	},
 }
 
@@ -1140,6 +1648,15 @@ func getFileHandle(r *mfs.Root, path string, create bool, builder cid.Builder) (
 	}
 }
 
+// filesFlush returns the value of the --flush option, true by default unless
+// MFS is flushed in write-back mode, see Files.FlushInterval.
+func filesFlush(req *cmds.Request, nd *core.IpfsNode) bool {
+	if flush, ok := req.Options[filesFlushOptionName].(bool); ok {
+		return flush
+	}
+	return !nd.FilesFlusher.WriteBack()
+}
+
 func checkPath(p string) (string, error) {
 	if len(p) == 0 {
 		return "", fmt.Errorf("paths must not be empty")
@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	filestore "github.com/ipfs/go-ipfs/filestore"
 
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -20,14 +23,20 @@ var FileStoreCmd = &cmds.Command{
 		Tagline: "Interact with filestore objects.",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"ls":     lsFileStore,
-		"verify": verifyFileStore,
-		"dups":   dupsFileStore,
+		"ls":            lsFileStore,
+		"verify":        verifyFileStore,
+		"dups":          dupsFileStore,
+		"materialize":   materializeFileStore,
+		"dematerialize": dematerializeFileStore,
+		"remap":         remapFileStore,
 	},
 }
 
 const (
 	fileOrderOptionName = "file-order"
+	repairOptionName    = "repair"
+	rechunkOptionName   = "rechunk"
+	sampleOptionName    = "sample"
 )
 
 var lsFileStore = &cmds.Command{
@@ -57,7 +66,7 @@ The output is:
 		}
 		args := req.Arguments
 		if len(args) > 0 {
-			return listByArgs(res, fs, args)
+			return listByArgs(res, fs, args, nil)
 		}
 
 		fileOrder, _ := req.Options[fileOrderOptionName].(bool)
@@ -113,6 +122,16 @@ missing:  <obj> could not be found in the filestore
 ERROR:    internal error, most likely due to a corrupt database
 
 For ERROR entries the error will also be printed to stderr.
+
+With --repair, the references whose backing file is gone or has changed
+(changed and no-file) are removed from the filestore, and 'dropped' is
+printed after their entry. The blocks can then be added again, or fetched
+from the network.
+
+With --rechunk, the backing files which have changed are also added again,
+as with 'ipfs add --nocopy', once their references are dropped. The new root
+of each file is pinned, and printed after the first entry dropped from the
+file. The root of the former contents of the file stays pinned, if it was.
 `,
 	},
 	Arguments: []cmdkit.Argument{
@@ -120,15 +139,21 @@ For ERROR entries the error will also be printed to stderr.
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(fileOrderOptionName, "verify the objects based on the order of the backing file"),
+		cmdkit.BoolOption(repairOptionName, "remove the references to changed or missing backing files"),
+		cmdkit.BoolOption(rechunkOptionName, "add the changed backing files again, implies --repair"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		_, fs, err := getFilestore(env)
 		if err != nil {
 			return err
 		}
+		repair, err := repairFunc(req, env, fs)
+		if err != nil {
+			return err
+		}
 		args := req.Arguments
 		if len(args) > 0 {
-			return listByArgs(res, fs, args)
+			return listByArgs(res, fs, args, repair)
 		}
 
 		fileOrder, _ := req.Options[fileOrderOptionName].(bool)
@@ -142,6 +167,11 @@ For ERROR entries the error will also be printed to stderr.
 			if r == nil {
 				break
 			}
+			if repair != nil {
+				if err := repair(r); err != nil {
+					return err
+				}
+			}
 			if err := res.Emit(r); err != nil {
 				return err
 			}
@@ -149,30 +179,8 @@ For ERROR entries the error will also be printed to stderr.
 
 		return nil
 	},
-	PostRun: cmds.PostRunMap{
-		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
-			for {
-				v, err := res.Next()
-				if err != nil {
-					if err == io.EOF {
-						return nil
-					}
-					return err
-				}
-
-				list, ok := v.(*filestore.ListRes)
-				if !ok {
-					return e.TypeErr(list, v)
-				}
-
-				if list.Status == filestore.StatusOtherError {
-					fmt.Fprintf(os.Stderr, "%s\n", list.ErrorMsg)
-				}
-				fmt.Fprintf(os.Stdout, "%s %s\n", list.Status.Format(), list.FormatLong())
-			}
-		},
-	},
-	Type: filestore.ListRes{},
+	PostRun: verifyPostRun,
+	Type:    filestore.ListRes{},
 }
 
 var dupsFileStore = &cmds.Command{
@@ -207,6 +215,222 @@ var dupsFileStore = &cmds.Command{
 	Type:     RefWrapper{},
 }
 
+type filestoreRefOutput struct {
+	Key      string
+	FilePath string
+	Offset   uint64
+	Size     uint64
+	Error    string `json:",omitempty"`
+}
+
+var materializeFileStore = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Copy the blocks of a file from the filestore into the repo.",
+		LongDescription: `
+Copy the blocks of a file which are stored in the filestore into the repo,
+and remove their references to the backing file, so that the backing file
+can be deleted without losing the blocks. The data is verified before
+being copied.
+
+The output is, for each reference removed:
+
+<hash> <size> <path> <offset>
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", true, false, "Path of the file to copy."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		p, err := coreiface.ParsePath(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		refs, err := api.Filestore().Materialize(req.Context, p)
+		if err != nil {
+			return err
+		}
+		return emitFilestoreRefs(res, refs)
+	},
+	Encoders: filestoreRefEncoders,
+	Type:     filestoreRefOutput{},
+}
+
+var dematerializeFileStore = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Replace the blocks of a file in the repo with filestore references.",
+		LongDescription: `
+Replace the blocks of a file which are stored in the repo with references to
+the same data in a local file, as if the file had been added with --nocopy,
+to reclaim the disk space they use. The local file must be under the root
+of the filestore, and the file must have been added with --raw-leaves: only
+its raw leaves can be referenced. The data is read back from the local file
+and verified before the blocks are removed from the repo.
+
+The output is, for each reference added:
+
+<hash> <size> <path> <offset>
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("ipfs-path", true, false, "Path of the file to replace."),
+		cmdkit.StringArg("local-path", true, false, "Path of the local file holding the same data."),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		file, err := filepath.Abs(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		req.Arguments[1] = file
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		p, err := coreiface.ParsePath(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+
+		refs, err := api.Filestore().Dematerialize(req.Context, p, req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		return emitFilestoreRefs(res, refs)
+	},
+	Encoders: filestoreRefEncoders,
+	Type:     filestoreRefOutput{},
+}
+
+func emitFilestoreRefs(res cmds.ResponseEmitter, refs <-chan coreiface.FilestoreRef) error {
+	for ref := range refs {
+		out := &filestoreRefOutput{
+			FilePath: ref.Path,
+			Offset:   ref.Offset,
+			Size:     ref.Size,
+		}
+		if ref.Cid.Defined() {
+			out.Key = ref.Cid.String()
+		}
+		if ref.Err != nil {
+			out.Error = ref.Err.Error()
+		}
+		if err := res.Emit(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var filestoreRefEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *filestoreRefOutput) error {
+		if out.Error != "" {
+			fmt.Fprintf(w, "error: %s: %s\n", out.Key, out.Error)
+			return nil
+		}
+		fmt.Fprintf(w, "%-50s %6d %s %d\n", out.Key, out.Size, out.FilePath, out.Offset)
+		return nil
+	}),
+}
+
+var remapFileStore = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Rewrite the paths of the backing files of the filestore.",
+		LongDescription: `
+Rewrite the references of the filestore to the files under the directory
+<from> so that they point to the same files under the directory <to>, after
+the files were moved, without adding them again. Both directories must be
+under the root of the filestore.
+
+The data isn't read while rewriting the references. Once all of them are
+rewritten, a random sample of them is verified, and printed like with
+'ipfs filestore verify'. If the sample doesn't verify, the references can
+be rewritten back by swapping <from> and <to>.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("from", true, false, "Directory the files were moved from."),
+		cmdkit.StringArg("to", true, false, "Directory the files were moved to."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption(sampleOptionName, "Number of references verified after rewriting them.").WithDefault(16),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		for i, p := range req.Arguments {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return err
+			}
+			req.Arguments[i] = abs
+		}
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		_, fs, err := getFilestore(env)
+		if err != nil {
+			return err
+		}
+
+		sample, _ := req.Options[sampleOptionName].(int)
+		r, err := filestore.Remap(fs, req.Arguments[0], req.Arguments[1], sample)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, r)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, r *filestore.RemapRes) error {
+			fmt.Fprintf(w, "remapped %d references\n", r.Remapped)
+			for _, list := range r.Sample {
+				fmt.Fprintf(w, "%s %s\n", list.Status.Format(), list.FormatLong())
+			}
+			return nil
+		}),
+	},
+	Type: filestore.RemapRes{},
+}
+
+// verifyPostRun prints the results of the verification of filestore references.
+var verifyPostRun = cmds.PostRunMap{
+	cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+		for {
+			v, err := res.Next()
+			if err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+
+			list, ok := v.(*filestore.ListRes)
+			if !ok {
+				return e.TypeErr(list, v)
+			}
+
+			if list.Status == filestore.StatusOtherError {
+				fmt.Fprintf(os.Stderr, "%s\n", list.ErrorMsg)
+			}
+			if list.Rechunked.Defined() {
+				fmt.Fprintf(os.Stdout, "%s %s dropped, rechunked as %s\n", list.Status.Format(), list.FormatLong(), list.Rechunked)
+				continue
+			}
+			if list.Dropped {
+				fmt.Fprintf(os.Stdout, "%s %s dropped\n", list.Status.Format(), list.FormatLong())
+				continue
+			}
+			fmt.Fprintf(os.Stdout, "%s %s\n", list.Status.Format(), list.FormatLong())
+		}
+	},
+}
+
 func getFilestore(env cmds.Environment) (*core.IpfsNode, *filestore.Filestore, error) {
 	n, err := cmdenv.GetNode(env)
 	if err != nil {
@@ -219,7 +443,46 @@ func getFilestore(env cmds.Environment) (*core.IpfsNode, *filestore.Filestore, e
 	return n, fs, err
 }
 
-func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string) error {
+// repairFunc returns the function repairing the references verified, as set
+// by the --repair and --rechunk options, or nil. The stale references are
+// dropped, and with --rechunk the changed backing files added again, once
+// each.
+func repairFunc(req *cmds.Request, env cmds.Environment, fs *filestore.Filestore) (func(r *filestore.ListRes) error, error) {
+	repair, _ := req.Options[repairOptionName].(bool)
+	rechunk, _ := req.Options[rechunkOptionName].(bool)
+	if !repair && !rechunk {
+		return nil, nil
+	}
+
+	var api coreiface.CoreAPI
+	if rechunk {
+		var err error
+		api, err = cmdenv.GetApi(env)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rechunked := make(map[string]bool)
+	return func(r *filestore.ListRes) error {
+		if err := filestore.DropStale(fs, r); err != nil {
+			return err
+		}
+		if !rechunk || !r.Dropped || r.Status != filestore.StatusFileChanged || rechunked[r.FilePath] {
+			return nil
+		}
+
+		rechunked[r.FilePath] = true
+		root, err := api.Filestore().Rechunk(req.Context, r.FilePath, options.Unixfs.Hash(r.Key.Prefix().MhType))
+		if err != nil {
+			return err
+		}
+		r.Rechunked = root.Cid()
+		return nil
+	}, nil
+}
+
+func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string, repair func(r *filestore.ListRes) error) error {
 	for _, arg := range args {
 		c, err := cid.Decode(arg)
 		if err != nil {
@@ -233,6 +496,11 @@ func listByArgs(res cmds.ResponseEmitter, fs *filestore.Filestore, args []string
 			continue
 		}
 		r := filestore.Verify(fs, c)
+		if repair != nil {
+			if err := repair(r); err != nil {
+				return err
+			}
+		}
 		if err := res.Emit(r); err != nil {
 			return err
 		}
@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	peermeta "github.com/ipfs/go-ipfs/core/peermeta"
 
 	ic "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
 	identify "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/protocol/identify"
@@ -35,6 +37,7 @@ type IdOutput struct {
 	Addresses       []string
 	AgentVersion    string
 	ProtocolVersion string
+	Metadata        map[string]string `json:",omitempty"`
 }
 
 const (
@@ -54,6 +57,7 @@ If no peer is specified, prints out information for local peers.
 <pver>: Protocol version.
 <pubkey>: Public key.
 <addrs>: Addresses (newline delimited).
+<meta>: Metadata, as key=value (newline delimited).
 
 EXAMPLE:
 
@@ -104,6 +108,13 @@ EXAMPLE:
 			return err
 		}
 
+		// peers not serving their metadata are listed without it
+		if n.PeerMeta != nil {
+			if _, err := n.PeerMeta.Fetch(req.Context, p.ID); err != nil {
+				log.Debugf("fetching the metadata of %s: %s", p.ID.Pretty(), err)
+			}
+		}
+
 		output, err := printPeer(n.Peerstore, p.ID)
 		if err != nil {
 			return err
@@ -120,6 +131,7 @@ EXAMPLE:
 				output = strings.Replace(output, "<pver>", out.ProtocolVersion, -1)
 				output = strings.Replace(output, "<pubkey>", out.PublicKey, -1)
 				output = strings.Replace(output, "<addrs>", strings.Join(out.Addresses, "\n"), -1)
+				output = strings.Replace(output, "<meta>", formatMetadata(out.Metadata), -1)
 				output = strings.Replace(output, "\\n", "\n", -1)
 				output = strings.Replace(output, "\\t", "\t", -1)
 				fmt.Fprint(w, output)
@@ -167,6 +179,11 @@ func printPeer(ps pstore.Peerstore, p peer.ID) (interface{}, error) {
 			info.AgentVersion = vs
 		}
 	}
+	if v, err := ps.Get(p, peermeta.PeerstoreKey); err == nil {
+		if meta, ok := v.(map[string]string); ok {
+			info.Metadata = meta
+		}
+	}
 
 	return info, nil
 }
@@ -197,5 +214,18 @@ func printSelf(node *core.IpfsNode) (interface{}, error) {
 	}
 	info.ProtocolVersion = identify.LibP2PVersion
 	info.AgentVersion = identify.ClientVersion
+	if node.PeerMeta != nil {
+		info.Metadata = node.PeerMeta.Metadata()
+	}
 	return info, nil
 }
+
+// formatMetadata returns the key=value lines of meta, sorted by key.
+func formatMetadata(meta map[string]string) string {
+	lines := make([]string, 0, len(meta))
+	for k, v := range meta {
+		lines = append(lines, k+"="+v)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
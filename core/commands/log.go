@@ -1,11 +1,15 @@
 package commands
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
-	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
 	lwriter "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log/writer"
 	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 )
@@ -22,6 +26,10 @@ var LogCmd = &cmds.Command{
 		ShortDescription: `
 'ipfs log' contains utility commands to affect or read the logging
 output of a running daemon.
+
+The log output is written to stderr, in the format of the IPFS_LOGGING_FMT
+environment variable: 'color' (the default), 'nocolor', or 'json' for one
+JSON object per line with the time, level, system, caller and message.
 `,
 	},
 
@@ -57,7 +65,11 @@ the event log.
 			subsystem = "*"
 		}
 
-		if err := logging.SetLogLevel(subsystem, level); err != nil {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+		if err := api.Log().SetLevel(req.Context, subsystem, level); err != nil {
 			return err
 		}
 
@@ -84,7 +96,15 @@ subsystems of a running daemon.
 `,
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		return cmds.EmitOnce(res, &stringList{logging.GetSubsystems()})
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+		subs, err := api.Log().Subsystems(req.Context)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &stringList{subs})
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, list *stringList) error {
@@ -97,22 +117,171 @@ subsystems of a running daemon.
 	Type: stringList{},
 }
 
+const (
+	logSubsystemOptionName = "subsystem"
+	logLevelOptionName     = "level"
+)
+
+// Severity of the log messages and event log entries, used to filter them
+// by level.
+var logLevels = map[string]int{
+	"debug":    0,
+	"info":     1,
+	"notice":   2,
+	"warning":  3,
+	"error":    4,
+	"critical": 5,
+}
+
+// LogOutput mirrors the log messages of the process to 'ipfs log tail', as
+// JSON objects with the time, level, system, caller and message, one per
+// line. The ipfs command writes its log output to it.
+var LogOutput = lwriter.NewMirrorWriter()
+
 var logTailCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
-		Tagline: "Read the event log.",
+		Tagline: "Read the event log and the log messages.",
 		ShortDescription: `
-Outputs event log messages (not other log messages) as they are generated.
+Outputs event log entries and log messages as they are generated.
 `,
-	},
+		LongDescription: `
+Outputs event log entries and log messages as they are generated. Each is a
+JSON object on its own line, the log messages with their time, level, system,
+caller and message. Only the log messages at the levels enabled by
+'ipfs log level' are output.
+
+The stream can be filtered on the daemon, which avoids raising log levels or
+transferring events you are not interested in:
 
+  --subsystem   Only output events and messages of the given subsystems (comma
+                separated), as listed by 'ipfs log ls'.
+  --level       Only output events and messages at least as severe as the
+                given level. The messages have the level they were logged at.
+                Events recording an error are at the 'error' level, all others
+                at the 'info' level.
+
+For example, to follow the bitswap errors:
+
+  ipfs log tail --subsystem=bitswap --level=error
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(logSubsystemOptionName, "Only output events and messages of these subsystems (comma separated)."),
+		cmdkit.StringOption(logLevelOptionName, "Only output events and messages at or above this level: debug, info, notice, warning, error, critical."),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		filter, err := newLogFilter(req)
+		if err != nil {
+			return err
+		}
+
 		ctx := req.Context
 		r, w := io.Pipe()
 		go func() {
 			defer w.Close()
 			<-ctx.Done()
 		}()
-		lwriter.WriterGroup.AddWriter(w)
+
+		// the events and the messages are written a line at a time, which
+		// the pipe doesn't interleave
+		for _, mw := range []*lwriter.MirrorWriter{lwriter.WriterGroup, LogOutput} {
+			var out io.WriteCloser = w
+			if filter != nil {
+				out = &logFilterWriter{w: w, match: filter.match}
+			}
+			mw.AddWriter(out)
+		}
 		return res.Emit(r)
 	},
 }
+
+type logFilter struct {
+	subsystems map[string]bool
+	level      int
+}
+
+// newLogFilter returns the filter described by the options of req, or nil if
+// all events should be output.
+func newLogFilter(req *cmds.Request) (*logFilter, error) {
+	subsystems, _ := req.Options[logSubsystemOptionName].(string)
+	level, _ := req.Options[logLevelOptionName].(string)
+	if subsystems == "" && level == "" {
+		return nil, nil
+	}
+
+	f := &logFilter{}
+	if subsystems != "" {
+		f.subsystems = make(map[string]bool)
+		for _, s := range strings.Split(subsystems, ",") {
+			f.subsystems[strings.TrimSpace(s)] = true
+		}
+	}
+	if level != "" {
+		lvl, ok := logLevels[strings.ToLower(level)]
+		if !ok {
+			return nil, fmt.Errorf("invalid log level %q, must be one of: debug, info, notice, warning, error, critical", level)
+		}
+		f.level = lvl
+	}
+	return f, nil
+}
+
+// match reports whether the given log message or event log entry passes the
+// filter.
+func (f *logFilter) match(line []byte) bool {
+	var event struct {
+		System string      `json:"system"`
+		Level  string      `json:"level"`
+		Error  interface{} `json:"error"`
+	}
+	if err := json.Unmarshal(line, &event); err != nil {
+		return false
+	}
+
+	if f.subsystems != nil && !f.subsystems[event.System] {
+		return false
+	}
+
+	lvl, ok := logLevels[strings.ToLower(event.Level)]
+	if !ok {
+		// an event, which has no level
+		lvl = logLevels["info"]
+		if event.Error != nil {
+			lvl = logLevels["error"]
+		}
+	}
+	return lvl >= f.level
+}
+
+// logFilterWriter passes the lines written to it that match through to w.
+type logFilterWriter struct {
+	w     io.WriteCloser
+	match func(line []byte) bool
+	buf   []byte
+}
+
+func (fw *logFilterWriter) Write(p []byte) (int, error) {
+	fw.buf = append(fw.buf, p...)
+	for {
+		i := bytes.IndexByte(fw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := fw.buf[:i+1]
+		if fw.match(line) {
+			if _, err := fw.w.Write(line); err != nil {
+				return 0, err
+			}
+		}
+		fw.buf = fw.buf[i+1:]
+	}
+	// Don't keep the consumed part of the buffer alive.
+	if len(fw.buf) == 0 {
+		fw.buf = nil
+	}
+	return len(p), nil
+}
+
+func (fw *logFilterWriter) Close() error {
+	return fw.w.Close()
+}
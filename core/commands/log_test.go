@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+)
+
+type nopCloser struct {
+	bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestLogFilter(t *testing.T) {
+	events := `{"event":"a","system":"bitswap"}
+{"event":"b","system":"dht"}
+{"event":"c","system":"bitswap","error":"failed"}
+not json
+{"event":"d","system":"dht","error":"failed"}
+{"level":"WARNING","system":"dht","message":"slow"}
+{"level":"DEBUG","system":"bitswap","message":"sent"}
+`
+
+	for _, c := range []struct {
+		subsystem, level string
+		expected         string
+	}{
+		{"bitswap", "", `{"event":"a","system":"bitswap"}
+{"event":"c","system":"bitswap","error":"failed"}
+{"level":"DEBUG","system":"bitswap","message":"sent"}
+`},
+		{"", "error", `{"event":"c","system":"bitswap","error":"failed"}
+{"event":"d","system":"dht","error":"failed"}
+`},
+		{"dht, bitswap", "ERROR", `{"event":"c","system":"bitswap","error":"failed"}
+{"event":"d","system":"dht","error":"failed"}
+`},
+		{"dht", "debug", `{"event":"b","system":"dht"}
+{"event":"d","system":"dht","error":"failed"}
+{"level":"WARNING","system":"dht","message":"slow"}
+`},
+		{"", "warning", `{"event":"c","system":"bitswap","error":"failed"}
+{"event":"d","system":"dht","error":"failed"}
+{"level":"WARNING","system":"dht","message":"slow"}
+`},
+	} {
+		req := &cmds.Request{Options: map[string]interface{}{
+			logSubsystemOptionName: c.subsystem,
+			logLevelOptionName:     c.level,
+		}}
+		f, err := newLogFilter(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out nopCloser
+		fw := &logFilterWriter{w: &out, match: f.match}
+		// Write in small chunks to exercise line buffering.
+		for data := []byte(events); len(data) > 0; {
+			n := 7
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := fw.Write(data[:n]); err != nil {
+				t.Fatal(err)
+			}
+			data = data[n:]
+		}
+
+		if out.String() != c.expected {
+			t.Errorf("subsystem %q, level %q: expected\n%s\ngot\n%s", c.subsystem, c.level, c.expected, out.String())
+		}
+	}
+
+	req := &cmds.Request{Options: map[string]interface{}{logLevelOptionName: "loud"}}
+	if _, err := newLogFilter(req); err == nil {
+		t.Fatal("expected an error for an invalid level")
+	}
+}
@@ -17,8 +17,16 @@ import (
 const (
 	mountIPFSPathOptionName = "ipfs-path"
 	mountIPNSPathOptionName = "ipns-path"
+	mountMFSPathOptionName  = "mfs-path"
 )
 
+// mountOutput is the output of 'ipfs mount', the mountpoints and the
+// mountpoint of MFS if mounted.
+type mountOutput struct {
+	config.Mounts
+	MFS string `json:",omitempty"`
+}
+
 var MountCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Mounts IPFS to the filesystem (read-only).",
@@ -74,11 +82,21 @@ baz
 baz
 > cat /ipfs/QmWLdkp93sNxGRjnFHPaYg8tCQ35NBY3XPn6KiETd3Z4WR
 baz
+
+MFS, the filesystem of 'ipfs files', is also mounted, writable, when the
+'--mfs-path' option or the Mounts.MFS config key is set. The files copied
+into it show up in 'ipfs files ls':
+
+> ipfs mount --mfs-path=/mfs
+> cp -r foo /mfs/
+> ipfs files ls /foo
+bar
 `,
 	},
 	Options: []cmdkit.Option{
 		cmdkit.StringOption(mountIPFSPathOptionName, "f", "The path where IPFS should be mounted."),
 		cmdkit.StringOption(mountIPNSPathOptionName, "n", "The path where IPNS should be mounted."),
+		cmdkit.StringOption(mountMFSPathOptionName, "m", "The path where MFS should be mounted, writable."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		cfg, err := cmdenv.GetConfig(env)
@@ -107,21 +125,40 @@ baz
 			nsdir = cfg.Mounts.IPNS // NB: be sure to not redeclare!
 		}
 
+		mfsdir, found := req.Options[mountMFSPathOptionName].(string)
+		if !found {
+			// optional, MFS isn't mounted by default
+			if val, err := nd.Repo.GetConfigKey("Mounts.MFS"); err == nil {
+				mfsdir, _ = val.(string)
+			}
+		}
+
 		err = nodeMount.Mount(nd, fsdir, nsdir)
 		if err != nil {
 			return err
 		}
 
-		var output config.Mounts
+		if mfsdir != "" {
+			err = nodeMount.MountMFS(nd, mfsdir)
+			if err != nil {
+				return err
+			}
+		}
+
+		var output mountOutput
 		output.IPFS = fsdir
 		output.IPNS = nsdir
+		output.MFS = mfsdir
 		return cmds.EmitOnce(res, &output)
 	},
-	Type: config.Mounts{},
+	Type: mountOutput{},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, mounts *config.Mounts) error {
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, mounts *mountOutput) error {
 			fmt.Fprintf(w, "IPFS mounted at: %s\n", mounts.IPFS)
 			fmt.Fprintf(w, "IPNS mounted at: %s\n", mounts.IPNS)
+			if mounts.MFS != "" {
+				fmt.Fprintf(w, "MFS mounted at: %s\n", mounts.MFS)
+			}
 
 			return nil
 		}),
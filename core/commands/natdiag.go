@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+// NatState is the output of 'ipfs diag nat'.
+type NatState struct {
+	Enabled     bool
+	Discovering bool
+	Found       bool
+	Mappings    []NatMapping
+	Remaps      int
+	LastRemap   string `json:",omitempty"`
+}
+
+// NatMapping is a port mapping of 'ipfs diag nat'.
+type NatMapping struct {
+	Protocol     string
+	InternalAddr string
+	ExternalPort int
+	ExternalAddr string `json:",omitempty"`
+	Error        string `json:",omitempty"`
+}
+
+func natState(n *core.IpfsNode) *NatState {
+	st := n.NATStatus()
+	out := &NatState{
+		Enabled:     st.Enabled,
+		Discovering: st.Discovering,
+		Found:       st.Found,
+		Mappings:    []NatMapping{},
+		Remaps:      st.Remaps,
+	}
+	if !st.LastRemap.IsZero() {
+		out.LastRemap = st.LastRemap.Format(time.RFC3339)
+	}
+	for _, m := range st.Mappings {
+		nm := NatMapping{
+			Protocol:     m.Protocol,
+			InternalAddr: m.InternalAddr.String(),
+			ExternalPort: m.ExternalPort,
+			Error:        m.Error,
+		}
+		if m.ExternalAddr != nil {
+			nm.ExternalAddr = m.ExternalAddr.String()
+		}
+		out.Mappings = append(out.Mappings, nm)
+	}
+	return out
+}
+
+var natStateEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, st *NatState) error {
+		switch {
+		case !st.Enabled:
+			fmt.Fprintln(w, "NAT port mapping disabled")
+			return nil
+		case st.Discovering:
+			fmt.Fprintln(w, "discovering the NAT device")
+			return nil
+		case !st.Found:
+			fmt.Fprintln(w, "no NAT device answering UPnP or NAT-PMP found")
+			return nil
+		}
+		for _, m := range st.Mappings {
+			if m.ExternalPort == 0 {
+				fmt.Fprintf(w, "%s: not mapped\n", m.InternalAddr)
+				continue
+			}
+			ext := m.ExternalAddr
+			if ext == "" {
+				ext = fmt.Sprintf("%s port %d (%s)", m.Protocol, m.ExternalPort, m.Error)
+			}
+			fmt.Fprintf(w, "%s: mapped to %s\n", m.InternalAddr, ext)
+		}
+		if st.LastRemap != "" {
+			fmt.Fprintf(w, "remapped %d times, last at %s\n", st.Remaps, st.LastRemap)
+		}
+		return nil
+	}),
+}
+
+var natDiagCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Print the state of the NAT port mapping.",
+		ShortDescription: `
+'ipfs diag nat' tells whether the node found a NAT device answering UPnP or
+NAT-PMP, and lists the ports it asked the device to map, with the external
+addresses they are mapped to.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"remap": natRemapDiagCmd,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.OnlineMode() {
+			return ErrNotOnline
+		}
+		return cmds.EmitOnce(res, natState(n))
+	},
+	Encoders: natStateEncoders,
+	Type:     NatState{},
+}
+
+var natRemapDiagCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Map the ports with the NAT device again.",
+		ShortDescription: `
+'ipfs diag nat remap' removes the port mappings of the node from the NAT device
+and maps the ports again, such as after the device restarted and lost them.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.OnlineMode() {
+			return ErrNotOnline
+		}
+		if err := n.RemapNAT(); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, natState(n))
+	},
+	Encoders: natStateEncoders,
+	Type:     NatState{},
+}
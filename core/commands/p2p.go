@@ -1,10 +1,16 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"text/tabwriter"
@@ -18,6 +24,7 @@ import (
 	ipfsaddr "gx/ipfs/QmSzEdVLaPMQGAKKGo4mKjsbWcfz6w8CoDjhRPxdk7xYdn/go-ipfs-addr"
 	madns "gx/ipfs/QmT4zgnKCyZBpRyxzsvZqUjzUkMWLJ2pZCw7uk6M6Kto5m/go-multiaddr-dns"
 	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	files "gx/ipfs/QmZMWMvWMVKCbHetJ4RgndbuEF1io2UpUxwQwtNjtYPzSC/go-ipfs-files"
 	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
 	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
@@ -54,6 +61,10 @@ type P2PStreamsOutput struct {
 const (
 	allowCustomProtocolOptionName = "allow-custom-protocol"
 	reportPeerIDOptionName        = "report-peer-id"
+	p2pTokenFileOptionName        = "token-file"
+	p2pTLSCertOptionName          = "tls-cert"
+	p2pTLSKeyOptionName           = "tls-key"
+	p2pTLSClientCAOptionName      = "tls-client-ca"
 )
 
 var resolveTimeout = 10 * time.Second
@@ -70,6 +81,7 @@ are refined`,
 	},
 
 	Subcommands: map[string]*cmds.Command{
+		"acl":     p2pACLCmd,
 		"stream":  p2pStreamCmd,
 		"forward": p2pForwardCmd,
 		"listen":  p2pListenCmd,
@@ -87,6 +99,12 @@ Forward connections made to <listen-address> to <target-address>.
 <protocol> specifies the libp2p protocol name to use for libp2p
 connections and/or handlers. It must be prefixed with '` + P2PProtoPrefix + `'.
 
+Any local process can connect to <listen-address>. To restrict the clients,
+--token-file makes them send the token of the file given first, followed by a
+newline, and --tls-cert, --tls-key and --tls-client-ca make them connect with
+TLS, with a certificate signed by --tls-client-ca. With --token-file=-, the
+token is read from the standard input.
+
 Example:
   ipfs p2p forward ` + P2PProtoPrefix + `myproto /ip4/127.0.0.1/tcp/4567 /ipfs/QmPeer
     - Forward connections to 127.0.0.1:4567 to '` + P2PProtoPrefix + `myproto' service on /ipfs/QmPeer
@@ -100,13 +118,23 @@ Example:
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
+		cmdkit.StringOption(p2pTokenFileOptionName, "File holding the token the local clients must send first, followed by a newline, - for stdin."),
+		cmdkit.StringOption(p2pTLSCertOptionName, "PEM certificate file to serve TLS to the local clients with."),
+		cmdkit.StringOption(p2pTLSKeyOptionName, "PEM key file of --tls-cert."),
+		cmdkit.StringOption(p2pTLSClientCAOptionName, "PEM file of the CA certificates the local clients' certificates must be signed by."),
 	},
+	PreRun: p2pLocalAuthPreRun,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := p2pGetNode(env)
 		if err != nil {
 			return err
 		}
 
+		auth, err := p2pLocalAuth(req)
+		if err != nil {
+			return err
+		}
+
 		protoOpt := req.Arguments[0]
 		listenOpt := req.Arguments[1]
 		targetOpt := req.Arguments[2]
@@ -129,10 +157,131 @@ Example:
 			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
 		}
 
-		return forwardLocal(n.Context(), n.P2P, n.Peerstore, proto, listen, targets)
+		return forwardLocal(n.Context(), n.P2P, n.Peerstore, proto, listen, targets, auth)
 	},
 }
 
+// p2pLocalAuthPreRun makes the files of the options restricting the local
+// clients absolute, as they are read by the daemon, and sends the token read
+// from stdin with --token-file=- as the body of the request, so that it's
+// never on the command line.
+func p2pLocalAuthPreRun(req *cmds.Request, env cmds.Environment) error {
+	for _, name := range []string{p2pTokenFileOptionName, p2pTLSCertOptionName, p2pTLSKeyOptionName, p2pTLSClientCAOptionName} {
+		path, _ := req.Options[name].(string)
+		if path == "" || path == "-" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		req.Options[name] = abs
+	}
+
+	if path, _ := req.Options[p2pTokenFileOptionName].(string); path == "-" {
+		token, err := ioutil.ReadAll(io.LimitReader(os.Stdin, maxTokenFileSize))
+		if err != nil {
+			return err
+		}
+		rf := files.NewReaderFile("token", "token", ioutil.NopCloser(bytes.NewReader(token)), nil)
+		req.Files = files.NewSliceFile("", "", []files.File{rf})
+	}
+	return nil
+}
+
+// maxTokenFileSize bounds the size of the token files read: a token of
+// p2p.MaxTokenLength, its line ending, and a byte to tell longer tokens apart.
+const maxTokenFileSize = p2p.MaxTokenLength + len("\r\n") + 1
+
+// p2pLocalToken reads the token of --token-file, from the body of req if it
+// is -.
+func p2pLocalToken(req *cmds.Request) (string, error) {
+	path, _ := req.Options[p2pTokenFileOptionName].(string)
+	var r io.Reader
+	switch path {
+	case "":
+		return "", nil
+	case "-":
+		if req.Files == nil {
+			return "", errors.New("--token-file=-: no token sent")
+		}
+		f, err := req.Files.NextFile()
+		if err != nil {
+			return "", fmt.Errorf("--token-file=-: %s", err)
+		}
+		defer f.Close()
+		r = f
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxTokenFileSize))
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimRight(string(b), "\r\n")
+	if len(token) > p2p.MaxTokenLength {
+		return "", fmt.Errorf("--token-file: the token exceeds %d bytes", p2p.MaxTokenLength)
+	}
+	if token == "" || strings.ContainsAny(token, "\r\n") {
+		return "", errors.New("--token-file: expected a token on a single line")
+	}
+	return token, nil
+}
+
+// p2pLocalAuth returns the restrictions of the local clients of the options
+// of req, nil if there are none.
+func p2pLocalAuth(req *cmds.Request) (*p2p.LocalAuth, error) {
+	certFile, _ := req.Options[p2pTLSCertOptionName].(string)
+	keyFile, _ := req.Options[p2pTLSKeyOptionName].(string)
+	caFile, _ := req.Options[p2pTLSClientCAOptionName].(string)
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("--tls-cert and --tls-key must be given together")
+	}
+	if caFile != "" && certFile == "" {
+		return nil, errors.New("--tls-client-ca needs --tls-cert and --tls-key")
+	}
+	token, err := p2pLocalToken(req)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" && certFile == "" {
+		return nil, nil
+	}
+	if token == "" && caFile == "" {
+		// TLS alone lets any local client connect
+		return nil, errors.New("--tls-cert needs --tls-client-ca or --token-file to restrict the clients")
+	}
+
+	auth := &p2p.LocalAuth{Token: token}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		auth.TLS.ClientCAs = pool
+		auth.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return auth, nil
+}
+
 // parseIpfsAddr is a function that takes in addr string and return ipfsAddrs
 func parseIpfsAddr(addr string) ([]ipfsaddr.IPFSAddr, error) {
 	mutiladdr, err := ma.NewMultiaddr(addr)
@@ -254,14 +403,14 @@ func checkPort(target ma.Multiaddr) error {
 }
 
 // forwardLocal forwards local connections to a libp2p service
-func forwardLocal(ctx context.Context, p *p2p.P2P, ps pstore.Peerstore, proto protocol.ID, bindAddr ma.Multiaddr, addrs []ipfsaddr.IPFSAddr) error {
+func forwardLocal(ctx context.Context, p *p2p.P2P, ps pstore.Peerstore, proto protocol.ID, bindAddr ma.Multiaddr, addrs []ipfsaddr.IPFSAddr, auth *p2p.LocalAuth) error {
 	for _, addr := range addrs {
 		ps.AddAddr(addr.ID(), addr.Multiaddr(), pstore.TempAddrTTL)
 	}
 	// TODO: return some info
 	// the length of the addrs must large than 0
 	// peerIDs in addr must be the same and choose addr[0] to connect
-	_, err := p.ForwardLocal(ctx, addrs[0].ID(), proto, bindAddr)
+	_, err := p.ForwardLocal(ctx, addrs[0].ID(), proto, bindAddr, auth)
 	return err
 }
 
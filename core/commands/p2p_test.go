@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	p2p "github.com/ipfs/go-ipfs/p2p"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+func TestP2PLocalTokenLength(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2ptoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		length int
+		ok     bool
+	}{
+		{p2p.MaxTokenLength, true},
+		{p2p.MaxTokenLength + 1, false},
+	} {
+		token := strings.Repeat("a", tc.length)
+		path := filepath.Join(dir, "token")
+		if err := ioutil.WriteFile(path, []byte(token+"\r\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		req := &cmds.Request{Options: cmdkit.OptMap{p2pTokenFileOptionName: path}}
+		out, err := p2pLocalToken(req)
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("expected a token of %d bytes to be refused", tc.length)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("token of %d bytes: %s", tc.length, err)
+		}
+		if out != token {
+			t.Errorf("expected the token of %d bytes to be read back, got %d bytes", tc.length, len(out))
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	p2p "github.com/ipfs/go-ipfs/p2p"
+
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+// P2PACLInfoOutput is the ACL of a protocol in the output of p2p acl ls
+type P2PACLInfoOutput struct {
+	Protocol string
+	Peers    []string
+	Ports    []int
+}
+
+// P2PACLLsOutput is output type of p2p acl ls command
+type P2PACLLsOutput struct {
+	ACLs []P2PACLInfoOutput
+}
+
+const (
+	p2pACLPeersOptionName = "peers"
+	p2pACLPortsOptionName = "ports"
+)
+
+var p2pACLCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Restrict the peers and ports of the p2p listeners.",
+		ShortDescription: `
+The ACL of a protocol restricts its listeners:
+
+  - 'ipfs p2p listen' only accepts the streams of the peers of the ACL, and
+    only forwards them to its ports.
+  - 'ipfs p2p forward' only forwards the connections to the peers of the ACL.
+
+An ACL without peers allows any peer, and one without ports any port. The
+ACLs are saved in the P2P.ACL key of the config.
+`,
+	},
+
+	Subcommands: map[string]*cmds.Command{
+		"ls":  p2pACLLsCmd,
+		"set": p2pACLSetCmd,
+		"rm":  p2pACLRmCmd,
+	},
+}
+
+var p2pACLLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the ACLs of the protocols.",
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(p2pHeadersOptionName, "v", "Print table headers (Protocol, Peers, Ports)."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := p2pGetNode(env)
+		if err != nil {
+			return err
+		}
+
+		output := &P2PACLLsOutput{ACLs: []P2PACLInfoOutput{}}
+		for proto, acl := range n.P2P.ACLs() {
+			info := P2PACLInfoOutput{Protocol: string(proto), Ports: acl.Ports}
+			for _, p := range acl.Peers {
+				info.Peers = append(info.Peers, p.Pretty())
+			}
+			output.ACLs = append(output.ACLs, info)
+		}
+		sort.Slice(output.ACLs, func(i, j int) bool {
+			return output.ACLs[i].Protocol < output.ACLs[j].Protocol
+		})
+
+		return cmds.EmitOnce(res, output)
+	},
+	Type: P2PACLLsOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *P2PACLLsOutput) error {
+			headers, _ := req.Options[p2pHeadersOptionName].(bool)
+			tw := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			if headers {
+				fmt.Fprintln(tw, "Protocol\tPeers\tPorts")
+			}
+			for _, acl := range out.ACLs {
+				peers := "*"
+				if len(acl.Peers) > 0 {
+					peers = strings.Join(acl.Peers, ",")
+				}
+				ports := "*"
+				if len(acl.Ports) > 0 {
+					s := make([]string, len(acl.Ports))
+					for i, port := range acl.Ports {
+						s[i] = strconv.Itoa(port)
+					}
+					ports = strings.Join(s, ",")
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", acl.Protocol, peers, ports)
+			}
+			tw.Flush()
+
+			return nil
+		}),
+	},
+}
+
+var p2pACLSetCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Set the ACL of a protocol.",
+		ShortDescription: `
+Replace the ACL of <protocol> with the peers and ports given, and close the
+listeners of the protocol it doesn't allow.
+
+Example:
+  ipfs p2p acl set ` + P2PProtoPrefix + `ssh --peers=QmPeerA,QmPeerB --ports=22
+    - Only accept the streams of '` + P2PProtoPrefix + `ssh' from QmPeerA and QmPeerB,
+      and only forward them to port 22
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("protocol", true, false, "Protocol name."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(p2pACLPeersOptionName, "Comma-separated IDs of the peers allowed, any peer if empty."),
+		cmdkit.StringOption(p2pACLPortsOptionName, "Comma-separated target ports allowed, any port if empty."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := p2pGetNode(env)
+		if err != nil {
+			return err
+		}
+
+		var acl p2p.ACL
+		peers, _ := req.Options[p2pACLPeersOptionName].(string)
+		for _, s := range splitList(peers) {
+			p, err := peer.IDB58Decode(s)
+			if err != nil {
+				return fmt.Errorf("invalid peer %q: %s", s, err)
+			}
+			acl.Peers = append(acl.Peers, p)
+		}
+		ports, _ := req.Options[p2pACLPortsOptionName].(string)
+		for _, s := range splitList(ports) {
+			port, err := strconv.Atoi(s)
+			if err != nil || port < 1 || port > 65535 {
+				return fmt.Errorf("invalid port %q", s)
+			}
+			acl.Ports = append(acl.Ports, port)
+		}
+
+		return n.SetP2PACL(protocol.ID(req.Arguments[0]), &acl)
+	},
+}
+
+var p2pACLRmCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove the ACL of a protocol.",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("protocol", true, false, "Protocol name."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := p2pGetNode(env)
+		if err != nil {
+			return err
+		}
+
+		proto := protocol.ID(req.Arguments[0])
+		if _, ok := n.P2P.ACLs()[proto]; !ok {
+			return errors.New("no ACL for " + string(proto))
+		}
+		return n.SetP2PACL(proto, nil)
+	},
+}
+
+// splitList splits the comma-separated list s, leaving out the empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
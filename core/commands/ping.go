@@ -1,16 +1,15 @@
 package commands
 
 import (
-	"context"
-	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 
-	ping "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/protocol/ping"
 	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
 	iaddr "gx/ipfs/QmSzEdVLaPMQGAKKGo4mKjsbWcfz6w8CoDjhRPxdk7xYdn/go-ipfs-addr"
 	"gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
@@ -28,11 +27,12 @@ type PingResult struct {
 }
 
 const (
-	pingCountOptionName = "count"
+	pingCountOptionName    = "count"
+	pingIntervalOptionName = "interval"
 )
 
 // ErrPingSelf is returned when the user attempts to ping themself.
-var ErrPingSelf = errors.New("error: can't ping self")
+var ErrPingSelf = coreiface.ErrPingSelf
 
 var PingCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
@@ -48,6 +48,7 @@ trip latency information.
 	},
 	Options: []cmdkit.Option{
 		cmdkit.IntOption(pingCountOptionName, "n", "Number of ping messages to send.").WithDefault(10),
+		cmdkit.StringOption(pingIntervalOptionName, "i", "Time to wait between two ping messages.").WithDefault("1s"),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -55,6 +56,11 @@ trip latency information.
 			return err
 		}
 
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
 		// Must be online!
 		if !n.OnlineMode() {
 			return ErrNotOnline
@@ -78,22 +84,35 @@ trip latency information.
 			return fmt.Errorf("error: ping count must be greater than 0, was %d", numPings)
 		}
 
-		if len(n.Peerstore.Addrs(pid)) == 0 {
-			// Make sure we can find the node in question
+		intervalStr, _ := req.Options[pingIntervalOptionName].(string)
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return fmt.Errorf("failed to parse interval %q: %s", intervalStr, err)
+		}
+
+		lookup := len(n.Peerstore.Addrs(pid)) == 0
+		if lookup {
 			if err := res.Emit(&PingResult{
 				Text:    fmt.Sprintf("Looking up peer %s", pid.Pretty()),
 				Success: true,
 			}); err != nil {
 				return err
 			}
+		}
 
-			ctx, cancel := context.WithTimeout(req.Context, kPingTimeout)
-			p, err := n.Routing.FindPeer(ctx, pid)
-			cancel()
-			if err != nil {
-				return res.Emit(&PingResult{Text: fmt.Sprintf("Peer lookup error: %s", err)})
-			}
-			n.Peerstore.AddAddrs(p.ID, p.Addrs, pstore.TempAddrTTL)
+		pings, err := api.Ping().Ping(req.Context, pid,
+			options.Ping.Count(numPings),
+			options.Ping.Interval(interval),
+			options.Ping.Timeout(kPingTimeout),
+		)
+		switch {
+		case err != nil && lookup && len(n.Peerstore.Addrs(pid)) == 0:
+			return res.Emit(&PingResult{Text: fmt.Sprintf("Peer lookup error: %s", err)})
+		case err != nil:
+			return res.Emit(&PingResult{
+				Success: false,
+				Text:    fmt.Sprintf("Ping error: %s", err),
+			})
 		}
 
 		if err := res.Emit(&PingResult{
@@ -103,44 +122,35 @@ trip latency information.
 			return err
 		}
 
-		ctx, cancel := context.WithTimeout(req.Context, kPingTimeout*time.Duration(numPings))
-		defer cancel()
-		pings, err := ping.Ping(ctx, n.PeerHost, pid)
-		if err != nil {
-			return res.Emit(&PingResult{
-				Success: false,
-				Text:    fmt.Sprintf("Ping error: %s", err),
-			})
-		}
-
-		var total time.Duration
-		ticker := time.NewTicker(time.Second)
-		defer ticker.Stop()
-		for i := 0; i < numPings; i++ {
-			t, ok := <-pings
-			if !ok {
-				break
-			}
+		var stats coreiface.PingStats
+		for r := range pings {
+			stats.Add(r)
 
-			if err := res.Emit(&PingResult{
+			out := &PingResult{
 				Success: true,
-				Time:    t,
-			}); err != nil {
+				Time:    r.RTT,
+			}
+			if r.Err != nil {
+				out = &PingResult{
+					Success: false,
+					Text:    fmt.Sprintf("Ping error: %s", r.Err),
+				}
+			}
+			if err := res.Emit(out); err != nil {
 				return err
 			}
+		}
+		if err := req.Context.Err(); err != nil {
+			return err
+		}
 
-			total += t
-
-			select {
-			case <-ticker.C:
-			case <-ctx.Done():
-				return ctx.Err()
-			}
+		text := fmt.Sprintf("Average latency: %.2fms", stats.AvgRTT.Seconds()*1000)
+		if stats.Received < stats.Sent {
+			text = fmt.Sprintf("%s, %d/%d pongs received (%.0f%% loss)", text, stats.Received, stats.Sent, stats.Loss()*100)
 		}
-		averagems := total.Seconds() * 1000 / float64(numPings)
 		return res.Emit(&PingResult{
-			Success: true,
-			Text:    fmt.Sprintf("Average latency: %.2fms", averagems),
+			Success: stats.Received > 0,
+			Text:    text,
 		})
 	},
 	Type: PingResult{},
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"strings"
+
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
+
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+const priorityOptionName = "priority"
+
+// prioritizedCommands are the paths of the commands fetching blocks, which
+// take the --priority option.
+var prioritizedCommands = []string{
+	"block/get",
+	"cat",
+	"dag/get",
+	"get",
+	"object/get",
+	"pin/add",
+	"refs",
+}
+
+// prioritizeCommands adds the --priority option to the prioritized commands
+// of root.
+func prioritizeCommands(root *cmds.Command) {
+	for _, path := range prioritizedCommands {
+		cmd := root
+		for _, name := range strings.Split(path, "/") {
+			cmd = cmd.Subcommands[name]
+			if cmd == nil {
+				panic("prioritized command not found: " + path)
+			}
+		}
+		cmd.Options = append(cmd.Options, cmdkit.StringOption(priorityOptionName, "How urgently the blocks fetched are needed: interactive, normal or background. The providers send the more urgent blocks first."))
+		cmd.Run = prioritizeRun(cmd.Run)
+	}
+}
+
+// prioritizeRun runs run with the priority of the --priority option, if set.
+func prioritizeRun(run func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error) func(*cmds.Request, cmds.ResponseEmitter, cmds.Environment) error {
+	return func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if s, ok := req.Options[priorityOptionName].(string); ok {
+			p, err := priority.Parse(s)
+			if err != nil {
+				return err
+			}
+			req.Context = priority.WithPriority(req.Context, p)
+		}
+		return run(req, re, env)
+	}
+}
@@ -0,0 +1,405 @@
+package commands
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	version "github.com/ipfs/go-ipfs"
+	oldcmds "github.com/ipfs/go-ipfs/commands"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	e "github.com/ipfs/go-ipfs/core/commands/e"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	lwriter "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log/writer"
+	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+)
+
+const (
+	profileOutputOptionName = "output"
+	profileTimeOptionName   = "profile-time"
+)
+
+// maxProfileLogSize caps the amount of log output kept in a profile.
+const maxProfileLogSize = 16 << 20
+
+// profileMutexFraction is the fraction of the mutex contention events
+// sampled while profiling, unless the sampling is already enabled.
+const profileMutexFraction = 10
+
+var sysProfileCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Collect a performance profile for debugging.",
+		ShortDescription: `
+Collects profiles and diagnostic information from a running daemon (or the
+local ipfs process if no daemon is running) into a single zip file, to attach
+to bug reports. The zip file contains:
+
+  goroutines.stacks   Stacks of all goroutines, human readable
+  goroutines.pprof    Goroutine profile
+  heap.pprof          Heap profile
+  mutex.pprof         Mutex contention profile, sampled over --profile-time
+  cpu.pprof           CPU profile, collected over --profile-time
+  version.json        Version information
+  sysinfo.json        System information, as reported by 'ipfs diag sys'
+  config.json         The config, as shown by 'ipfs config show'
+  events.log          Event log output emitted during --profile-time
+
+The secrets of the node are redacted from the logs: the private key, the
+secrets of the webhooks, the DSNs of the SQL datastores, the key of encrypted
+repos and the tokens of the p2p forwards.
+
+Profiles are collected without stopping the daemon, so they can be taken
+while it is under load. Any part that can't be collected is skipped and the
+reason recorded in errors.txt.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(profileOutputOptionName, "o", "The path where the output zip should be stored. Default: ./ipfs-profile-<timestamp>.zip"),
+		cmdkit.StringOption(profileTimeOptionName, "The amount of time spent collecting the CPU profile and logs.").WithDefault("30s"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		profileTimeStr, _ := req.Options[profileTimeOptionName].(string)
+		profileTime, err := time.ParseDuration(profileTimeStr)
+		if err != nil {
+			return fmt.Errorf("failed to parse profile duration %q: %s", profileTimeStr, err)
+		}
+
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		// the forwards are only known to the daemon
+		var tokens []string
+		if ctx, ok := env.(*oldcmds.Context); ok && ctx.Online {
+			if nd, err := ctx.GetNode(); err == nil && nd.P2P != nil {
+				tokens = nd.P2P.LocalTokens()
+			}
+		}
+
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(writeProfile(req.Context, w, cfgRoot, profileTime, tokens))
+		}()
+		return res.Emit(r)
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			req := res.Request()
+
+			v, err := res.Next()
+			if err != nil {
+				return err
+			}
+
+			outReader, ok := v.(io.Reader)
+			if !ok {
+				return e.New(e.TypeErr(outReader, v))
+			}
+
+			outPath, _ := req.Options[profileOutputOptionName].(string)
+			if outPath == "" {
+				outPath = "ipfs-profile-" + time.Now().UTC().Format("2006-01-02T15-04-05Z") + ".zip"
+			}
+
+			fi, err := os.Create(outPath)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(fi, outReader)
+			if cerr := fi.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(outPath)
+				return err
+			}
+
+			fmt.Fprintf(os.Stdout, "Wrote profiles to: %s\n", outPath)
+			return nil
+		},
+	},
+}
+
+// profileWriter writes the files of a profile to a zip archive, recording
+// the errors of the parts that couldn't be collected.
+type profileWriter struct {
+	zw   *zip.Writer
+	errs []string
+}
+
+// add writes a file to the archive using f. If f fails, the partially
+// written file is kept and the error recorded.
+func (p *profileWriter) add(name string, f func(w io.Writer) error) error {
+	w, err := p.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := f(w); err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("%s: %s", name, err))
+	}
+	return nil
+}
+
+func (p *profileWriter) addJSON(name string, v interface{}) error {
+	return p.add(name, func(w io.Writer) error {
+		buf, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(buf)
+		return err
+	})
+}
+
+func (p *profileWriter) addProfile(name, profile string, debug int) error {
+	return p.add(name, func(w io.Writer) error {
+		prof := pprof.Lookup(profile)
+		if prof == nil {
+			return fmt.Errorf("unknown profile %q", profile)
+		}
+		return prof.WriteTo(w, debug)
+	})
+}
+
+// writeProfile writes the profile to out, redacting the secrets of the
+// config and of the environment, and the p2p tokens.
+func writeProfile(ctx context.Context, out io.Writer, cfgRoot string, profileTime time.Duration, tokens []string) error {
+	p := &profileWriter{zw: zip.NewWriter(out)}
+
+	cfg, err := readConfigMap(cfgRoot)
+	if err != nil {
+		p.errs = append(p.errs, fmt.Sprintf("config.json: %s", err))
+	}
+	secrets := append(profileSecrets(cfgRoot, cfg), tokens...)
+	redact := newRedactor(secrets)
+
+	// Capture the event log while collecting the CPU profile.
+	logs := &limitedBuffer{max: maxProfileLogSize}
+	lr, lw := io.Pipe()
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		io.Copy(logs, lr)
+	}()
+	lwriter.WriterGroup.AddWriter(lw)
+	defer lw.Close()
+
+	// Take the snapshots first so they reflect the state of the node when
+	// the profile was requested.
+	if err := p.addProfile("goroutines.stacks", "goroutine", 2); err != nil {
+		return err
+	}
+	if err := p.addProfile("goroutines.pprof", "goroutine", 0); err != nil {
+		return err
+	}
+	if err := p.addProfile("heap.pprof", "heap", 0); err != nil {
+		return err
+	}
+
+	// Sample the mutex contention while collecting the CPU profile, the
+	// sampling is disabled by default.
+	if runtime.SetMutexProfileFraction(-1) == 0 {
+		runtime.SetMutexProfileFraction(profileMutexFraction)
+		defer runtime.SetMutexProfileFraction(0)
+	}
+
+	if err := p.add("cpu.pprof", func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := pprof.StartCPUProfile(&buf); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(profileTime):
+		case <-ctx.Done():
+		}
+		pprof.StopCPUProfile()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := p.addProfile("mutex.pprof", "mutex", 0); err != nil {
+		return err
+	}
+
+	// Closing the pipe makes the writer group drop it.
+	lw.Close()
+	<-logsDone
+	if err := p.add("events.log", func(w io.Writer) error {
+		_, err := redact.WriteString(w, logs.String())
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := p.addJSON("version.json", &VersionOutput{
+		Version: version.CurrentVersionNumber,
+		Commit:  version.CurrentCommit,
+		Repo:    fmt.Sprint(fsrepo.RepoVersion),
+		System:  runtime.GOARCH + "/" + runtime.GOOS,
+		Golang:  runtime.Version(),
+	}); err != nil {
+		return err
+	}
+
+	info := make(map[string]interface{})
+	for _, f := range []func(map[string]interface{}) error{runtimeInfo, envVarInfo, diskSpaceInfo, memInfo} {
+		if err := f(info); err != nil {
+			p.errs = append(p.errs, fmt.Sprintf("sysinfo.json: %s", err))
+		}
+	}
+	if err := p.addJSON("sysinfo.json", info); err != nil {
+		return err
+	}
+
+	if cfg != nil {
+		if err := p.add("config.json", func(w io.Writer) error {
+			if err := scrubValue(cfg, []string{config.IdentityTag, config.PrivKeyTag}); err != nil {
+				return err
+			}
+			scrubWebhookSecrets(cfg[webhooksConfigKey])
+			buf, err := config.HumanOutput(cfg)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(buf)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(p.errs) > 0 {
+		if err := p.add("errors.txt", func(w io.Writer) error {
+			for _, msg := range p.errs {
+				if _, err := fmt.Fprintln(w, msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	return p.zw.Close()
+}
+
+// limitedBuffer is a buffer that silently drops writes past max bytes.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := b.max - b.Len(); room < len(p) {
+		p = p[:room]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+// profileSecrets returns the secrets of the node found from its config cfg
+// and its environment: the private key, the secrets of the webhooks, the
+// DSNs of the SQL datastores, and the key of encrypted repos with its path.
+func profileSecrets(cfgRoot string, cfg map[string]interface{}) []string {
+	var secrets []string
+	readFile := func(path string) {
+		if path == "" {
+			return
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfgRoot, path)
+		}
+		if b, err := ioutil.ReadFile(path); err == nil {
+			secrets = append(secrets, strings.TrimSpace(string(b)))
+		}
+	}
+
+	secrets = append(secrets, os.Getenv(fsrepo.EnvRepoKey), os.Getenv(fsrepo.EnvRepoKeyFile))
+	readFile(os.Getenv(fsrepo.EnvRepoKeyFile))
+
+	if identity, ok := cfg[config.IdentityTag].(map[string]interface{}); ok {
+		key, _ := identity[config.PrivKeyTag].(string)
+		secrets = append(secrets, key)
+	}
+	hooks, _ := cfg[webhooksConfigKey].([]interface{})
+	for _, h := range hooks {
+		if h, ok := h.(map[string]interface{}); ok {
+			secret, _ := h["Secret"].(string)
+			secrets = append(secrets, secret)
+		}
+	}
+
+	// the SQL datastores read their DSN from the environment or a file
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if v["type"] == "sqlds" {
+				if env, ok := v["dsnEnv"].(string); ok && env != "" {
+					secrets = append(secrets, os.Getenv(env))
+				}
+				if path, ok := v["dsnFile"].(string); ok {
+					readFile(path)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	if ds, ok := cfg["Datastore"].(map[string]interface{}); ok {
+		walk(ds["Spec"])
+	}
+	return secrets
+}
+
+// newRedactor returns a replacer of the secrets, the longest first so that
+// the secrets containing others are redacted whole.
+func newRedactor(secrets []string) *strings.Replacer {
+	var nonEmpty []string
+	for _, s := range secrets {
+		if s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	sort.Slice(nonEmpty, func(i, j int) bool { return len(nonEmpty[i]) > len(nonEmpty[j]) })
+
+	oldnew := make([]string, 0, 2*len(nonEmpty))
+	for _, s := range nonEmpty {
+		oldnew = append(oldnew, s, "<redacted>")
+	}
+	return strings.NewReplacer(oldnew...)
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfileRedaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "dsn"), []byte("postgres://user:dsnpass@db/ipfs\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("IPFS_TEST_PROFILE_DSN", "postgres://user:envpass@db/ipfs")
+	defer os.Unsetenv("IPFS_TEST_PROFILE_DSN")
+
+	cfg := map[string]interface{}{
+		"Identity": map[string]interface{}{"PeerID": "QmPeer", "PrivKey": "privkey"},
+		"Webhooks": []interface{}{
+			map[string]interface{}{"URL": "https://example.com", "Secret": "hooksecret"},
+		},
+		"Datastore": map[string]interface{}{
+			"Spec": map[string]interface{}{
+				"type": "mount",
+				"mounts": []interface{}{
+					map[string]interface{}{"type": "sqlds", "dsnFile": "dsn"},
+					map[string]interface{}{"type": "sqlds", "dsnEnv": "IPFS_TEST_PROFILE_DSN"},
+				},
+			},
+		},
+	}
+	secrets := append(profileSecrets(dir, cfg), "p2ptoken")
+	logs := strings.Join([]string{
+		"key privkey",
+		"signing with hooksecret",
+		"connecting to postgres://user:dsnpass@db/ipfs",
+		"connecting to postgres://user:envpass@db/ipfs",
+		"client sent p2ptoken",
+		"peer QmPeer",
+	}, "\n")
+	redacted := newRedactor(secrets).Replace(logs)
+	for _, secret := range []string{"privkey", "hooksecret", "dsnpass", "envpass", "p2ptoken"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("expected %q to be redacted from:\n%s", secret, redacted)
+		}
+	}
+	if !strings.Contains(redacted, "peer QmPeer") {
+		t.Errorf("expected the rest of the logs to be kept:\n%s", redacted)
+	}
+
+	scrubWebhookSecrets(cfg["Webhooks"])
+	if _, ok := cfg["Webhooks"].([]interface{})[0].(map[string]interface{})["Secret"]; ok {
+		t.Error("expected the secrets of the webhooks to be scrubbed")
+	}
+}
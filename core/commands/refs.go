@@ -7,13 +7,12 @@ import (
 	"io"
 	"strings"
 
-	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
-	path "gx/ipfs/QmZErC2Ay6WuGi96CPg316PwitdwgLo6RxZRqVjJjRj2MR/go-path"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
-	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 )
 
@@ -34,13 +33,35 @@ type KeyList struct {
 }
 
 const (
-	refsFormatOptionName    = "format"
-	refsEdgesOptionName     = "edges"
-	refsUniqueOptionName    = "unique"
-	refsRecursiveOptionName = "recursive"
-	refsMaxDepthOptionName  = "max-depth"
+	refsFormatOptionName      = "format"
+	refsEdgesOptionName       = "edges"
+	refsUniqueOptionName      = "unique"
+	refsUniqueEdgesOptionName = "unique-edges"
+	refsRecursiveOptionName   = "recursive"
+	refsMaxDepthOptionName    = "max-depth"
+	refsCodecOptionName       = "codec"
 )
 
+// codecAliases are the multicodec names of the codecs go-cid names
+// otherwise.
+var codecAliases = map[string]string{
+	"dag-pb":   "protobuf",
+	"dag-cbor": "cbor",
+}
+
+// parseCodec returns the codec of name, as in cid.Codecs or its multicodec
+// name.
+func parseCodec(name string) (uint64, error) {
+	if alias, ok := codecAliases[name]; ok {
+		name = alias
+	}
+	codec, ok := cid.Codecs[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
+
 // RefsCmd is the `ipfs refs` command
 var RefsCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
@@ -52,6 +73,33 @@ with the following format:
   <link base58 hash>
 
 NOTE: List all references recursively by using the flag '-r'.
+`,
+		LongDescription: `
+Lists the hashes of all the links an IPFS or IPNS object(s) contains,
+with the following format:
+
+  <link base58 hash>
+
+NOTE: List all references recursively by using the flag '-r'.
+
+Refs are output as soon as they are found, so large DAGs can be analyzed
+while they are being fetched. The following options limit the traversal and
+the output:
+
+  --max-depth      Only list refs up to the given depth below the object
+                   (with -r).
+  --unique         List each linked object only once.
+  --unique-edges   List each link (source, destination and name) only once.
+                   Unlike --unique, an object linked from several parents is
+                   listed once per parent, which is what graph tools need.
+  --codec          Only list refs to objects of the given codecs (comma
+                   separated, e.g. 'dag-pb,raw'), named by their multicodec
+                   names or as by 'ipfs cid codecs' ('protobuf' for
+                   'dag-pb'). Objects of other codecs are still traversed.
+
+For example, to output the edges of the first two levels of a DAG:
+
+  ipfs refs -r --max-depth=2 --unique-edges --format="<src> <dst> <linkname>" <hash>
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
@@ -64,8 +112,10 @@ NOTE: List all references recursively by using the flag '-r'.
 		cmdkit.StringOption(refsFormatOptionName, "Emit edges with given format. Available tokens: <src> <dst> <linkname>.").WithDefault("<dst>"),
 		cmdkit.BoolOption(refsEdgesOptionName, "e", "Emit edge format: `<from> -> <to>`."),
 		cmdkit.BoolOption(refsUniqueOptionName, "u", "Omit duplicate refs from output."),
+		cmdkit.BoolOption(refsUniqueEdgesOptionName, "Omit duplicate edges from output."),
 		cmdkit.BoolOption(refsRecursiveOptionName, "r", "Recursively list links of child nodes."),
 		cmdkit.IntOption(refsMaxDepthOptionName, "Only for recursive refs, limits fetch and listing to the given depth").WithDefault(-1),
+		cmdkit.StringOption(refsCodecOptionName, "Only list refs to objects of these codecs (comma separated)."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		err := req.ParseBodyArgs()
@@ -74,16 +124,18 @@ NOTE: List all references recursively by using the flag '-r'.
 		}
 
 		ctx := req.Context
-		n, err := cmdenv.GetNode(env)
+		api, err := cmdenv.GetApi(env)
 		if err != nil {
 			return err
 		}
 
 		unique, _ := req.Options[refsUniqueOptionName].(bool)
+		uniqueEdges, _ := req.Options[refsUniqueEdgesOptionName].(bool)
 		recursive, _ := req.Options[refsRecursiveOptionName].(bool)
 		maxDepth, _ := req.Options[refsMaxDepthOptionName].(int)
 		edges, _ := req.Options[refsEdgesOptionName].(bool)
 		format, _ := req.Options[refsFormatOptionName].(string)
+		codecNames, _ := req.Options[refsCodecOptionName].(string)
 
 		if !recursive {
 			maxDepth = 1 // write only direct refs
@@ -97,23 +149,39 @@ NOTE: List all references recursively by using the flag '-r'.
 			format = "<src> -> <dst>"
 		}
 
-		objs, err := objectsForPaths(ctx, n, req.Arguments)
+		var codecs []uint64
+		if codecNames != "" {
+			for _, name := range strings.Split(codecNames, ",") {
+				codec, err := parseCodec(strings.TrimSpace(name))
+				if err != nil {
+					return err
+				}
+				codecs = append(codecs, codec)
+			}
+		}
+
+		paths, err := resolvePaths(ctx, api, req.Arguments)
 		if err != nil {
 			return err
 		}
 
-		rw := RefWriter{
-			res:      res,
-			DAG:      n.DAG,
-			Ctx:      ctx,
-			Unique:   unique,
-			PrintFmt: format,
-			MaxDepth: maxDepth,
-		}
+		for _, p := range paths {
+			refs, err := api.Dag().Refs(ctx, p,
+				options.Dag.MaxDepth(maxDepth),
+				options.Dag.Unique(unique),
+				options.Dag.UniqueEdges(uniqueEdges),
+				options.Dag.Codecs(codecs...),
+			)
+			if err != nil {
+				return err
+			}
 
-		for _, o := range objs {
-			if _, err := rw.WriteRefs(o); err != nil {
-				if err := res.Emit(&RefWrapper{Err: err.Error()}); err != nil {
+			for ref := range refs {
+				out := &RefWrapper{Ref: formatRef(format, ref)}
+				if ref.Err != nil {
+					out = &RefWrapper{Err: ref.Err.Error()}
+				}
+				if err := res.Emit(out); err != nil {
 					return err
 				}
 			}
@@ -159,21 +227,21 @@ Displays the hashes of all local objects.
 	Type:     RefWrapper{},
 }
 
-func objectsForPaths(ctx context.Context, n *core.IpfsNode, paths []string) ([]ipld.Node, error) {
-	objects := make([]ipld.Node, len(paths))
+func resolvePaths(ctx context.Context, api coreiface.CoreAPI, paths []string) ([]coreiface.ResolvedPath, error) {
+	resolved := make([]coreiface.ResolvedPath, len(paths))
 	for i, sp := range paths {
-		p, err := path.ParsePath(sp)
+		p, err := coreiface.ParsePath(sp)
 		if err != nil {
 			return nil, err
 		}
 
-		o, err := core.Resolve(ctx, n.Namesys, n.Resolver, p)
+		rp, err := api.ResolvePath(ctx, p)
 		if err != nil {
 			return nil, err
 		}
-		objects[i] = o
+		resolved[i] = rp
 	}
-	return objects, nil
+	return resolved, nil
 }
 
 type RefWrapper struct {
@@ -181,153 +249,15 @@ type RefWrapper struct {
 	Err string
 }
 
-type RefWriter struct {
-	res cmds.ResponseEmitter
-	DAG ipld.DAGService
-	Ctx context.Context
-
-	Unique   bool
-	MaxDepth int
-	PrintFmt string
-
-	seen map[string]int
-}
-
-// WriteRefs writes refs of the given object to the underlying writer.
-func (rw *RefWriter) WriteRefs(n ipld.Node) (int, error) {
-	return rw.writeRefsRecursive(n, 0)
-}
-
-func (rw *RefWriter) writeRefsRecursive(n ipld.Node, depth int) (int, error) {
-	nc := n.Cid()
-
-	var count int
-	for i, ng := range ipld.GetDAG(rw.Ctx, rw.DAG, n) {
-		lc := n.Links()[i].Cid
-		goDeeper, shouldWrite := rw.visit(lc, depth+1) // The children are at depth+1
-
-		// Avoid "Get()" on the node and continue with next Link.
-		// We can do this if:
-		// - We printed it before (thus it was already seen and
-		//   fetched with Get()
-		// - AND we must not go deeper.
-		// This is an optimization for pruned branches which have been
-		// visited before.
-		if !shouldWrite && !goDeeper {
-			continue
-		}
-
-		// We must Get() the node because:
-		// - it is new (never written)
-		// - OR we need to go deeper.
-		// This ensures printed refs are always fetched.
-		nd, err := ng.Get(rw.Ctx)
-		if err != nil {
-			return count, err
-		}
-
-		// Write this node if not done before (or !Unique)
-		if shouldWrite {
-			if err := rw.WriteEdge(nc, lc, n.Links()[i].Name); err != nil {
-				return count, err
-			}
-			count++
-		}
-
-		// Keep going deeper. This happens:
-		// - On unexplored branches
-		// - On branches not explored deep enough
-		// Note when !Unique, branches are always considered
-		// unexplored and only depth limits apply.
-		if goDeeper {
-			c, err := rw.writeRefsRecursive(nd, depth+1)
-			count += c
-			if err != nil {
-				return count, err
-			}
-		}
-	}
-
-	return count, nil
-}
-
-// visit returns two values:
-// - the first boolean is true if we should keep traversing the DAG
-// - the second boolean is true if we should print the CID
-//
-// visit will do branch pruning depending on rw.MaxDepth, previously visited
-// cids and whether rw.Unique is set. i.e. rw.Unique = false and
-// rw.MaxDepth = -1 disables any pruning. But setting rw.Unique to true will
-// prune already visited branches at the cost of keeping as set of visited
-// CIDs in memory.
-func (rw *RefWriter) visit(c cid.Cid, depth int) (bool, bool) {
-	atMaxDepth := rw.MaxDepth >= 0 && depth == rw.MaxDepth
-	overMaxDepth := rw.MaxDepth >= 0 && depth > rw.MaxDepth
-
-	// Shortcut when we are over max depth. In practice, this
-	// only applies when calling refs with --maxDepth=0, as root's
-	// children are already over max depth. Otherwise nothing should
-	// hit this.
-	if overMaxDepth {
-		return false, false
-	}
-
-	// We can shortcut right away if we don't need unique output:
-	//   - we keep traversing when not atMaxDepth
-	//   - always print
-	if !rw.Unique {
-		return !atMaxDepth, true
-	}
-
-	// Unique == true from this point.
-	// Thus, we keep track of seen Cids, and their depth.
-	if rw.seen == nil {
-		rw.seen = make(map[string]int)
-	}
-	key := string(c.Bytes())
-	oldDepth, ok := rw.seen[key]
-
-	// Unique == true && depth < MaxDepth (or unlimited) from this point
-
-	// Branch pruning cases:
-	// - We saw the Cid before and either:
-	//   - Depth is unlimited (MaxDepth = -1)
-	//   - We saw it higher (smaller depth) in the DAG (means we must have
-	//     explored deep enough before)
-	// Because we saw the CID, we don't print it again.
-	if ok && (rw.MaxDepth < 0 || oldDepth <= depth) {
-		return false, false
-	}
-
-	// Final case, we must keep exploring the DAG from this CID
-	// (unless we hit the depth limit).
-	// We note down its depth because it was either not seen
-	// or is lower than last time.
-	// We print if it was not seen.
-	rw.seen[key] = depth
-	return !atMaxDepth, !ok
-}
-
-// Write one edge
-func (rw *RefWriter) WriteEdge(from, to cid.Cid, linkname string) error {
-	if rw.Ctx != nil {
-		select {
-		case <-rw.Ctx.Done(): // just in case.
-			return rw.Ctx.Err()
-		default:
-		}
-	}
-
-	var s string
-	switch {
-	case rw.PrintFmt != "":
-		s = rw.PrintFmt
-		s = strings.Replace(s, "<src>", from.String(), -1)
-		s = strings.Replace(s, "<dst>", to.String(), -1)
-		s = strings.Replace(s, "<linkname>", linkname, -1)
-	default:
-		s += to.String()
+// formatRef formats a ref using the tokens accepted by the format option.
+func formatRef(format string, ref coreiface.DagRef) string {
+	if format == "" {
+		return ref.To.String()
 	}
 
-	return rw.res.Emit(&RefWrapper{Ref: s})
+	s := format
+	s = strings.Replace(s, "<src>", ref.From.String(), -1)
+	s = strings.Replace(s, "<dst>", ref.To.String(), -1)
+	s = strings.Replace(s, "<linkname>", ref.Name, -1)
+	return s
 }
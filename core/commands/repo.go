@@ -2,24 +2,34 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"text/tabwriter"
+	"time"
 
+	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
 	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
 	cmdkit "gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 )
 
@@ -41,18 +51,30 @@ var RepoCmd = &cmds.Command{
 		"fsck":    repoFsckCmd,
 		"version": repoVersionCmd,
 		"verify":  repoVerifyCmd,
+		"convert": repoConvertCmd,
+		"compact": repoCompactCmd,
+		"backup":  repoBackupCmd,
+		"restore": repoRestoreCmd,
+		"cache":   repoCacheCmd,
+		"named":   repoNamedCmd,
 	},
 }
 
 // GcResult is the result returned by "repo gc" command.
 type GcResult struct {
-	Key   cid.Cid
-	Error string `json:",omitempty"`
+	Key    cid.Cid
+	Error  string           `json:",omitempty"`
+	DryRun *gc.DryRunReport `json:",omitempty"`
+
+	// Progress is set instead of Key with --progress
+	Progress *coreiface.GcProgress `json:",omitempty"`
 }
 
 const (
 	repoStreamErrorsOptionName = "stream-errors"
 	repoQuietOptionName        = "quiet"
+	repoDryRunOptionName       = "dry-run"
+	repoProgressOptionName     = "progress"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -62,11 +84,27 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+
+The collection runs concurrently with adds, pins and reads: it only waits for
+the adds and pins in progress when it starts, and doesn't block new ones.
+Objects added, pinned or read while it runs are kept until the next
+collection.
+
+With --dry-run, nothing is removed: the number and size of the objects the
+collection would remove are reported instead, split between the objects no
+other object links to and the insides of unpinned DAGs, along with the objects
+it would keep as they are pinned or reachable from the MFS root.
+
+With --progress, the progress of the collection is reported instead of the
+removed objects: the current phase, the number of objects examined and
+removed, the space reclaimed and the number of errors. Errors are streamed.
 `,
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption(repoStreamErrorsOptionName, "Stream errors."),
 		cmdkit.BoolOption(repoQuietOptionName, "q", "Write minimal output."),
+		cmdkit.BoolOption(repoDryRunOptionName, "Report what would be removed without removing anything."),
+		cmdkit.BoolOption(repoProgressOptionName, "Report the progress of the collection instead of the removed objects."),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -74,6 +112,18 @@ order to reclaim hard disk space.
 			return err
 		}
 
+		if dryRun, _ := req.Options[repoDryRunOptionName].(bool); dryRun {
+			report, err := corerepo.GarbageCollectDryRun(n, req.Context)
+			if err != nil {
+				return err
+			}
+			return cmds.EmitOnce(re, &GcResult{DryRun: report})
+		}
+
+		if progress, _ := req.Options[repoProgressOptionName].(bool); progress {
+			return gcWithProgress(req, re, env)
+		}
+
 		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
 
 		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
@@ -104,7 +154,7 @@ order to reclaim hard disk space.
 			}
 		}
 
-		return nil
+		return corerepo.SyncStorageUsage(n)
 	},
 	Type: GcResult{},
 	Encoders: cmds.EncoderMap{
@@ -116,6 +166,16 @@ order to reclaim hard disk space.
 				return err
 			}
 
+			if gcr.DryRun != nil {
+				return printDryRunReport(w, gcr.DryRun, quiet)
+			}
+
+			if p := gcr.Progress; p != nil {
+				_, err := fmt.Fprintf(w, "%s: scanned %d, removed %d (%s), kept %d, %d errors\n",
+					p.Phase, p.Scanned, p.Removed, humanize.Bytes(p.BytesRemoved), p.Marked, p.Errors)
+				return err
+			}
+
 			prefix := "removed "
 			if quiet {
 				prefix = ""
@@ -127,6 +187,71 @@ order to reclaim hard disk space.
 	},
 }
 
+func gcWithProgress(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+	api, err := cmdenv.GetApi(env)
+	if err != nil {
+		return err
+	}
+
+	events, err := api.Repo().Gc(req.Context)
+	if err != nil {
+		return err
+	}
+
+	errs := false
+	for ev := range events {
+		var res *GcResult
+		switch {
+		case ev.Err != nil:
+			errs = true
+			res = &GcResult{Error: ev.Err.Error()}
+		case ev.Progress != nil:
+			res = &GcResult{Progress: ev.Progress}
+		default:
+			continue
+		}
+		if err := re.Emit(res); err != nil {
+			return err
+		}
+	}
+	if errs {
+		return errors.New("encountered errors during gc run")
+	}
+	return req.Context.Err()
+}
+
+func printDryRunReport(w io.Writer, r *gc.DryRunReport, quiet bool) error {
+	removed := gc.BlockCount{
+		Blocks: r.Unreferenced.Blocks + r.Linked.Blocks,
+		Bytes:  r.Unreferenced.Bytes + r.Linked.Bytes,
+	}
+	if quiet {
+		_, err := fmt.Fprintf(w, "%d\t%d\n", removed.Blocks, removed.Bytes)
+		return err
+	}
+
+	kept := gc.BlockCount{
+		Blocks: r.MFS.Blocks + r.Recent.Blocks + r.Pinned.Blocks,
+		Bytes:  r.MFS.Bytes + r.Recent.Bytes + r.Pinned.Bytes,
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range []struct {
+		name  string
+		count gc.BlockCount
+	}{
+		{"would remove", removed},
+		{"  unreferenced", r.Unreferenced},
+		{"  linked from garbage", r.Linked},
+		{"would keep", kept},
+		{"  pinned", r.Pinned},
+		{"  in MFS only", r.MFS},
+		{"  written recently", r.Recent},
+	} {
+		fmt.Fprintf(tw, "%s\t%d blocks\t%s\n", row.name, row.count.Blocks, humanize.Bytes(row.count.Bytes))
+	}
+	return tw.Flush()
+}
+
 const (
 	repoSizeOnlyOptionName = "size-only"
 	repoHumanOptionName    = "human"
@@ -267,31 +392,29 @@ type VerifyProgress struct {
 	Progress int
 }
 
-func verifyWorkerRun(ctx context.Context, wg *sync.WaitGroup, keys <-chan cid.Cid, results chan<- string, bs bstore.Blockstore) {
+// verifyResult is the result of the verification of a block, err is nil if
+// the block is valid.
+type verifyResult struct {
+	cid cid.Cid
+	err error
+}
+
+func verifyWorkerRun(ctx context.Context, wg *sync.WaitGroup, keys <-chan cid.Cid, results chan<- verifyResult, bs bstore.Blockstore) {
 	defer wg.Done()
 
 	for k := range keys {
 		_, err := bs.Get(k)
-		if err != nil {
-			select {
-			case results <- fmt.Sprintf("block %s was corrupt (%s)", k, err):
-			case <-ctx.Done():
-				return
-			}
-
-			continue
-		}
 
 		select {
-		case results <- "":
+		case results <- verifyResult{cid: k, err: err}:
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func verifyResultChan(ctx context.Context, keys <-chan cid.Cid, bs bstore.Blockstore) <-chan string {
-	results := make(chan string)
+func verifyResultChan(ctx context.Context, keys <-chan cid.Cid, bs bstore.Blockstore) <-chan verifyResult {
+	results := make(chan verifyResult)
 
 	go func() {
 		defer close(results)
@@ -309,9 +432,101 @@ func verifyResultChan(ctx context.Context, keys <-chan cid.Cid, bs bstore.Blocks
 	return results
 }
 
+// repairBlock removes a corrupt block, and fetches it again if refetch is
+// true.
+func repairBlock(ctx context.Context, nd *core.IpfsNode, bs bstore.Blockstore, c cid.Cid, refetch bool) (string, error) {
+	if err := bs.DeleteBlock(c); err != nil {
+		return "", err
+	}
+	if !refetch {
+		return fmt.Sprintf("block %s was removed", c), nil
+	}
+
+	if _, err := nd.Blocks.GetBlock(ctx, c); err != nil {
+		return "", fmt.Errorf("block %s was removed but could not be fetched: %s", c, err)
+	}
+	return fmt.Sprintf("block %s was fetched again", c), nil
+}
+
+// verifyPins reports the pinned blocks that are missing from the repo, and
+// checks that the MFS root is stored. Blocks referenced by the MFS root don't
+// need to be stored.
+func verifyPins(ctx context.Context, nd *core.IpfsNode, emit func(string)) (int, error) {
+	var fails int
+
+	rootNd, err := nd.FilesRoot.GetDirectory().GetNode()
+	if err != nil {
+		return 0, err
+	}
+	has, err := nd.Blockstore.Has(rootNd.Cid())
+	if err != nil {
+		return 0, err
+	}
+	if !has {
+		emit(fmt.Sprintf("MFS root %s is missing", rootNd.Cid()))
+		fails++
+	}
+
+	defer nd.Blockstore.PinLock().Unlock()
+
+	for _, c := range nd.Pinning.DirectKeys() {
+		has, err := nd.Blockstore.Has(c)
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			emit(fmt.Sprintf("directly pinned block %s is missing", c))
+			fails++
+		}
+	}
+
+	ng := dag.NewDAGService(bserv.New(nd.Blockstore, offline.Exchange(nd.Blockstore)))
+	output := make(chan gc.Result, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for res := range output {
+			if res.Error == nil || res.Error == gc.ErrCannotFetchAllLinks {
+				continue
+			}
+			emit(fmt.Sprintf("pinned content is incomplete: %s", res.Error))
+			fails++
+		}
+	}()
+
+	_, err = gc.ColoredSet(ctx, nd.Pinning, ng, []cid.Cid{rootNd.Cid()}, output)
+	close(output)
+	<-done
+	if err == gc.ErrCannotFetchAllLinks {
+		err = nil
+	}
+	return fails, err
+}
+
+const (
+	repoVerifyDeleteOptionName  = "delete-corrupt"
+	repoVerifyRefetchOptionName = "refetch"
+	repoVerifyPinsOptionName    = "check-pins"
+)
+
 var repoVerifyCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Verify all blocks in repo are not corrupted.",
+		ShortDescription: `
+'ipfs repo verify' hashes every block of the repo and reports the blocks whose
+content doesn't match their hash.
+
+Corrupt blocks are removed with --delete-corrupt. With --refetch, they are
+removed and fetched again from the network, which requires a running daemon.
+
+With --check-pins, the pinned blocks missing from the repo are reported too,
+as well as a missing MFS root.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(repoVerifyDeleteOptionName, "Remove corrupt blocks."),
+		cmdkit.BoolOption(repoVerifyRefetchOptionName, "Remove corrupt blocks and fetch them again."),
+		cmdkit.BoolOption(repoVerifyPinsOptionName, "Check that pinned content and the MFS root are stored."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
@@ -319,6 +534,13 @@ var repoVerifyCmd = &cmds.Command{
 			return err
 		}
 
+		deleteCorrupt, _ := req.Options[repoVerifyDeleteOptionName].(bool)
+		refetch, _ := req.Options[repoVerifyRefetchOptionName].(bool)
+		checkPins, _ := req.Options[repoVerifyPinsOptionName].(bool)
+		if refetch && !nd.OnlineMode() {
+			return cmdkit.Errorf(cmdkit.ErrClient, "--%s requires a running daemon", repoVerifyRefetchOptionName)
+		}
+
 		bs := bstore.NewBlockstore(nd.Repo.Datastore())
 		bs.HashOnRead(true)
 
@@ -330,23 +552,52 @@ var repoVerifyCmd = &cmds.Command{
 
 		results := verifyResultChan(req.Context, keys, bs)
 
-		var fails int
+		var corrupt []cid.Cid
 		var i int
-		for msg := range results {
-			if msg != "" {
+		for r := range results {
+			if r.err != nil {
+				msg := fmt.Sprintf("block %s was corrupt (%s)", r.cid, r.err)
 				if err := res.Emit(&VerifyProgress{Msg: msg}); err != nil {
 					return err
 				}
-				fails++
+				corrupt = append(corrupt, r.cid)
 			}
 			i++
 			if err := res.Emit(&VerifyProgress{Progress: i}); err != nil {
 				return err
 			}
 		}
+		if err := req.Context.Err(); err != nil {
+			return err
+		}
+
+		fails := len(corrupt)
+		if deleteCorrupt || refetch {
+			for _, c := range corrupt {
+				msg, err := repairBlock(req.Context, nd, bs, c, refetch)
+				if err != nil {
+					msg = err.Error()
+				} else {
+					fails--
+				}
+				if err := res.Emit(&VerifyProgress{Msg: msg}); err != nil {
+					return err
+				}
+			}
+		}
+
+		if checkPins {
+			pinFails, err := verifyPins(req.Context, nd, func(msg string) {
+				res.Emit(&VerifyProgress{Msg: msg})
+			})
+			if err != nil {
+				return err
+			}
+			fails += pinFails
+		}
 
 		if fails != 0 {
-			return errors.New("verify complete, some blocks were corrupt")
+			return errors.New("verify complete, some blocks were corrupt or missing")
 		}
 
 		return res.Emit(&VerifyProgress{Msg: "verify complete, all blocks validated."})
@@ -403,3 +654,498 @@ var repoVersionCmd = &cmds.Command{
 		}),
 	},
 }
+
+// RepoConvertOutput reports the progress of a datastore conversion.
+type RepoConvertOutput struct {
+	Copied int
+	Done   bool `json:",omitempty"`
+}
+
+const repoConvertProfileOptionName = "profile"
+
+var repoConvertCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Convert the repo to another datastore.",
+		ShortDescription: `
+'ipfs repo convert' copies the content of the datastore of the repo to a new
+datastore and makes the repo use it. The new datastore is given either as a
+Datastore.Spec JSON document (see docs/datastores.md), or with the --profile
+option as the datastore of a config profile, e.g.:
+
+  ipfs repo convert --profile=badgerds
+
+The current datastore is left untouched until all of its content was copied,
+so an interrupted conversion leaves the repo as it was. Files of the old
+datastore that would be replaced are moved to the datastore-convert-old
+directory of the repo; the other ones are left in place. Remove them once the
+node works with the new datastore.
+
+This command can only run when no ipfs daemon is running.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("spec", false, false, "The Datastore.Spec of the new datastore, as JSON."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(repoConvertProfileOptionName, "Use the datastore of the given config profile."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		profileName, _ := req.Options[repoConvertProfileOptionName].(string)
+		var spec map[string]interface{}
+		switch {
+		case len(req.Arguments) > 0 && profileName != "":
+			return cmdkit.Errorf(cmdkit.ErrClient, "specify either a spec or a profile, not both")
+		case len(req.Arguments) > 0:
+			if err := json.Unmarshal([]byte(req.Arguments[0]), &spec); err != nil {
+				return cmdkit.Errorf(cmdkit.ErrClient, "invalid datastore spec: %s", err)
+			}
+		case profileName != "":
+			profile, ok := config.Profiles[profileName]
+			if !ok {
+				return fmt.Errorf("%s is not a profile", profileName)
+			}
+			cfg, err := fsrepo.ConfigAt(cfgRoot)
+			if err != nil {
+				return err
+			}
+			if err := profile.Transform(cfg); err != nil {
+				return err
+			}
+			spec = cfg.Datastore.Spec
+		default:
+			return cmdkit.Errorf(cmdkit.ErrClient, "a datastore spec or a profile is required")
+		}
+
+		var copied int
+		err = fsrepo.ConvertDatastore(cfgRoot, spec, func(n int) {
+			copied = n
+			res.Emit(&RepoConvertOutput{Copied: n})
+		})
+		if err != nil {
+			return err
+		}
+		return res.Emit(&RepoConvertOutput{Copied: copied, Done: true})
+	},
+	Type: RepoConvertOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RepoConvertOutput) error {
+			if out.Done {
+				fmt.Fprintf(w, "converted datastore, %d entries copied\n", out.Copied)
+				return nil
+			}
+			fmt.Fprintf(w, "copied %d entries\n", out.Copied)
+			return nil
+		}),
+	},
+}
+
+// RepoCompactOutput reports the progress of a datastore compaction.
+type RepoCompactOutput struct {
+	Message string
+}
+
+var repoCompactCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Compact the datastore to reclaim disk space.",
+		ShortDescription: `
+'ipfs repo compact' runs the compaction of the datastores of the repo, which
+reclaims the space of deleted content, e.g. after a large garbage collection.
+What it does depends on the datastore:
+
+  badgerds  runs the garbage collection of the value log
+  levelds   compacts the whole database
+  flatfs    re-shards the blocks if the shardFunc of the datastore was
+            changed in Datastore.Spec
+
+This command can only run when no ipfs daemon is running.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		return fsrepo.CompactDatastore(cfgRoot, func(msg string) {
+			res.Emit(&RepoCompactOutput{Message: msg})
+		})
+	},
+	Type: RepoCompactOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RepoCompactOutput) error {
+			_, err := fmt.Fprintln(w, out.Message)
+			return err
+		}),
+	},
+}
+
+const (
+	repoBackupBlocksOptionName  = "blocks"
+	repoRestoreConfigOptionName = "config"
+)
+
+var repoBackupCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Write a backup of the node to stdout.",
+		ShortDescription: `
+'ipfs repo backup' writes a tar archive holding the config, the keys of the
+keystore, the pins and the MFS root of the node. With --blocks, the archive
+also holds all the blocks that are pinned or referenced by the MFS root.
+
+  ipfs repo backup --blocks > backup.tar
+
+The backup is a consistent snapshot, even when the daemon is running: the pins
+and the MFS root are read at once, then adding and pinning proceed while the
+archive is written. The garbage collection waits for it to complete.
+
+The archive holds the private keys of the node: store it safely.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(repoBackupBlocksOptionName, "b", "Include the pinned blocks and the blocks of the MFS root."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		withBlocks, _ := req.Options[repoBackupBlocksOptionName].(bool)
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(corerepo.Backup(req.Context, n, pw, withBlocks))
+		}()
+		return res.Emit(pr)
+	},
+}
+
+var repoRestoreCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Restore a backup of the node.",
+		ShortDescription: `
+'ipfs repo restore' restores an archive written by 'ipfs repo backup'.
+
+The blocks and keys of the backup are added to the repo, and so are its pins.
+The entries of the MFS root of the backup are added to the MFS root of the
+node. Keys and MFS entries that already exist are left untouched. With
+--config, the config of the backup replaces the current config, including the
+identity of the node; restart the daemon to apply it.
+
+  ipfs repo restore backup.tar
+
+Pinned blocks missing from the backup are fetched from the network when the
+daemon is running.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("backup", true, false, "The backup archive to restore.").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(repoRestoreConfigOptionName, "Replace the config with the config of the backup."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		file, err := req.Files.NextFile()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		restoreConfig, _ := req.Options[repoRestoreConfigOptionName].(bool)
+		out, err := corerepo.Restore(req.Context, n, file, restoreConfig)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Type: corerepo.RestoreResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *corerepo.RestoreResult) error {
+			fmt.Fprintf(w, "restored backup of %s from %s\n", out.Manifest.PeerID, out.Manifest.Created.Format(time.RFC3339))
+			fmt.Fprintf(w, "blocks: %d\n", out.Blocks)
+			fmt.Fprintf(w, "pins: %d\n", len(out.Manifest.Recursive)+len(out.Manifest.Direct))
+			for _, k := range out.Keys {
+				fmt.Fprintf(w, "restored key %s\n", k)
+			}
+			for _, k := range out.SkippedKeys {
+				fmt.Fprintf(w, "skipped existing key %s\n", k)
+			}
+			for _, f := range out.Files {
+				fmt.Fprintf(w, "restored file %s\n", f)
+			}
+			for _, f := range out.SkippedFiles {
+				fmt.Fprintf(w, "skipped existing file %s\n", f)
+			}
+			if out.Config {
+				fmt.Fprintln(w, "restored config, restart the daemon to apply it")
+			}
+			return nil
+		}),
+	},
+}
+
+const (
+	repoCacheBloomSizeOptionName   = "bloom-size"
+	repoCacheBloomHashesOptionName = "bloom-hashes"
+	repoCacheARCSizeOptionName     = "arc-size"
+)
+
+var repoCacheCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show or resize the blockstore caches.",
+		ShortDescription: `
+'ipfs repo cache' shows the sizes of the blockstore caches, and how many of
+the requests to the blockstore they answered.
+
+The caches are resized with the options below, 0 disabling a cache. Resizing
+empties the caches, and the bloom filter is rebuilt in the background. The
+new sizes only last until the daemon is restarted, set them in the config to
+keep them:
+
+  Datastore.BloomFilterSize    size of the bloom filter, in bytes
+  Datastore.BloomFilterHashes  number of hashes of the bloom filter
+  Datastore.ARCCacheSize       number of entries of the ARC cache
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption(repoCacheBloomSizeOptionName, "Set the size of the bloom filter, in bytes."),
+		cmdkit.IntOption(repoCacheBloomHashesOptionName, "Set the number of hashes of the bloom filter."),
+		cmdkit.IntOption(repoCacheARCSizeOptionName, "Set the number of entries of the ARC cache."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		c := n.BlockCache
+		if c == nil {
+			return errors.New("the node has no blockstore caches")
+		}
+
+		opts := c.Options()
+		bloomSize, bloomSet := req.Options[repoCacheBloomSizeOptionName].(int)
+		bloomHashes, hashesSet := req.Options[repoCacheBloomHashesOptionName].(int)
+		arcSize, arcSet := req.Options[repoCacheARCSizeOptionName].(int)
+		if bloomSet || hashesSet || arcSet {
+			if bloomSet {
+				opts.HasBloomFilterSize = bloomSize
+				if opts.HasBloomFilterHashes == 0 {
+					opts.HasBloomFilterHashes = bstore.DefaultCacheOpts().HasBloomFilterHashes
+				}
+			}
+			if hashesSet {
+				opts.HasBloomFilterHashes = bloomHashes
+			}
+			if arcSet {
+				opts.HasARCCacheSize = arcSize
+			}
+			if err := c.Resize(opts); err != nil {
+				return err
+			}
+		}
+
+		st := c.Stats()
+		return cmds.EmitOnce(res, &coreiface.BlockCacheStats{
+			BloomFilterSize:   opts.HasBloomFilterSize,
+			BloomFilterHashes: opts.HasBloomFilterHashes,
+			ARCCacheSize:      opts.HasARCCacheSize,
+			Requests:          st.Requests,
+			Misses:            st.Misses,
+			HitRate:           st.HitRate(),
+		})
+	},
+	Type: coreiface.BlockCacheStats{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, st *coreiface.BlockCacheStats) error {
+			wtr := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+			defer wtr.Flush()
+
+			fmt.Fprintf(wtr, "BloomFilterSize:\t%d\n", st.BloomFilterSize)
+			fmt.Fprintf(wtr, "BloomFilterHashes:\t%d\n", st.BloomFilterHashes)
+			fmt.Fprintf(wtr, "ARCCacheSize:\t%d\n", st.ARCCacheSize)
+			fmt.Fprintf(wtr, "Requests:\t%d\n", st.Requests)
+			fmt.Fprintf(wtr, "Misses:\t%d\n", st.Misses)
+			fmt.Fprintf(wtr, "HitRate:\t%.2f%%\n", st.HitRate*100)
+			return nil
+		}),
+	},
+}
+
+// NamedRepo is a repo served by the daemon in addition to its main repo.
+type NamedRepo struct {
+	Name string
+	ID   string `json:",omitempty"`
+}
+
+// NamedRepoList is the result of 'ipfs repo named ls'.
+type NamedRepoList struct {
+	Repos []NamedRepo
+}
+
+var repoNamedCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the named repos served by the daemon.",
+		ShortDescription: `
+The daemon can serve named repos in addition to its main repo, e.g. one per
+tenant of a shared daemon. Each named repo has its own blocks, pins, MFS root,
+keys and IPNS records, and its own identity used as its 'self' key, but they
+all use the network connections of the daemon.
+
+Commands run on a named repo with the --repo-name option:
+
+  ipfs repo named create alice
+  ipfs --repo-name=alice add file
+  ipfs --repo-name=alice pin ls
+
+Named repos are stored in the 'repos' directory of the main repo, and are
+opened when the daemon starts.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"create": repoNamedCreateCmd,
+		"ls":     repoNamedLsCmd,
+	},
+}
+
+const repoNamedBitsOptionName = "bits"
+
+var repoNamedCreateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Create a named repo.",
+		ShortDescription: `
+'ipfs repo named create' creates a repo with a new identity and the datastore
+configuration of the main repo, and serves it if the daemon is running.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("name", true, false, "Name of the repo."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption(repoNamedBitsOptionName, "b", "Number of bits to use in the generated RSA private key.").WithDefault(2048),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		name := req.Arguments[0]
+		bits, _ := req.Options[repoNamedBitsOptionName].(int)
+
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if n.Repos == nil {
+			return errors.New("named repos can only be created from the main repo")
+		}
+
+		root, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+		path, err := fsrepo.NamedRepoPath(root, name)
+		if err != nil {
+			return err
+		}
+		if fsrepo.IsInitialized(path) {
+			return fmt.Errorf("repo %q already exists", name)
+		}
+
+		mainConf, err := n.Repo.Config()
+		if err != nil {
+			return err
+		}
+		conf, err := config.Init(ioutil.Discard, bits)
+		if err != nil {
+			return err
+		}
+		conf.Datastore = mainConf.Datastore
+
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return err
+		}
+		if err := fsrepo.Init(path, conf); err != nil {
+			return err
+		}
+
+		r, err := fsrepo.Open(path)
+		if err != nil {
+			return err
+		}
+		if _, err := n.Repos.Add(n.Context(), name, r); err != nil {
+			r.Close()
+			return err
+		}
+
+		return cmds.EmitOnce(res, &NamedRepo{
+			Name: name,
+			ID:   conf.Identity.PeerID,
+		})
+	},
+	Type: NamedRepo{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, r *NamedRepo) error {
+			_, err := fmt.Fprintf(w, "created repo %s with identity %s\n", r.Name, r.ID)
+			return err
+		}),
+	},
+}
+
+var repoNamedLsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the named repos.",
+		ShortDescription: `
+'ipfs repo named ls' lists the named repos, with the identity of the ones
+served by the daemon.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		root, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+
+		names, err := fsrepo.NamedRepos(root)
+		if err != nil {
+			return err
+		}
+
+		list := &NamedRepoList{Repos: make([]NamedRepo, len(names))}
+		for i, name := range names {
+			list.Repos[i].Name = name
+			if n.Repos == nil {
+				continue
+			}
+			if rn, err := n.Repos.Get(name); err == nil {
+				list.Repos[i].ID = rn.Identity.Pretty()
+			}
+		}
+		return cmds.EmitOnce(res, list)
+	},
+	Type: NamedRepoList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, list *NamedRepoList) error {
+			wtr := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+			defer wtr.Flush()
+
+			for _, r := range list.Repos {
+				id := r.ID
+				if id == "" {
+					id = "(not open)"
+				}
+				fmt.Fprintf(wtr, "%s\t%s\n", r.Name, id)
+			}
+			return nil
+		}),
+	},
+}
@@ -22,12 +22,16 @@ const (
 	DebugOption  = "debug"
 	LocalOption  = "local"
 	ApiOption    = "api"
+
+	// RepoNameOption selects the named repo a command runs on, see 'ipfs
+	// repo named'.
+	RepoNameOption = "repo-name"
 )
 
 var Root = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline:  "Global p2p merkle-dag filesystem.",
-		Synopsis: "ipfs [--config=<config> | -c] [--debug=<debug> | -D] [--help=<help>] [-h=<h>] [--local=<local> | -L] [--api=<api>] <command> ...",
+		Synopsis: "ipfs [--config=<config> | -c] [--debug=<debug> | -D] [--help=<help>] [-h=<h>] [--local=<local> | -L] [--api=<api>] [--repo-name=<repo-name>] <command> ...",
 		Subcommands: `
 BASIC COMMANDS
   init          Initialize ipfs local configuration
@@ -79,6 +83,18 @@ environment variable:
 
   export IPFS_PATH=/path/to/ipfsrepo
 
+The daemon can also serve named repos, each with its own blocks, pins, files
+and keys, over the same network connections, e.g. one per tenant of a shared
+daemon. Commands run on a named repo with --repo-name, see 'ipfs repo named'.
+
+OUTPUT ENCODINGS
+
+Every command can format its output as json, ndjson (one JSON value per
+line), cbor or xml using --enc=<encoding>, in addition to its default text
+output. Over HTTP, json, ndjson and cbor can also be selected with the Accept
+header, when it prefers application/json, application/x-ndjson or
+application/cbor.
+
 EXIT STATUS
 
 The CLI will exit with one of the following values:
@@ -94,6 +110,7 @@ The CLI will exit with one of the following values:
 		cmdkit.BoolOption(cmds.OptShortHelp, "Show a short version of the command help text."),
 		cmdkit.BoolOption(LocalOption, "L", "Run the command locally, instead of using the daemon."),
 		cmdkit.StringOption(ApiOption, "Use a specific API instance (defaults to /ip4/127.0.0.1/tcp/5001)"),
+		cmdkit.StringOption(RepoNameOption, "Run the command on a named repo of the daemon instead of its main repo."),
 
 		// global options, added to every command
 		cmds.OptionEncodingType,
@@ -119,6 +136,7 @@ var rootSubcommands = map[string]*cmds.Command{
 	"stats":     StatsCmd,
 	"bootstrap": BootstrapCmd,
 	"config":    ConfigCmd,
+	"daemon":    DaemonCmd,
 	"dag":       dag.DagCmd,
 	"dht":       DhtCmd,
 	"diag":      DiagCmd,
@@ -204,6 +222,9 @@ func init() {
 	Root.Subcommands = rootSubcommands
 
 	RootRO.Subcommands = rootROSubcommands
+
+	prioritizeCommands(Root)
+	auditCommands(Root)
 }
 
 type MessageOutput struct {
@@ -1,15 +1,42 @@
 package commands
 
 import (
+	"errors"
+	"time"
+
+	oldcmds "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
 	cmds "gx/ipfs/Qma6uuSyjkecGhMFFLfzyJDPyoDtNJSHJNweDccZhaWkgU/go-ipfs-cmds"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 )
 
+const (
+	shutdownWaitOptionName        = "wait"
+	shutdownWaitTimeoutOptionName = "wait-timeout"
+)
+
+// drainPollInterval is how often we check for in-flight requests while
+// waiting for them to finish.
+const drainPollInterval = 100 * time.Millisecond
+
 var daemonShutdownCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Shut down the ipfs daemon",
+		ShortDescription: `
+Shuts down the running ipfs daemon.
+
+With --wait, the daemon first waits for all other in-flight commands to
+finish, for up to --wait-timeout, and flushes the MFS root and the pin set to
+disk. The commands still running after --wait-timeout are cancelled by the
+shutdown. The command returns once this is done and the daemon is exiting.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(shutdownWaitOptionName, "Wait for in-flight commands to finish and flush state before shutting down."),
+		cmdkit.StringOption(shutdownWaitTimeoutOptionName, "The maximum time to wait for in-flight commands with --wait.").WithDefault("5m"),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
@@ -21,10 +48,87 @@ var daemonShutdownCmd = &cmds.Command{
 			return cmdkit.Errorf(cmdkit.ErrClient, "daemon not running")
 		}
 
-		if err := nd.Process().Close(); err != nil {
-			log.Error("error while shutting down ipfs daemon:", err)
+		wait, _ := req.Options[shutdownWaitOptionName].(bool)
+		timeoutStr, _ := req.Options[shutdownWaitTimeoutOptionName].(string)
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return cmdkit.Errorf(cmdkit.ErrClient, "invalid --%s: %s", shutdownWaitTimeoutOptionName, err)
+		}
+		if !wait {
+			if err := nd.Process().Close(); err != nil {
+				log.Error("error while shutting down ipfs daemon:", err)
+			}
+			return nil
+		}
+
+		if ctx, ok := env.(*oldcmds.Context); ok {
+			err := drainRequests(req, ctx.ReqLog, timeout)
+			if err == errDrainTimeout {
+				log.Warningf("shutting down with commands still running after %s", timeout)
+			} else if err != nil {
+				return err
+			}
 		}
 
+		if err := flushNode(nd); err != nil {
+			return err
+		}
+
+		// Closing the node waits for the HTTP servers to finish serving
+		// requests, including this one, so it must not block the response.
+		go func() {
+			if err := nd.Process().Close(); err != nil {
+				log.Error("error while shutting down ipfs daemon:", err)
+			}
+		}()
 		return nil
 	},
 }
+
+// errDrainTimeout is returned by drainRequests when requests are still
+// running after its timeout.
+var errDrainTimeout = errors.New("in-flight commands still running")
+
+// drainRequests waits until the only active request in the log is req
+// itself, for up to timeout.
+func drainRequests(req *cmds.Request, reqLog *oldcmds.ReqLog, timeout time.Duration) error {
+	t := time.NewTicker(drainPollInterval)
+	defer t.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		active := 0
+		for _, e := range reqLog.Report() {
+			if e.Active {
+				active++
+			}
+		}
+		if active <= 1 {
+			return nil
+		}
+
+		select {
+		case <-t.C:
+		case <-deadline.C:
+			return errDrainTimeout
+		case <-req.Context.Done():
+			return req.Context.Err()
+		}
+	}
+}
+
+// flushNode writes the state kept in memory by the node to the repo.
+func flushNode(nd *core.IpfsNode) error {
+	if nd.FilesRoot != nil {
+		if err := mfs.FlushPath(nd.FilesRoot, "/"); err != nil {
+			return err
+		}
+	}
+	if nd.Pinning != nil {
+		if err := nd.Pinning.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -7,6 +7,9 @@ import (
 	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
@@ -30,6 +33,7 @@ for your IPFS node.`,
 		"bw":      statBwCmd,
 		"repo":    repoStatCmd,
 		"bitswap": bitswapStatCmd,
+		"all":     statAllCmd,
 	},
 }
 
@@ -38,6 +42,7 @@ const (
 	statProtoOptionName    = "proto"
 	statPollOptionName     = "poll"
 	statIntervalOptionName = "interval"
+	statSizeOnlyOptionName = "size-only"
 )
 
 var statBwCmd = &cmds.Command{
@@ -192,3 +197,95 @@ func printStats(out io.Writer, bs *metrics.Stats) {
 	fmt.Fprintf(out, "RateIn: %s/s\n", humanize.Bytes(uint64(bs.RateIn)))
 	fmt.Fprintf(out, "RateOut: %s/s\n", humanize.Bytes(uint64(bs.RateOut)))
 }
+
+var statAllCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Print all ipfs statistics.",
+		ShortDescription: `
+'ipfs stats all' prints the statistics of the node in a single document:
+bandwidth, bitswap, repo, DHT and connection manager statistics. Use
+'--enc=json' to get them in a format suitable for monitoring agents.
+
+The network related sections are only included when the daemon is running.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(statSizeOnlyOptionName, "Don't count the objects in the repo, only report its size."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		sizeOnly, _ := req.Options[statSizeOnlyOptionName].(bool)
+		stats, err := api.Stats().All(req.Context, options.Stats.SizeOnly(sizeOnly))
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, stats)
+	},
+	Type: coreiface.Stats{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s *coreiface.Stats) error {
+			if bw := s.Bandwidth; bw != nil {
+				printStats(w, &metrics.Stats{
+					TotalIn:  bw.TotalIn,
+					TotalOut: bw.TotalOut,
+					RateIn:   bw.RateIn,
+					RateOut:  bw.RateOut,
+				})
+			}
+			if bs := s.Bitswap; bs != nil {
+				fmt.Fprintln(w, "Bitswap")
+				fmt.Fprintf(w, "BlocksReceived: %d\n", bs.BlocksReceived)
+				fmt.Fprintf(w, "BlocksSent: %d\n", bs.BlocksSent)
+				fmt.Fprintf(w, "DataReceived: %s\n", humanize.Bytes(bs.DataReceived))
+				fmt.Fprintf(w, "DataSent: %s\n", humanize.Bytes(bs.DataSent))
+				fmt.Fprintf(w, "DupBlksReceived: %d\n", bs.DupBlksReceived)
+				fmt.Fprintf(w, "DupDataReceived: %s\n", humanize.Bytes(bs.DupDataReceived))
+				fmt.Fprintf(w, "Wantlist: %d\n", bs.WantlistLen)
+				fmt.Fprintf(w, "Partners: %d\n", bs.Peers)
+			}
+			if r := s.Repo; r != nil {
+				fmt.Fprintln(w, "Repo")
+				fmt.Fprintf(w, "RepoSize: %s\n", humanize.Bytes(r.RepoSize))
+				if r.StorageMax != corerepo.NoLimit {
+					fmt.Fprintf(w, "StorageMax: %s\n", humanize.Bytes(r.StorageMax))
+				}
+				if r.Version != "" {
+					fmt.Fprintf(w, "NumObjects: %d\n", r.NumObjects)
+					fmt.Fprintf(w, "RepoPath: %s\n", r.RepoPath)
+					fmt.Fprintf(w, "Version: %s\n", r.Version)
+				}
+				if q := r.Quota; q != nil {
+					fmt.Fprintf(w, "StorageUsage: %s\n", humanize.Bytes(q.Usage))
+					fmt.Fprintf(w, "StorageGCWatermark: %s\n", humanize.Bytes(q.HighWater))
+					fmt.Fprintf(w, "StorageMaxEnforced: %t\n", q.Enforced)
+				}
+				if c := r.Cache; c != nil {
+					fmt.Fprintf(w, "BloomFilterSize: %s\n", humanize.Bytes(uint64(c.BloomFilterSize)))
+					fmt.Fprintf(w, "ARCCacheSize: %d\n", c.ARCCacheSize)
+					fmt.Fprintf(w, "CacheHitRate: %.2f%%\n", c.HitRate*100)
+				}
+			}
+			if d := s.Dht; d != nil {
+				fmt.Fprintln(w, "DHT")
+				fmt.Fprintf(w, "Peers: %d\n", d.Peers)
+				if d.Bandwidth != nil {
+					fmt.Fprintf(w, "TotalIn: %s\n", humanize.Bytes(uint64(d.Bandwidth.TotalIn)))
+					fmt.Fprintf(w, "TotalOut: %s\n", humanize.Bytes(uint64(d.Bandwidth.TotalOut)))
+				}
+			}
+			if cm := s.ConnMgr; cm != nil {
+				fmt.Fprintln(w, "ConnMgr")
+				fmt.Fprintf(w, "Type: %s\n", cm.Type)
+				fmt.Fprintf(w, "LowWater: %d\n", cm.LowWater)
+				fmt.Fprintf(w, "HighWater: %d\n", cm.HighWater)
+				fmt.Fprintf(w, "Conns: %d\n", cm.Conns)
+				fmt.Fprintf(w, "Peers: %d\n", cm.Peers)
+			}
+			return nil
+		}),
+	},
+}
@@ -1,14 +1,21 @@
 package commands
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"path"
 	"sort"
+	"strings"
+	"time"
 
 	commands "github.com/ipfs/go-ipfs/commands"
+	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	rendezvous "github.com/ipfs/go-ipfs/rendezvous"
 	repo "github.com/ipfs/go-ipfs/repo"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
@@ -45,8 +52,12 @@ ipfs peers in the internet.
 		"addrs":      swarmAddrsCmd,
 		"connect":    swarmConnectCmd,
 		"disconnect": swarmDisconnectCmd,
+		"events":     swarmEventsCmd,
 		"filters":    swarmFiltersCmd,
+		"mdns":       swarmMdnsCmd,
 		"peers":      swarmPeersCmd,
+		"pnet":       swarmPnetCmd,
+		"rendezvous": swarmRendezvousCmd,
 	},
 }
 
@@ -315,6 +326,10 @@ var swarmAddrsListenCmd = &cmds.Command{
 'ipfs swarm addrs listen' lists all interface addresses the node is listening on.
 `,
 	},
+	Subcommands: map[string]*cmds.Command{
+		"add": swarmAddrsListenAddCmd,
+		"rm":  swarmAddrsListenRmCmd,
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env)
 		if err != nil {
@@ -340,6 +355,111 @@ var swarmAddrsListenCmd = &cmds.Command{
 	},
 }
 
+var swarmAddrsListenAddCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Listen on new addresses.",
+		ShortDescription: `
+'ipfs swarm addrs listen add' adds addresses to Addresses.Swarm, and makes the
+node listen on them without restarting. It lists the addresses of
+Addresses.Swarm the node listens on.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, true, "Address to listen on.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return updateListenAddrs(req, res, env, func(addrs []string, arg string) []string {
+			for _, a := range addrs {
+				if a == arg {
+					return addrs
+				}
+			}
+			return append(addrs, arg)
+		})
+	},
+	Type: stringList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+}
+
+var swarmAddrsListenRmCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Stop listening on addresses.",
+		ShortDescription: `
+'ipfs swarm addrs listen rm' removes addresses from Addresses.Swarm. The node
+stops announcing them and closes the connections accepted on them, but keeps
+those established. It lists the addresses of Addresses.Swarm the node listens
+on.
+
+The ports of the addresses removed are only released when the node restarts.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, true, "Address to stop listening on.").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		return updateListenAddrs(req, res, env, func(addrs []string, arg string) []string {
+			out := addrs[:0]
+			for _, a := range addrs {
+				if a != arg {
+					out = append(out, a)
+				}
+			}
+			return out
+		})
+	},
+	Type: stringList{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(stringListEncoder),
+	},
+}
+
+// updateListenAddrs applies update to Addresses.Swarm for each argument, and
+// the result to the running node.
+func updateListenAddrs(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, update func(addrs []string, arg string) []string) error {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	if !n.OnlineMode() {
+		return ErrNotOnline
+	}
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+	addrs := append([]string(nil), cfg.Addresses.Swarm...)
+	for _, arg := range req.Arguments {
+		a, err := ma.NewMultiaddr(arg)
+		if err != nil {
+			return err
+		}
+		addrs = update(addrs, a.String())
+	}
+
+	maddrs := make([]ma.Multiaddr, len(addrs))
+	for i, a := range addrs {
+		maddrs[i], err = ma.NewMultiaddr(a)
+		if err != nil {
+			return fmt.Errorf("invalid address in Addresses.Swarm: %s", err)
+		}
+	}
+	if err := n.SetListenAddrs(maddrs); err != nil {
+		return err
+	}
+	if err := n.Repo.SetConfigKey("Addresses.Swarm", addrs); err != nil {
+		return err
+	}
+
+	var out []string
+	for _, a := range n.ListenAddrs() {
+		out = append(out, a.String())
+	}
+	return cmds.EmitOnce(res, &stringList{out})
+}
+
 var swarmConnectCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Open connection to a given address.",
@@ -739,3 +859,444 @@ func filtersRemove(r repo.Repo, cfg *config.Config, toRemoveFilters []string) ([
 
 	return removed, nil
 }
+
+// SwarmEvent is an event of 'ipfs swarm events'.
+type SwarmEvent struct {
+	Type   string
+	Peer   string
+	Addrs  []string `json:",omitempty"`
+	Source string   `json:",omitempty"`
+	Time   time.Time
+}
+
+var swarmEventsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Watch the peers connected, disconnected and discovered.",
+		ShortDescription: `
+'ipfs swarm events' prints the events of the swarm as they happen, until it
+is interrupted: the peers the node connects to and disconnects from, and the
+peers found on the local network by mDNS. The events are dropped while the
+output isn't read.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		events, err := api.Swarm().Events(req.Context)
+		if err != nil {
+			return err
+		}
+
+		if f, ok := res.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		for e := range events {
+			out := &SwarmEvent{
+				Type:   e.Type,
+				Peer:   e.Peer.Pretty(),
+				Source: e.Source,
+				Time:   e.Time,
+			}
+			for _, a := range e.Addrs {
+				out.Addrs = append(out.Addrs, a.String())
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, e *SwarmEvent) error {
+			line := fmt.Sprintf("%s %s %s", e.Time.Format(time.RFC3339), e.Type, e.Peer)
+			if e.Source != "" {
+				line += " (" + e.Source + ")"
+			}
+			if len(e.Addrs) > 0 {
+				line += " " + strings.Join(e.Addrs, " ")
+			}
+			_, err := fmt.Fprintln(w, line)
+			return err
+		}),
+	},
+	Type: SwarmEvent{},
+}
+
+// MdnsState is the output of 'ipfs swarm mdns'.
+type MdnsState struct {
+	Enabled bool
+}
+
+var swarmMdnsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show, start or stop the discovery of the peers of the local network.",
+		ShortDescription: `
+'ipfs swarm mdns' tells whether the node looks for the peers of the local
+network with mDNS. 'ipfs swarm mdns on' and 'ipfs swarm mdns off' start and
+stop the discovery until the daemon restarts or Discovery.MDNS changes in the
+config, which is left as is.
+
+The interval of the queries and the service tag announced are set by the
+Discovery.MDNS.Interval and Discovery.MDNS.ServiceTag config keys.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("state", false, false, "'on' to start the discovery, 'off' to stop it."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env)
+		if err != nil {
+			return err
+		}
+
+		if len(req.Arguments) > 0 {
+			var enabled bool
+			switch req.Arguments[0] {
+			case "on":
+				enabled = true
+			case "off":
+			default:
+				return fmt.Errorf("invalid state %q, expected 'on' or 'off'", req.Arguments[0])
+			}
+			if err := api.Swarm().SetMDNS(req.Context, enabled); err != nil {
+				return err
+			}
+		}
+
+		enabled, err := api.Swarm().MDNS(req.Context)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &MdnsState{Enabled: enabled})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, st *MdnsState) error {
+			if st.Enabled {
+				_, err := fmt.Fprintln(w, "on")
+				return err
+			}
+			_, err := fmt.Fprintln(w, "off")
+			return err
+		}),
+	},
+	Type: MdnsState{},
+}
+
+const (
+	rendezvousLimitOptionName = "limit"
+	rendezvousTTLOptionName   = "ttl"
+)
+
+var swarmRendezvousCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Register and discover peers at rendezvous points.",
+		ShortDescription: `
+'ipfs swarm rendezvous' registers the node under namespaces at the rendezvous
+points of the Rendezvous.Points config key, and discovers the peers registered
+under them. The peers of an application agree on a namespace to find each
+other where the DHT and mDNS don't reach.
+
+The node registers under the namespaces of Rendezvous.Namespaces and connects
+to their peers by itself, these commands are for the other namespaces.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"discover":   swarmRendezvousDiscoverCmd,
+		"register":   swarmRendezvousRegisterCmd,
+		"unregister": swarmRendezvousUnregisterCmd,
+	},
+}
+
+// rendezvousClient returns the rendezvous client of the node of env.
+func rendezvousClient(env cmds.Environment) (*rendezvous.Client, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.PeerHost == nil {
+		return nil, ErrNotOnline
+	}
+	if n.Rendezvous == nil {
+		return nil, errors.New("no rendezvous point, set Rendezvous.Points in the config")
+	}
+	return n.Rendezvous, nil
+}
+
+// RendezvousPeer is a peer found by 'ipfs swarm rendezvous discover'.
+type RendezvousPeer struct {
+	ID    string
+	Addrs []string
+}
+
+var swarmRendezvousDiscoverCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "List the peers registered under a namespace.",
+		ShortDescription: `
+'ipfs swarm rendezvous discover' lists the peers registered under the
+namespace at the rendezvous points, those of all the namespaces if none is
+given. The peers aren't connected to, see 'ipfs swarm connect'.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("namespace", false, false, "The namespace of the peers."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.IntOption(rendezvousLimitOptionName, "n", "The maximum number of peers listed, 0 for the most the points return.").WithDefault(0),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		client, err := rendezvousClient(env)
+		if err != nil {
+			return err
+		}
+
+		var ns string
+		if len(req.Arguments) > 0 {
+			ns = req.Arguments[0]
+		}
+		limit, _ := req.Options[rendezvousLimitOptionName].(int)
+		if limit < 0 {
+			return fmt.Errorf("invalid limit %d", limit)
+		}
+
+		peers, err := client.Discover(req.Context, ns, limit)
+		if err != nil {
+			return err
+		}
+		for _, pi := range peers {
+			out := &RendezvousPeer{ID: pi.ID.Pretty()}
+			for _, a := range pi.Addrs {
+				out.Addrs = append(out.Addrs, a.String())
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, p *RendezvousPeer) error {
+			_, err := fmt.Fprintln(w, strings.Join(append([]string{p.ID}, p.Addrs...), " "))
+			return err
+		}),
+	},
+	Type: RendezvousPeer{},
+}
+
+// RendezvousRegistration is the output of 'ipfs swarm rendezvous register'.
+type RendezvousRegistration struct {
+	Namespace string
+	TTL       string
+}
+
+var swarmRendezvousRegisterCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Register the node under a namespace.",
+		ShortDescription: `
+'ipfs swarm rendezvous register' registers the node under the namespace at
+the rendezvous points, for the time given by --ttl, or the default time of the
+points if it isn't. The registration isn't renewed, unlike those of the
+namespaces of Rendezvous.Namespaces.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("namespace", true, false, "The namespace to register under."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(rendezvousTTLOptionName, "The time the registration lasts, like \"2h\"."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		client, err := rendezvousClient(env)
+		if err != nil {
+			return err
+		}
+
+		var ttl time.Duration
+		if s, ok := req.Options[rendezvousTTLOptionName].(string); ok {
+			ttl, err = time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("invalid ttl: %s", err)
+			}
+		}
+
+		granted, err := client.Register(req.Context, req.Arguments[0], ttl)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &RendezvousRegistration{
+			Namespace: req.Arguments[0],
+			TTL:       granted.String(),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, r *RendezvousRegistration) error {
+			_, err := fmt.Fprintf(w, "registered under %s for %s\n", r.Namespace, r.TTL)
+			return err
+		}),
+	},
+	Type: RendezvousRegistration{},
+}
+
+var swarmRendezvousUnregisterCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Remove the registration of the node under a namespace.",
+		ShortDescription: `
+'ipfs swarm rendezvous unregister' removes the registration of the node under
+the namespace from the rendezvous points.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("namespace", true, false, "The namespace to unregister from."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		client, err := rendezvousClient(env)
+		if err != nil {
+			return err
+		}
+		return client.Unregister(req.Context, req.Arguments[0])
+	},
+}
+
+// PnetState is the output of 'ipfs swarm pnet'.
+type PnetState struct {
+	Enabled         bool
+	Fingerprint     string `json:",omitempty"`
+	NextFingerprint string `json:",omitempty"`
+	Cutover         string `json:",omitempty"`
+}
+
+func pnetState(n *core.IpfsNode) *PnetState {
+	st := n.PNet()
+	out := &PnetState{Enabled: st.Enabled}
+	if st.Enabled {
+		out.Fingerprint = hex.EncodeToString(st.Fingerprint)
+	}
+	if st.NextFingerprint != nil {
+		out.NextFingerprint = hex.EncodeToString(st.NextFingerprint)
+		out.Cutover = st.Cutover.Format(time.RFC3339)
+	}
+	return out
+}
+
+var pnetStateEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, st *PnetState) error {
+		if !st.Enabled {
+			_, err := fmt.Fprintln(w, "not part of a private network")
+			return err
+		}
+		fmt.Fprintf(w, "swarm key fingerprint: %s\n", st.Fingerprint)
+		if st.NextFingerprint != "" {
+			fmt.Fprintf(w, "next swarm key fingerprint: %s, from %s\n", st.NextFingerprint, st.Cutover)
+		}
+		return nil
+	}),
+}
+
+var swarmPnetCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show and rotate the key of the private network.",
+		ShortDescription: `
+'ipfs swarm pnet' tells whether the node is part of a private network, the
+fingerprint of its swarm key, and the rotation of the key pending if there is
+one.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"cancel": swarmPnetCancelCmd,
+		"rotate": swarmPnetRotateCmd,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.OnlineMode() {
+			return ErrNotOnline
+		}
+		return cmds.EmitOnce(res, pnetState(n))
+	},
+	Encoders: pnetStateEncoders,
+	Type:     PnetState{},
+}
+
+const pnetAtOptionName = "at"
+
+var swarmPnetRotateCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Switch the private network to a new swarm key.",
+		ShortDescription: `
+'ipfs swarm pnet rotate' switches the private network of the node to the swarm
+key given, in the format of the swarm.key file, at the time given by --at, or
+right away. The connections established until then keep the current key.
+
+All the nodes of the network must switch at the same time, or those which
+didn't yet can't connect to those which did: give the key and the same time
+to all of them ahead of time. The rotation survives restarts, and the new key
+replaces the swarm.key file of the repo when the node switches to it.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.FileArg("key", true, false, "The new swarm key.").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption(pnetAtOptionName, "The time of the switch, in RFC 3339 format (e.g. \"2019-01-02T15:00:00Z\")."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.OnlineMode() {
+			return ErrNotOnline
+		}
+
+		cutover := time.Now()
+		if at, ok := req.Options[pnetAtOptionName].(string); ok {
+			cutover, err = time.Parse(time.RFC3339, at)
+			if err != nil {
+				return fmt.Errorf("invalid time: %s", err)
+			}
+		}
+
+		file, err := req.Files.NextFile()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		key, err := ioutil.ReadAll(io.LimitReader(file, 1024))
+		if err != nil {
+			return err
+		}
+
+		if err := n.RotateSwarmKey(key, cutover); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, pnetState(n))
+	},
+	Encoders: pnetStateEncoders,
+	Type:     PnetState{},
+}
+
+var swarmPnetCancelCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Cancel the pending rotation of the swarm key.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.OnlineMode() {
+			return ErrNotOnline
+		}
+		if err := n.CancelSwarmKeyRotation(); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, pnetState(n))
+	},
+	Encoders: pnetStateEncoders,
+	Type:     PnetState{},
+}
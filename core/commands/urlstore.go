@@ -20,7 +20,8 @@ import (
 
 var urlStoreCmd = &cmds.Command{
 	Subcommands: map[string]*cmds.Command{
-		"add": urlAdd,
+		"add":    urlAdd,
+		"verify": urlVerify,
 	},
 }
 
@@ -119,3 +120,61 @@ time.
 		}),
 	},
 }
+
+var urlVerify = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Verify the blocks stored at URLs.",
+		LongDescription: `
+Fetch the content of the URLs added with 'ipfs urlstore add' again, and
+verify the blocks stored at them. The content of each URL is fetched once.
+
+If one or more <url> is specified only verify the blocks stored at those
+URLs, otherwise verify the blocks stored at any URL.
+
+The output is the same as the one of 'ipfs filestore verify', where
+'changed' means the content of the URL has changed upstream, and 'no-file'
+that the URL can't be found anymore.
+
+With --repair, the references to changed or missing content are removed,
+and 'dropped' is printed after their entry.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("url", false, true, "URL of the blocks to verify."),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.BoolOption(repairOptionName, "remove the references to changed or missing content"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		_, fs, err := getFilestore(env)
+		if err != nil {
+			return err
+		}
+
+		for _, url := range req.Arguments {
+			if !filestore.IsURL(url) {
+				return fmt.Errorf("unsupported url syntax: %s", url)
+			}
+		}
+
+		repair, _ := req.Options[repairOptionName].(bool)
+		next, err := filestore.VerifyURLs(req.Context, fs, req.Arguments...)
+		if err != nil {
+			return err
+		}
+
+		for r := next(); r != nil; r = next() {
+			if repair {
+				if err := filestore.DropStale(fs, r); err != nil {
+					return err
+				}
+			}
+			if err := res.Emit(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	PostRun: verifyPostRun,
+	Type:    filestore.ListRes{},
+}
@@ -10,7 +10,6 @@ interfaces and how core/... fits into the bigger IPFS picture, see:
 package core
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -18,17 +17,34 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	version "github.com/ipfs/go-ipfs"
+	audit "github.com/ipfs/go-ipfs/core/audit"
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+	peermeta "github.com/ipfs/go-ipfs/core/peermeta"
+	swarmevents "github.com/ipfs/go-ipfs/core/swarmevents"
+	tracing "github.com/ipfs/go-ipfs/core/tracing"
+	webhook "github.com/ipfs/go-ipfs/core/webhook"
+	wss "github.com/ipfs/go-ipfs/core/wss"
+	bsstats "github.com/ipfs/go-ipfs/exchange/bsstats"
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
+	providequeue "github.com/ipfs/go-ipfs/exchange/providequeue"
+	provider "github.com/ipfs/go-ipfs/exchange/provider"
 	rp "github.com/ipfs/go-ipfs/exchange/reprovide"
+	wantages "github.com/ipfs/go-ipfs/exchange/wantages"
 	filestore "github.com/ipfs/go-ipfs/filestore"
 	mount "github.com/ipfs/go-ipfs/fuse/mount"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	ipnsrp "github.com/ipfs/go-ipfs/namesys/republisher"
 	p2p "github.com/ipfs/go-ipfs/p2p"
 	pin "github.com/ipfs/go-ipfs/pin"
+	rendezvous "github.com/ipfs/go-ipfs/rendezvous"
 	repo "github.com/ipfs/go-ipfs/repo"
+	rtpersist "github.com/ipfs/go-ipfs/routing/rtpersist"
+	cachebs "github.com/ipfs/go-ipfs/thirdparty/cachebs"
+	quotabs "github.com/ipfs/go-ipfs/thirdparty/quotabs"
 
 	circuit "gx/ipfs/QmNcNWuV38HBGYtRUi3okmfXSMEmXWwNgb82N3PzqqsHhY/go-libp2p-circuit"
 	ic "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
@@ -50,11 +66,8 @@ import (
 	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
 	mamask "gx/ipfs/QmSMZwvs3n4GBikZ7hKzT17c3bk65FmyZo2JqtJ16swqCv/multiaddr-filter"
 	quic "gx/ipfs/QmSvK3DvgynMo45orM88RQowdupvgdxs3fDyahQsKkmcUP/go-libp2p-quic-transport"
-	bitswap "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap"
-	bsnet "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/network"
 	dht "gx/ipfs/QmXbPygnUKAPMwseE5U3hQA7Thn59GVm7pQrhkFV63umT8/go-libp2p-kad-dht"
 	dhtopts "gx/ipfs/QmXbPygnUKAPMwseE5U3hQA7Thn59GVm7pQrhkFV63umT8/go-libp2p-kad-dht/opts"
-	pnet "gx/ipfs/QmY4Q5JC4vxLEi8EpVxJM4rcRryEVtH1zRKVTAm6BKV1pg/go-libp2p-pnet"
 	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
 	smux "gx/ipfs/QmY9JXR3FupnYAYJWK9aMr9bCpqWKcToQ1tz8DVGTrHpHw/go-stream-muxer"
 	psrouter "gx/ipfs/QmYNjCcTvz65dj9GbsmLKsVDkAiJNGHdWBMCRJamxKTrqB/go-libp2p-pubsub-router"
@@ -94,8 +107,12 @@ const (
 	onlineMode
 )
 
+// defaultUserAgent is the agent version identify announces unless
+// Swarm.UserAgent is set.
+var defaultUserAgent = "go-ipfs/" + version.CurrentVersionNumber + "/" + version.CurrentCommit
+
 func init() {
-	identify.ClientVersion = "go-ipfs/" + version.CurrentVersionNumber + "/" + version.CurrentCommit
+	identify.ClientVersion = defaultUserAgent
 }
 
 // IpfsNode is IPFS Core module. It represents an IPFS instance.
@@ -118,33 +135,93 @@ type IpfsNode struct {
 	Filestore       *filestore.Filestore // the filestore blockstore
 	BaseBlocks      bstore.Blockstore    // the raw blockstore, no filestore wrapping
 	GCLocker        bstore.GCLocker      // the locker used to protect the blockstore during gc
+	BlockCache      *cachebs.Blockstore  // the blockstore caches, nil with a nil repo
+	StorageQuota    *quotabs.Blockstore  // tracks the storage used, nil if Datastore.StorageMax isn't set
 	Blocks          bserv.BlockService   // the block service, get/add blocks.
 	DAG             ipld.DAGService      // the merkle dag service, get/add objects.
 	Resolver        *resolver.Resolver   // the path resolution system
 	Reporter        metrics.Reporter
 	Discovery       discovery.Service
 	FilesRoot       *mfs.Root
+	FilesEvents     *corefiles.Notifier // the changes of MFS, see 'ipfs files watch'
+	FilesShardSize  uint64              // the size of the MFS directories converted to HAMT shards, 0 not to
+	FilesFlusher    *corefiles.Flusher  // flushes the changes of MFS in write-back mode
+	FilesLock       sync.RWMutex        // held shared by the changes of MFS, and exclusively to swap in the root of a batch
 	RecordValidator record.Validator
+	Repos           *NamedRepos       // the named repos served by the node, nil for the nodes of named repos
+	Webhooks        *webhook.Notifier // notifies the endpoints of Webhooks of the events of the node
 
 	// Online
-	PeerHost     p2phost.Host        // the network host (server+client)
-	Bootstrapper io.Closer           // the periodic bootstrapper
-	Routing      routing.IpfsRouting // the routing system. recommend ipfs-dht
-	Exchange     exchange.Interface  // the block exchange + strategy (bitswap)
-	Namesys      namesys.NameSystem  // the name system, resolves paths to hashes
-	Reprovider   *rp.Reprovider      // the value reprovider system
+	PeerHost     p2phost.Host          // the network host (server+client)
+	SwarmEvents  *swarmevents.Hub      // the peers connected, disconnected and discovered, see 'ipfs swarm events'
+	WSS          *wss.Server           // serves the websocket transport over TLS, nil unless Swarm.WSS.Listen is set
+	Bootstrapper io.Closer             // the periodic bootstrapper
+	Routing      routing.IpfsRouting   // the routing system. recommend ipfs-dht
+	Exchange     exchange.Interface    // the block exchange + strategy (bitswap unless Exchange.Type is set)
+	Rendezvous   *rendezvous.Client    // registers and discovers peers at rendezvous points, nil unless Rendezvous.Points is set
+	WantAges     *wantages.Tracker     // tracks the age of the bitswap wantlist entries, nil with other exchanges
+	BitswapStats *bsstats.Network      // counts the bitswap messages and blocks exchanged with each peer, nil with other exchanges
+	ProvideQueue *providequeue.Tracker // tracks the blocks added until they are announced, nil offline
+	Provider     *provider.Queue       // announces the blocks received by the exchange from a persistent queue, nil offline
+	Namesys      namesys.NameSystem    // the name system, resolves paths to hashes
+	Reprovider   *rp.Reprovider        // the value reprovider system
 	IpnsRepub    *ipnsrp.Republisher
 
-	PubSub   *pubsub.PubSub
-	PSRouter *psrouter.PubsubValueStore
-	DHT      *dht.IpfsDHT
-	P2P      *p2p.P2P
+	PubSub            *pubsub.PubSub
+	PSRouter          *psrouter.PubsubValueStore
+	DHT               *dht.IpfsDHT
+	P2P               *p2p.P2P
+	RendezvousService *rendezvous.Service // the rendezvous point served, nil unless Rendezvous.Server is set
+	PeerMeta          *peermeta.Service   // serves the metadata of Swarm.Metadata and fetches that of the peers
+
+	proc   goprocess.Process
+	ctx    context.Context
+	parent *IpfsNode // the node serving the named repo of the node
+
+	// announcer announces the content of the node, see newAnnouncer, and
+	// provideFilter selects the keys announced, nil if they all are
+	announcer     routing.ContentRouting
+	provideFilter *rp.Filter
+
+	// provides announces the blocks received by the exchange, through the
+	// Provider, see setupProvider
+	provides routing.ContentRouting
 
-	proc goprocess.Process
-	ctx  context.Context
+	// wantPriorities are the priorities of the blocks fetched, which the
+	// bitswap network sends with the wants
+	wantPriorities *priority.Wants
 
 	mode         mode
 	localModeSet bool
+
+	reloadLk  sync.Mutex
+	reloaders []configReloader
+
+	discoveryLk  sync.Mutex
+	discoveryCfg config.MDNS
+	discoveryTag string
+
+	// peersFound is told about the peers found by mDNS, nil unless the
+	// routing system keeps track of them
+	peersFound discovery.Notifee
+
+	// tableSaver saves the routing table of the DHT, nil without DHT
+	tableSaver *rtpersist.Saver
+
+	// pnet protects the connections of the private network, nil unless the
+	// node is part of one
+	pnet *pnetProtector
+
+	// swarmListen keeps track of the addresses the swarm listens on, nil
+	// unless the node is online
+	swarmListen *swarmListen
+
+	// natPortMap reports the port mappings of the NAT device, nil unless
+	// the node maps its ports
+	natPortMap *natPortMap
+
+	// audit records the operations on the node, see AuditLog
+	audit *audit.Log
 }
 
 // Mounts defines what the node's mount state is. This should
@@ -153,6 +230,7 @@ type IpfsNode struct {
 type Mounts struct {
 	Ipfs mount.Mount
 	Ipns mount.Mount
+	Mfs  mount.Mount // the writable mount of MFS, see 'ipfs mount --mfs-path'
 }
 
 func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption RoutingOption, hostOption HostOption, do DiscoveryOption, pubsub, ipnsps, mplex bool) error {
@@ -192,10 +270,11 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 	}
 
 	if swarmkey != nil {
-		protec, err := pnet.NewProtector(bytes.NewReader(swarmkey))
+		protec, err := n.newPNetProtector(swarmkey)
 		if err != nil {
 			return fmt.Errorf("failed to configure private network: %s", err)
 		}
+		n.pnet = protec
 		n.PNetFingerprint = protec.Fingerprint()
 		go func() {
 			t := time.NewTicker(30 * time.Second)
@@ -226,6 +305,15 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 	if !cfg.Swarm.DisableRelay {
 		addrsFactory = composeAddrsFactory(addrsFactory, filterRelayAddrs)
 	}
+	n.WSS, err = wssServer(n.Repo)
+	if err != nil {
+		return err
+	}
+	if n.WSS != nil {
+		addrsFactory = composeAddrsFactory(addrsFactory, n.withWSSAddrs)
+	}
+	n.swarmListen = &swarmListen{}
+	addrsFactory = composeAddrsFactory(addrsFactory, n.withoutRemovedListenAddrs)
 	libp2pOpts = append(libp2pOpts, libp2p.AddrsFactory(addrsFactory))
 
 	connm, err := constructConnMgr(cfg.Swarm.ConnMgr)
@@ -237,7 +325,7 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 	libp2pOpts = append(libp2pOpts, makeSmuxTransportOption(mplex))
 
 	if !cfg.Swarm.DisableNatPortMap {
-		libp2pOpts = append(libp2pOpts, libp2p.NATPortMap())
+		libp2pOpts = append(libp2pOpts, libp2p.NATManager(n.newNATManager))
 	}
 
 	// disable the default listen addrs
@@ -257,28 +345,70 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 	// explicitly enable the default transports
 	libp2pOpts = append(libp2pOpts, libp2p.DefaultTransports)
 
-	if cfg.Experimental.QUIC {
+	quicOn, err := quicEnabled(n.Repo, cfg, swarmkey != nil)
+	if err != nil {
+		return err
+	}
+	if quicOn {
 		libp2pOpts = append(libp2pOpts, libp2p.Transport(quic.NewTransport))
 	}
 
+	if err := setUserAgent(n.Repo); err != nil {
+		return err
+	}
+
+	autoRelayOpts, routingOption, err := n.autoRelayOptions(ctx, cfg, routingOption)
+	if err != nil {
+		return err
+	}
+	libp2pOpts = append(libp2pOpts, autoRelayOpts...)
+
 	peerhost, err := hostOption(ctx, n.Identity, n.Peerstore, libp2pOpts...)
 
 	if err != nil {
 		return err
 	}
 
+	n.SwarmEvents = swarmevents.New()
+	peerhost.Network().Notify(n.SwarmEvents.Notifiee())
+
 	if err := n.startOnlineServicesWithHost(ctx, peerhost, routingOption, pubsub, ipnsps); err != nil {
 		return err
 	}
 
+	if err := n.setupConnGater(); err != nil {
+		return err
+	}
+
+	if err := n.setupRelayLimits(cfg); err != nil {
+		return err
+	}
+	if len(autoRelayOpts) > 0 {
+		n.Process().Go(n.reserveRelays)
+	}
+
 	// Ok, now we're ready to listen.
-	if err := startListening(n.PeerHost, cfg); err != nil {
+	if err := n.listenSwarm(quicOn); err != nil {
 		return err
 	}
+	if n.WSS != nil {
+		if err := n.listenWSS(); err != nil {
+			return err
+		}
+	}
 
 	n.P2P = p2p.NewP2P(n.Identity, n.PeerHost, n.Peerstore)
+	if err := n.setupP2PACL(); err != nil {
+		return err
+	}
 
 	// setup local discovery
+	n.discoveryCfg = cfg.Discovery.MDNS
+	n.discoveryTag, err = mdnsServiceTag(n.Repo)
+	if err != nil {
+		return err
+	}
+	n.OnConfigReload("Discovery.MDNS", n.reloadDiscovery)
 	if do != nil {
 		service, err := do(ctx, n.PeerHost)
 		if err != nil {
@@ -289,6 +419,20 @@ func (n *IpfsNode) startOnlineServices(ctx context.Context, routingOption Routin
 		}
 	}
 
+	if err := n.setupPeerMeta(); err != nil {
+		return err
+	}
+
+	if err := n.setupRendezvous(); err != nil {
+		return err
+	}
+
+	if n.DHT != nil {
+		if err := n.restoreRoutingTable(ctx); err != nil {
+			return err
+		}
+	}
+
 	return n.Bootstrap(DefaultBootstrapConfig)
 }
 
@@ -311,7 +455,9 @@ func constructConnMgr(cfg config.ConnMgr) (ifconnmgr.ConnManager, error) {
 	}
 }
 
-func (n *IpfsNode) startLateOnlineServices(ctx context.Context) error {
+// startLateOnlineServices starts the reprovider, which only reprovides the
+// keys when triggered unless reprovide is set.
+func (n *IpfsNode) startLateOnlineServices(ctx context.Context, reprovide bool) error {
 	cfg, err := n.Repo.Config()
 	if err != nil {
 		return err
@@ -328,10 +474,19 @@ func (n *IpfsNode) startLateOnlineServices(ctx context.Context) error {
 		keyProvider = rp.NewPinnedProvider(n.Pinning, n.DAG, true)
 	case "pinned":
 		keyProvider = rp.NewPinnedProvider(n.Pinning, n.DAG, false)
+	case "mfs":
+		keyProvider = rp.NewMFSProvider(n.FilesRoot, n.Blockstore)
 	default:
 		return fmt.Errorf("unknown reprovider strategy '%s'", cfg.Reprovider.Strategy)
 	}
-	n.Reprovider = rp.NewReprovider(ctx, n.Routing, keyProvider)
+	if n.provideFilter != nil {
+		keyProvider = rp.NewFilteredProvider(keyProvider, n.provideFilter)
+	}
+	rsys := n.announcer
+	if n.ProvideQueue != nil {
+		rsys = providequeue.WrapRouting(n.announcer, n.ProvideQueue)
+	}
+	n.Reprovider = rp.NewReprovider(ctx, rsys, keyProvider)
 
 	reproviderInterval := kReprovideFrequency
 	if cfg.Reprovider.Interval != "" {
@@ -343,7 +498,13 @@ func (n *IpfsNode) startLateOnlineServices(ctx context.Context) error {
 		reproviderInterval = dur
 	}
 
+	if !reprovide {
+		go n.Reprovider.Run(0)
+		return nil
+	}
+
 	go n.Reprovider.Run(reproviderInterval)
+	n.OnConfigReload("Reprovider.Interval", n.reloadReproviderInterval)
 
 	return nil
 }
@@ -436,14 +597,9 @@ func makeSmuxTransportOption(mplexExp bool) libp2p.Option {
 	return libp2p.ChainOptions(opts...)
 }
 
-func setupDiscoveryOption(d config.Discovery) DiscoveryOption {
+func setupDiscoveryOption(d config.Discovery, tag string) DiscoveryOption {
 	if d.MDNS.Enabled {
-		return func(ctx context.Context, h p2phost.Host) (discovery.Service, error) {
-			if d.MDNS.Interval == 0 {
-				d.MDNS.Interval = 5
-			}
-			return discovery.NewMdnsService(ctx, h, time.Duration(d.MDNS.Interval)*time.Second, discovery.ServiceTag)
-		}
+		return mdnsOption(d.MDNS, tag)
 	}
 	return nil
 }
@@ -452,6 +608,22 @@ func setupDiscoveryOption(d config.Discovery) DiscoveryOption {
 // logs a warning log.
 func (n *IpfsNode) HandlePeerFound(p pstore.PeerInfo) {
 	log.Warning("trying peer info: ", p)
+	if n.peersFound != nil {
+		n.peersFound.HandlePeerFound(p)
+	}
+	n.peerFound(p, "mdns")
+}
+
+// peerFound connects to p, found by the discovery service source.
+func (n *IpfsNode) peerFound(p pstore.PeerInfo, source string) {
+	if n.SwarmEvents != nil {
+		n.SwarmEvents.Publish(swarmevents.Event{
+			Type:   swarmevents.Discovered,
+			Peer:   p.ID,
+			Addrs:  p.Addrs,
+			Source: source,
+		})
+	}
 	ctx, cancel := context.WithTimeout(n.Context(), discoveryConnTimeout)
 	defer cancel()
 	if err := n.PeerHost.Connect(ctx, p); err != nil {
@@ -518,8 +690,23 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	//    PSRouter case below.
 	// 3. Introduce some kind of service manager? (my personal favorite but
 	//    that requires a fair amount of work).
-	if dht, ok := r.(*dht.IpfsDHT); ok {
-		n.DHT = dht
+	n.DHT = findDHT(r)
+	// the routers keeping track of the peers found by mDNS are told about
+	// them by the node
+	if nf, ok := r.(discovery.Notifee); ok {
+		n.peersFound = nf
+	}
+
+	n.Routing, err = n.withDelegates(n.Routing)
+	if err != nil {
+		return err
+	}
+	n.Routing, err = n.wrapRouting(ctx, n.Routing)
+	if err != nil {
+		return err
+	}
+	if tracing.Enabled() {
+		n.Routing = tracing.WrapRouting(n.Routing)
 	}
 
 	if enableIpnsps {
@@ -548,9 +735,39 @@ func (n *IpfsNode) startOnlineServicesWithHost(ctx context.Context, host p2phost
 	// Wrap standard peer host with routing system to allow unknown peer lookups
 	n.PeerHost = rhost.Wrap(host, n.Routing)
 
+	n.announcer, err = n.newAnnouncer(ctx)
+	if err != nil {
+		return err
+	}
+	clientOnly, err := configBool(n.Repo, "Bitswap.ClientOnly")
+	if err != nil {
+		return err
+	}
+	if clientOnly {
+		// the blocks aren't served, announcing them would only attract
+		// wants left unanswered
+		n.announcer = &clientOnlyRouting{n.announcer}
+	}
+	n.provideFilter, err = provideFilter(n.Repo)
+	if err != nil {
+		return err
+	}
+
 	// setup exchange service
-	bitswapNetwork := bsnet.NewFromIpfsHost(n.PeerHost, n.Routing)
-	n.Exchange = bitswap.New(ctx, bitswapNetwork, n.Blockstore)
+	// the blocks fetched for the named repos are stored in their own
+	// blockstores, see exchangeBlockstore
+	n.Repos.blocks = newExchangeBlockstore(n.Blockstore)
+	var exchangeBlocks bstore.Blockstore = n.Repos.blocks
+	if clientOnly {
+		exchangeBlocks = &clientOnlyBlockstore{exchangeBlocks}
+	}
+	if err := n.setupProvider(ctx); err != nil {
+		return err
+	}
+	n.Exchange, err = n.newExchange(ctx, exchangeBlocks)
+	if err != nil {
+		return err
+	}
 
 	size, err := n.getCacheSize()
 	if err != nil {
@@ -646,6 +863,21 @@ func (n *IpfsNode) teardown() error {
 	// needs to use another during its shutdown/cleanup process, it should be
 	// closed before that other object
 
+	// named repos use the network services of the node
+	if n.Repos != nil {
+		closers = append(closers, n.Repos)
+	}
+
+	// the mount of MFS writes to its root
+	if n.Mounts.Mfs != nil && !n.Mounts.Mfs.IsActive() {
+		closers = append(closers, mount.Closer(n.Mounts.Mfs))
+	}
+
+	// flush the pending changes of MFS before closing its root
+	if n.FilesFlusher != nil {
+		closers = append(closers, n.FilesFlusher)
+	}
+
 	if n.FilesRoot != nil {
 		closers = append(closers, n.FilesRoot)
 	}
@@ -654,6 +886,18 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.Exchange)
 	}
 
+	if n.RendezvousService != nil {
+		closers = append(closers, n.RendezvousService)
+	}
+
+	if n.PeerMeta != nil {
+		closers = append(closers, n.PeerMeta)
+	}
+
+	if n.Webhooks != nil {
+		closers = append(closers, n.Webhooks)
+	}
+
 	if n.Mounts.Ipfs != nil && !n.Mounts.Ipfs.IsActive() {
 		closers = append(closers, mount.Closer(n.Mounts.Ipfs))
 	}
@@ -661,6 +905,11 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, mount.Closer(n.Mounts.Ipns))
 	}
 
+	// the routing table is saved while the peers are still connected
+	if n.tableSaver != nil {
+		closers = append(closers, n.tableSaver)
+	}
+
 	if n.DHT != nil {
 		closers = append(closers, n.DHT.Process())
 	}
@@ -673,10 +922,23 @@ func (n *IpfsNode) teardown() error {
 		closers = append(closers, n.Bootstrapper)
 	}
 
-	if n.PeerHost != nil {
+	if n.WSS != nil {
+		closers = append(closers, n.WSS)
+	}
+
+	if n.PeerHost != nil && n.parent == nil {
 		closers = append(closers, n.PeerHost)
 	}
 
+	if n.pnet != nil {
+		closers = append(closers, n.pnet)
+	}
+
+	// the operations running while closing are still recorded
+	if n.audit != nil {
+		closers = append(closers, n.audit)
+	}
+
 	// Repo closed last, most things need to preserve state here
 	closers = append(closers, n.Repo)
 
@@ -820,8 +1082,18 @@ func (n *IpfsNode) loadBootstrapPeers() ([]pstore.PeerInfo, error) {
 
 func (n *IpfsNode) loadFilesRoot() error {
 	dsk := ds.NewKey("/local/filesroot")
+	n.FilesEvents = corefiles.NewNotifier()
 	pf := func(ctx context.Context, c cid.Cid) error {
-		return n.Repo.Datastore().Put(dsk, c.Bytes())
+		err := n.Repo.Datastore().Put(dsk, c.Bytes())
+		if err == repo.ErrReadOnly {
+			// Nodes using a read-only repo don't change the MFS root, it
+			// is only republished when closing them.
+			err = nil
+		}
+		if err == nil {
+			n.FilesEvents.Notify(corefiles.Event{Op: corefiles.OpPublish, Path: "/", Cid: c})
+		}
+		return err
 	}
 
 	var nd *merkledag.ProtoNode
@@ -961,27 +1233,6 @@ func composeAddrsFactory(f, g p2pbhost.AddrsFactory) p2pbhost.AddrsFactory {
 	}
 }
 
-// startListening on the network addresses
-func startListening(host p2phost.Host, cfg *config.Config) error {
-	listenAddrs, err := listenAddresses(cfg)
-	if err != nil {
-		return err
-	}
-
-	// Actually start listening:
-	if err := host.Network().Listen(listenAddrs...); err != nil {
-		return err
-	}
-
-	// list out our addresses
-	addrs, err := host.Network().InterfaceListenAddresses()
-	if err != nil {
-		return err
-	}
-	log.Infof("Swarm listening at: %s", addrs)
-	return nil
-}
-
 func constructDHTRouting(ctx context.Context, host p2phost.Host, dstore ds.Batching, validator record.Validator) (routing.IpfsRouting, error) {
 	return dht.New(
 		ctx, host,
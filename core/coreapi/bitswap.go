@@ -0,0 +1,101 @@
+package coreapi
+
+import (
+	"context"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	wantages "github.com/ipfs/go-ipfs/exchange/wantages"
+
+	bitswap "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+type BitswapAPI CoreAPI
+
+func (api *BitswapAPI) Wantlist(ctx context.Context) ([]coreiface.WantlistEntry, error) {
+	if !api.node.OnlineMode() || api.node.WantAges == nil {
+		return nil, coreiface.ErrOffline
+	}
+	return wantlistEntries(api.node.WantAges.Wantlist()), nil
+}
+
+func (api *BitswapAPI) WantlistForPeer(ctx context.Context, p peer.ID) ([]coreiface.WantlistEntry, error) {
+	if !api.node.OnlineMode() || api.node.WantAges == nil {
+		return nil, coreiface.ErrOffline
+	}
+	if p == api.node.Identity {
+		return api.Wantlist(ctx)
+	}
+	return wantlistEntries(api.node.WantAges.WantlistForPeer(p)), nil
+}
+
+func (api *BitswapAPI) Ledger(ctx context.Context, p peer.ID) (*coreiface.BitswapLedger, error) {
+	bs, err := api.bitswap()
+	if err != nil {
+		return nil, err
+	}
+	return api.ledger(bs, p), nil
+}
+
+func (api *BitswapAPI) Ledgers(ctx context.Context) ([]*coreiface.BitswapLedger, error) {
+	bs, err := api.bitswap()
+	if err != nil {
+		return nil, err
+	}
+	st, err := bs.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*coreiface.BitswapLedger, 0, len(st.Peers))
+	for _, s := range st.Peers {
+		p, err := peer.IDB58Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, api.ledger(bs, p))
+	}
+	return out, nil
+}
+
+func (api *BitswapAPI) bitswap() (*bitswap.Bitswap, error) {
+	if !api.node.OnlineMode() {
+		return nil, coreiface.ErrOffline
+	}
+	bs, ok := api.node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		return nil, coreiface.ErrOffline
+	}
+	return bs, nil
+}
+
+func (api *BitswapAPI) ledger(bs *bitswap.Bitswap, p peer.ID) *coreiface.BitswapLedger {
+	r := bs.LedgerForPeer(p)
+	l := &coreiface.BitswapLedger{
+		Peer:          p,
+		DebtRatio:     r.Value,
+		BytesSent:     r.Sent,
+		BytesReceived: r.Recv,
+	}
+	if api.node.BitswapStats != nil {
+		st := api.node.BitswapStats.Stats(p)
+		l.BlocksSent = st.BlocksSent
+		l.BlocksReceived = st.BlocksReceived
+		l.MessagesSent = st.MessagesSent
+		l.MessagesReceived = st.MessagesReceived
+	}
+	return l
+}
+
+func wantlistEntries(entries []wantages.Entry) []coreiface.WantlistEntry {
+	now := time.Now()
+	out := make([]coreiface.WantlistEntry, len(entries))
+	for i, e := range entries {
+		out[i] = coreiface.WantlistEntry{
+			Cid: e.Cid,
+			Age: now.Sub(e.Since),
+		}
+	}
+	return out
+}
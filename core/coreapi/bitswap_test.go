@@ -0,0 +1,91 @@
+package coreapi_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+)
+
+func TestBitswapWantlist(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nds, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := blocks.NewBlock([]byte("missing")).Cid()
+	go apis[1].Block().Get(ctx, coreiface.IpldPath(missing))
+
+	hasEntry := func(entries []coreiface.WantlistEntry, c cid.Cid) bool {
+		for _, e := range entries {
+			if e.Cid.Equals(c) && e.Age >= 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		own, err := apis[1].Bitswap().Wantlist(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		remote, err := apis[0].Bitswap().WantlistForPeer(ctx, nds[1].Identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hasEntry(own, missing) && hasEntry(remote, missing) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s on the wantlists, got %v and %v", missing, own, remote)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestBitswapLedger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nds, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := apis[0].Block().Put(ctx, strings.NewReader("Hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apis[1].Block().Get(ctx, res.Path()); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := apis[0].Bitswap().Ledger(ctx, nds[1].Identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.BlocksSent != 1 || l.BytesSent != uint64(len("Hello")) {
+		t.Errorf("expected the block to be accounted for, got %+v", l)
+	}
+	if l.MessagesReceived == 0 {
+		t.Error("expected the wantlist of the peer to be accounted for")
+	}
+
+	ledgers, err := apis[0].Bitswap().Ledgers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ledgers) != 1 || ledgers[0].Peer != nds[1].Identity {
+		t.Errorf("expected the ledger of the only partner, got %v", ledgers)
+	}
+}
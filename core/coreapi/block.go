@@ -22,7 +22,10 @@ type BlockStat struct {
 	size int
 }
 
-func (api *BlockAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.BlockPutOption) (coreiface.BlockStat, error) {
+func (api *BlockAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.BlockPutOption) (_ coreiface.BlockStat, err error) {
+	ctx, done := instrument(ctx, "Block.Put")
+	defer done(&err)
+
 	_, pref, err := caopts.BlockPutOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -51,13 +54,16 @@ func (api *BlockAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.Bloc
 	return &BlockStat{path: coreiface.IpldPath(b.Cid()), size: len(data)}, nil
 }
 
-func (api *BlockAPI) Get(ctx context.Context, p coreiface.Path) (io.Reader, error) {
+func (api *BlockAPI) Get(ctx context.Context, p coreiface.Path) (_ io.Reader, err error) {
+	ctx, done := instrument(ctx, "Block.Get")
+	defer done(&err)
+
 	rp, err := api.core().ResolvePath(ctx, p)
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := api.node.Blocks.GetBlock(ctx, rp.Cid())
+	b, err := api.blocks.GetBlock(ctx, rp.Cid())
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +71,10 @@ func (api *BlockAPI) Get(ctx context.Context, p coreiface.Path) (io.Reader, erro
 	return bytes.NewReader(b.RawData()), nil
 }
 
-func (api *BlockAPI) Rm(ctx context.Context, p coreiface.Path, opts ...caopts.BlockRmOption) error {
+func (api *BlockAPI) Rm(ctx context.Context, p coreiface.Path, opts ...caopts.BlockRmOption) (err error) {
+	ctx, done := instrument(ctx, "Block.Rm")
+	defer done(&err)
+
 	rp, err := api.core().ResolvePath(ctx, p)
 	if err != nil {
 		return err
@@ -103,13 +112,16 @@ func (api *BlockAPI) Rm(ctx context.Context, p coreiface.Path, opts ...caopts.Bl
 	}
 }
 
-func (api *BlockAPI) Stat(ctx context.Context, p coreiface.Path) (coreiface.BlockStat, error) {
+func (api *BlockAPI) Stat(ctx context.Context, p coreiface.Path) (_ coreiface.BlockStat, err error) {
+	ctx, done := instrument(ctx, "Block.Stat")
+	defer done(&err)
+
 	rp, err := api.core().ResolvePath(ctx, p)
 	if err != nil {
 		return nil, err
 	}
 
-	b, err := api.node.Blocks.GetBlock(ctx, rp.Cid())
+	b, err := api.blocks.GetBlock(ctx, rp.Cid())
 	if err != nil {
 		return nil, err
 	}
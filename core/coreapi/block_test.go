@@ -181,3 +181,43 @@ func TestBlockStat(t *testing.T) {
 		t.Error("length doesn't match")
 	}
 }
+
+func TestBlockWithSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := apis[0].Block().Put(ctx, strings.NewReader(`Hello`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ses := apis[1].WithSession(ctx)
+	if ses.WithSession(ctx) != ses {
+		t.Error("expected sessions not to be nested")
+	}
+
+	r, err := ses.Block().Get(ctx, res.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "Hello" {
+		t.Errorf("got wrong data: %s", d)
+	}
+
+	// the writes aren't affected by the session
+	put, err := ses.Block().Put(ctx, strings.NewReader(`World`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apis[1].Block().Stat(ctx, put.Path()); err != nil {
+		t.Error(err)
+	}
+}
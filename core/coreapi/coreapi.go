@@ -7,6 +7,12 @@ If you are running IPFS as a separate process, you should use `go-ipfs-api` to
 work with it via HTTP. As we finalize the interfaces here, `go-ipfs-api` will
 transparently adopt them so you can use the same code with either package.
 
+The calls of the main methods of the API, e.g. Unixfs.Add, Pin.Add or
+Name.Resolve, are recorded in the Prometheus metrics
+`ipfs_coreapi_calls_total`, by method and error, and
+`ipfs_coreapi_call_duration_seconds`, by method. They are registered with the
+default registry, which the daemon serves on `/debug/metrics/prometheus`.
+
 **NOTE: this package is experimental.** `go-ipfs` has mainly been developed
 as a standalone application and library-style use of this package is still new.
 Interfaces here aren't yet completely stable.
@@ -18,7 +24,10 @@ import (
 
 	core "github.com/ipfs/go-ipfs/core"
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
 
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
 	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
@@ -29,14 +38,61 @@ var log = logging.Logger("core/coreapi")
 type CoreAPI struct {
 	node *core.IpfsNode
 	dag  ipld.DAGService
+
+	// blocks fetches the blocks read through the Block API
+	blocks bserv.BlockGetter
+
+	// session is set when the reads of the API share a bitswap session,
+	// see WithSession
+	session bool
+
+	// priority is the priority of the fetches of the API, if prioritized is
+	// set, see WithPriority
+	priority    priority.Priority
+	prioritized bool
 }
 
 // NewCoreAPI creates new instance of IPFS CoreAPI backed by go-ipfs Node.
 func NewCoreAPI(n *core.IpfsNode) coreiface.CoreAPI {
-	api := &CoreAPI{n, n.DAG}
+	api := &CoreAPI{node: n, dag: n.DAG, blocks: n.Blocks}
 	return api
 }
 
+// WithSession returns an api backed by the same node whose reads share a
+// single bitswap session until ctx is canceled. The writes go to the node as
+// they would without the session.
+func (api *CoreAPI) WithSession(ctx context.Context) coreiface.CoreAPI {
+	if api.session {
+		return api
+	}
+	out := &CoreAPI{
+		node: api.node,
+		dag: &sessionDAG{
+			DAGService: api.dag,
+			ses:        dag.NewSession(ctx, api.dag),
+		},
+		blocks:  bserv.NewSession(ctx, api.node.Blocks),
+		session: true,
+	}
+	if api.prioritized {
+		out.setPriority(api.priority)
+	}
+	return out
+}
+
+// WithPriority returns an api backed by the same node whose fetches have
+// priority p, see exchange/priority.
+func (api *CoreAPI) WithPriority(p coreiface.Priority) coreiface.CoreAPI {
+	out := &CoreAPI{
+		node:    api.node,
+		dag:     api.dag,
+		blocks:  api.blocks,
+		session: api.session,
+	}
+	out.setPriority(priority.Priority(p))
+	return out
+}
+
 // Unixfs returns the UnixfsAPI interface implementation backed by the go-ipfs node
 func (api *CoreAPI) Unixfs() coreiface.UnixfsAPI {
 	return (*UnixfsAPI)(api)
@@ -87,8 +143,83 @@ func (api *CoreAPI) PubSub() coreiface.PubSubAPI {
 	return (*PubSubAPI)(api)
 }
 
-// getSession returns new api backed by the same node with a read-only session DAG
+// Ping returns the PingAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Ping() coreiface.PingAPI {
+	return (*PingAPI)(api)
+}
+
+// Stats returns the StatsAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Stats() coreiface.StatsAPI {
+	return (*StatsAPI)(api)
+}
+
+// Files returns the FilesAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Files() coreiface.FilesAPI {
+	return (*FilesAPI)(api)
+}
+
+// Bitswap returns the BitswapAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Bitswap() coreiface.BitswapAPI {
+	return (*BitswapAPI)(api)
+}
+
+// Repo returns the RepoAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Repo() coreiface.RepoAPI {
+	return (*RepoAPI)(api)
+}
+
+// Reprovider returns the ReproviderAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Reprovider() coreiface.ReproviderAPI {
+	return (*ReproviderAPI)(api)
+}
+
+// Filestore returns the FilestoreAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Filestore() coreiface.FilestoreAPI {
+	return (*FilestoreAPI)(api)
+}
+
+// P2P returns the P2PAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) P2P() coreiface.P2PAPI {
+	return (*P2PAPI)(api)
+}
+
+// Log returns the LogAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Log() coreiface.LogAPI {
+	return (*LogAPI)(api)
+}
+
+// Health returns the HealthAPI interface implementation backed by the go-ipfs node
+func (api *CoreAPI) Health() coreiface.HealthAPI {
+	return (*HealthAPI)(api)
+}
+
+// getSession returns new api backed by the same node with a read-only session
+// DAG, or api itself if its reads already share a session
 func (api *CoreAPI) getSession(ctx context.Context) *CoreAPI {
+	if api.session {
+		return api
+	}
 	ng := dag.NewReadOnlyDagService(dag.NewSession(ctx, api.dag))
-	return &CoreAPI{api.node, ng}
+	return &CoreAPI{
+		node:        api.node,
+		dag:         ng,
+		blocks:      api.blocks,
+		priority:    api.priority,
+		prioritized: api.prioritized,
+	}
+}
+
+// sessionDAG is a DAG service fetching the nodes through a session, and
+// writing them through the DAG service it wraps.
+type sessionDAG struct {
+	ipld.DAGService
+	ses ipld.NodeGetter
+}
+
+func (d *sessionDAG) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	return d.ses.Get(ctx, c)
+}
+
+func (d *sessionDAG) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	return d.ses.GetMany(ctx, cids)
 }
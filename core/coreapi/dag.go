@@ -12,8 +12,11 @@ import (
 	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	coredag "github.com/ipfs/go-ipfs/core/coredag"
 
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
 )
 
 type DagAPI CoreAPI
@@ -28,7 +31,10 @@ type dagBatch struct {
 // Put inserts data using specified format and input encoding. Unless used with
 // `WithCodes` or `WithHash`, the defaults "dag-cbor" and "sha256" are used.
 // Returns the path of the inserted data.
-func (api *DagAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.DagPutOption) (coreiface.ResolvedPath, error) {
+func (api *DagAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.DagPutOption) (_ coreiface.ResolvedPath, err error) {
+	ctx, done := instrument(ctx, "Dag.Put")
+	defer done(&err)
+
 	nd, err := getNode(src, opts...)
 
 	err = api.dag.Add(ctx, nd)
@@ -40,7 +46,10 @@ func (api *DagAPI) Put(ctx context.Context, src io.Reader, opts ...caopts.DagPut
 }
 
 // Get resolves `path` using Unixfs resolver, returns the resolved Node.
-func (api *DagAPI) Get(ctx context.Context, path coreiface.Path) (ipld.Node, error) {
+func (api *DagAPI) Get(ctx context.Context, path coreiface.Path) (_ ipld.Node, err error) {
+	ctx, done := instrument(ctx, "Dag.Get")
+	defer done(&err)
+
 	return api.core().ResolveNode(ctx, path)
 }
 
@@ -67,6 +76,262 @@ func (api *DagAPI) Tree(ctx context.Context, p coreiface.Path, opts ...caopts.Da
 	return out, nil
 }
 
+// Refs lists the links of the node specified by the path `p`, and of the nodes
+// below it up to the configured depth. Links are sent on the returned channel
+// as the DAG is fetched; the channel is closed when the traversal finishes.
+func (api *DagAPI) Refs(ctx context.Context, p coreiface.Path, opts ...caopts.DagRefsOption) (<-chan coreiface.DagRef, error) {
+	settings, err := caopts.DagRefsOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	nd, err := api.core().ResolveNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &refWalker{
+		ctx:      ctx,
+		dag:      api.dag,
+		settings: settings,
+		out:      make(chan coreiface.DagRef),
+	}
+	if len(settings.Codecs) > 0 {
+		rw.codecs = make(map[uint64]bool, len(settings.Codecs))
+		for _, c := range settings.Codecs {
+			rw.codecs[c] = true
+		}
+	}
+
+	go func() {
+		defer close(rw.out)
+		if err := rw.walk(nd, 0); err != nil {
+			select {
+			case rw.out <- coreiface.DagRef{Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return rw.out, nil
+}
+
+// refWalker traverses a DAG for DagAPI.Refs.
+type refWalker struct {
+	ctx      context.Context
+	dag      ipld.DAGService
+	settings *caopts.DagRefsSettings
+	codecs   map[uint64]bool
+	out      chan coreiface.DagRef
+
+	seen      map[string]int
+	seenEdges map[string]struct{}
+}
+
+func (rw *refWalker) walk(n ipld.Node, depth int) error {
+	nc := n.Cid()
+
+	for i, ng := range ipld.GetDAG(rw.ctx, rw.dag, n) {
+		lnk := n.Links()[i]
+		goDeeper, shouldWrite := rw.visit(nc, lnk, depth+1) // The children are at depth+1
+
+		// Avoid "Get()" on the node and continue with next Link.
+		// We can do this if:
+		// - We sent it before (thus it was already seen and
+		//   fetched with Get()
+		// - AND we must not go deeper.
+		// This is an optimization for pruned branches which have been
+		// visited before.
+		if !shouldWrite && !goDeeper {
+			continue
+		}
+
+		// We must Get() the node because:
+		// - it is new (never sent)
+		// - OR we need to go deeper.
+		// This ensures sent refs are always fetched.
+		nd, err := ng.Get(rw.ctx)
+		if err != nil {
+			return err
+		}
+
+		if shouldWrite {
+			select {
+			case rw.out <- coreiface.DagRef{From: nc, To: lnk.Cid, Name: lnk.Name}:
+			case <-rw.ctx.Done():
+				return rw.ctx.Err()
+			}
+		}
+
+		// Keep going deeper. This happens:
+		// - On unexplored branches
+		// - On branches not explored deep enough
+		// Note when not deduplicating, branches are always considered
+		// unexplored and only depth limits apply.
+		if goDeeper {
+			if err := rw.walk(nd, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// visit returns two values:
+// - the first boolean is true if we should keep traversing the DAG
+// - the second boolean is true if we should send the link
+//
+// visit will do branch pruning depending on MaxDepth, previously visited
+// cids and whether Unique or UniqueEdges is set. i.e. no deduplication and
+// MaxDepth = -1 disables any pruning. Deduplicating will prune already
+// visited branches at the cost of keeping as set of visited CIDs in memory.
+func (rw *refWalker) visit(from cid.Cid, lnk *ipld.Link, depth int) (bool, bool) {
+	maxDepth := rw.settings.MaxDepth
+	atMaxDepth := maxDepth >= 0 && depth == maxDepth
+	overMaxDepth := maxDepth >= 0 && depth > maxDepth
+
+	// Shortcut when we are over max depth. In practice, this
+	// only applies when MaxDepth is 0, as root's children are
+	// already over max depth. Otherwise nothing should hit this.
+	if overMaxDepth {
+		return false, false
+	}
+
+	goDeeper, shouldWrite := rw.visitNode(lnk.Cid, depth, atMaxDepth)
+
+	// With unique edges, a node is still sent once for every distinct
+	// link to it, even when its branch was pruned.
+	if rw.settings.UniqueEdges && !rw.settings.Unique {
+		if rw.seenEdges == nil {
+			rw.seenEdges = make(map[string]struct{})
+		}
+		key := string(from.Bytes()) + "/" + string(lnk.Cid.Bytes()) + "/" + lnk.Name
+		_, ok := rw.seenEdges[key]
+		rw.seenEdges[key] = struct{}{}
+		shouldWrite = !ok
+	}
+
+	if shouldWrite && rw.codecs != nil {
+		shouldWrite = rw.codecs[lnk.Cid.Type()]
+	}
+	return goDeeper, shouldWrite
+}
+
+func (rw *refWalker) visitNode(c cid.Cid, depth int, atMaxDepth bool) (bool, bool) {
+	// We can shortcut right away if we don't need unique output:
+	//   - we keep traversing when not atMaxDepth
+	//   - always send
+	if !rw.settings.Unique && !rw.settings.UniqueEdges {
+		return !atMaxDepth, true
+	}
+
+	// Deduplicating from this point.
+	// Thus, we keep track of seen Cids, and their depth.
+	if rw.seen == nil {
+		rw.seen = make(map[string]int)
+	}
+	key := string(c.Bytes())
+	oldDepth, ok := rw.seen[key]
+
+	// Branch pruning cases:
+	// - We saw the Cid before and either:
+	//   - Depth is unlimited (MaxDepth = -1)
+	//   - We saw it higher (smaller depth) in the DAG (means we must have
+	//     explored deep enough before)
+	// Because we saw the CID, we don't send it again.
+	if ok && (rw.settings.MaxDepth < 0 || oldDepth <= depth) {
+		return false, false
+	}
+
+	// Final case, we must keep exploring the DAG from this CID
+	// (unless we hit the depth limit).
+	// We note down its depth because it was either not seen
+	// or is lower than last time.
+	// We send it if it was not seen.
+	rw.seen[key] = depth
+	return !atMaxDepth, !ok
+}
+
+// Stat returns the size of the DAG specified by the path `p`, and with
+// `WithLocal` how much of it is stored locally, without fetching the blocks
+// missing.
+func (api *DagAPI) Stat(ctx context.Context, p coreiface.Path, opts ...caopts.DagStatOption) (*coreiface.DagStat, error) {
+	settings, err := caopts.DagStatOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if !settings.WithLocal {
+		nd, err := api.core().ResolveNode(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		size, err := nd.Size()
+		if err != nil {
+			return nil, err
+		}
+		return &coreiface.DagStat{Cid: nd.Cid(), Size: size}, nil
+	}
+
+	rp, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	stat := &coreiface.DagStat{Cid: rp.Cid()}
+	bs := api.node.Blockstore
+	offlineDAG := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	nd, err := offlineDAG.Get(ctx, rp.Cid())
+	switch err {
+	case nil:
+		if stat.Size, err = nd.Size(); err != nil {
+			return nil, err
+		}
+	case ipld.ErrNotFound:
+	default:
+		return nil, err
+	}
+
+	stat.Locality, err = dagLocality(ctx, offlineDAG, rp.Cid())
+	if err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+// dagLocality walks the DAG below root in dserv, which must not fetch the
+// blocks missing, counting the blocks found and missing.
+func dagLocality(ctx context.Context, dserv ipld.DAGService, root cid.Cid) (*coreiface.DagLocality, error) {
+	loc := new(coreiface.DagLocality)
+	seen := cid.NewSet()
+	queue := []*ipld.Link{{Cid: root}}
+	for len(queue) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		l := queue[0]
+		queue = queue[1:]
+		if !seen.Visit(l.Cid) {
+			continue
+		}
+
+		nd, err := dserv.Get(ctx, l.Cid)
+		if err == ipld.ErrNotFound {
+			loc.MissingBlocks++
+			loc.MissingBytes += l.Size
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		loc.LocalBlocks++
+		loc.LocalBytes += uint64(len(nd.RawData()))
+		queue = append(queue, nd.Links()...)
+	}
+	return loc, nil
+}
+
 // Batch creates new DagBatch
 func (api *DagAPI) Batch(ctx context.Context) coreiface.DagBatch {
 	return &dagBatch{api: api}
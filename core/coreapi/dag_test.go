@@ -9,6 +9,8 @@ import (
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	opt "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
 	mh "gx/ipfs/QmerPMzPk1mJVowm8KgmoknWa4yCYvvugMPsgWmDNUvDLW/go-multihash"
 )
 
@@ -117,6 +119,59 @@ func TestTree(t *testing.T) {
 	}
 }
 
+func TestRefs(t *testing.T) {
+	ctx := context.Background()
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := api.Dag().Put(ctx, strings.NewReader(`"leaf"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid, err := api.Dag().Put(ctx, strings.NewReader(`{"a": {"/": "`+leaf.Cid().String()+`"}, "b": {"/": "`+leaf.Cid().String()+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := api.Dag().Put(ctx, strings.NewReader(`{"x": {"/": "`+mid.Cid().String()+`"}, "z": {"/": "`+mid.Cid().String()+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range []struct {
+		opts     []opt.DagRefsOption
+		expected int
+	}{
+		{nil, 2},
+		{[]opt.DagRefsOption{opt.Dag.MaxDepth(0)}, 0},
+		{[]opt.DagRefsOption{opt.Dag.MaxDepth(-1)}, 6},
+		{[]opt.DagRefsOption{opt.Dag.MaxDepth(-1), opt.Dag.Unique(true)}, 2},
+		{[]opt.DagRefsOption{opt.Dag.MaxDepth(-1), opt.Dag.UniqueEdges(true)}, 4},
+		{[]opt.DagRefsOption{opt.Dag.MaxDepth(-1), opt.Dag.Codecs(cid.Raw)}, 0},
+		{[]opt.DagRefsOption{opt.Dag.MaxDepth(-1), opt.Dag.Codecs(cid.DagCBOR)}, 6},
+	} {
+		refs, err := api.Dag().Refs(ctx, root, c.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var n int
+		for ref := range refs {
+			if ref.Err != nil {
+				t.Fatalf("case %d: %s", i, ref.Err)
+			}
+			if ref.Name == "" {
+				t.Errorf("case %d: ref to %s has no name", i, ref.To)
+			}
+			n++
+		}
+		if n != c.expected {
+			t.Errorf("case %d: expected %d refs, got %d", i, c.expected, n)
+		}
+	}
+}
+
 func TestBatch(t *testing.T) {
 	ctx := context.Background()
 	_, api, err := makeAPI(ctx)
@@ -149,3 +204,49 @@ func TestBatch(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestDagStatWithLocal(t *testing.T) {
+	ctx := context.Background()
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := api.Dag().Put(ctx, strings.NewReader(`"foo"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := blocks.NewBlock([]byte("missing")).Cid()
+	root, err := api.Dag().Put(ctx, strings.NewReader(`{"a": {"/": "`+sub.Cid().String()+`"}, "b": {"/": "`+missing.String()+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := api.Dag().Stat(ctx, root, opt.Dag.WithLocal(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc := stat.Locality
+	if loc == nil {
+		t.Fatal("expected the locality to be reported")
+	}
+	if loc.LocalBlocks != 2 || loc.MissingBlocks != 1 || loc.Complete() {
+		t.Fatalf("expected 2 local blocks and 1 missing, got %+v", loc)
+	}
+
+	stat, err = api.Dag().Stat(ctx, sub, opt.Dag.WithLocal(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stat.Locality.Complete() || stat.Locality.LocalBlocks != 1 {
+		t.Fatalf("expected the whole dag to be local, got %+v", stat.Locality)
+	}
+
+	stat, err = api.Dag().Stat(ctx, coreiface.IpldPath(missing), opt.Dag.WithLocal(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size != 0 || stat.Locality.LocalBlocks != 0 || stat.Locality.MissingBlocks != 1 {
+		t.Fatalf("expected only the root to be missing, got %+v", stat.Locality)
+	}
+}
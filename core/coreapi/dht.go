@@ -21,7 +21,10 @@ import (
 
 type DhtAPI CoreAPI
 
-func (api *DhtAPI) FindPeer(ctx context.Context, p peer.ID) (pstore.PeerInfo, error) {
+func (api *DhtAPI) FindPeer(ctx context.Context, p peer.ID) (_ pstore.PeerInfo, err error) {
+	ctx, done := instrument(ctx, "Dht.FindPeer")
+	defer done(&err)
+
 	pi, err := api.node.Routing.FindPeer(ctx, peer.ID(p))
 	if err != nil {
 		return pstore.PeerInfo{}, err
@@ -30,7 +33,10 @@ func (api *DhtAPI) FindPeer(ctx context.Context, p peer.ID) (pstore.PeerInfo, er
 	return pi, nil
 }
 
-func (api *DhtAPI) FindProviders(ctx context.Context, p coreiface.Path, opts ...caopts.DhtFindProvidersOption) (<-chan pstore.PeerInfo, error) {
+func (api *DhtAPI) FindProviders(ctx context.Context, p coreiface.Path, opts ...caopts.DhtFindProvidersOption) (_ <-chan pstore.PeerInfo, err error) {
+	ctx, done := instrument(ctx, "Dht.FindProviders")
+	defer done(&err)
+
 	settings, err := caopts.DhtFindProvidersOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -50,7 +56,10 @@ func (api *DhtAPI) FindProviders(ctx context.Context, p coreiface.Path, opts ...
 	return pchan, nil
 }
 
-func (api *DhtAPI) Provide(ctx context.Context, path coreiface.Path, opts ...caopts.DhtProvideOption) error {
+func (api *DhtAPI) Provide(ctx context.Context, path coreiface.Path, opts ...caopts.DhtProvideOption) (err error) {
+	ctx, done := instrument(ctx, "Dht.Provide")
+	defer done(&err)
+
 	settings, err := caopts.DhtProvideOptions(opts...)
 	if err != nil {
 		return err
@@ -0,0 +1,220 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+type FilesAPI CoreAPI
+
+var errNoFilesRoot = errors.New("this node has no MFS root")
+
+func (api *FilesAPI) Watch(ctx context.Context) (<-chan coreiface.FilesEvent, error) {
+	if api.node.FilesEvents == nil {
+		return nil, errNoFilesRoot
+	}
+	events := api.node.FilesEvents.Watch(ctx)
+
+	out := make(chan coreiface.FilesEvent)
+	go func() {
+		defer close(out)
+		for ev := range events {
+			select {
+			case out <- coreiface.FilesEvent{
+				Op:     ev.Op,
+				Path:   ev.Path,
+				From:   ev.From,
+				Cid:    ev.Cid,
+				Missed: ev.Missed,
+			}:
+			case <-ctx.Done():
+				// the events are closed once the watcher is removed
+				for range events {
+				}
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (api *FilesAPI) Stat(ctx context.Context, path string, opts ...caopts.FilesStatOption) (*coreiface.FilesStat, error) {
+	settings, err := caopts.FilesStatOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	n := api.node
+	if n.FilesRoot == nil {
+		return nil, errNoFilesRoot
+	}
+	fsn, err := mfs.Lookup(n.FilesRoot, path)
+	if err != nil {
+		return nil, err
+	}
+	nd, err := fsn.GetNode()
+	if err != nil {
+		return nil, err
+	}
+
+	stat := &coreiface.FilesStat{
+		Cid:    nd.Cid(),
+		Type:   "file",
+		Blocks: len(nd.Links()),
+	}
+	if _, ok := fsn.(*mfs.Directory); ok {
+		stat.Type = "directory"
+	}
+	if stat.CumulativeSize, err = nd.Size(); err != nil {
+		return nil, err
+	}
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		fsnode, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return nil, err
+		}
+		stat.Size = fsnode.FileSize()
+	default:
+		stat.Size = stat.CumulativeSize
+	}
+
+	md, err := corefiles.ReadMetadata(nd)
+	if err != nil {
+		return nil, err
+	}
+	stat.Mode = md.Mode
+	stat.Mtime = md.Mtime
+
+	if settings.WithLocal {
+		bs := n.Blockstore
+		offlineDAG := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+		if stat.Locality, err = dagLocality(ctx, offlineDAG, nd.Cid()); err != nil {
+			return nil, err
+		}
+	}
+	return stat, nil
+}
+
+func (api *FilesAPI) Export(ctx context.Context, path, dest string, opts ...caopts.FilesExportOption) (<-chan coreiface.FilesExportResult, error) {
+	settings, err := caopts.FilesExportOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	n := api.node
+	if n.FilesRoot == nil {
+		return nil, errNoFilesRoot
+	}
+	if !filepath.IsAbs(dest) {
+		return nil, errors.New("the export destination must be an absolute path")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var events <-chan corefiles.Event
+	if settings.Sync {
+		// watch before the first sync, not to miss the changes made
+		// meanwhile
+		events = n.FilesEvents.Watch(ctx)
+	}
+
+	exporter := corefiles.NewExporter(n.FilesRoot, path, dest)
+	out := make(chan coreiface.FilesExportResult)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		for {
+			res, err := exporter.Sync(ctx)
+			select {
+			case out <- coreiface.FilesExportResult{Written: res.Written, Removed: res.Removed, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if events == nil {
+				return
+			}
+
+			if _, ok := <-events; !ok {
+				return
+			}
+			// the changes often come in bursts, sync once for all the
+			// changes received
+			for pending := true; pending; {
+				select {
+				case _, ok := <-events:
+					if !ok {
+						return
+					}
+				default:
+					pending = false
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (api *FilesAPI) Chmod(ctx context.Context, path string, mode uint32) error {
+	n := api.node
+	if n.FilesRoot == nil {
+		return errNoFilesRoot
+	}
+	n.FilesLock.RLock()
+	defer n.FilesLock.RUnlock()
+	if err := corefiles.Chmod(n.FilesRoot, path, mode, !n.FilesFlusher.WriteBack()); err != nil {
+		return err
+	}
+	n.FilesEvents.NotifyChange(n.FilesRoot, corefiles.OpChmod, path, "")
+	n.FilesFlusher.Changed()
+	return nil
+}
+
+func (api *FilesAPI) Touch(ctx context.Context, path string, mtime time.Time) error {
+	n := api.node
+	if n.FilesRoot == nil {
+		return errNoFilesRoot
+	}
+	n.FilesLock.RLock()
+	defer n.FilesLock.RUnlock()
+	if err := corefiles.Touch(n.FilesRoot, path, mtime, !n.FilesFlusher.WriteBack()); err != nil {
+		return err
+	}
+	corefiles.AutoShardParents(ctx, n.FilesRoot, n.DAG, n.FilesShardSize, path)
+	n.FilesEvents.NotifyChange(n.FilesRoot, corefiles.OpTouch, path, "")
+	n.FilesFlusher.Changed()
+	return nil
+}
+
+func (api *FilesAPI) Apply(ctx context.Context, ops []coreiface.FilesOp) (coreiface.ResolvedPath, error) {
+	n := api.node
+	if n.FilesRoot == nil {
+		return nil, errNoFilesRoot
+	}
+
+	fops := make([]corefiles.Op, len(ops))
+	for i, op := range ops {
+		fops[i] = corefiles.Op{Op: op.Op, Path: op.Path, From: op.From, Data: op.Data}
+	}
+	root, err := corefiles.Apply(ctx, n.FilesRoot, &n.FilesLock, n.DAG, fops, n.FilesShardSize)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range ops {
+		n.FilesEvents.NotifyChange(n.FilesRoot, op.Op, op.Path, op.From)
+	}
+	return coreiface.IpfsPath(root.Cid()), nil
+}
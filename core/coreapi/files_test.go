@@ -0,0 +1,167 @@
+package coreapi_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	opt "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+func TestFilesWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nd, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wctx, wcancel := context.WithCancel(ctx)
+	events, err := api.Files().Watch(wctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd.FilesEvents.Notify(corefiles.Event{Op: corefiles.OpMove, Path: "/b", From: "/a"})
+
+	select {
+	case ev := <-events:
+		if ev.Op != corefiles.OpMove || ev.Path != "/b" || ev.From != "/a" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+	}
+
+	wcancel()
+	for range events {
+	}
+}
+
+func TestFilesChmodTouch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nd, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Unix(1500000000, 0)
+	if err := api.Files().Touch(ctx, "/file", mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Files().Chmod(ctx, "/file", 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	fsn, err := mfs.Lookup(nd.FilesRoot, "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := fsn.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := corefiles.ReadMetadata(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Mode != 0640 || !md.Mtime.Equal(mtime) {
+		t.Fatalf("unexpected metadata %+v", md)
+	}
+
+	if err := api.Files().Chmod(ctx, "/", 0755); err == nil {
+		t.Fatal("expected setting the mode of the root to fail")
+	}
+}
+
+func TestFilesApply(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nd, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := api.Files().Apply(ctx, []coreiface.FilesOp{
+		{Op: corefiles.OpWrite, Path: "/a/b", Data: strings.NewReader("hello")},
+		{Op: corefiles.OpWrite, Path: "/c", Data: strings.NewReader("world")},
+		{Op: corefiles.OpMove, From: "/c", Path: "/a/c"},
+		{Op: corefiles.OpRemove, Path: "/a/b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rnd, err := nd.FilesRoot.GetDirectory().GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rnd.Cid().Equals(root.Cid()) {
+		t.Fatalf("expected the root %s, got %s", root.Cid(), rnd.Cid())
+	}
+	if _, err := mfs.Lookup(nd.FilesRoot, "/a/c"); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/a/b", "/c"} {
+		if _, err := mfs.Lookup(nd.FilesRoot, p); err == nil {
+			t.Fatalf("expected %s to be removed", p)
+		}
+	}
+
+	// a failing batch changes nothing
+	_, err = api.Files().Apply(ctx, []coreiface.FilesOp{
+		{Op: corefiles.OpWrite, Path: "/d", Data: strings.NewReader("d")},
+		{Op: corefiles.OpRemove, Path: "/missing/e"},
+	})
+	if err == nil {
+		t.Fatal("expected the batch to fail")
+	}
+	if _, err := mfs.Lookup(nd.FilesRoot, "/d"); err == nil {
+		t.Fatal("expected the failed batch not to be applied")
+	}
+}
+
+func TestFilesStat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = api.Files().Apply(ctx, []coreiface.FilesOp{
+		{Op: corefiles.OpWrite, Path: "/dir/file", Data: strings.NewReader("hello")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := api.Files().Stat(ctx, "/dir/file", opt.Files.WithLocal(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Type != "file" || stat.Size != 5 {
+		t.Fatalf("unexpected stat %+v", stat)
+	}
+	if stat.Locality == nil || !stat.Locality.Complete() {
+		t.Fatalf("expected the file to be local, got %+v", stat.Locality)
+	}
+
+	stat, err = api.Files().Stat(ctx, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Type != "directory" || stat.Locality != nil {
+		t.Fatalf("unexpected stat %+v", stat)
+	}
+}
@@ -0,0 +1,377 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	filestore "github.com/ipfs/go-ipfs/filestore"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	files "gx/ipfs/QmZMWMvWMVKCbHetJ4RgndbuEF1io2UpUxwQwtNjtYPzSC/go-ipfs-files"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+type FilestoreAPI CoreAPI
+
+var errVerifyOnly = errors.New("the Repair, Rechunk and Urls options only apply to Verify")
+
+// Ls lists the blocks of the filestore, sending their references on the
+// returned channel.
+func (api *FilestoreAPI) Ls(ctx context.Context, opts ...caopts.FilestoreListOption) (<-chan coreiface.FilestoreRef, error) {
+	settings, err := caopts.FilestoreListOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Repair || settings.Rechunk || settings.Urlstore {
+		return nil, errVerifyOnly
+	}
+
+	fs := api.node.Filestore
+	if fs == nil {
+		return nil, filestore.ErrFilestoreNotEnabled
+	}
+
+	next, err := listRefs(ctx, fs, settings, false)
+	if err != nil {
+		return nil, err
+	}
+	return sendRefs(ctx, settings, next, nil), nil
+}
+
+// Dups lists the blocks of the filestore also stored in the main blockstore,
+// sending their references on the returned channel.
+func (api *FilestoreAPI) Dups(ctx context.Context, opts ...caopts.FilestoreListOption) (<-chan coreiface.FilestoreRef, error) {
+	settings, err := caopts.FilestoreListOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Repair || settings.Rechunk || settings.Urlstore {
+		return nil, errVerifyOnly
+	}
+
+	fs := api.node.Filestore
+	if fs == nil {
+		return nil, filestore.ErrFilestoreNotEnabled
+	}
+
+	next, err := listRefs(ctx, fs, settings, false)
+	if err != nil {
+		return nil, err
+	}
+	return sendRefs(ctx, settings, next, func(r *filestore.ListRes) (bool, error) {
+		if !r.Key.Defined() {
+			return false, nil
+		}
+		return fs.MainBlockstore().Has(r.Key)
+	}), nil
+}
+
+// Verify verifies the blocks of the filestore, sending their references on
+// the returned channel. Stale references are dropped with the Repair option,
+// and the changed backing files added again with the Rechunk option.
+func (api *FilestoreAPI) Verify(ctx context.Context, opts ...caopts.FilestoreListOption) (<-chan coreiface.FilestoreRef, error) {
+	settings, err := caopts.FilestoreListOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := api.node.Filestore
+	if fs == nil {
+		return nil, filestore.ErrFilestoreNotEnabled
+	}
+
+	next, err := listRefs(ctx, fs, settings, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var repair func(r *filestore.ListRes) (bool, error)
+	if settings.Repair {
+		rechunked := make(map[string]bool)
+		repair = func(r *filestore.ListRes) (bool, error) {
+			if err := filestore.DropStale(fs, r); err != nil {
+				return true, err
+			}
+			if !settings.Rechunk || !r.Dropped || r.Status != filestore.StatusFileChanged ||
+				filestore.IsURL(r.FilePath) || rechunked[r.FilePath] {
+				return true, nil
+			}
+
+			rechunked[r.FilePath] = true
+			root, err := api.Rechunk(ctx, r.FilePath, caopts.Unixfs.Hash(r.Key.Prefix().MhType))
+			if err != nil {
+				return true, err
+			}
+			r.Rechunked = root.Cid()
+			return true, nil
+		}
+	}
+	return sendRefs(ctx, settings, next, repair), nil
+}
+
+// Rechunk adds the backing file at the path file, relative to the root of
+// the filestore, again with nocopy.
+func (api *FilestoreAPI) Rechunk(ctx context.Context, file string, opts ...caopts.UnixfsAddOption) (coreiface.ResolvedPath, error) {
+	fs := api.node.Filestore
+	if fs == nil {
+		return nil, filestore.ErrFilestoreNotEnabled
+	}
+
+	p := fs.FileManager().AbsPath(file)
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", file)
+	}
+	f, err := files.NewSerialFile(filepath.Base(p), p, false, stat)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	opts = append([]caopts.UnixfsAddOption{caopts.Unixfs.Nocopy(true), caopts.Unixfs.Pin(true)}, opts...)
+	return api.core().Unixfs().Add(ctx, f, opts...)
+}
+
+// listRefs returns an iterator over the blocks of the filestore selected by
+// settings, verifying them if verify is set. The blocks outside of the path
+// of the settings are skipped before being verified.
+func listRefs(ctx context.Context, fs *filestore.Filestore, settings *caopts.FilestoreListSettings, verify bool) (func() *filestore.ListRes, error) {
+	switch {
+	case settings.Urlstore:
+		return filestore.VerifyURLs(ctx, fs, settings.Urls...)
+	case len(settings.Cids) > 0:
+		cids := settings.Cids
+		return func() *filestore.ListRes {
+			if len(cids) == 0 {
+				return nil
+			}
+			c := cids[0]
+			cids = cids[1:]
+			if verify {
+				return filestore.Verify(fs, c)
+			}
+			return filestore.List(fs, c)
+		}, nil
+	case verify && settings.Path == "":
+		return filestore.VerifyAll(fs, settings.FileOrder)
+	}
+
+	next, err := filestore.ListAll(fs, settings.FileOrder)
+	if err != nil || !verify {
+		return next, err
+	}
+	return func() *filestore.ListRes {
+		for r := next(); r != nil; r = next() {
+			switch {
+			case r.Status != filestore.StatusOk:
+				return r
+			case inPath(r, settings.Path):
+				return filestore.Verify(fs, r.Key)
+			}
+		}
+		return nil
+	}, nil
+}
+
+func inPath(r *filestore.ListRes, prefix string) bool {
+	return strings.HasPrefix(r.FilePath, prefix)
+}
+
+// sendRefs sends the references returned by next which match the filters of
+// settings on the returned channel. visit is called with each of them if set,
+// and returns whether to send the reference, or an error sent along with it.
+func sendRefs(ctx context.Context, settings *caopts.FilestoreListSettings, next func() *filestore.ListRes, visit func(r *filestore.ListRes) (bool, error)) <-chan coreiface.FilestoreRef {
+	status := make(map[string]bool, len(settings.Status))
+	for _, s := range settings.Status {
+		status[s] = true
+	}
+
+	out := make(chan coreiface.FilestoreRef)
+	go func() {
+		defer close(out)
+
+		for r := next(); r != nil; r = next() {
+			if len(status) > 0 && !status[r.Status.String()] {
+				continue
+			}
+			if r.Status != filestore.StatusOtherError && !inPath(r, settings.Path) {
+				continue
+			}
+
+			ref := filestoreRef(r)
+			if visit != nil {
+				send, err := visit(r)
+				if err != nil {
+					ref.Err = err
+				} else if !send {
+					continue
+				} else {
+					ref = filestoreRef(r)
+				}
+			}
+
+			select {
+			case out <- ref:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Materialize copies the leaves of the file at p stored in the filestore into
+// the repo, sending the references removed on the returned channel.
+func (api *FilestoreAPI) Materialize(ctx context.Context, p coreiface.Path) (<-chan coreiface.FilestoreRef, error) {
+	fs := api.node.Filestore
+	if fs == nil {
+		return nil, filestore.ErrFilestoreNotEnabled
+	}
+
+	return api.moveLeaves(ctx, p, func(c cid.Cid, offset uint64) (*filestore.ListRes, error) {
+		if has, err := fs.FileManager().Has(c); err != nil || !has {
+			return nil, err
+		}
+		return filestore.Materialize(fs, c)
+	})
+}
+
+// Dematerialize replaces the leaves of the file at p stored in the repo with
+// references to file, sending the references added on the returned channel.
+func (api *FilestoreAPI) Dematerialize(ctx context.Context, p coreiface.Path, file string) (<-chan coreiface.FilestoreRef, error) {
+	fs := api.node.Filestore
+	if fs == nil {
+		return nil, filestore.ErrFilestoreNotEnabled
+	}
+
+	return api.moveLeaves(ctx, p, func(c cid.Cid, offset uint64) (*filestore.ListRes, error) {
+		if has, err := fs.MainBlockstore().Has(c); err != nil || !has {
+			return nil, err
+		}
+		return filestore.Dematerialize(fs, c, file, offset)
+	})
+}
+
+// moveLeaves calls move with the raw leaves of the file at p and their
+// offset, sending the references it returns on the returned channel. move
+// returns a nil ListRes for the leaves it skips.
+func (api *FilestoreAPI) moveLeaves(ctx context.Context, p coreiface.Path, move func(c cid.Cid, offset uint64) (*filestore.ListRes, error)) (<-chan coreiface.FilestoreRef, error) {
+	nd, err := api.core().ResolveNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan coreiface.FilestoreRef)
+	go func() {
+		defer close(out)
+
+		err := fileLeaves(ctx, api.dag, nd, 0, func(c cid.Cid, offset uint64) error {
+			unlock := api.node.Blockstore.PinLock()
+			r, err := move(c, offset)
+			unlock.Unlock()
+			if r == nil && err == nil {
+				return nil
+			}
+
+			var ref coreiface.FilestoreRef
+			if r != nil {
+				ref = filestoreRef(r)
+			} else {
+				ref.Cid = c
+			}
+			if err != nil {
+				ref.Err = err
+			}
+
+			select {
+			case out <- ref:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			select {
+			case out <- coreiface.FilestoreRef{Cid: nd.Cid(), Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+// fileLeaves calls f with the raw leaves of the unixfs file nd, starting at
+// offset in the file, and their offset. The raw leaves aren't fetched, their
+// size is known from their parent.
+func fileLeaves(ctx context.Context, ng ipld.NodeGetter, nd ipld.Node, offset uint64, f func(c cid.Cid, offset uint64) error) error {
+	switch nd := nd.(type) {
+	case *dag.RawNode:
+		return f(nd.Cid(), offset)
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return err
+		}
+		switch fsn.Type() {
+		case ft.TFile, ft.TRaw:
+		default:
+			return errNotAFile
+		}
+		links := nd.Links()
+		if fsn.NumChildren() != len(links) {
+			return errors.New("unixfs node has inconsistent block sizes")
+		}
+
+		offset += uint64(len(fsn.Data()))
+		for i, l := range links {
+			if l.Cid.Type() == cid.Raw {
+				if err := f(l.Cid, offset); err != nil {
+					return err
+				}
+			} else {
+				child, err := l.GetNode(ctx, ng)
+				if err != nil {
+					return err
+				}
+				if err := fileLeaves(ctx, ng, child, offset, f); err != nil {
+					return err
+				}
+			}
+			offset += fsn.BlockSize(i)
+		}
+		return nil
+	default:
+		return errNotAFile
+	}
+}
+
+func (api *FilestoreAPI) core() coreiface.CoreAPI {
+	return (*CoreAPI)(api)
+}
+
+func filestoreRef(r *filestore.ListRes) coreiface.FilestoreRef {
+	ref := coreiface.FilestoreRef{
+		Cid:       r.Key,
+		Path:      r.FilePath,
+		Offset:    r.Offset,
+		Size:      r.Size,
+		Status:    r.Status.String(),
+		Dropped:   r.Dropped,
+		Rechunked: r.Rechunked,
+	}
+	if r.ErrorMsg != "" {
+		ref.Err = errors.New(r.ErrorMsg)
+	}
+	return ref
+}
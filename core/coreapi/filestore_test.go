@@ -0,0 +1,222 @@
+package coreapi_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	"github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	"github.com/ipfs/go-ipfs/filestore"
+	"github.com/ipfs/go-ipfs/keystore"
+	"github.com/ipfs/go-ipfs/repo"
+
+	posinfo "gx/ipfs/QmR6YMs8EkXQLXNwQKxLnQp2VBZSepoEJ8KCZAyanJHhJu/go-ipfs-posinfo"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	mdag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	datastore "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	syncds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+// makeFilestoreAPI returns a node with the filestore enabled, and the root of
+// its filestore.
+func makeFilestoreAPI(t *testing.T, ctx context.Context) (*core.IpfsNode, coreiface.CoreAPI, string) {
+	dir, err := ioutil.TempDir("", "coreapi-filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := config.Config{}
+	c.Identity = config.Identity{PeerID: testPeerID}
+	c.Experimental.FilestoreEnabled = true
+
+	ds := syncds.MutexWrap(datastore.NewMapDatastore())
+	fm := filestore.NewFileManager(ds, dir)
+	fm.AllowFiles = true
+
+	nd, err := core.NewNode(ctx, &core.BuildCfg{
+		Repo: &repo.Mock{
+			C: c,
+			D: ds,
+			K: keystore.NewMemKeystore(),
+			F: fm,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nd, coreapi.NewCoreAPI(nd), dir
+}
+
+// addNocopy writes a file of 10 blocks of 10 bytes at name under dir, and
+// adds references to its blocks to the filestore.
+func addNocopy(t *testing.T, nd *core.IpfsNode, dir, name string) []*mdag.RawNode {
+	buf := make([]byte, 100)
+	rand.Read(buf)
+	fname := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fname, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var leaves []*mdag.RawNode
+	for i := 0; i < 10; i++ {
+		leaf := mdag.NewRawNode(buf[i*10 : (i+1)*10])
+		err := nd.Filestore.Put(&posinfo.FilestoreNode{
+			PosInfo: &posinfo.PosInfo{FullPath: fname, Offset: uint64(i * 10)},
+			Node:    leaf,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves
+}
+
+func collectRefs(refs <-chan coreiface.FilestoreRef, err error) ([]coreiface.FilestoreRef, error) {
+	if err != nil {
+		return nil, err
+	}
+	var out []coreiface.FilestoreRef
+	for ref := range refs {
+		out = append(out, ref)
+	}
+	return out, nil
+}
+
+func TestFilestoreLsFilters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nd, api, dir := makeFilestoreAPI(t, ctx)
+	defer os.RemoveAll(dir)
+
+	addNocopy(t, nd, dir, "a/file")
+	leaves := addNocopy(t, nd, dir, "b/file")
+
+	refs, err := collectRefs(api.Filestore().Ls(ctx, options.Filestore.Path("a/")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 10 {
+		t.Fatalf("expected the 10 blocks of a/file, got %d", len(refs))
+	}
+	for _, ref := range refs {
+		if ref.Path != "a/file" || ref.Status != "ok" {
+			t.Fatalf("unexpected reference %+v", ref)
+		}
+	}
+
+	if err := nd.Filestore.MainBlockstore().Put(leaves[2]); err != nil {
+		t.Fatal(err)
+	}
+	refs, err = collectRefs(api.Filestore().Dups(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || !refs[0].Cid.Equals(leaves[2].Cid()) {
+		t.Fatalf("expected the block copied to the repo to be a dup, got %v", refs)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "b/file"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	refs, err = collectRefs(api.Filestore().Verify(ctx, options.Filestore.Status("changed")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 10 {
+		t.Fatalf("expected the 10 blocks of b/file to be changed, got %d", len(refs))
+	}
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref.Path, "b/") || ref.Err == nil {
+			t.Fatalf("unexpected reference %+v", ref)
+		}
+	}
+
+	if _, err := api.Filestore().Ls(ctx, options.Filestore.Repair(true)); err == nil {
+		t.Fatal("expected the repair of a listing to be refused")
+	}
+}
+
+func TestFilestoreRechunk(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, api, dir := makeFilestoreAPI(t, ctx)
+	defer os.RemoveAll(dir)
+
+	fname := filepath.Join(dir, "file")
+	data := make([]byte, 1000)
+	rand.Read(data)
+	if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	root, err := api.Filestore().Rechunk(ctx, "file", options.Unixfs.Chunker("size-100"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the file changes, the first block is kept
+	rand.Read(data[100:])
+	data = append(data, data[:300]...)
+	if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := collectRefs(api.Filestore().Verify(ctx, options.Filestore.Rechunk(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dropped int
+	var rechunked []coreiface.FilestoreRef
+	for _, ref := range refs {
+		if ref.Dropped {
+			dropped++
+		}
+		if ref.Rechunked.Defined() {
+			rechunked = append(rechunked, ref)
+		}
+	}
+	if dropped != 9 {
+		t.Fatalf("expected the 9 changed blocks to be dropped, got %d", dropped)
+	}
+	if len(rechunked) != 1 || rechunked[0].Status != "changed" || !rechunked[0].Dropped {
+		t.Fatalf("expected the file to be rechunked once, got %v", rechunked)
+	}
+	if rechunked[0].Rechunked.Equals(root.Cid()) {
+		t.Fatal("expected a new root for the new contents of the file")
+	}
+
+	refs, err = collectRefs(api.Filestore().Verify(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range refs {
+		if ref.Status != "ok" {
+			t.Fatalf("expected the references to be repaired, got %+v", ref)
+		}
+	}
+
+	f, err := api.Unixfs().Get(ctx, coreiface.IpfsPath(rechunked[0].Rechunked))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Fatal("expected the new contents of the file to be read from the filestore")
+	}
+}
@@ -0,0 +1,132 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+)
+
+// healthKey is the key of the datastore read to check that the repo is
+// accessible. It needn't exist.
+var healthKey = ds.NewKey("/local/health")
+
+// HealthAPI checks the health of the node, for the probes of orchestrators
+// and load balancers.
+type HealthAPI CoreAPI
+
+// Check checks the health of the node. The node is live if its repo is
+// accessible, and ready if it is also connected with the network, has peers
+// in its DHT, and doesn't hold the writes with GCLock. The network checks
+// pass when the node is offline.
+func (api *HealthAPI) Check(ctx context.Context) (*coreiface.Health, error) {
+	repo := api.checkRepo()
+	out := &coreiface.Health{
+		Live: repo.OK,
+		Checks: []coreiface.HealthCheck{
+			repo,
+			api.checkBootstrap(),
+			api.checkDHT(),
+			api.checkGC(),
+		},
+	}
+
+	out.Ready = true
+	for _, c := range out.Checks {
+		out.Ready = out.Ready && c.OK
+	}
+	return out, nil
+}
+
+func (api *HealthAPI) checkRepo() coreiface.HealthCheck {
+	c := coreiface.HealthCheck{Name: "repo"}
+	if _, err := api.node.Repo.Config(); err != nil {
+		c.Message = fmt.Sprintf("reading the config: %s", err)
+		return c
+	}
+	if _, err := api.node.Repo.Datastore().Has(healthKey); err != nil {
+		c.Message = fmt.Sprintf("reading the datastore: %s", err)
+		return c
+	}
+	c.OK = true
+	c.Message = "accessible"
+	return c
+}
+
+// checkBootstrap passes once the node is connected with any peer, the
+// bootstrap peers or those found through them, or if it has no bootstrap
+// peers to connect with.
+func (api *HealthAPI) checkBootstrap() coreiface.HealthCheck {
+	c := coreiface.HealthCheck{Name: "bootstrap"}
+	n := api.node
+	if !n.OnlineMode() {
+		c.OK = true
+		c.Message = "offline"
+		return c
+	}
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	bootstrap, err := cfg.BootstrapPeers()
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+
+	// the bootstrap list has an address per line, several for some peers
+	ids := make(map[peer.ID]bool)
+	connected := 0
+	for _, bp := range bootstrap {
+		if ids[bp.ID()] {
+			continue
+		}
+		ids[bp.ID()] = true
+		if n.PeerHost.Network().Connectedness(bp.ID()) == inet.Connected {
+			connected++
+		}
+	}
+	peers := len(n.PeerHost.Network().Peers())
+
+	c.OK = peers > 0 || len(ids) == 0
+	c.Message = fmt.Sprintf("connected with %d peers, %d of %d bootstrap peers", peers, connected, len(ids))
+	return c
+}
+
+// checkDHT passes once peers speaking the DHT protocol, which make up its
+// routing table, are connected, or if the node doesn't route with the DHT.
+func (api *HealthAPI) checkDHT() coreiface.HealthCheck {
+	c := coreiface.HealthCheck{Name: "dht"}
+	if !api.node.OnlineMode() || api.node.DHT == nil {
+		c.OK = true
+		c.Message = "not used"
+		return c
+	}
+
+	peers := (*StatsAPI)(api).dhtStats().Peers
+	c.OK = peers > 0
+	c.Message = fmt.Sprintf("%d peers in the routing table", peers)
+	return c
+}
+
+// checkGC fails while GCLock is held or wanted, which blocks the writes. The
+// garbage collections run concurrently with the writes, so the node stays
+// ready during them.
+func (api *HealthAPI) checkGC() coreiface.HealthCheck {
+	c := coreiface.HealthCheck{Name: "gc", OK: true, Message: "idle"}
+	bs := api.node.Blockstore
+	if bs.GCRequested() {
+		c.OK = false
+		c.Message = "locked"
+	} else if tbs, ok := bs.(*gc.TrackingBlockstore); ok && tbs.Collecting() {
+		c.Message = "running"
+	}
+	return c
+}
@@ -0,0 +1,57 @@
+package coreapi_test
+
+import (
+	"context"
+	"testing"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+)
+
+func TestHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nds, apis, err := makeAPISwarm(ctx, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := apis[0]
+
+	check := func(name string, h *coreiface.Health) coreiface.HealthCheck {
+		t.Helper()
+		for _, c := range h.Checks {
+			if c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("expected the %s check, got %v", name, h.Checks)
+		return coreiface.HealthCheck{}
+	}
+
+	h, err := api.Health().Check(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Live || !h.Ready {
+		t.Fatalf("expected the offline node to be live and ready, got %+v", h)
+	}
+	if c := check("bootstrap", h); !c.OK || c.Message != "offline" {
+		t.Fatalf("expected the bootstrap check to pass offline, got %+v", c)
+	}
+	if c := check("dht", h); !c.OK {
+		t.Fatalf("expected the dht check to pass offline, got %+v", c)
+	}
+
+	unlocker := nds[0].Blockstore.GCLock()
+	h, err = api.Health().Check(ctx)
+	unlocker.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Live || h.Ready {
+		t.Fatalf("expected the node to be live but not ready under GCLock, got %+v", h)
+	}
+	if c := check("gc", h); c.OK || c.Message != "locked" {
+		t.Fatalf("expected the gc check to fail under GCLock, got %+v", c)
+	}
+}
@@ -0,0 +1,119 @@
+package coreapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	tracing "github.com/ipfs/go-ipfs/core/tracing"
+
+	prometheus "gx/ipfs/QmTQuFQWHAWy4wMH6ZyPfGiawA5u9T8rs79FENoV8yXaoS/client_golang/prometheus"
+)
+
+// Errors reported by the metrics of the calls, the others being reported as
+// errOther.
+const (
+	errNone     = ""
+	errCanceled = "canceled"
+	errTimeout  = "timeout"
+	errOffline  = "offline"
+	errOther    = "other"
+)
+
+type apiMetrics struct {
+	calls    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+var (
+	callMetricsOnce sync.Once
+	callMetrics     *apiMetrics
+)
+
+// getMetrics returns the metrics of the calls, registered with the default
+// prometheus registry on first use, nil if they can't be.
+func getMetrics() *apiMetrics {
+	callMetricsOnce.Do(func() {
+		m, err := newAPIMetrics()
+		if err != nil {
+			log.Errorf("registering the metrics of the CoreAPI: %s", err)
+			return
+		}
+		callMetrics = m
+	})
+	return callMetrics
+}
+
+func newAPIMetrics() (*apiMetrics, error) {
+	calls := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ipfs",
+			Subsystem: "coreapi",
+			Name:      "calls_total",
+			Help:      "Number of calls of the CoreAPI by method and error, empty for the calls which succeeded.",
+		},
+		[]string{"method", "error"},
+	)
+	if err := prometheus.Register(calls); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			calls = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			return nil, err
+		}
+	}
+
+	duration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ipfs",
+			Subsystem: "coreapi",
+			Name:      "call_duration_seconds",
+			Help:      "Latency of the calls of the CoreAPI by method, in seconds.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 10),
+		},
+		[]string{"method"},
+	)
+	if err := prometheus.Register(duration); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			duration = are.ExistingCollector.(*prometheus.HistogramVec)
+		} else {
+			return nil, err
+		}
+	}
+
+	return &apiMetrics{calls: calls, duration: duration}, nil
+}
+
+// errorLabel returns the error of err reported by the metrics.
+func errorLabel(err error) string {
+	switch err {
+	case nil:
+		return errNone
+	case context.Canceled:
+		return errCanceled
+	case context.DeadlineExceeded:
+		return errTimeout
+	case coreiface.ErrOffline:
+		return errOffline
+	default:
+		return errOther
+	}
+}
+
+// instrument starts the span of the API method, e.g. "Unixfs.Add", a child
+// of the span of ctx if it has one. The function returned finishes it with
+// the error of the call, and records the call in the metrics:
+//
+//	ctx, done := instrument(ctx, "Unixfs.Add")
+//	defer done(&err)
+func instrument(ctx context.Context, method string) (context.Context, func(*error)) {
+	start := time.Now()
+	ctx, finish := tracing.Start(ctx, "CoreAPI."+method)
+	return ctx, func(err *error) {
+		finish(err)
+		if m := getMetrics(); m != nil {
+			m.calls.WithLabelValues(method, errorLabel(*err)).Inc()
+			m.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		}
+	}
+}
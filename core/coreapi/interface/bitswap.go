@@ -0,0 +1,54 @@
+package iface
+
+import (
+	"context"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+// WantlistEntry is a block on a bitswap wantlist
+type WantlistEntry struct {
+	Cid cid.Cid
+
+	// Age is how long the block has been on the wantlist, as observed by the
+	// node polling the wantlists
+	Age time.Duration
+}
+
+// BitswapLedger describes the exchanges with a peer
+type BitswapLedger struct {
+	Peer peer.ID
+
+	// DebtRatio is the ratio of the bytes sent to the peer over the bytes
+	// received from it, high for the peers taking without giving back
+	DebtRatio float64
+
+	// BytesSent and BytesReceived are the sizes of the blocks exchanged
+	BytesSent     uint64
+	BytesReceived uint64
+
+	// The blocks and messages exchanged since the peer connected
+	BlocksSent       uint64
+	BlocksReceived   uint64
+	MessagesSent     uint64
+	MessagesReceived uint64
+}
+
+// BitswapAPI specifies the interface to the bitswap exchange
+type BitswapAPI interface {
+	// Wantlist returns the blocks the node is currently looking for
+	Wantlist(context.Context) ([]WantlistEntry, error)
+
+	// WantlistForPeer returns the blocks the given peer is currently asking
+	// the node for
+	WantlistForPeer(context.Context, peer.ID) ([]WantlistEntry, error)
+
+	// Ledger returns the ledger of the exchanges with the given peer
+	Ledger(context.Context, peer.ID) (*BitswapLedger, error)
+
+	// Ledgers returns the ledgers of the peers the node exchanges blocks
+	// with
+	Ledgers(context.Context) ([]*BitswapLedger, error)
+}
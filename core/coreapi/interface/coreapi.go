@@ -40,6 +40,47 @@ type CoreAPI interface {
 	// PubSub returns an implementation of PubSub API
 	PubSub() PubSubAPI
 
+	// Ping returns an implementation of Ping API
+	Ping() PingAPI
+
+	// Stats returns an implementation of Stats API
+	Stats() StatsAPI
+
+	// Repo returns an implementation of Repo API
+	Repo() RepoAPI
+
+	// Files returns an implementation of Files API
+	Files() FilesAPI
+
+	// Bitswap returns an implementation of Bitswap API
+	Bitswap() BitswapAPI
+
+	// Reprovider returns an implementation of Reprovider API
+	Reprovider() ReproviderAPI
+
+	// Filestore returns an implementation of Filestore API
+	Filestore() FilestoreAPI
+
+	// P2P returns an implementation of P2P API
+	P2P() P2PAPI
+
+	// Log returns an implementation of Log API
+	Log() LogAPI
+
+	// Health returns an implementation of Health API
+	Health() HealthAPI
+
+	// WithSession returns an implementation of Core API whose reads share a
+	// single bitswap session, discovering the peers providing the data once
+	// for a series of related operations. The session lasts until the context
+	// is canceled.
+	WithSession(context.Context) CoreAPI
+
+	// WithPriority returns an implementation of Core API whose reads fetch
+	// the blocks with priority p: the providers send the blocks wanted with
+	// a higher priority first
+	WithPriority(p Priority) CoreAPI
+
 	// ResolvePath resolves the path using Unixfs resolver
 	ResolvePath(context.Context, Path) (ResolvedPath, error)
 
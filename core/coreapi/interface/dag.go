@@ -6,6 +6,7 @@ import (
 
 	"github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 )
 
@@ -26,6 +27,56 @@ type DagBatch interface {
 	Commit(ctx context.Context) error
 }
 
+// DagRef is a link between two nodes, as returned by DagAPI.Refs
+type DagRef struct {
+	// From is the CID of the node containing the link
+	From cid.Cid
+
+	// To is the CID of the linked node
+	To cid.Cid
+
+	// Name is the name of the link
+	Name string
+
+	// Err is set when the traversal failed. It is the last value sent.
+	Err error
+}
+
+// DagLocality describes how much of a DAG is stored locally
+type DagLocality struct {
+	// LocalBlocks and LocalBytes are the number and total size of the
+	// distinct blocks of the DAG stored locally
+	LocalBlocks uint64
+	LocalBytes  uint64
+
+	// MissingBlocks is the number of blocks missing locally linked to by the
+	// blocks stored, the blocks below them being unknown
+	MissingBlocks uint64
+
+	// MissingBytes is the size of the missing blocks and of the blocks below
+	// them as recorded in the links to them. It is a lower bound, as some
+	// formats, such as dag-cbor, don't record the sizes of the linked DAGs.
+	MissingBytes uint64
+}
+
+// Complete returns true if the whole DAG is stored locally
+func (l *DagLocality) Complete() bool {
+	return l.MissingBlocks == 0
+}
+
+// DagStat describes a DAG, as returned by DagAPI.Stat
+type DagStat struct {
+	// Cid is the CID of the root of the DAG
+	Cid cid.Cid
+
+	// Size is the size of the DAG as recorded in its root, 0 when the root
+	// isn't available locally and Locality was requested
+	Size uint64
+
+	// Locality is set when requested with options.Dag.WithLocal
+	Locality *DagLocality
+}
+
 // DagAPI specifies the interface to IPLD
 type DagAPI interface {
 	DagOps
@@ -36,6 +87,16 @@ type DagAPI interface {
 	// Tree returns list of paths within a node specified by the path.
 	Tree(ctx context.Context, path Path, opts ...options.DagTreeOption) ([]Path, error)
 
+	// Refs lists the links of the node specified by the path, and of the
+	// nodes below it up to the depth set with options.Dag.MaxDepth. Links are
+	// sent as they are found, while the DAG is being fetched.
+	Refs(ctx context.Context, path Path, opts ...options.DagRefsOption) (<-chan DagRef, error)
+
+	// Stat returns the size of the DAG specified by the path, and how much
+	// of it is stored locally if requested with options.Dag.WithLocal,
+	// without fetching the blocks missing
+	Stat(ctx context.Context, path Path, opts ...options.DagStatOption) (*DagStat, error)
+
 	// Batch creates new DagBatch
 	Batch(ctx context.Context) DagBatch
 }
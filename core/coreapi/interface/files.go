@@ -0,0 +1,118 @@
+package iface
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// FilesEvent describes a change of the mutable filesystem, MFS
+type FilesEvent struct {
+	// Op is the operation: write, mkdir, cp, mv, rm, chcid, chmod, touch,
+	// or publish when a new root was published
+	Op string
+
+	// Path is the path changed, the destination of moves and copies
+	Path string
+
+	// From is the source of moves
+	From string
+
+	// Cid is the new CID of Path, undefined after removals
+	Cid cid.Cid
+
+	// Missed is the number of events missed before this one because they
+	// weren't received fast enough. MFS should be scanned again after
+	// missing events.
+	Missed uint64
+}
+
+// FilesStat describes an entry of MFS, as returned by FilesAPI.Stat
+type FilesStat struct {
+	// Cid is the CID of the entry
+	Cid cid.Cid
+
+	// Type is "file" or "directory"
+	Type string
+
+	// Size is the size of the content of files, and CumulativeSize the size
+	// of the DAG of the entry
+	Size           uint64
+	CumulativeSize uint64
+
+	// Blocks is the number of links of the entry
+	Blocks int
+
+	// Mode and Mtime are the metadata of the entry, see FilesAPI.Chmod and
+	// FilesAPI.Touch, unset when zero
+	Mode  uint32
+	Mtime time.Time
+
+	// Locality is set when requested with options.Files.WithLocal
+	Locality *DagLocality
+}
+
+// FilesExportResult counts the changes written to the local filesystem by
+// FilesAPI.Export
+type FilesExportResult struct {
+	// Written is the number of files and directories written
+	Written uint64
+
+	// Removed is the number of files and directories removed as they were
+	// removed from MFS
+	Removed uint64
+
+	// Err is set when writing the changes failed
+	Err error
+}
+
+// FilesOp is an operation of a batch applied by FilesAPI.Apply
+type FilesOp struct {
+	// Op is the operation: write, mv or rm
+	Op string
+
+	// Path is the file written, the destination of moves or the entry
+	// removed
+	Path string
+
+	// From is the source of moves
+	From string
+
+	// Data is the new content of the file written, created with its parents
+	// if missing
+	Data io.Reader
+}
+
+// FilesAPI specifies the interface to the mutable filesystem, MFS
+type FilesAPI interface {
+	// Watch returns a channel receiving the changes of MFS until the context
+	// is canceled
+	Watch(context.Context) (<-chan FilesEvent, error)
+
+	// Stat returns the description of the entry at the path, and how much of
+	// its DAG is stored locally if requested with options.Files.WithLocal
+	Stat(ctx context.Context, path string, opts ...options.FilesStatOption) (*FilesStat, error)
+
+	// Chmod sets the permission bits of the mode of the entry at the path,
+	// stored in its unixfs node
+	Chmod(ctx context.Context, path string, mode uint32) error
+
+	// Touch sets the modification time of the entry at the path, stored in
+	// its unixfs node, creating an empty file if the path doesn't exist
+	Touch(ctx context.Context, path string, mtime time.Time) error
+
+	// Export writes the entry at the path to the local path dest, a
+	// directory for directories, sending the changes written on the returned
+	// channel. With options.Files.Sync, the changes of the entry are written
+	// until the context is canceled, leaving alone the local files which
+	// weren't exported.
+	Export(ctx context.Context, path, dest string, opts ...options.FilesExportOption) (<-chan FilesExportResult, error)
+
+	// Apply applies the operations in order and publishes a single new root,
+	// which it returns. Either all the operations are applied or none is.
+	Apply(ctx context.Context, ops []FilesOp) (ResolvedPath, error)
+}
@@ -0,0 +1,86 @@
+package iface
+
+import (
+	"context"
+
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// FilestoreRef describes a block of the filestore, stored outside of the
+// repo in a file or at a URL
+type FilestoreRef struct {
+	Cid cid.Cid
+
+	// Path is the path of the backing file, relative to the root of the
+	// filestore, or the URL of the block
+	Path string
+
+	// Offset and Size locate the data of the block in the backing file
+	Offset uint64
+	Size   uint64
+
+	// Status is the state of the block: "ok", "changed" if the contents
+	// of the backing file have changed, "no-file" if the backing file is
+	// gone, "error" if it couldn't be read, "missing" if the block isn't in
+	// the filestore and "ERROR" if the reference is corrupt
+	Status string
+
+	// Err is set when Status isn't "ok"
+	Err error
+
+	// Dropped is set when the reference was removed from the filestore
+	Dropped bool
+
+	// Rechunked is the root of the file added again from the new contents
+	// of the backing file, with the Rechunk option. It is only set on the
+	// first reference dropped of each file
+	Rechunked cid.Cid
+}
+
+// FilestoreAPI specifies the interface to the filestore, which stores the
+// blocks added with nocopy as references to their backing files
+type FilestoreAPI interface {
+	// Ls lists the blocks of the filestore without reading their backing
+	// files. The references are sent on the returned channel as they are
+	// read, closed once all of them were listed or the context is canceled.
+	Ls(context.Context, ...options.FilestoreListOption) (<-chan FilestoreRef, error)
+
+	// Dups lists the blocks of the filestore which are also stored in the
+	// repo, like Ls.
+	Dups(context.Context, ...options.FilestoreListOption) (<-chan FilestoreRef, error)
+
+	// Verify checks that the blocks of the filestore can be read back from
+	// their backing files. The references are sent on the returned channel,
+	// closed once all of them were verified or the context is canceled.
+	//
+	// With the Repair option, the references whose backing file is gone or
+	// has changed are removed from the filestore. With the Urls option, the
+	// blocks stored at URLs are fetched again from their origin, reporting
+	// the content which has changed or disappeared upstream. With the
+	// Rechunk option, the backing files which have changed are also added
+	// again, see Rechunk.
+	Verify(context.Context, ...options.FilestoreListOption) (<-chan FilestoreRef, error)
+
+	// Rechunk adds the backing file at the given path, relative to the root
+	// of the filestore like the Path of the references, again with nocopy,
+	// so that the filestore references its current contents. The new root
+	// is pinned. The references to former contents of the file aren't
+	// removed, the Repair option of Verify removes them.
+	Rechunk(ctx context.Context, file string, opts ...options.UnixfsAddOption) (ResolvedPath, error)
+
+	// Materialize copies the blocks of the file at the given path which are
+	// stored in the filestore into the repo, and removes their references,
+	// so that the backing files can be deleted. The references removed are
+	// sent on the returned channel.
+	Materialize(context.Context, Path) (<-chan FilestoreRef, error)
+
+	// Dematerialize replaces the blocks of the file at the given path which
+	// are stored in the repo with references to the same data in a local
+	// file, given by its absolute path under the root of the filestore.
+	// Only the raw leaves of the file can be referenced, the data is
+	// verified before the blocks are removed. The references added are sent
+	// on the returned channel.
+	Dematerialize(ctx context.Context, p Path, file string) (<-chan FilestoreRef, error)
+}
@@ -0,0 +1,40 @@
+package iface
+
+import (
+	"context"
+)
+
+// HealthCheck is the result of one of the checks of the health of a node
+type HealthCheck struct {
+	// Name is the name of the check: "repo", "bootstrap", "dht" or "gc"
+	Name string
+
+	// OK tells whether the check passed
+	OK bool
+
+	// Message describes the state checked, or why the check failed
+	Message string
+}
+
+// Health describes the health of a node
+type Health struct {
+	// Live tells whether the node works at all, i.e. its repo is accessible.
+	// A node which isn't live should be restarted
+	Live bool
+
+	// Ready tells whether all the checks passed, i.e. the node can serve
+	// requests. A node which isn't ready should be sent no traffic
+	Ready bool
+
+	// Checks are the results of the checks, in the order they ran
+	Checks []HealthCheck
+}
+
+// HealthAPI specifies the interface to the health of the node
+type HealthAPI interface {
+	// Check checks the health of the node: the accessibility of its repo,
+	// its connectivity with the bootstrap peers, the readiness of the DHT and
+	// the state of the garbage collection, "idle", "running" or "locked"
+	// when the writes are held
+	Check(context.Context) (*Health, error)
+}
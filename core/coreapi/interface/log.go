@@ -0,0 +1,16 @@
+package iface
+
+import (
+	"context"
+)
+
+// LogAPI specifies the interface to the logging subsystems of the node
+type LogAPI interface {
+	// SetLevel changes the level of the log output of the subsystem, or of
+	// all subsystems if it is "*", with debug the most verbose and critical
+	// the least verbose
+	SetLevel(ctx context.Context, subsystem string, level string) error
+
+	// Subsystems returns the names of the logging subsystems, sorted
+	Subsystems(context.Context) ([]string, error)
+}
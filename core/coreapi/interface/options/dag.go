@@ -17,8 +17,21 @@ type DagTreeSettings struct {
 	Depth int
 }
 
+type DagRefsSettings struct {
+	MaxDepth    int
+	Unique      bool
+	UniqueEdges bool
+	Codecs      []uint64
+}
+
+type DagStatSettings struct {
+	WithLocal bool
+}
+
 type DagPutOption func(*DagPutSettings) error
 type DagTreeOption func(*DagTreeSettings) error
+type DagRefsOption func(*DagRefsSettings) error
+type DagStatOption func(*DagStatSettings) error
 
 func DagPutOptions(opts ...DagPutOption) (*DagPutSettings, error) {
 	options := &DagPutSettings{
@@ -51,6 +64,34 @@ func DagTreeOptions(opts ...DagTreeOption) (*DagTreeSettings, error) {
 	return options, nil
 }
 
+func DagRefsOptions(opts ...DagRefsOption) (*DagRefsSettings, error) {
+	options := &DagRefsSettings{
+		MaxDepth: 1,
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+func DagStatOptions(opts ...DagStatOption) (*DagStatSettings, error) {
+	options := &DagStatSettings{
+		WithLocal: false,
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
 type dagOpts struct{}
 
 var Dag dagOpts
@@ -93,3 +134,52 @@ func (dagOpts) Depth(depth int) DagTreeOption {
 		return nil
 	}
 }
+
+// MaxDepth is an option for Dag.Refs which specifies how deep below the given
+// node links are listed. Default is 1 (only the links of the node itself),
+// -1 means no depth limit
+func (dagOpts) MaxDepth(depth int) DagRefsOption {
+	return func(settings *DagRefsSettings) error {
+		settings.MaxDepth = depth
+		return nil
+	}
+}
+
+// Unique is an option for Dag.Refs which specifies whether each linked node
+// should only be listed once. Default is false
+func (dagOpts) Unique(unique bool) DagRefsOption {
+	return func(settings *DagRefsSettings) error {
+		settings.Unique = unique
+		return nil
+	}
+}
+
+// UniqueEdges is an option for Dag.Refs which specifies whether each link
+// (source, destination and name) should only be listed once. Unlike Unique,
+// a node linked from several places is listed once per parent. Default is
+// false
+func (dagOpts) UniqueEdges(unique bool) DagRefsOption {
+	return func(settings *DagRefsSettings) error {
+		settings.UniqueEdges = unique
+		return nil
+	}
+}
+
+// Codecs is an option for Dag.Refs which restricts the listed links to the
+// ones pointing to nodes of the given multicodecs. The DAG is still traversed
+// through nodes of other codecs. Default is to list links to any codec
+func (dagOpts) Codecs(codecs ...uint64) DagRefsOption {
+	return func(settings *DagRefsSettings) error {
+		settings.Codecs = codecs
+		return nil
+	}
+}
+
+// WithLocal is an option for Dag.Stat which specifies whether to report how
+// much of the DAG is stored locally. Default is false
+func (dagOpts) WithLocal(withLocal bool) DagStatOption {
+	return func(settings *DagStatSettings) error {
+		settings.WithLocal = withLocal
+		return nil
+	}
+}
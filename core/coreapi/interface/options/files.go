@@ -0,0 +1,63 @@
+package options
+
+type FilesStatSettings struct {
+	WithLocal bool
+}
+
+type FilesExportSettings struct {
+	Sync bool
+}
+
+type FilesStatOption func(*FilesStatSettings) error
+type FilesExportOption func(*FilesExportSettings) error
+
+func FilesStatOptions(opts ...FilesStatOption) (*FilesStatSettings, error) {
+	options := &FilesStatSettings{
+		WithLocal: false,
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+func FilesExportOptions(opts ...FilesExportOption) (*FilesExportSettings, error) {
+	options := &FilesExportSettings{
+		Sync: false,
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+type filesOpts struct{}
+
+var Files filesOpts
+
+// WithLocal is an option for Files.Stat which specifies whether to report how
+// much of the DAG of the entry is stored locally. Default is false
+func (filesOpts) WithLocal(withLocal bool) FilesStatOption {
+	return func(settings *FilesStatSettings) error {
+		settings.WithLocal = withLocal
+		return nil
+	}
+}
+
+// Sync is an option for Files.Export which specifies whether to keep writing
+// the changes of the entry exported until the context is canceled. Default is
+// false
+func (filesOpts) Sync(sync bool) FilesExportOption {
+	return func(settings *FilesExportSettings) error {
+		settings.Sync = sync
+		return nil
+	}
+}
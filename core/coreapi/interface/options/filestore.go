@@ -0,0 +1,114 @@
+package options
+
+import (
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+type FilestoreListSettings struct {
+	Cids      []cid.Cid
+	FileOrder bool
+	Path      string
+	Status    []string
+	Repair    bool
+	Rechunk   bool
+	Urlstore  bool
+	Urls      []string
+}
+
+type FilestoreListOption func(*FilestoreListSettings) error
+
+func FilestoreListOptions(opts ...FilestoreListOption) (*FilestoreListSettings, error) {
+	options := &FilestoreListSettings{
+		FileOrder: false,
+		Repair:    false,
+		Rechunk:   false,
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+type filestoreOpts struct{}
+
+var Filestore filestoreOpts
+
+// Cids is an option for Filestore.Ls and Filestore.Verify which restricts the
+// listing to the given blocks. All the blocks of the filestore are listed by
+// default
+func (filestoreOpts) Cids(cids ...cid.Cid) FilestoreListOption {
+	return func(settings *FilestoreListSettings) error {
+		settings.Cids = append(settings.Cids, cids...)
+		return nil
+	}
+}
+
+// Path is an option for the listings of the filestore which only keeps the
+// blocks whose backing file or URL starts with prefix. The paths of the
+// backing files are relative to the root of the filestore
+func (filestoreOpts) Path(prefix string) FilestoreListOption {
+	return func(settings *FilestoreListSettings) error {
+		settings.Path = prefix
+		return nil
+	}
+}
+
+// Status is an option for the listings of the filestore which only keeps the
+// blocks in one of the given states, such as "ok" or "changed". Without
+// verification, the blocks are "ok" unless their reference is corrupt
+func (filestoreOpts) Status(status ...string) FilestoreListOption {
+	return func(settings *FilestoreListSettings) error {
+		settings.Status = append(settings.Status, status...)
+		return nil
+	}
+}
+
+// Urls is an option for Filestore.Verify which restricts the verification to
+// the blocks stored at the given URLs, or at any URL if none is given. The
+// content of each URL is fetched once to verify all its blocks
+func (filestoreOpts) Urls(urls ...string) FilestoreListOption {
+	return func(settings *FilestoreListSettings) error {
+		settings.Urlstore = true
+		settings.Urls = append(settings.Urls, urls...)
+		return nil
+	}
+}
+
+// FileOrder is an option for the listings of the filestore which lists the
+// blocks in the order of their backing files, reading each file sequentially
+// when verifying it. Default is false
+func (filestoreOpts) FileOrder(fileOrder bool) FilestoreListOption {
+	return func(settings *FilestoreListSettings) error {
+		settings.FileOrder = fileOrder
+		return nil
+	}
+}
+
+// Repair is an option for Filestore.Verify which removes the references
+// whose backing file is gone or has changed, so that the blocks can be added
+// again or fetched from the network. Default is false
+func (filestoreOpts) Repair(repair bool) FilestoreListOption {
+	return func(settings *FilestoreListSettings) error {
+		settings.Repair = repair
+		return nil
+	}
+}
+
+// Rechunk is an option for Filestore.Verify which, along with the removal of
+// the stale references like Repair, adds the backing files which have
+// changed again, so that their new contents can be read from the filestore.
+// The files are chunked anew, with the hash function of their former blocks.
+// Implies Repair. Default is false
+func (filestoreOpts) Rechunk(rechunk bool) FilestoreListOption {
+	return func(settings *FilestoreListSettings) error {
+		settings.Rechunk = rechunk
+		if rechunk {
+			settings.Repair = true
+		}
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package options
+
+import (
+	"crypto/tls"
+
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+)
+
+type P2PListenerSettings struct {
+	AllowCustomProtocol bool
+	ReportPeerID        bool
+
+	Token string
+	TLS   *tls.Config
+}
+
+type P2PCloseSettings struct {
+	All           bool
+	Protocol      *protocol.ID
+	ListenAddress ma.Multiaddr
+	TargetAddress ma.Multiaddr
+}
+
+type P2PListenerOption func(*P2PListenerSettings) error
+type P2PCloseOption func(*P2PCloseSettings) error
+
+func P2PListenerOptions(opts ...P2PListenerOption) (*P2PListenerSettings, error) {
+	options := &P2PListenerSettings{}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+func P2PCloseOptions(opts ...P2PCloseOption) (*P2PCloseSettings, error) {
+	options := &P2PCloseSettings{}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+type p2pOpts struct{}
+
+var P2P p2pOpts
+
+// AllowCustomProtocol is an option for P2P.Forward and P2P.Listen which
+// allows the protocol names outside of the /x/ namespace. Default is false
+func (p2pOpts) AllowCustomProtocol(allow bool) P2PListenerOption {
+	return func(settings *P2PListenerSettings) error {
+		settings.AllowCustomProtocol = allow
+		return nil
+	}
+}
+
+// ReportPeerID is an option for P2P.Listen which makes it send the base58 ID
+// of the remote peer, followed by a newline, to the target before the data
+// forwarded. Default is false
+func (p2pOpts) ReportPeerID(report bool) P2PListenerOption {
+	return func(settings *P2PListenerSettings) error {
+		settings.ReportPeerID = report
+		return nil
+	}
+}
+
+// Token is an option for P2P.Forward which makes the local clients send the
+// token, followed by a newline, before the data forwarded. Default is none
+func (p2pOpts) Token(token string) P2PListenerOption {
+	return func(settings *P2PListenerSettings) error {
+		settings.Token = token
+		return nil
+	}
+}
+
+// TLS is an option for P2P.Forward which makes the local clients connect with
+// TLS, with the config given, such as requiring their certificates. Default
+// is plain TCP
+func (p2pOpts) TLS(config *tls.Config) P2PListenerOption {
+	return func(settings *P2PListenerSettings) error {
+		settings.TLS = config
+		return nil
+	}
+}
+
+// All is an option for P2P.Close which closes all the listeners
+func (p2pOpts) All() P2PCloseOption {
+	return func(settings *P2PCloseSettings) error {
+		settings.All = true
+		return nil
+	}
+}
+
+// Protocol is an option for P2P.Close which closes the listeners of the
+// protocol
+func (p2pOpts) Protocol(proto protocol.ID) P2PCloseOption {
+	return func(settings *P2PCloseSettings) error {
+		settings.Protocol = &proto
+		return nil
+	}
+}
+
+// ListenAddress is an option for P2P.Close which closes the listeners of the
+// listen address
+func (p2pOpts) ListenAddress(addr ma.Multiaddr) P2PCloseOption {
+	return func(settings *P2PCloseSettings) error {
+		settings.ListenAddress = addr
+		return nil
+	}
+}
+
+// TargetAddress is an option for P2P.Close which closes the listeners of the
+// target address
+func (p2pOpts) TargetAddress(addr ma.Multiaddr) P2PCloseOption {
+	return func(settings *P2PCloseSettings) error {
+		settings.TargetAddress = addr
+		return nil
+	}
+}
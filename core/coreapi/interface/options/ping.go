@@ -0,0 +1,61 @@
+package options
+
+import (
+	"time"
+)
+
+type PingSettings struct {
+	Count    int
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+type PingOption func(*PingSettings) error
+
+func PingOptions(opts ...PingOption) (*PingSettings, error) {
+	options := &PingSettings{
+		Count:    10,
+		Interval: time.Second,
+		Timeout:  10 * time.Second,
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+type pingOpts struct{}
+
+var Ping pingOpts
+
+// Count is an option for Ping.Ping which specifies the number of pings to
+// send. Default is 10
+func (pingOpts) Count(count int) PingOption {
+	return func(settings *PingSettings) error {
+		settings.Count = count
+		return nil
+	}
+}
+
+// Interval is an option for Ping.Ping which specifies the time between two
+// pings. Default is 1 second
+func (pingOpts) Interval(interval time.Duration) PingOption {
+	return func(settings *PingSettings) error {
+		settings.Interval = interval
+		return nil
+	}
+}
+
+// Timeout is an option for Ping.Ping which specifies how long to wait for
+// each pong, and for the lookup of the peer's addresses. Default is 10
+// seconds
+func (pingOpts) Timeout(timeout time.Duration) PingOption {
+	return func(settings *PingSettings) error {
+		settings.Timeout = timeout
+		return nil
+	}
+}
@@ -0,0 +1,34 @@
+package options
+
+type StatsSettings struct {
+	SizeOnly bool
+}
+
+type StatsOption func(*StatsSettings) error
+
+func StatsOptions(opts ...StatsOption) (*StatsSettings, error) {
+	options := &StatsSettings{
+		SizeOnly: false,
+	}
+
+	for _, opt := range opts {
+		err := opt(options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+type statsOpts struct{}
+
+var Stats statsOpts
+
+// SizeOnly is an option for Stats.All which skips counting the objects in
+// the repo, which requires listing all of them. Default is false
+func (statsOpts) SizeOnly(sizeOnly bool) StatsOption {
+	return func(settings *StatsSettings) error {
+		settings.SizeOnly = sizeOnly
+		return nil
+	}
+}
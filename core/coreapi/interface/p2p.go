@@ -0,0 +1,95 @@
+package iface
+
+import (
+	"context"
+
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+)
+
+// P2PListener is a listener whose connections are forwarded
+type P2PListener struct {
+	Protocol protocol.ID
+
+	// ListenAddress is the local address of a forward, or the address of the
+	// node for the streams of the protocol
+	ListenAddress ma.Multiaddr
+
+	// TargetAddress is the address of the peer of a forward, or the local
+	// address the streams are forwarded to
+	TargetAddress ma.Multiaddr
+}
+
+// P2PStream is a connection being forwarded
+type P2PStream struct {
+	ID       uint64
+	Protocol protocol.ID
+
+	OriginAddress ma.Multiaddr
+	TargetAddress ma.Multiaddr
+}
+
+// P2PACL restricts the listeners of a protocol
+type P2PACL struct {
+	// Peers are the peers the streams are accepted from, and forwarded to,
+	// any peer if empty
+	Peers []peer.ID
+
+	// Ports are the ports the streams are forwarded to, any port if empty
+	Ports []int
+}
+
+// P2PAPI specifies the interface to the tunnels of TCP connections over
+// libp2p streams
+type P2PAPI interface {
+	// Forward forwards the connections accepted on the local address listen
+	// to the protocol of the peer target
+	Forward(ctx context.Context, proto protocol.ID, listen ma.Multiaddr, target peer.ID, opts ...options.P2PListenerOption) (P2PListener, error)
+
+	// Listen forwards the streams of the protocol to the local address
+	// target
+	Listen(ctx context.Context, proto protocol.ID, target ma.Multiaddr, opts ...options.P2PListenerOption) (P2PListener, error)
+
+	// Close stops the listeners matching the options, and returns their
+	// number. The streams they forward are left open
+	Close(context.Context, ...options.P2PCloseOption) (int, error)
+
+	// Ls returns the listeners
+	Ls(context.Context) ([]P2PListener, error)
+
+	// Streams returns the connections being forwarded
+	Streams(context.Context) ([]P2PStream, error)
+
+	// CloseStream closes the connection being forwarded of the given ID
+	CloseStream(ctx context.Context, id uint64) error
+
+	// SetStreamHandler handles the streams of the protocol with handler,
+	// replacing the handler previously set for it. The protocols of the node
+	// and of the listeners can't be taken over
+	SetStreamHandler(ctx context.Context, proto protocol.ID, handler inet.StreamHandler) error
+
+	// RemoveStreamHandler stops handling the streams of the protocol, set
+	// with SetStreamHandler
+	RemoveStreamHandler(ctx context.Context, proto protocol.ID) error
+
+	// StreamHandlers returns the protocols handled with SetStreamHandler
+	StreamHandlers(context.Context) ([]protocol.ID, error)
+
+	// SetACL restricts the listeners of the protocol with acl, closing
+	// those it doesn't allow, and saves it in the config
+	SetACL(ctx context.Context, proto protocol.ID, acl P2PACL) error
+
+	// RemoveACL lifts the restrictions of the listeners of the protocol
+	RemoveACL(ctx context.Context, proto protocol.ID) error
+
+	// ACLs returns the ACLs of the protocols
+	ACLs(context.Context) (map[protocol.ID]P2PACL, error)
+
+	// NewStream opens a stream with the peer on the first of the protocols
+	// it supports
+	NewStream(ctx context.Context, p peer.ID, protos ...protocol.ID) (inet.Stream, error)
+}
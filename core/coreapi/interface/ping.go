@@ -0,0 +1,77 @@
+package iface
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+// ErrPingSelf is returned when attempting to ping the local node
+var ErrPingSelf = errors.New("can't ping self")
+
+// PingResult is the result of a single ping
+type PingResult struct {
+	// Seq is the sequence number of the ping, starting at 1
+	Seq int
+
+	// RTT is the round trip time of the ping
+	RTT time.Duration
+
+	// Err is set when the ping failed
+	Err error
+}
+
+// PingStats summarizes a series of pings
+type PingStats struct {
+	// Sent is the number of pings sent
+	Sent int
+
+	// Received is the number of pongs received
+	Received int
+
+	// MinRTT, AvgRTT and MaxRTT are computed over the received pongs
+	MinRTT time.Duration
+	AvgRTT time.Duration
+	MaxRTT time.Duration
+
+	total time.Duration
+}
+
+// Add updates the stats with the result of a ping
+func (s *PingStats) Add(r PingResult) {
+	s.Sent++
+	if r.Err != nil {
+		return
+	}
+
+	s.Received++
+	s.total += r.RTT
+	if s.Received == 1 || r.RTT < s.MinRTT {
+		s.MinRTT = r.RTT
+	}
+	if r.RTT > s.MaxRTT {
+		s.MaxRTT = r.RTT
+	}
+	s.AvgRTT = s.total / time.Duration(s.Received)
+}
+
+// Loss returns the fraction of pings that got no reply
+func (s *PingStats) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+	return float64(s.Sent-s.Received) / float64(s.Sent)
+}
+
+// PingAPI specifies the interface to the ping protocol
+type PingAPI interface {
+	// Ping sends pings to the given peer, looking up its addresses first if
+	// they aren't known. Results are sent on the returned channel as pongs
+	// are received; it is closed once all pings were sent, the connection to
+	// the peer failed or the context is canceled.
+	Ping(context.Context, peer.ID, ...options.PingOption) (<-chan PingResult, error)
+}
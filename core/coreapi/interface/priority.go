@@ -0,0 +1,16 @@
+package iface
+
+// Priority is how urgently the blocks read through the API are needed
+type Priority int
+
+const (
+	// PriorityBackground is the priority of the reads nobody is waiting for,
+	// e.g. pinning
+	PriorityBackground Priority = iota - 1
+
+	// PriorityNormal is the priority of the reads without any hint
+	PriorityNormal
+
+	// PriorityInteractive is the priority of the reads a user is waiting for
+	PriorityInteractive
+)
@@ -0,0 +1,53 @@
+package iface
+
+import (
+	"context"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// GcProgress describes a garbage collection in progress
+type GcProgress struct {
+	// Phase is the current phase of the collection: "mark", "sweep",
+	// "datastore" or "done"
+	Phase string
+
+	// Marked is the number of blocks kept, known once marking is over
+	Marked uint64
+
+	// Scanned is the number of blocks examined by the sweep
+	Scanned uint64
+
+	// Removed and BytesRemoved are the number and total size of the blocks
+	// removed
+	Removed      uint64
+	BytesRemoved uint64
+
+	// Errors is the number of errors so far
+	Errors uint64
+}
+
+// GcEvent is an event of a garbage collection. Exactly one of its fields is
+// set.
+type GcEvent struct {
+	// Removed is the cid of a block removed
+	Removed cid.Cid
+
+	// Err is an error of the collection. Blocks that couldn't be removed
+	// don't stop the collection.
+	Err error
+
+	// Progress reports the progress of the collection, at the start of each
+	// phase and periodically while sweeping. A successful collection ends
+	// with the "done" phase and the totals.
+	Progress *GcProgress
+}
+
+// RepoAPI specifies the interface to the maintenance of the repo
+type RepoAPI interface {
+	// Gc starts a garbage collection, removing the blocks which are neither
+	// pinned nor reachable from the MFS root. Its events are sent on the
+	// returned channel, closed when the collection is over or the context is
+	// canceled.
+	Gc(context.Context) (<-chan GcEvent, error)
+}
@@ -0,0 +1,91 @@
+package iface
+
+import (
+	"context"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// ReproviderStat describes the activity of the reprovider, which announces
+// the content of the node to the routing system periodically
+type ReproviderStat struct {
+	// Interval is the time between reprovides, 0 if they are disabled
+	Interval time.Duration
+
+	// Running is set while a reprovide is in progress, Current is then the
+	// number of keys announced so far
+	Running bool
+	Current uint64
+
+	// LastStart and LastEnd delimit the last reprovide, zero until the first
+	// one is over
+	LastStart time.Time
+	LastEnd   time.Time
+
+	// LastProvided is the number of keys announced by the last reprovide,
+	// LastErr its error
+	LastProvided uint64
+	LastErr      error
+
+	// LastCycle is the duration of the last reprovide which announced all
+	// the keys
+	LastCycle time.Duration
+
+	// Provided and Failed count the announcements and the failed attempts
+	// since the node started, ErrorRate is the ratio of the failed attempts
+	Provided  uint64
+	Failed    uint64
+	ErrorRate float64
+
+	// Queued is the number of new blocks waiting to be announced, Retrying
+	// the number of them whose announcement failed
+	Queued   int
+	Retrying int
+
+	// Concurrency is the number of new blocks announced at once, adapted to
+	// Latency, the average latency of their announcements
+	Concurrency int
+	Latency     time.Duration
+}
+
+// ProvideEntry describes a block added to the node and its announcement to
+// the routing system
+type ProvideEntry struct {
+	Cid cid.Cid
+
+	// State is "pending" until the block is announced, "provided" once it
+	// is, and "unknown" for the blocks not added since the node started or
+	// announced too long ago to be remembered
+	State string
+
+	// Age is the time since the block was added
+	Age time.Duration
+
+	// Attempts counts the failed announcements of the block, LastErr is the
+	// error of the last one
+	Attempts int
+	LastErr  error
+}
+
+// ReproviderAPI specifies the interface to the reprovider
+type ReproviderAPI interface {
+	// Reprovide announces the content of the node now, following the
+	// Reprovider.Strategy of the config, and waits until it is done
+	Reprovide(context.Context) error
+
+	// SetInterval changes the time between reprovides until the node is
+	// restarted or its config is reloaded. An interval of 0 disables
+	// reproviding.
+	SetInterval(context.Context, time.Duration) error
+
+	// Stat returns the activity of the reprovider
+	Stat(context.Context) (*ReproviderStat, error)
+
+	// Queue returns the blocks added to the node which weren't announced
+	// yet, the oldest first
+	Queue(context.Context) ([]ProvideEntry, error)
+
+	// QueueStatus returns whether the block at the given path was announced
+	QueueStatus(context.Context, Path) (*ProvideEntry, error)
+}
@@ -0,0 +1,108 @@
+package iface
+
+import (
+	"context"
+
+	options "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+)
+
+// BandwidthStats describes the bandwidth used by the node
+type BandwidthStats struct {
+	TotalIn  int64
+	TotalOut int64
+	RateIn   float64
+	RateOut  float64
+}
+
+// BitswapStats describes the activity of bitswap
+type BitswapStats struct {
+	ProvideBufLen   int
+	WantlistLen     int
+	Peers           int
+	BlocksReceived  uint64
+	DataReceived    uint64
+	BlocksSent      uint64
+	DataSent        uint64
+	DupBlksReceived uint64
+	DupDataReceived uint64
+}
+
+// RepoStats describes the size of the repo
+type RepoStats struct {
+	RepoSize   uint64
+	StorageMax uint64
+
+	// The following fields are not set when only the size was requested
+	NumObjects uint64 `json:",omitempty"`
+	RepoPath   string `json:",omitempty"`
+	Version    string `json:",omitempty"`
+
+	// Quota is set when the node tracks its storage usage, see
+	// Datastore.StorageMax
+	Quota *QuotaStats `json:",omitempty"`
+
+	// Cache describes the blockstore caches
+	Cache *BlockCacheStats `json:",omitempty"`
+}
+
+// QuotaStats describes the storage used by the node against its quota
+type QuotaStats struct {
+	// Usage is the storage used, as tracked while adding and removing
+	// blocks. It is reset to the size of the repo after garbage collections.
+	Usage uint64
+
+	// HighWater is the usage above which a garbage collection is triggered
+	HighWater uint64
+
+	// Enforced is true if blocks are refused over StorageMax
+	Enforced bool
+}
+
+// BlockCacheStats describes the sizes and the effectiveness of the blockstore
+// caches. Sizes of 0 mean that the cache is disabled.
+type BlockCacheStats struct {
+	BloomFilterSize   int
+	BloomFilterHashes int
+	ARCCacheSize      int
+
+	// Requests is the number of Has, Get and GetSize requests made to the
+	// blockstore, Misses the number of them the caches couldn't answer
+	Requests uint64
+	Misses   uint64
+	HitRate  float64
+}
+
+// DhtStats describes the DHT activity of the node
+type DhtStats struct {
+	// Peers is the number of connected peers speaking the DHT protocol
+	Peers int
+
+	// Bandwidth used by the DHT protocol, if bandwidth metrics are enabled
+	Bandwidth *BandwidthStats `json:",omitempty"`
+}
+
+// ConnMgrStats describes the state of the connection manager
+type ConnMgrStats struct {
+	Type      string
+	LowWater  int
+	HighWater int
+	Conns     int
+	Peers     int
+}
+
+// Stats gathers the statistics of the node in a single document. Sections
+// that don't apply to the node (e.g. network statistics of an offline node)
+// are nil.
+type Stats struct {
+	Bandwidth *BandwidthStats `json:",omitempty"`
+	Bitswap   *BitswapStats   `json:",omitempty"`
+	Repo      *RepoStats      `json:",omitempty"`
+	Dht       *DhtStats       `json:",omitempty"`
+	ConnMgr   *ConnMgrStats   `json:",omitempty"`
+}
+
+// StatsAPI specifies the interface to node statistics
+type StatsAPI interface {
+	// All returns the statistics of all the subsystems of the node
+	All(context.Context, ...options.StatsOption) (*Stats, error)
+}
@@ -35,6 +35,23 @@ type ConnectionInfo interface {
 	Streams() ([]protocol.ID, error)
 }
 
+// SwarmEvent is an event of the swarm
+type SwarmEvent struct {
+	// Type is "connected", "disconnected" or "discovered"
+	Type string
+	Peer peer.ID
+
+	// Addrs are the addresses of the connection, or the addresses the peer
+	// was found at
+	Addrs []ma.Multiaddr
+
+	// Source is the service which found the peer, for the "discovered"
+	// events
+	Source string
+
+	Time time.Time
+}
+
 // SwarmAPI specifies the interface to libp2p swarm
 type SwarmAPI interface {
 	// Connect to a given peer
@@ -54,4 +71,15 @@ type SwarmAPI interface {
 
 	// ListenAddrs returns the list of all listening addresses
 	ListenAddrs(context.Context) ([]ma.Multiaddr, error)
+
+	// Events returns the events of the swarm until the context is canceled.
+	// The events are dropped while the reader doesn't keep up
+	Events(context.Context) (<-chan SwarmEvent, error)
+
+	// SetMDNS starts or stops the local discovery until Discovery.MDNS
+	// changes in the config
+	SetMDNS(ctx context.Context, enabled bool) error
+
+	// MDNS returns true if the local discovery is running
+	MDNS(context.Context) (bool, error)
 }
@@ -12,10 +12,11 @@ import (
 
 // TODO: ideas on making this more coreapi-ish without breaking the http API?
 type AddEvent struct {
-	Name  string
-	Hash  string `json:",omitempty"`
-	Bytes int64  `json:",omitempty"`
-	Size  string `json:",omitempty"`
+	Name   string
+	Hash   string `json:",omitempty"`
+	Bytes  int64  `json:",omitempty"`
+	Chunks int64  `json:",omitempty"`
+	Size   string `json:",omitempty"`
 }
 
 type UnixfsFile interface {
@@ -0,0 +1,25 @@
+package coreapi
+
+import (
+	"context"
+	"sort"
+
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+// LogAPI changes the levels of the loggers of the process. They are shared
+// by all the nodes of the process.
+type LogAPI CoreAPI
+
+// SetLevel changes the level of the log output of subsystem, or of all
+// subsystems if it is "*".
+func (api *LogAPI) SetLevel(ctx context.Context, subsystem string, level string) error {
+	return logging.SetLogLevel(subsystem, level)
+}
+
+// Subsystems returns the names of the logging subsystems, sorted.
+func (api *LogAPI) Subsystems(ctx context.Context) ([]string, error) {
+	subs := logging.GetSubsystems()
+	sort.Strings(subs)
+	return subs, nil
+}
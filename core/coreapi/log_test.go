@@ -0,0 +1,47 @@
+package coreapi_test
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, apis, err := makeAPISwarm(ctx, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := apis[0]
+
+	subs, err := api.Log().Subsystems(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for i, s := range subs {
+		if i > 0 && subs[i-1] > s {
+			t.Fatalf("expected the subsystems to be sorted, got %v", subs)
+		}
+		if s == "core/coreapi" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected the subsystem of the CoreAPI, got %v", subs)
+	}
+
+	if err := api.Log().SetLevel(ctx, "core/coreapi", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Log().SetLevel(ctx, "core/coreapi", "error"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Log().SetLevel(ctx, "no-such-subsystem", "debug"); err == nil {
+		t.Fatal("expected an error for an unknown subsystem")
+	}
+	if err := api.Log().SetLevel(ctx, "core/coreapi", "loud"); err == nil {
+		t.Fatal("expected an error for an unknown level")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/ipfs/go-ipfs/core"
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	"github.com/ipfs/go-ipfs/core/webhook"
 	"github.com/ipfs/go-ipfs/keystore"
 	"github.com/ipfs/go-ipfs/namesys"
 
@@ -37,7 +38,10 @@ func (e *ipnsEntry) Value() coreiface.Path {
 }
 
 // Publish announces new IPNS name and returns the new IPNS entry.
-func (api *NameAPI) Publish(ctx context.Context, p coreiface.Path, opts ...caopts.NamePublishOption) (coreiface.IpnsEntry, error) {
+func (api *NameAPI) Publish(ctx context.Context, p coreiface.Path, opts ...caopts.NamePublishOption) (_ coreiface.IpnsEntry, err error) {
+	ctx, done := instrument(ctx, "Name.Publish")
+	defer done(&err)
+
 	options, err := caopts.NamePublishOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -83,6 +87,11 @@ func (api *NameAPI) Publish(ctx context.Context, p coreiface.Path, opts ...caopt
 		return nil, err
 	}
 
+	n.Webhooks.Notify(webhook.IpnsPublished, map[string]string{
+		"Name":  pid.Pretty(),
+		"Value": pth.String(),
+	})
+
 	return &ipnsEntry{
 		name:  pid.Pretty(),
 		value: p,
@@ -142,7 +151,10 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 
 // Resolve attempts to resolve the newest version of the specified name and
 // returns its path.
-func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.NameResolveOption) (coreiface.Path, error) {
+func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.NameResolveOption) (_ coreiface.Path, err error) {
+	ctx, done := instrument(ctx, "Name.Resolve")
+	defer done(&err)
+
 	results, err := api.Search(ctx, name, opts...)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,256 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	p2p "github.com/ipfs/go-ipfs/p2p"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+)
+
+// p2pProtoPrefix is the namespace of the protocols forwarded, unless the
+// custom protocols are allowed
+const p2pProtoPrefix = "/x/"
+
+// P2PAPI is the API of the libp2p tunnels. Unlike the `ipfs p2p` commands it
+// doesn't require the Experimental.Libp2pStreamMounting flag, which only
+// gates the commands.
+type P2PAPI CoreAPI
+
+// Forward forwards the connections accepted on listen to the protocol of
+// the peer target. The listener lasts until it is closed, or until the node
+// is.
+func (api *P2PAPI) Forward(ctx context.Context, proto protocol.ID, listen ma.Multiaddr, target peer.ID, opts ...caopts.P2PListenerOption) (coreiface.P2PListener, error) {
+	if !api.node.OnlineMode() {
+		return coreiface.P2PListener{}, coreiface.ErrOffline
+	}
+
+	settings, err := caopts.P2PListenerOptions(opts...)
+	if err != nil {
+		return coreiface.P2PListener{}, err
+	}
+	if err := api.checkProtocol(proto, settings); err != nil {
+		return coreiface.P2PListener{}, err
+	}
+
+	var auth *p2p.LocalAuth
+	if settings.Token != "" || settings.TLS != nil {
+		auth = &p2p.LocalAuth{Token: settings.Token, TLS: settings.TLS}
+	}
+
+	l, err := api.node.P2P.ForwardLocal(api.node.Context(), target, proto, listen, auth)
+	if err != nil {
+		return coreiface.P2PListener{}, err
+	}
+	return listenerInfo(l), nil
+}
+
+// Listen forwards the streams of the protocol to target.
+func (api *P2PAPI) Listen(ctx context.Context, proto protocol.ID, target ma.Multiaddr, opts ...caopts.P2PListenerOption) (coreiface.P2PListener, error) {
+	if !api.node.OnlineMode() {
+		return coreiface.P2PListener{}, coreiface.ErrOffline
+	}
+
+	settings, err := caopts.P2PListenerOptions(opts...)
+	if err != nil {
+		return coreiface.P2PListener{}, err
+	}
+	if err := api.checkProtocol(proto, settings); err != nil {
+		return coreiface.P2PListener{}, err
+	}
+	if settings.Token != "" || settings.TLS != nil {
+		return coreiface.P2PListener{}, errors.New("the local clients can only be restricted on forwards")
+	}
+
+	l, err := api.node.P2P.ForwardRemote(api.node.Context(), proto, target, settings.ReportPeerID)
+	if err != nil {
+		return coreiface.P2PListener{}, err
+	}
+	return listenerInfo(l), nil
+}
+
+// Close stops the listeners matching the options.
+func (api *P2PAPI) Close(ctx context.Context, opts ...caopts.P2PCloseOption) (int, error) {
+	if !api.node.OnlineMode() {
+		return 0, coreiface.ErrOffline
+	}
+
+	settings, err := caopts.P2PCloseOptions(opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	p, l, t := settings.Protocol != nil, settings.ListenAddress != nil, settings.TargetAddress != nil
+	if !(settings.All || p || l || t) {
+		return 0, errors.New("no matching options given")
+	}
+	if settings.All && (p || l || t) {
+		return 0, errors.New("can't combine All with other matching options")
+	}
+
+	match := func(listener p2p.Listener) bool {
+		if settings.All {
+			return true
+		}
+		if p && *settings.Protocol != listener.Protocol() {
+			return false
+		}
+		if l && !settings.ListenAddress.Equal(listener.ListenAddress()) {
+			return false
+		}
+		if t && !settings.TargetAddress.Equal(listener.TargetAddress()) {
+			return false
+		}
+		return true
+	}
+
+	done := api.node.P2P.ListenersLocal.Close(match)
+	done += api.node.P2P.ListenersP2P.Close(match)
+	return done, nil
+}
+
+// Ls returns the forwards, followed by the protocols listened on.
+func (api *P2PAPI) Ls(ctx context.Context) ([]coreiface.P2PListener, error) {
+	if !api.node.OnlineMode() {
+		return nil, coreiface.ErrOffline
+	}
+
+	var out []coreiface.P2PListener
+	for _, ls := range []*p2p.Listeners{api.node.P2P.ListenersLocal, api.node.P2P.ListenersP2P} {
+		ls.RLock()
+		for _, l := range ls.Listeners {
+			out = append(out, listenerInfo(l))
+		}
+		ls.RUnlock()
+	}
+	return out, nil
+}
+
+// Streams returns the connections being forwarded.
+func (api *P2PAPI) Streams(ctx context.Context) ([]coreiface.P2PStream, error) {
+	if !api.node.OnlineMode() {
+		return nil, coreiface.ErrOffline
+	}
+
+	streams := api.node.P2P.Streams
+	streams.Lock()
+	defer streams.Unlock()
+
+	out := make([]coreiface.P2PStream, 0, len(streams.Streams))
+	for id, s := range streams.Streams {
+		out = append(out, coreiface.P2PStream{
+			ID:            id,
+			Protocol:      s.Protocol,
+			OriginAddress: s.OriginAddr,
+			TargetAddress: s.TargetAddr,
+		})
+	}
+	return out, nil
+}
+
+// CloseStream resets the connection being forwarded of the given ID.
+func (api *P2PAPI) CloseStream(ctx context.Context, id uint64) error {
+	if !api.node.OnlineMode() {
+		return coreiface.ErrOffline
+	}
+
+	streams := api.node.P2P.Streams
+	streams.Lock()
+	s, ok := streams.Streams[id]
+	streams.Unlock()
+	if !ok {
+		return fmt.Errorf("no stream with id %d", id)
+	}
+	return streams.Reset(s)
+}
+
+// SetStreamHandler handles the streams of proto with handler.
+func (api *P2PAPI) SetStreamHandler(ctx context.Context, proto protocol.ID, handler inet.StreamHandler) error {
+	if !api.node.OnlineMode() {
+		return coreiface.ErrOffline
+	}
+	return api.node.P2P.SetStreamHandler(proto, handler)
+}
+
+// RemoveStreamHandler stops handling the streams of proto.
+func (api *P2PAPI) RemoveStreamHandler(ctx context.Context, proto protocol.ID) error {
+	if !api.node.OnlineMode() {
+		return coreiface.ErrOffline
+	}
+	return api.node.P2P.RemoveStreamHandler(proto)
+}
+
+// StreamHandlers returns the protocols handled with SetStreamHandler.
+func (api *P2PAPI) StreamHandlers(ctx context.Context) ([]protocol.ID, error) {
+	if !api.node.OnlineMode() {
+		return nil, coreiface.ErrOffline
+	}
+	return api.node.P2P.StreamHandlers(), nil
+}
+
+// SetACL restricts the listeners of proto with acl, and saves it in P2P.ACL.
+func (api *P2PAPI) SetACL(ctx context.Context, proto protocol.ID, acl coreiface.P2PACL) error {
+	if !api.node.OnlineMode() {
+		return coreiface.ErrOffline
+	}
+	return api.node.SetP2PACL(proto, &p2p.ACL{Peers: acl.Peers, Ports: acl.Ports})
+}
+
+// RemoveACL lifts the restrictions of the listeners of proto.
+func (api *P2PAPI) RemoveACL(ctx context.Context, proto protocol.ID) error {
+	if !api.node.OnlineMode() {
+		return coreiface.ErrOffline
+	}
+	return api.node.SetP2PACL(proto, nil)
+}
+
+// ACLs returns the ACLs of the protocols.
+func (api *P2PAPI) ACLs(ctx context.Context) (map[protocol.ID]coreiface.P2PACL, error) {
+	if !api.node.OnlineMode() {
+		return nil, coreiface.ErrOffline
+	}
+	acls := api.node.P2P.ACLs()
+	out := make(map[protocol.ID]coreiface.P2PACL, len(acls))
+	for proto, acl := range acls {
+		out[proto] = coreiface.P2PACL{Peers: acl.Peers, Ports: acl.Ports}
+	}
+	return out, nil
+}
+
+// NewStream opens a stream with p on the first of protos it supports,
+// looking the peer up if its addresses aren't known.
+func (api *P2PAPI) NewStream(ctx context.Context, p peer.ID, protos ...protocol.ID) (inet.Stream, error) {
+	if !api.node.OnlineMode() {
+		return nil, coreiface.ErrOffline
+	}
+	if len(protos) == 0 {
+		return nil, errors.New("no protocol given")
+	}
+	if p == api.node.Identity {
+		return nil, errors.New("can't open a stream with self")
+	}
+	return api.node.PeerHost.NewStream(ctx, p, protos...)
+}
+
+func (api *P2PAPI) checkProtocol(proto protocol.ID, settings *caopts.P2PListenerSettings) error {
+	if !settings.AllowCustomProtocol && !strings.HasPrefix(string(proto), p2pProtoPrefix) {
+		return errors.New("protocol name must be within '" + p2pProtoPrefix + "' namespace")
+	}
+	return nil
+}
+
+func listenerInfo(l p2p.Listener) coreiface.P2PListener {
+	return coreiface.P2PListener{
+		Protocol:      l.Protocol(),
+		ListenAddress: l.ListenAddress(),
+		TargetAddress: l.TargetAddress(),
+	}
+}
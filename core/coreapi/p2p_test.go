@@ -0,0 +1,165 @@
+package coreapi_test
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+
+	opt "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	p2p "github.com/ipfs/go-ipfs/p2p"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	manet "gx/ipfs/QmQVUtnrNGtCRkCMpXgpApfzQjc8FDaDVxHqWH8cnZQeh5/go-multiaddr-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+)
+
+func TestP2PForward(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nds, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the service of the first node echoes the lines it reads
+	service, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+	go func() {
+		for {
+			c, err := service.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					c.Write([]byte(line))
+				}
+			}()
+		}
+	}()
+
+	target, err := manet.FromNetAddr(service.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apis[0].P2P().Listen(ctx, "/x/echo", target); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apis[0].P2P().Listen(ctx, "/echo", target); err == nil {
+		t.Fatal("expected an error for a protocol outside of /x/")
+	}
+
+	listen, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd, err := apis[1].P2P().Forward(ctx, "/x/echo", listen, nds[0].Identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := manet.Dial(fwd.ListenAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hello\n" {
+		t.Fatalf("expected the line echoed, got %q", line)
+	}
+
+	streams, err := apis[1].P2P().Streams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams[0].Protocol != "/x/echo" {
+		t.Fatalf("expected the stream forwarded, got %v", streams)
+	}
+
+	ls, err := apis[1].P2P().Ls(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || !ls[0].ListenAddress.Equal(fwd.ListenAddress) {
+		t.Fatalf("expected the forward, got %v", ls)
+	}
+
+	if _, err := apis[1].P2P().Close(ctx); err == nil {
+		t.Fatal("expected an error without matching options")
+	}
+	closed, err := apis[1].P2P().Close(ctx, opt.P2P.Protocol("/x/echo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 {
+		t.Fatalf("expected 1 listener closed, got %d", closed)
+	}
+	if ls, _ := apis[1].P2P().Ls(ctx); len(ls) != 0 {
+		t.Fatalf("expected no listeners, got %v", ls)
+	}
+}
+
+func TestP2PStreamHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nds, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = apis[0].P2P().SetStreamHandler(ctx, "/app/hello/1.0.0", func(s inet.Stream) {
+		defer s.Close()
+		s.Write([]byte("hello " + s.Conn().RemotePeer().Pretty() + "\n"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apis[0].P2P().SetStreamHandler(ctx, "/ipfs/ping/1.0.0", func(inet.Stream) {}); err != p2p.ErrProtocolInUse {
+		t.Fatalf("expected ErrProtocolInUse for a protocol of the node, got %v", err)
+	}
+
+	s, err := apis[1].P2P().NewStream(ctx, nds[0].Identity, "/app/hello/1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(s).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hello "+nds[1].Identity.Pretty()+"\n" {
+		t.Fatalf("unexpected reply %q", line)
+	}
+
+	handlers, err := apis[0].P2P().StreamHandlers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handlers) != 1 || handlers[0] != "/app/hello/1.0.0" {
+		t.Fatalf("expected the handler, got %v", handlers)
+	}
+
+	if err := apis[0].P2P().RemoveStreamHandler(ctx, "/app/hello/1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := apis[0].P2P().RemoveStreamHandler(ctx, "/app/hello/1.0.0"); err != p2p.ErrNoHandler {
+		t.Fatalf("expected ErrNoHandler, got %v", err)
+	}
+}
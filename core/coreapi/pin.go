@@ -7,6 +7,7 @@ import (
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
 	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
 	merkledag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
 
@@ -16,7 +17,10 @@ import (
 
 type PinAPI CoreAPI
 
-func (api *PinAPI) Add(ctx context.Context, p coreiface.Path, opts ...caopts.PinAddOption) error {
+func (api *PinAPI) Add(ctx context.Context, p coreiface.Path, opts ...caopts.PinAddOption) (err error) {
+	ctx, done := instrument(ctx, "Pin.Add")
+	defer done(&err)
+
 	settings, err := caopts.PinAddOptions(opts...)
 	if err != nil {
 		return err
@@ -29,6 +33,7 @@ func (api *PinAPI) Add(ctx context.Context, p coreiface.Path, opts ...caopts.Pin
 
 	defer api.node.Blockstore.PinLock().Unlock()
 
+	ctx = (*CoreAPI)(api).withPriority(ctx)
 	_, err = corerepo.Pin(api.node, api.core(), ctx, []string{rp.Cid().String()}, settings.Recursive)
 	if err != nil {
 		return err
@@ -52,8 +57,11 @@ func (api *PinAPI) Ls(ctx context.Context, opts ...caopts.PinLsOption) ([]coreif
 	return api.pinLsAll(settings.Type, ctx)
 }
 
-func (api *PinAPI) Rm(ctx context.Context, p coreiface.Path) error {
-	_, err := corerepo.Unpin(api.node, api.core(), ctx, []string{p.String()}, true)
+func (api *PinAPI) Rm(ctx context.Context, p coreiface.Path) (err error) {
+	ctx, done := instrument(ctx, "Pin.Rm")
+	defer done(&err)
+
+	_, err = corerepo.Unpin(api.node, api.core(), ctx, []string{p.String()}, true)
 	if err != nil {
 		return err
 	}
@@ -61,7 +69,10 @@ func (api *PinAPI) Rm(ctx context.Context, p coreiface.Path) error {
 	return api.node.Pinning.Flush()
 }
 
-func (api *PinAPI) Update(ctx context.Context, from coreiface.Path, to coreiface.Path, opts ...caopts.PinUpdateOption) error {
+func (api *PinAPI) Update(ctx context.Context, from coreiface.Path, to coreiface.Path, opts ...caopts.PinUpdateOption) (err error) {
+	ctx, done := instrument(ctx, "Pin.Update")
+	defer done(&err)
+
 	settings, err := caopts.PinUpdateOptions(opts...)
 	if err != nil {
 		return err
@@ -79,6 +90,7 @@ func (api *PinAPI) Update(ctx context.Context, from coreiface.Path, to coreiface
 
 	defer api.node.Blockstore.PinLock().Unlock()
 
+	ctx = priority.WithDefault((*CoreAPI)(api).withPriority(ctx), priority.Background)
 	err = api.node.Pinning.Update(ctx, fp.Cid(), tp.Cid(), settings.Unpin)
 	if err != nil {
 		return err
@@ -0,0 +1,108 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+
+	ping "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/protocol/ping"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+)
+
+type PingAPI CoreAPI
+
+var (
+	errPingTimeout = errors.New("ping timed out")
+	errPingClosed  = errors.New("ping stream closed")
+)
+
+// Ping sends pings to the peer `p`, sending the results on the returned
+// channel.
+func (api *PingAPI) Ping(ctx context.Context, p peer.ID, opts ...caopts.PingOption) (<-chan coreiface.PingResult, error) {
+	settings, err := caopts.PingOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.Count <= 0 {
+		return nil, fmt.Errorf("ping count must be greater than 0, was %d", settings.Count)
+	}
+
+	n := api.node
+	if !n.OnlineMode() {
+		return nil, coreiface.ErrOffline
+	}
+
+	if p == n.Identity {
+		return nil, coreiface.ErrPingSelf
+	}
+
+	if len(n.Peerstore.Addrs(p)) == 0 {
+		// Make sure we can find the node in question
+		fctx, cancel := context.WithTimeout(ctx, settings.Timeout)
+		pi, err := n.Routing.FindPeer(fctx, p)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		n.Peerstore.AddAddrs(pi.ID, pi.Addrs, pstore.TempAddrTTL)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pings, err := ping.Ping(ctx, n.PeerHost, p)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan coreiface.PingResult)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		for seq := 1; seq <= settings.Count; seq++ {
+			res := coreiface.PingResult{Seq: seq}
+
+			timeout := time.NewTimer(settings.Timeout)
+			select {
+			case rtt, ok := <-pings:
+				if ok {
+					res.RTT = rtt
+				} else {
+					res.Err = errPingClosed
+				}
+			case <-timeout.C:
+				res.Err = errPingTimeout
+			case <-ctx.Done():
+				timeout.Stop()
+				return
+			}
+			timeout.Stop()
+
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+
+			// Pings are sent one after the other on the same stream, there
+			// is no point in going on once one of them failed.
+			if res.Err != nil || seq == settings.Count {
+				return
+			}
+
+			select {
+			case <-time.After(settings.Interval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,51 @@
+package coreapi_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	opt "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+)
+
+func TestPing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nds, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pings, err := apis[1].Ping().Ping(ctx, nds[0].Identity, opt.Ping.Count(3), opt.Ping.Interval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stats coreiface.PingStats
+	for r := range pings {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if r.Seq != stats.Sent+1 {
+			t.Errorf("expected sequence number %d, got %d", stats.Sent+1, r.Seq)
+		}
+		stats.Add(r)
+	}
+
+	if stats.Sent != 3 || stats.Received != 3 || stats.Loss() != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.MinRTT > stats.AvgRTT || stats.AvgRTT > stats.MaxRTT {
+		t.Errorf("inconsistent stats: %+v", stats)
+	}
+
+	if _, err := apis[1].Ping().Ping(ctx, nds[1].Identity); err != coreiface.ErrPingSelf {
+		t.Errorf("expected ErrPingSelf, got %v", err)
+	}
+
+	if _, err := apis[1].Ping().Ping(ctx, nds[0].Identity, opt.Ping.Count(0)); err == nil {
+		t.Error("expected an error for a count of 0")
+	}
+}
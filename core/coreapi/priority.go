@@ -0,0 +1,77 @@
+package coreapi
+
+import (
+	"context"
+
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
+
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+)
+
+// setPriority makes the fetches of api have priority p, wrapping its DAG and
+// blocks.
+func (api *CoreAPI) setPriority(p priority.Priority) {
+	api.priority = p
+	api.prioritized = true
+	api.dag = &priorityDAG{DAGService: api.dag, p: p}
+	api.blocks = &priorityBlocks{BlockGetter: api.blocks, p: p}
+}
+
+// withPriority returns ctx with the priority of api, if set.
+func (api *CoreAPI) withPriority(ctx context.Context) context.Context {
+	if !api.prioritized {
+		return ctx
+	}
+	return priority.WithPriority(ctx, api.priority)
+}
+
+// priorityDAG is a DAG service fetching the nodes with priority p.
+type priorityDAG struct {
+	ipld.DAGService
+	p priority.Priority
+}
+
+func (d *priorityDAG) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	return d.DAGService.Get(priority.WithPriority(ctx, d.p), c)
+}
+
+func (d *priorityDAG) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	return d.DAGService.GetMany(priority.WithPriority(ctx, d.p), cids)
+}
+
+// Session returns a session of the DAG service fetching the nodes with
+// priority p.
+func (d *priorityDAG) Session(ctx context.Context) ipld.NodeGetter {
+	return &priorityGetter{NodeGetter: dag.NewSession(ctx, d.DAGService), p: d.p}
+}
+
+type priorityGetter struct {
+	ipld.NodeGetter
+	p priority.Priority
+}
+
+func (g *priorityGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	return g.NodeGetter.Get(priority.WithPriority(ctx, g.p), c)
+}
+
+func (g *priorityGetter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	return g.NodeGetter.GetMany(priority.WithPriority(ctx, g.p), cids)
+}
+
+// priorityBlocks fetches the blocks with priority p.
+type priorityBlocks struct {
+	bserv.BlockGetter
+	p priority.Priority
+}
+
+func (b *priorityBlocks) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return b.BlockGetter.GetBlock(priority.WithPriority(ctx, b.p), c)
+}
+
+func (b *priorityBlocks) GetBlocks(ctx context.Context, ks []cid.Cid) <-chan blocks.Block {
+	return b.BlockGetter.GetBlocks(priority.WithPriority(ctx, b.p), ks)
+}
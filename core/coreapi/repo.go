@@ -0,0 +1,67 @@
+package coreapi
+
+import (
+	"context"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
+)
+
+type RepoAPI CoreAPI
+
+// Gc runs a garbage collection, sending the blocks removed, the errors and
+// the progress of the collection on the returned channel.
+func (api *RepoAPI) Gc(ctx context.Context) (<-chan coreiface.GcEvent, error) {
+	n := api.node
+
+	results, err := corerepo.GarbageCollectWithProgress(n, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan coreiface.GcEvent)
+	go func() {
+		defer close(out)
+
+		var errors uint64
+		for res := range results {
+			var ev coreiface.GcEvent
+			switch {
+			case res.Error != nil:
+				errors++
+				ev.Err = res.Error
+			case res.Progress != nil:
+				ev.Progress = gcProgress(res.Progress, errors)
+				if res.Progress.Phase == gc.PhaseDone {
+					if err := corerepo.SyncStorageUsage(n); err != nil {
+						log.Errorf("syncing storage usage: %s", err)
+					}
+				}
+			default:
+				ev.Removed = res.KeyRemoved
+			}
+
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				// drain the results for the collection to stop
+				for range results {
+				}
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func gcProgress(p *gc.Progress, errors uint64) *coreiface.GcProgress {
+	return &coreiface.GcProgress{
+		Phase:        p.Phase,
+		Marked:       p.Marked,
+		Scanned:      p.Scanned,
+		Removed:      p.Removed,
+		BytesRemoved: p.BytesRemoved,
+		Errors:       errors,
+	}
+}
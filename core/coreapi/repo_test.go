@@ -0,0 +1,57 @@
+package coreapi_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRepoGcProgress(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blk, err := api.Block().Put(ctx, strings.NewReader(`garbage`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := api.Repo().Gc(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var removed bool
+	var phases []string
+	var last uint64
+	for ev := range events {
+		switch {
+		case ev.Err != nil:
+			t.Fatal(ev.Err)
+		case ev.Progress != nil:
+			phases = append(phases, ev.Progress.Phase)
+			last = ev.Progress.Removed
+			if ev.Progress.Phase == "done" && ev.Progress.BytesRemoved == 0 {
+				t.Error("expected the reclaimed space to be reported")
+			}
+		default:
+			if ev.Removed.Equals(blk.Path().Cid()) {
+				removed = true
+			}
+		}
+	}
+
+	if !removed {
+		t.Error("expected the block to be removed")
+	}
+	if len(phases) == 0 || phases[0] != "mark" || phases[len(phases)-1] != "done" {
+		t.Errorf("unexpected phases: %v", phases)
+	}
+	if last == 0 {
+		t.Error("expected the removed blocks to be counted")
+	}
+}
@@ -0,0 +1,130 @@
+package coreapi
+
+import (
+	"context"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	providequeue "github.com/ipfs/go-ipfs/exchange/providequeue"
+	rp "github.com/ipfs/go-ipfs/exchange/reprovide"
+
+	bitswap "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap"
+)
+
+type ReproviderAPI CoreAPI
+
+func (api *ReproviderAPI) Reprovide(ctx context.Context) error {
+	r, err := api.reprovider()
+	if err != nil {
+		return err
+	}
+	return r.Trigger(ctx)
+}
+
+func (api *ReproviderAPI) SetInterval(ctx context.Context, interval time.Duration) error {
+	r, err := api.reprovider()
+	if err != nil {
+		return err
+	}
+	r.SetInterval(interval)
+	return nil
+}
+
+func (api *ReproviderAPI) Stat(ctx context.Context) (*coreiface.ReproviderStat, error) {
+	r, err := api.reprovider()
+	if err != nil {
+		return nil, err
+	}
+
+	st := r.Stat()
+	out := &coreiface.ReproviderStat{
+		Interval:     st.Interval,
+		Running:      st.Running,
+		Current:      st.Current,
+		LastStart:    st.LastStart,
+		LastEnd:      st.LastEnd,
+		LastProvided: st.LastProvided,
+		LastErr:      st.LastErr,
+		LastCycle:    st.LastCycle,
+		Provided:     st.Provided,
+		Failed:       st.Failed,
+	}
+	if attempts := st.Provided + st.Failed; attempts > 0 {
+		out.ErrorRate = float64(st.Failed) / float64(attempts)
+	}
+	if bs, ok := api.node.Exchange.(*bitswap.Bitswap); ok {
+		bst, err := bs.Stat()
+		if err != nil {
+			return nil, err
+		}
+		out.Queued = bst.ProvideBufLen
+	}
+	if api.node.Provider != nil {
+		pst := api.node.Provider.Stat()
+		out.Queued += pst.Queued
+		out.Retrying = pst.Retrying
+		out.Concurrency = pst.Concurrency
+		out.Latency = pst.Latency
+	}
+	return out, nil
+}
+
+func (api *ReproviderAPI) Queue(ctx context.Context) ([]coreiface.ProvideEntry, error) {
+	q, err := api.provideQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := q.Pending()
+	out := make([]coreiface.ProvideEntry, len(entries))
+	for i, e := range entries {
+		out[i] = provideEntry(e, now)
+	}
+	return out, nil
+}
+
+func (api *ReproviderAPI) QueueStatus(ctx context.Context, p coreiface.Path) (*coreiface.ProvideEntry, error) {
+	q, err := api.provideQueue()
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	e := provideEntry(q.Status(resolved.Cid()), time.Now())
+	return &e, nil
+}
+
+func (api *ReproviderAPI) provideQueue() (*providequeue.Tracker, error) {
+	if !api.node.OnlineMode() || api.node.ProvideQueue == nil {
+		return nil, coreiface.ErrOffline
+	}
+	return api.node.ProvideQueue, nil
+}
+
+func provideEntry(e providequeue.Entry, now time.Time) coreiface.ProvideEntry {
+	out := coreiface.ProvideEntry{
+		Cid:      e.Cid,
+		State:    e.State.String(),
+		Attempts: e.Attempts,
+		LastErr:  e.LastErr,
+	}
+	if e.State != providequeue.Unknown {
+		out.Age = now.Sub(e.Since)
+	}
+	return out
+}
+
+func (api *ReproviderAPI) reprovider() (*rp.Reprovider, error) {
+	if !api.node.OnlineMode() || api.node.Reprovider == nil {
+		return nil, coreiface.ErrOffline
+	}
+	return api.node.Reprovider, nil
+}
+
+func (api *ReproviderAPI) core() coreiface.CoreAPI {
+	return (*CoreAPI)(api)
+}
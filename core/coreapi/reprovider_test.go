@@ -0,0 +1,102 @@
+package coreapi_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+)
+
+func TestReproviderStat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := apis[0]
+
+	if err := api.Reprovider().SetInterval(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Reprovider().Reprovide(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := api.Reprovider().Stat(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Interval != time.Hour {
+		t.Errorf("expected the interval to be changed, got %s", st.Interval)
+	}
+	if st.Running || st.LastEnd.IsZero() || st.LastErr != nil {
+		t.Errorf("expected the reprovide to be over, got %+v", st)
+	}
+	if st.LastProvided == 0 || st.Provided < st.LastProvided {
+		t.Errorf("expected the keys provided to be counted, got %+v", st)
+	}
+}
+
+func TestReproviderQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := apis[0]
+
+	p, err := api.Block().Put(ctx, strings.NewReader("announce me"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := api.Reprovider().QueueStatus(ctx, p.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.State == "unknown" {
+		t.Fatalf("expected the block added to be tracked, got %+v", e)
+	}
+
+	// the reprovider announces the block if bitswap didn't already
+	if err := api.Reprovider().Reprovide(ctx); err != nil {
+		t.Fatal(err)
+	}
+	e, err = api.Reprovider().QueueStatus(ctx, p.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.State != "provided" || !e.Cid.Equals(p.Path().Cid()) {
+		t.Fatalf("expected the block to be provided, got %+v", e)
+	}
+	queue, err := api.Reprovider().Queue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range queue {
+		if q.Cid.Equals(e.Cid) {
+			t.Fatalf("expected the block provided to leave the queue")
+		}
+	}
+}
+
+func TestReproviderOffline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.Reprovider().Stat(ctx); err != coreiface.ErrOffline {
+		t.Fatalf("expected the reprovider to be offline, got %v", err)
+	}
+	if _, err := api.Reprovider().Queue(ctx); err != coreiface.ErrOffline {
+		t.Fatalf("expected the provide queue to be offline, got %v", err)
+	}
+}
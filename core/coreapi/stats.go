@@ -0,0 +1,180 @@
+package coreapi
+
+import (
+	"context"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	caopts "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+
+	bitswap "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap"
+	dht "gx/ipfs/QmXbPygnUKAPMwseE5U3hQA7Thn59GVm7pQrhkFV63umT8/go-libp2p-kad-dht"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	metrics "gx/ipfs/QmbYN6UmTJn5UUQdi5CTsU86TXVBSrTcRk5UmyA36Qx2J6/go-libp2p-metrics"
+)
+
+type StatsAPI CoreAPI
+
+// All returns the statistics of the node. The network related sections are
+// only set when the node is online.
+func (api *StatsAPI) All(ctx context.Context, opts ...caopts.StatsOption) (*coreiface.Stats, error) {
+	settings, err := caopts.StatsOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	n := api.node
+	out := &coreiface.Stats{}
+
+	if out.Repo, err = api.repoStats(ctx, settings.SizeOnly); err != nil {
+		return nil, err
+	}
+
+	if !n.OnlineMode() {
+		return out, nil
+	}
+
+	if n.Reporter != nil {
+		out.Bandwidth = bandwidthStats(n.Reporter.GetBandwidthTotals())
+	}
+
+	if bs, ok := n.Exchange.(*bitswap.Bitswap); ok {
+		st, err := bs.Stat()
+		if err != nil {
+			return nil, err
+		}
+		out.Bitswap = &coreiface.BitswapStats{
+			ProvideBufLen:   st.ProvideBufLen,
+			WantlistLen:     len(st.Wantlist),
+			Peers:           len(st.Peers),
+			BlocksReceived:  st.BlocksReceived,
+			DataReceived:    st.DataReceived,
+			BlocksSent:      st.BlocksSent,
+			DataSent:        st.DataSent,
+			DupBlksReceived: st.DupBlksReceived,
+			DupDataReceived: st.DupDataReceived,
+		}
+	}
+
+	if n.DHT != nil {
+		out.Dht = api.dhtStats()
+	}
+
+	if out.ConnMgr, err = api.connMgrStats(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (api *StatsAPI) repoStats(ctx context.Context, sizeOnly bool) (*coreiface.RepoStats, error) {
+	if sizeOnly {
+		st, err := corerepo.RepoSize(ctx, api.node)
+		if err != nil {
+			return nil, err
+		}
+		return &coreiface.RepoStats{
+			RepoSize:   st.RepoSize,
+			StorageMax: st.StorageMax,
+			Quota:      api.quotaStats(),
+			Cache:      api.blockCacheStats(),
+		}, nil
+	}
+
+	st, err := corerepo.RepoStat(ctx, api.node)
+	if err != nil {
+		return nil, err
+	}
+	return &coreiface.RepoStats{
+		RepoSize:   st.RepoSize,
+		StorageMax: st.StorageMax,
+		NumObjects: st.NumObjects,
+		RepoPath:   st.RepoPath,
+		Version:    st.Version,
+		Quota:      api.quotaStats(),
+		Cache:      api.blockCacheStats(),
+	}, nil
+}
+
+func (api *StatsAPI) quotaStats() *coreiface.QuotaStats {
+	q := api.node.StorageQuota
+	if q == nil {
+		return nil
+	}
+
+	_, highWater := q.Limits()
+	return &coreiface.QuotaStats{
+		Usage:     q.Usage(),
+		HighWater: highWater,
+		Enforced:  q.Enforced(),
+	}
+}
+
+func (api *StatsAPI) blockCacheStats() *coreiface.BlockCacheStats {
+	c := api.node.BlockCache
+	if c == nil {
+		return nil
+	}
+
+	opts := c.Options()
+	st := c.Stats()
+	return &coreiface.BlockCacheStats{
+		BloomFilterSize:   opts.HasBloomFilterSize,
+		BloomFilterHashes: opts.HasBloomFilterHashes,
+		ARCCacheSize:      opts.HasARCCacheSize,
+		Requests:          st.Requests,
+		Misses:            st.Misses,
+		HitRate:           st.HitRate(),
+	}
+}
+
+func (api *StatsAPI) dhtStats() *coreiface.DhtStats {
+	n := api.node
+	out := &coreiface.DhtStats{}
+
+	for _, p := range n.PeerHost.Network().Peers() {
+		protos, err := n.Peerstore.SupportsProtocols(p, string(dht.ProtocolDHT))
+		if err == nil && len(protos) > 0 {
+			out.Peers++
+		}
+	}
+
+	if n.Reporter != nil {
+		out.Bandwidth = bandwidthStats(n.Reporter.GetBandwidthForProtocol(dht.ProtocolDHT))
+	}
+	return out
+}
+
+func (api *StatsAPI) connMgrStats() (*coreiface.ConnMgrStats, error) {
+	n := api.node
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &coreiface.ConnMgrStats{
+		Type:      cfg.Swarm.ConnMgr.Type,
+		LowWater:  cfg.Swarm.ConnMgr.LowWater,
+		HighWater: cfg.Swarm.ConnMgr.HighWater,
+		Conns:     len(n.PeerHost.Network().Conns()),
+		Peers:     len(n.PeerHost.Network().Peers()),
+	}
+	switch out.Type {
+	case "":
+		out.Type = "basic"
+		out.LowWater = config.DefaultConnMgrLowWater
+		out.HighWater = config.DefaultConnMgrHighWater
+	case "none":
+		out.LowWater, out.HighWater = 0, 0
+	}
+	return out, nil
+}
+
+func bandwidthStats(st metrics.Stats) *coreiface.BandwidthStats {
+	return &coreiface.BandwidthStats{
+		TotalIn:  st.TotalIn,
+		TotalOut: st.TotalOut,
+		RateIn:   st.RateIn,
+		RateOut:  st.RateOut,
+	}
+}
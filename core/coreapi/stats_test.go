@@ -0,0 +1,63 @@
+package coreapi_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	opt "github.com/ipfs/go-ipfs/core/coreapi/interface/options"
+)
+
+func TestStatsOffline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := api.Block().Put(ctx, strings.NewReader(`Hello`)); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := api.Stats().All(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Repo == nil || stats.Repo.NumObjects == 0 || stats.Repo.Version == "" {
+		t.Errorf("unexpected repo stats: %+v", stats.Repo)
+	}
+	if stats.Bandwidth != nil || stats.Bitswap != nil || stats.Dht != nil || stats.ConnMgr != nil {
+		t.Errorf("expected no network stats on an offline node, got %+v", stats)
+	}
+
+	stats, err = api.Stats().All(ctx, opt.Stats.SizeOnly(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Repo.NumObjects != 0 || stats.Repo.Version != "" {
+		t.Errorf("expected only the size with SizeOnly, got %+v", stats.Repo)
+	}
+}
+
+func TestStatsOnline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, apis, err := makeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := apis[0].Stats().All(ctx, opt.Stats.SizeOnly(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Repo == nil || stats.Bitswap == nil || stats.ConnMgr == nil {
+		t.Fatalf("expected repo, bitswap and connmgr stats, got %+v", stats)
+	}
+	if stats.ConnMgr.Type != "basic" || stats.ConnMgr.HighWater == 0 {
+		t.Errorf("unexpected connmgr stats: %+v", stats.ConnMgr)
+	}
+}
@@ -147,6 +147,46 @@ func (api *SwarmAPI) Peers(context.Context) ([]coreiface.ConnectionInfo, error)
 	return out, nil
 }
 
+func (api *SwarmAPI) Events(ctx context.Context) (<-chan coreiface.SwarmEvent, error) {
+	if api.node.SwarmEvents == nil {
+		return nil, coreiface.ErrOffline
+	}
+
+	events := api.node.SwarmEvents.Subscribe(ctx)
+	out := make(chan coreiface.SwarmEvent)
+	go func() {
+		defer close(out)
+		for e := range events {
+			select {
+			case out <- coreiface.SwarmEvent{
+				Type:   string(e.Type),
+				Peer:   e.Peer,
+				Addrs:  e.Addrs,
+				Source: e.Source,
+				Time:   e.Time,
+			}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (api *SwarmAPI) SetMDNS(ctx context.Context, enabled bool) error {
+	if api.node.PeerHost == nil {
+		return coreiface.ErrOffline
+	}
+	return api.node.SetMDNS(enabled)
+}
+
+func (api *SwarmAPI) MDNS(context.Context) (bool, error) {
+	if api.node.PeerHost == nil {
+		return false, coreiface.ErrOffline
+	}
+	return api.node.MDNSEnabled(), nil
+}
+
 func (ci *connInfo) ID() peer.ID {
 	return ci.peer
 }
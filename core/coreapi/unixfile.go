@@ -106,7 +106,7 @@ func (d *ufsDirectory) Seek(offset int64, whence int) (int64, error) {
 }
 
 type ufsFile struct {
-	uio.DagReader
+	*dagSeekReader
 
 	name string
 	path string
@@ -129,7 +129,7 @@ func (f *ufsFile) FullPath() string {
 }
 
 func (f *ufsFile) Size() (int64, error) {
-	return int64(f.DagReader.Size()), nil
+	return int64(f.dagSeekReader.Size()), nil
 }
 
 func newUnixfsDir(ctx context.Context, dserv ipld.DAGService, nd ipld.Node, name string, path string) (iface.UnixfsFile, error) {
@@ -184,13 +184,13 @@ func newUnixfsFile(ctx context.Context, dserv ipld.DAGService, nd ipld.Node, nam
 		return nil, errors.New("unknown node type")
 	}
 
-	dr, err := uio.NewDagReader(ctx, nd, dserv)
+	dr, err := newDagSeekReader(ctx, nd, dserv)
 	if err != nil {
 		return nil, err
 	}
 
 	return &ufsFile{
-		DagReader: dr,
+		dagSeekReader: dr,
 
 		name: name,
 		path: path,
@@ -0,0 +1,229 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+// Number of sibling blocks to prefetch ahead of the one being read.
+const prefetchBlocks = 8
+
+var (
+	errInvalidWhence = errors.New("invalid whence")
+	errNotAFile      = errors.New("not a unixfs file")
+)
+
+// seekFrame is a node on the path from the root of a file to the block
+// currently being read.
+type seekFrame struct {
+	node ipld.Node
+	fsn  *ft.FSNode // nil for raw nodes
+
+	// start is the offset of the first byte of node within the file.
+	start int64
+	size  int64
+}
+
+func (f *seekFrame) contains(offset int64) bool {
+	return offset >= f.start && offset < f.start+f.size
+}
+
+// dagSeekReader reads a unixfs file. Unlike uio.DagReader, it doesn't start
+// fetching the whole file when opened. Seeking walks straight down to the
+// block containing the new offset using the block sizes recorded in the
+// unixfs nodes, only fetching the nodes on the way, and reading only
+// prefetches a small window of blocks ahead.
+type dagSeekReader struct {
+	ctx   context.Context
+	dserv ipld.NodeGetter
+
+	size   int64
+	offset int64
+
+	// path from the root to the block being read.
+	stack []*seekFrame
+
+	// data of the current block, starting at offset.
+	buf []byte
+
+	// prefetched holds the CIDs we already asked the network for.
+	prefetched *cid.Set
+}
+
+func newDagSeekReader(ctx context.Context, nd ipld.Node, dserv ipld.NodeGetter) (*dagSeekReader, error) {
+	root, err := newSeekFrame(nd, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dagSeekReader{
+		ctx:        ctx,
+		dserv:      dserv,
+		size:       root.size,
+		stack:      []*seekFrame{root},
+		prefetched: cid.NewSet(),
+	}, nil
+}
+
+func newSeekFrame(nd ipld.Node, start int64) (*seekFrame, error) {
+	switch nd := nd.(type) {
+	case *dag.RawNode:
+		return &seekFrame{node: nd, start: start, size: int64(len(nd.RawData()))}, nil
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return nil, err
+		}
+		switch fsn.Type() {
+		case ft.TFile, ft.TRaw:
+		default:
+			return nil, errNotAFile
+		}
+		if fsn.NumChildren() != len(nd.Links()) {
+			return nil, errors.New("unixfs node has inconsistent block sizes")
+		}
+		return &seekFrame{node: nd, fsn: fsn, start: start, size: int64(fsn.FileSize())}, nil
+	default:
+		return nil, errors.New("unknown node type")
+	}
+}
+
+func (r *dagSeekReader) Size() uint64 {
+	return uint64(r.size)
+}
+
+func (r *dagSeekReader) Read(b []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if len(r.buf) == 0 {
+		buf, err := r.loadBlock(r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.buf = buf
+	}
+
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	r.offset += int64(n)
+	return n, nil
+}
+
+func (r *dagSeekReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return r.offset, errInvalidWhence
+	}
+
+	if offset < 0 {
+		return r.offset, errors.New("invalid offset")
+	}
+
+	if offset != r.offset {
+		// Blocks are loaded lazily, the next read will find the right one.
+		r.buf = nil
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *dagSeekReader) Close() error {
+	r.buf = nil
+	r.stack = r.stack[:1]
+	return nil
+}
+
+// loadBlock returns the data of the file from offset up to the end of the
+// block containing it.
+func (r *dagSeekReader) loadBlock(offset int64) ([]byte, error) {
+	// Climb up until we find a node that covers the offset. The root always
+	// does.
+	for len(r.stack) > 1 && !r.stack[len(r.stack)-1].contains(offset) {
+		r.stack = r.stack[:len(r.stack)-1]
+	}
+
+	for {
+		f := r.stack[len(r.stack)-1]
+		rel := offset - f.start
+
+		if f.fsn == nil {
+			return f.node.RawData()[rel:], nil
+		}
+
+		// Data stored in the node itself comes before its children.
+		data := f.fsn.Data()
+		if rel < int64(len(data)) {
+			return data[rel:], nil
+		}
+
+		child, start, err := r.childAt(f, rel-int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		cf, err := newSeekFrame(child, f.start+int64(len(data))+start)
+		if err != nil {
+			return nil, err
+		}
+		r.stack = append(r.stack, cf)
+	}
+}
+
+// childAt fetches the child of f containing rel, the offset relative to the
+// start of f's children, and returns it with its offset relative to the
+// same.
+func (r *dagSeekReader) childAt(f *seekFrame, rel int64) (ipld.Node, int64, error) {
+	links := f.node.Links()
+
+	var start int64
+	for i := range links {
+		bs := int64(f.fsn.BlockSize(i))
+		if rel < start+bs {
+			r.prefetch(links[i+1:])
+
+			child, err := links[i].GetNode(r.ctx, r.dserv)
+			if err != nil {
+				return nil, 0, err
+			}
+			return child, start, nil
+		}
+		start += bs
+	}
+	return nil, 0, io.ErrUnexpectedEOF
+}
+
+// prefetch asks for the next few links in the background so they are
+// available locally by the time we read them.
+func (r *dagSeekReader) prefetch(links []*ipld.Link) {
+	if len(links) > prefetchBlocks {
+		links = links[:prefetchBlocks]
+	}
+
+	var cids []cid.Cid
+	for _, l := range links {
+		if r.prefetched.Visit(l.Cid) {
+			cids = append(cids, l.Cid)
+		}
+	}
+	if len(cids) == 0 {
+		return
+	}
+
+	ch := r.dserv.GetMany(r.ctx, cids)
+	go func() {
+		for range ch {
+		}
+	}()
+}
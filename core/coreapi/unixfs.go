@@ -10,6 +10,7 @@ import (
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
 	"github.com/ipfs/go-ipfs/core/coreapi/interface/options"
 	"github.com/ipfs/go-ipfs/core/coreunix"
+	gc "github.com/ipfs/go-ipfs/pin/gc"
 
 	blockservice "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
 	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
@@ -28,7 +29,10 @@ type UnixfsAPI CoreAPI
 
 // Add builds a merkledag node from a reader, adds it to the blockstore,
 // and returns the key representing that node.
-func (api *UnixfsAPI) Add(ctx context.Context, files files.File, opts ...options.UnixfsAddOption) (coreiface.ResolvedPath, error) {
+func (api *UnixfsAPI) Add(ctx context.Context, files files.File, opts ...options.UnixfsAddOption) (_ coreiface.ResolvedPath, err error) {
+	ctx, done := instrument(ctx, "Unixfs.Add")
+	defer done(&err)
+
 	settings, prefix, err := options.UnixfsAddOptions(opts...)
 	if err != nil {
 		return nil, err
@@ -67,7 +71,12 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.File, opts ...options
 
 	addblockstore := n.Blockstore
 	if !(settings.FsCache || settings.NoCopy) {
-		addblockstore = bstore.NewGCBlockstore(n.BaseBlocks, n.GCLocker)
+		if tbs, ok := n.Blockstore.(*gc.TrackingBlockstore); ok {
+			// the blocks added must be tracked by garbage collections
+			addblockstore = tbs.Wrap(n.BaseBlocks)
+		} else {
+			addblockstore = bstore.NewGCBlockstore(n.BaseBlocks, n.GCLocker)
+		}
 	}
 
 	exch := n.Exchange
@@ -133,7 +142,10 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.File, opts ...options
 	return coreiface.IpfsPath(nd.Cid()), nil
 }
 
-func (api *UnixfsAPI) Get(ctx context.Context, p coreiface.Path) (coreiface.UnixfsFile, error) {
+func (api *UnixfsAPI) Get(ctx context.Context, p coreiface.Path) (_ coreiface.UnixfsFile, err error) {
+	ctx, done := instrument(ctx, "Unixfs.Get")
+	defer done(&err)
+
 	ses := api.core().getSession(ctx)
 
 	nd, err := ses.ResolveNode(ctx, p)
@@ -146,7 +158,10 @@ func (api *UnixfsAPI) Get(ctx context.Context, p coreiface.Path) (coreiface.Unix
 
 // Ls returns the contents of an IPFS or IPNS object(s) at path p, with the format:
 // `<link base58 hash> <link size in bytes> <link name>`
-func (api *UnixfsAPI) Ls(ctx context.Context, p coreiface.Path) ([]*ipld.Link, error) {
+func (api *UnixfsAPI) Ls(ctx context.Context, p coreiface.Path) (_ []*ipld.Link, err error) {
+	ctx, done := instrument(ctx, "Unixfs.Ls")
+	defer done(&err)
+
 	dagnode, err := api.core().ResolveNode(ctx, p)
 	if err != nil {
 		return nil, err
@@ -655,6 +655,74 @@ func TestGetEmptyFile(t *testing.T) {
 	}
 }
 
+func TestGetSeek(t *testing.T) {
+	ctx := context.Background()
+	_, api, err := makeAPI(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	for name, opts := range map[string][]options.UnixfsAddOption{
+		"balanced":  {options.Unixfs.Chunker("size-7")},
+		"trickle":   {options.Unixfs.Chunker("size-7"), options.Unixfs.Layout(options.TrickleLayout)},
+		"rawLeaves": {options.Unixfs.Chunker("size-7"), options.Unixfs.RawLeaves(true)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := api.Unixfs().Add(ctx, files.NewReaderFile("", "", ioutil.NopCloser(bytes.NewReader(data)), nil), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := api.Unixfs().Get(ctx, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			size, err := f.Size()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(len(data)) {
+				t.Fatalf("expected size %d, got %d", len(data), size)
+			}
+
+			for _, off := range []int64{0, 6, 7, 500, 993, 999, 3, 700} {
+				if _, err := f.Seek(off, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				buf := make([]byte, 20)
+				n, err := io.ReadFull(f, buf)
+				if err != nil && err != io.ErrUnexpectedEOF {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf[:n], data[off:off+int64(n)]) {
+					t.Fatalf("wrong data at offset %d", off)
+				}
+				if exp := int64(len(data)) - off; n != 20 && int64(n) != exp {
+					t.Fatalf("short read at offset %d: %d", off, n)
+				}
+			}
+
+			end, err := f.Seek(0, io.SeekEnd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if end != int64(len(data)) {
+				t.Fatalf("expected to seek to %d, got %d", len(data), end)
+			}
+			if _, err := f.Read(make([]byte, 1)); err != io.EOF {
+				t.Fatalf("expected EOF, got %v", err)
+			}
+		})
+	}
+}
+
 func TestGetDir(t *testing.T) {
 	ctx := context.Background()
 	node, api, err := makeAPI(ctx)
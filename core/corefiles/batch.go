@@ -0,0 +1,254 @@
+package corefiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	gopath "path"
+	"sync"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+// ErrConflict is returned by Apply when MFS changed while the batch was
+// applied.
+var ErrConflict = errors.New("mfs changed while applying the batch")
+
+// applyLk serializes the batches, so that they only conflict with the other
+// changes of MFS.
+var applyLk sync.Mutex
+
+// Op is an operation of a batch, see Apply.
+type Op struct {
+	// Op is OpWrite, OpMove or OpRemove
+	Op string
+
+	// Path is the file written, the destination of moves or the entry
+	// removed
+	Path string
+
+	// From is the source of moves
+	From string
+
+	// Data is the content of the file written, replacing its previous
+	// content. The missing parent directories of the file are created.
+	Data io.Reader
+}
+
+// Apply applies ops in order to r and flushes it once, publishing a single
+// new root which it returns. The directories changed are converted to or from
+// HAMT shards according to shardSize, see AutoShard.
+//
+// The operations are applied to a copy of the tree, off to the side. The new
+// root is then swapped in holding lk, the lock of the changes of r, unless r
+// changed since the copy, in which case ErrConflict is returned: the roots
+// published never reflect a part of the batch, a failed batch leaves r
+// unchanged, and the changes of r made holding lk shared never interleave
+// with the swap.
+func Apply(ctx context.Context, r *mfs.Root, lk sync.Locker, ds ipld.DAGService, ops []Op, shardSize uint64) (ipld.Node, error) {
+	applyLk.Lock()
+	defer applyLk.Unlock()
+
+	live := r.GetDirectory()
+	base, err := live.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	pbase, ok := base.(*dag.ProtoNode)
+	if !ok {
+		return nil, dag.ErrNotProtobuf
+	}
+
+	scratch, err := mfs.NewRoot(ctx, ds, pbase, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+
+	for i, op := range ops {
+		if err := applyOp(scratch, op); err != nil {
+			return nil, fmt.Errorf("operation %d, %s %s: %s", i+1, op.Op, op.Path, err)
+		}
+	}
+	for _, op := range ops {
+		paths := []string{op.Path}
+		if op.Op == OpMove {
+			paths = append(paths, op.From)
+		}
+		AutoShardParents(ctx, scratch, ds, shardSize, paths...)
+	}
+	if _, err := scratch.GetDirectory().GetNode(); err != nil {
+		return nil, err
+	}
+
+	lk.Lock()
+	defer lk.Unlock()
+
+	current, err := live.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if !current.Cid().Equals(base.Cid()) {
+		return nil, ErrConflict
+	}
+	if err := replaceEntries(ctx, live, scratch.GetDirectory()); err != nil {
+		return nil, err
+	}
+	if err := r.Flush(); err != nil {
+		return nil, err
+	}
+	return live.GetNode()
+}
+
+func applyOp(r *mfs.Root, op Op) error {
+	switch op.Op {
+	case OpWrite:
+		return writeFile(r, op.Path, op.Data)
+	case OpMove:
+		return mfs.Mv(r, op.From, op.Path)
+	case OpRemove:
+		dir, name := gopath.Split(gopath.Clean(op.Path))
+		if name == "" {
+			return errors.New("cannot remove the root")
+		}
+		parent, err := mfs.Lookup(r, dir)
+		if err != nil {
+			return fmt.Errorf("parent lookup: %s", err)
+		}
+		pdir, ok := parent.(*mfs.Directory)
+		if !ok {
+			return fmt.Errorf("no such file or directory: %s", op.Path)
+		}
+		return pdir.Unlink(name)
+	default:
+		return fmt.Errorf("unsupported operation %q", op.Op)
+	}
+}
+
+// writeFile replaces the content of the file at path with the content of
+// data, creating it and its parents if needed.
+func writeFile(r *mfs.Root, path string, data io.Reader) error {
+	dir := gopath.Dir(gopath.Clean(path))
+	if dir != "/" {
+		err := mfs.Mkdir(r, dir, mfs.MkdirOpts{Mkparents: true})
+		if err != nil {
+			return err
+		}
+	}
+	return WriteFile(r, path, data, true)
+}
+
+// WriteFile replaces the content of the file at path in r with the content of
+// data, creating the file if needed in its parent directory, which must
+// exist. The changes are flushed up to the root if flush is set.
+func WriteFile(r *mfs.Root, path string, data io.Reader, flush bool) error {
+	if data == nil {
+		return errors.New("no data to write")
+	}
+	dir, name := gopath.Split(gopath.Clean(path))
+	if name == "" {
+		return errors.New("cannot write to the root")
+	}
+
+	parent, err := mfs.Lookup(r, dir)
+	if err != nil {
+		return err
+	}
+	pdir, ok := parent.(*mfs.Directory)
+	if !ok {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	child, err := pdir.Child(name)
+	if err == os.ErrNotExist {
+		nd := dag.NodeWithData(ft.FilePBData(nil, 0))
+		nd.SetCidBuilder(pdir.GetCidBuilder())
+		if err := pdir.AddChild(name, nd); err != nil {
+			return err
+		}
+		child, err = pdir.Child(name)
+	}
+	if err != nil {
+		return err
+	}
+	fi, ok := child.(*mfs.File)
+	if !ok {
+		return fmt.Errorf("%s is not a file", path)
+	}
+
+	wfd, err := fi.Open(mfs.OpenWriteOnly, flush)
+	if err != nil {
+		return err
+	}
+	if err := wfd.Truncate(0); err != nil {
+		wfd.Close()
+		return err
+	}
+	if _, err := io.Copy(wfd, data); err != nil {
+		wfd.Close()
+		return err
+	}
+	return wfd.Close()
+}
+
+// replaceEntries makes the entries of dst those of src, replacing the entries
+// which differ.
+func replaceEntries(ctx context.Context, dst, src *mfs.Directory) error {
+	names, err := src.ListNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	kept := make(map[string]bool, len(names))
+	for _, name := range names {
+		kept[name] = true
+
+		child, err := src.Child(name)
+		if err != nil {
+			return err
+		}
+		nd, err := child.GetNode()
+		if err != nil {
+			return err
+		}
+
+		old, err := dst.Child(name)
+		switch err {
+		case nil:
+			oldnd, err := old.GetNode()
+			if err != nil {
+				return err
+			}
+			if oldnd.Cid().Equals(nd.Cid()) {
+				continue
+			}
+			if err := dst.Unlink(name); err != nil {
+				return err
+			}
+		case os.ErrNotExist:
+		default:
+			return err
+		}
+		if err := dst.AddChild(name, nd); err != nil {
+			return err
+		}
+	}
+
+	oldNames, err := dst.ListNames(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range oldNames {
+		if !kept[name] {
+			if err := dst.Unlink(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
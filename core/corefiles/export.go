@@ -0,0 +1,202 @@
+package corefiles
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("corefiles")
+
+// ExportResult counts the changes written by Exporter.Sync.
+type ExportResult struct {
+	// Written is the number of files and directories written
+	Written uint64
+
+	// Removed is the number of files and directories removed as they were
+	// removed from MFS
+	Removed uint64
+}
+
+// Exporter writes an entry of MFS to the local filesystem, and then the
+// changes of the entry.
+type Exporter struct {
+	r    *mfs.Root
+	path string
+	dest string
+
+	// exported holds the CIDs of the entries written, by local path
+	exported map[string]cid.Cid
+}
+
+// NewExporter returns an exporter of the entry at path in r to the local path
+// dest, a directory for directories.
+func NewExporter(r *mfs.Root, path, dest string) *Exporter {
+	return &Exporter{
+		r:        r,
+		path:     path,
+		dest:     filepath.Clean(dest),
+		exported: make(map[string]cid.Cid),
+	}
+}
+
+// Sync writes the files and directories which changed since the last sync,
+// and removes the ones removed from MFS. The local files which weren't
+// exported are left alone, and so are the directories containing them.
+func (e *Exporter) Sync(ctx context.Context) (ExportResult, error) {
+	var res ExportResult
+
+	fsn, err := mfs.Lookup(e.r, e.path)
+	if err != nil {
+		return res, err
+	}
+
+	seen := make(map[string]bool)
+	// the directories unchanged, whose entries weren't walked
+	var unchanged []string
+	if err := e.export(ctx, fsn, e.dest, seen, &unchanged, &res); err != nil {
+		return res, err
+	}
+
+	// remove the deepest entries first, the directories once empty
+	var removed []string
+	for local := range e.exported {
+		if !seen[local] && !under(local, unchanged) {
+			removed = append(removed, local)
+		}
+	}
+	sortDeepestFirst(removed)
+	for _, local := range removed {
+		delete(e.exported, local)
+		if err := os.Remove(local); err != nil {
+			if !os.IsNotExist(err) {
+				log.Debugf("export: removing %s: %s", local, err)
+			}
+			continue
+		}
+		res.Removed++
+	}
+	return res, nil
+}
+
+func (e *Exporter) export(ctx context.Context, fsn mfs.FSNode, local string, seen map[string]bool, unchanged *[]string, res *ExportResult) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	nd, err := fsn.GetNode()
+	if err != nil {
+		return err
+	}
+	seen[local] = true
+	prev, wasExported := e.exported[local]
+
+	switch fsn := fsn.(type) {
+	case *mfs.Directory:
+		if wasExported && prev.Equals(nd.Cid()) {
+			*unchanged = append(*unchanged, local)
+			return nil
+		}
+		if err := os.MkdirAll(local, 0755); err != nil {
+			return err
+		}
+		names, err := fsn.ListNames(ctx)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+				return fmt.Errorf("export: invalid name %q", name)
+			}
+			child, err := fsn.Child(name)
+			if err != nil {
+				return err
+			}
+			if err := e.export(ctx, child, filepath.Join(local, name), seen, unchanged, res); err != nil {
+				return err
+			}
+		}
+	case *mfs.File:
+		if wasExported && prev.Equals(nd.Cid()) {
+			return nil
+		}
+		if err := writeLocalFile(fsn, local); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("export: unsupported entry at %s", local)
+	}
+
+	md, err := ReadMetadata(nd)
+	if err != nil {
+		return err
+	}
+	if md.Mode != 0 {
+		if err := os.Chmod(local, os.FileMode(md.Mode&0777)); err != nil {
+			return err
+		}
+	}
+	if !md.Mtime.IsZero() {
+		if err := os.Chtimes(local, md.Mtime, md.Mtime); err != nil {
+			return err
+		}
+	}
+
+	e.exported[local] = nd.Cid()
+	res.Written++
+	return nil
+}
+
+// writeLocalFile writes the content of fi to local through a temporary file,
+// so that readers never see the file partly written.
+func writeLocalFile(fi *mfs.File, local string) error {
+	rfd, err := fi.Open(mfs.OpenReadOnly, false)
+	if err != nil {
+		return err
+	}
+	defer rfd.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(local), ".export-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, rfd)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), local)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// under returns true if local is below one of dirs.
+func under(local string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(local, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortDeepestFirst(paths []string) {
+	sort.Slice(paths, func(i, j int) bool {
+		return len(paths[i]) > len(paths[j])
+	})
+}
@@ -0,0 +1,92 @@
+package corefiles
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	mdtest "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag/test"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+func TestExporter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := mfs.NewRoot(ctx, mdtest.Mock(), ft.EmptyDirNode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, content := range map[string]string{"/dir/a": "a", "/dir/sub/b": "b"} {
+		if err := writeFile(r, p, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dest := filepath.Join(tmp, "out")
+
+	checkFile := func(rel, expected string) {
+		t.Helper()
+		b, err := ioutil.ReadFile(filepath.Join(dest, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Fatalf("expected %q in %s, got %q", expected, rel, b)
+		}
+	}
+
+	e := NewExporter(r, "/dir", dest)
+	res, err := e.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the directories and the files
+	if res.Written != 4 || res.Removed != 0 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	checkFile("a", "a")
+	checkFile("sub/b", "b")
+
+	res, err = e.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Written != 0 || res.Removed != 0 {
+		t.Fatalf("expected nothing to change, got %+v", res)
+	}
+
+	if err := writeFile(r, "/dir/a", strings.NewReader("changed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyOp(r, Op{Op: OpRemove, Path: "/dir/sub"}); err != nil {
+		t.Fatal(err)
+	}
+	// a local file not exported is kept
+	if err := ioutil.WriteFile(filepath.Join(dest, "local"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = e.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// /dir and /dir/a written, sub and sub/b removed
+	if res.Written != 2 || res.Removed != 2 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	checkFile("a", "changed")
+	checkFile("local", "local")
+	if _, err := os.Stat(filepath.Join(dest, "sub")); !os.IsNotExist(err) {
+		t.Fatalf("expected sub to be removed: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package corefiles
+
+import (
+	"sync"
+	"time"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+// FlushPolicy sets when the changes of MFS are flushed to its root in
+// write-back mode. The zero policy is write-through: every change is flushed.
+type FlushPolicy struct {
+	// Interval is the longest time the changes wait to be flushed, 0 not to
+	// flush them on an interval
+	Interval time.Duration
+
+	// Ops is the number of changes flushed together, 0 not to flush them
+	// after a number of changes
+	Ops int
+}
+
+// WriteBack returns true if the changes are flushed by the policy rather
+// than by each change.
+func (p FlushPolicy) WriteBack() bool {
+	return p.Interval > 0 || p.Ops > 0
+}
+
+// Flusher flushes the changes of MFS made without flushing them, according
+// to its policy.
+type Flusher struct {
+	r      *mfs.Root
+	policy FlushPolicy
+
+	lk      sync.Mutex
+	pending int
+	closed  bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewFlusher returns a flusher of the changes of r, flushing them on the
+// interval of policy until closed.
+func NewFlusher(r *mfs.Root, policy FlushPolicy) *Flusher {
+	f := &Flusher{
+		r:      r,
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+	if policy.Interval > 0 {
+		f.wg.Add(1)
+		go f.loop()
+	}
+	return f
+}
+
+// WriteBack returns true if the changes should be made without flushing
+// them, and reported with Changed.
+func (f *Flusher) WriteBack() bool {
+	return f.policy.WriteBack()
+}
+
+// Changed records a change made without flushing it, flushing the pending
+// changes once they reach the number of changes of the policy.
+func (f *Flusher) Changed() {
+	if !f.WriteBack() {
+		return
+	}
+
+	f.lk.Lock()
+	f.pending++
+	full := f.policy.Ops > 0 && f.pending >= f.policy.Ops
+	f.lk.Unlock()
+
+	if full {
+		if err := f.Flush(); err != nil {
+			log.Errorf("flushing mfs: %s", err)
+		}
+	}
+}
+
+// Pending returns the number of changes waiting to be flushed.
+func (f *Flusher) Pending() int {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	return f.pending
+}
+
+// Flush flushes the pending changes and waits for the new root to be
+// published. It is the barrier of the write-back mode: the changes made
+// before it returns are durable.
+func (f *Flusher) Flush() error {
+	f.lk.Lock()
+	f.pending = 0
+	f.lk.Unlock()
+
+	return mfs.FlushPath(f.r, "/")
+}
+
+// Close stops flushing on the interval, and flushes the pending changes.
+func (f *Flusher) Close() error {
+	f.lk.Lock()
+	if f.closed {
+		f.lk.Unlock()
+		return nil
+	}
+	f.closed = true
+	pending := f.pending
+	f.lk.Unlock()
+
+	close(f.done)
+	f.wg.Wait()
+	if pending == 0 {
+		return nil
+	}
+	return f.Flush()
+}
+
+func (f *Flusher) loop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.policy.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if f.Pending() == 0 {
+				continue
+			}
+			if err := f.Flush(); err != nil {
+				log.Errorf("flushing mfs: %s", err)
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package corefiles
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	mdtest "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag/test"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+func TestFlusher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pf := func(context.Context, cid.Cid) error { return nil }
+	r, err := mfs.NewRoot(ctx, mdtest.Mock(), ft.EmptyDirNode(), pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wt := NewFlusher(r, FlushPolicy{})
+	defer wt.Close()
+	wt.Changed()
+	if wt.WriteBack() || wt.Pending() != 0 {
+		t.Fatal("expected the zero policy to be write-through")
+	}
+
+	byOps := NewFlusher(r, FlushPolicy{Ops: 3})
+	defer byOps.Close()
+	byOps.Changed()
+	byOps.Changed()
+	if n := byOps.Pending(); n != 2 {
+		t.Fatalf("expected 2 pending changes, got %d", n)
+	}
+	byOps.Changed()
+	if n := byOps.Pending(); n != 0 {
+		t.Fatalf("expected the changes to be flushed, got %d pending", n)
+	}
+
+	byInterval := NewFlusher(r, FlushPolicy{Interval: 10 * time.Millisecond})
+	defer byInterval.Close()
+	byInterval.Changed()
+	deadline := time.Now().Add(5 * time.Second)
+	for byInterval.Pending() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the changes to be flushed on the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
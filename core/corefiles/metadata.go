@@ -0,0 +1,296 @@
+package corefiles
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	gopath "path"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+// The fields of the unixfs data holding the metadata, as specified by unixfs
+// 1.5. The version of go-unixfs in use doesn't know them, they are read and
+// written here.
+const (
+	fieldMode  = 7
+	fieldMtime = 8
+
+	fieldMtimeSeconds = 1
+	fieldMtimeNanos   = 2
+)
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ModeMask is the mask of the mode bits stored: the permissions, setuid,
+// setgid and sticky bits.
+const ModeMask = 07777
+
+var (
+	errRootMetadata = errors.New("cannot set the metadata of the root")
+	errMalformed    = errors.New("malformed unixfs data")
+)
+
+// Metadata is the POSIX metadata of a unixfs node.
+type Metadata struct {
+	// Mode holds the permission bits, see ModeMask, 0 when unset
+	Mode uint32
+
+	// Mtime is the modification time, zero when unset
+	Mtime time.Time
+}
+
+// ReadMetadata returns the metadata of nd, none for the nodes that aren't
+// unixfs protobuf nodes.
+func ReadMetadata(nd ipld.Node) (Metadata, error) {
+	var md Metadata
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return md, nil
+	}
+
+	err := walkFields(pn.Data(), func(num, wt int, _, value []byte) error {
+		switch {
+		case num == fieldMode && wt == wireVarint:
+			mode, _ := binary.Uvarint(value)
+			md.Mode = uint32(mode) & ModeMask
+		case num == fieldMtime && wt == wireBytes:
+			mtime, err := readMtime(value)
+			if err != nil {
+				return err
+			}
+			md.Mtime = mtime
+		}
+		return nil
+	})
+	return md, err
+}
+
+func readMtime(b []byte) (time.Time, error) {
+	var secs int64
+	var nanos uint32
+	err := walkFields(b, func(num, wt int, _, value []byte) error {
+		switch {
+		case num == fieldMtimeSeconds && wt == wireVarint:
+			v, _ := binary.Uvarint(value)
+			secs = int64(v)
+		case num == fieldMtimeNanos && wt == wireFixed32:
+			nanos = binary.LittleEndian.Uint32(value)
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nanos >= uint32(time.Second) {
+		return time.Time{}, errMalformed
+	}
+	return time.Unix(secs, int64(nanos)), nil
+}
+
+// WithMetadata returns a copy of nd, a unixfs protobuf node, with its metadata
+// replaced by md.
+func WithMetadata(nd *dag.ProtoNode, md Metadata) (*dag.ProtoNode, error) {
+	var data []byte
+	err := walkFields(nd.Data(), func(num, _ int, field, _ []byte) error {
+		if num != fieldMode && num != fieldMtime {
+			data = append(data, field...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if md.Mode != 0 {
+		data = appendTag(data, fieldMode, wireVarint)
+		data = appendUvarint(data, uint64(md.Mode&ModeMask))
+	}
+	if !md.Mtime.IsZero() {
+		var mtime []byte
+		mtime = appendTag(mtime, fieldMtimeSeconds, wireVarint)
+		mtime = appendUvarint(mtime, uint64(md.Mtime.Unix()))
+		if nanos := md.Mtime.Nanosecond(); nanos != 0 {
+			var b [4]byte
+			binary.LittleEndian.PutUint32(b[:], uint32(nanos))
+			mtime = appendTag(mtime, fieldMtimeNanos, wireFixed32)
+			mtime = append(mtime, b[:]...)
+		}
+		data = appendTag(data, fieldMtime, wireBytes)
+		data = appendUvarint(data, uint64(len(mtime)))
+		data = append(data, mtime...)
+	}
+
+	out := nd.Copy().(*dag.ProtoNode)
+	out.SetData(data)
+	return out, nil
+}
+
+// Chmod sets the mode of the entry at path in r to the permission bits of
+// mode.
+func Chmod(r *mfs.Root, path string, mode uint32, flush bool) error {
+	return updateMetadata(r, path, flush, func(md *Metadata) {
+		md.Mode = mode & ModeMask
+	})
+}
+
+// Touch sets the modification time of the entry at path in r to mtime,
+// creating an empty file if path doesn't exist.
+func Touch(r *mfs.Root, path string, mtime time.Time, flush bool) error {
+	return updateMetadata(r, path, flush, func(md *Metadata) {
+		md.Mtime = mtime
+	})
+}
+
+// updateMetadata replaces the entry at path with a copy having its metadata
+// updated by update. The entries stored as a single raw block are wrapped in
+// a unixfs file node to hold the metadata.
+func updateMetadata(r *mfs.Root, path string, flush bool, update func(*Metadata)) error {
+	path = gopath.Clean(path)
+	if path == "/" {
+		return errRootMetadata
+	}
+
+	dir, name := gopath.Split(path)
+	parent, err := mfs.Lookup(r, dir)
+	if err != nil {
+		return fmt.Errorf("parent lookup: %s", err)
+	}
+	pdir, ok := parent.(*mfs.Directory)
+	if !ok {
+		return fmt.Errorf("no such file or directory: %s", path)
+	}
+
+	var nd ipld.Node
+	child, err := pdir.Child(name)
+	switch err {
+	case nil:
+		if nd, err = child.GetNode(); err != nil {
+			return err
+		}
+	case os.ErrNotExist:
+		nd = dag.NodeWithData(ft.FilePBData(nil, 0))
+	default:
+		return err
+	}
+
+	var pn *dag.ProtoNode
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		pn = nd
+	case *dag.RawNode:
+		if pn, err = wrapRaw(nd, pdir.GetCidBuilder()); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%s isn't a unixfs node", path)
+	}
+
+	md, err := ReadMetadata(pn)
+	if err != nil {
+		return err
+	}
+	update(&md)
+	if pn, err = WithMetadata(pn, md); err != nil {
+		return err
+	}
+	pn.SetCidBuilder(pdir.GetCidBuilder())
+
+	if child != nil {
+		if err := pdir.Unlink(name); err != nil {
+			return err
+		}
+	}
+	if err := pdir.AddChild(name, pn); err != nil {
+		return err
+	}
+	if flush {
+		return pdir.Flush()
+	}
+	return nil
+}
+
+// wrapRaw returns a unixfs file node with raw as its only block.
+func wrapRaw(raw *dag.RawNode, builder cid.Builder) (*dag.ProtoNode, error) {
+	fsn := ft.NewFSNode(ft.TFile)
+	fsn.AddBlockSize(uint64(len(raw.RawData())))
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	pn := dag.NodeWithData(data)
+	pn.SetCidBuilder(builder)
+	if err := pn.AddNodeLink("", raw); err != nil {
+		return nil, err
+	}
+	return pn, nil
+}
+
+// walkFields calls fn with the number, the wire type, the encoding and the
+// value of each field of the protobuf message b. The value of the varints is
+// their encoding, the value of the length-delimited fields their content.
+func walkFields(b []byte, fn func(num, wt int, field, value []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformed
+		}
+		num, wt := int(tag>>3), int(tag&7)
+
+		start := n
+		end := 0
+		switch wt {
+		case wireVarint:
+			_, m := binary.Uvarint(b[start:])
+			if m <= 0 {
+				return errMalformed
+			}
+			end = start + m
+		case wireFixed64:
+			end = start + 8
+		case wireFixed32:
+			end = start + 4
+		case wireBytes:
+			size, m := binary.Uvarint(b[start:])
+			if m <= 0 || size > uint64(len(b)) {
+				return errMalformed
+			}
+			start += m
+			end = start + int(size)
+		default:
+			return errMalformed
+		}
+		if end > len(b) {
+			return errMalformed
+		}
+
+		if err := fn(num, wt, b[:end], b[start:end]); err != nil {
+			return err
+		}
+		b = b[end:]
+	}
+	return nil
+}
+
+func appendTag(b []byte, num, wt int) []byte {
+	return appendUvarint(b, uint64(num)<<3|uint64(wt))
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
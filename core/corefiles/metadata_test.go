@@ -0,0 +1,75 @@
+package corefiles
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+func TestMetadata(t *testing.T) {
+	nd := dag.NodeWithData(ft.FilePBData([]byte("hello"), 5))
+
+	md, err := ReadMetadata(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Mode != 0 || !md.Mtime.IsZero() {
+		t.Fatalf("expected no metadata, got %+v", md)
+	}
+
+	want := Metadata{Mode: 0755, Mtime: time.Unix(1500000000, 42)}
+	withMD, err := WithMetadata(nd, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err = ReadMetadata(withMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Mode != want.Mode || !md.Mtime.Equal(want.Mtime) {
+		t.Fatalf("expected %+v, got %+v", want, md)
+	}
+	if !bytes.HasPrefix(withMD.Data(), nd.Data()) {
+		t.Fatal("expected the unixfs data to be kept")
+	}
+
+	// replacing the metadata drops the fields unset
+	withMode, err := WithMetadata(withMD, Metadata{Mode: 0600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err = ReadMetadata(withMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Mode != 0600 || !md.Mtime.IsZero() {
+		t.Fatalf("expected only the mode, got %+v", md)
+	}
+
+	cleared, err := WithMetadata(withMode, Metadata{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cleared.Data(), nd.Data()) {
+		t.Fatal("expected clearing the metadata to restore the original data")
+	}
+}
+
+func TestMetadataNegativeMtime(t *testing.T) {
+	nd := dag.NodeWithData(ft.FilePBData(nil, 0))
+	want := time.Unix(-86400, 5)
+	withMD, err := WithMetadata(nd, Metadata{Mtime: want})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md, err := ReadMetadata(withMD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !md.Mtime.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, md.Mtime)
+	}
+}
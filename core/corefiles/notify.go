@@ -0,0 +1,131 @@
+// Package corefiles implements the operations on the mutable filesystem of
+// the nodes, MFS, shared by the commands and the CoreAPI.
+package corefiles
+
+import (
+	"context"
+	"sync"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+// Operations changing MFS, see Event.
+const (
+	OpWrite   = "write"
+	OpMkdir   = "mkdir"
+	OpCopy    = "cp"
+	OpMove    = "mv"
+	OpRemove  = "rm"
+	OpChcid   = "chcid"
+	OpChmod   = "chmod"
+	OpTouch   = "touch"
+	OpPublish = "publish"
+)
+
+// eventBuffer is the number of events buffered for each watcher.
+const eventBuffer = 64
+
+// Event describes a change of MFS.
+type Event struct {
+	// Op is the operation, OpPublish when a new root was published
+	Op string
+
+	// Path is the path changed, the destination of moves and copies
+	Path string
+
+	// From is the source of moves
+	From string
+
+	// Cid is the new CID of Path, undefined after removals
+	Cid cid.Cid
+
+	// Missed is the number of events missed before this one because the
+	// watcher didn't keep up. Watchers missing events should rescan MFS.
+	Missed uint64
+}
+
+// Notifier sends the changes of MFS to its watchers.
+type Notifier struct {
+	lk       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+type watcher struct {
+	ch     chan Event
+	missed uint64
+}
+
+// NewNotifier returns a notifier without watchers.
+func NewNotifier() *Notifier {
+	return &Notifier{watchers: make(map[*watcher]struct{})}
+}
+
+// Watch returns a channel receiving the changes of MFS until ctx is
+// canceled.
+func (n *Notifier) Watch(ctx context.Context) <-chan Event {
+	w := &watcher{ch: make(chan Event, eventBuffer)}
+
+	n.lk.Lock()
+	n.watchers[w] = struct{}{}
+	n.lk.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		n.lk.Lock()
+		delete(n.watchers, w)
+		close(w.ch)
+		n.lk.Unlock()
+	}()
+	return w.ch
+}
+
+// Watched returns true if changes have watchers, so that the callers can skip
+// computing the events nobody watches.
+func (n *Notifier) Watched() bool {
+	if n == nil {
+		return false
+	}
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	return len(n.watchers) > 0
+}
+
+// Notify sends ev to the watchers, without waiting for the slow ones: they
+// miss the event and are told so with the next event they receive. A nil
+// notifier drops the events.
+func (n *Notifier) Notify(ev Event) {
+	if n == nil {
+		return
+	}
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	for w := range n.watchers {
+		wev := ev
+		wev.Missed = w.missed
+		select {
+		case w.ch <- wev:
+			w.missed = 0
+		default:
+			w.missed++
+		}
+	}
+}
+
+// NotifyChange sends the change of path in r to the watchers, with the new CID
+// of path unless it was removed.
+func (n *Notifier) NotifyChange(r *mfs.Root, op, path, from string) {
+	if !n.Watched() {
+		return
+	}
+
+	ev := Event{Op: op, Path: path, From: from}
+	if op != OpRemove {
+		if fsn, err := mfs.Lookup(r, path); err == nil {
+			if nd, err := fsn.GetNode(); err == nil {
+				ev.Cid = nd.Cid()
+			}
+		}
+	}
+	n.Notify(ev)
+}
@@ -0,0 +1,43 @@
+package corefiles
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNotifier(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	n := NewNotifier()
+	if n.Watched() {
+		t.Fatal("expected no watchers")
+	}
+	events := n.Watch(ctx)
+	if !n.Watched() {
+		t.Fatal("expected a watcher")
+	}
+
+	// overflow the buffer of the watcher
+	for i := 0; i < eventBuffer+2; i++ {
+		n.Notify(Event{Op: OpWrite, Path: "/a"})
+	}
+	for i := 0; i < eventBuffer; i++ {
+		if ev := <-events; ev.Missed != 0 {
+			t.Fatalf("expected the buffered events to be complete, got %d missed", ev.Missed)
+		}
+	}
+	n.Notify(Event{Op: OpRemove, Path: "/a"})
+	if ev := <-events; ev.Op != OpRemove || ev.Missed != 2 {
+		t.Errorf("expected a removal after 2 missed events, got %+v", ev)
+	}
+
+	cancel()
+	for range events {
+	}
+	if n.Watched() {
+		t.Error("expected the watcher to be removed")
+	}
+
+	var none *Notifier
+	none.Notify(Event{Op: OpWrite})
+}
@@ -0,0 +1,317 @@
+package corefiles
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	gopath "path"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+	hamt "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs/hamt"
+	uio "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs/io"
+)
+
+// DefaultShardSize is the size of the block of a basic directory above which
+// 'ipfs files shard -r' converts it to a HAMT shard when no size is set.
+// Directories of this size have about 5000 entries, and their blocks are well
+// below the limit of bitswap.
+const DefaultShardSize = 256 << 10
+
+// linkOverhead estimates the size of the encoding of a link in a directory
+// block, besides its name and CID: the tags, the lengths and the size.
+const linkOverhead = 12
+
+var errShardRoot = errors.New("cannot convert the root directory, move its entries to a directory")
+
+// IsSharded returns true if nd is a HAMT shard.
+func IsSharded(nd ipld.Node) bool {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return false
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	return err == nil && fsn.Type() == ft.THAMTShard
+}
+
+// Shard converts the basic directory at path in r to a HAMT shard, or a HAMT
+// shard to a basic directory if sharded is false. It returns false if the
+// directory was already in the format requested.
+func Shard(ctx context.Context, r *mfs.Root, ds ipld.DAGService, path string, sharded bool) (bool, error) {
+	path = gopath.Clean(path)
+	if path == "/" {
+		return false, errShardRoot
+	}
+
+	pdir, name, nd, err := lookupDir(r, path)
+	if err != nil {
+		return false, err
+	}
+	if IsSharded(nd) == sharded {
+		return false, nil
+	}
+
+	var converted *dag.ProtoNode
+	if sharded {
+		converted, err = toShard(ctx, ds, nd)
+	} else {
+		converted, err = toBasic(ctx, ds, nd)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// keep the metadata set by chmod and touch
+	md, err := ReadMetadata(nd)
+	if err != nil {
+		return false, err
+	}
+	if converted, err = WithMetadata(converted, md); err != nil {
+		return false, err
+	}
+
+	if err := pdir.Unlink(name); err != nil {
+		return false, err
+	}
+	if err := pdir.AddChild(name, converted); err != nil {
+		return false, err
+	}
+	return true, pdir.Flush()
+}
+
+// AutoShard converts the directory at path in r to a HAMT shard if its block
+// grew above size, and back to a basic directory if it shrank below half of
+// it. It returns true if the directory was converted. The root, which can't
+// be converted, the missing directories and a zero size are ignored.
+func AutoShard(ctx context.Context, r *mfs.Root, ds ipld.DAGService, path string, size uint64) (bool, error) {
+	path = gopath.Clean(path)
+	if size == 0 || path == "/" {
+		return false, nil
+	}
+	if _, err := mfs.Lookup(r, path); err == os.ErrNotExist {
+		return false, nil
+	}
+
+	_, _, nd, err := lookupDir(r, path)
+	if err != nil {
+		return false, err
+	}
+
+	if !IsSharded(nd) {
+		if uint64(len(nd.RawData())) <= size {
+			return false, nil
+		}
+		return Shard(ctx, r, ds, path, true)
+	}
+
+	basic, err := shardSize(ctx, ds, nd, size/2)
+	if err != nil || basic >= size/2 {
+		return false, err
+	}
+	return Shard(ctx, r, ds, path, false)
+}
+
+// AutoShardParents calls AutoShard on the parent directories of paths, the
+// directories which entries were added to or removed from. The errors are
+// logged: the changes of the directories were made.
+func AutoShardParents(ctx context.Context, r *mfs.Root, ds ipld.DAGService, size uint64, paths ...string) {
+	for _, p := range paths {
+		dir := gopath.Dir(gopath.Clean(p))
+		if _, err := AutoShard(ctx, r, ds, dir, size); err != nil {
+			log.Errorf("converting %s to or from a HAMT shard: %s", dir, err)
+		}
+	}
+}
+
+// AutoShardTree calls AutoShard on the directory at path and on all the
+// directories below it, and returns the paths of the directories converted.
+func AutoShardTree(ctx context.Context, r *mfs.Root, ds ipld.DAGService, path string, size uint64) ([]string, error) {
+	path = gopath.Clean(path)
+	fsn, err := mfs.Lookup(r, path)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := fsn.(*mfs.Directory)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+
+	names, err := dir.ListNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var converted []string
+	for _, name := range names {
+		child, err := dir.Child(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := child.(*mfs.Directory); !ok {
+			continue
+		}
+		below, err := AutoShardTree(ctx, r, ds, gopath.Join(path, name), size)
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, below...)
+	}
+
+	ok, err = AutoShard(ctx, r, ds, path, size)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		converted = append(converted, path)
+	}
+	return converted, nil
+}
+
+// lookupDir returns the parent of the directory at path, its name and its
+// node.
+func lookupDir(r *mfs.Root, path string) (*mfs.Directory, string, *dag.ProtoNode, error) {
+	dir, name := gopath.Split(path)
+	parent, err := mfs.Lookup(r, dir)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("parent lookup: %s", err)
+	}
+	pdir, ok := parent.(*mfs.Directory)
+	if !ok {
+		return nil, "", nil, fmt.Errorf("no such file or directory: %s", path)
+	}
+
+	child, err := pdir.Child(name)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if _, ok := child.(*mfs.Directory); !ok {
+		return nil, "", nil, fmt.Errorf("%s is not a directory", path)
+	}
+	nd, err := child.GetNode()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, "", nil, dag.ErrNotProtobuf
+	}
+	return pdir, name, pn, nil
+}
+
+// shardSize estimates the size the block of the HAMT shard nd would have as a
+// basic directory, walking its child shards until the estimate reaches limit.
+func shardSize(ctx context.Context, ds ipld.DAGService, nd *dag.ProtoNode, limit uint64) (uint64, error) {
+	prefixLen := len(fmt.Sprintf("%X", uio.DefaultShardWidth-1))
+
+	var size uint64
+	for _, l := range nd.Links() {
+		if size >= limit {
+			break
+		}
+		if len(l.Name) > prefixLen {
+			size += uint64(len(l.Name)-prefixLen+len(l.Cid.Bytes())) + linkOverhead
+			continue
+		}
+
+		// a link to a child shard
+		child, err := l.GetNode(ctx, ds)
+		if err != nil {
+			return 0, err
+		}
+		pn, ok := child.(*dag.ProtoNode)
+		if !ok {
+			return 0, dag.ErrNotProtobuf
+		}
+		below, err := shardSize(ctx, ds, pn, limit-size)
+		if err != nil {
+			return 0, err
+		}
+		size += below
+	}
+	return size, nil
+}
+
+// linkNode stands for the node of a link set in a HAMT shard, so that the
+// entries are moved without being fetched: the shard only reads the CID and
+// the size of the node.
+type linkNode struct {
+	ipld.Node
+	l *ipld.Link
+}
+
+func (n *linkNode) Cid() cid.Cid {
+	return n.l.Cid
+}
+
+func (n *linkNode) Size() (uint64, error) {
+	return n.l.Size, nil
+}
+
+// linkDAG skips the linkNodes added, they are already stored.
+type linkDAG struct {
+	ipld.DAGService
+}
+
+func (ds linkDAG) Add(ctx context.Context, nd ipld.Node) error {
+	if _, ok := nd.(*linkNode); ok {
+		return nil
+	}
+	return ds.DAGService.Add(ctx, nd)
+}
+
+func (ds linkDAG) AddMany(ctx context.Context, nds []ipld.Node) error {
+	var out []ipld.Node
+	for _, nd := range nds {
+		if _, ok := nd.(*linkNode); !ok {
+			out = append(out, nd)
+		}
+	}
+	return ds.DAGService.AddMany(ctx, out)
+}
+
+// toShard converts the basic directory nd to a HAMT shard, from the CIDs,
+// the names and the sizes of its links.
+func toShard(ctx context.Context, ds ipld.DAGService, nd *dag.ProtoNode) (*dag.ProtoNode, error) {
+	shard, err := hamt.NewShard(linkDAG{ds}, uio.DefaultShardWidth)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range nd.Links() {
+		if err := shard.Set(ctx, l.Name, &linkNode{l: l}); err != nil {
+			return nil, err
+		}
+	}
+
+	snd, err := shard.Node()
+	if err != nil {
+		return nil, err
+	}
+	pn, ok := snd.(*dag.ProtoNode)
+	if !ok {
+		return nil, dag.ErrNotProtobuf
+	}
+	return pn, nil
+}
+
+func toBasic(ctx context.Context, ds ipld.DAGService, nd *dag.ProtoNode) (*dag.ProtoNode, error) {
+	dir, err := uio.NewDirectoryFromNode(ds, nd)
+	if err != nil {
+		return nil, err
+	}
+	links, err := dir.Links(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	basic := ft.EmptyDirNode()
+	basic.SetCidBuilder(nd.CidBuilder())
+	for _, l := range links {
+		if err := basic.AddRawLink(l.Name, l); err != nil {
+			return nil, err
+		}
+	}
+	return basic, nil
+}
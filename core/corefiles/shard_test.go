@@ -0,0 +1,122 @@
+package corefiles
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	mdtest "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag/test"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+	uio "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs/io"
+)
+
+func TestAutoShard(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := mdtest.Mock()
+	r, err := mfs.NewRoot(ctx, ds, ft.EmptyDirNode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		p := fmt.Sprintf("/dir/file-%02d", i)
+		if err := writeFile(r, p, strings.NewReader(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sharded := func() bool {
+		t.Helper()
+		_, _, nd, err := lookupDir(r, "/dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return IsSharded(nd)
+	}
+
+	// well below the size of the directory, and above half of it once sharded
+	const size = 1 << 10
+	ok, err := AutoShard(ctx, r, ds, "/dir", size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || !sharded() {
+		t.Fatal("expected the directory to be converted to a shard")
+	}
+
+	names, err := mfs.Lookup(r, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := names.(*mfs.Directory).ListNames(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 50 {
+		t.Fatalf("expected the shard to hold the 50 entries, got %d", len(list))
+	}
+
+	if ok, err := AutoShard(ctx, r, ds, "/dir", size); err != nil || ok {
+		t.Fatalf("expected the shard to be left alone, got %t, %v", ok, err)
+	}
+
+	if ok, err := AutoShard(ctx, r, ds, "/dir", 1<<20); err != nil || !ok {
+		t.Fatalf("expected the shard to be converted back, got %t, %v", ok, err)
+	}
+	if sharded() {
+		t.Fatal("expected a basic directory")
+	}
+
+	if _, err := Shard(ctx, r, ds, "/", true); err != errShardRoot {
+		t.Fatalf("expected the root not to be converted, got %v", err)
+	}
+}
+
+func TestShardWithoutFetching(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ds := mdtest.Mock()
+	r, err := mfs.NewRoot(ctx, ds, ft.EmptyDirNode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the entries needn't be stored to be moved to the shard
+	missing := dag.NodeWithData([]byte("not stored"))
+	dir := ft.EmptyDirNode()
+	if err := dir.AddRawLink("missing", &ipld.Link{Cid: missing.Cid(), Size: 10}); err != nil {
+		t.Fatal(err)
+	}
+	root, err := mfs.Lookup(r, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.(*mfs.Directory).AddChild("dir", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := Shard(ctx, r, ds, "/dir", true); err != nil || !ok {
+		t.Fatalf("expected the directory to be converted, got %t, %v", ok, err)
+	}
+	_, _, nd, err := lookupDir(r, "/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shard, err := uio.NewDirectoryFromNode(ds, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := shard.Links(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || !links[0].Cid.Equals(missing.Cid()) || links[0].Size != 10 {
+		t.Fatalf("expected the link of the entry in the shard, got %v", links)
+	}
+}
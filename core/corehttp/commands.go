@@ -8,11 +8,14 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	version "github.com/ipfs/go-ipfs"
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	"github.com/ipfs/go-ipfs/core"
+	audit "github.com/ipfs/go-ipfs/core/audit"
 	corecommands "github.com/ipfs/go-ipfs/core/commands"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
 	path "gx/ipfs/QmZErC2Ay6WuGi96CPg316PwitdwgLo6RxZRqVjJjRj2MR/go-path"
@@ -130,11 +133,133 @@ func commandsOption(cctx oldcmds.Context, command *cmds.Command) ServeOption {
 		patchCORSVars(cfg, l.Addr())
 
 		cmdHandler := cmdsHttp.NewHandler(&cctx, command, cfg)
-		mux.Handle(APIPath+"/", cmdHandler)
+		mux.Handle(APIPath+"/", auditCaller(negotiateEncoding(namedRepoHandler(n, cctx, command, cfg, cmdHandler))))
 		return mux, nil
 	}
 }
 
+// namedRepoHandler runs the commands given a repo name on the node of that
+// repo. The handler of each repo is built on its first request.
+func namedRepoHandler(n *core.IpfsNode, cctx oldcmds.Context, command *cmds.Command, cfg *cmdsHttp.ServerConfig, next http.Handler) http.Handler {
+	var lk sync.Mutex
+	handlers := make(map[string]http.Handler)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get(corecommands.RepoNameOption)
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		root, err := fsrepo.NamedRepoPath(cctx.ConfigRoot, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if n.Repos == nil {
+			http.Error(w, "the node doesn't serve named repos", http.StatusBadRequest)
+			return
+		}
+		// only the repos served get a handler, whatever the names requested
+		node, err := n.Repos.Get(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		lk.Lock()
+		h, ok := handlers[name]
+		if !ok {
+			env := &oldcmds.Context{
+				Online:     cctx.Online,
+				ConfigRoot: root,
+				ReqLog:     cctx.ReqLog,
+				LoadConfig: cctx.LoadConfig,
+				ConstructNode: func() (*core.IpfsNode, error) {
+					return node, nil
+				},
+			}
+			h = cmdsHttp.NewHandler(env, command, cfg)
+			handlers[name] = h
+		}
+		lk.Unlock()
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// auditCaller records the client of the request in its context, for the
+// audit log of the commands.
+func auditCaller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.WithCaller(r.Context(), r.RemoteAddr, "api", r.UserAgent())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// negotiateEncoding selects the output encoding of requests that don't
+// specify one with the encoding query parameter based on their Accept header,
+// when it prefers JSON, NDJSON or CBOR, see corecommands.EncodingForAccept.
+// It also makes sure the response is labeled with the right Content-Type for
+// the encodings go-ipfs-cmds doesn't know about.
+func negotiateEncoding(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		enc := q.Get(cmds.EncLong)
+		if enc == "" {
+			enc = q.Get(cmds.EncShort)
+		}
+		if enc == "" {
+			if accepted, ok := corecommands.EncodingForAccept(r.Header.Get("Accept")); ok {
+				enc = string(accepted)
+				q.Set(cmds.EncLong, enc)
+				r.URL.RawQuery = q.Encode()
+			}
+		}
+
+		switch et := cmds.EncodingType(enc); et {
+		case corecommands.NDJSON, corecommands.CBOR:
+			w = &contentTypeWriter{ResponseWriter: w, contentType: corecommands.MIMETypes[et]}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// contentTypeWriter overrides the Content-Type of successful responses.
+type contentTypeWriter struct {
+	http.ResponseWriter
+	contentType string
+	wroteHeader bool
+}
+
+func (w *contentTypeWriter) WriteHeader(code int) {
+	if !w.wroteHeader && code < 300 {
+		w.Header().Set("Content-Type", w.contentType)
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *contentTypeWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *contentTypeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *contentTypeWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
 // CommandsOption constructs a ServerOption for hooking the commands into the
 // HTTP server.
 func CommandsOption(cctx oldcmds.Context) ServeOption {
@@ -0,0 +1,93 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+)
+
+// The helpers below read optional config keys that have no counterpart in the
+// config struct yet.
+
+// configNumber reads an optional numeric config key. Missing keys read as 0.
+func configNumber(r repo.Repo, key string) (float64, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return 0, nil // not set
+	}
+
+	switch val := val.(type) {
+	case float64:
+		return val, nil
+	case int:
+		return float64(val), nil
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %s: %s", key, err)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("invalid value for %s: expected a number, got %v", key, val)
+	}
+}
+
+// configString reads an optional string config key. Missing keys read as "".
+func configString(r repo.Repo, key string) (string, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return "", nil // not set
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid value for %s: expected a string, got %v", key, val)
+	}
+	return s, nil
+}
+
+// configStrings reads an optional list of strings config key. Missing keys
+// read as nil.
+func configStrings(r repo.Repo, key string) ([]string, error) {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return nil, nil // not set
+	}
+
+	switch val := val.(type) {
+	case []string:
+		return val, nil
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, v := range val {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid value for %s: expected a list of strings, got %v", key, val)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("invalid value for %s: expected a list of strings, got %v", key, val)
+	}
+}
+
+// configDecode decodes an optional config key into out. Missing keys leave out
+// untouched.
+func configDecode(r repo.Repo, key string, out interface{}) error {
+	val, err := r.GetConfigKey(key)
+	if err != nil {
+		return nil // not set
+	}
+
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(buf, out); err != nil {
+		return fmt.Errorf("invalid value for %s: %s", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package corehttp
+
+import (
+	"strings"
+)
+
+// immutableCacheControl is sent with everything served from /ipfs/.
+const immutableCacheControl = "public, max-age=29030400, immutable"
+
+// ipnsCacheControl is sent with the files served from /ipns/, cached for as
+// long as the node caches the value of the names by default.
+const ipnsCacheControl = "public, max-age=60"
+
+// etagMatch reports whether the given If-None-Match header value matches
+// etag, using the weak comparison function from RFC 7232.
+func etagMatch(header string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
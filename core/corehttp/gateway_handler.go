@@ -16,7 +16,10 @@ import (
 
 	core "github.com/ipfs/go-ipfs/core"
 	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	tracing "github.com/ipfs/go-ipfs/core/tracing"
 	"github.com/ipfs/go-ipfs/dagutils"
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
+	namesys "github.com/ipfs/go-ipfs/namesys"
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	chunker "gx/ipfs/QmR4QQVkBZsZENRjYFVi8dEtPL3daZRNKk24m4r6WKJHNm/go-ipfs-chunker"
@@ -41,16 +44,18 @@ const (
 // gatewayHandler is a HTTP handler that serves IPFS objects (accessible by default at /ipfs/<path>)
 // (it serves requests like GET /ipfs/QmVRzPKPzNtSrEzBFm2UZfxmPAgnaLke4DMcerbsGGSaFe/link)
 type gatewayHandler struct {
-	node   *core.IpfsNode
-	config GatewayConfig
-	api    coreiface.CoreAPI
+	node    *core.IpfsNode
+	config  GatewayConfig
+	api     coreiface.CoreAPI
+	metrics *gatewayMetrics
 }
 
-func newGatewayHandler(n *core.IpfsNode, c GatewayConfig, api coreiface.CoreAPI) *gatewayHandler {
+func newGatewayHandler(n *core.IpfsNode, c GatewayConfig, api coreiface.CoreAPI, m *gatewayMetrics) *gatewayHandler {
 	i := &gatewayHandler{
-		node:   n,
-		config: c,
-		api:    api,
+		node:    n,
+		config:  c,
+		api:     api,
+		metrics: m,
 	}
 	return i
 }
@@ -69,6 +74,9 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Hour)
 	defer cancel()
 
+	span, ctx := tracing.StartRequest(ctx, r, "Gateway")
+	defer span.Finish()
+
 	defer func() {
 		if r := recover(); r != nil {
 			log.Error("A panic occurred in the gateway handler!")
@@ -77,6 +85,12 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	if i.metrics != nil {
+		mw := newMetricsResponseWriter(w)
+		defer i.metrics.observe(r, mw)
+		w = mw
+	}
+
 	if i.config.Writable {
 		switch r.Method {
 		case "POST":
@@ -92,7 +106,7 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == "GET" || r.Method == "HEAD" {
-		i.getOrHeadHandler(ctx, w, r)
+		i.getOrHeadHandler(priority.WithPriority(ctx, priority.Interactive), w, r)
 		return
 	}
 
@@ -177,11 +191,39 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 		defer dr.Close()
 	}
 
-	// Check etag send back to us
+	// Directory listings are generated, so they only get a weak etag.
 	etag := "\"" + resolvedPath.Cid().String() + "\""
-	if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-None-Match") == "W/"+etag {
-		w.WriteHeader(http.StatusNotModified)
-		return
+	if dir {
+		etag = "W/" + etag
+	}
+
+	// Content under /ipfs/ can be cached forever, and revalidated with its
+	// etag. Content under /ipns/ may change: it's only cached for a short
+	// while, then revalidated with its etag, which changes with the value
+	// of the name, or its modification time.
+	//
+	// Directory listings are never marked cacheable nor revalidated: they
+	// are generated by us and change whenever the listing template does.
+	immutable := strings.HasPrefix(urlPath, ipfsPathPrefix)
+	cacheControl := ipnsCacheControl
+	var modtime time.Time
+	if immutable {
+		cacheControl = immutableCacheControl
+		// set modtime to a really long time ago, since files are immutable and should stay cached
+		modtime = time.Unix(1, 0)
+	} else {
+		modtime = i.ipnsModTime(urlPath)
+	}
+
+	if !dir {
+		w.Header().Set("Cache-Control", cacheControl)
+
+		// Check etag send back to us
+		if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatch(inm, etag) {
+			w.Header().Set("Etag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
 
 	i.addUserHeaders(w) // ok, _now_ write user's headers.
@@ -234,19 +276,6 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 		w.Header().Set("Suborigin", suborigin)
 	}
 
-	// set these headers _after_ the error, for we may just not have it
-	// and dont want the client to cache a 500 response...
-	// and only if it's /ipfs!
-	// TODO: break this out when we split /ipfs /ipns routes.
-	modtime := time.Now()
-
-	if strings.HasPrefix(urlPath, ipfsPathPrefix) && !dir {
-		w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
-
-		// set modtime to a really long time ago, since files are immutable and should stay cached
-		modtime = time.Unix(1, 0)
-	}
-
 	if !dir {
 		urlFilename := r.URL.Query().Get("filename")
 		var name string
@@ -256,6 +285,7 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 		} else {
 			name = getFilename(urlPath)
 		}
+		setResponseType(w, gwRespFile)
 		i.serveFile(w, r, name, modtime, dr)
 		return
 	}
@@ -279,6 +309,7 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 		goget := r.URL.Query().Get("go-get") == "1"
 		if dirwithoutslash && !goget {
 			// See comment above where originalUrlPath is declared.
+			setResponseType(w, gwRespRedirect)
 			http.Redirect(w, r, originalUrlPath+"/", 302)
 			return
 		}
@@ -290,7 +321,10 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 		}
 		defer dr.Close()
 
+		w.Header().Set("Cache-Control", cacheControl)
+
 		// write to request
+		setResponseType(w, gwRespDirIndex)
 		http.ServeContent(w, r, "index.html", modtime, dr)
 		return
 	default:
@@ -299,6 +333,7 @@ func (i *gatewayHandler) getOrHeadHandler(ctx context.Context, w http.ResponseWr
 	case os.IsNotExist(err):
 	}
 
+	setResponseType(w, gwRespDirListing)
 	if r.Method == "HEAD" {
 		return
 	}
@@ -375,6 +410,18 @@ func (s *sizeSeeker) Seek(offset int64, whence int) (int64, error) {
 	return s.sizeReadSeeker.Seek(offset, whence)
 }
 
+// ipnsModTime returns the time the name of the /ipns/ path p was first
+// resolved to its current value, zero if unknown.
+func (i *gatewayHandler) ipnsModTime(p string) time.Time {
+	mt, ok := i.node.Namesys.(namesys.ModTimeResolver)
+	if !ok {
+		return time.Time{}
+	}
+	name := strings.SplitN(strings.TrimPrefix(p, ipnsPathPrefix), "/", 2)[0]
+	modtime, _ := mt.LastModified(name)
+	return modtime
+}
+
 func (i *gatewayHandler) serveFile(w http.ResponseWriter, req *http.Request, name string, modtime time.Time, content io.ReadSeeker) {
 	if sp, ok := content.(sizeReadSeeker); ok {
 		content = &sizeSeeker{
@@ -0,0 +1,149 @@
+package corehttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	prometheus "gx/ipfs/QmTQuFQWHAWy4wMH6ZyPfGiawA5u9T8rs79FENoV8yXaoS/client_golang/prometheus"
+)
+
+// Response types reported by the gateway metrics.
+const (
+	gwRespOther      = "other"
+	gwRespFile       = "unixfs_file"
+	gwRespDirIndex   = "unixfs_dir_index"
+	gwRespDirListing = "unixfs_dir_listing"
+	gwRespRedirect   = "redirect"
+)
+
+type gatewayMetrics struct {
+	responses *prometheus.CounterVec
+	ttfb      *prometheus.HistogramVec
+}
+
+func newGatewayMetrics() (*gatewayMetrics, error) {
+	responses := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ipfs",
+			Subsystem: "http_gw",
+			Name:      "responses_total",
+			Help:      "Total number of gateway responses by namespace, response type, status code and cache status.",
+		},
+		[]string{"namespace", "type", "code", "cache"},
+	)
+	if err := prometheus.Register(responses); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			responses = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			return nil, err
+		}
+	}
+
+	ttfb := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ipfs",
+			Subsystem: "http_gw",
+			Name:      "time_to_first_byte_seconds",
+			Help:      "The time it took the gateway to start responding, in seconds.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+		},
+		[]string{"namespace", "type"},
+	)
+	if err := prometheus.Register(ttfb); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			ttfb = are.ExistingCollector.(*prometheus.HistogramVec)
+		} else {
+			return nil, err
+		}
+	}
+
+	return &gatewayMetrics{
+		responses: responses,
+		ttfb:      ttfb,
+	}, nil
+}
+
+// observe records the outcome of a single gateway request.
+func (m *gatewayMetrics) observe(r *http.Request, w *metricsResponseWriter) {
+	ns := "ipfs"
+	if strings.HasPrefix(r.URL.Path, ipnsPathPrefix) {
+		ns = "ipns"
+	}
+
+	code := w.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	cache := "miss"
+	if code == http.StatusNotModified {
+		cache = "hit"
+	}
+
+	m.responses.WithLabelValues(ns, w.respType, strconv.Itoa(code), cache).Inc()
+	if w.wroteHeader {
+		m.ttfb.WithLabelValues(ns, w.respType).Observe(w.firstByte.Seconds())
+	}
+}
+
+// metricsResponseWriter records the status code, response type and time to
+// first byte of a gateway response.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+
+	start       time.Time
+	firstByte   time.Duration
+	wroteHeader bool
+	code        int
+	respType    string
+}
+
+func newMetricsResponseWriter(w http.ResponseWriter) *metricsResponseWriter {
+	return &metricsResponseWriter{
+		ResponseWriter: w,
+		start:          time.Now(),
+		respType:       gwRespOther,
+	}
+}
+
+func (w *metricsResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.code = code
+		w.firstByte = time.Since(w.start)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *metricsResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *metricsResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+func (w *metricsResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// setResponseType tags the response to a read with the given type if it is
+// being recorded. The responses to writes are left as gwRespOther.
+func setResponseType(w http.ResponseWriter, t string) {
+	if mw, ok := w.(*metricsResponseWriter); ok {
+		mw.respType = t
+	}
+}
@@ -3,6 +3,7 @@ package corehttp
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"math"
 	"net/http"
@@ -331,6 +332,45 @@ func TestIPNSHostnameRedirect(t *testing.T) {
 	}
 }
 
+func TestHostConfig(t *testing.T) {
+	hc := HostConfig{
+		NotFound:    "404.html",
+		HTTPHeaders: map[string][]string{"X-Site": {"example"}},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ipns/example.com/index.html", "/ipns/example.com/404.html":
+			w.Header().Set("X-Site", "overridden")
+			fmt.Fprint(w, r.URL.Path)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	})
+
+	for _, test := range []struct {
+		path   string
+		status int
+		text   string
+	}{
+		{"/index.html", http.StatusOK, "/ipns/example.com/index.html"},
+		{"/missing", http.StatusNotFound, "/ipns/example.com/404.html"},
+	} {
+		r := httptest.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		serveHost(next, hc, "example.com", w, r)
+
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.path, test.status, w.Code)
+		}
+		if w.Body.String() != test.text {
+			t.Errorf("%s: expected body %q, got %q", test.path, test.text, w.Body.String())
+		}
+		if h := w.Header().Get("X-Site"); h != "example" {
+			t.Errorf("%s: expected host header to be set, got %q", test.path, h)
+		}
+	}
+}
+
 func TestIPNSHostnameBacklinks(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -563,6 +603,166 @@ func TestCacheControlImmutable(t *testing.T) {
 	}
 }
 
+func TestIfNoneMatch(t *testing.T) {
+	ns := mockNamesys{}
+	ts, n := newTestServerAndNode(t, ns)
+	t.Logf("test server url: %s", ts.URL)
+	defer ts.Close()
+
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.net"] = path.FromString("/ipfs/" + k)
+
+	for _, test := range []struct {
+		path        string
+		ifNoneMatch string
+		status      int
+	}{
+		{"/ipfs/" + k, "", http.StatusOK},
+		{"/ipfs/" + k, "\"" + k + "\"", http.StatusNotModified},
+		{"/ipfs/" + k, "W/\"" + k + "\"", http.StatusNotModified},
+		{"/ipfs/" + k, "\"foo\", \"" + k + "\"", http.StatusNotModified},
+		{"/ipfs/" + k, "\"foo\"", http.StatusOK},
+		{"/ipns/example.net", "\"" + k + "\"", http.StatusNotModified},
+		{"/ipns/example.net", "\"foo\"", http.StatusOK},
+		{emptyDir + "/", "W/\"" + emptyDir[len("/ipfs/"):] + "\"", http.StatusOK},
+	} {
+		req, err := http.NewRequest("GET", ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != test.status {
+			t.Errorf("%s (If-None-Match: %s): expected status %d, got %d", test.path, test.ifNoneMatch, test.status, res.StatusCode)
+		}
+	}
+
+	// /ipns/ content must only be cached briefly
+	res, err := http.Get(ts.URL + "/ipns/example.net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if cc := res.Header.Get("Cache-Control"); cc != ipnsCacheControl {
+		t.Errorf("unexpected Cache-Control: %s on /ipns/ path", cc)
+	}
+	if etag := res.Header.Get("Etag"); etag != "\""+k+"\"" {
+		t.Errorf("unexpected Etag: %s on /ipns/ path", etag)
+	}
+
+	// the etag follows the value of the name
+	k2, err := coreunix.Add(n, strings.NewReader("fnord2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.net"] = path.FromString("/ipfs/" + k2)
+	req, err := http.NewRequest("GET", ts.URL+"/ipns/example.net", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("If-None-Match", "\""+k+"\"")
+	res, err = doWithoutRedirect(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200 once the name changed, got %d", res.StatusCode)
+	}
+}
+
+// modTimeNamesys is a mockNamesys which knows when its names changed.
+type modTimeNamesys struct {
+	mockNamesys
+	modified map[string]time.Time
+}
+
+func (m modTimeNamesys) LastModified(name string) (time.Time, bool) {
+	t, ok := m.modified[name]
+	return t, ok
+}
+
+func TestIPNSLastModified(t *testing.T) {
+	ns := mockNamesys{}
+	ts, n := newTestServerAndNode(t, ns)
+	t.Logf("test server url: %s", ts.URL)
+	defer ts.Close()
+
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.net"] = path.FromString("/ipfs/" + k)
+
+	modified := time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+	n.Namesys = modTimeNamesys{ns, map[string]time.Time{"example.net": modified}}
+
+	for _, test := range []struct {
+		ifModifiedSince time.Time
+		status          int
+	}{
+		{time.Time{}, http.StatusOK},
+		{modified, http.StatusNotModified},
+		{modified.Add(time.Hour), http.StatusNotModified},
+		{modified.Add(-time.Hour), http.StatusOK},
+	} {
+		req, err := http.NewRequest("GET", ts.URL+"/ipns/example.net", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !test.ifModifiedSince.IsZero() {
+			req.Header.Set("If-Modified-Since", test.ifModifiedSince.Format(http.TimeFormat))
+		}
+
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != test.status {
+			t.Errorf("If-Modified-Since: %s: expected status %d, got %d", test.ifModifiedSince, test.status, res.StatusCode)
+		}
+		if res.StatusCode == http.StatusOK {
+			if lm := res.Header.Get("Last-Modified"); lm != modified.Format(http.TimeFormat) {
+				t.Errorf("expected Last-Modified: %s, got %q", modified.Format(http.TimeFormat), lm)
+			}
+		}
+	}
+}
+
+func TestMetricsResponseWriterFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var w http.ResponseWriter = newMetricsResponseWriter(rec)
+
+	f, ok := w.(http.Flusher)
+	if !ok {
+		t.Fatal("expected the metrics writer to be an http.Flusher")
+	}
+	if _, ok := w.(http.CloseNotifier); !ok {
+		t.Fatal("expected the metrics writer to be an http.CloseNotifier")
+	}
+
+	f.Flush()
+	if !rec.Flushed {
+		t.Fatal("expected the flush to reach the underlying writer")
+	}
+	if mw := w.(*metricsResponseWriter); !mw.wroteHeader || mw.code != http.StatusOK {
+		t.Fatalf("expected the flush to be recorded as a 200, got %d", mw.code)
+	}
+}
+
 func TestGoGetSupport(t *testing.T) {
 	ts, _ := newTestServerAndNode(t, nil)
 	t.Logf("test server url: %s", ts.URL)
@@ -0,0 +1,60 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+)
+
+// HealthOption adds the /health and /ready endpoints, for the liveness and
+// readiness probes of orchestrators and load balancers. They respond with
+// the checks of the node in JSON, with 200 OK if the node is respectively
+// live or ready, and 503 Service Unavailable otherwise.
+func HealthOption() ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		api := coreapi.NewCoreAPI(n)
+		mux.Handle("/health", &healthHandler{api: api})
+		mux.Handle("/ready", &healthHandler{api: api, ready: true})
+		return mux, nil
+	}
+}
+
+type healthHandler struct {
+	api coreiface.CoreAPI
+
+	// ready is set for the readiness endpoint, unset for the liveness one
+	ready bool
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	health, err := h.api.Health().Check(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	ok := health.Live
+	if h.ready {
+		ok = health.Ready
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if r.Method == "GET" {
+		json.NewEncoder(w).Encode(health)
+	}
+}
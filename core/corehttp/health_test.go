@@ -0,0 +1,69 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+)
+
+func TestHealthOption(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, HealthOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/health", "/ready"} {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var h coreiface.Health
+		err = json.NewDecoder(res.Body).Decode(&h)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, res.StatusCode)
+		}
+		if !h.Live || !h.Ready || len(h.Checks) != 4 {
+			t.Fatalf("%s: expected the node to be live and ready, got %+v", path, h)
+		}
+	}
+
+	unlocker := n.Blockstore.GCLock()
+	defer unlocker.Unlock()
+	for path, status := range map[string]int{
+		"/health": http.StatusOK,
+		"/ready":  http.StatusServiceUnavailable,
+	} {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != status {
+			t.Fatalf("%s: expected %d under GCLock, got %d", path, status, res.StatusCode)
+		}
+	}
+
+	res, err := http.Post(ts.URL+"/ready", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for POST, got %d", res.StatusCode)
+	}
+}
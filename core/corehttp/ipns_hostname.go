@@ -5,25 +5,73 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 
 	core "github.com/ipfs/go-ipfs/core"
 	namesys "github.com/ipfs/go-ipfs/namesys"
 	nsopts "github.com/ipfs/go-ipfs/namesys/opts"
+	repo "github.com/ipfs/go-ipfs/repo"
 
 	isd "gx/ipfs/QmZmmuAXgX73UQmX1jRKjTGmjzq24Jinqkq8vzkBtno4uX/go-is-domain"
 )
 
+const gatewayHostsKey = "Gateway.Hosts"
+
+// HostConfig overrides how the gateway serves a website for a single
+// hostname.
+type HostConfig struct {
+	// Root is the IPFS or IPNS path to serve the site from. Defaults to the
+	// DNSLink of the hostname (/ipns/<hostname>).
+	Root string
+
+	// NotFound is the path, relative to the site root, of a page to serve
+	// (with a 404 status) in place of the default 404 response.
+	NotFound string
+
+	// HTTPHeaders are set on every response for this host. They take
+	// precedence over Gateway.HTTPHeaders.
+	HTTPHeaders map[string][]string
+}
+
 // IPNSHostnameOption rewrites an incoming request if its Host: header contains
 // an IPNS name.
 // The rewritten request points at the resolved name on the gateway handler.
+//
+// Hosts listed in the Gateway.Hosts section of the config are served according
+// to their HostConfig. The list is updated when the config is reloaded.
 func IPNSHostnameOption() ServeOption {
 	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		hosts, err := loadHostConfigs(n.Repo)
+		if err != nil {
+			return nil, err
+		}
+
+		var hostsLk sync.RWMutex
+		n.OnConfigReload(gatewayHostsKey, func(r repo.Repo) error {
+			newHosts, err := loadHostConfigs(r)
+			if err != nil {
+				return err
+			}
+			hostsLk.Lock()
+			hosts = newHosts
+			hostsLk.Unlock()
+			return nil
+		})
+
 		childMux := http.NewServeMux()
 		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			ctx, cancel := context.WithCancel(n.Context())
 			defer cancel()
 
-			host := strings.SplitN(r.Host, ":", 2)[0]
+			host := strings.ToLower(strings.SplitN(r.Host, ":", 2)[0])
+			hostsLk.RLock()
+			hc, ok := hosts[host]
+			hostsLk.RUnlock()
+			if ok {
+				serveHost(childMux, hc, host, w, r)
+				return
+			}
+
 			if len(host) > 0 && isd.IsDomain(host) {
 				name := "/ipns/" + host
 				_, err := n.Namesys.Resolve(ctx, name, nsopts.Depth(1))
@@ -37,3 +85,100 @@ func IPNSHostnameOption() ServeOption {
 		return childMux, nil
 	}
 }
+
+// loadHostConfigs reads the Gateway.Hosts section of the config, keyed by
+// lowercase host name.
+func loadHostConfigs(r repo.Repo) (map[string]HostConfig, error) {
+	var cfgHosts map[string]HostConfig
+	if err := configDecode(r, gatewayHostsKey, &cfgHosts); err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]HostConfig, len(cfgHosts))
+	for h, hc := range cfgHosts {
+		hosts[strings.ToLower(h)] = hc
+	}
+	return hosts, nil
+}
+
+// serveHost serves a request for a host with a HostConfig.
+func serveHost(next http.Handler, hc HostConfig, host string, w http.ResponseWriter, r *http.Request) {
+	root := strings.TrimSuffix(hc.Root, "/")
+	if root == "" {
+		root = "/ipns/" + host
+	}
+
+	originalPath := r.URL.Path
+	r.Header.Set("X-Ipns-Original-Path", originalPath)
+	r.URL.Path = root + originalPath
+
+	hw := &hostResponseWriter{
+		ResponseWriter: w,
+		headers:        hc.HTTPHeaders,
+		interceptNotFound: hc.NotFound != "" &&
+			(r.Method == "GET" || r.Method == "HEAD"),
+	}
+	next.ServeHTTP(hw, r)
+
+	if !hw.intercepted {
+		return
+	}
+
+	notFound := "/" + strings.TrimPrefix(hc.NotFound, "/")
+	r.Header.Set("X-Ipns-Original-Path", originalPath)
+	r.URL.Path = root + notFound
+	next.ServeHTTP(&hostResponseWriter{
+		ResponseWriter: w,
+		headers:        hc.HTTPHeaders,
+		status:         http.StatusNotFound,
+	}, r)
+}
+
+// hostResponseWriter applies per-host headers to a response and optionally
+// intercepts 404 responses so that a custom page can be served instead.
+type hostResponseWriter struct {
+	http.ResponseWriter
+
+	headers map[string][]string
+
+	// status, if set, overrides the status code of any successful response.
+	status int
+
+	interceptNotFound bool
+	intercepted       bool
+	wroteHeader       bool
+}
+
+func (w *hostResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if w.interceptNotFound && code == http.StatusNotFound {
+		// Drop whatever the handler set for its own error page.
+		h := w.Header()
+		for k := range h {
+			delete(h, k)
+		}
+		w.intercepted = true
+		return
+	}
+
+	for k, v := range w.headers {
+		w.Header()[k] = v
+	}
+	if w.status != 0 && code < 300 {
+		code = w.status
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *hostResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.intercepted {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
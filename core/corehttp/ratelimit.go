@@ -0,0 +1,446 @@
+package corehttp
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	simplelru "gx/ipfs/QmQjMHF8ptRgx4E57UFMiT4YM6kqaJeYxZ1MCDX23aw4rK/golang-lru/simplelru"
+)
+
+const (
+	rateLimitRequestsKey   = "Gateway.RateLimit.RequestsPerSecond"
+	rateLimitBurstKey      = "Gateway.RateLimit.Burst"
+	rateLimitConcurrentKey = "Gateway.RateLimit.MaxConcurrentRequests"
+	rateLimitBytesKey      = "Gateway.RateLimit.BytesPerSecond"
+	rateLimitIPv6PrefixKey = "Gateway.RateLimit.IPv6PrefixLength"
+)
+
+// clientIdleTimeout is how long we keep the state of a client that has not
+// made any requests around before forgetting about it.
+const clientIdleTimeout = 5 * time.Minute
+
+// maxRateLimitClients is the number of clients whose state is kept. Past it,
+// the least recently seen clients are forgotten.
+const maxRateLimitClients = 64 * 1024
+
+// defaultIPv6PrefixLength is the length of the prefix of the IPv6 addresses
+// sharing the limits of a single client: a host usually gets a whole /64.
+const defaultIPv6PrefixLength = 64
+
+// RateLimitConfig configures the per client IP limits enforced by
+// RateLimitOption. A zero value for any of the fields disables that limit.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained number of requests a single client
+	// may make per second.
+	RequestsPerSecond float64
+
+	// Burst is the number of requests a client may make in a row before
+	// RequestsPerSecond kicks in. Defaults to RequestsPerSecond.
+	Burst int
+
+	// MaxConcurrentRequests caps the number of requests (and therefore DAG
+	// traversals) a single client may have in flight at once.
+	MaxConcurrentRequests int
+
+	// BytesPerSecond caps the response bandwidth of a single client.
+	BytesPerSecond int64
+
+	// IPv6PrefixLength is the length of the prefix of the IPv6 addresses
+	// counted as a single client. Defaults to 64.
+	IPv6PrefixLength int
+}
+
+func (c RateLimitConfig) enabled() bool {
+	return c.RequestsPerSecond > 0 || c.MaxConcurrentRequests > 0 || c.BytesPerSecond > 0
+}
+
+// RateLimitOption limits the rate, concurrency and bandwidth of requests made
+// by a single client IP to the handlers registered after it. Requests over the
+// limit are rejected with 429 Too Many Requests.
+//
+// The limits are read from the Gateway.RateLimit section of the config, and
+// are updated when the config is reloaded.
+func RateLimitOption() ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		cfg, err := loadRateLimitConfig(n.Repo)
+		if err != nil {
+			return nil, err
+		}
+
+		childMux := http.NewServeMux()
+		rl := newRateLimiter(cfg, childMux)
+		mux.Handle("/", rl)
+
+		n.OnConfigReload("Gateway.RateLimit", func(r repo.Repo) error {
+			cfg, err := loadRateLimitConfig(r)
+			if err != nil {
+				return err
+			}
+			rl.setConfig(cfg)
+			return nil
+		})
+		return childMux, nil
+	}
+}
+
+// RateLimitOptionWithConfig is like RateLimitOption but uses the given limits
+// instead of reading them from the config.
+func RateLimitOptionWithConfig(cfg RateLimitConfig) ServeOption {
+	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		if !cfg.enabled() {
+			return mux, nil
+		}
+
+		childMux := http.NewServeMux()
+		mux.Handle("/", newRateLimiter(cfg, childMux))
+		return childMux, nil
+	}
+}
+
+func loadRateLimitConfig(r repo.Repo) (RateLimitConfig, error) {
+	var cfg RateLimitConfig
+
+	rps, err := configNumber(r, rateLimitRequestsKey)
+	if err != nil {
+		return cfg, err
+	}
+	burst, err := configNumber(r, rateLimitBurstKey)
+	if err != nil {
+		return cfg, err
+	}
+	concurrent, err := configNumber(r, rateLimitConcurrentKey)
+	if err != nil {
+		return cfg, err
+	}
+	bps, err := configNumber(r, rateLimitBytesKey)
+	if err != nil {
+		return cfg, err
+	}
+	prefix, err := configNumber(r, rateLimitIPv6PrefixKey)
+	if err != nil {
+		return cfg, err
+	}
+	if prefix < 0 || prefix > 128 {
+		return cfg, fmt.Errorf("%s must be between 0 and 128, got %v", rateLimitIPv6PrefixKey, prefix)
+	}
+
+	cfg.RequestsPerSecond = rps
+	cfg.Burst = int(burst)
+	cfg.MaxConcurrentRequests = int(concurrent)
+	cfg.BytesPerSecond = int64(bps)
+	cfg.IPv6PrefixLength = int(prefix)
+	return cfg, nil
+}
+
+// tokenBucket is a simple token bucket. It is not thread-safe.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   now,
+	}
+}
+
+// setLimits changes the rate and the burst of the bucket, keeping the tokens
+// it holds up to the new burst.
+func (b *tokenBucket) setLimits(rate, burst float64) {
+	b.rate = rate
+	b.burst = burst
+	b.tokens = math.Min(b.tokens, burst)
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+}
+
+// allow takes a single token from the bucket if one is available.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes n tokens from the bucket, going into debt if necessary, and
+// returns how long the caller must wait before the reservation is honored.
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// retryAfter returns how long until the next token becomes available.
+func (b *tokenBucket) retryAfter() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+type clientState struct {
+	requests *tokenBucket
+	bytes    *tokenBucket
+	active   int
+	lastSeen time.Time
+}
+
+// setLimits sets up the buckets of the client for the limits of cfg, keeping
+// the tokens left in those it already has.
+func (c *clientState) setLimits(cfg RateLimitConfig, now time.Time) {
+	switch {
+	case cfg.RequestsPerSecond <= 0:
+		c.requests = nil
+	case c.requests == nil:
+		c.requests = newTokenBucket(cfg.RequestsPerSecond, float64(cfg.Burst), now)
+	default:
+		c.requests.setLimits(cfg.RequestsPerSecond, float64(cfg.Burst))
+	}
+
+	bps := float64(cfg.BytesPerSecond)
+	switch {
+	case bps <= 0:
+		c.bytes = nil
+	case c.bytes == nil:
+		c.bytes = newTokenBucket(bps, bps, now)
+	default:
+		c.bytes.setLimits(bps, bps)
+	}
+}
+
+type rateLimiter struct {
+	cfg  RateLimitConfig
+	next http.Handler
+
+	mu sync.Mutex
+	// clients holds the *clientState of the clients, by key, the least
+	// recently seen first
+	clients *simplelru.LRU
+
+	// for tests
+	now func() time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig, next http.Handler) *rateLimiter {
+	clients, err := simplelru.NewLRU(maxRateLimitClients, nil)
+	if err != nil {
+		panic(err)
+	}
+	rl := &rateLimiter{
+		next:    next,
+		clients: clients,
+		now:     time.Now,
+	}
+	rl.setConfig(cfg)
+	return rl
+}
+
+// setConfig replaces the limits. The clients keep the tokens left in their
+// buckets, up to the new burst.
+func (rl *rateLimiter) setConfig(cfg RateLimitConfig) {
+	if cfg.Burst <= 0 {
+		cfg.Burst = int(math.Ceil(cfg.RequestsPerSecond))
+	}
+	if cfg.IPv6PrefixLength <= 0 {
+		cfg.IPv6PrefixLength = defaultIPv6PrefixLength
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.cfg = cfg
+	now := rl.now()
+	for _, key := range rl.clients.Keys() {
+		if c, ok := rl.clients.Peek(key); ok {
+			c.(*clientState).setLimits(cfg, now)
+		}
+	}
+}
+
+// clientKey returns the key of the client making r: its IP, or the prefix of
+// prefixLen bits of its IPv6 address, so that a client can't get around the
+// limits by rotating the addresses of its network.
+func clientKey(r *http.Request, prefixLen int) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() != nil {
+		return host
+	}
+	masked := ip.Mask(net.CIDRMask(prefixLen, 8*net.IPv6len))
+	return masked.String() + "/" + strconv.Itoa(prefixLen)
+}
+
+// acquire registers the start of a request made by r. It returns the client
+// state on success, or how long the client should wait before retrying. The
+// client state is nil if no limits are enforced.
+func (rl *rateLimiter) acquire(r *http.Request) (*clientState, time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if !rl.cfg.enabled() {
+		return nil, 0, true
+	}
+
+	now := rl.now()
+	rl.prune(now)
+
+	key := clientKey(r, rl.cfg.IPv6PrefixLength)
+	var c *clientState
+	if v, ok := rl.clients.Get(key); ok {
+		c = v.(*clientState)
+	} else {
+		c = &clientState{}
+		c.setLimits(rl.cfg, now)
+		rl.clients.Add(key, c)
+	}
+	c.lastSeen = now
+
+	if rl.cfg.MaxConcurrentRequests > 0 && c.active >= rl.cfg.MaxConcurrentRequests {
+		return nil, time.Second, false
+	}
+	if c.requests != nil && !c.requests.allow(now) {
+		return nil, c.requests.retryAfter(), false
+	}
+
+	c.active++
+	return c, 0, true
+}
+
+func (rl *rateLimiter) release(c *clientState) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	c.active--
+	c.lastSeen = rl.now()
+}
+
+// prune forgets the least recently seen clients while they are idle. Must be
+// called with rl.mu held.
+func (rl *rateLimiter) prune(now time.Time) {
+	for {
+		_, v, ok := rl.clients.GetOldest()
+		if !ok {
+			return
+		}
+		c := v.(*clientState)
+		if c.active > 0 || now.Sub(c.lastSeen) <= clientIdleTimeout {
+			return
+		}
+		rl.clients.RemoveOldest()
+	}
+}
+
+// waitBytes blocks until the client is allowed to send n more bytes.
+func (rl *rateLimiter) waitBytes(r *http.Request, c *clientState, n int) error {
+	rl.mu.Lock()
+	if c.bytes == nil {
+		// the limit was lifted by a config reload
+		rl.mu.Unlock()
+		return nil
+	}
+	delay := c.bytes.reserve(rl.now(), float64(n))
+	rl.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+func (rl *rateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, retry, ok := rl.acquire(r)
+	if !ok {
+		secs := int(math.Ceil(retry.Seconds()))
+		if secs < 1 {
+			secs = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	if c == nil {
+		rl.next.ServeHTTP(w, r)
+		return
+	}
+	defer rl.release(c)
+
+	if c.bytes != nil {
+		w = &throttledResponseWriter{
+			ResponseWriter: w,
+			wait: func(n int) error {
+				return rl.waitBytes(r, c, n)
+			},
+		}
+	}
+
+	rl.next.ServeHTTP(w, r)
+}
+
+// throttleChunkSize is the largest write passed through to the client before
+// waiting on the bandwidth limiter again.
+const throttleChunkSize = 32 * 1024
+
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	wait func(n int) error
+}
+
+func (w *throttledResponseWriter) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > throttleChunkSize {
+			chunk = chunk[:throttleChunkSize]
+		}
+		if err := w.wait(len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (w *throttledResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,179 @@
+package corehttp
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newTokenBucket(2, 2, now)
+
+	if !b.allow(now) || !b.allow(now) {
+		t.Fatal("expected the burst to be allowed")
+	}
+	if b.allow(now) {
+		t.Fatal("expected the bucket to be empty")
+	}
+	if d := b.retryAfter(); d != 500*time.Millisecond {
+		t.Fatalf("expected retry after 500ms, got %s", d)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if !b.allow(now) {
+		t.Fatal("expected a token to be refilled")
+	}
+
+	if d := b.reserve(now, 4); d != 2*time.Second {
+		t.Fatalf("expected to wait 2s, got %s", d)
+	}
+}
+
+func TestRateLimiterRequests(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rl := newRateLimiter(RateLimitConfig{RequestsPerSecond: 1, Burst: 2}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	rl.now = func() time.Time { return now }
+
+	do := func(remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/ipfs/", nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		rl.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := do("1.2.3.4:1000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+
+	w := do("1.2.3.4:1001")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected Retry-After: 1, got %q", w.Header().Get("Retry-After"))
+	}
+
+	// other clients are not affected
+	if w := do("5.6.7.8:1000"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for another client, got %d", w.Code)
+	}
+
+	now = now.Add(time.Second)
+	if w := do("1.2.3.4:1000"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 after refill, got %d", w.Code)
+	}
+}
+
+func TestRateLimiterConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	rl := newRateLimiter(RateLimitConfig{MaxConcurrentRequests: 1}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	done := make(chan int)
+	go func() {
+		r := httptest.NewRequest("GET", "/ipfs/", nil)
+		w := httptest.NewRecorder()
+		rl.ServeHTTP(w, r)
+		done <- w.Code
+	}()
+	<-started
+
+	r := httptest.NewRequest("GET", "/ipfs/", nil)
+	w := httptest.NewRecorder()
+	rl.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+}
+
+func TestRateLimiterIPv6Prefix(t *testing.T) {
+	rl := newRateLimiter(RateLimitConfig{RequestsPerSecond: 1, Burst: 1}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	now := time.Unix(1000, 0)
+	rl.now = func() time.Time { return now }
+
+	do := func(remote string) int {
+		r := httptest.NewRequest("GET", "/ipfs/", nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		rl.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := do("[2001:db8:1:2::1]:1000"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	// same /64
+	if code := do("[2001:db8:1:2:ffff::2]:1000"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 within the same /64, got %d", code)
+	}
+	// another /64
+	if code := do("[2001:db8:1:3::1]:1000"); code != http.StatusOK {
+		t.Fatalf("expected 200 for another /64, got %d", code)
+	}
+
+	rl.setConfig(RateLimitConfig{RequestsPerSecond: 1, Burst: 1, IPv6PrefixLength: 48})
+	now = now.Add(time.Second)
+	if code := do("[2001:db8:1:4::1]:1000"); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := do("[2001:db8:1:5::1]:1000"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 within the same /48, got %d", code)
+	}
+}
+
+func TestRateLimiterReload(t *testing.T) {
+	rl := newRateLimiter(RateLimitConfig{RequestsPerSecond: 1, Burst: 2}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	now := time.Unix(1000, 0)
+	rl.now = func() time.Time { return now }
+
+	do := func() int {
+		r := httptest.NewRequest("GET", "/ipfs/", nil)
+		r.RemoteAddr = "1.2.3.4:1000"
+		w := httptest.NewRecorder()
+		rl.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := do(); code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, code)
+		}
+	}
+
+	// reloading doesn't give the client a fresh bucket
+	rl.setConfig(RateLimitConfig{RequestsPerSecond: 1, Burst: 5})
+	if code := do(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after reload, got %d", code)
+	}
+}
+
+func TestRateLimiterMaxClients(t *testing.T) {
+	rl := newRateLimiter(RateLimitConfig{RequestsPerSecond: 1, Burst: 1}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	now := time.Unix(1000, 0)
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < maxRateLimitClients+10; i++ {
+		r := httptest.NewRequest("GET", "/ipfs/", nil)
+		r.RemoteAddr = fmt.Sprintf("10.%d.%d.%d:1000", i>>16&0xff, i>>8&0xff, i&0xff)
+		rl.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if n := rl.clients.Len(); n != maxRateLimitClients {
+		t.Fatalf("expected %d clients, got %d", maxRateLimitClients, n)
+	}
+}
@@ -0,0 +1,276 @@
+package corehttp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+)
+
+const (
+	tlsAddressesKey = "Gateway.TLS.Addresses"
+	tlsCertFileKey  = "Gateway.TLS.CertFile"
+	tlsKeyFileKey   = "Gateway.TLS.KeyFile"
+	tlsDomainsKey   = "Gateway.TLS.Domains"
+	tlsACMEKey      = "Gateway.TLS.ACME"
+)
+
+// certCheckInterval is how often we check whether the certificate files have
+// been replaced on disk (e.g., by an ACME client renewing them).
+const certCheckInterval = time.Minute
+
+// defaultACMECacheDir is the directory of the repo keeping the ACME account
+// key and the certificates obtained.
+const defaultACMECacheDir = "acme"
+
+// TLSConfig configures the HTTPS listeners of the gateway.
+type TLSConfig struct {
+	// Addresses are the multiaddrs to serve HTTPS on.
+	Addresses []string
+
+	// CertFile and KeyFile are the PEM encoded certificate chain and private
+	// key. They are reloaded when they change on disk so renewals don't
+	// require a restart.
+	CertFile string
+	KeyFile  string
+
+	// Domains, if set, restricts the server names (SNI) we complete TLS
+	// handshakes for. Entries of the form *.example.com match any direct
+	// subdomain of example.com.
+	Domains []string
+
+	// ACME, if set, obtains and renews the certificates of Domains from an
+	// ACME CA instead of reading CertFile and KeyFile.
+	ACME *ACMEConfig
+}
+
+// ACMEConfig configures the certificates obtained from an ACME CA, Let's
+// Encrypt by default. The CA validates the domains with the TLS-ALPN-01
+// challenge, answered on the HTTPS listeners, so they must be reachable on
+// port 443. Wildcard domains, which need the DNS-01 challenge, are not
+// supported. ACME support is only compiled in with the acme build tag.
+type ACMEConfig struct {
+	// AcceptTOS accepts the terms of service of the CA, required.
+	AcceptTOS bool
+
+	// Email is the contact of the account registered with the CA, optional.
+	Email string
+
+	// CacheDir keeps the account key and the certificates, relative to the
+	// repo unless absolute. Default: acme
+	CacheDir string
+
+	// DirectoryURL is the directory of the CA. Default: Let's Encrypt
+	DirectoryURL string
+}
+
+// LoadTLSConfig reads the Gateway.TLS section of the config. TLS is disabled
+// if no addresses are configured.
+func LoadTLSConfig(r repo.Repo) (TLSConfig, error) {
+	var cfg TLSConfig
+	var err error
+
+	if cfg.Addresses, err = configStrings(r, tlsAddressesKey); err != nil {
+		return cfg, err
+	}
+	if len(cfg.Addresses) == 0 {
+		return cfg, nil
+	}
+
+	if cfg.Domains, err = configStrings(r, tlsDomainsKey); err != nil {
+		return cfg, err
+	}
+	if cfg.ACME, err = loadACMEConfig(r); err != nil || cfg.ACME != nil {
+		return cfg, err
+	}
+
+	if cfg.CertFile, err = configString(r, tlsCertFileKey); err != nil {
+		return cfg, err
+	}
+	if cfg.KeyFile, err = configString(r, tlsKeyFileKey); err != nil {
+		return cfg, err
+	}
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return cfg, fmt.Errorf("%s and %s, or %s, must be set to serve the gateway over TLS", tlsCertFileKey, tlsKeyFileKey, tlsACMEKey)
+	}
+	return cfg, nil
+}
+
+// loadACMEConfig reads Gateway.TLS.ACME, nil if it isn't set or false.
+func loadACMEConfig(r repo.Repo) (*ACMEConfig, error) {
+	if val, err := r.GetConfigKey(tlsACMEKey); err != nil || val == nil || val == false {
+		return nil, nil
+	}
+
+	c := new(ACMEConfig)
+	if err := configDecode(r, tlsACMEKey, c); err != nil {
+		return nil, err
+	}
+	if !c.AcceptTOS {
+		return nil, fmt.Errorf("%s.AcceptTOS must be set to accept the terms of service of the CA", tlsACMEKey)
+	}
+
+	domains, err := configStrings(r, tlsDomainsKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("%s must list the domains to obtain certificates for", tlsDomainsKey)
+	}
+	for _, d := range domains {
+		if strings.HasPrefix(d, "*.") {
+			return nil, fmt.Errorf("%s: wildcard domain %q needs the DNS-01 challenge, which is not supported: obtain its certificate with an external ACME client and set %s and %s", tlsACMEKey, d, tlsCertFileKey, tlsKeyFileKey)
+		}
+	}
+
+	if c.CacheDir == "" {
+		c.CacheDir = defaultACMECacheDir
+	}
+	if !filepath.IsAbs(c.CacheDir) {
+		pr, ok := r.(interface{ Path() string })
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s.CacheDir: the path must be absolute, the repo is not on disk", tlsACMEKey)
+		}
+		c.CacheDir = filepath.Join(pr.Path(), c.CacheDir)
+	}
+	return c, nil
+}
+
+// NewTLSListener wraps the given listener so that it serves TLS using the
+// certificate described by cfg.
+func NewTLSListener(lis net.Listener, cfg TLSConfig) (net.Listener, error) {
+	tc, err := newServerTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(lis, tc), nil
+}
+
+func newServerTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	if cfg.ACME != nil {
+		return newACMETLSConfig(cfg)
+	}
+
+	certs := &certReloader{
+		certFile: cfg.CertFile,
+		keyFile:  cfg.KeyFile,
+	}
+	if err := certs.reload(); err != nil {
+		return nil, err
+	}
+
+	domains := cfg.Domains
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if len(domains) > 0 && !matchDomain(domains, hello.ServerName) {
+				return nil, fmt.Errorf("tls: unknown server name %q", hello.ServerName)
+			}
+			return certs.get()
+		},
+	}, nil
+}
+
+// matchDomain checks whether name is one of the given domains. Wildcard
+// domains match exactly one extra label.
+func matchDomain(domains []string, name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if strings.HasPrefix(d, "*.") {
+			label := strings.TrimSuffix(name, d[1:])
+			if label != name && label != "" && !strings.Contains(label, ".") {
+				return true
+			}
+			continue
+		}
+		if name == d {
+			return true
+		}
+	}
+	return false
+}
+
+// certReloader serves a certificate loaded from disk, picking up changes to
+// the files.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	modTime     time.Time
+	lastChecked time.Time
+}
+
+func (c *certReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{c.certFile, c.keyFile} {
+		st, err := os.Stat(f)
+		if err != nil {
+			return latest, err
+		}
+		if st.ModTime().After(latest) {
+			latest = st.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (c *certReloader) reload() error {
+	mt, err := c.filesModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTime = mt
+	c.lastChecked = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certReloader) get() (*tls.Certificate, error) {
+	c.mu.Lock()
+	cert := c.cert
+	stale := time.Since(c.lastChecked) > certCheckInterval
+	if stale {
+		c.lastChecked = time.Now()
+	}
+	modTime := c.modTime
+	c.mu.Unlock()
+
+	if !stale {
+		return cert, nil
+	}
+
+	mt, err := c.filesModTime()
+	if err != nil || !mt.After(modTime) {
+		return cert, nil
+	}
+
+	// Keep serving the old certificate if the new one is broken (e.g.,
+	// we caught the files mid-renewal).
+	if err := c.reload(); err != nil {
+		log.Errorf("failed to reload TLS certificate: %s", err)
+		return cert, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert, nil
+}
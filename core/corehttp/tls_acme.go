@@ -0,0 +1,29 @@
+// +build acme
+
+package corehttp
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newACMETLSConfig returns a TLS config serving the certificates of the
+// domains of cfg obtained from the ACME CA, answering its TLS-ALPN-01
+// challenges. The certificates are renewed 30 days before they expire.
+func newACMETLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cfg.ACME.CacheDir),
+		HostPolicy: autocert.HostWhitelist(cfg.Domains...),
+		Email:      cfg.ACME.Email,
+	}
+	if cfg.ACME.DirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: cfg.ACME.DirectoryURL}
+	}
+
+	tc := m.TLSConfig()
+	tc.MinVersion = tls.VersionTLS12
+	return tc, nil
+}
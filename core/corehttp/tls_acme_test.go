@@ -0,0 +1,41 @@
+// +build acme
+
+package corehttp
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestACMETLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tc, err := newServerTLSConfig(TLSConfig{
+		Domains: []string{"gateway.example.com"},
+		ACME:    &ACMEConfig{AcceptTOS: true, CacheDir: dir},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alpn := false
+	for _, p := range tc.NextProtos {
+		alpn = alpn || p == acme.ALPNProto
+	}
+	if !alpn {
+		t.Errorf("expected the TLS-ALPN-01 challenges to be answered, got %v", tc.NextProtos)
+	}
+
+	// unknown names are refused before contacting the CA
+	if _, err := tc.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Error("expected the certificate of an unknown domain to be refused")
+	}
+}
@@ -0,0 +1,12 @@
+// +build !acme
+
+package corehttp
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+func newACMETLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	return nil, fmt.Errorf("%s is set but ipfs was built without ACME support, rebuild it with GOTAGS=acme", tlsACMEKey)
+}
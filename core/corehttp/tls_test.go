@@ -0,0 +1,26 @@
+package corehttp
+
+import (
+	"testing"
+)
+
+func TestMatchDomain(t *testing.T) {
+	domains := []string{"example.com", "*.ipfs.example.net"}
+	for _, tc := range []struct {
+		name  string
+		match bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com.", true},
+		{"www.example.com", false},
+		{"bafybeigdyrzt.ipfs.example.net", true},
+		{"ipfs.example.net", false},
+		{"a.b.ipfs.example.net", false},
+		{"evilipfs.example.net", false},
+		{"", false},
+	} {
+		if m := matchDomain(domains, tc.name); m != tc.match {
+			t.Errorf("matchDomain(%q): expected %t, got %t", tc.name, tc.match, m)
+		}
+	}
+}
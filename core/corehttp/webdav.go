@@ -0,0 +1,880 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	gopath "path"
+	"strings"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+	uio "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs/io"
+)
+
+const webdavAddressesKey = "Addresses.WebDAV"
+
+// The collections served over WebDAV: MFS, writable, and the content of IPFS,
+// read-only. The root of /ipfs isn't listable, as with the FUSE mount.
+const (
+	webdavFilesPrefix = "/files"
+	webdavIpfsPrefix  = "/ipfs"
+)
+
+var errWebDAVReadOnly = errors.New("read-only, only /files is writable")
+
+// WebDAVAddresses returns the multiaddrs to serve WebDAV on, set by the
+// optional Addresses.WebDAV key. WebDAV isn't served if none is set.
+func WebDAVAddresses(r repo.Repo) ([]string, error) {
+	return configStrings(r, webdavAddressesKey)
+}
+
+// WebDAVOption serves MFS, writable, under /files and the content of IPFS,
+// read-only, under /ipfs over WebDAV, for the clients mounting network drives
+// where FUSE isn't available. The locks of class 2, which some clients
+// require to write, are enforced. The requests are checked by davAccess.
+func WebDAVOption() ServeOption {
+	return func(n *core.IpfsNode, lis net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		if n.FilesRoot == nil {
+			return nil, errors.New("webdav: the node has no MFS root")
+		}
+		access, err := newDavAccess(n.Repo, lis)
+		if err != nil {
+			return nil, fmt.Errorf("webdav: %s", err)
+		}
+		mux.Handle("/", &webdavHandler{
+			node:   n,
+			api:    coreapi.NewCoreAPI(n),
+			access: access,
+			locks:  newDavLocks(),
+		})
+		return mux, nil
+	}
+}
+
+type webdavHandler struct {
+	node   *core.IpfsNode
+	api    coreiface.CoreAPI
+	access *davAccess
+	locks  *davLocks
+}
+
+// davPath is a path served over WebDAV.
+type davPath struct {
+	// href is the cleaned path of the request
+	href string
+
+	// files is set for the paths in MFS, and ipfs for the /ipfs/ paths
+	files bool
+	ipfs  bool
+
+	// path is the path in MFS or the /ipfs/ path
+	path string
+}
+
+// virtual returns true for the collections which aren't in MFS or IPFS: the
+// root and /ipfs.
+func (p davPath) virtual() bool {
+	return !p.files && (!p.ipfs || p.path == webdavIpfsPrefix)
+}
+
+func parseDavPath(p string) (davPath, bool) {
+	p = gopath.Clean("/" + p)
+	switch {
+	case p == "/":
+		return davPath{href: p}, true
+	case p == webdavFilesPrefix || strings.HasPrefix(p, webdavFilesPrefix+"/"):
+		path := strings.TrimPrefix(p, webdavFilesPrefix)
+		if path == "" {
+			path = "/"
+		}
+		return davPath{href: p, files: true, path: path}, true
+	case p == webdavIpfsPrefix || strings.HasPrefix(p, webdavIpfsPrefix+"/"):
+		return davPath{href: p, ipfs: true, path: p}, true
+	default:
+		return davPath{}, false
+	}
+}
+
+// davEntry describes a resource, as listed by PROPFIND.
+type davEntry struct {
+	href  string
+	dir   bool
+	size  uint64
+	mtime time.Time
+	etag  string
+}
+
+// davChanges are the methods changing MFS.
+var davChanges = map[string]bool{
+	"PROPPATCH": true,
+	"PUT":       true,
+	"DELETE":    true,
+	"MKCOL":     true,
+	"COPY":      true,
+	"MOVE":      true,
+	"LOCK":      true,
+}
+
+func (i *webdavHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if code, reason := i.access.check(r); code != 0 {
+		if code == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ipfs"`)
+		}
+		http.Error(w, reason, code)
+		return
+	}
+
+	p, ok := parseDavPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if davChanges[r.Method] {
+		// the changes of MFS hold its lock shared, see corefiles.Apply
+		i.node.FilesLock.RLock()
+		defer i.node.FilesLock.RUnlock()
+	}
+
+	var err error
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("DAV", "1, 2")
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, COPY, MOVE, PROPFIND, PROPPATCH, LOCK, UNLOCK")
+		return
+	case "GET", "HEAD":
+		err = i.get(w, r, p)
+	case "PROPFIND":
+		err = i.propfind(w, r, p)
+	case "PROPPATCH":
+		err = i.proppatch(w, r, p)
+	case "PUT":
+		err = i.put(w, r, p)
+	case "DELETE":
+		err = i.delete(w, r, p)
+	case "MKCOL":
+		err = i.mkcol(w, r, p)
+	case "COPY", "MOVE":
+		err = i.copyMove(w, r, p)
+	case "LOCK":
+		err = i.lock(w, r, p)
+	case "UNLOCK":
+		err = i.unlock(w, r, p)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+	if err != nil {
+		webdavError(w, err)
+	}
+}
+
+// davStatusError is an error answered with its status code.
+type davStatusError struct {
+	code int
+	err  error
+}
+
+func (e davStatusError) Error() string {
+	return e.err.Error()
+}
+
+func davError(code int, format string, args ...interface{}) error {
+	return davStatusError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+func webdavError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch e := err.(type) {
+	case davStatusError:
+		code = e.code
+	default:
+		if err == os.ErrNotExist {
+			code = http.StatusNotFound
+		}
+	}
+	if code == http.StatusInternalServerError {
+		log.Errorf("webdav: %s", err)
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// writable checks that p is an entry of MFS that can be changed.
+func writable(p davPath) error {
+	if !p.files {
+		return davError(http.StatusForbidden, "%s", errWebDAVReadOnly)
+	}
+	if p.path == "/" {
+		return davError(http.StatusForbidden, "cannot change the root of /files")
+	}
+	return nil
+}
+
+// writeBack returns true if the changes are left to the flusher of the node.
+func (i *webdavHandler) writeBack() bool {
+	return i.node.FilesFlusher.WriteBack()
+}
+
+// parentDir returns the parent directory of the entry of MFS at path, and
+// the name of the entry.
+func (i *webdavHandler) parentDir(path string) (*mfs.Directory, string, error) {
+	dir, name := gopath.Split(path)
+	parent, err := mfs.Lookup(i.node.FilesRoot, dir)
+	if err != nil {
+		return nil, "", davError(http.StatusConflict, "parent of %s: %s", path, err)
+	}
+	pdir, ok := parent.(*mfs.Directory)
+	if !ok {
+		return nil, "", davError(http.StatusConflict, "parent of %s is not a directory", path)
+	}
+	return pdir, name, nil
+}
+
+func (i *webdavHandler) flushDir(dir *mfs.Directory) error {
+	if i.writeBack() {
+		return nil
+	}
+	return dir.Flush()
+}
+
+// changed reports the change of the entry at path to the node, see the FUSE
+// mount of MFS.
+func (i *webdavHandler) changed(ctx context.Context, op string, resized bool, path, from string) {
+	n := i.node
+	if resized {
+		paths := []string{path}
+		if from != "" {
+			paths = append(paths, from)
+		}
+		corefiles.AutoShardParents(ctx, n.FilesRoot, n.DAG, n.FilesShardSize, paths...)
+	}
+	n.FilesEvents.NotifyChange(n.FilesRoot, op, path, from)
+	n.FilesFlusher.Changed()
+}
+
+// lookupNode returns the node at p, which must not be virtual.
+func (i *webdavHandler) lookupNode(ctx context.Context, p davPath) (ipld.Node, error) {
+	if p.files {
+		fsn, err := mfs.Lookup(i.node.FilesRoot, p.path)
+		if err != nil {
+			return nil, err
+		}
+		return fsn.GetNode()
+	}
+
+	ip, err := coreiface.ParsePath(p.path)
+	if err != nil {
+		return nil, davError(http.StatusNotFound, "%s", err)
+	}
+	nd, err := i.api.ResolveNode(ctx, ip)
+	if err != nil {
+		return nil, davError(http.StatusNotFound, "%s", err)
+	}
+	return nd, nil
+}
+
+// nodeEntry describes nd, a unixfs node, found at href.
+func nodeEntry(href string, nd ipld.Node) (davEntry, error) {
+	e := davEntry{href: href, etag: `"` + nd.Cid().String() + `"`}
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return e, err
+		}
+		switch fsn.Type() {
+		case ft.TDirectory, ft.THAMTShard:
+			e.dir = true
+		default:
+			e.size = fsn.FileSize()
+		}
+	case *dag.RawNode:
+		e.size = uint64(len(nd.RawData()))
+	default:
+		return e, fmt.Errorf("%s is not a unixfs node", href)
+	}
+
+	md, err := corefiles.ReadMetadata(nd)
+	if err != nil {
+		return e, err
+	}
+	e.mtime = md.Mtime
+	return e, nil
+}
+
+// entries returns the description of p, and of its children if children is
+// set and p is a collection.
+func (i *webdavHandler) entries(ctx context.Context, p davPath, children bool) ([]davEntry, error) {
+	if p.virtual() {
+		out := []davEntry{{href: p.href, dir: true}}
+		if children && p.href == "/" {
+			out = append(out,
+				davEntry{href: webdavFilesPrefix, dir: true},
+				davEntry{href: webdavIpfsPrefix, dir: true})
+		}
+		return out, nil
+	}
+
+	nd, err := i.lookupNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	e, err := nodeEntry(p.href, nd)
+	if err != nil {
+		return nil, err
+	}
+	out := []davEntry{e}
+	if !children || !e.dir {
+		return out, nil
+	}
+
+	if p.files {
+		fsn, err := mfs.Lookup(i.node.FilesRoot, p.path)
+		if err != nil {
+			return nil, err
+		}
+		dir, ok := fsn.(*mfs.Directory)
+		if !ok {
+			return out, nil
+		}
+		names, err := dir.ListNames(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			child, err := dir.Child(name)
+			if err != nil {
+				return nil, err
+			}
+			cnd, err := child.GetNode()
+			if err != nil {
+				return nil, err
+			}
+			ce, err := nodeEntry(gopath.Join(p.href, name), cnd)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ce)
+		}
+		return out, nil
+	}
+
+	dir, err := uio.NewDirectoryFromNode(i.node.DAG, nd)
+	if err != nil {
+		return nil, err
+	}
+	links, err := dir.Links(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		cnd, err := l.GetNode(ctx, i.node.DAG)
+		if err != nil {
+			return nil, err
+		}
+		ce, err := nodeEntry(gopath.Join(p.href, l.Name), cnd)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ce)
+	}
+	return out, nil
+}
+
+var webdavListTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html><head><title>{{.Path}}</title></head><body>
+<h1>{{.Path}}</h1>
+<ul>
+{{range .Entries}}<li><a href="{{.Href}}">{{.Name}}</a></li>
+{{end}}</ul>
+</body></html>
+`))
+
+func (i *webdavHandler) get(w http.ResponseWriter, r *http.Request, p davPath) error {
+	ctx := r.Context()
+	list, err := i.entries(ctx, p, true)
+	if err != nil {
+		return err
+	}
+	e := list[0]
+
+	if e.dir {
+		type link struct{ Href, Name string }
+		data := struct {
+			Path    string
+			Entries []link
+		}{Path: p.href}
+		for _, ce := range list[1:] {
+			name := gopath.Base(ce.href)
+			if ce.dir {
+				name += "/"
+			}
+			data.Entries = append(data.Entries, link{Href: davHref(ce), Name: name})
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		return webdavListTemplate.Execute(w, data)
+	}
+
+	var content io.ReadSeeker
+	if p.files {
+		fsn, err := mfs.Lookup(i.node.FilesRoot, p.path)
+		if err != nil {
+			return err
+		}
+		fi, ok := fsn.(*mfs.File)
+		if !ok {
+			return davError(http.StatusConflict, "%s is not a file", p.href)
+		}
+		fd, err := fi.Open(mfs.OpenReadOnly, false)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		content = fd
+	} else {
+		ip, err := coreiface.ParsePath(p.path)
+		if err != nil {
+			return davError(http.StatusNotFound, "%s", err)
+		}
+		f, err := i.api.Unixfs().Get(ctx, ip)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		content = f
+	}
+
+	w.Header().Set("Etag", e.etag)
+	http.ServeContent(w, r, gopath.Base(p.href), e.mtime, content)
+	return nil
+}
+
+// davHref returns the escaped href of e, ending with a slash for the
+// collections.
+func davHref(e davEntry) string {
+	href := (&url.URL{Path: e.href}).EscapedPath()
+	if e.dir && !strings.HasSuffix(href, "/") {
+		href += "/"
+	}
+	return href
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	XmlnsD    string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+type davProp struct {
+	DisplayName   string          `xml:"D:displayname"`
+	ResourceType  davResourceType `xml:"D:resourcetype"`
+	ContentLength *uint64         `xml:"D:getcontentlength,omitempty"`
+	LastModified  string          `xml:"D:getlastmodified,omitempty"`
+	ETag          string          `xml:"D:getetag,omitempty"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection,omitempty"`
+}
+
+func writeMultistatus(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// propfind answers with all the properties of the resource, whatever the
+// properties requested.
+func (i *webdavHandler) propfind(w http.ResponseWriter, r *http.Request, p davPath) error {
+	var children bool
+	switch r.Header.Get("Depth") {
+	case "0":
+	case "1":
+		children = true
+	default:
+		return davError(http.StatusForbidden, "PROPFIND requests must set Depth to 0 or 1")
+	}
+	io.Copy(ioutil.Discard, r.Body)
+
+	list, err := i.entries(r.Context(), p, children)
+	if err != nil {
+		return err
+	}
+
+	ms := davMultistatus{XmlnsD: "DAV:"}
+	for _, e := range list {
+		prop := davProp{
+			DisplayName: gopath.Base(e.href),
+			ETag:        e.etag,
+		}
+		if e.dir {
+			prop.ResourceType.Collection = &struct{}{}
+		} else {
+			size := e.size
+			prop.ContentLength = &size
+		}
+		if !e.mtime.IsZero() {
+			prop.LastModified = e.mtime.UTC().Format(http.TimeFormat)
+		}
+		ms.Responses = append(ms.Responses, davResponse{
+			Href: davHref(e),
+			Propstat: davPropstat{
+				Prop:   prop,
+				Status: "HTTP/1.1 200 OK",
+			},
+		})
+	}
+	return writeMultistatus(w, ms)
+}
+
+// proppatch accepts the properties set or removed without storing them:
+// some clients, like Windows, give up on the files whose properties can't be
+// set.
+func (i *webdavHandler) proppatch(w http.ResponseWriter, r *http.Request, p davPath) error {
+	if err := writable(p); err != nil {
+		return err
+	}
+	if err := i.locks.check(r, false, p.path); err != nil {
+		return err
+	}
+	if _, err := mfs.Lookup(i.node.FilesRoot, p.path); err != nil {
+		return err
+	}
+
+	// the names of the elements in the prop elements
+	var names []xml.Name
+	dec := xml.NewDecoder(r.Body)
+	depth, propDepth := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return davError(http.StatusBadRequest, "invalid PROPPATCH body: %s", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case propDepth == 0 && tok.Name.Space == "DAV:" && tok.Name.Local == "prop":
+				propDepth = depth
+			case propDepth != 0 && depth == propDepth+1:
+				names = append(names, tok.Name)
+			}
+		case xml.EndElement:
+			if depth == propDepth {
+				propDepth = 0
+			}
+			depth--
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<D:multistatus xmlns:D="DAV:"><D:response><D:href>`)
+	xml.EscapeText(&b, []byte((&url.URL{Path: p.href}).EscapedPath()))
+	b.WriteString(`</D:href><D:propstat><D:prop>`)
+	for n, name := range names {
+		fmt.Fprintf(&b, `<p%d:%s xmlns:p%d="`, n, name.Local, n)
+		xml.EscapeText(&b, []byte(name.Space))
+		b.WriteString(`"/>`)
+	}
+	b.WriteString(`</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response></D:multistatus>`)
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (i *webdavHandler) put(w http.ResponseWriter, r *http.Request, p davPath) error {
+	if err := writable(p); err != nil {
+		return err
+	}
+	if err := i.locks.check(r, false, p.path); err != nil {
+		return err
+	}
+	pdir, name, err := i.parentDir(p.path)
+	if err != nil {
+		return err
+	}
+
+	created := false
+	child, err := pdir.Child(name)
+	switch err {
+	case nil:
+		if _, ok := child.(*mfs.Directory); ok {
+			return davError(http.StatusMethodNotAllowed, "%s is a collection", p.href)
+		}
+	case os.ErrNotExist:
+		created = true
+	default:
+		return err
+	}
+
+	if err := corefiles.WriteFile(i.node.FilesRoot, p.path, r.Body, !i.writeBack()); err != nil {
+		return err
+	}
+	i.changed(r.Context(), corefiles.OpWrite, created, p.path, "")
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return nil
+}
+
+func (i *webdavHandler) delete(w http.ResponseWriter, r *http.Request, p davPath) error {
+	if err := writable(p); err != nil {
+		return err
+	}
+	if err := i.locks.check(r, true, p.path); err != nil {
+		return err
+	}
+	pdir, name, err := i.parentDir(p.path)
+	if err != nil {
+		return err
+	}
+	if _, err := pdir.Child(name); err != nil {
+		return err
+	}
+	if err := pdir.Unlink(name); err != nil {
+		return err
+	}
+	if err := i.flushDir(pdir); err != nil {
+		return err
+	}
+	i.locks.removeAll(p.path)
+	i.changed(r.Context(), corefiles.OpRemove, true, p.path, "")
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (i *webdavHandler) mkcol(w http.ResponseWriter, r *http.Request, p davPath) error {
+	if err := writable(p); err != nil {
+		return err
+	}
+	if err := i.locks.check(r, false, p.path); err != nil {
+		return err
+	}
+	if r.ContentLength > 0 {
+		return davError(http.StatusUnsupportedMediaType, "MKCOL requests can't have a body")
+	}
+	pdir, name, err := i.parentDir(p.path)
+	if err != nil {
+		return err
+	}
+	if _, err := pdir.Child(name); err == nil {
+		return davError(http.StatusMethodNotAllowed, "%s already exists", p.href)
+	}
+	if _, err := pdir.Mkdir(name); err != nil {
+		return err
+	}
+	if err := i.flushDir(pdir); err != nil {
+		return err
+	}
+	i.changed(r.Context(), corefiles.OpMkdir, true, p.path, "")
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// copyMove copies p into MFS, from MFS or IPFS, or moves it within MFS.
+func (i *webdavHandler) copyMove(w http.ResponseWriter, r *http.Request, p davPath) error {
+	move := r.Method == "MOVE"
+	if move {
+		if err := writable(p); err != nil {
+			return err
+		}
+	} else if p.virtual() {
+		return davError(http.StatusForbidden, "cannot copy %s", p.href)
+	}
+
+	u, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || u.Path == "" {
+		return davError(http.StatusBadRequest, "invalid Destination header")
+	}
+	dst, ok := parseDavPath(u.Path)
+	if !ok {
+		return davError(http.StatusBadGateway, "the destination is not served")
+	}
+	if err := writable(dst); err != nil {
+		return err
+	}
+	if dst.href == p.href {
+		return davError(http.StatusForbidden, "the source and the destination are the same")
+	}
+	if err := i.locks.check(r, true, dst.path); err != nil {
+		return err
+	}
+	if move {
+		if err := i.locks.check(r, true, p.path); err != nil {
+			return err
+		}
+	}
+
+	nd, err := i.lookupNode(r.Context(), p)
+	if err != nil {
+		return err
+	}
+	switch nd.(type) {
+	case *dag.ProtoNode, *dag.RawNode:
+	default:
+		return davError(http.StatusForbidden, "%s is not a unixfs node", p.href)
+	}
+
+	pdir, name, err := i.parentDir(dst.path)
+	if err != nil {
+		return err
+	}
+	status := http.StatusCreated
+	if _, err := pdir.Child(name); err == nil {
+		if r.Header.Get("Overwrite") == "F" {
+			return davError(http.StatusPreconditionFailed, "%s already exists", dst.href)
+		}
+		if err := pdir.Unlink(name); err != nil {
+			return err
+		}
+		status = http.StatusNoContent
+	}
+
+	if move {
+		if err := mfs.Mv(i.node.FilesRoot, p.path, dst.path); err != nil {
+			return err
+		}
+		if spdir, _, err := i.parentDir(p.path); err == nil {
+			if err := i.flushDir(spdir); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := pdir.AddChild(name, nd); err != nil {
+			return err
+		}
+	}
+	if err := i.flushDir(pdir); err != nil {
+		return err
+	}
+
+	if move {
+		i.locks.removeAll(p.path)
+		i.changed(r.Context(), corefiles.OpMove, true, dst.path, p.path)
+	} else {
+		i.changed(r.Context(), corefiles.OpCopy, true, dst.path, "")
+	}
+	w.WriteHeader(status)
+	return nil
+}
+
+// lock grants an exclusive write lock on p and its descendants, creating an
+// empty file for the unmapped paths as required, or refreshes the lock
+// submitted in the If header when the request has no body.
+func (i *webdavHandler) lock(w http.ResponseWriter, r *http.Request, p davPath) error {
+	if err := writable(p); err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<16))
+	if err != nil {
+		return err
+	}
+	timeout := davLockTimeout(r)
+
+	if len(body) == 0 {
+		tokens := davSubmittedTokens(r)
+		if len(tokens) != 1 {
+			return davError(http.StatusBadRequest, "expected the lock to refresh in the If header")
+		}
+		for token := range tokens {
+			if err := i.locks.refresh(token, p.path, timeout); err != nil {
+				return err
+			}
+			return writeLockDiscovery(w, http.StatusOK, p, token, timeout)
+		}
+	}
+
+	token, err := i.locks.create(p.path, timeout)
+	if err != nil {
+		return err
+	}
+
+	status := http.StatusOK
+	if _, err := mfs.Lookup(i.node.FilesRoot, p.path); err == os.ErrNotExist {
+		err := func() error {
+			if _, _, err := i.parentDir(p.path); err != nil {
+				return err
+			}
+			return corefiles.WriteFile(i.node.FilesRoot, p.path, strings.NewReader(""), !i.writeBack())
+		}()
+		if err != nil {
+			i.locks.remove(token, p.path)
+			return err
+		}
+		i.changed(r.Context(), corefiles.OpWrite, true, p.path, "")
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Lock-Token", "<"+token+">")
+	return writeLockDiscovery(w, status, p, token, timeout)
+}
+
+// writeLockDiscovery answers a LOCK request with the lock of token on p.
+func writeLockDiscovery(w http.ResponseWriter, status int, p davPath, token string, timeout time.Duration) error {
+	var body strings.Builder
+	body.WriteString(xml.Header)
+	body.WriteString(`<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`)
+	body.WriteString(`<D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope>`)
+	fmt.Fprintf(&body, `<D:depth>infinity</D:depth><D:timeout>Second-%d</D:timeout>`, int(timeout.Seconds()))
+	fmt.Fprintf(&body, `<D:locktoken><D:href>%s</D:href></D:locktoken>`, token)
+	body.WriteString(`<D:lockroot><D:href>`)
+	xml.EscapeText(&body, []byte((&url.URL{Path: p.href}).EscapedPath()))
+	body.WriteString(`</D:href></D:lockroot></D:activelock></D:lockdiscovery></D:prop>`)
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := io.WriteString(w, body.String())
+	return err
+}
+
+// unlock releases the lock of the Lock-Token header.
+func (i *webdavHandler) unlock(w http.ResponseWriter, r *http.Request, p davPath) error {
+	if err := writable(p); err != nil {
+		return err
+	}
+	if err := i.locks.remove(davLockToken(r), p.path); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,169 @@
+package corehttp
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+)
+
+const (
+	webdavAllowedHostsKey = "WebDAV.AllowedHosts"
+	webdavAuthFileKey     = "WebDAV.AuthFile"
+)
+
+// davAccess decides which requests the WebDAV server answers.
+//
+// The Host of the requests must name the address the server listens on, so
+// that the pages of other origins can't reach it by rebinding their names to
+// its address, and the requests sent by the pages of other origins are
+// refused. The clients must authenticate with HTTP basic authentication when
+// WebDAV.AuthFile is set.
+type davAccess struct {
+	port  string
+	anyIP bool            // the server listens on all the addresses, any IP is its own
+	hosts map[string]bool // the names and IPs of the server, lower case
+
+	users map[string][sha256.Size]byte // the hashes of the passwords of the users, nil without authentication
+}
+
+func newDavAccess(r repo.Repo, lis net.Listener) (*davAccess, error) {
+	host, port, err := net.SplitHostPort(lis.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+
+	a := &davAccess{
+		port:  port,
+		hosts: map[string]bool{"localhost": true},
+	}
+	if ip := net.ParseIP(host); ip == nil {
+		a.hosts[strings.ToLower(host)] = true
+	} else if ip.IsUnspecified() {
+		a.anyIP = true
+	} else {
+		a.hosts[ip.String()] = true
+		if !ip.IsLoopback() {
+			delete(a.hosts, "localhost")
+		}
+	}
+
+	names, err := configStrings(r, webdavAllowedHostsKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		a.hosts[strings.ToLower(name)] = true
+	}
+
+	path, err := configString(r, webdavAuthFileKey)
+	if err != nil || path == "" {
+		return a, err
+	}
+	if !filepath.IsAbs(path) {
+		pr, ok := r.(interface{ Path() string })
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s: the path must be absolute, the repo is not on disk", webdavAuthFileKey)
+		}
+		path = filepath.Join(pr.Path(), path)
+	}
+	a.users, err = readDavUsers(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for %s: %s", webdavAuthFileKey, err)
+	}
+	return a, nil
+}
+
+// readDavUsers reads the users of the file at path, a user:password per
+// line. The empty lines and the lines starting with # are skipped.
+func readDavUsers(path string) (map[string][sha256.Size]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := make(map[string][sha256.Size]byte)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected user:password", n)
+		}
+		users[line[:i]] = sha256.Sum256([]byte(line[i+1:]))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, errors.New("no users")
+	}
+	return users, nil
+}
+
+// check returns the status and the reason of the refusal of r, 0 if r is
+// answered.
+func (a *davAccess) check(r *http.Request) (int, string) {
+	if !a.allowedHost(r.Host) {
+		return http.StatusMisdirectedRequest, "unknown host " + r.Host
+	}
+
+	// the browsers send the origin of the cross-origin requests, and of the
+	// requests other than GET and HEAD
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return http.StatusForbidden, "cross-origin requests are refused"
+		}
+	}
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return http.StatusForbidden, "cross-origin requests are refused"
+	}
+
+	if a.users != nil && !a.authenticated(r) {
+		return http.StatusUnauthorized, "authentication required"
+	}
+	return 0, ""
+}
+
+// allowedHost tells whether host, the Host header of a request, names the
+// server.
+func (a *davAccess) allowedHost(host string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		// no port, the default one of HTTP
+		name, port = host, "80"
+	}
+	if port != a.port {
+		return false
+	}
+
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(name, "["), "]"))
+	if ip := net.ParseIP(name); ip != nil {
+		return a.anyIP || a.hosts[ip.String()]
+	}
+	return a.hosts[name]
+}
+
+func (a *davAccess) authenticated(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	want, ok := a.users[user]
+	sum := sha256.Sum256([]byte(pass))
+	return subtle.ConstantTimeCompare(sum[:], want[:]) == 1 && ok
+}
@@ -0,0 +1,183 @@
+package corehttp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// davMaxLockTimeout bounds the time a WebDAV lock is held without being
+// refreshed, whatever the timeout requested.
+const davMaxLockTimeout = time.Hour
+
+// davLock is a write lock on a path of MFS and its descendants.
+type davLock struct {
+	path    string
+	expires time.Time
+}
+
+// davLocks are the exclusive write locks granted over WebDAV. The changes of
+// the paths locked, of their descendants and of the parents of the entries
+// created in them are refused unless the request submits the token of the
+// lock in its If header.
+type davLocks struct {
+	lk    sync.Mutex
+	locks map[string]*davLock // by token
+}
+
+func newDavLocks() *davLocks {
+	return &davLocks{locks: make(map[string]*davLock)}
+}
+
+// davCovers tells whether a lock on locked covers path.
+func davCovers(locked, path string) bool {
+	return locked == "/" || path == locked || strings.HasPrefix(path, locked+"/")
+}
+
+// conflict returns the token of a lock covering path, or covered by it if
+// descendants is set, which isn't submitted, "" if there is none. l.lk must be
+// held.
+func (l *davLocks) conflict(path string, descendants bool, submitted map[string]bool) string {
+	now := time.Now()
+	for token, lock := range l.locks {
+		if now.After(lock.expires) {
+			delete(l.locks, token)
+			continue
+		}
+		if submitted[token] {
+			continue
+		}
+		if davCovers(lock.path, path) || (descendants && davCovers(path, lock.path)) {
+			return token
+		}
+	}
+	return ""
+}
+
+// check refuses the changes of paths, and of their descendants if
+// descendants is set, under a lock whose token r doesn't submit.
+func (l *davLocks) check(r *http.Request, descendants bool, paths ...string) error {
+	submitted := davSubmittedTokens(r)
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	for _, path := range paths {
+		if l.conflict(path, descendants, submitted) != "" {
+			return davError(http.StatusLocked, "%s is locked", path)
+		}
+	}
+	return nil
+}
+
+// create grants a lock on path and its descendants for timeout, refused if
+// another lock covers any of them.
+func (l *davLocks) create(path string, timeout time.Duration) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	token := fmt.Sprintf("opaquelocktoken:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.conflict(path, true, nil) != "" {
+		return "", davError(http.StatusLocked, "%s is locked", path)
+	}
+	l.locks[token] = &davLock{path: path, expires: time.Now().Add(timeout)}
+	return token, nil
+}
+
+// refresh extends the lock of token covering path by timeout.
+func (l *davLocks) refresh(token, path string, timeout time.Duration) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	lock, ok := l.locks[token]
+	if !ok || time.Now().After(lock.expires) || !davCovers(lock.path, path) {
+		return davError(http.StatusPreconditionFailed, "no lock %s on %s", token, path)
+	}
+	lock.expires = time.Now().Add(timeout)
+	return nil
+}
+
+// remove releases the lock of token covering path.
+func (l *davLocks) remove(token, path string) error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	lock, ok := l.locks[token]
+	if !ok || !davCovers(lock.path, path) {
+		return davError(http.StatusConflict, "no lock %s on %s", token, path)
+	}
+	delete(l.locks, token)
+	return nil
+}
+
+// removeAll releases the locks of path and its descendants, once they are
+// deleted or moved.
+func (l *davLocks) removeAll(path string) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	for token, lock := range l.locks {
+		if davCovers(path, lock.path) {
+			delete(l.locks, token)
+		}
+	}
+}
+
+// davSubmittedTokens returns the lock tokens listed in the If header of r,
+// e.g. If: (<opaquelocktoken:...>) or </files/a> (<opaquelocktoken:...>).
+// The state tokens are those between parentheses, the resource tags outside
+// of them are ignored.
+func davSubmittedTokens(r *http.Request) map[string]bool {
+	tokens := make(map[string]bool)
+	depth := 0
+	h := r.Header.Get("If")
+	for i := 0; i < len(h); i++ {
+		switch h[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '<':
+			end := strings.IndexByte(h[i:], '>')
+			if end < 0 {
+				return tokens
+			}
+			if depth > 0 {
+				tokens[h[i+1:i+end]] = true
+			}
+			i += end
+		}
+	}
+	return tokens
+}
+
+// davLockToken returns the token of the Lock-Token header of r, <token>.
+func davLockToken(r *http.Request) string {
+	return strings.TrimSuffix(strings.TrimPrefix(r.Header.Get("Lock-Token"), "<"), ">")
+}
+
+// davLockTimeout returns the timeout requested by the Timeout header of r,
+// e.g. Second-600 or Infinite, bounded by davMaxLockTimeout.
+func davLockTimeout(r *http.Request) time.Duration {
+	for _, t := range strings.Split(r.Header.Get("Timeout"), ",") {
+		t = strings.TrimSpace(t)
+		if !strings.HasPrefix(t, "Second-") {
+			continue
+		}
+		s, err := strconv.ParseUint(strings.TrimPrefix(t, "Second-"), 10, 32)
+		if err != nil || s == 0 {
+			continue
+		}
+		if d := time.Duration(s) * time.Second; d < davMaxLockTimeout {
+			return d
+		}
+	}
+	return davMaxLockTimeout
+}
@@ -0,0 +1,168 @@
+package corehttp
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+)
+
+const davLockBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`
+
+func TestWebDAV(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, WebDAVOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path string, body io.Reader, headers map[string]string, status int) string {
+		t.Helper()
+		req, err := http.NewRequest(method, ts.URL+path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		out, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != status {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, status, res.StatusCode, out)
+		}
+		return string(out)
+	}
+
+	do("MKCOL", "/files/dir", nil, nil, http.StatusCreated)
+	do("MKCOL", "/files/missing/dir", nil, nil, http.StatusConflict)
+	do("PUT", "/files/dir/a.txt", strings.NewReader("hello"), nil, http.StatusCreated)
+	do("PUT", "/files/dir/a.txt", strings.NewReader("hello dav"), nil, http.StatusNoContent)
+	if out := do("GET", "/files/dir/a.txt", nil, nil, http.StatusOK); out != "hello dav" {
+		t.Fatalf("expected the content written, got %q", out)
+	}
+
+	out := do("PROPFIND", "/files/dir", nil, map[string]string{"Depth": "1"}, http.StatusMultiStatus)
+	if !strings.Contains(out, "<D:href>/files/dir/</D:href>") || !strings.Contains(out, "<D:href>/files/dir/a.txt</D:href>") {
+		t.Fatalf("expected the directory and its file to be listed, got %s", out)
+	}
+	if !strings.Contains(out, "<D:getcontentlength>9</D:getcontentlength>") {
+		t.Fatalf("expected the size of the file, got %s", out)
+	}
+	do("PROPFIND", "/files/dir", nil, nil, http.StatusForbidden)
+
+	do("MOVE", "/files/dir/a.txt", nil, map[string]string{"Destination": ts.URL + "/files/b.txt"}, http.StatusCreated)
+	do("GET", "/files/dir/a.txt", nil, nil, http.StatusNotFound)
+	do("COPY", "/files/b.txt", nil, map[string]string{"Destination": ts.URL + "/files/dir/c.txt"}, http.StatusCreated)
+	do("COPY", "/files/b.txt", nil, map[string]string{"Destination": ts.URL + "/files/dir/c.txt", "Overwrite": "F"}, http.StatusPreconditionFailed)
+
+	// the content of IPFS is read-only, and can be copied into MFS
+	k, err := coreunix.Add(n, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := do("GET", "/ipfs/"+k, nil, nil, http.StatusOK); out != "fnord" {
+		t.Fatalf("expected the content added, got %q", out)
+	}
+	do("PUT", "/ipfs/"+k, strings.NewReader("x"), nil, http.StatusForbidden)
+	do("COPY", "/ipfs/"+k, nil, map[string]string{"Destination": ts.URL + "/files/fnord"}, http.StatusCreated)
+	if out := do("GET", "/files/fnord", nil, nil, http.StatusOK); out != "fnord" {
+		t.Fatalf("expected the content copied, got %q", out)
+	}
+
+	// the locks are enforced
+	out = do("LOCK", "/files/locked.txt", strings.NewReader(davLockBody), nil, http.StatusCreated)
+	token := strings.SplitN(strings.SplitN(out, "<D:locktoken><D:href>", 2)[1], "<", 2)[0]
+	do("LOCK", "/files", strings.NewReader(davLockBody), nil, http.StatusLocked)
+	do("PUT", "/files/locked.txt", strings.NewReader("x"), nil, http.StatusLocked)
+	do("PUT", "/files/locked.txt", strings.NewReader("x"), map[string]string{"If": "(<" + token + ">)"}, http.StatusNoContent)
+	do("LOCK", "/files/locked.txt", nil, map[string]string{"If": "(<" + token + ">)"}, http.StatusOK)
+	do("UNLOCK", "/files/locked.txt", nil, map[string]string{"Lock-Token": "<opaquelocktoken:bogus>"}, http.StatusConflict)
+	do("UNLOCK", "/files/locked.txt", nil, map[string]string{"Lock-Token": "<" + token + ">"}, http.StatusNoContent)
+	do("DELETE", "/files/locked.txt", nil, nil, http.StatusNoContent)
+
+	// the requests of other hosts and origins are refused
+	do("GET", "/files/fnord", nil, map[string]string{"Origin": "http://example.com"}, http.StatusForbidden)
+	req, err := http.NewRequest("GET", ts.URL+"/files/fnord", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "rebound.example.com"
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMisdirectedRequest {
+		t.Fatalf("expected the requests of other hosts to be refused, got %d", res.StatusCode)
+	}
+
+	do("DELETE", "/files/dir", nil, nil, http.StatusNoContent)
+	do("PROPFIND", "/files/dir", nil, map[string]string{"Depth": "0"}, http.StatusNotFound)
+	do("DELETE", "/files", nil, nil, http.StatusForbidden)
+}
+
+func TestWebDAVAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webdav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	users := filepath.Join(dir, "users")
+	if err := ioutil.WriteFile(users, []byte("# the users\nalice:secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a := &davAccess{port: "8081", hosts: map[string]bool{"localhost": true, "127.0.0.1": true}}
+	a.users, err = readDavUsers(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		host, origin, user, pass string
+		code                     int
+	}{
+		{host: "127.0.0.1:8081", user: "alice", pass: "secret"},
+		{host: "localhost:8081", user: "alice", pass: "secret"},
+		{host: "localhost:8081", origin: "http://localhost:8081", user: "alice", pass: "secret"},
+		{host: "localhost:8081", code: http.StatusUnauthorized},
+		{host: "localhost:8081", user: "alice", pass: "wrong", code: http.StatusUnauthorized},
+		{host: "localhost:8081", user: "bob", pass: "secret", code: http.StatusUnauthorized},
+		{host: "localhost:8082", user: "alice", pass: "secret", code: http.StatusMisdirectedRequest},
+		{host: "evil.example.com:8081", user: "alice", pass: "secret", code: http.StatusMisdirectedRequest},
+		{host: "localhost:8081", origin: "http://evil.example.com", user: "alice", pass: "secret", code: http.StatusForbidden},
+	} {
+		r := httptest.NewRequest("PROPFIND", "/files/", nil)
+		r.Host = c.host
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if c.user != "" {
+			r.SetBasicAuth(c.user, c.pass)
+		}
+		if code, reason := a.check(r); code != c.code {
+			t.Errorf("%+v: expected %d, got %d %s", c, c.code, code, reason)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package corerepo
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core"
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	pin "github.com/ipfs/go-ipfs/pin"
+
+	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+)
+
+// BackupFormatVersion is the version of the backup archives written by
+// Backup.
+const BackupFormatVersion = 1
+
+// Names of the entries of backup archives.
+const (
+	backupManifestName = "backup.json"
+	backupConfigName   = "config"
+	backupKeysDir      = "keystore"
+	backupBlocksDir    = "blocks"
+)
+
+// BackupManifest describes the content of a backup archive. It is the first
+// entry of the archive.
+type BackupManifest struct {
+	Version     int
+	Created     time.Time
+	PeerID      string
+	FilesRoot   string
+	Recursive   []string
+	Direct      []string
+	Keys        []string
+	WithBlocks  bool
+	BlocksCount int `json:",omitempty"`
+}
+
+// Backup writes a tar archive of the config, the keystore, the pins and the
+// MFS root of the node to w, followed by the blocks they reference if
+// withBlocks is true.
+//
+// The pins and the MFS root are read under the GC lock, so that the archive
+// is a consistent snapshot of the node, which is then released: pinning and
+// adding content proceed while the archive is written. The garbage collection
+// waits until the blocks are written.
+func Backup(ctx context.Context, n *core.IpfsNode, w io.Writer, withBlocks bool) error {
+	m, cfgb, keys, err := backupSnapshot(n, withBlocks)
+	if err != nil {
+		return err
+	}
+
+	var set *cid.Set
+	if withBlocks {
+		defer n.Blockstore.PinLock().Unlock()
+
+		ng := dag.NewDAGService(bserv.New(n.Blockstore, offline.Exchange(n.Blockstore)))
+		set, err = pinnedSet(ctx, m, ng)
+		if err != nil {
+			return err
+		}
+		m.BlocksCount = set.Len()
+	}
+
+	tw := tar.NewWriter(w)
+
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, backupManifestName, mb, m.Created); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, backupConfigName, cfgb, m.Created); err != nil {
+		return err
+	}
+
+	for i, name := range m.Keys {
+		if err := writeTarFile(tw, path.Join(backupKeysDir, name), keys[i], m.Created); err != nil {
+			return err
+		}
+	}
+
+	if set != nil {
+		err := set.ForEach(func(c cid.Cid) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			blk, err := n.Blockstore.Get(c)
+			if err != nil {
+				return fmt.Errorf("can't back up block %s: %s", c, err)
+			}
+			return writeTarFile(tw, path.Join(backupBlocksDir, c.String()), blk.RawData(), m.Created)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// backupSnapshot returns the manifest, the config and the keys of m.Keys of
+// a backup of n, read under the GC lock.
+func backupSnapshot(n *core.IpfsNode, withBlocks bool) (*BackupManifest, []byte, [][]byte, error) {
+	defer n.Blockstore.GCLock().Unlock()
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cfgb, err := config.HumanOutput(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rootNd, err := n.FilesRoot.GetDirectory().GetNode()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	m := &BackupManifest{
+		Version:    BackupFormatVersion,
+		Created:    time.Now().UTC(),
+		PeerID:     cfg.Identity.PeerID,
+		FilesRoot:  rootNd.Cid().String(),
+		Recursive:  cidStrings(n.Pinning.RecursiveKeys()),
+		Direct:     cidStrings(n.Pinning.DirectKeys()),
+		WithBlocks: withBlocks,
+	}
+
+	ks := n.Repo.Keystore()
+	if m.Keys, err = ks.List(); err != nil {
+		return nil, nil, nil, err
+	}
+	keys := make([][]byte, len(m.Keys))
+	for i, name := range m.Keys {
+		k, err := ks.Get(name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if keys[i], err = ci.MarshalPrivateKey(k); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return m, cfgb, keys, nil
+}
+
+// pinnedSet returns the blocks that are pinned or referenced by the MFS root
+// in the snapshot m, the recursive pins with all their descendants.
+func pinnedSet(ctx context.Context, m *BackupManifest, ng ipld.NodeGetter) (*cid.Set, error) {
+	set := cid.NewSet()
+	for _, s := range m.Direct {
+		c, err := cid.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		set.Add(c)
+	}
+
+	roots := append([]string{m.FilesRoot}, m.Recursive...)
+	for _, s := range roots {
+		c, err := cid.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		if !set.Visit(c) {
+			continue
+		}
+		err = dag.EnumerateChildren(ctx, dag.GetLinksWithDAG(ng), c, set.Visit)
+		if err != nil {
+			return nil, fmt.Errorf("can't back up the blocks of %s: %s", c, err)
+		}
+	}
+	return set, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, mtime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  mtime,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+func cidStrings(cids []cid.Cid) []string {
+	out := make([]string, len(cids))
+	for i, c := range cids {
+		out[i] = c.String()
+	}
+	return out
+}
+
+// RestoreResult describes what was restored from a backup.
+type RestoreResult struct {
+	Manifest BackupManifest
+
+	// Blocks is the number of blocks restored
+	Blocks int
+
+	// Keys restored, and SkippedKeys already existing in the keystore
+	Keys        []string
+	SkippedKeys []string `json:",omitempty"`
+
+	// Files added to the MFS root, and SkippedFiles already existing
+	Files        []string
+	SkippedFiles []string `json:",omitempty"`
+
+	// Config is true if the config was restored
+	Config bool
+}
+
+// Restore restores a backup archive written by Backup. Blocks and keys are
+// added, the pins of the backup are added to the existing ones, and the
+// entries of the MFS root of the backup are added to the MFS root of the
+// node. Existing keys and files are left untouched. If restoreConfig is
+// true, the config of the backup replaces the config of the node.
+//
+// Blocks that aren't in the backup are fetched from the exchange of the
+// node, which is offline unless the node is online.
+func Restore(ctx context.Context, n *core.IpfsNode, r io.Reader, restoreConfig bool) (*RestoreResult, error) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup: %s", err)
+	}
+	if hdr.Name != backupManifestName {
+		return nil, fmt.Errorf("invalid backup: expected %s, found %s", backupManifestName, hdr.Name)
+	}
+
+	out := &RestoreResult{}
+	if err := json.NewDecoder(tr).Decode(&out.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %s", err)
+	}
+	if out.Manifest.Version != BackupFormatVersion {
+		return nil, fmt.Errorf("unsupported backup format version %d", out.Manifest.Version)
+	}
+
+	defer n.Blockstore.PinLock().Unlock()
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch dir, name := path.Split(hdr.Name); {
+		case hdr.Name == backupConfigName:
+			if !restoreConfig {
+				continue
+			}
+			var cfg config.Config
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return nil, fmt.Errorf("invalid config in backup: %s", err)
+			}
+			if err := n.Repo.SetConfig(&cfg); err != nil {
+				return nil, err
+			}
+			out.Config = true
+		case strings.TrimSuffix(dir, "/") == backupKeysDir:
+			restored, err := restoreKey(n.Repo.Keystore(), name, data)
+			if err != nil {
+				return nil, err
+			}
+			if restored {
+				out.Keys = append(out.Keys, name)
+			} else {
+				out.SkippedKeys = append(out.SkippedKeys, name)
+			}
+		case strings.TrimSuffix(dir, "/") == backupBlocksDir:
+			if err := restoreBlock(n, name, data); err != nil {
+				return nil, err
+			}
+			out.Blocks++
+		default:
+			log.Warningf("ignoring unknown backup entry %s", hdr.Name)
+		}
+	}
+
+	if err := restorePins(ctx, n, &out.Manifest); err != nil {
+		return nil, err
+	}
+	if err := restoreFiles(ctx, n, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// restoreKey adds a key to the keystore, returning false if a key with the
+// same name exists.
+func restoreKey(ks keystore.Keystore, name string, data []byte) (bool, error) {
+	k, err := ci.UnmarshalPrivateKey(data)
+	if err != nil {
+		return false, fmt.Errorf("invalid key %s in backup: %s", name, err)
+	}
+	has, err := ks.Has(name)
+	if err != nil || has {
+		return false, err
+	}
+	return true, ks.Put(name, k)
+}
+
+func restoreBlock(n *core.IpfsNode, name string, data []byte) error {
+	c, err := cid.Decode(name)
+	if err != nil {
+		return fmt.Errorf("invalid block %s in backup: %s", name, err)
+	}
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("block %s in backup is corrupted", name)
+	}
+
+	blk, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return err
+	}
+	return n.Blockstore.Put(blk)
+}
+
+func restorePins(ctx context.Context, n *core.IpfsNode, m *BackupManifest) error {
+	// Direct pins are skipped if the block is pinned in any way, as the
+	// pinner refuses to pin directly recursively pinned blocks.
+	for _, pins := range []struct {
+		cids      []string
+		recursive bool
+		skip      pin.Mode
+	}{
+		{m.Recursive, true, pin.Recursive},
+		{m.Direct, false, pin.Any},
+	} {
+		for _, s := range pins.cids {
+			c, err := cid.Decode(s)
+			if err != nil {
+				return fmt.Errorf("invalid pin %s in backup: %s", s, err)
+			}
+			_, pinned, err := n.Pinning.IsPinnedWithType(c, pins.skip)
+			if err != nil {
+				return err
+			}
+			if pinned {
+				continue
+			}
+
+			nd, err := n.DAG.Get(ctx, c)
+			if err != nil {
+				return fmt.Errorf("can't restore pin %s: %s", s, err)
+			}
+			if err := n.Pinning.Pin(ctx, nd, pins.recursive); err != nil {
+				return fmt.Errorf("can't restore pin %s: %s", s, err)
+			}
+		}
+	}
+	return n.Pinning.Flush()
+}
+
+// restoreFiles adds the entries of the MFS root of the backup to the MFS
+// root of the node.
+func restoreFiles(ctx context.Context, n *core.IpfsNode, out *RestoreResult) error {
+	c, err := cid.Decode(out.Manifest.FilesRoot)
+	if err != nil {
+		return fmt.Errorf("invalid files root in backup: %s", err)
+	}
+	nd, err := n.DAG.Get(ctx, c)
+	if err != nil {
+		return fmt.Errorf("can't restore the files root %s: %s", c, err)
+	}
+
+	n.FilesLock.RLock()
+	defer n.FilesLock.RUnlock()
+	for _, l := range nd.Links() {
+		p := "/" + l.Name
+		if _, err := mfs.Lookup(n.FilesRoot, p); err == nil {
+			out.SkippedFiles = append(out.SkippedFiles, p)
+			continue
+		}
+
+		child, err := l.GetNode(ctx, n.DAG)
+		if err != nil {
+			return fmt.Errorf("can't restore %s: %s", p, err)
+		}
+		if err := mfs.PutNode(n.FilesRoot, p, child); err != nil {
+			return err
+		}
+		out.Files = append(out.Files, p)
+	}
+	return mfs.FlushPath(n.FilesRoot, "/")
+}
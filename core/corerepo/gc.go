@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
@@ -12,6 +13,7 @@ import (
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
 	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
 	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
 )
@@ -88,7 +90,43 @@ func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
 	}
 	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
 
-	return CollectResult(ctx, rmed, nil)
+	if err := CollectResult(ctx, rmed, nil); err != nil {
+		return err
+	}
+	return SyncStorageUsage(n)
+}
+
+// GarbageCollectDryRun reports what GarbageCollect would remove, without
+// removing anything.
+func GarbageCollectDryRun(n *core.IpfsNode, ctx context.Context) (*gc.DryRunReport, error) {
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// walk the blockstore below the tracking one, whose reads would keep the
+	// blocks from the collection in progress
+	var bs bstore.Blockstore = n.BaseBlocks
+	if n.Filestore != nil {
+		bs = n.Filestore
+	}
+	tbs, _ := n.Blockstore.(*gc.TrackingBlockstore)
+	return gc.DryRun(ctx, bs, tbs, n.Pinning, roots)
+}
+
+// SyncStorageUsage resets the storage usage tracked by the node to the size
+// of the repo. The usage tracked while adding and removing blocks drifts
+// from the size on disk, as datastores don't release space right away.
+func SyncStorageUsage(n *core.IpfsNode) error {
+	if n.StorageQuota == nil {
+		return nil
+	}
+	usage, err := n.Repo.GetStorageUsage()
+	if err != nil {
+		return err
+	}
+	n.StorageQuota.SetUsage(usage)
+	return nil
 }
 
 // CollectResult collects the output of a garbage collection run and calls the
@@ -157,6 +195,26 @@ func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result
 	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
 }
 
+// GarbageCollectWithProgress is GarbageCollectAsync also reporting the
+// progress of the collection, see gc.GCWithProgress.
+func GarbageCollectWithProgress(n *core.IpfsNode, ctx context.Context) (<-chan gc.Result, error) {
+	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return nil, err
+	}
+	return gc.GCWithProgress(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots), nil
+}
+
+// minWatermarkGCInterval is the minimum time between two garbage collections
+// triggered by the storage usage going over the watermark.
+const minWatermarkGCInterval = time.Minute
+
+// PeriodicGC collects garbage automatically until ctx is done: every
+// GCPeriod and whenever the storage usage goes over the watermark, if the repo
+// is over the watermark, and at the times of the GCPolicy schedule or when the
+// disk runs out of free space, unconditionally. Collections triggered during
+// the quiet hours are deferred to their end, unless the repo is over
+// StorageMax.
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 	cfg, err := node.Repo.Config()
 	if err != nil {
@@ -171,7 +229,13 @@ func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 	if err != nil {
 		return err
 	}
-	if int64(period) == 0 {
+
+	policy, err := LoadGCPolicy(node.Repo)
+	if err != nil {
+		return err
+	}
+
+	if int64(period) == 0 && len(policy.Schedule) == 0 && policy.MinFreeSpace == 0 {
 		// if duration is 0, it means GC is disabled.
 		return nil
 	}
@@ -181,15 +245,101 @@ func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 		return err
 	}
 
+	var periodic <-chan time.Time
+	if int64(period) != 0 {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		periodic = ticker.C
+	}
+
+	// Going over the watermark triggers a GC right away, without waiting for
+	// the next period, unless one just ran.
+	var lastGC time.Time
+	var highWater <-chan struct{}
+	if int64(period) != 0 && node.StorageQuota != nil {
+		highWater = node.StorageQuota.HighWater()
+	}
+
+	var scheduled <-chan time.Time
+	nextScheduled := func() {
+		if next := policy.NextScheduled(time.Now()); !next.IsZero() {
+			scheduled = time.After(time.Until(next))
+		}
+	}
+	nextScheduled()
+
+	var freeSpaceCheck <-chan time.Time
+	var repoPath string
+	var lowSpace bool
+	if policy.MinFreeSpace != 0 {
+		if pr, ok := node.Repo.(interface{ Path() string }); ok {
+			repoPath = pr.Path()
+			ticker := time.NewTicker(freeSpaceCheckInterval)
+			defer ticker.Stop()
+			freeSpaceCheck = ticker.C
+		} else {
+			log.Warning("Datastore.GCMinFreeSpace is ignored: the repo is not on disk")
+		}
+	}
+
+	// The collection deferred by the quiet hours, if any. It is forced if
+	// one of the deferred triggers was unconditional.
+	var quietOver <-chan time.Time
+	var deferred, deferredForce bool
+
+	collect := func(reason string, force bool) {
+		if time.Since(lastGC) < minWatermarkGCInterval {
+			return
+		}
+		if now := time.Now(); policy.Quiet(now) && !gc.overStorageMax() {
+			if !deferred {
+				log.Infof("%s, deferring repo GC to the end of the quiet hours", reason)
+				quietOver = time.After(time.Until(policy.endOfQuiet(now)))
+			}
+			deferred = true
+			deferredForce = deferredForce || force
+			return
+		}
+		log.Info(reason)
+		lastGC = time.Now()
+		if err := gc.collect(ctx, force); err != nil {
+			log.Error(err)
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case <-time.After(period):
+		case <-highWater:
+			collect("storage usage went over the watermark", false)
+		case <-periodic:
 			// the private func maybeGC doesn't compute storageMax, storageGC, slackGC so that they are not re-computed for every cycle
-			if err := gc.maybeGC(ctx, 0); err != nil {
-				log.Error(err)
+			collect("periodic repo GC", false)
+		case <-scheduled:
+			nextScheduled()
+			collect("scheduled repo GC", true)
+		case <-freeSpaceCheck:
+			free, err := freeSpace(repoPath)
+			if err != nil {
+				log.Errorf("checking free disk space: %s", err)
+				continue
 			}
+			if free >= policy.MinFreeSpace {
+				lowSpace = false
+				continue
+			}
+			// collect once each time the free space drops below the
+			// goal, the remaining blocks may be all pinned
+			if !lowSpace {
+				lowSpace = true
+				collect(fmt.Sprintf("free disk space %s is below Datastore.GCMinFreeSpace", humanize.Bytes(free)), true)
+			}
+		case <-quietOver:
+			quietOver = nil
+			force := deferredForce
+			deferred, deferredForce = false, false
+			collect("end of the quiet hours", force)
 		}
 	}
 }
@@ -202,6 +352,33 @@ func ConditionalGC(ctx context.Context, node *core.IpfsNode, offset uint64) erro
 	return gc.maybeGC(ctx, offset)
 }
 
+// collect collects garbage if the repo is over the watermark, or
+// unconditionally if force is set.
+func (gc *GC) collect(ctx context.Context, force bool) error {
+	if !force {
+		return gc.maybeGC(ctx, 0)
+	}
+
+	log.Info("Starting repo GC...")
+	defer log.EventBegin(ctx, "repoGC").Done()
+
+	if err := GarbageCollect(gc.Node, ctx); err != nil {
+		return err
+	}
+	log.Infof("Repo GC done. See `ipfs repo stat` to see how much space got freed.\n")
+	return nil
+}
+
+// overStorageMax returns whether the repo is over StorageMax.
+func (gc *GC) overStorageMax() bool {
+	storage, err := gc.Repo.GetStorageUsage()
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	return storage > gc.StorageMax
+}
+
 func (gc *GC) maybeGC(ctx context.Context, offset uint64) error {
 	storage, err := gc.Repo.GetStorageUsage()
 	if err != nil {
@@ -0,0 +1,160 @@
+package corerepo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+	sysi "gx/ipfs/QmZRjKbHa6DenStpQJFiaPcEwkZqrx7TH6xTf342LDU3qM/go-sysinfo"
+)
+
+// freeSpaceCheckInterval is the interval at which the free space of the disk
+// holding the repo is checked against Datastore.GCMinFreeSpace.
+const freeSpaceCheckInterval = time.Minute
+
+// GCPolicy holds the optional triggers of the automatic garbage collections,
+// in addition to GCPeriod and StorageGCWatermark.
+type GCPolicy struct {
+	// Schedule holds the times of day at which to collect garbage, as
+	// offsets from midnight in local time.
+	Schedule []time.Duration
+
+	// MinFreeSpace triggers a collection when the free space of the disk
+	// holding the repo drops below it. Zero disables the check.
+	MinFreeSpace uint64
+
+	// QuietStart and QuietEnd bound the quiet hours, as offsets from
+	// midnight in local time. Collections triggered during the quiet hours
+	// are deferred to their end, unless the repo is over StorageMax. The
+	// quiet hours are disabled when both are equal.
+	QuietStart, QuietEnd time.Duration
+}
+
+// LoadGCPolicy reads the policy from the optional Datastore.GCSchedule,
+// Datastore.GCMinFreeSpace and Datastore.GCQuietHours keys of the config.
+func LoadGCPolicy(r repo.Repo) (*GCPolicy, error) {
+	p := new(GCPolicy)
+
+	if val, err := r.GetConfigKey("Datastore.GCSchedule"); err == nil {
+		times, ok := val.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid value for Datastore.GCSchedule: expected a list of times, got %v", val)
+		}
+		for _, t := range times {
+			s, ok := t.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid time in Datastore.GCSchedule: %v", t)
+			}
+			d, err := parseTimeOfDay(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time in Datastore.GCSchedule: %s", err)
+			}
+			p.Schedule = append(p.Schedule, d)
+		}
+	}
+
+	if val, err := r.GetConfigKey("Datastore.GCMinFreeSpace"); err == nil {
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for Datastore.GCMinFreeSpace: expected a size, got %v", val)
+		}
+		if p.MinFreeSpace, err = humanize.ParseBytes(s); err != nil {
+			return nil, fmt.Errorf("invalid value for Datastore.GCMinFreeSpace: %s", err)
+		}
+	}
+
+	if val, err := r.GetConfigKey("Datastore.GCQuietHours"); err == nil {
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for Datastore.GCQuietHours: expected a range of times, got %v", val)
+		}
+		if p.QuietStart, p.QuietEnd, err = parseQuietHours(s); err != nil {
+			return nil, fmt.Errorf("invalid value for Datastore.GCQuietHours: %s", err)
+		}
+	}
+
+	return p, nil
+}
+
+// parseTimeOfDay parses a "HH:MM" time of day into an offset from midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time of day", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseQuietHours parses a "HH:MM-HH:MM" range of times of day. The range
+// may span midnight, e.g. "22:00-06:00".
+func parseQuietHours(s string) (start, end time.Duration, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%q is not a HH:MM-HH:MM range", s)
+	}
+	if start, err = parseTimeOfDay(parts[0]); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseTimeOfDay(parts[1]); err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// sinceMidnight returns the offset of t from the midnight of its day.
+func sinceMidnight(t time.Time) time.Duration {
+	y, m, d := t.Date()
+	return t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+}
+
+// nextAt returns the first time after t at offset from midnight.
+func nextAt(t time.Time, offset time.Duration) time.Time {
+	y, m, d := t.Date()
+	next := time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Add(offset)
+	if !next.After(t) {
+		next = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location()).Add(offset)
+	}
+	return next
+}
+
+// Quiet returns whether t falls in the quiet hours.
+func (p *GCPolicy) Quiet(t time.Time) bool {
+	if p.QuietStart == p.QuietEnd {
+		return false
+	}
+	now := sinceMidnight(t)
+	if p.QuietStart < p.QuietEnd {
+		return now >= p.QuietStart && now < p.QuietEnd
+	}
+	// the quiet hours span midnight
+	return now >= p.QuietStart || now < p.QuietEnd
+}
+
+// endOfQuiet returns the end of the quiet hours following t.
+func (p *GCPolicy) endOfQuiet(t time.Time) time.Time {
+	return nextAt(t, p.QuietEnd)
+}
+
+// NextScheduled returns the first scheduled collection after t, or the zero
+// time if there is no schedule.
+func (p *GCPolicy) NextScheduled(t time.Time) time.Time {
+	var next time.Time
+	for _, offset := range p.Schedule {
+		if at := nextAt(t, offset); next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	return next
+}
+
+// freeSpace returns the free space of the disk holding path.
+func freeSpace(path string) (uint64, error) {
+	info, err := sysi.DiskUsage(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Free, nil
+}
@@ -0,0 +1,73 @@
+package corerepo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCPolicyQuietHours(t *testing.T) {
+	day := time.Date(2018, 10, 1, 0, 0, 0, 0, time.Local)
+	at := func(hour, min int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute)
+	}
+
+	start, end, err := parseQuietHours("22:00-06:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &GCPolicy{QuietStart: start, QuietEnd: end}
+
+	for _, tc := range []struct {
+		t     time.Time
+		quiet bool
+	}{
+		{at(21, 59), false},
+		{at(22, 0), true},
+		{at(3, 0), true},
+		{at(6, 30), false},
+		{at(12, 0), false},
+	} {
+		if p.Quiet(tc.t) != tc.quiet {
+			t.Errorf("expected quiet at %s to be %t", tc.t.Format("15:04"), tc.quiet)
+		}
+	}
+
+	if end := p.endOfQuiet(at(23, 0)); !end.Equal(at(24+6, 30)) {
+		t.Errorf("expected the quiet hours to end the next morning, got %s", end)
+	}
+
+	for _, s := range []string{"22:00", "22:00-25:00", "10pm-6am"} {
+		if _, _, err := parseQuietHours(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+}
+
+func TestGCPolicySchedule(t *testing.T) {
+	day := time.Date(2018, 10, 1, 0, 0, 0, 0, time.Local)
+
+	p := new(GCPolicy)
+	if next := p.NextScheduled(day); !next.IsZero() {
+		t.Fatalf("expected no scheduled collection, got %s", next)
+	}
+
+	for _, s := range []string{"15:00", "03:00"} {
+		d, err := parseTimeOfDay(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Schedule = append(p.Schedule, d)
+	}
+
+	for _, tc := range []struct {
+		now, next time.Duration
+	}{
+		{0, 3 * time.Hour},
+		{3 * time.Hour, 15 * time.Hour},
+		{16 * time.Hour, 27 * time.Hour},
+	} {
+		if next := p.NextScheduled(day.Add(tc.now)); !next.Equal(day.Add(tc.next)) {
+			t.Errorf("expected the collection after %s to be at %s, got %s", day.Add(tc.now), day.Add(tc.next), next)
+		}
+	}
+}
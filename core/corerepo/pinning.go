@@ -19,12 +19,15 @@ import (
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/coreapi/interface"
+	"github.com/ipfs/go-ipfs/core/webhook"
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 )
 
 func Pin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []string, recursive bool) ([]cid.Cid, error) {
 	out := make([]cid.Cid, len(paths))
+	ctx = priority.WithDefault(ctx, priority.Background)
 
 	for i, fpath := range paths {
 		p, err := iface.ParsePath(fpath)
@@ -48,6 +51,15 @@ func Pin(n *core.IpfsNode, api iface.CoreAPI, ctx context.Context, paths []strin
 		return nil, err
 	}
 
+	cids := make([]string, len(out))
+	for i, c := range out {
+		cids[i] = c.String()
+	}
+	n.Webhooks.Notify(webhook.PinCompleted, map[string]interface{}{
+		"Cids":      cids,
+		"Recursive": recursive,
+	})
+
 	return out, nil
 }
 
@@ -118,6 +118,10 @@ func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
 		return nil, err
 	}
 
+	if cc, ok := reader.(chunkCounter); ok {
+		chnk = &countingSplitter{Splitter: chnk, counter: cc}
+	}
+
 	// Make sure all added nodes are written when done.
 	defer adder.bufferedDS.Commit()
 
@@ -618,6 +622,7 @@ type progressReader struct {
 	file         files.File
 	out          chan<- interface{}
 	bytes        int64
+	chunks       int64
 	lastProgress int64
 }
 
@@ -628,14 +633,39 @@ func (i *progressReader) Read(p []byte) (int, error) {
 	if i.bytes-i.lastProgress >= progressReaderIncrement || err == io.EOF {
 		i.lastProgress = i.bytes
 		i.out <- &coreiface.AddEvent{
-			Name:  i.file.FileName(),
-			Bytes: i.bytes,
+			Name:   i.file.FileName(),
+			Bytes:  i.bytes,
+			Chunks: i.chunks,
 		}
 	}
 
 	return n, err
 }
 
+func (i *progressReader) countChunk() {
+	i.chunks++
+}
+
+// chunkCounter is implemented by readers that want to know how many chunks
+// were cut from them.
+type chunkCounter interface {
+	countChunk()
+}
+
+// countingSplitter reports every chunk it produces to a chunkCounter.
+type countingSplitter struct {
+	chunker.Splitter
+	counter chunkCounter
+}
+
+func (s *countingSplitter) NextBytes() ([]byte, error) {
+	b, err := s.Splitter.NextBytes()
+	if err == nil {
+		s.counter.countChunk()
+	}
+	return b, err
+}
+
 type progressReader2 struct {
 	*progressReader
 	files.FileInfo
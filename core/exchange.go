@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	bscompress "github.com/ipfs/go-ipfs/exchange/bscompress"
+	bsstats "github.com/ipfs/go-ipfs/exchange/bsstats"
+	peerfilter "github.com/ipfs/go-ipfs/exchange/peerfilter"
+	priority "github.com/ipfs/go-ipfs/exchange/priority"
+	providequeue "github.com/ipfs/go-ipfs/exchange/providequeue"
+	provider "github.com/ipfs/go-ipfs/exchange/provider"
+	rp "github.com/ipfs/go-ipfs/exchange/reprovide"
+	throttle "github.com/ipfs/go-ipfs/exchange/throttle"
+	wantages "github.com/ipfs/go-ipfs/exchange/wantages"
+
+	exchange "gx/ipfs/QmP2g3VxmC7g7fyRJDj1VJ72KHZbJ9UW24YjSWEj1XTb4H/go-ipfs-exchange-interface"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	bitswap "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap"
+	bsnet "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/network"
+)
+
+// ExchangeConstructor builds the exchange of an online node, fetching blocks
+// into bs and serving the blocks of bs. The host, the routing and the Provider
+// of the node are set up when it's called. params are the options of the
+// Exchange config section.
+type ExchangeConstructor func(ctx context.Context, n *IpfsNode, bs bstore.Blockstore, params map[string]interface{}) (exchange.Interface, error)
+
+// DefaultExchange is the exchange of the nodes without an Exchange.Type.
+const DefaultExchange = "bitswap"
+
+var exchanges = map[string]ExchangeConstructor{
+	DefaultExchange: newBitswap,
+}
+
+// AddExchangeConstructor registers an exchange selected by setting
+// Exchange.Type to name.
+func AddExchangeConstructor(name string, c ExchangeConstructor) error {
+	if _, ok := exchanges[name]; ok {
+		return fmt.Errorf("already have an exchange named %q", name)
+	}
+	exchanges[name] = c
+	return nil
+}
+
+// newExchange builds the exchange selected by the optional Exchange.Type
+// config key.
+func (n *IpfsNode) newExchange(ctx context.Context, bs bstore.Blockstore) (exchange.Interface, error) {
+	var params map[string]interface{}
+	if val, err := n.Repo.GetConfigKey("Exchange"); err == nil && val != nil {
+		var ok bool
+		if params, ok = val.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("invalid value for Exchange: expected an object, got %v", val)
+		}
+	}
+
+	typ := DefaultExchange
+	if val, ok := params["Type"]; ok {
+		if typ, ok = val.(string); !ok {
+			return nil, fmt.Errorf("invalid value for Exchange.Type: expected a string, got %v", val)
+		}
+	}
+
+	construct, ok := exchanges[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown exchange type %q", typ)
+	}
+	return construct(ctx, n, bs, params)
+}
+
+// setupProvider sets up the Provider, the persistent queue announcing the
+// blocks received by the exchange, whichever it is. The blocks given to the
+// exchange are tracked by the ProvideQueue until they are announced, see the
+// blockservice of the node.
+func (n *IpfsNode) setupProvider(ctx context.Context) error {
+	n.ProvideQueue = providequeue.New(n.provideFilter.Allows)
+	var err error
+	n.Provider, err = provider.New(ctx, n.Repo.Datastore(), providequeue.WrapRouting(n.announcer, n.ProvideQueue))
+	if err != nil {
+		return err
+	}
+	queued, err := n.Provider.Queued()
+	if err != nil {
+		return err
+	}
+	for _, e := range queued {
+		n.ProvideQueue.Restore(e.Cid, e.Since)
+	}
+
+	n.provides = n.Provider
+	if n.provideFilter != nil {
+		n.provides = rp.NewFilteredRouting(n.provides, n.provideFilter)
+	}
+	if n.Repos != nil && n.Repos.blocks != nil {
+		n.provides = n.Repos.blocks.filterProvides(n.provides)
+	}
+	return nil
+}
+
+// newBitswap builds the bitswap exchange, set up by the Bitswap config
+// section.
+func newBitswap(ctx context.Context, n *IpfsNode, bs bstore.Blockstore, params map[string]interface{}) (exchange.Interface, error) {
+	host := n.PeerHost
+	limits, err := bitswapLimits(n.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if limits != (throttle.Limits{}) {
+		// throttle the compressed streams, to limit what goes on the wire
+		host = throttle.Wrap(host, limits)
+	}
+	compress, err := configBool(n.Repo, "Bitswap.Compression")
+	if err != nil {
+		return nil, err
+	}
+	if compress {
+		host = bscompress.Wrap(host)
+	}
+
+	n.BitswapStats = bsstats.Wrap(bsnet.NewFromIpfsHost(host, n.provides))
+	peerFilter, err := bitswapPeerFilter(n.Repo)
+	if err != nil {
+		return nil, err
+	}
+	var network bsnet.BitSwapNetwork = n.BitswapStats
+	if peerFilter != nil {
+		network = peerfilter.Wrap(n.BitswapStats, peerFilter)
+	}
+	// the wants are sent with the priorities of their fetches, recorded by
+	// the exchange of the node, see priority.Wrap
+	n.wantPriorities = priority.NewWants()
+	network = priority.WrapNetwork(network, n.wantPriorities)
+
+	ex := bitswap.New(ctx, network, bs).(*bitswap.Bitswap)
+	n.WantAges = wantages.New(ctx, ex)
+	return ex, nil
+}
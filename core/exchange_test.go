@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	exchange "gx/ipfs/QmP2g3VxmC7g7fyRJDj1VJ72KHZbJ9UW24YjSWEj1XTb4H/go-ipfs-exchange-interface"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	datastore "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	syncds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+// keysRepo is a mock repo with the config keys of keys.
+type keysRepo struct {
+	*repo.Mock
+	keys map[string]interface{}
+}
+
+func (r *keysRepo) GetConfigKey(key string) (interface{}, error) {
+	if val, ok := r.keys[key]; ok {
+		return val, nil
+	}
+	return r.Mock.GetConfigKey(key)
+}
+
+func TestExchangeSelection(t *testing.T) {
+	ctx := context.Background()
+	bs := bstore.NewBlockstore(syncds.MutexWrap(datastore.NewMapDatastore()))
+
+	var built string
+	var gotParams map[string]interface{}
+	constructor := func(name string) ExchangeConstructor {
+		return func(ctx context.Context, n *IpfsNode, bs bstore.Blockstore, params map[string]interface{}) (exchange.Interface, error) {
+			built, gotParams = name, params
+			return offline.Exchange(bs), nil
+		}
+	}
+	defer func(c ExchangeConstructor) { exchanges[DefaultExchange] = c }(exchanges[DefaultExchange])
+	exchanges[DefaultExchange] = constructor(DefaultExchange)
+	if err := AddExchangeConstructor("test", constructor("test")); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(exchanges, "test")
+	if err := AddExchangeConstructor("test", constructor("test")); err == nil {
+		t.Fatal("expected an exchange to be registered only once")
+	}
+
+	newNode := func(cfg interface{}) *IpfsNode {
+		r := &keysRepo{Mock: &repo.Mock{}, keys: make(map[string]interface{})}
+		if cfg != nil {
+			r.keys["Exchange"] = cfg
+		}
+		return &IpfsNode{Repo: r}
+	}
+
+	if _, err := newNode(nil).newExchange(ctx, bs); err != nil || built != DefaultExchange {
+		t.Fatalf("expected the default exchange without a config, got %q: %v", built, err)
+	}
+
+	params := map[string]interface{}{"Type": "test", "Option": true}
+	if _, err := newNode(params).newExchange(ctx, bs); err != nil || built != "test" {
+		t.Fatalf("expected the exchange of Exchange.Type, got %q: %v", built, err)
+	}
+	if gotParams["Option"] != true {
+		t.Fatalf("expected the exchange to get the Exchange section, got %v", gotParams)
+	}
+
+	for _, cfg := range []interface{}{
+		"bitswap",
+		map[string]interface{}{"Type": 1},
+		map[string]interface{}{"Type": "unknown"},
+	} {
+		if _, err := newNode(cfg).newExchange(ctx, bs); err == nil {
+			t.Fatalf("expected the config %v to be refused", cfg)
+		}
+	}
+}
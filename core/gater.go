@@ -0,0 +1,75 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	gater "github.com/ipfs/go-ipfs/core/gater"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	swarm "gx/ipfs/QmQdLXW5JTSsrVb3ZpnpbASRwyM8CcE4XcM5nPbN19dWLr/go-libp2p-swarm"
+	mamask "gx/ipfs/QmSMZwvs3n4GBikZ7hKzT17c3bk65FmyZo2JqtJ16swqCv/multiaddr-filter"
+)
+
+// setupConnGater gates the connections of the swarm with the rules of
+// Swarm.ConnGater: the networks of Allow and Block, and the number of
+// connections with a /24 subnet of MaxConnsPerSubnet.
+func (n *IpfsNode) setupConnGater() error {
+	allow, err := configMasks(n.Repo, "Swarm.ConnGater.Allow")
+	if err != nil {
+		return err
+	}
+	block, err := configMasks(n.Repo, "Swarm.ConnGater.Block")
+	if err != nil {
+		return err
+	}
+	max, err := configInt(n.Repo, "Swarm.ConnGater.MaxConnsPerSubnet", 0)
+	if err != nil {
+		return err
+	}
+	if max < 0 {
+		return fmt.Errorf("invalid value for Swarm.ConnGater.MaxConnsPerSubnet: expected a positive number, got %d", max)
+	}
+	if len(allow) == 0 && len(block) == 0 && max == 0 {
+		return nil
+	}
+
+	swrm, ok := n.PeerHost.Network().(*swarm.Swarm)
+	if !ok {
+		return errors.New("Swarm.ConnGater needs the network of the host to be a swarm")
+	}
+	if n.WSS != nil && len(allow) > 0 {
+		// the secure websockets are forwarded from the loopback address,
+		// their server checks the addresses they come from
+		allow = append(allow, loopbackNets...)
+	}
+	g := gater.New(swrm.Filters, allow, block, max)
+	if n.WSS != nil {
+		g.SetResolver(n.WSS.RemoteAddr)
+	}
+	swrm.Notify(g.Notifiee())
+	return nil
+}
+
+var loopbackNets = []*net.IPNet{
+	{IP: net.IPv4(127, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv6loopback, Mask: net.CIDRMask(128, 128)},
+}
+
+// configMasks reads the networks of key, in the format of Swarm.AddrFilters
+// (e.g. /ip4/10.0.0.0/ipcidr/8).
+func configMasks(r repo.Repo, key string) ([]*net.IPNet, error) {
+	masks, err := configStrings(r, key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*net.IPNet, len(masks))
+	for i, s := range masks {
+		out[i], err = mamask.NewMask(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %s", key, err)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,242 @@
+// Package gater decides which peers the swarm connects with by their IP
+// address: the addresses allowed or blocked, and the number of connections
+// with a /24 subnet.
+//
+// The rules are applied through the filters of the swarm, which it checks
+// both before dialing and when accepting a connection: the addresses outside
+// of those allowed are filtered, and so is a subnet while it has as many
+// connections as it can. The relayed connections aren't gated. The
+// connections forwarded by a local proxy are counted by the addresses the
+// proxy accepted them from, see SetResolver.
+package gater
+
+import (
+	"net"
+	"sync"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	mafilter "gx/ipfs/QmQJRvWaYAvU3Mdtk33ADXr9JAZwKMBYBGPkRQBDvyj2nn/go-maddr-filter"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("gater")
+
+// subnetMask is the mask of the subnets whose connections are counted.
+var subnetMask = net.CIDRMask(24, 32)
+
+// Gater applies the rules to the filters of a swarm.
+type Gater struct {
+	filters *mafilter.Filters
+	max     int
+
+	lk      sync.Mutex
+	conns   map[string]int
+	full    map[string]*net.IPNet
+	resolve func(ma.Multiaddr) ma.Multiaddr
+	remotes map[inet.Conn]ma.Multiaddr // the addresses counted, by connection
+}
+
+// New applies the rules to filters: the connections are only allowed with
+// the addresses of allow unless it is empty, never with those of block, and
+// with at most max addresses of the same IPv4 /24 subnet unless max is 0.
+func New(filters *mafilter.Filters, allow, block []*net.IPNet, max int) *Gater {
+	if len(allow) > 0 {
+		for _, n := range complement(allow, 32) {
+			filters.AddDialFilter(n)
+		}
+		for _, n := range complement(allow, 128) {
+			filters.AddDialFilter(n)
+		}
+	}
+	for _, n := range block {
+		filters.AddDialFilter(n)
+	}
+	return &Gater{
+		filters: filters,
+		max:     max,
+		conns:   make(map[string]int),
+		full:    make(map[string]*net.IPNet),
+		remotes: make(map[inet.Conn]ma.Multiaddr),
+	}
+}
+
+// SetResolver makes the connections counted by the addresses resolve returns
+// for their remote addresses, such as the addresses the connections forwarded
+// by a local proxy come from.
+func (g *Gater) SetResolver(resolve func(ma.Multiaddr) ma.Multiaddr) {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	g.resolve = resolve
+}
+
+// remoteAddr returns the address c is counted by, which is remembered until
+// it's forgotten, as the resolver may not know it anymore once c is closed.
+func (g *Gater) remoteAddr(c inet.Conn) ma.Multiaddr {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	a := c.RemoteMultiaddr()
+	if g.resolve != nil {
+		a = g.resolve(a)
+	}
+	g.remotes[c] = a
+	return a
+}
+
+// forget returns the address c was counted by, and forgets it.
+func (g *Gater) forget(c inet.Conn) ma.Multiaddr {
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	a, ok := g.remotes[c]
+	if !ok {
+		return c.RemoteMultiaddr()
+	}
+	delete(g.remotes, c)
+	return a
+}
+
+// Notifiee returns the notifiee counting the connections of the network.
+func (g *Gater) Notifiee() inet.Notifiee {
+	return &inet.NotifyBundle{
+		ConnectedF: func(_ inet.Network, c inet.Conn) {
+			a := g.remoteAddr(c)
+			if !g.connected(a) {
+				log.Debugf("closing the connection with %s, its subnet has too many connections", a)
+				go c.Close()
+			}
+		},
+		DisconnectedF: func(_ inet.Network, c inet.Conn) {
+			g.disconnected(g.forget(c))
+		},
+	}
+}
+
+// connected counts a connection with a, and tells whether it stays within
+// the limit of its subnet. The subnet is filtered once at the limit.
+func (g *Gater) connected(a ma.Multiaddr) bool {
+	subnet := subnetOf(a)
+	if g.max <= 0 || subnet == nil {
+		return true
+	}
+
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	key := subnet.String()
+	g.conns[key]++
+	if g.conns[key] >= g.max && g.full[key] == nil && !g.filtered(subnet) {
+		g.filters.AddDialFilter(subnet)
+		g.full[key] = subnet
+	}
+	return g.conns[key] <= g.max
+}
+
+// disconnected stops counting a connection with a, and no longer filters its
+// subnet once under the limit.
+func (g *Gater) disconnected(a ma.Multiaddr) {
+	subnet := subnetOf(a)
+	if g.max <= 0 || subnet == nil {
+		return
+	}
+
+	g.lk.Lock()
+	defer g.lk.Unlock()
+	key := subnet.String()
+	g.conns[key]--
+	if g.conns[key] <= 0 {
+		delete(g.conns, key)
+	}
+	if n := g.full[key]; n != nil && g.conns[key] < g.max {
+		g.filters.Remove(n)
+		delete(g.full, key)
+	}
+}
+
+// filtered tells whether the filters already have n, which mustn't be
+// removed with the limit.
+func (g *Gater) filtered(n *net.IPNet) bool {
+	for _, f := range g.filters.Filters() {
+		if f.String() == n.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// subnetOf returns the /24 subnet of the IPv4 address a, nil for the other
+// addresses.
+func subnetOf(a ma.Multiaddr) *net.IPNet {
+	protos := a.Protocols()
+	if len(protos) == 0 || protos[0].Code != ma.P_IP4 {
+		return nil
+	}
+	s, err := a.ValueForProtocol(ma.P_IP4)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return nil
+	}
+	return &net.IPNet{IP: ip.Mask(subnetMask), Mask: subnetMask}
+}
+
+// complement returns the networks of bits long addresses which are outside
+// of those of nets. The IPv4-mapped IPv6 addresses are left out, as the net
+// package would match the IPv4 addresses with them.
+func complement(nets []*net.IPNet, bits int) []*net.IPNet {
+	var in []*net.IPNet
+	for _, a := range nets {
+		ones, abits := a.Mask.Size()
+		if abits != bits {
+			continue
+		}
+		ip := a.IP.To16()
+		if bits == 32 {
+			ip = a.IP.To4()
+		}
+		if ip != nil {
+			in = append(in, &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, bits)})
+		}
+	}
+	if bits == 128 {
+		in = append(in, &net.IPNet{IP: net.IPv4zero.To16(), Mask: net.CIDRMask(96, 128)})
+	}
+
+	var out []*net.IPNet
+	var walk func(ip net.IP, ones int)
+	walk = func(ip net.IP, ones int) {
+		overlaps := false
+		for _, a := range in {
+			aones, _ := a.Mask.Size()
+			if aones <= ones && samePrefix(a.IP, ip, aones) {
+				return // all in a
+			}
+			if aones > ones && samePrefix(a.IP, ip, ones) {
+				overlaps = true
+			}
+		}
+		if !overlaps {
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, bits)})
+			return
+		}
+
+		hi := make(net.IP, len(ip))
+		copy(hi, ip)
+		hi[ones/8] |= 0x80 >> uint(ones%8)
+		walk(ip, ones+1)
+		walk(hi, ones+1)
+	}
+	walk(make(net.IP, bits/8), 0)
+	return out
+}
+
+// samePrefix tells whether the first ones bits of a and b are the same.
+func samePrefix(a, b net.IP, ones int) bool {
+	for i := 0; i < ones; i++ {
+		m := byte(0x80 >> uint(i%8))
+		if a[i/8]&m != b[i/8]&m {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package gater
+
+import (
+	"net"
+	"testing"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	mafilter "gx/ipfs/QmQJRvWaYAvU3Mdtk33ADXr9JAZwKMBYBGPkRQBDvyj2nn/go-maddr-filter"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+)
+
+func cidr(t *testing.T, s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func addr(t *testing.T, s string) ma.Multiaddr {
+	a, err := ma.NewMultiaddr(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAllowBlock(t *testing.T) {
+	filters := mafilter.NewFilters()
+	allow := []*net.IPNet{cidr(t, "10.0.0.0/8"), cidr(t, "192.168.1.0/24"), cidr(t, "2001:db8::/32")}
+	block := []*net.IPNet{cidr(t, "10.1.0.0/16")}
+	New(filters, allow, block, 0)
+
+	for s, blocked := range map[string]bool{
+		"/ip4/10.2.3.4/tcp/4001":     false,
+		"/ip4/192.168.1.7/tcp/4001":  false,
+		"/ip6/2001:db8::1/tcp/4001":  false,
+		"/ip4/10.1.2.3/tcp/4001":     true,
+		"/ip4/192.168.2.1/tcp/4001":  true,
+		"/ip4/8.8.8.8/udp/4001/quic": true,
+		"/ip6/2001:db9::1/tcp/4001":  true,
+	} {
+		if filters.AddrBlocked(addr(t, s)) != blocked {
+			t.Errorf("expected %s to be blocked: %t", s, blocked)
+		}
+	}
+}
+
+func TestMaxConnsPerSubnet(t *testing.T) {
+	filters := mafilter.NewFilters()
+	g := New(filters, nil, nil, 2)
+
+	a := addr(t, "/ip4/1.2.3.4/tcp/4001")
+	b := addr(t, "/ip4/1.2.3.5/tcp/4001")
+	c := addr(t, "/ip4/1.2.3.6/tcp/4001")
+	other := addr(t, "/ip4/1.2.4.1/tcp/4001")
+
+	if !g.connected(a) {
+		t.Fatal("expected the first connection to be allowed")
+	}
+	if filters.AddrBlocked(c) {
+		t.Fatal("expected the subnet not to be filtered under the limit")
+	}
+	if !g.connected(b) {
+		t.Fatal("expected the second connection to be allowed")
+	}
+	if !filters.AddrBlocked(c) {
+		t.Fatal("expected the subnet to be filtered at the limit")
+	}
+	if filters.AddrBlocked(other) {
+		t.Fatal("expected the other subnets not to be filtered")
+	}
+	// one dialed before the subnet was filtered
+	if g.connected(c) {
+		t.Fatal("expected the connection over the limit to be refused")
+	}
+
+	g.disconnected(c)
+	if !filters.AddrBlocked(c) {
+		t.Fatal("expected the subnet to stay filtered at the limit")
+	}
+	g.disconnected(b)
+	if filters.AddrBlocked(c) {
+		t.Fatal("expected the subnet not to be filtered once under the limit")
+	}
+}
+
+// fakeConn is a connection with a remote address.
+type fakeConn struct {
+	inet.Conn
+	remote ma.Multiaddr
+}
+
+func (c *fakeConn) RemoteMultiaddr() ma.Multiaddr { return c.remote }
+
+func TestResolver(t *testing.T) {
+	filters := mafilter.NewFilters()
+	g := New(filters, nil, nil, 1)
+
+	// the connections forwarded by a local proxy
+	forwarded := map[string]ma.Multiaddr{
+		"/ip4/127.0.0.1/tcp/5001/ws": addr(t, "/ip4/1.2.3.4/tcp/4001/wss"),
+		"/ip4/127.0.0.1/tcp/5002/ws": addr(t, "/ip4/1.2.4.4/tcp/4001/wss"),
+	}
+	g.SetResolver(func(a ma.Multiaddr) ma.Multiaddr {
+		if r, ok := forwarded[a.String()]; ok {
+			return r
+		}
+		return a
+	})
+
+	n := g.Notifiee()
+	a := &fakeConn{remote: addr(t, "/ip4/127.0.0.1/tcp/5001/ws")}
+	b := &fakeConn{remote: addr(t, "/ip4/127.0.0.1/tcp/5002/ws")}
+	n.Connected(nil, a)
+	n.Connected(nil, b)
+	if !filters.AddrBlocked(addr(t, "/ip4/1.2.3.5/tcp/4001")) || !filters.AddrBlocked(addr(t, "/ip4/1.2.4.5/tcp/4001")) {
+		t.Fatal("expected the subnets the connections come from to be counted")
+	}
+	if filters.AddrBlocked(addr(t, "/ip4/127.0.0.1/tcp/4001")) {
+		t.Fatal("expected the address of the proxy not to be counted")
+	}
+
+	// the proxy forgets the connections once closed
+	delete(forwarded, a.remote.String())
+	n.Disconnected(nil, a)
+	if filters.AddrBlocked(addr(t, "/ip4/1.2.3.5/tcp/4001")) {
+		t.Fatal("expected the connection to be uncounted from the subnet it came from")
+	}
+}
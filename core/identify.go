@@ -0,0 +1,38 @@
+package core
+
+import (
+	"fmt"
+
+	peermeta "github.com/ipfs/go-ipfs/core/peermeta"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	identify "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/protocol/identify"
+)
+
+// setUserAgent sets the agent version identify announces to Swarm.UserAgent,
+// or to defaultUserAgent if it isn't set.
+func setUserAgent(r repo.Repo) error {
+	ua, err := configString(r, "Swarm.UserAgent")
+	if err != nil {
+		return err
+	}
+	if ua == "" {
+		ua = defaultUserAgent
+	}
+	identify.ClientVersion = ua
+	return nil
+}
+
+// setupPeerMeta serves the metadata of Swarm.Metadata, and fetches that of
+// the peers.
+func (n *IpfsNode) setupPeerMeta() error {
+	meta, err := configStringMap(n.Repo, "Swarm.Metadata")
+	if err != nil {
+		return err
+	}
+	n.PeerMeta, err = peermeta.New(n.PeerHost, meta)
+	if err != nil {
+		return fmt.Errorf("invalid value for Swarm.Metadata: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	manet "gx/ipfs/QmQVUtnrNGtCRkCMpXgpApfzQjc8FDaDVxHqWH8cnZQeh5/go-multiaddr-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+)
+
+// swarmListen keeps track of the addresses of Addresses.Swarm the node
+// listens on, so that they can change while it runs.
+//
+// The swarm can't close a single listener: the addresses removed stop being
+// announced and the connections accepted on them are closed, but they stay
+// bound until the node restarts.
+type swarmListen struct {
+	quic bool
+
+	// setLk serializes the changes of the addresses, made without holding lk
+	// while the swarm starts listening
+	setLk sync.Mutex
+
+	lk     sync.Mutex
+	active []ma.Multiaddr
+	closed []ma.Multiaddr
+}
+
+// isClosed tells whether a is an address of a listener removed, or
+// connections accepted by one.
+func (l *swarmListen) isClosed(a ma.Multiaddr) bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	for _, c := range l.closed {
+		if listenedBy(c, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// listenedBy tells whether the local address a belongs to the listener of
+// listen: the same transport and port, on the same IP address unless listen
+// is on all the interfaces.
+func listenedBy(listen, a ma.Multiaddr) bool {
+	lparts := ma.Split(listen)
+	aparts := ma.Split(a)
+	if len(lparts) != len(aparts) || len(lparts) < 2 {
+		return false
+	}
+	if !ma.Join(lparts[1:]...).Equal(ma.Join(aparts[1:]...)) {
+		return false
+	}
+	if lparts[0].Equal(aparts[0]) {
+		return true
+	}
+	return manet.IsIPUnspecified(lparts[0]) && lparts[0].Protocols()[0].Code == aparts[0].Protocols()[0].Code
+}
+
+// listenSwarm starts listening on the addresses of Addresses.Swarm, and
+// registers them to be reloaded.
+func (n *IpfsNode) listenSwarm(listenQUIC bool) error {
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+	addrs, err := listenAddresses(cfg)
+	if err != nil {
+		return err
+	}
+
+	n.swarmListen.quic = listenQUIC
+	if err := n.SetListenAddrs(addrs); err != nil {
+		// as long as the node listens somewhere, such as without IPv6
+		if len(n.ListenAddrs()) == 0 {
+			return err
+		}
+		log.Warning(err)
+	}
+
+	// list out our addresses
+	ifaceAddrs, err := n.PeerHost.Network().InterfaceListenAddresses()
+	if err != nil {
+		return err
+	}
+	log.Infof("Swarm listening at: %s", ifaceAddrs)
+
+	n.PeerHost.Network().Notify(&inet.NotifyBundle{
+		ConnectedF: n.closeRemovedListenerConn,
+	})
+	n.OnConfigReload("Addresses.Swarm", n.reloadListenAddrs)
+	return nil
+}
+
+// SetListenAddrs makes the node listen on addrs, and on the QUIC addresses
+// derived from them unless QUIC is disabled, instead of the addresses it
+// listens on. The connections established are kept, but the addresses
+// removed are no longer announced nor accept connections.
+func (n *IpfsNode) SetListenAddrs(addrs []ma.Multiaddr) error {
+	if n.parent != nil {
+		return n.parent.SetListenAddrs(addrs)
+	}
+	if n.swarmListen == nil {
+		return errors.New("the node isn't online")
+	}
+
+	l := n.swarmListen
+	l.setLk.Lock()
+	defer l.setLk.Unlock()
+
+	if l.quic {
+		var err error
+		addrs, err = withQUICAddrs(addrs)
+		if err != nil {
+			return err
+		}
+	}
+
+	l.lk.Lock()
+	current := append([]ma.Multiaddr(nil), l.active...)
+	closed := append([]ma.Multiaddr(nil), l.closed...)
+	l.lk.Unlock()
+
+	var active, failed []ma.Multiaddr
+	var errs []string
+	for _, a := range addrs {
+		switch {
+		case containsAddr(current, a):
+		case containsAddr(closed, a):
+			// still bound, it only needs to accept connections again
+			closed = removeAddr(closed, a)
+		default:
+			if err := n.PeerHost.Network().Listen(a); err != nil {
+				failed = append(failed, a)
+				errs = append(errs, err.Error())
+				continue
+			}
+		}
+		active = append(active, a)
+	}
+	for _, a := range current {
+		if !containsAddr(active, a) {
+			closed = append(closed, a)
+		}
+	}
+
+	l.lk.Lock()
+	l.active = active
+	l.closed = closed
+	l.lk.Unlock()
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to listen on %s: %s", failed, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ListenAddrs returns the addresses of Addresses.Swarm the node listens on.
+func (n *IpfsNode) ListenAddrs() []ma.Multiaddr {
+	if n.parent != nil {
+		return n.parent.ListenAddrs()
+	}
+	if n.swarmListen == nil {
+		return nil
+	}
+	n.swarmListen.lk.Lock()
+	defer n.swarmListen.lk.Unlock()
+	return append([]ma.Multiaddr(nil), n.swarmListen.active...)
+}
+
+// reloadListenAddrs applies Addresses.Swarm to the running swarm.
+func (n *IpfsNode) reloadListenAddrs(r repo.Repo) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	addrs, err := listenAddresses(cfg)
+	if err != nil {
+		return err
+	}
+	return n.SetListenAddrs(addrs)
+}
+
+// closeRemovedListenerConn closes the connections accepted on the addresses
+// removed from Addresses.Swarm.
+func (n *IpfsNode) closeRemovedListenerConn(_ inet.Network, c inet.Conn) {
+	if c.Stat().Direction != inet.DirInbound || !n.swarmListen.isClosed(c.LocalMultiaddr()) {
+		return
+	}
+	log.Debugf("closing the connection of %s accepted on the removed address %s", c.RemotePeer(), c.LocalMultiaddr())
+	go c.Close()
+}
+
+// withoutRemovedListenAddrs drops the addresses of the listeners removed from
+// those of the host.
+func (n *IpfsNode) withoutRemovedListenAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if !n.swarmListen.isClosed(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func containsAddr(addrs []ma.Multiaddr, a ma.Multiaddr) bool {
+	for _, b := range addrs {
+		if b.Equal(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeAddr(addrs []ma.Multiaddr, a ma.Multiaddr) []ma.Multiaddr {
+	out := addrs[:0]
+	for _, b := range addrs {
+		if !b.Equal(a) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
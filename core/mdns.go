@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	discovery "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/discovery"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+// ErrNotOnline is returned when the mDNS service of an offline node is
+// started or stopped.
+var ErrNotOnline = errors.New("mdns: the node isn't online")
+
+// mdnsServiceTag reads the optional Discovery.MDNS.ServiceTag config key, the
+// tag of the mDNS service the peers of the local network announce, which only
+// the nodes using the same tag find.
+func mdnsServiceTag(r repo.Repo) (string, error) {
+	val, err := r.GetConfigKey("Discovery.MDNS.ServiceTag")
+	if err != nil || val == nil {
+		return discovery.ServiceTag, nil // not set
+	}
+	tag, ok := val.(string)
+	if !ok || tag == "" {
+		return "", fmt.Errorf("invalid value for Discovery.MDNS.ServiceTag: expected a non-empty string, got %v", val)
+	}
+	return tag, nil
+}
+
+// mdnsOption returns the discovery option starting the mDNS service as cfg
+// and tag tell, enabled or not.
+func mdnsOption(cfg config.MDNS, tag string) DiscoveryOption {
+	return func(ctx context.Context, h p2phost.Host) (discovery.Service, error) {
+		interval := cfg.Interval
+		if interval == 0 {
+			interval = 5
+		}
+		return discovery.NewMdnsService(ctx, h, time.Duration(interval)*time.Second, tag)
+	}
+}
+
+// restartDiscovery stops the mDNS service, and starts it again as cfg and
+// tag tell if enabled is set. n.discoveryLk must be held.
+func (n *IpfsNode) restartDiscovery(cfg config.MDNS, tag string, enabled bool) error {
+	if n.Discovery != nil {
+		if err := n.Discovery.Close(); err != nil {
+			log.Warning("error closing mdns service: ", err)
+		}
+		n.Discovery = nil
+	}
+	if !enabled {
+		return nil
+	}
+
+	service, err := mdnsOption(cfg, tag)(n.ctx, n.PeerHost)
+	if err != nil {
+		return err
+	}
+	service.RegisterNotifee(n)
+	n.Discovery = service
+	return nil
+}
+
+// SetMDNS starts or stops the mDNS service at runtime, with the interval and
+// the service tag of the config. The config is left as is, so its next change
+// of Discovery.MDNS decides again.
+func (n *IpfsNode) SetMDNS(enabled bool) error {
+	if n.PeerHost == nil {
+		return ErrNotOnline
+	}
+	if n.parent != nil {
+		// the nodes of named repos use the network services of their parent
+		return n.parent.SetMDNS(enabled)
+	}
+	n.discoveryLk.Lock()
+	defer n.discoveryLk.Unlock()
+
+	if enabled == (n.Discovery != nil) {
+		return nil
+	}
+	return n.restartDiscovery(n.discoveryCfg, n.discoveryTag, enabled)
+}
+
+// MDNSEnabled returns true if the mDNS service is running.
+func (n *IpfsNode) MDNSEnabled() bool {
+	if n.parent != nil {
+		return n.parent.MDNSEnabled()
+	}
+	n.discoveryLk.Lock()
+	defer n.discoveryLk.Unlock()
+	return n.Discovery != nil
+}
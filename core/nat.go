@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	p2pbhost "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/host/basic"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+)
+
+// ErrNATPortMapDisabled is returned when the port mappings of a node without
+// NAT port mapping are changed.
+var ErrNATPortMapDisabled = errors.New("NAT port mapping is disabled, unset Swarm.DisableNatPortMap to enable it")
+
+// natPortMap keeps the NAT manager of the host, which maps the ports the
+// node listens on with UPnP or NAT-PMP, to report its mappings.
+type natPortMap struct {
+	mgr p2pbhost.NATManager
+
+	lk        sync.Mutex
+	remaps    int
+	lastRemap time.Time
+}
+
+// newNATManager is the NAT manager constructor of the host.
+func (n *IpfsNode) newNATManager(net inet.Network) p2pbhost.NATManager {
+	mgr := p2pbhost.NewNATManager(net)
+	n.natPortMap = &natPortMap{mgr: mgr}
+	return mgr
+}
+
+// NATState is the state of the NAT port mapping of a node.
+type NATState struct {
+	// Enabled is unset if Swarm.DisableNatPortMap is set
+	Enabled bool
+
+	// Discovering is set until the discovery of the NAT device is over, and
+	// Found tells whether it found a device answering UPnP or NAT-PMP then
+	Discovering bool
+	Found       bool
+
+	Mappings []NATMapping
+
+	// Remaps is the number of times the mappings were forced again, last at
+	// LastRemap
+	Remaps    int
+	LastRemap time.Time
+}
+
+// NATMapping is the mapping of a port listened on to an external port.
+type NATMapping struct {
+	Protocol     string
+	InternalAddr ma.Multiaddr
+	InternalPort int
+
+	// ExternalPort is the port mapped, 0 until the mapping succeeds
+	ExternalPort int
+	ExternalAddr ma.Multiaddr
+
+	// Error is why the external address isn't known
+	Error string
+}
+
+// NATStatus returns the state of the NAT port mapping of the node.
+func (n *IpfsNode) NATStatus() NATState {
+	if n.parent != nil {
+		return n.parent.NATStatus()
+	}
+	p := n.natPortMap
+	if p == nil {
+		return NATState{}
+	}
+
+	st := NATState{Enabled: true}
+	select {
+	case <-p.mgr.Ready():
+	default:
+		st.Discovering = true
+	}
+	p.lk.Lock()
+	st.Remaps = p.remaps
+	st.LastRemap = p.lastRemap
+	p.lk.Unlock()
+
+	nat := p.mgr.NAT()
+	if nat == nil {
+		return st
+	}
+	st.Found = true
+	for _, m := range nat.Mappings() {
+		nm := NATMapping{
+			Protocol:     m.Protocol(),
+			InternalAddr: m.InternalAddr(),
+			InternalPort: m.InternalPort(),
+			ExternalPort: m.ExternalPort(),
+		}
+		if ext, err := m.ExternalAddr(); err != nil {
+			nm.Error = err.Error()
+		} else {
+			nm.ExternalAddr = ext
+		}
+		st.Mappings = append(st.Mappings, nm)
+	}
+	return st
+}
+
+// RemapNAT removes the port mappings of the node from the NAT device and maps
+// the ports again, such as after the device restarted and lost them.
+func (n *IpfsNode) RemapNAT() error {
+	if n.parent != nil {
+		return n.parent.RemapNAT()
+	}
+	p := n.natPortMap
+	if p == nil {
+		return ErrNATPortMapDisabled
+	}
+	nat := p.mgr.NAT()
+	if nat == nil {
+		select {
+		case <-p.mgr.Ready():
+			return errors.New("no NAT device answering UPnP or NAT-PMP was found")
+		default:
+			return errors.New("the NAT device is still being discovered")
+		}
+	}
+
+	p.lk.Lock()
+	p.remaps++
+	p.lastRemap = time.Now()
+	p.lk.Unlock()
+
+	var errs []string
+	for _, m := range nat.Mappings() {
+		addr := m.InternalAddr()
+		if err := m.Close(); err != nil {
+			log.Debugf("removing the port mapping of %s: %s", addr, err)
+		}
+		if _, err := nat.NewMapping(addr); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", addr, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to map %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
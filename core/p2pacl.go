@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	p2p "github.com/ipfs/go-ipfs/p2p"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+)
+
+// p2pACLKey is the config key of the ACLs of the p2p listeners, an object of
+// the ACLs by protocol. It isn't part of the config struct, and the keys of
+// the object are protocol names, which can't be set one by one as they
+// contain dots.
+const p2pACLKey = "P2P.ACL"
+
+// setupP2PACL applies P2P.ACL to the p2p listeners.
+func (n *IpfsNode) setupP2PACL() error {
+	if err := n.reloadP2PACL(n.Repo); err != nil {
+		return err
+	}
+	n.OnConfigReload(p2pACLKey, n.reloadP2PACL)
+	return nil
+}
+
+func (n *IpfsNode) reloadP2PACL(r repo.Repo) error {
+	acls, err := configP2PACL(r)
+	if err != nil {
+		return err
+	}
+	n.P2P.SetACLs(acls)
+	return nil
+}
+
+// SetP2PACL restricts the p2p listeners of proto with acl, or lifts their
+// restrictions if acl is nil, and saves the ACLs in the config.
+func (n *IpfsNode) SetP2PACL(proto protocol.ID, acl *p2p.ACL) error {
+	if n.parent != nil {
+		return n.parent.SetP2PACL(proto, acl)
+	}
+	if n.P2P == nil {
+		return errors.New("the node isn't online")
+	}
+
+	acls, err := configP2PACL(n.Repo)
+	if err != nil {
+		return err
+	}
+	if acl != nil {
+		acls[proto] = *acl
+	} else {
+		delete(acls, proto)
+	}
+	if err := n.Repo.SetConfigKey(p2pACLKey, encodeP2PACL(acls)); err != nil {
+		return err
+	}
+
+	if acl != nil {
+		n.P2P.SetACL(proto, *acl)
+	} else {
+		n.P2P.RemoveACL(proto)
+	}
+	return nil
+}
+
+// configP2PACL reads the ACLs of P2P.ACL, e.g.
+// {"/x/ssh": {"Peers": ["Qm..."], "Ports": [22]}}.
+func configP2PACL(r repo.Repo) (map[protocol.ID]p2p.ACL, error) {
+	acls := make(map[protocol.ID]p2p.ACL)
+	val, err := r.GetConfigKey(p2pACLKey)
+	if err != nil || val == nil {
+		return acls, nil // not set
+	}
+
+	obj, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid value for %s: expected an object, got %v", p2pACLKey, val)
+	}
+	for proto, v := range obj {
+		entry, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s of %s: expected an object, got %v", p2pACLKey, proto, v)
+		}
+
+		var acl p2p.ACL
+		peers, _ := entry["Peers"].([]interface{})
+		for _, v := range peers {
+			s, _ := v.(string)
+			p, err := peer.IDB58Decode(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s of %s: invalid peer %v", p2pACLKey, proto, v)
+			}
+			acl.Peers = append(acl.Peers, p)
+		}
+		ports, _ := entry["Ports"].([]interface{})
+		for _, v := range ports {
+			port, ok := v.(float64)
+			if !ok || port < 1 || port > 65535 || port != float64(int(port)) {
+				return nil, fmt.Errorf("invalid value for %s of %s: invalid port %v", p2pACLKey, proto, v)
+			}
+			acl.Ports = append(acl.Ports, int(port))
+		}
+		acls[protocol.ID(proto)] = acl
+	}
+	return acls, nil
+}
+
+// encodeP2PACL returns acls in the format of P2P.ACL.
+func encodeP2PACL(acls map[protocol.ID]p2p.ACL) map[string]interface{} {
+	out := make(map[string]interface{}, len(acls))
+	for proto, acl := range acls {
+		peers := make([]string, len(acl.Peers))
+		for i, p := range acl.Peers {
+			peers[i] = p.Pretty()
+		}
+		ports := make([]int, len(acl.Ports))
+		copy(ports, acl.Ports)
+		out[string(proto)] = map[string]interface{}{
+			"Peers": peers,
+			"Ports": ports,
+		}
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+// Package peermeta exchanges the metadata of the nodes, the key/value pairs
+// their operators set to tell the nodes of a fleet apart. The identify
+// protocol only carries the agent and protocol versions, so the metadata is
+// served on a protocol of its own, and fetched on demand.
+package peermeta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+var log = logging.Logger("peermeta")
+
+// ProtocolID is the protocol the metadata is served on.
+const ProtocolID = "/ipfs/metadata/1.0.0"
+
+// MaxSize bounds the size of the metadata, encoded in JSON.
+const MaxSize = 4096
+
+// PeerstoreKey is the key the metadata fetched is kept under in the
+// peerstore.
+const PeerstoreKey = "Metadata"
+
+// Timeout bounds the time of the exchanges of the metadata.
+var Timeout = 10 * time.Second
+
+// ErrTooLarge is returned when the metadata exceeds MaxSize.
+var ErrTooLarge = errors.New("peermeta: metadata too large")
+
+// Service serves the metadata of a node, and fetches that of its peers.
+type Service struct {
+	host p2phost.Host
+	meta map[string]string
+	data []byte
+}
+
+// New serves meta on host.
+func New(host p2phost.Host, meta map[string]string) (*Service, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+	s := &Service{host: host, meta: meta, data: data}
+	host.SetStreamHandler(ProtocolID, s.handleStream)
+	return s, nil
+}
+
+// Metadata returns the metadata served.
+func (s *Service) Metadata() map[string]string {
+	return s.meta
+}
+
+// Close stops serving the metadata.
+func (s *Service) Close() error {
+	s.host.RemoveStreamHandler(ProtocolID)
+	return nil
+}
+
+func (s *Service) handleStream(st inet.Stream) {
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(Timeout))
+	if _, err := st.Write(s.data); err != nil {
+		log.Debugf("sending the metadata to %s: %s", st.Conn().RemotePeer().Pretty(), err)
+		st.Reset()
+	}
+}
+
+// Fetch asks p for its metadata, and keeps it in the peerstore.
+func (s *Service) Fetch(ctx context.Context, p peer.ID) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	st, err := s.host.NewStream(ctx, p, ProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		st.SetDeadline(deadline)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(st, MaxSize+1))
+	if err != nil {
+		st.Reset()
+		return nil, err
+	}
+	if len(data) > MaxSize {
+		st.Reset()
+		return nil, ErrTooLarge
+	}
+	var meta map[string]string
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+
+	if err := s.host.Peerstore().Put(p, PeerstoreKey, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,57 @@
+package peermeta
+
+import (
+	"context"
+	"testing"
+
+	mocknet "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/net/mock"
+)
+
+func TestFetch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	if _, err := New(hosts[0], map[string]string{"region": "eu-west", "role": "gateway"}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(hosts[1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := s.Fetch(ctx, hosts[0].ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta) != 2 || meta["region"] != "eu-west" || meta["role"] != "gateway" {
+		t.Fatalf("expected the metadata of the peer, got %v", meta)
+	}
+
+	kept, err := hosts[1].Peerstore().Get(hosts[0].ID(), PeerstoreKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.(map[string]string)["region"] != "eu-west" {
+		t.Fatalf("expected the metadata in the peerstore, got %v", kept)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := make([]byte, MaxSize)
+	if _, err := New(mn.Hosts()[0], map[string]string{"k": string(large)}); err != ErrTooLarge {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
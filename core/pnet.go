@@ -0,0 +1,246 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	pnet "gx/ipfs/QmY4Q5JC4vxLEi8EpVxJM4rcRryEVtH1zRKVTAm6BKV1pg/go-libp2p-pnet"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+)
+
+// ErrNotPrivate is returned when the swarm key of a node not part of a
+// private network is rotated. The key of a new private network must be added
+// to the repo before the node starts.
+var ErrNotPrivate = errors.New("pnet: the node isn't part of a private network")
+
+// pnetNextKey is the key of the rotation of the swarm key pending in the
+// datastore, kept until the cutover so that it survives restarts.
+var pnetNextKey = ds.NewKey("/local/pnet/next")
+
+// swarmKeySetter is implemented by the repos which can replace their swarm
+// key.
+type swarmKeySetter interface {
+	SetSwarmKey(key []byte) error
+}
+
+// protector protects the connections of a private network.
+type protector interface {
+	Protect(net.Conn) (net.Conn, error)
+	Fingerprint() []byte
+}
+
+// pendingRotation is a rotation of the swarm key, as kept in the datastore.
+type pendingRotation struct {
+	Key     []byte
+	Cutover time.Time
+}
+
+// pnetProtector protects the connections with the current swarm key, and
+// switches to the next one at its cutover. The connections already protected
+// keep the key they were established with.
+type pnetProtector struct {
+	n *IpfsNode
+
+	lk      sync.Mutex
+	current protector
+	next    protector
+	pending *pendingRotation
+	timer   *time.Timer
+}
+
+// newPNetProtector returns the protector of the private network of key,
+// which resumes the rotation pending if there is one.
+func (n *IpfsNode) newPNetProtector(key []byte) (*pnetProtector, error) {
+	current, err := pnet.NewProtector(bytes.NewReader(key))
+	if err != nil {
+		return nil, err
+	}
+	p := &pnetProtector{n: n, current: current}
+
+	val, err := n.Repo.Datastore().Get(pnetNextKey)
+	if err == ds.ErrNotFound {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pending pendingRotation
+	if err := json.Unmarshal(val, &pending); err != nil {
+		log.Errorf("discarding the pending rotation of the swarm key: %s", err)
+		return p, nil
+	}
+	if err := p.schedule(&pending); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pnetProtector) Protect(c net.Conn) (net.Conn, error) {
+	p.lk.Lock()
+	current := p.current
+	p.lk.Unlock()
+	return current.Protect(c)
+}
+
+func (p *pnetProtector) Fingerprint() []byte {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.current.Fingerprint()
+}
+
+// schedule replaces the pending rotation with r, applied at its cutover.
+func (p *pnetProtector) schedule(r *pendingRotation) error {
+	next, err := pnet.NewProtector(bytes.NewReader(r.Key))
+	if err != nil {
+		return fmt.Errorf("invalid swarm key: %s", err)
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.next = next
+	p.pending = r
+	p.timer = time.AfterFunc(time.Until(r.Cutover), p.cutover)
+	return nil
+}
+
+// cancel drops the pending rotation.
+func (p *pnetProtector) cancel() {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.next = nil
+	p.pending = nil
+}
+
+// cutover switches to the next swarm key, and replaces the key of the repo
+// with it.
+func (p *pnetProtector) cutover() {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if p.pending == nil {
+		return
+	}
+
+	if setter, ok := p.n.Repo.(swarmKeySetter); ok {
+		if err := setter.SetSwarmKey(p.pending.Key); err != nil {
+			log.Errorf("saving the new swarm key, the node still uses it until it restarts: %s", err)
+		}
+	}
+	if err := p.n.Repo.Datastore().Delete(pnetNextKey); err != nil && err != ds.ErrNotFound {
+		log.Errorf("removing the pending rotation of the swarm key: %s", err)
+	}
+
+	p.current = p.next
+	p.n.PNetFingerprint = p.current.Fingerprint()
+	log.Infof("switched to the swarm key of fingerprint %x", p.n.PNetFingerprint)
+	p.next = nil
+	p.pending = nil
+	p.timer = nil
+}
+
+// Close stops the pending rotation, which resumes when the node starts
+// again.
+func (p *pnetProtector) Close() error {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	return nil
+}
+
+// PNetState is the state of the private network of a node.
+type PNetState struct {
+	// Enabled is set if the node is part of a private network
+	Enabled     bool
+	Fingerprint []byte
+
+	// NextFingerprint is the fingerprint of the swarm key used from Cutover
+	// on, nil unless a rotation is pending
+	NextFingerprint []byte
+	Cutover         time.Time
+}
+
+// PNet returns the state of the private network of the node.
+func (n *IpfsNode) PNet() PNetState {
+	if n.parent != nil {
+		return n.parent.PNet()
+	}
+	p := n.pnet
+	if p == nil {
+		return PNetState{}
+	}
+
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	st := PNetState{
+		Enabled:     true,
+		Fingerprint: p.current.Fingerprint(),
+	}
+	if p.pending != nil {
+		st.NextFingerprint = p.next.Fingerprint()
+		st.Cutover = p.pending.Cutover
+	}
+	return st
+}
+
+// RotateSwarmKey switches the private network of the node to key at cutover,
+// right away if it is past. The connections established until then keep the
+// current key. All the nodes of the network rotate their key at the same
+// time, or those which didn't yet can't connect to those which did.
+//
+// The rotation replaces the one pending, and survives restarts until the
+// cutover, when key replaces the swarm key of the repo.
+func (n *IpfsNode) RotateSwarmKey(key []byte, cutover time.Time) error {
+	if n.parent != nil {
+		return n.parent.RotateSwarmKey(key, cutover)
+	}
+	if n.pnet == nil {
+		return ErrNotPrivate
+	}
+	if _, ok := n.Repo.(swarmKeySetter); !ok {
+		return errors.New("pnet: the repo can't store a new swarm key")
+	}
+
+	if _, err := pnet.NewProtector(bytes.NewReader(key)); err != nil {
+		return fmt.Errorf("invalid swarm key: %s", err)
+	}
+
+	// saved first, as a cutover already past removes it right away
+	r := &pendingRotation{Key: key, Cutover: cutover}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := n.Repo.Datastore().Put(pnetNextKey, b); err != nil {
+		return err
+	}
+	return n.pnet.schedule(r)
+}
+
+// CancelSwarmKeyRotation drops the rotation of the swarm key pending.
+func (n *IpfsNode) CancelSwarmKeyRotation() error {
+	if n.parent != nil {
+		return n.parent.CancelSwarmKeyRotation()
+	}
+	if n.pnet == nil {
+		return ErrNotPrivate
+	}
+	n.pnet.cancel()
+	err := n.Repo.Datastore().Delete(pnetNextKey)
+	if err == ds.ErrNotFound {
+		return nil
+	}
+	return err
+}
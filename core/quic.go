@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+)
+
+// quicEnabled tells whether the node dials and listens with QUIC: unless
+// Swarm.DisableQUIC is set, or the node is part of a private network, whose
+// protector QUIC connections would bypass.
+func quicEnabled(r repo.Repo, cfg *config.Config, private bool) (bool, error) {
+	disabled, err := configBool(r, "Swarm.DisableQUIC")
+	if err != nil {
+		return false, err
+	}
+	if disabled {
+		if cfg.Experimental.QUIC {
+			log.Warning("Experimental.QUIC is set but Swarm.DisableQUIC disables QUIC")
+		}
+		return false, nil
+	}
+	if private {
+		log.Info("QUIC is disabled in private networks")
+		return false, nil
+	}
+	return true, nil
+}
+
+// withQUICAddrs returns listen with, when it has no QUIC address, a QUIC
+// address on the UDP port of the same number for each of its TCP addresses,
+// so that the nodes listen with QUIC on their usual port.
+func withQUICAddrs(listen []ma.Multiaddr) ([]ma.Multiaddr, error) {
+	for _, a := range listen {
+		if _, err := a.ValueForProtocol(ma.P_QUIC); err == nil {
+			return listen, nil
+		}
+	}
+
+	out := append([]ma.Multiaddr(nil), listen...)
+	for _, a := range listen {
+		parts := ma.Split(a)
+		if len(parts) != 2 {
+			continue
+		}
+		if code := parts[0].Protocols()[0].Code; code != ma.P_IP4 && code != ma.P_IP6 {
+			continue
+		}
+		port, err := parts[1].ValueForProtocol(ma.P_TCP)
+		if err != nil {
+			continue
+		}
+		q, err := ma.NewMultiaddr(fmt.Sprintf("%s/udp/%s/quic", parts[0], port))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, q)
+	}
+	return out, nil
+}
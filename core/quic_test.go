@@ -0,0 +1,49 @@
+package core
+
+import (
+	"testing"
+
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+)
+
+func TestWithQUICAddrs(t *testing.T) {
+	addrs := func(ss ...string) []ma.Multiaddr {
+		out := make([]ma.Multiaddr, len(ss))
+		for i, s := range ss {
+			a, err := ma.NewMultiaddr(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[i] = a
+		}
+		return out
+	}
+
+	cases := []struct {
+		listen, expected []ma.Multiaddr
+	}{
+		{
+			listen:   addrs("/ip4/0.0.0.0/tcp/4001", "/ip6/::/tcp/4001", "/ip4/0.0.0.0/tcp/8081/ws"),
+			expected: addrs("/ip4/0.0.0.0/tcp/4001", "/ip6/::/tcp/4001", "/ip4/0.0.0.0/tcp/8081/ws", "/ip4/0.0.0.0/udp/4001/quic", "/ip6/::/udp/4001/quic"),
+		},
+		{
+			// the QUIC addresses listed are left as they are
+			listen:   addrs("/ip4/0.0.0.0/tcp/4001", "/ip4/0.0.0.0/udp/4002/quic"),
+			expected: addrs("/ip4/0.0.0.0/tcp/4001", "/ip4/0.0.0.0/udp/4002/quic"),
+		},
+	}
+	for _, c := range cases {
+		out, err := withQUICAddrs(c.listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(out) != len(c.expected) {
+			t.Fatalf("expected %s, got %s", c.expected, out)
+		}
+		for i := range out {
+			if !out[i].Equal(c.expected[i]) {
+				t.Fatalf("expected %s, got %s", c.expected, out)
+			}
+		}
+	}
+}
@@ -0,0 +1,319 @@
+// Package relaylimit limits the circuits a node relays, as the relays of the
+// version 2 of the circuit relay protocol do. The relay of go-libp2p only
+// speaks the version 1, which relays any circuit as long as it lasts, so its
+// streams are wrapped: a circuit is only relayed to the peers holding a
+// reservation, the number of circuits of each peer is bounded, and the
+// circuits are reset once they last or relay more than the limits.
+//
+// The peers reserve a slot at the relays they announce addresses through
+// with Reserve, see ReserveProtocolID.
+package relaylimit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	circuit "gx/ipfs/QmNcNWuV38HBGYtRUi3okmfXSMEmXWwNgb82N3PzqqsHhY/go-libp2p-circuit"
+	pb "gx/ipfs/QmNcNWuV38HBGYtRUi3okmfXSMEmXWwNgb82N3PzqqsHhY/go-libp2p-circuit/pb"
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	proto "gx/ipfs/QmdxUuburamoF6zF9qjeQC4WYcWGbWuRmdLacMEsW8ioD8/gogo-protobuf/proto"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+var log = logging.Logger("relaylimit")
+
+// maxMessageSize bounds the size of the first message of the circuit
+// streams, the relay request.
+const maxMessageSize = 4096
+
+// Limits are the limits of a relay.
+type Limits struct {
+	// ReservationTTL is the time a reservation lasts unless renewed
+	ReservationTTL time.Duration
+
+	// MaxReservations bounds the number of peers holding a reservation
+	MaxReservations int
+
+	// MaxCircuits bounds the number of circuits relayed from or to a peer
+	MaxCircuits int
+
+	// Duration bounds the time a circuit is relayed
+	Duration time.Duration
+
+	// Data bounds the bytes relayed by a circuit in each direction
+	Data int64
+}
+
+// DefaultLimits are the default limits of the relays of the version 2 of the
+// circuit relay protocol.
+var DefaultLimits = Limits{
+	ReservationTTL:  time.Hour,
+	MaxReservations: 128,
+	MaxCircuits:     16,
+	Duration:        2 * time.Minute,
+	Data:            1 << 17,
+}
+
+// ErrUnsupportedNetwork is returned when the streams of the network of the
+// host can't be wrapped.
+var ErrUnsupportedNetwork = errors.New("relaylimit: the network of the host doesn't expose its stream handler")
+
+var (
+	errNoReservation   = errors.New("relaylimit: the destination holds no reservation")
+	errTooManyCircuits = errors.New("relaylimit: too many circuits")
+	errLimitReached    = errors.New("relaylimit: the circuit reached its limits")
+)
+
+// Relay limits the circuits relayed by a host.
+type Relay struct {
+	host   p2phost.Host
+	limits Limits
+
+	lk           sync.Mutex
+	reservations map[peer.ID]time.Time // by peer, their expiration
+	circuits     map[peer.ID]int
+}
+
+// New limits the circuits relayed by host, whose relay must be enabled with
+// the hop option.
+func New(host p2phost.Host, limits Limits) (*Relay, error) {
+	n, ok := host.Network().(interface {
+		StreamHandler() inet.StreamHandler
+	})
+	if !ok || n.StreamHandler() == nil {
+		return nil, ErrUnsupportedNetwork
+	}
+
+	r := newRelay(host, limits)
+	next := n.StreamHandler()
+	host.Network().SetStreamHandler(func(s inet.Stream) {
+		next(&stream{Stream: s, r: r})
+	})
+	return r, nil
+}
+
+func newRelay(host p2phost.Host, limits Limits) *Relay {
+	r := &Relay{
+		host:         host,
+		limits:       limits,
+		reservations: make(map[peer.ID]time.Time),
+		circuits:     make(map[peer.ID]int),
+	}
+	host.SetStreamHandler(ReserveProtocolID, r.handleReserve)
+	return r
+}
+
+// Close stops granting reservations. The circuits stay limited.
+func (r *Relay) Close() error {
+	r.host.RemoveStreamHandler(ReserveProtocolID)
+	return nil
+}
+
+// reserve grants p a reservation, or renews it, returning its expiration.
+func (r *Relay) reserve(p peer.ID) (time.Time, error) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	now := time.Now()
+	if _, ok := r.reservations[p]; !ok {
+		for q, expires := range r.reservations {
+			if now.After(expires) {
+				delete(r.reservations, q)
+			}
+		}
+		if len(r.reservations) >= r.limits.MaxReservations {
+			return time.Time{}, fmt.Errorf("relaylimit: the %d reservations are taken", r.limits.MaxReservations)
+		}
+	}
+	expires := now.Add(r.limits.ReservationTTL)
+	r.reservations[p] = expires
+	return expires, nil
+}
+
+// open counts a circuit from src to dst, refused if dst holds no reservation
+// or if either peer has too many circuits.
+func (r *Relay) open(src, dst peer.ID) error {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	expires, ok := r.reservations[dst]
+	if !ok || time.Now().After(expires) {
+		return errNoReservation
+	}
+	if r.circuits[src] >= r.limits.MaxCircuits || r.circuits[dst] >= r.limits.MaxCircuits {
+		return errTooManyCircuits
+	}
+	r.circuits[src]++
+	r.circuits[dst]++
+	return nil
+}
+
+func (r *Relay) close(src, dst peer.ID) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	for _, p := range []peer.ID{src, dst} {
+		r.circuits[p]--
+		if r.circuits[p] <= 0 {
+			delete(r.circuits, p)
+		}
+	}
+}
+
+// stream is an incoming stream, limited once it turns out to be a relay
+// request: the relay reads the request, which is parsed on the way.
+type stream struct {
+	inet.Stream
+	r *Relay
+
+	lk     sync.Mutex
+	hop    bool   // the stream speaks the relay protocol, until its request is read
+	header []byte // the bytes of the request read so far
+
+	// set while the circuit is relayed
+	dst         peer.ID
+	relayed     bool
+	read, wrote int64
+	timer       *time.Timer
+}
+
+func (s *stream) SetProtocol(p protocol.ID) {
+	s.lk.Lock()
+	s.hop = p == circuit.ProtoID
+	s.lk.Unlock()
+	s.Stream.SetProtocol(p)
+}
+
+func (s *stream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+
+	var lerr error
+	s.lk.Lock()
+	if s.hop {
+		lerr = s.readHeader(b[:n])
+	} else if s.relayed {
+		s.read += int64(n)
+		if s.read > s.r.limits.Data {
+			lerr = errLimitReached
+		}
+	}
+	s.lk.Unlock()
+
+	switch {
+	case lerr == errLimitReached:
+		s.Reset()
+		return 0, lerr
+	case lerr != nil:
+		// the relay answers the refused requests, and resets the stream
+		return 0, lerr
+	case err != nil:
+		s.release()
+	}
+	return n, err
+}
+
+// readHeader parses the bytes b read of the request, and opens the circuit
+// once it is complete. s.lk must be held.
+func (s *stream) readHeader(b []byte) error {
+	s.header = append(s.header, b...)
+	size, n := binary.Uvarint(s.header)
+	if n == 0 {
+		return nil // the size isn't read yet
+	}
+	if n < 0 || size > maxMessageSize {
+		s.hop = false // not a request the relay accepts either
+		return nil
+	}
+	end := n + int(size)
+	if len(s.header) < end {
+		return nil
+	}
+
+	s.hop = false
+	var req pb.CircuitRelay
+	if err := proto.Unmarshal(s.header[n:end], &req); err != nil || req.GetType() != pb.CircuitRelay_HOP {
+		return nil
+	}
+	dst, err := peer.IDFromBytes(req.GetDstPeer().GetId())
+	if err != nil {
+		return nil
+	}
+
+	src := s.Conn().RemotePeer()
+	if err := s.r.open(src, dst); err != nil {
+		code := pb.CircuitRelay_HOP_NO_CONN_TO_DST
+		if err == errTooManyCircuits {
+			code = pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM
+		}
+		log.Debugf("refusing to relay %s to %s: %s", src.Pretty(), dst.Pretty(), err)
+		writeStatus(s.Stream, code)
+		return err
+	}
+	s.dst = dst
+	s.relayed = true
+	s.timer = time.AfterFunc(s.r.limits.Duration, func() { s.Reset() })
+	// the bytes read past the request are relayed
+	s.read = int64(len(s.header) - end)
+	s.header = nil
+	return nil
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	s.lk.Lock()
+	over := false
+	if s.relayed {
+		s.wrote += int64(len(b))
+		over = s.wrote > s.r.limits.Data
+	}
+	s.lk.Unlock()
+
+	if over {
+		s.Reset()
+		return 0, errLimitReached
+	}
+	return s.Stream.Write(b)
+}
+
+func (s *stream) Close() error {
+	s.release()
+	return s.Stream.Close()
+}
+
+func (s *stream) Reset() error {
+	s.release()
+	return s.Stream.Reset()
+}
+
+// release stops counting the circuit of s, if any.
+func (s *stream) release() {
+	s.lk.Lock()
+	relayed, dst, timer := s.relayed, s.dst, s.timer
+	s.relayed = false
+	s.lk.Unlock()
+
+	if !relayed {
+		return
+	}
+	timer.Stop()
+	s.r.close(s.Conn().RemotePeer(), dst)
+}
+
+// writeStatus answers a relay request with the status code.
+func writeStatus(s inet.Stream, code pb.CircuitRelay_Status) {
+	b, err := proto.Marshal(&pb.CircuitRelay{
+		Type: pb.CircuitRelay_STATUS.Enum(),
+		Code: code.Enum(),
+	})
+	if err != nil {
+		return
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(b)))
+	s.Write(append(prefix[:n], b...))
+}
@@ -0,0 +1,148 @@
+package relaylimit
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	circuit "gx/ipfs/QmNcNWuV38HBGYtRUi3okmfXSMEmXWwNgb82N3PzqqsHhY/go-libp2p-circuit"
+	pb "gx/ipfs/QmNcNWuV38HBGYtRUi3okmfXSMEmXWwNgb82N3PzqqsHhY/go-libp2p-circuit/pb"
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	mocknet "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/net/mock"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	proto "gx/ipfs/QmdxUuburamoF6zF9qjeQC4WYcWGbWuRmdLacMEsW8ioD8/gogo-protobuf/proto"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+const testProtocol = "/test/relay"
+
+func TestReserve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	limits := DefaultLimits
+	limits.MaxReservations = 1
+	newRelay(hosts[0], limits)
+
+	for i := 0; i < 2; i++ {
+		ttl, err := Reserve(ctx, hosts[1], hosts[0].ID())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl <= 0 || ttl > time.Hour {
+			t.Fatalf("expected a reservation of up to an hour, got %s", ttl)
+		}
+	}
+	if _, err := Reserve(ctx, hosts[2], hosts[0].ID()); err == nil {
+		t.Fatal("expected the reservations over the limit to be refused")
+	}
+}
+
+// relayRequest returns the HOP request of a circuit to dst, and data.
+func relayRequest(t *testing.T, dst peer.ID, data []byte) []byte {
+	b, err := proto.Marshal(&pb.CircuitRelay{
+		Type:    pb.CircuitRelay_HOP.Enum(),
+		DstPeer: &pb.CircuitRelay_Peer{Id: []byte(dst)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(b)))
+	return append(append(prefix[:n], b...), data...)
+}
+
+// openStream opens a stream from src to the relay, returning both ends, the
+// end of the relay limited by r.
+func openStream(ctx context.Context, t *testing.T, r *Relay, src, relay int, hosts []hostWithStreams) (inet.Stream, *stream) {
+	out, err := hosts[src].NewStream(ctx, hosts[relay].ID(), testProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := <-hosts[relay].streams
+	s := &stream{Stream: in, r: r}
+	s.SetProtocol(circuit.ProtoID)
+	return out, s
+}
+
+func TestLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []hostWithStreams
+	for _, h := range mn.Hosts() {
+		hs := hostWithStreams{Host: h, streams: make(chan inet.Stream, 1)}
+		h.SetStreamHandler(testProtocol, func(s inet.Stream) { hs.streams <- s })
+		hosts = append(hosts, hs)
+	}
+
+	limits := DefaultLimits
+	limits.MaxCircuits = 1
+	limits.Data = 10
+	r := newRelay(hosts[0], limits)
+	src, dst := hosts[1].ID(), hosts[2].ID()
+	buf := make([]byte, 1024)
+
+	// no reservation
+	out, s := openStream(ctx, t, r, 1, 0, hosts)
+	out.Write(relayRequest(t, dst, nil))
+	if _, err := s.Read(buf); err != errNoReservation {
+		t.Fatalf("expected the circuit to be refused, got %v", err)
+	}
+	if n, _ := out.Read(buf); n == 0 {
+		t.Error("expected the refusal to be answered")
+	}
+
+	if _, err := r.reserve(dst); err != nil {
+		t.Fatal(err)
+	}
+	out, s = openStream(ctx, t, r, 1, 0, hosts)
+	req := relayRequest(t, dst, []byte("12345"))
+	out.Write(req)
+	read := 0
+	for read < len(req) {
+		n, err := s.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read += n
+	}
+	if r.circuits[src] != 1 || r.circuits[dst] != 1 {
+		t.Fatalf("expected the circuit to be counted, got %v", r.circuits)
+	}
+
+	// one circuit per peer
+	out2, s2 := openStream(ctx, t, r, 1, 0, hosts)
+	out2.Write(relayRequest(t, dst, nil))
+	if _, err := s2.Read(buf); err != errTooManyCircuits {
+		t.Fatalf("expected the second circuit to be refused, got %v", err)
+	}
+
+	// 10 bytes in each direction
+	if _, err := s.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("0")); err != errLimitReached {
+		t.Fatalf("expected the data written over the limit to be refused, got %v", err)
+	}
+	if len(r.circuits) != 0 {
+		t.Fatalf("expected the circuit to be released, got %v", r.circuits)
+	}
+}
+
+// hostWithStreams is a host passing the streams of testProtocol on streams.
+type hostWithStreams struct {
+	p2phost.Host
+	streams chan inet.Stream
+}
@@ -0,0 +1,79 @@
+package relaylimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+// ReserveProtocolID is the protocol the reservations are requested on. The
+// relay answers the peer opening a stream with its reservation, in JSON.
+const ReserveProtocolID = "/ipfs/relay/reserve/1.0.0"
+
+// Timeout bounds the time of the reservation requests.
+var Timeout = 10 * time.Second
+
+// maxReservationSize bounds the size of the answers to the reservation
+// requests.
+const maxReservationSize = 1024
+
+// reservation is the answer to a reservation request.
+type reservation struct {
+	// TTL is the time the reservation lasts, in seconds, unless refused
+	TTL int64 `json:",omitempty"`
+
+	// Error is why the reservation was refused
+	Error string `json:",omitempty"`
+}
+
+func (r *Relay) handleReserve(st inet.Stream) {
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(Timeout))
+
+	p := st.Conn().RemotePeer()
+	var res reservation
+	if expires, err := r.reserve(p); err != nil {
+		res.Error = err.Error()
+	} else {
+		res.TTL = int64(time.Until(expires) / time.Second)
+	}
+	if err := json.NewEncoder(st).Encode(res); err != nil {
+		log.Debugf("answering the reservation of %s: %s", p.Pretty(), err)
+		st.Reset()
+	}
+}
+
+// Reserve reserves a slot at relay, so that it relays the circuits to host.
+// It returns the time the reservation lasts, it must be renewed before.
+func Reserve(ctx context.Context, host p2phost.Host, relay peer.ID) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	st, err := host.NewStream(ctx, relay, ReserveProtocolID)
+	if err != nil {
+		return 0, err
+	}
+	defer st.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		st.SetDeadline(deadline)
+	}
+
+	var res reservation
+	if err := json.NewDecoder(io.LimitReader(st, maxReservationSize)).Decode(&res); err != nil {
+		st.Reset()
+		return 0, err
+	}
+	if res.Error != "" {
+		return 0, errors.New(res.Error)
+	}
+	if res.TTL <= 0 {
+		return 0, errors.New("relaylimit: the relay granted no reservation")
+	}
+	return time.Duration(res.TTL) * time.Second, nil
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+)
+
+// ConfigReloader applies the current config of a repo to a running service.
+type ConfigReloader func(r repo.Repo) error
+
+type configReloader struct {
+	section string
+	reload  ConfigReloader
+}
+
+// configReloadable is implemented by repos that can re-read their config
+// from disk.
+type configReloadable interface {
+	ReloadConfig() error
+}
+
+// OnConfigReload registers f to be called by ReloadConfig. section names the
+// part of the config f applies (e.g., "Gateway.RateLimit").
+func (n *IpfsNode) OnConfigReload(section string, f ConfigReloader) {
+	n.reloadLk.Lock()
+	defer n.reloadLk.Unlock()
+
+	n.reloaders = append(n.reloaders, configReloader{section: section, reload: f})
+}
+
+// ReloadConfig re-reads the config of the node and applies the sections that
+// can be changed without restarting. It returns the names of the sections
+// that were reloaded.
+func (n *IpfsNode) ReloadConfig() ([]string, error) {
+	if r, ok := n.Repo.(configReloadable); ok {
+		if err := r.ReloadConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	n.reloadLk.Lock()
+	reloaders := make([]configReloader, len(n.reloaders))
+	copy(reloaders, n.reloaders)
+	n.reloadLk.Unlock()
+
+	var sections []string
+	seen := make(map[string]bool)
+	for _, r := range reloaders {
+		if err := r.reload(n.Repo); err != nil {
+			return sections, fmt.Errorf("failed to reload %s: %s", r.section, err)
+		}
+		if !seen[r.section] {
+			seen[r.section] = true
+			sections = append(sections, r.section)
+		}
+	}
+	return sections, nil
+}
+
+// reloadReproviderInterval applies Reprovider.Interval to the running
+// reprovider.
+func (n *IpfsNode) reloadReproviderInterval(r repo.Repo) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+
+	interval := kReprovideFrequency
+	if cfg.Reprovider.Interval != "" {
+		interval, err = time.ParseDuration(cfg.Reprovider.Interval)
+		if err != nil {
+			return err
+		}
+	}
+
+	n.Reprovider.SetInterval(interval)
+	return nil
+}
+
+// reloadDiscovery starts, stops or restarts the mDNS service when
+// Discovery.MDNS changes.
+func (n *IpfsNode) reloadDiscovery(r repo.Repo) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	tag, err := mdnsServiceTag(r)
+	if err != nil {
+		return err
+	}
+
+	n.discoveryLk.Lock()
+	defer n.discoveryLk.Unlock()
+
+	if cfg.Discovery.MDNS == n.discoveryCfg && tag == n.discoveryTag {
+		return nil
+	}
+	n.discoveryCfg = cfg.Discovery.MDNS
+	n.discoveryTag = tag
+	return n.restartDiscovery(n.discoveryCfg, tag, n.discoveryCfg.Enabled)
+}
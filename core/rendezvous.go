@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rendezvous "github.com/ipfs/go-ipfs/rendezvous"
+
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	iaddr "gx/ipfs/QmSzEdVLaPMQGAKKGo4mKjsbWcfz6w8CoDjhRPxdk7xYdn/go-ipfs-addr"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+)
+
+// defaultRendezvousInterval is the time between two discoveries of the peers
+// of the namespaces of Rendezvous.Namespaces.
+const defaultRendezvousInterval = 5 * time.Minute
+
+// rendezvousTimeout bounds the time of the requests to the rendezvous points.
+const rendezvousTimeout = time.Minute
+
+// setupRendezvous serves the rendezvous protocol if Rendezvous.Server is set,
+// and registers the node and discovers the peers under the namespaces of
+// Rendezvous.Namespaces at the rendezvous points of Rendezvous.Points.
+func (n *IpfsNode) setupRendezvous() error {
+	server, err := configBool(n.Repo, "Rendezvous.Server")
+	if err != nil {
+		return err
+	}
+	if server {
+		n.RendezvousService = rendezvous.NewService(n.PeerHost)
+	}
+
+	addrs, err := configStrings(n.Repo, "Rendezvous.Points")
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return nil
+	}
+	points := make([]pstore.PeerInfo, len(addrs))
+	for i, s := range addrs {
+		ia, err := iaddr.ParseString(s)
+		if err != nil {
+			return fmt.Errorf("invalid value for Rendezvous.Points: %s", err)
+		}
+		points[i] = pstore.PeerInfo{
+			ID:    ia.ID(),
+			Addrs: []ma.Multiaddr{ia.Transport()},
+		}
+	}
+	n.Rendezvous = rendezvous.NewClient(n.PeerHost, points)
+
+	namespaces, err := configStrings(n.Repo, "Rendezvous.Namespaces")
+	if err != nil {
+		return err
+	}
+	ttl, err := configDuration(n.Repo, "Rendezvous.TTL", rendezvous.DefaultTTL)
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 || ttl > rendezvous.MaxTTL {
+		return fmt.Errorf("invalid value for Rendezvous.TTL: expected a duration up to %s, got %s", rendezvous.MaxTTL, ttl)
+	}
+	interval, err := configDuration(n.Repo, "Rendezvous.Interval", defaultRendezvousInterval)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid value for Rendezvous.Interval: expected a positive duration, got %s", interval)
+	}
+
+	if len(namespaces) > 0 {
+		n.Process().Go(func(proc goprocess.Process) {
+			n.runRendezvous(proc, namespaces, ttl, interval)
+		})
+	}
+	return nil
+}
+
+// runRendezvous keeps the node registered under namespaces, renewing the
+// registrations halfway through their ttl, and connects to the peers
+// registered under them every interval. The registrations are removed when
+// the node stops.
+func (n *IpfsNode) runRendezvous(proc goprocess.Process, namespaces []string, ttl, interval time.Duration) {
+	ctx, cancel := context.WithCancel(n.Context())
+	defer cancel()
+
+	renew := make(map[string]time.Time, len(namespaces))
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		now := time.Now()
+		for _, ns := range namespaces {
+			if now.Before(renew[ns]) {
+				continue
+			}
+			rctx, rcancel := context.WithTimeout(ctx, rendezvousTimeout)
+			granted, err := n.Rendezvous.Register(rctx, ns, ttl)
+			rcancel()
+			if err != nil {
+				log.Warningf("registering under %s at the rendezvous points: %s", ns, err)
+				continue
+			}
+			renew[ns] = now.Add(granted / 2)
+		}
+
+		for _, ns := range namespaces {
+			rctx, rcancel := context.WithTimeout(ctx, rendezvousTimeout)
+			peers, err := n.Rendezvous.Discover(rctx, ns, 0)
+			rcancel()
+			if err != nil {
+				log.Warningf("discovering the peers of %s at the rendezvous points: %s", ns, err)
+				continue
+			}
+			for _, pi := range peers {
+				if len(n.PeerHost.Network().ConnsToPeer(pi.ID)) > 0 {
+					continue
+				}
+				go n.peerFound(pi, "rendezvous")
+			}
+		}
+
+		select {
+		case <-t.C:
+		case <-proc.Closing():
+			uctx, ucancel := context.WithTimeout(context.Background(), discoveryConnTimeout)
+			for _, ns := range namespaces {
+				if err := n.Rendezvous.Unregister(uctx, ns); err != nil {
+					log.Debugf("unregistering from %s: %s", ns, err)
+				}
+			}
+			ucancel()
+			return
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	namesys "github.com/ipfs/go-ipfs/namesys"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	exchange "gx/ipfs/QmP2g3VxmC7g7fyRJDj1VJ72KHZbJ9UW24YjSWEj1XTb4H/go-ipfs-exchange-interface"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+)
+
+// NamedRepos are the repos served by a node in addition to its own, e.g. one
+// per tenant of a shared daemon. Each named repo has a node of its own, with
+// its own blocks, pins, MFS root and keys, which uses the host, routing and
+// exchange of the main node rather than starting its own.
+type NamedRepos struct {
+	parent *IpfsNode
+
+	// blocks and exchange are the blockstore and the exchange of the parent
+	// online, shared with the named repos
+	blocks   *exchangeBlockstore
+	exchange exchange.Interface
+
+	lk    sync.RWMutex
+	nodes map[string]*IpfsNode
+}
+
+func newNamedRepos(parent *IpfsNode) *NamedRepos {
+	return &NamedRepos{
+		parent: parent,
+		nodes:  make(map[string]*IpfsNode),
+	}
+}
+
+// Add builds the node of the repo r, served under name. The node is closed
+// with the main node.
+func (nr *NamedRepos) Add(ctx context.Context, name string, r repo.Repo) (*IpfsNode, error) {
+	nr.lk.Lock()
+	defer nr.lk.Unlock()
+
+	if _, ok := nr.nodes[name]; ok {
+		return nil, fmt.Errorf("named repo %q is already open", name)
+	}
+
+	n, err := NewNode(ctx, &BuildCfg{
+		Online:    nr.parent.OnlineMode(),
+		Permanent: true,
+		Repo:      r,
+		parent:    nr.parent,
+	})
+	if err != nil {
+		return nil, err
+	}
+	nr.nodes[name] = n
+	return n, nil
+}
+
+// Get returns the node of the named repo.
+func (nr *NamedRepos) Get(name string) (*IpfsNode, error) {
+	nr.lk.RLock()
+	defer nr.lk.RUnlock()
+
+	n, ok := nr.nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("no repo named %q", name)
+	}
+	return n, nil
+}
+
+// Names returns the sorted names of the repos.
+func (nr *NamedRepos) Names() []string {
+	nr.lk.RLock()
+	defer nr.lk.RUnlock()
+
+	names := make([]string, 0, len(nr.nodes))
+	for name := range nr.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (nr *NamedRepos) all() []*IpfsNode {
+	nr.lk.RLock()
+	defer nr.lk.RUnlock()
+
+	nodes := make([]*IpfsNode, 0, len(nr.nodes))
+	for _, n := range nr.nodes {
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// Close closes the nodes of the repos.
+func (nr *NamedRepos) Close() error {
+	nr.lk.Lock()
+	defer nr.lk.Unlock()
+
+	var err error
+	for name, n := range nr.nodes {
+		if cerr := n.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("closing repo %q: %s", name, cerr)
+		}
+		delete(nr.nodes, name)
+	}
+	return err
+}
+
+// useParentServices makes the node of a named repo use the network services
+// of parent, the node serving it. The blocks of the named repo are fetched
+// with the exchange of parent, but they are neither served nor announced by
+// it: they are stored in the blockstore of the named repo only.
+func (n *IpfsNode) useParentServices(parent *IpfsNode) error {
+	if err := n.LoadPrivateKey(); err != nil {
+		return err
+	}
+
+	n.parent = parent
+	n.Peerstore = parent.Peerstore
+	n.PeerHost = parent.PeerHost
+	n.SwarmEvents = parent.SwarmEvents
+	n.Routing = parent.Routing
+	n.PubSub = parent.PubSub
+	n.Exchange = &childExchange{
+		Interface: parent.Repos.exchange,
+		wants:     parent.Repos.blocks,
+		bs:        n.Blockstore,
+	}
+
+	size, err := n.getCacheSize()
+	if err != nil {
+		return err
+	}
+
+	// names are resolved and published with the keys of the named repo
+	n.Namesys = namesys.NewNameSystem(n.Routing, n.Repo.Datastore(), size)
+	return n.setupIpnsRepublisher()
+}
+
+// exchangeBlockstore is the blockstore of the exchange of a node serving
+// named repos. The exchange stores the blocks it receives in it, but those
+// wanted by the named repos alone are dropped: their childExchange stores
+// them in the blockstore of the named repo instead, so that the node neither
+// serves nor announces them.
+type exchangeBlockstore struct {
+	bstore.Blockstore
+
+	lk    sync.Mutex
+	wants map[cid.Cid]*wanters
+}
+
+// wanters counts the fetches of a block in flight.
+type wanters struct {
+	node, repos int
+}
+
+func newExchangeBlockstore(bs bstore.Blockstore) *exchangeBlockstore {
+	return &exchangeBlockstore{
+		Blockstore: bs,
+		wants:      make(map[cid.Cid]*wanters),
+	}
+}
+
+// want records the fetches of cs, by the node itself or by a named repo.
+func (bs *exchangeBlockstore) want(cs []cid.Cid, named bool) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	for _, c := range cs {
+		w, ok := bs.wants[c]
+		if !ok {
+			w = new(wanters)
+			bs.wants[c] = w
+		}
+		if named {
+			w.repos++
+		} else {
+			w.node++
+		}
+	}
+}
+
+// unwant records the end of the fetches of cs recorded by want.
+func (bs *exchangeBlockstore) unwant(cs []cid.Cid, named bool) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	for _, c := range cs {
+		w, ok := bs.wants[c]
+		if !ok {
+			continue
+		}
+		if named {
+			w.repos--
+		} else {
+			w.node--
+		}
+		if w.node <= 0 && w.repos <= 0 {
+			delete(bs.wants, c)
+		}
+	}
+}
+
+// reposOnly tells whether c is wanted by the named repos, not by the node.
+func (bs *exchangeBlockstore) reposOnly(c cid.Cid) bool {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	w, ok := bs.wants[c]
+	return ok && w.repos > 0 && w.node <= 0
+}
+
+func (bs *exchangeBlockstore) Put(blk blocks.Block) error {
+	if bs.reposOnly(blk.Cid()) {
+		return nil
+	}
+	return bs.Blockstore.Put(blk)
+}
+
+func (bs *exchangeBlockstore) PutMany(blks []blocks.Block) error {
+	kept := blks[:0:0]
+	for _, blk := range blks {
+		if !bs.reposOnly(blk.Cid()) {
+			kept = append(kept, blk)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return bs.Blockstore.PutMany(kept)
+}
+
+// filterProvides returns a content routing announcing the blocks kept in bs
+// only, and not those dropped for the named repos.
+func (bs *exchangeBlockstore) filterProvides(r routing.ContentRouting) routing.ContentRouting {
+	return &keptRouting{ContentRouting: r, bs: bs.Blockstore}
+}
+
+type keptRouting struct {
+	routing.ContentRouting
+	bs bstore.Blockstore
+}
+
+func (r *keptRouting) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	if has, err := r.bs.Has(c); err == nil && !has {
+		return nil
+	}
+	return r.ContentRouting.Provide(ctx, c, brdcst)
+}
+
+// parentExchange records the fetches of the node serving named repos, so that
+// the blocks it wants are kept in its blockstore even when a named repo
+// wants them too.
+type parentExchange struct {
+	exchange.Interface
+	wants *exchangeBlockstore
+}
+
+func (e *parentExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	e.wants.want([]cid.Cid{c}, false)
+	defer e.wants.unwant([]cid.Cid{c}, false)
+	return e.Interface.GetBlock(ctx, c)
+}
+
+func (e *parentExchange) GetBlocks(ctx context.Context, cs []cid.Cid) (<-chan blocks.Block, error) {
+	return getBlocks(ctx, e.Interface, e.wants, cs, false, nil)
+}
+
+// childExchange fetches the blocks of a named repo with the exchange of the
+// main node, and stores them in the blockstore of the named repo.
+type childExchange struct {
+	exchange.Interface
+	wants *exchangeBlockstore
+	bs    bstore.Blockstore
+}
+
+func (e *childExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	e.wants.want([]cid.Cid{c}, true)
+	defer e.wants.unwant([]cid.Cid{c}, true)
+
+	blk, err := e.Interface.GetBlock(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.bs.Put(blk); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+func (e *childExchange) GetBlocks(ctx context.Context, cs []cid.Cid) (<-chan blocks.Block, error) {
+	return getBlocks(ctx, e.Interface, e.wants, cs, true, e.bs)
+}
+
+// HasBlock doesn't give the block to the exchange of the main node, which
+// would serve and announce it.
+func (e *childExchange) HasBlock(blocks.Block) error {
+	return nil
+}
+
+// Close doesn't close the exchange, which belongs to the main node.
+func (e *childExchange) Close() error {
+	return nil
+}
+
+// getBlocks fetches cs with ex, recording the fetches in wants until the
+// blocks are received or the fetch ends. The blocks are stored in bs unless
+// it's nil.
+func getBlocks(ctx context.Context, ex exchange.Interface, wants *exchangeBlockstore, cs []cid.Cid, named bool, bs bstore.Blockstore) (<-chan blocks.Block, error) {
+	pending := cid.NewSet()
+	for _, c := range cs {
+		pending.Add(c)
+	}
+
+	wants.want(pending.Keys(), named)
+	in, err := ex.GetBlocks(ctx, cs)
+	if err != nil {
+		wants.unwant(pending.Keys(), named)
+		return nil, err
+	}
+
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		defer func() {
+			wants.unwant(pending.Keys(), named)
+		}()
+
+		for blk := range in {
+			if pending.Has(blk.Cid()) {
+				pending.Remove(blk.Cid())
+				wants.unwant([]cid.Cid{blk.Cid()}, named)
+			}
+			if bs != nil {
+				if err := bs.Put(blk); err != nil {
+					log.Errorf("storing block %s in named repo: %s", blk.Cid(), err)
+					continue
+				}
+			}
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,397 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+	compose "github.com/ipfs/go-ipfs/routing/compose"
+	delegated "github.com/ipfs/go-ipfs/routing/delegated"
+	rtpersist "github.com/ipfs/go-ipfs/routing/rtpersist"
+
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	iaddr "gx/ipfs/QmSzEdVLaPMQGAKKGo4mKjsbWcfz6w8CoDjhRPxdk7xYdn/go-ipfs-addr"
+	dht "gx/ipfs/QmXbPygnUKAPMwseE5U3hQA7Thn59GVm7pQrhkFV63umT8/go-libp2p-kad-dht"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	nilrouting "gx/ipfs/QmdmWkx54g7VfVyxeG8ic84uf4G6Eq1GohuyKA3XDuJ8oC/go-ipfs-routing/none"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	record "gx/ipfs/QmfARXVCzpwFXQdepAJZuqyNDgV9doEsMnVCo1ssmuSe1U/go-libp2p-record"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+// withDelegates returns r, queried after the endpoints of the optional
+// Routing.Delegates config key for the providers and the IPNS records.
+func (n *IpfsNode) withDelegates(r routing.IpfsRouting) (routing.IpfsRouting, error) {
+	urls, err := configStrings(n.Repo, "Routing.Delegates")
+	if err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		return r, nil
+	}
+	clients, err := delegatedClients("Routing.Delegates", urls)
+	if err != nil {
+		return nil, err
+	}
+	return delegated.Wrap(r, clients, n.RecordValidator), nil
+}
+
+// delegatedClients returns the clients of the endpoints at urls, read from
+// the config key key.
+func delegatedClients(key string, urls []string) ([]*delegated.Client, error) {
+	clients := make([]*delegated.Client, len(urls))
+	for i, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %s", key, err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("invalid value for %s: expected an http or https URL, got %q", key, u)
+		}
+		clients[i] = delegated.NewClient(u)
+	}
+	return clients, nil
+}
+
+// RouterConstructor builds a router of the type it's registered for, declared
+// in Routing.Routers or selected by Routing.Type. params are the Parameters
+// of the router, nil when it's selected by Routing.Type.
+type RouterConstructor func(ctx context.Context, host p2phost.Host, dstore ds.Batching, validator record.Validator, params map[string]interface{}) (routing.IpfsRouting, error)
+
+// builtinRouters are the router types of Routing.Routers built by the node.
+var builtinRouters = map[string]bool{
+	"dht":        true,
+	"delegated":  true,
+	"mdns":       true,
+	"static":     true,
+	"parallel":   true,
+	"sequential": true,
+	"tiered":     true,
+}
+
+var routers = map[string]RouterConstructor{}
+
+// AddRouterConstructor registers a router type, usable in Routing.Routers
+// and as Routing.Type.
+func AddRouterConstructor(name string, c RouterConstructor) error {
+	if _, ok := routers[name]; ok || builtinRouters[name] {
+		return fmt.Errorf("already have a router type named %q", name)
+	}
+	routers[name] = c
+	return nil
+}
+
+// RouterOption returns the routing option building the router type name,
+// registered with AddRouterConstructor, false if it isn't registered.
+func RouterOption(name string) (RoutingOption, bool) {
+	c, ok := routers[name]
+	if !ok {
+		return nil, false
+	}
+	return func(ctx context.Context, host p2phost.Host, dstore ds.Batching, validator record.Validator) (routing.IpfsRouting, error) {
+		return c(ctx, host, dstore, validator, nil)
+	}, true
+}
+
+// RoutingWrapper wraps the routing system of an online node. The host of the
+// node is set up when it's called.
+type RoutingWrapper func(ctx context.Context, n *IpfsNode, r routing.IpfsRouting) (routing.IpfsRouting, error)
+
+var routingWrappers []RoutingWrapper
+
+// AddRoutingWrapper registers a wrapper of the routing system of the online
+// nodes. The wrappers are applied in the order they are registered.
+func AddRoutingWrapper(w RoutingWrapper) {
+	routingWrappers = append(routingWrappers, w)
+}
+
+// wrapRouting applies the registered wrappers to r.
+func (n *IpfsNode) wrapRouting(ctx context.Context, r routing.IpfsRouting) (routing.IpfsRouting, error) {
+	for _, w := range routingWrappers {
+		var err error
+		if r, err = w(ctx, n, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// CustomRoutingOption returns the routing option building the routers
+// declared by the Routing.Routers config key of r, the one named by
+// Routing.Router being the routing system of the node.
+func CustomRoutingOption(r repo.Repo) RoutingOption {
+	return func(ctx context.Context, host p2phost.Host, dstore ds.Batching, validator record.Validator) (routing.IpfsRouting, error) {
+		val, err := r.GetConfigKey("Routing.Routers")
+		if err != nil || val == nil {
+			return nil, errors.New("the custom routing needs Routing.Routers to be set")
+		}
+		specs, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid value for Routing.Routers: expected an object, got %v", val)
+		}
+		val, err = r.GetConfigKey("Routing.Router")
+		if err != nil || val == nil {
+			return nil, errors.New("the custom routing needs Routing.Router to be set")
+		}
+		root, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for Routing.Router: expected a string, got %v", val)
+		}
+
+		b := &routerBuilder{
+			ctx:       ctx,
+			host:      host,
+			dstore:    dstore,
+			validator: validator,
+			specs:     specs,
+			built:     make(map[string]routing.IpfsRouting),
+			building:  make(map[string]bool),
+		}
+		return b.build(root)
+	}
+}
+
+// routerBuilder builds the routers declared by Routing.Routers, each once.
+type routerBuilder struct {
+	ctx       context.Context
+	host      p2phost.Host
+	dstore    ds.Batching
+	validator record.Validator
+
+	specs    map[string]interface{}
+	built    map[string]routing.IpfsRouting
+	building map[string]bool
+	dht      bool
+}
+
+func (b *routerBuilder) build(name string) (routing.IpfsRouting, error) {
+	if r, ok := b.built[name]; ok {
+		return r, nil
+	}
+	if b.building[name] {
+		return nil, fmt.Errorf("invalid value for Routing.Routers: the router %q is part of itself", name)
+	}
+	b.building[name] = true
+
+	key := "Routing.Routers." + name
+	val, ok := b.specs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown router %q", name)
+	}
+	spec, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid value for %s: expected an object, got %v", key, val)
+	}
+	typ, ok := spec["Type"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid value for %s.Type: expected a string, got %v", key, spec["Type"])
+	}
+	params := map[string]interface{}{}
+	if val, ok := spec["Parameters"]; ok && val != nil {
+		if params, ok = val.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("invalid value for %s.Parameters: expected an object, got %v", key, val)
+		}
+	}
+	key += ".Parameters"
+
+	var r routing.IpfsRouting
+	var err error
+	switch typ {
+	case "dht":
+		r, err = b.buildDHT(key, params)
+	case "delegated":
+		var urls []string
+		if urls, err = paramStrings(key, params, "Endpoints"); err != nil {
+			break
+		}
+		var clients []*delegated.Client
+		if clients, err = delegatedClients(key+".Endpoints", urls); err != nil {
+			break
+		}
+		var none routing.IpfsRouting
+		if none, err = nilrouting.ConstructNilRouting(b.ctx, b.host, b.dstore, b.validator); err != nil {
+			break
+		}
+		r = delegated.Wrap(none, clients, b.validator)
+	case "mdns":
+		r = compose.NewPeers()
+	case "static":
+		r, err = buildStatic(key, params)
+	case "parallel", "sequential", "tiered":
+		r, err = b.buildComposed(key, typ, params)
+	default:
+		c, ok := routers[typ]
+		if !ok {
+			err = fmt.Errorf("invalid value for Routing.Routers.%s.Type: unknown router type %q", name, typ)
+			break
+		}
+		r, err = c(b.ctx, b.host, b.dstore, b.validator, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.built[name] = r
+	return r, nil
+}
+
+func (b *routerBuilder) buildDHT(key string, params map[string]interface{}) (routing.IpfsRouting, error) {
+	if b.dht {
+		return nil, errors.New("invalid value for Routing.Routers: only one router can be of type dht")
+	}
+	b.dht = true
+
+	switch mode := params["Mode"]; mode {
+	case nil, "server":
+		return constructDHTRouting(b.ctx, b.host, b.dstore, b.validator)
+	case "client":
+		return constructClientDHTRouting(b.ctx, b.host, b.dstore, b.validator)
+	default:
+		return nil, fmt.Errorf("invalid value for %s.Mode: expected \"server\" or \"client\", got %v", key, mode)
+	}
+}
+
+func (b *routerBuilder) buildComposed(key, typ string, params map[string]interface{}) (routing.IpfsRouting, error) {
+	names, err := paramStrings(key, params, "Routers")
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("invalid value for %s.Routers: a %s router needs routers", key, typ)
+	}
+
+	c := &compose.Router{Validator: b.validator}
+	switch typ {
+	case "sequential":
+		c.Mode = compose.Sequential
+	case "tiered":
+		c.Mode = compose.Tiered
+	}
+	if val, ok := params["Delay"]; ok {
+		s, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s.Delay: expected a duration, got %v", key, val)
+		}
+		if c.Delay, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("invalid value for %s.Delay: %s", key, err)
+		}
+	}
+
+	for _, name := range names {
+		r, err := b.build(name)
+		if err != nil {
+			return nil, err
+		}
+		c.Routers = append(c.Routers, r)
+	}
+	return c, nil
+}
+
+func buildStatic(key string, params map[string]interface{}) (routing.IpfsRouting, error) {
+	addrs, err := paramStrings(key, params, "Peers")
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]pstore.PeerInfo, len(addrs))
+	for i, s := range addrs {
+		ia, err := iaddr.ParseString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s.Peers: %s", key, err)
+		}
+		peers[i] = pstore.PeerInfo{
+			ID:    ia.ID(),
+			Addrs: []ma.Multiaddr{ia.Transport()},
+		}
+	}
+	return compose.NewStatic(peers), nil
+}
+
+// paramStrings reads the list of strings name of the parameters of a router,
+// set at key.
+func paramStrings(key string, params map[string]interface{}, name string) ([]string, error) {
+	list, ok := params[name].([]interface{})
+	if !ok && params[name] != nil {
+		return nil, fmt.Errorf("invalid value for %s.%s: expected a list of strings, got %v", key, name, params[name])
+	}
+	out := make([]string, 0, len(list))
+	for _, v := range list {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s.%s: expected a list of strings, got %v", key, name, params[name])
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// findDHT returns the DHT of r, nil if it has none.
+func findDHT(r routing.IpfsRouting) *dht.IpfsDHT {
+	switch r := r.(type) {
+	case *dht.IpfsDHT:
+		return r
+	case *compose.Router:
+		for _, rt := range r.Routers {
+			if d := findDHT(rt); d != nil {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// restoreConcurrency bounds the number of peers of the saved routing table
+// dialed at once.
+const restoreConcurrency = 16
+
+// restoreRoutingTable reconnects to the peers of the routing table of the DHT
+// saved when the node last ran, which brings them back into the table, and
+// saves the table from now on.
+func (n *IpfsNode) restoreRoutingTable(ctx context.Context) error {
+	peers, err := rtpersist.Load(n.Repo.Datastore())
+	if err != nil {
+		return err
+	}
+	if len(peers) > 0 {
+		log.Infof("reconnecting to %d peers of the last routing table", len(peers))
+		go restoreConnect(ctx, n.PeerHost, peers)
+	}
+	n.tableSaver = rtpersist.Start(n.Repo.Datastore(), n.dhtPeers)
+	return nil
+}
+
+// dhtPeers returns the peers connected speaking the DHT protocol, which make
+// up its routing table, with their addresses.
+func (n *IpfsNode) dhtPeers() []pstore.PeerInfo {
+	var out []pstore.PeerInfo
+	for _, p := range n.PeerHost.Network().Peers() {
+		protos, err := n.Peerstore.SupportsProtocols(p, string(dht.ProtocolDHT))
+		if err != nil || len(protos) == 0 {
+			continue
+		}
+		out = append(out, n.Peerstore.PeerInfo(p))
+	}
+	return out
+}
+
+// restoreConnect connects to peers, a few at once.
+func restoreConnect(ctx context.Context, h p2phost.Host, peers []pstore.PeerInfo) {
+	sem := make(chan struct{}, restoreConcurrency)
+	for _, pi := range peers {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func(pi pstore.PeerInfo) {
+			defer func() { <-sem }()
+			ctx, cancel := context.WithTimeout(ctx, DefaultBootstrapConfig.ConnectionTimeout)
+			defer cancel()
+			if err := h.Connect(ctx, pi); err != nil {
+				log.Debugf("reconnecting to %s: %s", pi.ID, err)
+			}
+		}(pi)
+	}
+}
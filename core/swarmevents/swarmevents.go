@@ -0,0 +1,111 @@
+// Package swarmevents broadcasts the events of the swarm of the node, the
+// peers connected, disconnected and found by the local discovery, to the
+// subscribers watching them.
+package swarmevents
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+// Type is the kind of an event.
+type Type string
+
+const (
+	// Connected is the event of a peer the node connected to
+	Connected Type = "connected"
+
+	// Disconnected is the event of a peer the node disconnected from
+	Disconnected Type = "disconnected"
+
+	// Discovered is the event of a peer found by the local discovery
+	Discovered Type = "discovered"
+)
+
+// Buffer is the number of events kept for a subscriber not keeping up, the
+// next ones are dropped.
+var Buffer = 64
+
+// Event is an event of the swarm.
+type Event struct {
+	Type Type
+	Peer peer.ID
+
+	// Addrs are the addresses of the connection, or the addresses the peer
+	// was found at
+	Addrs []ma.Multiaddr
+
+	// Source is the service which found the peer, for Discovered events
+	Source string
+
+	Time time.Time
+}
+
+// Hub broadcasts the events to its subscribers.
+type Hub struct {
+	lk   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// New returns a hub without subscribers.
+func New() *Hub {
+	return &Hub{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns the events published until ctx is canceled.
+func (h *Hub) Subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, Buffer)
+	h.lk.Lock()
+	h.subs[ch] = struct{}{}
+	h.lk.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.lk.Lock()
+		delete(h.subs, ch)
+		close(ch)
+		h.lk.Unlock()
+	}()
+	return ch
+}
+
+// Publish sends e to the subscribers, but those not keeping up.
+func (h *Hub) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Notifiee returns the notifiee of a network publishing its connections and
+// disconnections.
+func (h *Hub) Notifiee() inet.Notifiee {
+	return &inet.NotifyBundle{
+		ConnectedF: func(_ inet.Network, c inet.Conn) {
+			h.Publish(Event{
+				Type:  Connected,
+				Peer:  c.RemotePeer(),
+				Addrs: []ma.Multiaddr{c.RemoteMultiaddr()},
+			})
+		},
+		DisconnectedF: func(_ inet.Network, c inet.Conn) {
+			h.Publish(Event{
+				Type:  Disconnected,
+				Peer:  c.RemotePeer(),
+				Addrs: []ma.Multiaddr{c.RemoteMultiaddr()},
+			})
+		},
+	}
+}
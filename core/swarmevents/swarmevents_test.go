@@ -0,0 +1,41 @@
+package swarmevents
+
+import (
+	"context"
+	"testing"
+
+	testutil "gx/ipfs/QmPuhRE325DR8ChNcFtgd6F1eANCHy1oohXZPpYop4xsK6/go-testutil"
+)
+
+func TestHub(t *testing.T) {
+	defer func(b int) { Buffer = b }(Buffer)
+	Buffer = 2
+
+	h := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := h.Subscribe(ctx)
+
+	p := testutil.RandPeerIDFatal(t)
+	for i := 0; i < 3; i++ {
+		h.Publish(Event{Type: Discovered, Peer: p, Source: "mdns"})
+	}
+
+	for i := 0; i < 2; i++ {
+		e := <-events
+		if e.Type != Discovered || e.Peer != p || e.Time.IsZero() {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("expected the events beyond the buffer to be dropped, got %+v", e)
+	default:
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatal("expected the events to end with the context")
+	}
+	// no subscriber left
+	h.Publish(Event{Type: Connected, Peer: p})
+}
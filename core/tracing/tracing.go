@@ -0,0 +1,240 @@
+// Package tracing reports the spans of the operations of the node to the
+// global tracer of opentracing, set by the tracer plugins with SetTracer. The
+// spans are children of the spans of the contexts of the operations, so that
+// a caller passing the context of its own span sees the operations of the
+// node in its traces.
+//
+// The spans use opentracing, not OpenTelemetry, which isn't a gx dependency,
+// and there is no config for the exporter: a tracer plugin sets the tracer
+// and exports the spans. The exchange and the routing system are wrapped only
+// when a plugin sets the tracer, so without one the fetches of the blocks and
+// the queries of the routing system produce no spans at all. The other spans
+// cost little without one, and only reach the tracer go-log sets.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	exchange "gx/ipfs/QmP2g3VxmC7g7fyRJDj1VJ72KHZbJ9UW24YjSWEj1XTb4H/go-ipfs-exchange-interface"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	ropts "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing/options"
+	opentracing "gx/ipfs/QmWLWmRVSiagqP15jczsGME1qpob6HDbtbHAY2he9W5iUo/opentracing-go"
+	ext "gx/ipfs/QmWLWmRVSiagqP15jczsGME1qpob6HDbtbHAY2he9W5iUo/opentracing-go/ext"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+)
+
+// enabled is set once a tracer plugin sets the tracer. The global tracer
+// can't tell, as go-log sets its own when it's loaded.
+var enabled int32
+
+// SetTracer sets the global tracer to the tracer of a plugin.
+func SetTracer(tracer opentracing.Tracer) {
+	opentracing.SetGlobalTracer(tracer)
+	atomic.StoreInt32(&enabled, 1)
+}
+
+// Enabled tells whether a tracer plugin set the tracer.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Start starts the span of the operation name, a child of the span of ctx
+// if it has one. The function returned finishes it with the error of the
+// operation, for the callers to defer.
+func Start(ctx context.Context, name string) (context.Context, func(*error)) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, name)
+	return ctx, func(err *error) {
+		Finish(span, *err)
+	}
+}
+
+// Finish finishes span, marked as failed if err isn't nil.
+func Finish(span opentracing.Span, err error) {
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogKV("error", err.Error())
+	}
+	span.Finish()
+}
+
+// StartRequest starts the span of the HTTP request r, a child of the span
+// whose context the caller sent in the headers of r if it did, or else of the
+// span of ctx if it has one.
+func StartRequest(ctx context.Context, r *http.Request, name string) (opentracing.Span, context.Context) {
+	tracer := opentracing.GlobalTracer()
+	var opts []opentracing.StartSpanOption
+	if parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header)); err == nil {
+		opts = append(opts, opentracing.ChildOf(parent))
+	} else if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+
+	span := tracer.StartSpan(name, opts...)
+	ext.SpanKindRPCServer.Set(span)
+	ext.HTTPMethod.Set(span, r.Method)
+	ext.HTTPUrl.Set(span, r.URL.Path)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
+
+// Exchange is an exchange tracing the fetches of the blocks.
+type Exchange struct {
+	exchange.Interface
+}
+
+// WrapExchange returns an exchange tracing the fetches of e.
+func WrapExchange(e exchange.Interface) *Exchange {
+	return &Exchange{Interface: e}
+}
+
+func (e *Exchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return getBlock(ctx, e.Interface, c)
+}
+
+func (e *Exchange) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	return getBlocks(ctx, e.Interface, cids)
+}
+
+// NewSession returns a session tracing its fetches, if the exchange wrapped
+// supports sessions.
+func (e *Exchange) NewSession(ctx context.Context) exchange.Fetcher {
+	se, ok := e.Interface.(exchange.SessionExchange)
+	if !ok {
+		return e
+	}
+	return &fetcher{f: se.NewSession(ctx)}
+}
+
+type fetcher struct {
+	f exchange.Fetcher
+}
+
+func (f *fetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return getBlock(ctx, f.f, c)
+}
+
+func (f *fetcher) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	return getBlocks(ctx, f.f, cids)
+}
+
+func getBlock(ctx context.Context, f exchange.Fetcher, c cid.Cid) (blocks.Block, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Exchange.GetBlock")
+	span.SetTag("cid", c.String())
+	b, err := f.GetBlock(ctx, c)
+	Finish(span, err)
+	return b, err
+}
+
+func getBlocks(ctx context.Context, f exchange.Fetcher, cids []cid.Cid) (<-chan blocks.Block, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Exchange.GetBlocks")
+	span.SetTag("count", len(cids))
+	in, err := f.GetBlocks(ctx, cids)
+	if err != nil {
+		Finish(span, err)
+		return nil, err
+	}
+
+	out := make(chan blocks.Block)
+	go func() {
+		defer span.Finish()
+		defer close(out)
+		received := 0
+		for b := range in {
+			select {
+			case out <- b:
+				received++
+			case <-ctx.Done():
+				span.SetTag("received", received)
+				return
+			}
+		}
+		span.SetTag("received", received)
+	}()
+	return out, nil
+}
+
+// Routing is a routing system tracing its queries.
+type Routing struct {
+	routing.IpfsRouting
+}
+
+// batchProvider is a content routing announcing many keys at once, see
+// reprovide.BatchProvider.
+type batchProvider interface {
+	ProvideMany(ctx context.Context, keys []cid.Cid) error
+}
+
+// batchRouting is a Routing wrapping a batchProvider.
+type batchRouting struct {
+	*Routing
+	bp batchProvider
+}
+
+// WrapRouting returns a routing system tracing the queries made with r. It
+// announces many keys at once if r does.
+func WrapRouting(r routing.IpfsRouting) routing.IpfsRouting {
+	rt := &Routing{IpfsRouting: r}
+	if bp, ok := r.(batchProvider); ok {
+		return &batchRouting{Routing: rt, bp: bp}
+	}
+	return rt
+}
+
+func (r *Routing) FindPeer(ctx context.Context, p peer.ID) (_ pstore.PeerInfo, err error) {
+	ctx, done := Start(ctx, "Routing.FindPeer")
+	defer done(&err)
+	return r.IpfsRouting.FindPeer(ctx, p)
+}
+
+func (r *Routing) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan pstore.PeerInfo {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Routing.FindProvidersAsync")
+	span.SetTag("cid", c.String())
+	in := r.IpfsRouting.FindProvidersAsync(ctx, c, count)
+
+	out := make(chan pstore.PeerInfo)
+	go func() {
+		defer span.Finish()
+		defer close(out)
+		found := 0
+		for pi := range in {
+			select {
+			case out <- pi:
+				found++
+			case <-ctx.Done():
+				span.SetTag("found", found)
+				return
+			}
+		}
+		span.SetTag("found", found)
+	}()
+	return out
+}
+
+func (r *Routing) Provide(ctx context.Context, c cid.Cid, brdcst bool) (err error) {
+	ctx, done := Start(ctx, "Routing.Provide")
+	defer done(&err)
+	return r.IpfsRouting.Provide(ctx, c, brdcst)
+}
+
+func (r *Routing) GetValue(ctx context.Context, key string, opts ...ropts.Option) (_ []byte, err error) {
+	ctx, done := Start(ctx, "Routing.GetValue")
+	defer done(&err)
+	return r.IpfsRouting.GetValue(ctx, key, opts...)
+}
+
+func (r *Routing) PutValue(ctx context.Context, key string, value []byte, opts ...ropts.Option) (err error) {
+	ctx, done := Start(ctx, "Routing.PutValue")
+	defer done(&err)
+	return r.IpfsRouting.PutValue(ctx, key, value, opts...)
+}
+
+func (r *batchRouting) ProvideMany(ctx context.Context, keys []cid.Cid) (err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Routing.ProvideMany")
+	span.SetTag("count", len(keys))
+	defer func() { Finish(span, err) }()
+	return r.bp.ProvideMany(ctx, keys)
+}
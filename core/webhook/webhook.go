@@ -0,0 +1,260 @@
+// Package webhook notifies HTTP endpoints of the events of the node, e.g. to
+// alert its operators without polling it.
+//
+// The events are POSTed in JSON, one at a time and in order, by a single
+// worker: a slow endpoint delays the others, and the events are dropped once
+// Queue are waiting. The bodies are signed with the secret of the endpoint,
+// the hex encoded HMAC-SHA256 of the body being sent in the SignatureHeader
+// header as "sha256=<hex>". The body has the time of the event, which the
+// endpoints can check to refuse replays.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("webhook")
+
+// Event is the kind of an event notified.
+type Event string
+
+const (
+	// PinCompleted is the event of objects pinned, with their CIDs
+	PinCompleted Event = "pin.completed"
+
+	// IpnsPublished is the event of a name published, with its value
+	IpnsPublished Event = "ipns.published"
+
+	// RepoNearingQuota is the event of the storage used going over the
+	// watermark of Datastore.StorageMax
+	RepoNearingQuota Event = "repo.quota"
+
+	// NoPeers is the event of the node losing its last peer
+	NoPeers Event = "peers.none"
+)
+
+// Events are the events notified.
+var Events = []Event{PinCompleted, IpnsPublished, RepoNearingQuota, NoPeers}
+
+const (
+	// SignatureHeader is the header of the signature of the body
+	SignatureHeader = "X-Ipfs-Signature"
+
+	// EventHeader is the header of the event, also in the body
+	EventHeader = "X-Ipfs-Event"
+)
+
+var (
+	// Timeout bounds the time of a POST.
+	Timeout = 10 * time.Second
+
+	// Attempts is the number of POSTs of an event to an endpoint failing to
+	// receive it, RetryDelay apart. The responses 4xx aren't retried.
+	Attempts   = 3
+	RetryDelay = 5 * time.Second
+
+	// Queue is the number of events waiting to be sent, the next ones are
+	// dropped.
+	Queue = 256
+)
+
+// Endpoint is an HTTP endpoint notified of events.
+type Endpoint struct {
+	URL string
+
+	// Secret is the key of the signatures, the bodies are unsigned if it
+	// is empty
+	Secret string
+
+	// Events are the events the endpoint is notified of, all if empty
+	Events []Event
+}
+
+func (e *Endpoint) wants(ev Event) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, w := range e.Events {
+		if w == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification is the body of the POSTs.
+type Notification struct {
+	Event Event
+
+	// Node is the peer ID of the node
+	Node string
+
+	Time time.Time
+	Data interface{} `json:",omitempty"`
+}
+
+type delivery struct {
+	endpoint Endpoint
+	event    Event
+	body     []byte
+}
+
+// Notifier sends the events of a node to the endpoints.
+type Notifier struct {
+	node   string
+	client *http.Client
+
+	lk        sync.RWMutex
+	endpoints []Endpoint
+
+	queue  chan delivery
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// New returns a notifier sending the events of node to endpoints.
+func New(node string, endpoints []Endpoint) *Notifier {
+	n := &Notifier{
+		node:      node,
+		client:    &http.Client{Timeout: Timeout},
+		endpoints: endpoints,
+		queue:     make(chan delivery, Queue),
+		closed:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// SetEndpoints replaces the endpoints notified of the next events.
+func (n *Notifier) SetEndpoints(endpoints []Endpoint) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	n.endpoints = endpoints
+}
+
+// Notify sends ev to the endpoints wanting it, in the background. data is
+// encoded in JSON. A nil notifier doesn't send anything.
+func (n *Notifier) Notify(ev Event, data interface{}) {
+	if n == nil {
+		return
+	}
+
+	n.lk.RLock()
+	var to []Endpoint
+	for _, e := range n.endpoints {
+		if e.wants(ev) {
+			to = append(to, e)
+		}
+	}
+	n.lk.RUnlock()
+	if len(to) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(&Notification{
+		Event: ev,
+		Node:  n.node,
+		Time:  time.Now().UTC(),
+		Data:  data,
+	})
+	if err != nil {
+		log.Errorf("encoding the %s event: %s", ev, err)
+		return
+	}
+	for _, e := range to {
+		select {
+		case n.queue <- delivery{endpoint: e, event: ev, body: body}:
+		default:
+			log.Warningf("dropping the %s event for %s, too many events waiting", ev, e.URL)
+		}
+	}
+}
+
+// Close stops sending the events, dropping those waiting.
+func (n *Notifier) Close() error {
+	n.once.Do(func() {
+		close(n.closed)
+	})
+	<-n.done
+	return nil
+}
+
+func (n *Notifier) run() {
+	defer close(n.done)
+	for {
+		select {
+		case d := <-n.queue:
+			n.deliver(d)
+		case <-n.closed:
+			return
+		}
+	}
+}
+
+// deliver POSTs d, up to Attempts times.
+func (n *Notifier) deliver(d delivery) {
+	for i := 0; i < Attempts; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(RetryDelay):
+			case <-n.closed:
+				return
+			}
+		}
+		retry, err := n.post(d)
+		if err == nil {
+			return
+		}
+		log.Warningf("sending the %s event to %s: %s", d.event, d.endpoint.URL, err)
+		if !retry {
+			return
+		}
+	}
+}
+
+// post POSTs d once, and tells whether to retry on failure.
+func (n *Notifier) post(d delivery) (bool, error) {
+	req, err := http.NewRequest("POST", d.endpoint.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(d.event))
+	if d.endpoint.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(d.endpoint.Secret, d.body))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		return false, fmt.Errorf("%s", res.Status)
+	default:
+		return true, fmt.Errorf("%s", res.Status)
+	}
+}
+
+// Sign returns the signature of body with secret, as sent in the
+// SignatureHeader header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type received struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+func newServer(t *testing.T, status ...int) (*httptest.Server, <-chan received) {
+	ch := make(chan received, 16)
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- received{
+			event:     r.Header.Get(EventHeader),
+			signature: r.Header.Get(SignatureHeader),
+			body:      body,
+		}
+		if calls < len(status) {
+			w.WriteHeader(status[calls])
+		}
+		calls++
+	}))
+	return ts, ch
+}
+
+func receive(t *testing.T, ch <-chan received) received {
+	t.Helper()
+	select {
+	case r := <-ch:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+		return received{}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ts, ch := newServer(t)
+	defer ts.Close()
+
+	n := New("QmNode", []Endpoint{{URL: ts.URL, Secret: "s3cret", Events: []Event{PinCompleted}}})
+	defer n.Close()
+
+	n.Notify(NoPeers, nil)
+	n.Notify(PinCompleted, map[string]interface{}{"Cids": []string{"QmFoo"}})
+
+	r := receive(t, ch)
+	if r.event != string(PinCompleted) {
+		t.Fatalf("expected only the wanted event, got %q", r.event)
+	}
+	if r.signature != Sign("s3cret", r.body) {
+		t.Fatalf("expected the body to be signed, got %q", r.signature)
+	}
+
+	var notif struct {
+		Event Event
+		Node  string
+		Time  time.Time
+		Data  map[string][]string
+	}
+	if err := json.Unmarshal(r.body, &notif); err != nil {
+		t.Fatal(err)
+	}
+	if notif.Event != PinCompleted || notif.Node != "QmNode" || notif.Time.IsZero() || notif.Data["Cids"][0] != "QmFoo" {
+		t.Fatalf("unexpected notification %s", r.body)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	delay := RetryDelay
+	RetryDelay = 10 * time.Millisecond
+	defer func() { RetryDelay = delay }()
+
+	ts, ch := newServer(t, http.StatusBadGateway, http.StatusOK)
+	defer ts.Close()
+
+	n := New("QmNode", []Endpoint{{URL: ts.URL}})
+	defer n.Close()
+
+	n.Notify(NoPeers, nil)
+	r := receive(t, ch)
+	if r.signature != "" {
+		t.Fatalf("expected no signature without a secret, got %q", r.signature)
+	}
+	receive(t, ch) // retried after the 502
+
+	n.Notify(IpnsPublished, nil)
+	if r := receive(t, ch); r.event != string(IpnsPublished) {
+		t.Fatalf("expected the next event once delivered, got %q", r.event)
+	}
+}
+
+func TestNotifyNil(t *testing.T) {
+	var n *Notifier
+	n.Notify(NoPeers, nil)
+}
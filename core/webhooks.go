@@ -0,0 +1,158 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	webhook "github.com/ipfs/go-ipfs/core/webhook"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+)
+
+// webhooksKey is the config key of the endpoints notified of the events of
+// the node, a list of objects. It isn't part of the config struct.
+const webhooksKey = "Webhooks"
+
+// quotaCheckInterval is the interval at which the storage used is compared
+// with the watermark, for the RepoNearingQuota events.
+var quotaCheckInterval = time.Minute
+
+// setupWebhooks notifies the endpoints of Webhooks of the events of the node.
+func (n *IpfsNode) setupWebhooks() error {
+	endpoints, err := configWebhooks(n.Repo)
+	if err != nil {
+		return err
+	}
+	n.Webhooks = webhook.New(n.Identity.Pretty(), endpoints)
+	n.OnConfigReload(webhooksKey, n.reloadWebhooks)
+
+	// the named repos share the network of their parent, which notifies
+	// its peers
+	if n.PeerHost != nil && n.parent == nil {
+		n.PeerHost.Network().Notify(noPeersNotifiee(n.Webhooks))
+	}
+	if n.StorageQuota != nil {
+		n.Process().Go(n.watchQuota)
+	}
+	return nil
+}
+
+func (n *IpfsNode) reloadWebhooks(r repo.Repo) error {
+	endpoints, err := configWebhooks(r)
+	if err != nil {
+		return err
+	}
+	n.Webhooks.SetEndpoints(endpoints)
+	return nil
+}
+
+// noPeersNotifiee returns the notifiee of a network sending a NoPeers event
+// when its last peer disconnects.
+func noPeersNotifiee(w *webhook.Notifier) inet.Notifiee {
+	// alone is set once the event is sent, so that it is sent once for the
+	// disconnections of all the connections with the last peer
+	var alone int32
+	return &inet.NotifyBundle{
+		ConnectedF: func(_ inet.Network, c inet.Conn) {
+			atomic.StoreInt32(&alone, 0)
+		},
+		DisconnectedF: func(net inet.Network, c inet.Conn) {
+			if len(net.Peers()) > 0 {
+				return
+			}
+			if atomic.CompareAndSwapInt32(&alone, 0, 1) {
+				w.Notify(webhook.NoPeers, map[string]string{
+					"LastPeer": c.RemotePeer().Pretty(),
+				})
+			}
+		},
+	}
+}
+
+// watchQuota sends a RepoNearingQuota event when the storage used goes over
+// the watermark, and again once it went back under it.
+func (n *IpfsNode) watchQuota(proc goprocess.Process) {
+	ticker := time.NewTicker(quotaCheckInterval)
+	defer ticker.Stop()
+
+	over := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-proc.Closing():
+			return
+		}
+
+		usage := n.StorageQuota.Usage()
+		max, highWater := n.StorageQuota.Limits()
+		if usage < highWater {
+			over = false
+			continue
+		}
+		if !over {
+			over = true
+			n.Webhooks.Notify(webhook.RepoNearingQuota, map[string]uint64{
+				"Usage":     usage,
+				"HighWater": highWater,
+				"Max":       max,
+			})
+		}
+	}
+}
+
+// configWebhooks reads the endpoints of Webhooks, e.g.
+// [{"URL": "https://alerts.example.com/ipfs", "Secret": "...", "Events": ["peers.none"]}].
+func configWebhooks(r repo.Repo) ([]webhook.Endpoint, error) {
+	val, err := r.GetConfigKey(webhooksKey)
+	if err != nil || val == nil {
+		return nil, nil // not set
+	}
+
+	list, ok := val.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid value for %s: expected a list of objects, got %v", webhooksKey, val)
+	}
+	out := make([]webhook.Endpoint, 0, len(list))
+	for i, v := range list {
+		entry, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s[%d]: expected an object, got %v", webhooksKey, i, v)
+		}
+
+		var e webhook.Endpoint
+		e.URL, _ = entry["URL"].(string)
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid value for %s[%d].URL: expected an http or https URL, got %v", webhooksKey, i, entry["URL"])
+		}
+		if s, ok := entry["Secret"]; ok && s != nil {
+			if e.Secret, ok = s.(string); !ok {
+				return nil, fmt.Errorf("invalid value for %s[%d].Secret: expected a string, got %v", webhooksKey, i, s)
+			}
+		}
+		events, _ := entry["Events"].([]interface{})
+		for _, v := range events {
+			ev, err := parseWebhookEvent(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s[%d].Events: %s", webhooksKey, i, err)
+			}
+			e.Events = append(e.Events, ev)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func parseWebhookEvent(v interface{}) (webhook.Event, error) {
+	s, _ := v.(string)
+	for _, ev := range webhook.Events {
+		if string(ev) == s {
+			return ev, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event %v, expected one of %v", v, webhook.Events)
+}
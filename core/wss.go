@@ -0,0 +1,98 @@
+package core
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	wss "github.com/ipfs/go-ipfs/core/wss"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	mafilter "gx/ipfs/QmQJRvWaYAvU3Mdtk33ADXr9JAZwKMBYBGPkRQBDvyj2nn/go-maddr-filter"
+	swarm "gx/ipfs/QmQdLXW5JTSsrVb3ZpnpbASRwyM8CcE4XcM5nPbN19dWLr/go-libp2p-swarm"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+)
+
+// wssServer returns the server of the secure websockets of
+// Swarm.WSS.Listen, with the certificate of Swarm.WSS.Certificate and
+// Swarm.WSS.Key, nil if Swarm.WSS.Listen isn't set. It only listens once
+// listenWSS is called.
+func wssServer(r repo.Repo) (*wss.Server, error) {
+	listen, err := configStrings(r, "Swarm.WSS.Listen")
+	if err != nil || len(listen) == 0 {
+		return nil, err
+	}
+	cert, err := loadWSSCertificate(r)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := configString(r, "Swarm.WSS.Domain")
+	if err != nil {
+		return nil, err
+	}
+	return wss.New(cert, domain), nil
+}
+
+func loadWSSCertificate(r repo.Repo) (*tls.Certificate, error) {
+	certFile, err := configString(r, "Swarm.WSS.Certificate")
+	if err != nil {
+		return nil, err
+	}
+	keyFile, err := configString(r, "Swarm.WSS.Key")
+	if err != nil {
+		return nil, err
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("Swarm.WSS.Listen needs Swarm.WSS.Certificate and Swarm.WSS.Key")
+	}
+	return wss.LoadCertificate(certFile, keyFile)
+}
+
+// listenWSS starts listening for the secure websockets, forwarded to the
+// websocket listener of the node unless the filters of the swarm block the
+// addresses they come from.
+func (n *IpfsNode) listenWSS() error {
+	listen, err := configStrings(n.Repo, "Swarm.WSS.Listen")
+	if err != nil {
+		return err
+	}
+	addrs := make([]ma.Multiaddr, len(listen))
+	for i, s := range listen {
+		addrs[i], err = ma.NewMultiaddr(s)
+		if err != nil {
+			return fmt.Errorf("invalid value for Swarm.WSS.Listen: %s", err)
+		}
+	}
+	target, err := wss.WebsocketTarget(n.PeerHost.Network().ListenAddresses())
+	if err != nil {
+		return err
+	}
+	var filters *mafilter.Filters
+	if swrm, ok := n.PeerHost.Network().(*swarm.Swarm); ok {
+		filters = swrm.Filters
+	}
+	if err := n.WSS.Listen(addrs, target, filters); err != nil {
+		return err
+	}
+	log.Infof("Swarm listening for secure websockets at: %s", n.WSS.Addrs())
+	n.OnConfigReload("Swarm.WSS", n.reloadWSSCertificate)
+	return nil
+}
+
+// reloadWSSCertificate reads the certificate of the secure websockets again,
+// such as after its renewal.
+func (n *IpfsNode) reloadWSSCertificate(r repo.Repo) error {
+	cert, err := loadWSSCertificate(r)
+	if err != nil {
+		return err
+	}
+	n.WSS.SetCertificate(cert)
+	return nil
+}
+
+// withWSSAddrs adds the addresses of the secure websockets to those of the
+// host.
+func (n *IpfsNode) withWSSAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	out := append([]ma.Multiaddr(nil), addrs...)
+	return append(out, n.WSS.Addrs()...)
+}
@@ -0,0 +1,340 @@
+// Package wss serves the websocket transport of a node over TLS, for the
+// browser peers, which can only dial secure websockets from the pages served
+// over HTTPS.
+//
+// The TLS connections accepted are terminated with the certificate given and
+// forwarded to the websocket listener of the node, which sees them as coming
+// from the loopback address. The server checks the addresses they really come
+// from with the filters of the swarm before forwarding them, and RemoteAddr
+// tells the addresses of the connections forwarded apart, e.g. for the
+// connection gater.
+package wss
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	mafilter "gx/ipfs/QmQJRvWaYAvU3Mdtk33ADXr9JAZwKMBYBGPkRQBDvyj2nn/go-maddr-filter"
+	manet "gx/ipfs/QmQVUtnrNGtCRkCMpXgpApfzQjc8FDaDVxHqWH8cnZQeh5/go-multiaddr-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("wss")
+
+// codeWSS is the code of the wss protocol of the multiaddrs.
+const codeWSS = 0x01de
+
+func init() {
+	// older multiaddr tables don't know about secure websockets
+	if ma.ProtocolWithName("wss").Code == 0 {
+		err := ma.AddProtocol(ma.Protocol{
+			Code:  codeWSS,
+			Name:  "wss",
+			VCode: ma.CodeToVarint(codeWSS),
+		})
+		if err != nil {
+			log.Errorf("registering the wss protocol: %s", err)
+		}
+	}
+}
+
+// HandshakeTimeout bounds the time of the TLS handshakes.
+var HandshakeTimeout = 10 * time.Second
+
+// ErrNoWebsocket is returned when the node has no websocket listener to
+// forward the connections to.
+var ErrNoWebsocket = errors.New("wss: the node doesn't listen on a /ws address")
+
+// LoadCertificate reads the certificate and the key of the PEM files
+// certFile and keyFile.
+func LoadCertificate(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// Server listens for secure websocket connections.
+type Server struct {
+	domain string
+
+	lk        sync.Mutex
+	cert      *tls.Certificate
+	filters   *mafilter.Filters
+	listeners []net.Listener
+	addrs     []ma.Multiaddr
+	closed    bool
+	wg        sync.WaitGroup
+
+	// the addresses the connections forwarded come from, by the address
+	// they are forwarded from
+	remotes map[string]ma.Multiaddr
+}
+
+// New returns a server not listening yet, with cert. The addresses it
+// announces are those of domain if it isn't empty, to match the name of the
+// certificate, and the addresses of the network interfaces otherwise.
+func New(cert *tls.Certificate, domain string) *Server {
+	return &Server{
+		cert:    cert,
+		domain:  domain,
+		remotes: make(map[string]ma.Multiaddr),
+	}
+}
+
+// SetCertificate replaces the certificate of the next connections, such as
+// one renewed.
+func (s *Server) SetCertificate(cert *tls.Certificate) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.cert = cert
+}
+
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.cert, nil
+}
+
+// Addrs returns the /wss addresses the server listens on, none until it
+// listens.
+func (s *Server) Addrs() []ma.Multiaddr {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.addrs
+}
+
+// WebsocketTarget returns the address the connections are forwarded to, the
+// first websocket address of listenAddrs, dialed on the loopback interface
+// if it is unspecified.
+func WebsocketTarget(listenAddrs []ma.Multiaddr) (string, error) {
+	for _, a := range listenAddrs {
+		parts := ma.Split(a)
+		if len(parts) != 3 || parts[2].String() != "/ws" {
+			continue
+		}
+		if _, err := parts[1].ValueForProtocol(ma.P_TCP); err != nil {
+			continue
+		}
+		tcp := parts[0].Encapsulate(parts[1])
+		if manet.IsIPUnspecified(tcp) {
+			loopback := "/ip4/127.0.0.1"
+			if isIP6(tcp) {
+				loopback = "/ip6/::1"
+			}
+			l, err := ma.NewMultiaddr(loopback)
+			if err != nil {
+				return "", err
+			}
+			tcp = l.Encapsulate(parts[1])
+		}
+		_, host, err := manet.DialArgs(tcp)
+		if err != nil {
+			return "", err
+		}
+		return host, nil
+	}
+	return "", ErrNoWebsocket
+}
+
+// Listen accepts the TLS connections on the TCP addresses listen, and
+// forwards them to target, a host:port, unless filters, the filters of the
+// swarm which may be nil, block the addresses they come from.
+func (s *Server) Listen(listen []ma.Multiaddr, target string, filters *mafilter.Filters) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.closed {
+		return errors.New("wss: server closed")
+	}
+	s.filters = filters
+
+	for _, a := range listen {
+		l, err := manet.Listen(a)
+		if err != nil {
+			return err
+		}
+		addrs, err := s.announced(l.Multiaddr())
+		if err != nil {
+			l.Close()
+			return err
+		}
+		tl := tls.NewListener(manet.NetListener(l), &tls.Config{
+			GetCertificate: s.getCertificate,
+		})
+		s.listeners = append(s.listeners, tl)
+		s.addrs = append(s.addrs, addrs...)
+
+		s.wg.Add(1)
+		go s.serve(tl, target)
+	}
+	return nil
+}
+
+// announced returns the /wss addresses of the TCP address listened.
+func (s *Server) announced(tcp ma.Multiaddr) ([]ma.Multiaddr, error) {
+	port, err := tcp.ValueForProtocol(ma.P_TCP)
+	if err != nil {
+		return nil, fmt.Errorf("wss: %s isn't a TCP address", tcp)
+	}
+	if s.domain != "" {
+		a, err := ma.NewMultiaddr(fmt.Sprintf("/dns4/%s/tcp/%s/wss", s.domain, port))
+		if err != nil {
+			return nil, err
+		}
+		return []ma.Multiaddr{a}, nil
+	}
+
+	hosts := []ma.Multiaddr{ma.Split(tcp)[0]}
+	if manet.IsIPUnspecified(tcp) {
+		ifaces, err := manet.InterfaceMultiaddrs()
+		if err != nil {
+			return nil, err
+		}
+		hosts = hosts[:0]
+		for _, ia := range ifaces {
+			if isIP6(ia) == isIP6(tcp) && !manet.IsIP6LinkLocal(ia) {
+				hosts = append(hosts, ia)
+			}
+		}
+	}
+
+	var out []ma.Multiaddr
+	for _, h := range hosts {
+		a, err := ma.NewMultiaddr(fmt.Sprintf("%s/tcp/%s/wss", h, port))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, nil
+}
+
+func isIP6(a ma.Multiaddr) bool {
+	_, err := a.ValueForProtocol(ma.P_IP6)
+	return err == nil
+}
+
+func (s *Server) serve(l net.Listener, target string) {
+	defer s.wg.Done()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.lk.Lock()
+			closed := s.closed
+			s.lk.Unlock()
+			if !closed {
+				log.Errorf("accepting wss connections: %s", err)
+			}
+			return
+		}
+		go s.forward(c.(*tls.Conn), target)
+	}
+}
+
+// forward copies the data of c to target and back, once the TLS handshake
+// is over, unless the filters block the address of c.
+func (s *Server) forward(c *tls.Conn, target string) {
+	defer c.Close()
+
+	remote, err := manet.FromNetAddr(c.RemoteAddr())
+	if err != nil {
+		log.Debugf("wss connection from %s: %s", c.RemoteAddr(), err)
+		return
+	}
+	s.lk.Lock()
+	filters := s.filters
+	s.lk.Unlock()
+	if filters != nil && filters.AddrBlocked(remote) {
+		log.Debugf("refusing the wss connection from %s, its address is filtered", remote)
+		return
+	}
+	wssAddr, err := ma.NewMultiaddr("/wss")
+	if err != nil {
+		return
+	}
+	remote = remote.Encapsulate(wssAddr)
+
+	c.SetDeadline(time.Now().Add(HandshakeTimeout))
+	if err := c.Handshake(); err != nil {
+		log.Debugf("wss handshake with %s: %s", c.RemoteAddr(), err)
+		return
+	}
+	c.SetDeadline(time.Time{})
+
+	t, err := net.DialTimeout("tcp", target, HandshakeTimeout)
+	if err != nil {
+		log.Errorf("forwarding a wss connection to %s: %s", target, err)
+		return
+	}
+	defer t.Close()
+
+	// the node sees the connection as coming from the local address of t,
+	// recorded before any data reaches it
+	from := t.LocalAddr().String()
+	s.lk.Lock()
+	s.remotes[from] = remote
+	s.lk.Unlock()
+	defer func() {
+		s.lk.Lock()
+		delete(s.remotes, from)
+		s.lk.Unlock()
+	}()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(t, c)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(c, t)
+		done <- struct{}{}
+	}()
+	// either side closing ends the connection
+	<-done
+}
+
+// RemoteAddr returns the address a connection of the websocket listener of
+// the node whose remote address is a comes from, a unless it was forwarded
+// by the server.
+func (s *Server) RemoteAddr(a ma.Multiaddr) ma.Multiaddr {
+	parts := ma.Split(a)
+	if len(parts) < 2 {
+		return a
+	}
+	tcp, err := manet.ToNetAddr(parts[0].Encapsulate(parts[1]))
+	if err != nil {
+		return a
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if remote, ok := s.remotes[tcp.String()]; ok {
+		return remote
+	}
+	return a
+}
+
+// Close stops listening. The connections forwarded are left open.
+func (s *Server) Close() error {
+	s.lk.Lock()
+	s.closed = true
+	listeners := s.listeners
+	s.listeners = nil
+	s.addrs = nil
+	s.lk.Unlock()
+
+	var first error
+	for _, l := range listeners {
+		if err := l.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	s.wg.Wait()
+	return first
+}
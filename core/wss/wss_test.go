@@ -0,0 +1,177 @@
+package wss
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	mafilter "gx/ipfs/QmQJRvWaYAvU3Mdtk33ADXr9JAZwKMBYBGPkRQBDvyj2nn/go-maddr-filter"
+	manet "gx/ipfs/QmQVUtnrNGtCRkCMpXgpApfzQjc8FDaDVxHqWH8cnZQeh5/go-multiaddr-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+)
+
+func selfSigned(t *testing.T) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestForward(t *testing.T) {
+	// the websocket listener of the node, echoing here
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	accepted := make(chan net.Addr, 1)
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c.RemoteAddr()
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+
+	wsAddr, err := manet.FromNetAddr(echo.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := ma.NewMultiaddr(wsAddr.String() + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := WebsocketTarget([]ma.Multiaddr{wsAddr, ws})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != echo.Addr().String() {
+		t.Fatalf("expected the websocket address, got %s", target)
+	}
+
+	s := New(selfSigned(t), "")
+	defer s.Close()
+	listen, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Listen([]ma.Multiaddr{listen}, target, nil); err != nil {
+		t.Fatal(err)
+	}
+	addrs := s.Addrs()
+	if len(addrs) != 1 {
+		t.Fatalf("expected one address, got %s", addrs)
+	}
+	parts := ma.Split(addrs[0])
+	if parts[len(parts)-1].String() != "/wss" {
+		t.Fatalf("expected a wss address, got %s", addrs[0])
+	}
+	port, err := addrs[0].ValueForProtocol(ma.P_TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := tls.Dial("tcp", "127.0.0.1:"+port, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expected the data to be forwarded, got %q", buf)
+	}
+
+	// the node can tell where the connection comes from
+	from, err := manet.FromNetAddr(<-accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := manet.FromNetAddr(c.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remote := s.RemoteAddr(from); remote.String() != local.String()+"/wss" {
+		t.Fatalf("expected the connection to come from %s/wss, got %s", local, remote)
+	}
+	if a := s.RemoteAddr(ws); !a.Equal(ws) {
+		t.Fatalf("expected the addresses not forwarded to be kept, got %s", a)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		for {
+			c, err := target.Accept()
+			if err != nil {
+				return
+			}
+			t.Errorf("expected the connection from a filtered address not to be forwarded")
+			c.Close()
+		}
+	}()
+
+	filters := mafilter.NewFilters()
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	filters.AddDialFilter(loopback)
+
+	s := New(selfSigned(t), "")
+	defer s.Close()
+	listen, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Listen([]ma.Multiaddr{listen}, target.Addr().String(), filters); err != nil {
+		t.Fatal(err)
+	}
+	port, err := s.Addrs()[0].ValueForProtocol(ma.P_TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := net.Dial("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+}
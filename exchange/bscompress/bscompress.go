@@ -0,0 +1,129 @@
+// Package bscompress compresses the streams of the protocols of a host with
+// deflate, when the remote peer supports it, falling back to uncompressed
+// streams otherwise. It's meant for the host of bitswap, to reduce the
+// bandwidth used to send blocks of text.
+package bscompress
+
+import (
+	"compress/flate"
+	"context"
+	"io"
+	"strings"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+// Prefix is prepended to the protocols to get the protocols of their
+// compressed streams.
+const Prefix = "/x/deflate"
+
+// Level is the compression level of the streams, favoring speed as most
+// blocks are small.
+var Level = flate.BestSpeed
+
+// Host is a host compressing the streams of the protocols it handles and
+// opens.
+type Host struct {
+	p2phost.Host
+}
+
+// Wrap returns a host compressing the streams of h.
+func Wrap(h p2phost.Host) *Host {
+	return &Host{Host: h}
+}
+
+func compressed(pid protocol.ID) protocol.ID {
+	return protocol.ID(Prefix) + pid
+}
+
+// SetStreamHandler handles the streams of pid, compressed or not.
+func (h *Host) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	h.Host.SetStreamHandler(pid, handler)
+	h.Host.SetStreamHandler(compressed(pid), func(s inet.Stream) {
+		cs, err := newStream(s, pid)
+		if err != nil {
+			s.Reset()
+			return
+		}
+		handler(cs)
+	})
+}
+
+func (h *Host) RemoveStreamHandler(pid protocol.ID) {
+	h.Host.RemoveStreamHandler(compressed(pid))
+	h.Host.RemoveStreamHandler(pid)
+}
+
+// NewStream opens a compressed stream to p if it supports it, and an
+// uncompressed one otherwise. The protocol of the stream returned is one of
+// pids either way.
+func (h *Host) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	all := make([]protocol.ID, 0, 2*len(pids))
+	for _, pid := range pids {
+		all = append(all, compressed(pid))
+	}
+	all = append(all, pids...)
+
+	s, err := h.Host.NewStream(ctx, p, all...)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(string(s.Protocol()), Prefix) {
+		return s, nil
+	}
+	cs, err := newStream(s, protocol.ID(strings.TrimPrefix(string(s.Protocol()), Prefix)))
+	if err != nil {
+		s.Reset()
+		return nil, err
+	}
+	return cs, nil
+}
+
+// stream compresses what is written to the stream it wraps, flushing after
+// each write, and decompresses what is read.
+type stream struct {
+	inet.Stream
+	pid protocol.ID
+	r   io.ReadCloser
+	w   *flate.Writer
+}
+
+func newStream(s inet.Stream, pid protocol.ID) (*stream, error) {
+	w, err := flate.NewWriter(s, Level)
+	if err != nil {
+		return nil, err
+	}
+	return &stream{
+		Stream: s,
+		pid:    pid,
+		r:      flate.NewReader(s),
+		w:      w,
+	}, nil
+}
+
+func (s *stream) Protocol() protocol.ID {
+	return s.pid
+}
+
+func (s *stream) Read(b []byte) (int, error) {
+	return s.r.Read(b)
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	n, err := s.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, s.w.Flush()
+}
+
+func (s *stream) Close() error {
+	if err := s.w.Close(); err != nil {
+		s.Stream.Reset()
+		return err
+	}
+	return s.Stream.Close()
+}
@@ -0,0 +1,72 @@
+package bscompress
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	mocknet "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/net/mock"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+const testProtocol = protocol.ID("/test/1.0.0")
+
+// send sends data from client to server, and checks that it's received on a
+// stream of testProtocol. It returns the stream of the client.
+func send(t *testing.T, server, client p2phost.Host, data []byte) inet.Stream {
+	received := make(chan []byte, 1)
+	server.SetStreamHandler(testProtocol, func(s inet.Stream) {
+		defer s.Close()
+		if s.Protocol() != testProtocol {
+			t.Errorf("expected the stream of the server to be of %s, got %s", testProtocol, s.Protocol())
+		}
+		b, err := ioutil.ReadAll(s)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- b
+	})
+	defer server.RemoveStreamHandler(testProtocol)
+
+	s, err := client.NewStream(context.Background(), server.ID(), testProtocol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Protocol() != testProtocol {
+		t.Errorf("expected the stream of the client to be of %s, got %s", testProtocol, s.Protocol())
+	}
+	if _, err := s.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(<-received, data) {
+		t.Error("received data doesn't match")
+	}
+	return s
+}
+
+func TestCompressedStream(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	client := Wrap(hosts[1])
+	data := []byte(strings.Repeat("text compresses well ", 1000))
+
+	if _, ok := send(t, Wrap(hosts[0]), client, data).(*stream); !ok {
+		t.Error("expected the stream to be compressed")
+	}
+	if _, ok := send(t, hosts[0], client, data).(*stream); ok {
+		t.Error("expected to fall back on an uncompressed stream")
+	}
+}
@@ -0,0 +1,130 @@
+// Package bsstats counts the bitswap messages and blocks exchanged with each
+// peer, which the bitswap ledgers don't record. The stats of a peer are
+// forgotten once it disconnects.
+package bsstats
+
+import (
+	"context"
+	"sync"
+
+	bsmsg "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/message"
+	bsnet "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/network"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+// Stats are the messages and blocks exchanged with a peer.
+type Stats struct {
+	MessagesSent     uint64
+	MessagesReceived uint64
+	BlocksSent       uint64
+	BlocksReceived   uint64
+}
+
+// Network is a bitswap network counting the messages sent and received.
+type Network struct {
+	bsnet.BitSwapNetwork
+
+	lk    sync.Mutex
+	stats map[peer.ID]*Stats
+}
+
+// Wrap returns a network counting the messages sent and received on n.
+func Wrap(n bsnet.BitSwapNetwork) *Network {
+	return &Network{
+		BitSwapNetwork: n,
+		stats:          make(map[peer.ID]*Stats),
+	}
+}
+
+// Stats returns the messages and blocks exchanged with p.
+func (n *Network) Stats(p peer.ID) Stats {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	if st, ok := n.stats[p]; ok {
+		return *st
+	}
+	return Stats{}
+}
+
+func (n *Network) sent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	st := n.get(p)
+	st.MessagesSent++
+	st.BlocksSent += uint64(len(msg.Blocks()))
+}
+
+func (n *Network) received(p peer.ID, msg bsmsg.BitSwapMessage) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	st := n.get(p)
+	st.MessagesReceived++
+	st.BlocksReceived += uint64(len(msg.Blocks()))
+}
+
+// forget drops the stats of p, so that the peers met over time don't grow the
+// stats without bound.
+func (n *Network) forget(p peer.ID) {
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	delete(n.stats, p)
+}
+
+// get returns the stats of p, n.lk must be held.
+func (n *Network) get(p peer.ID) *Stats {
+	st, ok := n.stats[p]
+	if !ok {
+		st = new(Stats)
+		n.stats[p] = st
+	}
+	return st
+}
+
+func (n *Network) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	if err := n.BitSwapNetwork.SendMessage(ctx, p, msg); err != nil {
+		return err
+	}
+	n.sent(p, msg)
+	return nil
+}
+
+func (n *Network) NewMessageSender(ctx context.Context, p peer.ID) (bsnet.MessageSender, error) {
+	s, err := n.BitSwapNetwork.NewMessageSender(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &messageSender{MessageSender: s, net: n, p: p}, nil
+}
+
+func (n *Network) SetDelegate(r bsnet.Receiver) {
+	n.BitSwapNetwork.SetDelegate(&receiver{Receiver: r, net: n})
+}
+
+type messageSender struct {
+	bsnet.MessageSender
+	net *Network
+	p   peer.ID
+}
+
+func (s *messageSender) SendMsg(ctx context.Context, msg bsmsg.BitSwapMessage) error {
+	if err := s.MessageSender.SendMsg(ctx, msg); err != nil {
+		return err
+	}
+	s.net.sent(s.p, msg)
+	return nil
+}
+
+type receiver struct {
+	bsnet.Receiver
+	net *Network
+}
+
+func (r *receiver) ReceiveMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) {
+	r.net.received(p, msg)
+	r.Receiver.ReceiveMessage(ctx, p, msg)
+}
+
+func (r *receiver) PeerDisconnected(p peer.ID) {
+	r.net.forget(p)
+	r.Receiver.PeerDisconnected(p)
+}
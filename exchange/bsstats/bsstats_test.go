@@ -0,0 +1,99 @@
+package bsstats
+
+import (
+	"context"
+	"testing"
+
+	bsmsg "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/message"
+	bsnet "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/network"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+type fakeNetwork struct {
+	bsnet.BitSwapNetwork
+	delegate bsnet.Receiver
+}
+
+func (n *fakeNetwork) SendMessage(context.Context, peer.ID, bsmsg.BitSwapMessage) error {
+	return nil
+}
+
+func (n *fakeNetwork) SetDelegate(r bsnet.Receiver) {
+	n.delegate = r
+}
+
+type fakeReceiver struct {
+	bsnet.Receiver
+	received     int
+	disconnected int
+}
+
+func (r *fakeReceiver) ReceiveMessage(context.Context, peer.ID, bsmsg.BitSwapMessage) {
+	r.received++
+}
+
+func (r *fakeReceiver) PeerDisconnected(peer.ID) {
+	r.disconnected++
+}
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	p := peer.ID("peer")
+
+	fn := new(fakeNetwork)
+	n := Wrap(fn)
+	r := new(fakeReceiver)
+	n.SetDelegate(r)
+
+	msg := bsmsg.New(false)
+	msg.AddBlock(blocks.NewBlock([]byte("a")))
+	msg.AddBlock(blocks.NewBlock([]byte("b")))
+	if err := n.SendMessage(ctx, p, msg); err != nil {
+		t.Fatal(err)
+	}
+	fn.delegate.ReceiveMessage(ctx, p, msg)
+	fn.delegate.ReceiveMessage(ctx, p, bsmsg.New(false))
+
+	if r.received != 2 {
+		t.Fatalf("expected the messages to be delivered, got %d", r.received)
+	}
+	st := n.Stats(p)
+	expected := Stats{
+		MessagesSent:     1,
+		MessagesReceived: 2,
+		BlocksSent:       2,
+		BlocksReceived:   2,
+	}
+	if st != expected {
+		t.Errorf("expected %+v, got %+v", expected, st)
+	}
+	if st := n.Stats(peer.ID("other")); st != (Stats{}) {
+		t.Errorf("expected no stats for an unknown peer, got %+v", st)
+	}
+}
+
+func TestForgetDisconnected(t *testing.T) {
+	ctx := context.Background()
+	p := peer.ID("peer")
+
+	fn := new(fakeNetwork)
+	n := Wrap(fn)
+	r := new(fakeReceiver)
+	n.SetDelegate(r)
+
+	fn.delegate.ReceiveMessage(ctx, p, bsmsg.New(false))
+	if st := n.Stats(p); st.MessagesReceived != 1 {
+		t.Fatalf("expected a message received, got %+v", st)
+	}
+	fn.delegate.PeerDisconnected(p)
+	if r.disconnected != 1 {
+		t.Fatalf("expected the disconnection to be delivered, got %d", r.disconnected)
+	}
+	if st := n.Stats(p); st != (Stats{}) {
+		t.Errorf("expected the stats to be forgotten, got %+v", st)
+	}
+	if len(n.stats) != 0 {
+		t.Errorf("expected no stats left, got %d", len(n.stats))
+	}
+}
@@ -0,0 +1,232 @@
+// Package delegate announces the content of the node to remote indexers over
+// HTTP, in batches, for the nodes storing more blocks than the DHT can keep
+// up with.
+//
+// The announcements are posted as JSON to the endpoint of the indexer, which
+// must acknowledge them with a 2xx status:
+//
+//	{"Peer": "<peer id>", "Addrs": ["<multiaddr>", ...], "Cids": ["<cid>", ...]}
+package delegate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("delegate")
+
+// MaxBatch is the maximum number of keys announced by a request.
+var MaxBatch = 1024
+
+// Timeout bounds the time of a request to an indexer.
+var Timeout = time.Minute
+
+// Announcement is the body of the requests to the indexers.
+type Announcement struct {
+	Peer  string
+	Addrs []string
+	Cids  []string
+}
+
+// Client posts announcements to the endpoint of an indexer.
+type Client struct {
+	url   string
+	self  peer.ID
+	addrs func() []ma.Multiaddr
+	http  *http.Client
+}
+
+// NewClient returns a client announcing that the peer self, listening on
+// addrs, provides content to the indexer at url.
+func NewClient(url string, self peer.ID, addrs func() []ma.Multiaddr) *Client {
+	return &Client{
+		url:   url,
+		self:  self,
+		addrs: addrs,
+		http:  &http.Client{Timeout: Timeout},
+	}
+}
+
+// Announce announces keys to the indexer, in batches of MaxBatch keys.
+func (c *Client) Announce(ctx context.Context, keys []cid.Cid) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > MaxBatch {
+			n = MaxBatch
+		}
+		if err := c.post(ctx, keys[:n]); err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+func (c *Client) post(ctx context.Context, keys []cid.Cid) error {
+	a := Announcement{
+		Peer: c.self.Pretty(),
+		Cids: make([]string, len(keys)),
+	}
+	for _, addr := range c.addrs() {
+		a.Addrs = append(a.Addrs, addr.String())
+	}
+	for i, k := range keys {
+		a.Cids[i] = k.String()
+	}
+	body, err := json.Marshal(&a)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drained so that the connection is reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("delegate: %s answered %s", c.url, resp.Status)
+	}
+	return nil
+}
+
+// Routing is a content routing announcing the keys to indexers, and to the
+// routing wrapped unless only the indexers are to be used. The other queries
+// are answered by the routing wrapped.
+type Routing struct {
+	routing.ContentRouting
+	clients []*Client
+	only    bool
+
+	requests chan *request
+}
+
+// request is a key waiting to be announced, done receives the outcome.
+type request struct {
+	key  cid.Cid
+	done chan error
+}
+
+// Wrap returns a content routing announcing the keys to the indexers of
+// clients, and with r too unless only is set, until ctx is canceled.
+func Wrap(ctx context.Context, r routing.ContentRouting, clients []*Client, only bool) *Routing {
+	dr := &Routing{
+		ContentRouting: r,
+		clients:        clients,
+		only:           only,
+		requests:       make(chan *request),
+	}
+	go dr.run(ctx)
+	return dr
+}
+
+// run announces the keys given to Provide. The keys given while a batch is
+// announced are announced together by the next one.
+func (r *Routing) run(ctx context.Context) {
+	for {
+		var batch []*request
+		select {
+		case req := <-r.requests:
+			batch = append(batch, req)
+		case <-ctx.Done():
+			return
+		}
+	collect:
+		for len(batch) < MaxBatch {
+			select {
+			case req := <-r.requests:
+				batch = append(batch, req)
+			default:
+				break collect
+			}
+		}
+
+		keys := make([]cid.Cid, len(batch))
+		for i, req := range batch {
+			keys[i] = req.key
+		}
+		err := r.announce(ctx, keys)
+		for _, req := range batch {
+			req.done <- err
+		}
+	}
+}
+
+// announce announces keys to all the indexers, returning the first error.
+func (r *Routing) announce(ctx context.Context, keys []cid.Cid) error {
+	var firstErr error
+	for _, c := range r.clients {
+		if err := c.Announce(ctx, keys); err != nil {
+			log.Debugf("announcing %d keys: %s", len(keys), err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// Provide announces c to the indexers, batched with the keys provided
+// concurrently, and to the routing wrapped.
+func (r *Routing) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	if !brdcst {
+		return r.ContentRouting.Provide(ctx, c, false)
+	}
+
+	req := &request{key: c, done: make(chan error, 1)}
+	select {
+	case r.requests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var err error
+	if !r.only {
+		err = r.ContentRouting.Provide(ctx, c, true)
+	}
+	select {
+	case derr := <-req.done:
+		if derr != nil {
+			return derr
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ProvideMany announces keys to the indexers, and to the routing wrapped one
+// at a time.
+func (r *Routing) ProvideMany(ctx context.Context, keys []cid.Cid) error {
+	if err := r.announce(ctx, keys); err != nil {
+		return err
+	}
+	if r.only {
+		return nil
+	}
+	for _, c := range keys {
+		if err := r.ContentRouting.Provide(ctx, c, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package delegate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	testutil "gx/ipfs/QmPuhRE325DR8ChNcFtgd6F1eANCHy1oohXZPpYop4xsK6/go-testutil"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	mock "gx/ipfs/QmdmWkx54g7VfVyxeG8ic84uf4G6Eq1GohuyKA3XDuJ8oC/go-ipfs-routing/mock"
+)
+
+// indexer records the announcements it receives.
+type indexer struct {
+	lk    sync.Mutex
+	posts []Announcement
+	fail  bool
+}
+
+func (ix *indexer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var a Announcement
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ix.lk.Lock()
+	defer ix.lk.Unlock()
+	if ix.fail {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		return
+	}
+	ix.posts = append(ix.posts, a)
+}
+
+func (ix *indexer) announced() map[string]bool {
+	ix.lk.Lock()
+	defer ix.lk.Unlock()
+	out := make(map[string]bool)
+	for _, a := range ix.posts {
+		for _, c := range a.Cids {
+			out[c] = true
+		}
+	}
+	return out
+}
+
+func testKeys(n int) []cid.Cid {
+	keys := make([]cid.Cid, n)
+	for i := range keys {
+		keys[i] = blocks.NewBlock([]byte{byte(i), byte(i >> 8)}).Cid()
+	}
+	return keys
+}
+
+func TestClientBatches(t *testing.T) {
+	defer func(max int) { MaxBatch = max }(MaxBatch)
+	MaxBatch = 4
+
+	ix := &indexer{}
+	srv := httptest.NewServer(ix)
+	defer srv.Close()
+
+	id := testutil.RandIdentityOrFatal(t)
+	addr, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/4001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(srv.URL, id.ID(), func() []ma.Multiaddr { return []ma.Multiaddr{addr} })
+
+	keys := testKeys(10)
+	if err := c.Announce(context.Background(), keys); err != nil {
+		t.Fatal(err)
+	}
+	if len(ix.posts) != 3 {
+		t.Fatalf("expected 3 requests of at most 4 keys, got %d", len(ix.posts))
+	}
+	a := ix.posts[0]
+	if a.Peer != id.ID().Pretty() || len(a.Addrs) != 1 || a.Addrs[0] != addr.String() {
+		t.Fatalf("expected the announcement of the peer and its addresses, got %+v", a)
+	}
+	if got := ix.announced(); len(got) != len(keys) {
+		t.Fatalf("expected %d keys announced, got %d", len(keys), len(got))
+	}
+
+	ix.fail = true
+	if err := c.Announce(context.Background(), keys[:1]); err == nil {
+		t.Fatal("expected the error of the indexer")
+	}
+}
+
+func TestRouting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ix := &indexer{}
+	srv := httptest.NewServer(ix)
+	defer srv.Close()
+
+	mrserv := mock.NewServer()
+	idA := testutil.RandIdentityOrFatal(t)
+	clA := mrserv.Client(idA)
+	clB := mrserv.Client(testutil.RandIdentityOrFatal(t))
+	noAddrs := func() []ma.Multiaddr { return nil }
+
+	keys := testKeys(8)
+	r := Wrap(ctx, clA, []*Client{NewClient(srv.URL, idA.ID(), noAddrs)}, false)
+	var wg sync.WaitGroup
+	for _, k := range keys[:4] {
+		wg.Add(1)
+		go func(k cid.Cid) {
+			defer wg.Done()
+			if err := r.Provide(ctx, k, true); err != nil {
+				t.Error(err)
+			}
+		}(k)
+	}
+	wg.Wait()
+	if err := r.ProvideMany(ctx, keys[4:6]); err != nil {
+		t.Fatal(err)
+	}
+
+	only := Wrap(ctx, clA, []*Client{NewClient(srv.URL, idA.ID(), noAddrs)}, true)
+	if err := only.ProvideMany(ctx, keys[6:]); err != nil {
+		t.Fatal(err)
+	}
+
+	announced := ix.announced()
+	for i, k := range keys {
+		if !announced[k.String()] {
+			t.Fatalf("expected key %d to be announced to the indexer", i)
+		}
+		var provs []pstore.PeerInfo
+		for p := range clB.FindProvidersAsync(ctx, k, 1) {
+			provs = append(provs, p)
+		}
+		if dht := i < 6; dht != (len(provs) > 0) {
+			t.Fatalf("expected key %d to be provided to the routing wrapped: %t, got %d providers", i, dht, len(provs))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package peerfilter restricts the peers the exchanges serve blocks to.
+package peerfilter
+
+import (
+	"context"
+
+	bsmsg "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/message"
+	bsnet "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/network"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("peerfilter")
+
+// Filter decides which peers are served blocks.
+type Filter struct {
+	allow map[peer.ID]struct{}
+	deny  map[peer.ID]struct{}
+}
+
+// New returns a filter allowing the peers of allow, or all the peers if it's
+// empty, except the peers of deny.
+func New(allow, deny []peer.ID) *Filter {
+	f := &Filter{deny: make(map[peer.ID]struct{}, len(deny))}
+	if len(allow) > 0 {
+		f.allow = make(map[peer.ID]struct{}, len(allow))
+		for _, p := range allow {
+			f.allow[p] = struct{}{}
+		}
+	}
+	for _, p := range deny {
+		f.deny[p] = struct{}{}
+	}
+	return f
+}
+
+// Allowed returns true if p may be served blocks. A nil filter allows all
+// the peers.
+func (f *Filter) Allowed(p peer.ID) bool {
+	if f == nil {
+		return true
+	}
+	if _, ok := f.deny[p]; ok {
+		return false
+	}
+	if f.allow == nil {
+		return true
+	}
+	_, ok := f.allow[p]
+	return ok
+}
+
+// Network is a bitswap network dropping the wants of the peers the filter
+// doesn't allow, so that bitswap never sends them blocks. The blocks they
+// send are still received.
+type Network struct {
+	bsnet.BitSwapNetwork
+	f *Filter
+}
+
+// Wrap returns a network applying f to the messages received on n.
+func Wrap(n bsnet.BitSwapNetwork, f *Filter) *Network {
+	return &Network{BitSwapNetwork: n, f: f}
+}
+
+func (n *Network) SetDelegate(r bsnet.Receiver) {
+	n.BitSwapNetwork.SetDelegate(&receiver{Receiver: r, f: n.f})
+}
+
+type receiver struct {
+	bsnet.Receiver
+	f *Filter
+}
+
+func (r *receiver) ReceiveMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) {
+	if r.f.Allowed(p) {
+		r.Receiver.ReceiveMessage(ctx, p, msg)
+		return
+	}
+	if len(msg.Wantlist()) > 0 {
+		log.Debugf("ignoring the wants of %s", p)
+	}
+
+	blks := msg.Blocks()
+	if len(blks) == 0 {
+		return
+	}
+	out := bsmsg.New(false)
+	for _, b := range blks {
+		out.AddBlock(b)
+	}
+	r.Receiver.ReceiveMessage(ctx, p, out)
+}
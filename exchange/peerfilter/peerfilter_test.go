@@ -0,0 +1,78 @@
+package peerfilter
+
+import (
+	"context"
+	"testing"
+
+	bsmsg "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/message"
+	bsnet "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/network"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+type fakeNetwork struct {
+	bsnet.BitSwapNetwork
+	delegate bsnet.Receiver
+}
+
+func (n *fakeNetwork) SetDelegate(r bsnet.Receiver) {
+	n.delegate = r
+}
+
+type fakeReceiver struct {
+	bsnet.Receiver
+	received []bsmsg.BitSwapMessage
+}
+
+func (r *fakeReceiver) ReceiveMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) {
+	r.received = append(r.received, msg)
+}
+
+func TestFilter(t *testing.T) {
+	a, b, c := peer.ID("a"), peer.ID("b"), peer.ID("c")
+
+	var f *Filter
+	if !f.Allowed(a) {
+		t.Error("expected a nil filter to allow all the peers")
+	}
+
+	f = New(nil, []peer.ID{a})
+	if f.Allowed(a) || !f.Allowed(b) {
+		t.Error("expected only the denied peer to be refused")
+	}
+
+	f = New([]peer.ID{a, b}, []peer.ID{b})
+	if !f.Allowed(a) || f.Allowed(b) || f.Allowed(c) {
+		t.Error("expected only the allowed peers not denied to be allowed")
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	ctx := context.Background()
+	allowed, denied := peer.ID("allowed"), peer.ID("denied")
+
+	fn := new(fakeNetwork)
+	r := new(fakeReceiver)
+	Wrap(fn, New(nil, []peer.ID{denied})).SetDelegate(r)
+
+	blk := blocks.NewBlock([]byte("block"))
+	want := bsmsg.New(false)
+	want.AddEntry(blk.Cid(), 1)
+
+	fn.delegate.ReceiveMessage(ctx, allowed, want)
+	fn.delegate.ReceiveMessage(ctx, denied, want)
+	if len(r.received) != 1 || len(r.received[0].Wantlist()) != 1 {
+		t.Fatal("expected only the wants of the allowed peer to be delivered")
+	}
+
+	both := bsmsg.New(false)
+	both.AddEntry(blk.Cid(), 1)
+	both.AddBlock(blk)
+	fn.delegate.ReceiveMessage(ctx, denied, both)
+	if len(r.received) != 2 {
+		t.Fatal("expected the blocks of the denied peer to be delivered")
+	}
+	if msg := r.received[1]; len(msg.Wantlist()) != 0 || len(msg.Blocks()) != 1 {
+		t.Errorf("expected only the blocks, got %d wants and %d blocks", len(msg.Wantlist()), len(msg.Blocks()))
+	}
+}
@@ -0,0 +1,308 @@
+// Package priority lets the callers fetching blocks hint how urgently they
+// need them, so that the fetches in the background don't slow down the
+// fetches a user is waiting for.
+//
+// The priority is carried by the context of the fetches. The exchange records
+// the priority of the blocks wanted, and the bitswap network returned by
+// WrapNetwork sets the priorities of the wants sent to the providers
+// accordingly, so that they send the more urgent blocks first. The fetches
+// never wait for each other.
+package priority
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	exchange "gx/ipfs/QmP2g3VxmC7g7fyRJDj1VJ72KHZbJ9UW24YjSWEj1XTb4H/go-ipfs-exchange-interface"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bsmsg "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/message"
+	bsnet "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/network"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+// Priority is how urgently blocks are needed.
+type Priority int
+
+const (
+	// Background is the priority of the fetches nobody is waiting for, e.g.
+	// pinning
+	Background Priority = iota - 1
+
+	// Normal is the priority of the fetches without any hint
+	Normal
+
+	// Interactive is the priority of the fetches a user is waiting for, e.g.
+	// the reads of the gateway
+	Interactive
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Background:
+		return "background"
+	case Normal:
+		return "normal"
+	case Interactive:
+		return "interactive"
+	default:
+		return fmt.Sprintf("priority(%d)", int(p))
+	}
+}
+
+// Parse parses the name of a priority, "interactive", "normal" or
+// "background".
+func Parse(s string) (Priority, error) {
+	for p := Background; p <= Interactive; p++ {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return Normal, fmt.Errorf("unknown priority %q, expected interactive, normal or background", s)
+}
+
+type ctxKey struct{}
+
+// WithPriority returns a context whose fetches have priority p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// WithDefault returns a context whose fetches have priority p, unless ctx
+// already sets their priority.
+func WithDefault(ctx context.Context, p Priority) context.Context {
+	if _, ok := ctx.Value(ctxKey{}).(Priority); ok {
+		return ctx
+	}
+	return WithPriority(ctx, p)
+}
+
+// FromContext returns the priority of the fetches of ctx, Normal if it wasn't
+// set.
+func FromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(ctxKey{}).(Priority); ok && p >= Background && p <= Interactive {
+		return p
+	}
+	return Normal
+}
+
+// Wants are the priorities of the blocks being fetched.
+type Wants struct {
+	lk    sync.Mutex
+	wants map[cid.Cid]*[Interactive - Background + 1]int
+}
+
+// NewWants returns the priorities of the blocks fetched by an exchange, see
+// Wrap and WrapNetwork.
+func NewWants() *Wants {
+	return &Wants{wants: make(map[cid.Cid]*[Interactive - Background + 1]int)}
+}
+
+func (w *Wants) add(p Priority, cs ...cid.Cid) {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	for _, c := range cs {
+		counts, ok := w.wants[c]
+		if !ok {
+			counts = new([Interactive - Background + 1]int)
+			w.wants[c] = counts
+		}
+		counts[p-Background]++
+	}
+}
+
+func (w *Wants) remove(p Priority, cs ...cid.Cid) {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	for _, c := range cs {
+		counts, ok := w.wants[c]
+		if !ok {
+			continue
+		}
+		counts[p-Background]--
+		if *counts == [Interactive - Background + 1]int{} {
+			delete(w.wants, c)
+		}
+	}
+}
+
+// Priority returns the highest priority of the fetches of c in flight,
+// Normal if there are none.
+func (w *Wants) Priority(c cid.Cid) Priority {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	counts, ok := w.wants[c]
+	if !ok {
+		return Normal
+	}
+	for p := Interactive; p > Background; p-- {
+		if counts[p-Background] > 0 {
+			return p
+		}
+	}
+	return Background
+}
+
+// Exchange is an exchange recording the priorities of the blocks it fetches.
+type Exchange struct {
+	exchange.Interface
+	wants *Wants
+}
+
+// Wrap returns an exchange recording the priorities of the fetches of e in
+// wants, or in wants of its own if wants is nil.
+func Wrap(e exchange.Interface, wants *Wants) *Exchange {
+	if wants == nil {
+		wants = NewWants()
+	}
+	return &Exchange{Interface: e, wants: wants}
+}
+
+// Wants returns the priorities of the blocks being fetched.
+func (e *Exchange) Wants() *Wants {
+	return e.wants
+}
+
+func (e *Exchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return e.getBlock(ctx, e.Interface, c)
+}
+
+func (e *Exchange) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	return e.getBlocks(ctx, e.Interface, cids)
+}
+
+// NewSession returns a session recording the priorities of its fetches, if
+// the exchange supports sessions.
+func (e *Exchange) NewSession(ctx context.Context) exchange.Fetcher {
+	se, ok := e.Interface.(exchange.SessionExchange)
+	if !ok {
+		return e
+	}
+	return &fetcher{f: se.NewSession(ctx), e: e}
+}
+
+type fetcher struct {
+	f exchange.Fetcher
+	e *Exchange
+}
+
+func (f *fetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return f.e.getBlock(ctx, f.f, c)
+}
+
+func (f *fetcher) GetBlocks(ctx context.Context, cids []cid.Cid) (<-chan blocks.Block, error) {
+	return f.e.getBlocks(ctx, f.f, cids)
+}
+
+func (e *Exchange) getBlock(ctx context.Context, f exchange.Fetcher, c cid.Cid) (blocks.Block, error) {
+	p := FromContext(ctx)
+	e.wants.add(p, c)
+	defer e.wants.remove(p, c)
+	return f.GetBlock(ctx, c)
+}
+
+func (e *Exchange) getBlocks(ctx context.Context, f exchange.Fetcher, cids []cid.Cid) (<-chan blocks.Block, error) {
+	p := FromContext(ctx)
+	pending := cid.NewSet()
+	for _, c := range cids {
+		pending.Add(c)
+	}
+
+	e.wants.add(p, pending.Keys()...)
+	in, err := f.GetBlocks(ctx, cids)
+	if err != nil {
+		e.wants.remove(p, pending.Keys()...)
+		return nil, err
+	}
+
+	out := make(chan blocks.Block)
+	go func() {
+		defer func() {
+			e.wants.remove(p, pending.Keys()...)
+		}()
+		defer close(out)
+		for blk := range in {
+			if pending.Has(blk.Cid()) {
+				pending.Remove(blk.Cid())
+				e.wants.remove(p, blk.Cid())
+			}
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// The bitswap priorities of the wants of each priority are in a band of
+// bandSize priorities: bitswap gives the wants of a fetch decreasing
+// priorities from maxPriority, whose rank is kept in the band of the priority
+// of the fetch.
+const (
+	maxPriority = math.MaxInt32
+	bandSize    = 1 << 29
+)
+
+// wantPriority returns the bitswap priority of a want of priority p, whose
+// bitswap priority was prio.
+func wantPriority(p Priority, prio int) int {
+	var rank int
+	if prio > maxPriority-bandSize {
+		rank = maxPriority - prio
+	} else if prio >= 0 {
+		// already in a band, e.g. the messages sent to several peers
+		rank = bandSize - 1 - prio%bandSize
+	}
+	return (int(p-Background)+1)*bandSize - 1 - rank
+}
+
+// Network is a bitswap network setting the priorities of the wants sent
+// according to the priorities of their fetches, so that the providers send
+// the blocks wanted interactively before the others.
+type Network struct {
+	bsnet.BitSwapNetwork
+	wants *Wants
+}
+
+// WrapNetwork returns a network setting the priorities of the wants sent on
+// n from wants.
+func WrapNetwork(n bsnet.BitSwapNetwork, wants *Wants) *Network {
+	return &Network{BitSwapNetwork: n, wants: wants}
+}
+
+// prioritize sets the priorities of the wants of msg.
+func (n *Network) prioritize(msg bsmsg.BitSwapMessage) {
+	for _, e := range msg.Wantlist() {
+		if e.Cancel {
+			continue
+		}
+		msg.AddEntry(e.Cid, wantPriority(n.wants.Priority(e.Cid), e.Priority))
+	}
+}
+
+func (n *Network) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	n.prioritize(msg)
+	return n.BitSwapNetwork.SendMessage(ctx, p, msg)
+}
+
+func (n *Network) NewMessageSender(ctx context.Context, p peer.ID) (bsnet.MessageSender, error) {
+	s, err := n.BitSwapNetwork.NewMessageSender(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &messageSender{MessageSender: s, net: n}, nil
+}
+
+type messageSender struct {
+	bsnet.MessageSender
+	net *Network
+}
+
+func (s *messageSender) SendMsg(ctx context.Context, msg bsmsg.BitSwapMessage) error {
+	s.net.prioritize(msg)
+	return s.MessageSender.SendMsg(ctx, msg)
+}
@@ -0,0 +1,181 @@
+package priority
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	exchange "gx/ipfs/QmP2g3VxmC7g7fyRJDj1VJ72KHZbJ9UW24YjSWEj1XTb4H/go-ipfs-exchange-interface"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bsmsg "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/message"
+	bsnet "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap/network"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+// blockingExchange returns the blocks once released.
+type blockingExchange struct {
+	exchange.Interface
+	release chan struct{}
+}
+
+func (e *blockingExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	select {
+	case <-e.release:
+		return blocks.NewBlock([]byte("block")), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fakeNetwork records the messages sent.
+type fakeNetwork struct {
+	bsnet.BitSwapNetwork
+	sent []bsmsg.BitSwapMessage
+}
+
+func (n *fakeNetwork) SendMessage(ctx context.Context, p peer.ID, msg bsmsg.BitSwapMessage) error {
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	if p := FromContext(ctx); p != Normal {
+		t.Errorf("expected the default priority to be normal, got %s", p)
+	}
+	if p := FromContext(WithPriority(ctx, Background)); p != Background {
+		t.Errorf("expected the background priority, got %s", p)
+	}
+	if p := FromContext(WithDefault(WithPriority(ctx, Interactive), Background)); p != Interactive {
+		t.Errorf("expected the default not to override the priority set, got %s", p)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for p := Background; p <= Interactive; p++ {
+		if out, err := Parse(p.String()); err != nil || out != p {
+			t.Errorf("expected %s to parse, got %s, %v", p, out, err)
+		}
+	}
+	if _, err := Parse("urgent"); err == nil {
+		t.Error("expected an unknown priority to be refused")
+	}
+}
+
+func TestFetchesDontWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	be := &blockingExchange{release: make(chan struct{})}
+	e := Wrap(be, nil)
+	c := blocks.NewBlock([]byte("block")).Cid()
+
+	done := make(chan struct{})
+	for _, p := range []Priority{Background, Normal, Interactive} {
+		go func(p Priority) {
+			e.GetBlock(WithPriority(ctx, p), c)
+			done <- struct{}{}
+		}(p)
+	}
+	waitFor(t, func() bool { return e.Wants().Priority(c) == Interactive })
+
+	close(be.release)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	if p := e.Wants().Priority(c); p != Normal {
+		t.Errorf("expected no want left, got %s", p)
+	}
+}
+
+func TestWants(t *testing.T) {
+	w := NewWants()
+	c := blocks.NewBlock([]byte("block")).Cid()
+
+	w.add(Background, c)
+	if p := w.Priority(c); p != Background {
+		t.Errorf("expected the background priority, got %s", p)
+	}
+	w.add(Interactive, c)
+	w.add(Interactive, c)
+	w.remove(Interactive, c)
+	if p := w.Priority(c); p != Interactive {
+		t.Errorf("expected the interactive priority, got %s", p)
+	}
+	w.remove(Interactive, c)
+	w.remove(Background, c)
+	if len(w.wants) != 0 {
+		t.Errorf("expected the wants to be removed, got %d", len(w.wants))
+	}
+}
+
+func TestWantPriority(t *testing.T) {
+	first, later := math.MaxInt32, math.MaxInt32-100
+	for p := Background; p < Interactive; p++ {
+		if wantPriority(p, first) >= wantPriority(p+1, later) {
+			t.Errorf("expected the wants of %s to come after those of %s", p, p+1)
+		}
+	}
+	for p := Background; p <= Interactive; p++ {
+		a, b := wantPriority(p, first), wantPriority(p, later)
+		if a <= b {
+			t.Errorf("expected the order of the wants of %s to be kept", p)
+		}
+		if wantPriority(p, a) != a || wantPriority(p, b) != b {
+			t.Errorf("expected the priorities of %s to be kept once set", p)
+		}
+		if wantPriority(Interactive, a) != wantPriority(Interactive, first) {
+			t.Errorf("expected the rank of a want of %s to be kept by another priority", p)
+		}
+		if a <= 0 || a > math.MaxInt32 {
+			t.Errorf("expected a positive int32 priority, got %d", a)
+		}
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	ctx := context.Background()
+	w := NewWants()
+	fn := new(fakeNetwork)
+	n := WrapNetwork(fn, w)
+
+	bg, ia := blocks.NewBlock([]byte("background")).Cid(), blocks.NewBlock([]byte("interactive")).Cid()
+	w.add(Background, bg)
+	w.add(Interactive, ia)
+
+	msg := bsmsg.New(false)
+	msg.AddEntry(bg, math.MaxInt32)
+	msg.AddEntry(ia, math.MaxInt32-1)
+	msg.Cancel(blocks.NewBlock([]byte("cancelled")).Cid())
+	if err := n.SendMessage(ctx, peer.ID("a"), msg); err != nil {
+		t.Fatal(err)
+	}
+
+	prios := make(map[cid.Cid]int)
+	cancels := 0
+	for _, e := range fn.sent[0].Wantlist() {
+		if e.Cancel {
+			cancels++
+			continue
+		}
+		prios[e.Cid] = e.Priority
+	}
+	if cancels != 1 {
+		t.Errorf("expected the cancel to be sent, got %d", cancels)
+	}
+	if prios[ia] <= prios[bg] {
+		t.Errorf("expected the interactive want first, got %d <= %d", prios[ia], prios[bg])
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,281 @@
+// Package providequeue tracks the blocks added to the node until they are
+// announced to the routing system, which bitswap doesn't expose: its provide
+// queue only reports its length.
+package providequeue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	exchange "gx/ipfs/QmP2g3VxmC7g7fyRJDj1VJ72KHZbJ9UW24YjSWEj1XTb4H/go-ipfs-exchange-interface"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("providequeue")
+
+// MaxPending bounds the number of blocks tracked until they are announced.
+// The blocks added once it's reached are announced all the same, but their
+// state is unknown.
+var MaxPending = 1 << 16
+
+// MaxProvided is the number of blocks announced last remembered.
+var MaxProvided = 4096
+
+// State is where a block stands in the queue.
+type State int
+
+const (
+	// Unknown is the state of the blocks which weren't added since the node
+	// started, or were announced too long ago to be remembered
+	Unknown State = iota
+
+	// Pending is the state of the blocks added and not announced yet
+	Pending
+
+	// Provided is the state of the blocks announced
+	Provided
+)
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Provided:
+		return "provided"
+	default:
+		return "unknown"
+	}
+}
+
+// Entry is a block tracked by the queue.
+type Entry struct {
+	Cid   cid.Cid
+	State State
+
+	// Since is the time the block was added
+	Since time.Time
+
+	// Attempts counts the failed announcements of the block, LastErr is the
+	// error of the last one
+	Attempts int
+	LastErr  error
+
+	// ProvidedAt is the time the block was announced
+	ProvidedAt time.Time
+}
+
+// Tracker records the blocks added to the node and the outcome of their
+// announcements.
+type Tracker struct {
+	lk      sync.Mutex
+	pending map[cid.Cid]*Entry
+
+	// provided holds the blocks announced last, recent their order with the
+	// oldest first
+	provided map[cid.Cid]*Entry
+	recent   []cid.Cid
+
+	// untracked counts the blocks added while MaxPending blocks were pending
+	untracked uint64
+
+	// allow returns false for the blocks never announced, nil if they all are
+	allow func(cid.Cid) bool
+}
+
+// New returns an empty tracker. The blocks for which allow returns false are
+// never announced and aren't tracked, allow may be nil if all the blocks are
+// announced.
+func New(allow func(cid.Cid) bool) *Tracker {
+	return &Tracker{
+		pending:  make(map[cid.Cid]*Entry),
+		provided: make(map[cid.Cid]*Entry),
+		allow:    allow,
+	}
+}
+
+// Added records c as waiting to be announced.
+func (t *Tracker) Added(c cid.Cid) {
+	t.add(c, time.Now())
+}
+
+// Restore records c as waiting to be announced since the time since, for the
+// blocks queued before the node restarted.
+func (t *Tracker) Restore(c cid.Cid, since time.Time) {
+	t.add(c, since)
+}
+
+func (t *Tracker) add(c cid.Cid, since time.Time) {
+	if t.allow != nil && !t.allow(c) {
+		return
+	}
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if _, ok := t.pending[c]; ok {
+		return
+	}
+	if len(t.pending) >= MaxPending {
+		if t.untracked == 0 {
+			log.Warningf("more than %d blocks waiting to be announced, not tracking the next ones", MaxPending)
+		}
+		t.untracked++
+		return
+	}
+	t.pending[c] = &Entry{Cid: c, State: Pending, Since: since}
+}
+
+// Attempted records the outcome of an announcement of c.
+func (t *Tracker) Attempted(c cid.Cid, err error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	e, ok := t.pending[c]
+	if err != nil {
+		if ok {
+			e.Attempts++
+			e.LastErr = err
+		}
+		return
+	}
+
+	if !ok {
+		// the blocks not added since the node started are reprovided or
+		// were received, they aren't tracked
+		if e, ok = t.provided[c]; ok {
+			e.ProvidedAt = time.Now()
+		}
+		return
+	}
+	delete(t.pending, c)
+	e.State = Provided
+	e.ProvidedAt = time.Now()
+	t.remember(e)
+}
+
+// remember adds e to the blocks announced last, t.lk must be held.
+func (t *Tracker) remember(e *Entry) {
+	if _, ok := t.provided[e.Cid]; ok {
+		t.provided[e.Cid] = e
+		return
+	}
+	if MaxProvided <= 0 {
+		return
+	}
+	for len(t.recent) >= MaxProvided {
+		delete(t.provided, t.recent[0])
+		t.recent = t.recent[1:]
+	}
+	t.provided[e.Cid] = e
+	t.recent = append(t.recent, e.Cid)
+}
+
+// Pending returns the blocks waiting to be announced, the oldest first.
+func (t *Tracker) Pending() []Entry {
+	t.lk.Lock()
+	out := make([]Entry, 0, len(t.pending))
+	for _, e := range t.pending {
+		out = append(out, *e)
+	}
+	t.lk.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Since.Before(out[j].Since)
+	})
+	return out
+}
+
+// Status returns the entry of c, of state Unknown if c isn't tracked.
+func (t *Tracker) Status(c cid.Cid) Entry {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if e, ok := t.pending[c]; ok {
+		return *e
+	}
+	if e, ok := t.provided[c]; ok {
+		return *e
+	}
+	return Entry{Cid: c}
+}
+
+// Untracked returns the number of blocks which were added while MaxPending
+// blocks were waiting to be announced.
+func (t *Tracker) Untracked() uint64 {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	return t.untracked
+}
+
+// Exchange is an exchange recording the blocks it's given as waiting to be
+// announced.
+type Exchange struct {
+	exchange.Interface
+	t *Tracker
+}
+
+// WrapExchange returns an exchange recording the blocks given to e in t.
+func WrapExchange(e exchange.Interface, t *Tracker) *Exchange {
+	return &Exchange{Interface: e, t: t}
+}
+
+func (e *Exchange) HasBlock(b blocks.Block) error {
+	// recorded first, so that the announcement can't be over before
+	e.t.Added(b.Cid())
+	return e.Interface.HasBlock(b)
+}
+
+// NewSession returns a session of the exchange wrapped, if it supports
+// sessions.
+func (e *Exchange) NewSession(ctx context.Context) exchange.Fetcher {
+	se, ok := e.Interface.(exchange.SessionExchange)
+	if !ok {
+		return e
+	}
+	return se.NewSession(ctx)
+}
+
+// Routing is a content routing recording the outcome of the announcements.
+type Routing struct {
+	routing.ContentRouting
+	t *Tracker
+}
+
+// batchProvider is a content routing announcing many keys at once, see
+// reprovide.BatchProvider.
+type batchProvider interface {
+	ProvideMany(ctx context.Context, keys []cid.Cid) error
+}
+
+// batchRouting is a Routing wrapping a batchProvider.
+type batchRouting struct {
+	*Routing
+	bp batchProvider
+}
+
+// WrapRouting returns a content routing recording the outcome of the
+// announcements made with r in t. It announces many keys at once if r does.
+func WrapRouting(r routing.ContentRouting, t *Tracker) routing.ContentRouting {
+	rt := &Routing{ContentRouting: r, t: t}
+	if bp, ok := r.(batchProvider); ok {
+		return &batchRouting{Routing: rt, bp: bp}
+	}
+	return rt
+}
+
+func (r *Routing) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	err := r.ContentRouting.Provide(ctx, c, brdcst)
+	if brdcst {
+		r.t.Attempted(c, err)
+	}
+	return err
+}
+
+func (r *batchRouting) ProvideMany(ctx context.Context, keys []cid.Cid) error {
+	err := r.bp.ProvideMany(ctx, keys)
+	for _, c := range keys {
+		r.t.Attempted(c, err)
+	}
+	return err
+}
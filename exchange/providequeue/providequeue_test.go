@@ -0,0 +1,103 @@
+package providequeue
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+// failingRouting fails to announce the blocks of fail.
+type failingRouting struct {
+	routing.ContentRouting
+	fail map[cid.Cid]bool
+}
+
+func (r *failingRouting) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	if r.fail[c] {
+		return errors.New("no peers")
+	}
+	return nil
+}
+
+func TestTracker(t *testing.T) {
+	a := blocks.NewBlock([]byte("a"))
+	b := blocks.NewBlock([]byte("b"))
+	c := blocks.NewBlock([]byte("c"))
+
+	tr := New(nil)
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	ex := WrapExchange(offline.Exchange(bs), tr)
+	for _, blk := range []blocks.Block{a, b} {
+		if err := ex.HasBlock(blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rt := &failingRouting{fail: map[cid.Cid]bool{b.Cid(): true}}
+	r := WrapRouting(rt, tr)
+	ctx := context.Background()
+	for _, blk := range []blocks.Block{a, b, c} {
+		r.Provide(ctx, blk.Cid(), true)
+	}
+	r.Provide(ctx, b.Cid(), true)
+
+	pending := tr.Pending()
+	if len(pending) != 1 || !pending[0].Cid.Equals(b.Cid()) {
+		t.Fatalf("expected b to be pending, got %v", pending)
+	}
+	if e := pending[0]; e.State != Pending || e.Attempts != 2 || e.LastErr == nil {
+		t.Fatalf("expected b to have failed twice, got %+v", e)
+	}
+	if st := tr.Status(a.Cid()); st.State != Provided || st.ProvidedAt.IsZero() {
+		t.Fatalf("expected a to be provided, got %+v", st)
+	}
+	if st := tr.Status(c.Cid()); st.State != Unknown {
+		t.Fatalf("expected c, which wasn't added, to be unknown, got %s", st.State)
+	}
+
+	delete(rt.fail, b.Cid())
+	r.Provide(ctx, b.Cid(), true)
+	if pending := tr.Pending(); len(pending) != 0 {
+		t.Fatalf("expected no block pending, got %v", pending)
+	}
+	if st := tr.Status(b.Cid()); st.State != Provided || st.Attempts != 2 {
+		t.Fatalf("expected b to be provided after two failures, got %+v", st)
+	}
+}
+
+func TestTrackerLimits(t *testing.T) {
+	defer func(pending, provided int) {
+		MaxPending, MaxProvided = pending, provided
+	}(MaxPending, MaxProvided)
+	MaxPending, MaxProvided = 2, 1
+
+	var keys []cid.Cid
+	for _, s := range []string{"a", "b", "c"} {
+		keys = append(keys, blocks.NewBlock([]byte(s)).Cid())
+	}
+
+	tr := New(nil)
+	for _, k := range keys {
+		tr.Added(k)
+	}
+	if n := len(tr.Pending()); n != 2 || tr.Untracked() != 1 {
+		t.Fatalf("expected 2 blocks pending and 1 untracked, got %d and %d", n, tr.Untracked())
+	}
+
+	tr.Attempted(keys[0], nil)
+	tr.Attempted(keys[1], nil)
+	if st := tr.Status(keys[0]); st.State != Unknown {
+		t.Fatalf("expected the first block provided to be forgotten, got %s", st.State)
+	}
+	if st := tr.Status(keys[1]); st.State != Provided {
+		t.Fatalf("expected the last block provided to be remembered, got %s", st.State)
+	}
+}
@@ -0,0 +1,438 @@
+// Package provider announces the blocks added to the node from a queue
+// persisted in the datastore, so that the announcements survive restarts.
+//
+// The keys are announced in batches of keys of the same region of the DHT
+// keyspace, which the lookups of the DHT reach through the same peers, and
+// as many at once as the latency of the routing system allows: fewer when
+// the announcements slow down or fail, more while they are fast.
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsns "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/namespace"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+var log = logging.Logger("provider")
+
+// QueuePrefix is the namespace of the queue in the datastore.
+var QueuePrefix = ds.NewKey("provide-queue")
+
+var (
+	// BatchSize is the number of keys taken from the queue at once
+	BatchSize = 1024
+
+	// RegionBits is the number of bits of the DHT keyspace telling the
+	// regions apart
+	RegionBits uint = 4
+
+	// TargetLatency is the latency of the announcements above which fewer
+	// are made at once. The DHT takes tens of seconds to announce a key
+	// under normal conditions
+	TargetLatency = 45 * time.Second
+
+	// InitialConcurrency is the number of announcements made at once to
+	// start with, the number of workers bitswap used to announce with
+	InitialConcurrency = 6
+
+	// MaxConcurrency bounds the number of announcements made at once
+	MaxConcurrency = 32
+
+	// ProvideTimeout bounds the time of an announcement
+	ProvideTimeout = time.Minute
+
+	// RetryDelay is the time before a key whose announcement failed is
+	// retried, doubled by each failure up to MaxRetryDelay
+	RetryDelay    = time.Minute
+	MaxRetryDelay = time.Hour
+)
+
+// Entry is a key in the queue.
+type Entry struct {
+	Cid cid.Cid
+
+	// Since is the time the key was queued
+	Since time.Time
+}
+
+// Stat describes the state of the queue.
+type Stat struct {
+	// Queued is the number of keys in the queue, Retrying the number of
+	// them whose announcement failed
+	Queued   int
+	Retrying int
+
+	// Concurrency is the number of announcements made at once, Latency the
+	// average latency of the announcements
+	Concurrency int
+	Latency     time.Duration
+}
+
+// batchProvider is a content routing announcing many keys at once, see
+// reprovide.BatchProvider.
+type batchProvider interface {
+	ProvideMany(ctx context.Context, keys []cid.Cid) error
+}
+
+// Queue is a content routing queuing the keys announced, and announcing them
+// with the routing it wraps. The other queries are answered by the routing
+// wrapped.
+type Queue struct {
+	routing.ContentRouting
+	ds    ds.Datastore
+	wake  chan struct{}
+	limit *limiter
+
+	lk      sync.Mutex
+	length  int
+	pending []cid.Cid // the keys queued and not tried yet, in order
+	retries map[cid.Cid]*retry
+}
+
+// retry is the schedule of a key whose announcement failed.
+type retry struct {
+	delay time.Duration
+	next  time.Time
+}
+
+// New returns a queue stored in d announcing the keys with r until ctx is
+// canceled. The keys queued before are announced first. The keys queued are
+// read once, and kept in memory.
+func New(ctx context.Context, d ds.Datastore, r routing.ContentRouting) (*Queue, error) {
+	q := &Queue{
+		ContentRouting: r,
+		ds:             dsns.Wrap(d, QueuePrefix),
+		wake:           make(chan struct{}, 1),
+		limit:          &limiter{limit: float64(InitialConcurrency)},
+		retries:        make(map[cid.Cid]*retry),
+	}
+
+	res, err := q.ds.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		r, ok := res.NextSync()
+		if !ok {
+			break
+		}
+		if r.Error != nil {
+			res.Close()
+			return nil, r.Error
+		}
+		c, err := dshelp.DsKeyToCid(ds.RawKey(r.Key))
+		if err != nil {
+			log.Errorf("decoding the key of the provide queue %s: %s", r.Key, err)
+			continue
+		}
+		q.pending = append(q.pending, c)
+	}
+	q.length = len(q.pending)
+	res.Close()
+
+	go q.run(ctx)
+	return q, nil
+}
+
+// Provide queues c to be announced, and returns once it's stored.
+func (q *Queue) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	if !brdcst {
+		return q.ContentRouting.Provide(ctx, c, false)
+	}
+	return q.Enqueue(c)
+}
+
+// Enqueue queues c to be announced, unless it's queued already.
+func (q *Queue) Enqueue(c cid.Cid) error {
+	k := dshelp.CidToDsKey(c)
+
+	q.lk.Lock()
+	defer q.lk.Unlock()
+	has, err := q.ds.Has(k)
+	if err != nil || has {
+		return err
+	}
+	var since [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(since[:], time.Now().UnixNano())
+	if err := q.ds.Put(k, since[:n]); err != nil {
+		return err
+	}
+	q.pending = append(q.pending, c)
+	q.length++
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Queued returns the keys in the queue.
+func (q *Queue) Queued() ([]Entry, error) {
+	res, err := q.ds.Query(dsq.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var out []Entry
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		c, err := dshelp.DsKeyToCid(ds.RawKey(r.Key))
+		if err != nil {
+			log.Errorf("decoding the key of the provide queue %s: %s", r.Key, err)
+			continue
+		}
+		e := Entry{Cid: c}
+		if nanos, n := binary.Varint(r.Value); n > 0 {
+			e.Since = time.Unix(0, nanos)
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Stat returns the state of the queue.
+func (q *Queue) Stat() Stat {
+	q.lk.Lock()
+	st := Stat{
+		Queued:   q.length,
+		Retrying: len(q.retries),
+	}
+	q.lk.Unlock()
+
+	st.Concurrency, st.Latency = q.limit.stat()
+	return st
+}
+
+func (q *Queue) run(ctx context.Context) {
+	for {
+		batch, next := q.nextBatch()
+		if len(batch) == 0 {
+			var timer <-chan time.Time
+			if !next.IsZero() {
+				timer = time.After(time.Until(next))
+			}
+			select {
+			case <-q.wake:
+			case <-timer:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		for _, region := range regions(batch) {
+			q.announce(ctx, region)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// nextBatch returns up to BatchSize keys due to be announced, those whose
+// announcement failed first, and the time the next of them is due if none
+// is.
+func (q *Queue) nextBatch() ([]cid.Cid, time.Time) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	now := time.Now()
+	var next time.Time
+	var batch []cid.Cid
+	for c, rt := range q.retries {
+		if rt.next.After(now) {
+			if next.IsZero() || rt.next.Before(next) {
+				next = rt.next
+			}
+			continue
+		}
+		if len(batch) < BatchSize {
+			batch = append(batch, c)
+		}
+	}
+
+	n := BatchSize - len(batch)
+	if n > len(q.pending) {
+		n = len(q.pending)
+	}
+	batch = append(batch, q.pending[:n]...)
+	q.pending = q.pending[n:]
+	if len(q.pending) == 0 {
+		q.pending = nil
+	}
+	return batch, next
+}
+
+// regions splits keys by region of the DHT keyspace.
+func regions(keys []cid.Cid) [][]cid.Cid {
+	type keyed struct {
+		c      cid.Cid
+		region byte
+	}
+	sorted := make([]keyed, len(keys))
+	for i, c := range keys {
+		// the DHT looks up the sha256 of the key
+		h := sha256.Sum256([]byte(c.KeyString()))
+		sorted[i] = keyed{c: c, region: h[0] >> (8 - RegionBits)}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].region < sorted[j].region
+	})
+
+	var out [][]cid.Cid
+	for i, k := range sorted {
+		if i == 0 || k.region != sorted[i-1].region {
+			out = append(out, nil)
+		}
+		out[len(out)-1] = append(out[len(out)-1], k.c)
+	}
+	return out
+}
+
+// announce announces the keys of a region, all at once if the routing
+// wrapped supports it, as many at once as the limiter allows otherwise.
+func (q *Queue) announce(ctx context.Context, keys []cid.Cid) {
+	if bp, ok := q.ContentRouting.(batchProvider); ok {
+		pctx, cancel := context.WithTimeout(ctx, ProvideTimeout)
+		start := time.Now()
+		err := bp.ProvideMany(pctx, keys)
+		cancel()
+		q.limit.observe(time.Since(start), err)
+		for _, c := range keys {
+			q.done(c, err)
+		}
+		return
+	}
+
+	var lk sync.Mutex
+	freed := sync.NewCond(&lk)
+	inflight := 0
+	var wg sync.WaitGroup
+	for _, c := range keys {
+		// the concurrency changes as the announcements are made
+		lk.Lock()
+		for inflight >= q.limit.current() {
+			freed.Wait()
+		}
+		inflight++
+		lk.Unlock()
+
+		wg.Add(1)
+		go func(c cid.Cid) {
+			defer wg.Done()
+			defer func() {
+				lk.Lock()
+				inflight--
+				freed.Signal()
+				lk.Unlock()
+			}()
+
+			pctx, cancel := context.WithTimeout(ctx, ProvideTimeout)
+			start := time.Now()
+			err := q.ContentRouting.Provide(pctx, c, true)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			q.limit.observe(time.Since(start), err)
+			q.done(c, err)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// done removes c from the queue once announced, and schedules its next
+// attempt otherwise.
+func (q *Queue) done(c cid.Cid, err error) {
+	q.lk.Lock()
+	defer q.lk.Unlock()
+
+	if err != nil {
+		log.Debugf("announcing %s: %s", c, err)
+		rt, ok := q.retries[c]
+		if !ok {
+			rt = &retry{delay: RetryDelay / 2}
+			q.retries[c] = rt
+		}
+		rt.delay *= 2
+		if rt.delay > MaxRetryDelay {
+			rt.delay = MaxRetryDelay
+		}
+		rt.next = time.Now().Add(rt.delay)
+		return
+	}
+
+	delete(q.retries, c)
+	if err := q.ds.Delete(dshelp.CidToDsKey(c)); err != nil {
+		log.Errorf("removing %s from the provide queue: %s", c, err)
+		return
+	}
+	q.length--
+}
+
+// limiter adapts the number of announcements made at once to their latency:
+// it's halved when they fail or their latency exceeds TargetLatency, and
+// grows by one for each round of announcements made on time otherwise.
+type limiter struct {
+	lk      sync.Mutex
+	limit   float64
+	latency time.Duration // exponentially weighted average
+	cut     time.Time     // time of the last decrease
+}
+
+func (l *limiter) current() int {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	return int(l.limit)
+}
+
+func (l *limiter) stat() (int, time.Duration) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	return int(l.limit), l.latency
+}
+
+// observe records an announcement which took d.
+func (l *limiter) observe(d time.Duration, err error) {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if l.latency == 0 {
+		l.latency = d
+	} else {
+		l.latency = (7*l.latency + d) / 8
+	}
+
+	if err != nil || l.latency > TargetLatency {
+		// the announcements in flight when the limit was cut don't cut it
+		// again
+		if time.Since(l.cut) > l.latency {
+			l.limit /= 2
+			l.cut = time.Now()
+		}
+	} else {
+		l.limit += 1 / l.limit
+	}
+
+	if l.limit < 1 {
+		l.limit = 1
+	}
+	if max := float64(MaxConcurrency); l.limit > max {
+		l.limit = max
+	}
+}
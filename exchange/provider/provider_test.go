@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+// fakeRouting records the keys announced, or fails to announce them.
+type fakeRouting struct {
+	routing.ContentRouting
+	fail bool
+
+	lk       sync.Mutex
+	provided map[cid.Cid]bool
+}
+
+func (r *fakeRouting) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	if r.fail {
+		return errors.New("no peers")
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.provided[c] = true
+	return nil
+}
+
+func testKeys(n int) []cid.Cid {
+	keys := make([]cid.Cid, n)
+	for i := range keys {
+		keys[i] = blocks.NewBlock([]byte{byte(i)}).Cid()
+	}
+	return keys
+}
+
+func TestQueuePersists(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	keys := testKeys(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	q, err := New(ctx, d, &fakeRouting{fail: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		if err := q.Provide(ctx, k, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Enqueue(keys[0])
+	if st := q.Stat(); st.Queued != len(keys) {
+		t.Fatalf("expected %d keys queued, got %d", len(keys), st.Queued)
+	}
+	cancel()
+
+	// the keys not announced are announced after a restart
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	r := &fakeRouting{provided: make(map[cid.Cid]bool)}
+	q, err = New(ctx, d, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, err := q.Queued()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range queued {
+		if e.Since.IsZero() {
+			t.Fatalf("expected the time %s was queued to be restored", e.Cid)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Stat().Queued > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the queue to be emptied, %d keys left", q.Stat().Queued)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	for _, k := range keys {
+		if !r.provided[k] {
+			t.Fatalf("expected %s to be announced", k)
+		}
+	}
+}
+
+func TestRegions(t *testing.T) {
+	keys := testKeys(64)
+	regs := regions(keys)
+	if len(regs) > 1<<RegionBits {
+		t.Fatalf("expected at most %d regions, got %d", 1<<RegionBits, len(regs))
+	}
+
+	n := 0
+	last := -1
+	for _, reg := range regs {
+		region := -1
+		for _, c := range reg {
+			h := sha256.Sum256([]byte(c.KeyString()))
+			r := int(h[0] >> (8 - RegionBits))
+			if region == -1 {
+				region = r
+			}
+			if r != region {
+				t.Fatalf("expected the keys of a batch to be of the same region, got %d and %d", region, r)
+			}
+		}
+		if region <= last {
+			t.Fatalf("expected the regions in order, got %d after %d", region, last)
+		}
+		last = region
+		n += len(reg)
+	}
+	if n != len(keys) {
+		t.Fatalf("expected all the %d keys to be split, got %d", len(keys), n)
+	}
+}
+
+func TestNextBatch(t *testing.T) {
+	defer func(size int) { BatchSize = size }(BatchSize)
+	BatchSize = 2
+
+	keys := testKeys(5)
+	due := time.Now().Add(time.Hour)
+	q := &Queue{
+		pending: keys[:3],
+		retries: map[cid.Cid]*retry{
+			keys[3]: {next: time.Now().Add(-time.Second)},
+			keys[4]: {next: due},
+		},
+	}
+
+	// the keys whose announcement failed come first, when they are due
+	batch, next := q.nextBatch()
+	if len(batch) != 2 || batch[0] != keys[3] || batch[1] != keys[0] {
+		t.Fatalf("expected the key due and the first key queued, got %v", batch)
+	}
+	if !next.Equal(due) {
+		t.Fatalf("expected the next key to be due at %s, got %s", due, next)
+	}
+
+	// the keys queued are read once
+	delete(q.retries, keys[3])
+	batch, _ = q.nextBatch()
+	if len(batch) != 2 || batch[0] != keys[1] || batch[1] != keys[2] {
+		t.Fatalf("expected the next keys queued, got %v", batch)
+	}
+	if batch, _ = q.nextBatch(); len(batch) != 0 {
+		t.Fatalf("expected no key due, got %v", batch)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{limit: 1}
+	for i := 0; i < 100; i++ {
+		l.observe(time.Second, nil)
+	}
+	grown := l.current()
+	if grown <= 1 {
+		t.Fatalf("expected the concurrency to grow with fast announcements, got %d", grown)
+	}
+
+	l.observe(time.Second, errors.New("failed"))
+	if c := l.current(); c != grown/2 && c != (grown+1)/2 {
+		t.Fatalf("expected the concurrency to be halved by a failure, got %d after %d", c, grown)
+	}
+	if _, latency := l.stat(); latency != time.Second {
+		t.Fatalf("expected an average latency of 1s, got %s", latency)
+	}
+}
@@ -0,0 +1,103 @@
+package reprovide
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+)
+
+// Filter selects the keys announced by their codec and their string form, so
+// that the private data of a node can be left unannounced.
+type Filter struct {
+	codecs   map[uint64]bool
+	prefixes []string
+}
+
+// NewFilter returns a filter allowing the keys of one of codecs, named as in
+// cid.Codecs, whose string form starts with one of prefixes. An empty list
+// allows all the keys.
+func NewFilter(codecs, prefixes []string) (*Filter, error) {
+	f := &Filter{prefixes: prefixes}
+	if len(codecs) > 0 {
+		f.codecs = make(map[uint64]bool, len(codecs))
+	}
+	for _, name := range codecs {
+		codec, ok := cid.Codecs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown codec %q", name)
+		}
+		f.codecs[codec] = true
+	}
+	return f, nil
+}
+
+// Allows returns true if c is to be announced. A nil filter allows all the
+// keys.
+func (f *Filter) Allows(c cid.Cid) bool {
+	if f == nil {
+		return true
+	}
+	if f.codecs != nil && !f.codecs[c.Type()] {
+		return false
+	}
+	if len(f.prefixes) == 0 {
+		return true
+	}
+	s := c.String()
+	for _, p := range f.prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewFilteredProvider returns a key provider supplying the keys of kp which f
+// allows.
+func NewFilteredProvider(kp KeyChanFunc, f *Filter) KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		in, err := kp(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make(chan cid.Cid)
+		go func() {
+			defer close(out)
+			for c := range in {
+				if !f.Allows(c) {
+					continue
+				}
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return out, nil
+	}
+}
+
+// filteredRouting is a content routing announcing only the keys its filter
+// allows.
+type filteredRouting struct {
+	routing.ContentRouting
+	f *Filter
+}
+
+// NewFilteredRouting returns a content routing announcing with r the keys f
+// allows, and silently skipping the others.
+func NewFilteredRouting(r routing.ContentRouting, f *Filter) routing.ContentRouting {
+	return &filteredRouting{ContentRouting: r, f: f}
+}
+
+func (r *filteredRouting) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	if brdcst && !r.f.Allows(c) {
+		return nil
+	}
+	return r.ContentRouting.Provide(ctx, c, brdcst)
+}
@@ -5,8 +5,11 @@ import (
 
 	pin "github.com/ipfs/go-ipfs/pin"
 
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
 	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	blocks "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
 	cidutil "gx/ipfs/QmbfKu17LbMWyGUxHEUns9Wf5Dkm8PT6be4uPhTkk4YvaV/go-cidutil"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 	merkledag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
@@ -44,6 +47,59 @@ func NewPinnedProvider(pinning pin.Pinner, dag ipld.DAGService, onlyRoots bool)
 	}
 }
 
+// NewMFSProvider returns provider supplying the keys of the MFS tree. The
+// parts of the tree which aren't stored locally are skipped, they aren't
+// fetched.
+func NewMFSProvider(root *mfs.Root, bstore blocks.Blockstore) KeyChanFunc {
+	dag := merkledag.NewDAGService(bserv.New(bstore, offline.Exchange(bstore)))
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		links, err := merkledag.GetLinksWithDAG(dag)(ctx, c)
+		if err == ipld.ErrNotFound {
+			return nil, nil
+		}
+		return links, err
+	}
+
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		nd, err := root.GetDirectory().GetNode()
+		if err != nil {
+			return nil, err
+		}
+
+		set := cidutil.NewStreamingSet()
+		go func() {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			defer close(set.New)
+
+			set.Visitor(ctx)(nd.Cid())
+			err := merkledag.EnumerateChildren(ctx, getLinks, nd.Cid(), set.Visitor(ctx))
+			if err != nil {
+				log.Errorf("reprovide mfs: %s", err)
+			}
+		}()
+
+		outCh := make(chan cid.Cid)
+		go func() {
+			defer close(outCh)
+			for c := range set.New {
+				// the blocks which aren't stored locally are visited, but
+				// not announced
+				if has, err := bstore.Has(c); err != nil || !has {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case outCh <- c:
+				}
+			}
+		}()
+
+		return outCh, nil
+	}
+}
+
 func pinSet(ctx context.Context, pinning pin.Pinner, dag ipld.DAGService, onlyRoots bool) (*cidutil.StreamingSet, error) {
 	set := cidutil.NewStreamingSet()
 
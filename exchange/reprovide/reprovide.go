@@ -3,6 +3,7 @@ package reprovide
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	backoff "gx/ipfs/QmPJUtEJsm5YLUWhF6imvyCH8KZXRJa9Wup7FDMwTy5Ufz/backoff"
@@ -18,6 +19,15 @@ var log = logging.Logger("reprovider")
 type KeyChanFunc func(context.Context) (<-chan cid.Cid, error)
 type doneFunc func(error)
 
+// BatchProvider is implemented by the content routings announcing many keys
+// at once, which are given the keys in batches of BatchSize.
+type BatchProvider interface {
+	ProvideMany(ctx context.Context, keys []cid.Cid) error
+}
+
+// BatchSize is the number of keys given at once to the BatchProviders.
+var BatchSize = 1024
+
 type Reprovider struct {
 	ctx     context.Context
 	trigger chan doneFunc
@@ -26,6 +36,43 @@ type Reprovider struct {
 	rsys routing.ContentRouting
 
 	keyProvider KeyChanFunc
+
+	intervalLk      sync.Mutex
+	interval        time.Duration
+	intervalChanged chan struct{}
+
+	statLk sync.Mutex
+	stat   Stat
+}
+
+// Stat describes the activity of a Reprovider.
+type Stat struct {
+	// Interval is the time between reprovides, 0 if they are disabled
+	Interval time.Duration
+
+	// Running is set while the keys are being reprovided, Current is then
+	// the number of keys provided so far
+	Running bool
+	Current uint64
+
+	// LastStart is the start of the last reprovide, LastEnd its end. They
+	// are zero until the first reprovide is over.
+	LastStart time.Time
+	LastEnd   time.Time
+
+	// LastProvided is the number of keys provided by the last reprovide,
+	// LastErr its error
+	LastProvided uint64
+	LastErr      error
+
+	// LastCycle is the duration of the last reprovide which provided all the
+	// keys, zero until a reprovide succeeds
+	LastCycle time.Duration
+
+	// Provided and Failed count the announcements of keys and the attempts
+	// which failed, retried or not, since the Reprovider was created
+	Provided uint64
+	Failed   uint64
 }
 
 // NewReprovider creates new Reprovider instance.
@@ -36,11 +83,17 @@ func NewReprovider(ctx context.Context, rsys routing.ContentRouting, keyProvider
 
 		rsys:        rsys,
 		keyProvider: keyProvider,
+
+		intervalChanged: make(chan struct{}, 1),
 	}
 }
 
 // Run re-provides keys with 'tick' interval or when triggered
 func (rp *Reprovider) Run(tick time.Duration) {
+	rp.intervalLk.Lock()
+	rp.interval = tick
+	rp.intervalLk.Unlock()
+
 	// dont reprovide immediately.
 	// may have just started the daemon and shutting it down immediately.
 	// probability( up another minute | uptime ) increases with uptime.
@@ -56,6 +109,13 @@ func (rp *Reprovider) Run(tick time.Duration) {
 			return
 		case done = <-rp.trigger:
 		case <-after:
+		case <-rp.intervalChanged:
+			rp.intervalLk.Lock()
+			tick = rp.interval
+			rp.intervalLk.Unlock()
+
+			after = time.After(tick)
+			continue
 		}
 
 		//'mute' the trigger channel so when `ipfs bitswap reprovide` is called
@@ -77,37 +137,122 @@ func (rp *Reprovider) Run(tick time.Duration) {
 	}
 }
 
+// SetInterval changes the interval between reprovides of a running
+// Reprovider. The next reprovide happens after the new interval; an interval
+// of 0 disables periodic reproviding.
+func (rp *Reprovider) SetInterval(tick time.Duration) {
+	rp.intervalLk.Lock()
+	changed := rp.interval != tick
+	rp.interval = tick
+	rp.intervalLk.Unlock()
+
+	if !changed {
+		return
+	}
+	select {
+	case rp.intervalChanged <- struct{}{}:
+	default: // a change is already pending
+	}
+}
+
+// Stat returns the activity of the Reprovider.
+func (rp *Reprovider) Stat() Stat {
+	rp.intervalLk.Lock()
+	interval := rp.interval
+	rp.intervalLk.Unlock()
+
+	rp.statLk.Lock()
+	defer rp.statLk.Unlock()
+	st := rp.stat
+	st.Interval = interval
+	return st
+}
+
 // Reprovide registers all keys given by rp.keyProvider to libp2p content routing
 func (rp *Reprovider) Reprovide() error {
+	start := time.Now()
+	rp.statLk.Lock()
+	rp.stat.Running = true
+	rp.stat.Current = 0
+	rp.statLk.Unlock()
+
+	err := rp.reprovide()
+
+	rp.statLk.Lock()
+	rp.stat.Running = false
+	rp.stat.LastStart = start
+	rp.stat.LastEnd = time.Now()
+	rp.stat.LastProvided = rp.stat.Current
+	rp.stat.LastErr = err
+	if err == nil {
+		rp.stat.LastCycle = rp.stat.LastEnd.Sub(start)
+	}
+	rp.statLk.Unlock()
+	return err
+}
+
+func (rp *Reprovider) reprovide() error {
 	keychan, err := rp.keyProvider(rp.ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get key chan: %s", err)
 	}
+
+	bp, batching := rp.rsys.(BatchProvider)
+	var batch []cid.Cid
 	for c := range keychan {
 		// hash security
 		if err := verifcid.ValidateCid(c); err != nil {
 			log.Errorf("insecure hash in reprovider, %s (%s)", c, err)
 			continue
 		}
-		op := func() error {
-			err := rp.rsys.Provide(rp.ctx, c, true)
-			if err != nil {
-				log.Debugf("Failed to provide key: %s", err)
+		if !batching {
+			if err := rp.provide(func() error { return rp.rsys.Provide(rp.ctx, c, true) }, 1); err != nil {
+				return err
 			}
-			return err
+			continue
 		}
 
-		// TODO: this backoff library does not respect our context, we should
-		// eventually work contexts into it. low priority.
-		err := backoff.Retry(op, backoff.NewExponentialBackOff())
-		if err != nil {
-			log.Debugf("Providing failed after number of retries: %s", err)
+		batch = append(batch, c)
+		if len(batch) < BatchSize {
+			continue
+		}
+		keys := batch
+		batch = nil
+		if err := rp.provide(func() error { return bp.ProvideMany(rp.ctx, keys) }, len(keys)); err != nil {
 			return err
 		}
 	}
+	if len(batch) > 0 {
+		return rp.provide(func() error { return bp.ProvideMany(rp.ctx, batch) }, len(batch))
+	}
 	return nil
 }
 
+// provide calls op, announcing n keys, until it succeeds.
+func (rp *Reprovider) provide(op func() error, n int) error {
+	counted := func() error {
+		err := op()
+		rp.statLk.Lock()
+		if err != nil {
+			log.Debugf("Failed to provide key: %s", err)
+			rp.stat.Failed++
+		} else {
+			rp.stat.Provided += uint64(n)
+			rp.stat.Current += uint64(n)
+		}
+		rp.statLk.Unlock()
+		return err
+	}
+
+	// TODO: this backoff library does not respect our context, we should
+	// eventually work contexts into it. low priority.
+	err := backoff.Retry(counted, backoff.NewExponentialBackOff())
+	if err != nil {
+		log.Debugf("Providing failed after number of retries: %s", err)
+	}
+	return err
+}
+
 // Trigger starts reprovision process in rp.Run and waits for it
 func (rp *Reprovider) Trigger(ctx context.Context) error {
 	progressCtx, done := context.WithCancel(ctx)
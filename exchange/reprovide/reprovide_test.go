@@ -3,11 +3,20 @@ package reprovide_test
 import (
 	"context"
 	"testing"
+	"time"
 
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
 	testutil "gx/ipfs/QmPuhRE325DR8ChNcFtgd6F1eANCHy1oohXZPpYop4xsK6/go-testutil"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
 	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
 	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
 	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	merkledag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
 	mock "gx/ipfs/QmdmWkx54g7VfVyxeG8ic84uf4G6Eq1GohuyKA3XDuJ8oC/go-ipfs-routing/mock"
 	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
 	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
@@ -55,3 +64,185 @@ func TestReprovide(t *testing.T) {
 		t.Fatal("Somehow got the wrong peer back as a provider.")
 	}
 }
+
+// batchRouting records the batches of keys it's given.
+type batchRouting struct {
+	routing.ContentRouting
+	batches [][]cid.Cid
+}
+
+func (r *batchRouting) ProvideMany(ctx context.Context, keys []cid.Cid) error {
+	r.batches = append(r.batches, keys)
+	return nil
+}
+
+func TestReprovideBatches(t *testing.T) {
+	defer func(size int) { BatchSize = size }(BatchSize)
+	BatchSize = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	for _, s := range []string{"a", "b", "c"} {
+		bstore.Put(blocks.NewBlock([]byte(s)))
+	}
+
+	r := &batchRouting{ContentRouting: mock.NewServer().Client(testutil.RandIdentityOrFatal(t))}
+	reprov := NewReprovider(ctx, r, NewBlockstoreProvider(bstore))
+	if err := reprov.Reprovide(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.batches) != 2 || len(r.batches[0]) != 2 || len(r.batches[1]) != 1 {
+		t.Fatalf("expected the keys to be provided in batches of 2, got %v", r.batches)
+	}
+	if st := reprov.Stat(); st.LastProvided != 3 {
+		t.Fatalf("expected 3 keys provided, got %d", st.LastProvided)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	raw := blocks.NewBlock([]byte("raw")).Cid()
+	raw = cid.NewCidV1(cid.Raw, raw.Hash())
+	pb := merkledag.NodeWithData([]byte("protobuf")).Cid()
+
+	if _, err := NewFilter([]string{"nope"}, nil); err == nil {
+		t.Fatal("expected unknown codecs to be rejected")
+	}
+	f, err := NewFilter([]string{"raw"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Allows(raw) || f.Allows(pb) {
+		t.Fatal("expected only the raw blocks to be allowed")
+	}
+	f, err = NewFilter(nil, []string{raw.String()[:6]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Allows(raw) || f.Allows(pb) {
+		t.Fatal("expected only the keys with the prefix to be allowed")
+	}
+	if !(*Filter)(nil).Allows(pb) {
+		t.Fatal("expected a nil filter to allow all the keys")
+	}
+
+	keys := func(context.Context) (<-chan cid.Cid, error) {
+		ch := make(chan cid.Cid, 2)
+		ch <- raw
+		ch <- pb
+		close(ch)
+		return ch, nil
+	}
+	out, err := NewFilteredProvider(keys, f)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var provided []cid.Cid
+	for c := range out {
+		provided = append(provided, c)
+	}
+	if len(provided) != 1 || !provided[0].Equals(raw) {
+		t.Fatalf("expected only the raw block to be provided, got %v", provided)
+	}
+
+	mrserv := mock.NewServer()
+	r := NewFilteredRouting(mrserv.Client(testutil.RandIdentityOrFatal(t)), f)
+	for _, c := range []cid.Cid{raw, pb} {
+		if err := r.Provide(ctx, c, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clB := mrserv.Client(testutil.RandIdentityOrFatal(t))
+	for c, expected := range map[cid.Cid]bool{raw: true, pb: false} {
+		_, found := <-clB.FindProvidersAsync(ctx, c, 1)
+		if found != expected {
+			t.Fatalf("expected %s to be provided: %t", c, expected)
+		}
+	}
+}
+
+func TestSetInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clA := mock.NewServer().Client(testutil.RandIdentityOrFatal(t))
+
+	provided := make(chan struct{}, 1)
+	keyProvider := func(context.Context) (<-chan cid.Cid, error) {
+		select {
+		case provided <- struct{}{}:
+		default:
+		}
+		ch := make(chan cid.Cid)
+		close(ch)
+		return ch, nil
+	}
+
+	reprov := NewReprovider(ctx, clA, keyProvider)
+	go reprov.Run(0)
+
+	select {
+	case <-provided:
+		t.Fatal("reprovided while disabled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	reprov.SetInterval(10 * time.Millisecond)
+	select {
+	case <-provided:
+	case <-time.After(5 * time.Second):
+		t.Fatal("didn't reprovide after setting the interval")
+	}
+}
+
+func TestMFSProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bstore := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	dag := merkledag.NewDAGService(bserv.New(bstore, offline.Exchange(bstore)))
+
+	root, err := mfs.NewRoot(ctx, dag, ft.EmptyDirNode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := merkledag.NewRawNode([]byte("local"))
+	if err := mfs.PutNode(root, "/local", local); err != nil {
+		t.Fatal(err)
+	}
+	// a directory linking to a block which isn't stored locally
+	missing := merkledag.NewRawNode([]byte("missing"))
+	dir := ft.EmptyDirNode()
+	if err := dir.AddRawLink("missing", &ipld.Link{Cid: missing.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := mfs.PutNode(root, "/dir", dir); err != nil {
+		t.Fatal(err)
+	}
+	unpinned := blocks.NewBlock([]byte("not in mfs"))
+	bstore.Put(unpinned)
+
+	keys, err := NewMFSProvider(root, bstore)(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provided := make(map[string]bool)
+	for c := range keys {
+		provided[c.KeyString()] = true
+	}
+
+	if !provided[local.Cid().KeyString()] || !provided[dir.Cid().KeyString()] {
+		t.Fatal("expected the blocks of mfs to be provided")
+	}
+	if provided[missing.Cid().KeyString()] {
+		t.Fatal("expected the blocks which aren't stored locally to be skipped")
+	}
+	if provided[unpinned.Cid().KeyString()] {
+		t.Fatal("expected the blocks outside of mfs to be skipped")
+	}
+}
@@ -0,0 +1,94 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// minBurst is the minimum number of bytes a limiter lets through at once.
+const minBurst = 4 << 10
+
+// Limiter limits a rate of bytes with a token bucket holding one second worth
+// of bytes. A nil limiter doesn't limit anything.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	lk     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter of rate bytes per second, or nil if rate is 0.
+func NewLimiter(rate uint64) *Limiter {
+	if rate == 0 {
+		return nil
+	}
+	burst := float64(rate)
+	if burst < minBurst {
+		burst = minBurst
+	}
+	return &Limiter{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// Burst returns the maximum number of bytes let through at once.
+func (l *Limiter) Burst() int {
+	if l == nil {
+		return 0
+	}
+	return int(l.burst)
+}
+
+// reserve takes n bytes at now, and returns how long to wait for them to be
+// within the rate.
+func (l *Limiter) reserve(n int, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+	}
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// wait waits for n bytes to be within the rates of all the limiters.
+func wait(n int, limiters ...*Limiter) {
+	now := time.Now()
+	var d time.Duration
+	for _, l := range limiters {
+		if w := l.reserve(n, now); w > d {
+			d = w
+		}
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// chunkSize returns the size of the chunks of writes the limiters let through
+// at once, 0 if none of them limits anything.
+func chunkSize(limiters ...*Limiter) int {
+	size := 0
+	for _, l := range limiters {
+		if b := l.Burst(); b > 0 && (size == 0 || b < size) {
+			size = b
+		}
+	}
+	return size
+}
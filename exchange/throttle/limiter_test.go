@@ -0,0 +1,46 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	var none *Limiter
+	if d := none.reserve(1<<20, time.Now()); d != 0 {
+		t.Errorf("expected a nil limiter not to wait, got %s", d)
+	}
+	if NewLimiter(0) != nil {
+		t.Error("expected no limiter without a rate")
+	}
+
+	l := NewLimiter(10000)
+	now := l.last
+	if d := l.reserve(10000, now); d != 0 {
+		t.Errorf("expected the burst not to wait, got %s", d)
+	}
+	if d := l.reserve(5000, now); d != 500*time.Millisecond {
+		t.Errorf("expected to wait for half a second, got %s", d)
+	}
+
+	// the bucket refills at the rate, up to the burst
+	now = now.Add(10 * time.Second)
+	if d := l.reserve(10000, now); d != 0 {
+		t.Errorf("expected the refilled burst not to wait, got %s", d)
+	}
+	if d := l.reserve(1000, now); d != 100*time.Millisecond {
+		t.Errorf("expected the bucket not to hold more than the burst, waited %s", d)
+	}
+}
+
+func TestChunkSize(t *testing.T) {
+	if size := chunkSize(nil, nil); size != 0 {
+		t.Errorf("expected no chunks without limits, got %d", size)
+	}
+	if size := chunkSize(NewLimiter(100000), nil, NewLimiter(50000)); size != 50000 {
+		t.Errorf("expected the chunks of the lowest limit, got %d", size)
+	}
+	if size := chunkSize(NewLimiter(10)); size != minBurst {
+		t.Errorf("expected chunks of at least %d bytes, got %d", minBurst, size)
+	}
+}
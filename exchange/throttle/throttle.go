@@ -0,0 +1,162 @@
+// Package throttle limits the upload and download rates of the streams of a
+// host, in total and per peer. It's meant for the host of bitswap, to cap the
+// bandwidth used to exchange blocks.
+package throttle
+
+import (
+	"context"
+	"sync"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+// Limits are rates in bytes per second, 0 for no limit.
+type Limits struct {
+	Upload   uint64
+	Download uint64
+
+	PeerUpload   uint64
+	PeerDownload uint64
+}
+
+// Host is a host limiting the rates of the streams of the protocols it
+// handles and opens.
+type Host struct {
+	p2phost.Host
+
+	limits   Limits
+	upload   *Limiter
+	download *Limiter
+
+	lk    sync.Mutex
+	peers map[peer.ID]*peerLimiters
+}
+
+// peerLimiters are the limiters of a peer, kept while it has streams open.
+type peerLimiters struct {
+	upload   *Limiter
+	download *Limiter
+	streams  int
+}
+
+// Wrap returns a host limiting the rates of the streams of h.
+func Wrap(h p2phost.Host, limits Limits) *Host {
+	return &Host{
+		Host:     h,
+		limits:   limits,
+		upload:   NewLimiter(limits.Upload),
+		download: NewLimiter(limits.Download),
+		peers:    make(map[peer.ID]*peerLimiters),
+	}
+}
+
+func (h *Host) SetStreamHandler(pid protocol.ID, handler inet.StreamHandler) {
+	h.Host.SetStreamHandler(pid, func(s inet.Stream) {
+		handler(h.wrap(s))
+	})
+}
+
+func (h *Host) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (inet.Stream, error) {
+	s, err := h.Host.NewStream(ctx, p, pids...)
+	if err != nil {
+		return nil, err
+	}
+	return h.wrap(s), nil
+}
+
+func (h *Host) wrap(s inet.Stream) inet.Stream {
+	p := s.Conn().RemotePeer()
+
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	pl, ok := h.peers[p]
+	if !ok {
+		pl = &peerLimiters{
+			upload:   NewLimiter(h.limits.PeerUpload),
+			download: NewLimiter(h.limits.PeerDownload),
+		}
+		h.peers[p] = pl
+	}
+	pl.streams++
+
+	return &stream{
+		Stream:   s,
+		host:     h,
+		peer:     p,
+		upload:   []*Limiter{h.upload, pl.upload},
+		download: []*Limiter{h.download, pl.download},
+	}
+}
+
+// release forgets the limiters of p once it has no streams open.
+func (h *Host) release(p peer.ID) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	pl, ok := h.peers[p]
+	if !ok {
+		return
+	}
+	pl.streams--
+	if pl.streams <= 0 {
+		delete(h.peers, p)
+	}
+}
+
+type stream struct {
+	inet.Stream
+	host *Host
+	peer peer.ID
+
+	upload   []*Limiter
+	download []*Limiter
+
+	closed sync.Once
+}
+
+// Read waits after reading for the bytes read to be within the download
+// rates, delaying the next reads.
+func (s *stream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	if n > 0 {
+		wait(n, s.download...)
+	}
+	return n, err
+}
+
+// Write writes b by chunks, waiting before each chunk for it to be within
+// the upload rates.
+func (s *stream) Write(b []byte) (int, error) {
+	size := chunkSize(s.upload...)
+	if size == 0 {
+		return s.Stream.Write(b)
+	}
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		wait(len(chunk), s.upload...)
+		n, err := s.Stream.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[len(chunk):]
+	}
+	return written, nil
+}
+
+func (s *stream) Close() error {
+	s.closed.Do(func() { s.host.release(s.peer) })
+	return s.Stream.Close()
+}
+
+func (s *stream) Reset() error {
+	s.closed.Do(func() { s.host.release(s.peer) })
+	return s.Stream.Reset()
+}
@@ -0,0 +1,148 @@
+// Package wantages tracks how long the blocks have been on the wantlists
+// bitswap knows of, which bitswap doesn't record itself.
+package wantages
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bitswap "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("wantages")
+
+// PollInterval is the interval between two polls of the wantlists, and so the
+// precision of the ages.
+var PollInterval = 2 * time.Second
+
+// Source is the part of bitswap polled for the wantlists.
+type Source interface {
+	// GetWantlist returns the wantlist of the node
+	GetWantlist() []cid.Cid
+
+	// WantlistForPeer returns the wantlist of a peer, as known to the node
+	WantlistForPeer(peer.ID) []cid.Cid
+
+	// Stat lists the peers bitswap exchanges blocks with
+	Stat() (*bitswap.Stat, error)
+}
+
+// Entry is a block on a wantlist.
+type Entry struct {
+	Cid cid.Cid
+
+	// Since is the time the block was first seen on the wantlist
+	Since time.Time
+}
+
+// Tracker records the time the blocks were first seen on the wantlist of
+// the node and on the wantlists of its bitswap partners.
+type Tracker struct {
+	src Source
+
+	lk    sync.Mutex
+	self  map[cid.Cid]time.Time
+	peers map[peer.ID]map[cid.Cid]time.Time
+}
+
+// New returns a tracker polling src until ctx is canceled.
+func New(ctx context.Context, src Source) *Tracker {
+	t := &Tracker{
+		src:   src,
+		self:  make(map[cid.Cid]time.Time),
+		peers: make(map[peer.ID]map[cid.Cid]time.Time),
+	}
+	go t.run(ctx)
+	return t
+}
+
+func (t *Tracker) run(ctx context.Context) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.poll(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// poll records the blocks on the wantlists at now, and forgets the blocks
+// which left them and the peers bitswap stopped exchanging with.
+func (t *Tracker) poll(now time.Time) {
+	st, err := t.src.Stat()
+	if err != nil {
+		log.Debugf("listing the bitswap partners: %s", err)
+		return
+	}
+
+	self := t.src.GetWantlist()
+	wantlists := make(map[peer.ID][]cid.Cid, len(st.Peers))
+	for _, s := range st.Peers {
+		p, err := peer.IDB58Decode(s)
+		if err != nil {
+			continue
+		}
+		wantlists[p] = t.src.WantlistForPeer(p)
+	}
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.self = update(t.self, self, now)
+	peers := make(map[peer.ID]map[cid.Cid]time.Time, len(wantlists))
+	for p, wl := range wantlists {
+		peers[p] = update(t.peers[p], wl, now)
+	}
+	t.peers = peers
+}
+
+// update returns the times of the blocks of wl, taken from seen for the blocks
+// already seen and now for the others.
+func update(seen map[cid.Cid]time.Time, wl []cid.Cid, now time.Time) map[cid.Cid]time.Time {
+	out := make(map[cid.Cid]time.Time, len(wl))
+	for _, c := range wl {
+		since, ok := seen[c]
+		if !ok {
+			since = now
+		}
+		out[c] = since
+	}
+	return out
+}
+
+// Wantlist returns the current wantlist of the node.
+func (t *Tracker) Wantlist() []Entry {
+	wl := t.src.GetWantlist()
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.self = update(t.self, wl, time.Now())
+	return entries(t.self, wl)
+}
+
+// WantlistForPeer returns the current wantlist of p, as known to the node.
+func (t *Tracker) WantlistForPeer(p peer.ID) []Entry {
+	wl := t.src.WantlistForPeer(p)
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	seen := update(t.peers[p], wl, time.Now())
+	if len(seen) > 0 {
+		t.peers[p] = seen
+	}
+	return entries(seen, wl)
+}
+
+func entries(seen map[cid.Cid]time.Time, wl []cid.Cid) []Entry {
+	out := make([]Entry, 0, len(wl))
+	for _, c := range wl {
+		out = append(out, Entry{Cid: c, Since: seen[c]})
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package wantages
+
+import (
+	"testing"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bitswap "gx/ipfs/QmUYXFM46WgGs5AScfL4FSZXa9p5nAhddueyM5auAVZGCQ/go-bitswap"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+)
+
+type fakeSource struct {
+	self  []cid.Cid
+	peers map[peer.ID][]cid.Cid
+}
+
+func (s *fakeSource) GetWantlist() []cid.Cid {
+	return s.self
+}
+
+func (s *fakeSource) WantlistForPeer(p peer.ID) []cid.Cid {
+	return s.peers[p]
+}
+
+func (s *fakeSource) Stat() (*bitswap.Stat, error) {
+	st := new(bitswap.Stat)
+	for p := range s.peers {
+		st.Peers = append(st.Peers, p.Pretty())
+	}
+	return st, nil
+}
+
+func TestTracker(t *testing.T) {
+	a := blocks.NewBlock([]byte("a")).Cid()
+	b := blocks.NewBlock([]byte("b")).Cid()
+	p := peer.ID("peer")
+
+	src := &fakeSource{
+		self:  []cid.Cid{a},
+		peers: map[peer.ID][]cid.Cid{p: {b}},
+	}
+	tr := &Tracker{
+		src:   src,
+		self:  make(map[cid.Cid]time.Time),
+		peers: make(map[peer.ID]map[cid.Cid]time.Time),
+	}
+
+	start := time.Now().Add(-time.Hour)
+	tr.poll(start)
+	src.self = []cid.Cid{a, b}
+	tr.poll(start.Add(time.Minute))
+
+	wl := tr.Wantlist()
+	if len(wl) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(wl))
+	}
+	if !wl[0].Since.Equal(start) {
+		t.Errorf("expected %s to be wanted since the first poll", a)
+	}
+	if !wl[1].Since.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected %s to be wanted since the second poll", b)
+	}
+
+	if pwl := tr.WantlistForPeer(p); len(pwl) != 1 || !pwl[0].Since.Equal(start) {
+		t.Errorf("unexpected wantlist for the peer: %v", pwl)
+	}
+
+	// blocks leaving the wantlist are forgotten
+	src.self = nil
+	tr.poll(start.Add(2 * time.Minute))
+	src.self = []cid.Cid{a}
+	if wl := tr.Wantlist(); len(wl) != 1 || !wl[0].Since.After(start.Add(2*time.Minute)) {
+		t.Errorf("expected %s to be wanted again since now, got %v", a, wl)
+	}
+
+	// and so are the peers bitswap stopped exchanging with
+	delete(src.peers, p)
+	tr.poll(start.Add(3 * time.Minute))
+	if len(tr.peers) != 0 {
+		t.Error("expected the wantlist of the peer to be forgotten")
+	}
+}
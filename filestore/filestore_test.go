@@ -5,6 +5,10 @@ import (
 	"context"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
@@ -164,6 +168,195 @@ func TestDeletes(t *testing.T) {
 	}
 }
 
+func TestDropStale(t *testing.T) {
+	dir, fs := newTestFilestore(t)
+	changed, cids := randomFileAdd(t, fs, dir, 100)
+	removed, gone := randomFileAdd(t, fs, dir, 20)
+
+	f, err := os.OpenFile(changed, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := os.Remove(removed); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := VerifyAll(fs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped := make(map[string]bool)
+	for r := next(); r != nil; r = next() {
+		if err := DropStale(fs, r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Dropped != r.Stale() {
+			t.Fatalf("%s: expected only the stale references to be dropped, got %s", r.Key, r.Status)
+		}
+		if r.Dropped {
+			dropped[r.Key.KeyString()] = true
+		}
+	}
+
+	for _, c := range append([]cid.Cid{cids[0]}, gone...) {
+		if !dropped[c.KeyString()] {
+			t.Fatalf("expected %s to be dropped", c)
+		}
+		if _, err := fs.Get(c); err != blockstore.ErrNotFound {
+			t.Fatalf("expected %s to be missing, got %v", c, err)
+		}
+	}
+	for _, c := range cids[1:] {
+		if _, err := fs.Get(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(dropped) != 1+len(gone) {
+		t.Fatalf("expected %d references dropped, got %d", 1+len(gone), len(dropped))
+	}
+}
+
+func TestMaterialize(t *testing.T) {
+	dir, fs := newTestFilestore(t)
+	fname, cids := randomFileAdd(t, fs, dir, 100)
+	c := cids[3]
+
+	if _, err := Materialize(fs, c); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := fs.FileManager().Has(c); has {
+		t.Fatal("expected the reference to be removed")
+	}
+	if has, _ := fs.MainBlockstore().Has(c); !has {
+		t.Fatal("expected the block to be copied")
+	}
+
+	r, err := Dematerialize(fs, c, fname, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.FilePath != filepath.Base(fname) || r.Offset != 30 || r.Size != 10 {
+		t.Fatalf("unexpected reference %s", r.FormatLong())
+	}
+	if has, _ := fs.MainBlockstore().Has(c); has {
+		t.Fatal("expected the block to be removed")
+	}
+	if _, err := fs.Get(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data is verified before the block is removed
+	if _, err := Materialize(fs, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Dematerialize(fs, c, fname, 40); err == nil {
+		t.Fatal("expected the reference to the wrong data to be refused")
+	}
+	if has, _ := fs.MainBlockstore().Has(c); !has {
+		t.Fatal("expected the block to be kept")
+	}
+}
+
+func TestVerifyURLs(t *testing.T) {
+	_, fs := newTestFilestore(t)
+	fs.FileManager().AllowUrls = true
+
+	content := make(map[string][]byte)
+	// the server ignores the ranges
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := content[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	refs := make(map[string]string)
+	for _, p := range []string{"/a", "/b", "/c"} {
+		buf := make([]byte, 100)
+		rand.Read(buf)
+		content[p] = buf
+		for i := 0; i < 10; i++ {
+			n := &posinfo.FilestoreNode{
+				PosInfo: &posinfo.PosInfo{
+					FullPath: srv.URL + p,
+					Offset:   uint64(i * 10),
+				},
+				Node: dag.NewRawNode(buf[i*10 : (i+1)*10]),
+			}
+			if err := fs.Put(n); err != nil {
+				t.Fatal(err)
+			}
+			refs[n.Cid().KeyString()] = p
+		}
+	}
+	content["/a"][0]++
+	content["/b"] = content["/b"][:50]
+	delete(content, "/c")
+
+	next, err := VerifyURLs(context.Background(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[string]map[Status]int)
+	for r := next(); r != nil; r = next() {
+		p := refs[r.Key.KeyString()]
+		if statuses[p] == nil {
+			statuses[p] = make(map[Status]int)
+		}
+		statuses[p][r.Status]++
+	}
+
+	if s := statuses["/a"]; s[StatusFileChanged] != 1 || s[StatusOk] != 9 {
+		t.Fatalf("expected the first block of /a to be changed, got %v", s)
+	}
+	if s := statuses["/b"]; s[StatusFileChanged] != 5 || s[StatusOk] != 5 {
+		t.Fatalf("expected the end of /b to be changed, got %v", s)
+	}
+	if s := statuses["/c"]; s[StatusFileNotFound] != 10 {
+		t.Fatalf("expected the blocks of /c to be missing, got %v", s)
+	}
+}
+
+func TestRemap(t *testing.T) {
+	dir, fs := newTestFilestore(t)
+	old := filepath.Join(dir, "old")
+	if err := os.Mkdir(old, 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, cids := randomFileAdd(t, fs, old, 100)
+	_, others := randomFileAdd(t, fs, dir, 50)
+
+	moved := filepath.Join(dir, "new")
+	if err := os.Rename(old, moved); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Remap(fs, old, moved, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Remapped != uint64(len(cids)) || len(res.Sample) != 5 {
+		t.Fatalf("expected %d references remapped and 5 verified, got %d and %d", len(cids), res.Remapped, len(res.Sample))
+	}
+	for _, r := range res.Sample {
+		if r.Status != StatusOk {
+			t.Fatalf("%s: expected the sample to verify, got %s", r.Key, r.Status)
+		}
+	}
+
+	for _, c := range append(cids, others...) {
+		if _, err := fs.Get(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestIsURL(t *testing.T) {
 	if !IsURL("http://www.example.com") {
 		t.Fatal("IsURL failed: http://www.example.com")
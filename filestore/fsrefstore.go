@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -193,16 +194,9 @@ func (f *FileManager) readFileDataObj(c cid.Cid, d *pb.DataObj) ([]byte, error)
 		return nil, &CorruptReferenceError{StatusFileError, err}
 	}
 
-	outcid, err := c.Prefix().Sum(outbuf)
-	if err != nil {
+	if err := verifyData(c, d, outbuf); err != nil {
 		return nil, err
 	}
-
-	if !c.Equals(outcid) {
-		return nil, &CorruptReferenceError{StatusFileChanged,
-			fmt.Errorf("data in file did not match. %s offset %d", d.GetFilePath(), d.GetOffset())}
-	}
-
 	return outbuf, nil
 }
 
@@ -223,31 +217,65 @@ func (f *FileManager) readURLDataObj(c cid.Cid, d *pb.DataObj) ([]byte, error) {
 	if err != nil {
 		return nil, &CorruptReferenceError{StatusFileError, err}
 	}
-	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
-		return nil, &CorruptReferenceError{StatusFileError,
-			fmt.Errorf("expected HTTP 200 or 206 got %d", res.StatusCode)}
+	defer res.Body.Close()
+	if err := urlStatusError(res); err != nil {
+		return nil, err
+	}
+
+	// servers ignoring the range send the whole content
+	if res.StatusCode == http.StatusOK && d.GetOffset() > 0 {
+		if _, err := io.CopyN(ioutil.Discard, res.Body, int64(d.GetOffset())); err != nil {
+			return nil, readURLError(err)
+		}
 	}
 
 	outbuf := make([]byte, d.GetSize_())
-	_, err = io.ReadFull(res.Body, outbuf)
+	if _, err := io.ReadFull(res.Body, outbuf); err != nil {
+		return nil, readURLError(err)
+	}
+
+	if err := verifyData(c, d, outbuf); err != nil {
+		return nil, err
+	}
+	return outbuf, nil
+}
+
+// urlStatusError returns the error of the response to the request of a
+// block, if any. The content of URLs which can't be found anymore is reported
+// as gone, like missing files.
+func urlStatusError(res *http.Response) error {
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return nil
+	case http.StatusNotFound, http.StatusGone:
+		return &CorruptReferenceError{StatusFileNotFound,
+			fmt.Errorf("expected HTTP 200 or 206 got %d", res.StatusCode)}
+	default:
+		return &CorruptReferenceError{StatusFileError,
+			fmt.Errorf("expected HTTP 200 or 206 got %d", res.StatusCode)}
+	}
+}
+
+func readURLError(err error) error {
 	if err == io.EOF || err == io.ErrUnexpectedEOF {
-		return nil, &CorruptReferenceError{StatusFileChanged, err}
-	} else if err != nil {
-		return nil, &CorruptReferenceError{StatusFileError, err}
+		return &CorruptReferenceError{StatusFileChanged, err}
 	}
-	res.Body.Close()
+	return &CorruptReferenceError{StatusFileError, err}
+}
 
-	outcid, err := c.Prefix().Sum(outbuf)
+// verifyData checks that data is the data of the block c, read from the
+// reference d.
+func verifyData(c cid.Cid, d *pb.DataObj, data []byte) error {
+	outcid, err := c.Prefix().Sum(data)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if !c.Equals(outcid) {
-		return nil, &CorruptReferenceError{StatusFileChanged,
+		return &CorruptReferenceError{StatusFileChanged,
 			fmt.Errorf("data in file did not match. %s offset %d", d.GetFilePath(), d.GetOffset())}
 	}
-
-	return outbuf, nil
+	return nil
 }
 
 // Has returns if the FileManager is storing a block reference. It does not
@@ -281,26 +309,45 @@ func (f *FileManager) putTo(b *posinfo.FilestoreNode, to putter) error {
 		if !f.AllowFiles {
 			return ErrFilestoreNotEnabled
 		}
-		if !filepath.HasPrefix(b.PosInfo.FullPath, f.root) {
-			return fmt.Errorf("cannot add filestore references outside ipfs root (%s)", f.root)
-		}
-
-		p, err := filepath.Rel(f.root, b.PosInfo.FullPath)
+		p, err := f.relPath(b.PosInfo.FullPath)
 		if err != nil {
 			return err
 		}
 
-		dobj.FilePath = filepath.ToSlash(p)
+		dobj.FilePath = p
 	}
 	dobj.Offset = b.PosInfo.Offset
 	dobj.Size_ = uint64(len(b.RawData()))
 
-	data, err := proto.Marshal(&dobj)
+	return putDataObj(b.Cid(), &dobj, to)
+}
+
+func putDataObj(c cid.Cid, d *pb.DataObj, to putter) error {
+	data, err := proto.Marshal(d)
 	if err != nil {
 		return err
 	}
 
-	return to.Put(dshelp.CidToDsKey(b.Cid()), data)
+	return to.Put(dshelp.CidToDsKey(c), data)
+}
+
+// relPath returns the path of the absolute path p relative to the root of
+// the FileManager, as stored in the references.
+func (f *FileManager) relPath(p string) (string, error) {
+	if !filepath.HasPrefix(p, f.root) {
+		return "", fmt.Errorf("cannot add filestore references outside ipfs root (%s)", f.root)
+	}
+	rel, err := filepath.Rel(f.root, p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// AbsPath returns the absolute path of the path p of a reference, relative
+// to the root of the FileManager.
+func (f *FileManager) AbsPath(p string) string {
+	return filepath.Join(f.root, filepath.FromSlash(p))
 }
 
 // PutMany is like Put() but takes a slice of blocks instead,
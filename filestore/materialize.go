@@ -0,0 +1,77 @@
+package filestore
+
+import (
+	pb "github.com/ipfs/go-ipfs/filestore/pb"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	blockstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+)
+
+// Materialize copies the data of the block with the given key from its
+// backing file or URL into the main blockstore, and then removes its
+// reference from the FileManager, so that the backing file can be deleted.
+// The data is verified against the key before being copied. The returned
+// ListRes describes the reference removed, or why it couldn't be.
+func Materialize(fs *Filestore, key cid.Cid) (*ListRes, error) {
+	dobj, err := fs.fm.getDataObj(key)
+	if err != nil {
+		return mkListRes(key, nil, err), err
+	}
+	data, err := fs.fm.readDataObj(key, dobj)
+	if err != nil {
+		return mkListRes(key, dobj, err), err
+	}
+
+	blk, err := blocks.NewBlockWithCid(data, key)
+	if err != nil {
+		return mkListRes(key, dobj, err), err
+	}
+	if err := fs.bs.Put(blk); err != nil {
+		return mkListRes(key, dobj, err), err
+	}
+
+	err = fs.fm.DeleteBlock(key)
+	if err != nil && err != blockstore.ErrNotFound {
+		return mkListRes(key, dobj, err), err
+	}
+	return mkListRes(key, dobj, nil), nil
+}
+
+// Dematerialize replaces the block with the given key of the main
+// blockstore with a reference to the same data, found in the file at the
+// given absolute path and offset, which must be under the root of the
+// Filestore. The data is read back from the file and verified against the
+// key before the block is removed from the main blockstore. The returned
+// ListRes describes the reference added, or why it couldn't be.
+func Dematerialize(fs *Filestore, key cid.Cid, path string, offset uint64) (*ListRes, error) {
+	if !fs.fm.AllowFiles {
+		return mkListRes(key, nil, ErrFilestoreNotEnabled), ErrFilestoreNotEnabled
+	}
+	p, err := fs.fm.relPath(path)
+	if err != nil {
+		return mkListRes(key, nil, err), err
+	}
+
+	size, err := fs.bs.GetSize(key)
+	if err != nil {
+		return mkListRes(key, nil, err), err
+	}
+	dobj := &pb.DataObj{
+		FilePath: p,
+		Offset:   offset,
+		Size_:    uint64(size),
+	}
+	if _, err := fs.fm.readDataObj(key, dobj); err != nil {
+		return mkListRes(key, dobj, err), err
+	}
+
+	if err := putDataObj(key, dobj, fs.fm.ds); err != nil {
+		return mkListRes(key, dobj, err), err
+	}
+	err = fs.bs.DeleteBlock(key)
+	if err != nil && err != blockstore.ErrNotFound {
+		return mkListRes(key, dobj, err), err
+	}
+	return mkListRes(key, dobj, nil), nil
+}
@@ -0,0 +1,134 @@
+package filestore
+
+import (
+	"math/rand"
+	"strings"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	dshelp "gx/ipfs/QmauEMWPoSqggfpSDHMMXuDn12DTd7TaFBvn39eeurzKT2/go-ipfs-ds-help"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// remapBatchSize is the number of references rewritten per batch.
+const remapBatchSize = 1024
+
+// RemapRes is the result of Remap.
+type RemapRes struct {
+	// Remapped is the number of references rewritten
+	Remapped uint64
+
+	// Sample holds the verification of a random sample of the references
+	// rewritten
+	Sample []*ListRes
+}
+
+// Remap rewrites the references of the FileManager of the given Filestore
+// to the files under the directory from, so that they point to the same
+// files under the directory to, as when the backing files were moved. Both
+// are absolute paths under the root of the Filestore. The data isn't read
+// while rewriting the references, a random sample of sample references is
+// verified once all of them are rewritten.
+func Remap(fs *Filestore, from, to string, sample int) (*RemapRes, error) {
+	from, err := fs.fm.relPath(from)
+	if err != nil {
+		return nil, err
+	}
+	to, err = fs.fm.relPath(to)
+	if err != nil {
+		return nil, err
+	}
+
+	qr, err := fs.fm.ds.Query(dsq.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer qr.Close()
+
+	res := &RemapRes{}
+	var keys []cid.Cid
+	var batch ds.Batch
+	pending := 0
+	for {
+		v, ok := qr.NextSync()
+		if !ok {
+			break
+		}
+		if v.Error != nil {
+			return res, v.Error
+		}
+		dobj, err := unmarshalDataObj(v.Value)
+		if err != nil || IsURL(dobj.GetFilePath()) {
+			continue
+		}
+		p, ok := remapPath(dobj.GetFilePath(), from, to)
+		if !ok {
+			continue
+		}
+		c, err := dshelp.DsKeyToCid(ds.RawKey(v.Key))
+		if err != nil {
+			continue
+		}
+
+		if batch == nil {
+			batch, err = fs.fm.ds.Batch()
+			if err != nil {
+				return res, err
+			}
+		}
+		dobj.FilePath = p
+		if err := putDataObj(c, dobj, batch); err != nil {
+			return res, err
+		}
+		pending++
+		if pending == remapBatchSize {
+			if err := batch.Commit(); err != nil {
+				return res, err
+			}
+			res.Remapped += uint64(pending)
+			batch = nil
+			pending = 0
+		}
+
+		// reservoir sampling of the keys rewritten
+		n := res.Remapped + uint64(pending)
+		if len(keys) < sample {
+			keys = append(keys, c)
+		} else if i := rand.Int63n(int64(n)); i < int64(sample) {
+			keys[i] = c
+		}
+	}
+	if batch != nil {
+		if err := batch.Commit(); err != nil {
+			return res, err
+		}
+		res.Remapped += uint64(pending)
+	}
+
+	for _, c := range keys {
+		res.Sample = append(res.Sample, Verify(fs, c))
+	}
+	return res, nil
+}
+
+// remapPath returns the path p moved from the directory from to the
+// directory to, and false if p isn't under from.
+func remapPath(p, from, to string) (string, bool) {
+	switch {
+	case from == ".":
+		return pathJoin(to, p), true
+	case p == from:
+		return to, true
+	case strings.HasPrefix(p, from+"/"):
+		return pathJoin(to, p[len(from)+1:]), true
+	default:
+		return "", false
+	}
+}
+
+func pathJoin(dir, p string) string {
+	if dir == "." {
+		return p
+	}
+	return dir + "/" + p
+}
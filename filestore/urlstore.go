@@ -0,0 +1,143 @@
+package filestore
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	pb "github.com/ipfs/go-ipfs/filestore/pb"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// VerifyURLs returns a function as an iterator which, once invoked,
+// returns one by one each block of the Filestore's FileManager stored at
+// one of the given URLs, or at any URL if none is given, after verifying
+// it. Unlike VerifyAll, the content of each URL is fetched once and read
+// sequentially to verify all the blocks stored at it, instead of fetching
+// each block with its own request. The requests are canceled with ctx.
+func VerifyURLs(ctx context.Context, fs *Filestore, urls ...string) (func() *ListRes, error) {
+	if !fs.fm.AllowUrls {
+		return nil, ErrUrlstoreNotEnabled
+	}
+
+	entries, err := sortedEntries(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	want := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		want[u] = true
+	}
+	var filtered listEntries
+	for _, v := range entries {
+		if v.err != nil || !IsURL(v.filePath) {
+			continue
+		}
+		if len(want) > 0 && !want[v.filePath] {
+			continue
+		}
+		filtered = append(filtered, v)
+	}
+
+	r := &urlReader{ctx: ctx}
+	i := 0
+	return func() *ListRes {
+		if i >= len(filtered) {
+			r.close()
+			return nil
+		}
+		v := filtered[i]
+		i++
+		c, dobj, err := v.dataObj()
+		if err != nil {
+			return mkListRes(c, dobj, err)
+		}
+		_, err = r.read(fs, c, dobj)
+		return mkListRes(c, dobj, err)
+	}, nil
+}
+
+// urlReader reads the blocks stored at a URL in the order of their offset,
+// from a single response with the whole content of the URL.
+type urlReader struct {
+	ctx  context.Context
+	url  string
+	body io.ReadCloser
+	pos  uint64
+
+	// err is the error of the request of url, returned for all its blocks
+	err error
+}
+
+func (r *urlReader) read(fs *Filestore, c cid.Cid, d *pb.DataObj) ([]byte, error) {
+	if d.GetFilePath() != r.url {
+		r.close()
+		r.open(d.GetFilePath())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.body == nil || d.GetOffset() < r.pos {
+		// the blocks overlap, or reading the content failed
+		return fs.fm.readURLDataObj(c, d)
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, r.body, int64(d.GetOffset()-r.pos)); err != nil {
+		return nil, r.fail(err)
+	}
+	outbuf := make([]byte, d.GetSize_())
+	if _, err := io.ReadFull(r.body, outbuf); err != nil {
+		return nil, r.fail(err)
+	}
+	r.pos = d.GetOffset() + d.GetSize_()
+
+	if err := verifyData(c, d, outbuf); err != nil {
+		return nil, err
+	}
+	return outbuf, nil
+}
+
+func (r *urlReader) open(url string) {
+	r.url = url
+	r.pos = 0
+	r.err = nil
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		r.err = err
+		return
+	}
+	res, err := http.DefaultClient.Do(req.WithContext(r.ctx))
+	if err != nil {
+		r.err = &CorruptReferenceError{StatusFileError, err}
+		return
+	}
+	if err := urlStatusError(res); err != nil {
+		res.Body.Close()
+		r.err = err
+		return
+	}
+	r.body = res.Body
+}
+
+// fail stops reading the content after the error err. Content ending early
+// has changed, so that the next blocks are reported as changed too. The next
+// blocks are read with their own request after any other error.
+func (r *urlReader) fail(err error) error {
+	r.close()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		r.err = readURLError(err)
+		return r.err
+	}
+	return readURLError(err)
+}
+
+func (r *urlReader) close() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
@@ -64,6 +64,20 @@ type ListRes struct {
 	FilePath string
 	Offset   uint64
 	Size     uint64
+
+	// Dropped is set when the reference was removed by DropStale
+	Dropped bool `json:",omitempty"`
+
+	// Rechunked is the root of the file added again from the new contents
+	// of the backing file, when the reference was dropped because the file
+	// has changed and the file was re-chunked
+	Rechunked cid.Cid
+}
+
+// Stale returns true if the backing data of the block is gone or has
+// changed, so that the reference can't be used to read the block anymore.
+func (r *ListRes) Stale() bool {
+	return r.Status == StatusFileNotFound || r.Status == StatusFileChanged
 }
 
 // FormatLong returns a human readable string for a ListRes object.
@@ -116,6 +130,33 @@ func VerifyAll(fs *Filestore, fileOrder bool) (func() *ListRes, error) {
 	return listAll(fs, true)
 }
 
+// DropStale verifies the reference of r again, and removes it from the
+// FileManager of the given Filestore if it is still stale. The block is then
+// missing from the Filestore, and can be added again or fetched from the
+// network. References which can't be read for any other reason are kept, as
+// the problem may be transient. r is updated with the result of the new
+// verification, and Dropped is set if the reference was removed.
+func DropStale(fs *Filestore, r *ListRes) error {
+	if !r.Stale() {
+		return nil
+	}
+
+	// the block may have been added again since it was verified
+	*r = *list(fs, true, r.Key)
+	if !r.Stale() {
+		return nil
+	}
+
+	err := fs.fm.DeleteBlock(r.Key)
+	switch err {
+	case nil, blockstore.ErrNotFound:
+		r.Dropped = true
+		return nil
+	default:
+		return err
+	}
+}
+
 func list(fs *Filestore, verify bool, key cid.Cid) *ListRes {
 	dobj, err := fs.fm.getDataObj(key)
 	if err != nil {
@@ -166,6 +207,33 @@ func next(qr dsq.Results) (cid.Cid, *pb.DataObj, error) {
 }
 
 func listAllFileOrder(fs *Filestore, verify bool) (func() *ListRes, error) {
+	entries, err := sortedEntries(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	i := 0
+	return func() *ListRes {
+		if i >= len(entries) {
+			return nil
+		}
+		v := entries[i]
+		i++
+		cid, dobj, err := v.dataObj()
+		if err != nil {
+			return mkListRes(cid, dobj, err)
+		}
+		// finally verify the dataobj if requested
+		if verify {
+			_, err = fs.fm.readDataObj(cid, dobj)
+		}
+		return mkListRes(cid, dobj, err)
+	}, nil
+}
+
+// sortedEntries returns the references of the FileManager sorted by path
+// and offset.
+func sortedEntries(fs *Filestore) (listEntries, error) {
 	q := dsq.Query{}
 	qr, err := fs.fm.ds.Query(q)
 	if err != nil {
@@ -195,39 +263,7 @@ func listAllFileOrder(fs *Filestore, verify bool) (func() *ListRes, error) {
 		}
 	}
 	sort.Sort(entries)
-
-	i := 0
-	return func() *ListRes {
-		if i >= len(entries) {
-			return nil
-		}
-		v := entries[i]
-		i++
-		// attempt to convert the datastore key to a CID,
-		// store the error but don't use it yet
-		cid, keyErr := dshelp.DsKeyToCid(ds.RawKey(v.dsKey))
-		// first if they listRes already had an error return that error
-		if v.err != nil {
-			return mkListRes(cid, nil, v.err)
-		}
-		// now reconstruct the DataObj
-		dobj := pb.DataObj{
-			FilePath: v.filePath,
-			Offset:   v.offset,
-			Size_:    v.size,
-		}
-		// now if we could not convert the datastore key return that
-		// error
-		if keyErr != nil {
-			return mkListRes(cid, &dobj, keyErr)
-		}
-		// finally verify the dataobj if requested
-		var err error
-		if verify {
-			_, err = fs.fm.readDataObj(cid, &dobj)
-		}
-		return mkListRes(cid, &dobj, err)
-	}, nil
+	return entries, nil
 }
 
 type listEntry struct {
@@ -238,6 +274,26 @@ type listEntry struct {
 	err      error
 }
 
+// dataObj returns the cid and the reconstructed DataObj of the entry.
+func (v *listEntry) dataObj() (cid.Cid, *pb.DataObj, error) {
+	// attempt to convert the datastore key to a CID,
+	// store the error but don't use it yet
+	cid, keyErr := dshelp.DsKeyToCid(ds.RawKey(v.dsKey))
+	// first if they listRes already had an error return that error
+	if v.err != nil {
+		return cid, nil, v.err
+	}
+	// now reconstruct the DataObj
+	dobj := &pb.DataObj{
+		FilePath: v.filePath,
+		Offset:   v.offset,
+		Size_:    v.size,
+	}
+	// now if we could not convert the datastore key return that
+	// error
+	return cid, dobj, keyErr
+}
+
 type listEntries []*listEntry
 
 func (l listEntries) Len() int      { return len(l) }
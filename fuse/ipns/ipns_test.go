@@ -131,7 +131,7 @@ func setupIpnsTest(t *testing.T, node *core.IpfsNode) (*core.IpfsNode, *mountWra
 		}
 	}
 
-	fs, err := NewFileSystem(node, node.PrivateKey, "", "")
+	fs, err := NewFileSystem(node, node.PrivateKey, "", "", DefaultPublishDelay)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -494,3 +494,43 @@ func TestMultiWrite(t *testing.T) {
 		t.Fatal("File on disk did not match bytes written")
 	}
 }
+
+// Test that the changes are only published once synced
+func TestPublishOnFsync(t *testing.T) {
+	nd, mnt := setupIpnsTest(t, nil)
+	defer mnt.Close()
+
+	name := "/ipns/" + nd.Identity.Pretty()
+	before, err := nd.Namesys.Resolve(nd.Context(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Create(mnt.Dir + "/local/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	if _, err := fi.Write(randBytes(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := nd.Namesys.Resolve(nd.Context(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != before {
+		t.Fatal("expected the changes not to be published before the delay")
+	}
+
+	if err := fi.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	p, err = nd.Namesys.Resolve(nd.Context(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == before {
+		t.Fatal("expected the changes to be published on fsync")
+	}
+}
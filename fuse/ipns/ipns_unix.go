@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
+	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
 	namesys "github.com/ipfs/go-ipfs/namesys"
@@ -18,7 +20,6 @@ import (
 	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
 
 	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
-	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	fuse "gx/ipfs/QmSJBsmLP1XMjv8hxYg2rUMdPDB7YUpyBo9idjrJ6Cmq6F/fuse"
 	fs "gx/ipfs/QmSJBsmLP1XMjv8hxYg2rUMdPDB7YUpyBo9idjrJ6Cmq6F/fuse/fs"
 	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
@@ -42,13 +43,14 @@ type FileSystem struct {
 	RootNode *Root
 }
 
-// NewFileSystem constructs new fs using given core.IpfsNode instance.
-func NewFileSystem(ipfs *core.IpfsNode, sk ci.PrivKey, ipfspath, ipnspath string) (*FileSystem, error) {
+// NewFileSystem constructs new fs using given core.IpfsNode instance. The
+// changes are published once the mount has been quiet for delay.
+func NewFileSystem(ipfs *core.IpfsNode, sk ci.PrivKey, ipfspath, ipnspath string, delay time.Duration) (*FileSystem, error) {
 
 	kmap := map[string]ci.PrivKey{
 		"local": sk,
 	}
-	root, err := CreateRoot(ipfs, kmap, ipfspath, ipnspath)
+	root, err := CreateRoot(ipfs, kmap, ipfspath, ipnspath, delay)
 	if err != nil {
 		return nil, err
 	}
@@ -83,12 +85,6 @@ type Root struct {
 	LocalLinks map[string]*Link
 }
 
-func ipnsPubFunc(ipfs *core.IpfsNode, k ci.PrivKey) mfs.PubFunc {
-	return func(ctx context.Context, c cid.Cid) error {
-		return ipfs.Namesys.Publish(ctx, k, path.FromCid(c))
-	}
-}
-
 func loadRoot(ctx context.Context, rt *keyRoot, ipfs *core.IpfsNode, name string) (fs.Node, error) {
 	p, err := path.ParsePath("/ipns/" + name)
 	if err != nil {
@@ -111,23 +107,26 @@ func loadRoot(ctx context.Context, rt *keyRoot, ipfs *core.IpfsNode, name string
 		return nil, dag.ErrNotProtobuf
 	}
 
-	root, err := mfs.NewRoot(ctx, ipfs.DAG, pbnode, ipnsPubFunc(ipfs, rt.k))
+	root, err := mfs.NewRoot(ctx, ipfs.DAG, pbnode, rt.pub.pubFunc)
 	if err != nil {
 		return nil, err
 	}
 
 	rt.root = root
+	rt.pub.root = root
+	rt.pub.published = pbnode.Cid()
 
-	return &Directory{dir: root.GetDirectory()}, nil
+	return &Directory{dir: root.GetDirectory(), pub: rt.pub}, nil
 }
 
 type keyRoot struct {
 	k     ci.PrivKey
 	alias string
 	root  *mfs.Root
+	pub   *publisher
 }
 
-func CreateRoot(ipfs *core.IpfsNode, keys map[string]ci.PrivKey, ipfspath, ipnspath string) (*Root, error) {
+func CreateRoot(ipfs *core.IpfsNode, keys map[string]ci.PrivKey, ipfspath, ipnspath string, delay time.Duration) (*Root, error) {
 	ldirs := make(map[string]fs.Node)
 	roots := make(map[string]*keyRoot)
 	links := make(map[string]*Link)
@@ -138,7 +137,7 @@ func CreateRoot(ipfs *core.IpfsNode, keys map[string]ci.PrivKey, ipfspath, ipnsp
 		}
 		name := pid.Pretty()
 
-		kr := &keyRoot{k: k, alias: alias}
+		kr := &keyRoot{k: k, alias: alias, pub: newPublisher(ipfs, k, delay)}
 		fsn, err := loadRoot(ipfs.Context(), kr, ipfs, name)
 		if err != nil {
 			return nil, err
@@ -213,9 +212,14 @@ func (s *Root) Lookup(ctx context.Context, name string) (fs.Node, error) {
 	return nil, errors.New("invalid path from ipns record")
 }
 
+// Close publishes the last changes of the keys and closes their roots.
 func (r *Root) Close() error {
 	for _, mr := range r.Roots {
-		err := mr.root.Close()
+		err := mr.pub.close()
+		if err != nil {
+			return err
+		}
+		err = mr.root.Close()
 		if err != nil {
 			return err
 		}
@@ -259,15 +263,25 @@ func (r *Root) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 // Directory is wrapper over an mfs directory to satisfy the fuse fs interface
 type Directory struct {
 	dir *mfs.Directory
+	pub *publisher
 }
 
 type FileNode struct {
-	fi *mfs.File
+	fi  *mfs.File
+	pub *publisher
+
+	// handles are the handles open for writing, flushed on fsync
+	lk      sync.Mutex
+	handles map[*File]struct{}
 }
 
 // File is wrapper over an mfs file to satisfy the fuse fs interface
 type File struct {
-	fi mfs.FileDescriptor
+	fi   mfs.FileDescriptor
+	node *FileNode
+
+	// writable is set for the handles open for writing
+	writable bool
 }
 
 // Attr returns the attributes of a given node.
@@ -304,9 +318,9 @@ func (s *Directory) Lookup(ctx context.Context, name string) (fs.Node, error) {
 
 	switch child := child.(type) {
 	case *mfs.Directory:
-		return &Directory{dir: child}, nil
+		return &Directory{dir: child, pub: s.pub}, nil
 	case *mfs.File:
-		return &FileNode{fi: child}, nil
+		return &FileNode{fi: child, pub: s.pub}, nil
 	default:
 		// NB: if this happens, we do not want to continue, unpredictable behaviour
 		// may occur.
@@ -370,6 +384,7 @@ func (fi *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.Wr
 		return err
 	}
 	resp.Size = wrote
+	fi.node.pub.changed()
 	return nil
 }
 
@@ -397,17 +412,19 @@ func (fi *File) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fus
 			if err != nil {
 				return err
 			}
+			fi.node.pub.changed()
 		}
 	}
 	return nil
 }
 
-// Fsync flushes the content in the file to disk, but does not
-// update the dag tree internally
+// Fsync flushes the handles of the file open for writing, and publishes the
+// changes of the mount at once: it is the barrier to wait for the changes to
+// be published.
 func (fi *FileNode) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
 	errs := make(chan error, 1)
 	go func() {
-		errs <- fi.fi.Sync()
+		errs <- fi.sync(ctx)
 	}()
 	select {
 	case err := <-errs:
@@ -417,10 +434,35 @@ func (fi *FileNode) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
 	}
 }
 
-func (fi *File) Forget() {
-	err := fi.fi.Sync()
-	if err != nil {
-		log.Debug("forget file error: ", err)
+func (fi *FileNode) sync(ctx context.Context) error {
+	fi.lk.Lock()
+	handles := make([]*File, 0, len(fi.handles))
+	for h := range fi.handles {
+		handles = append(handles, h)
+	}
+	fi.lk.Unlock()
+
+	for _, h := range handles {
+		if err := h.fi.Flush(); err != nil {
+			return err
+		}
+	}
+	fi.pub.changed()
+	return fi.pub.sync(ctx)
+}
+
+// Fsync publishes the changes of the mount at once.
+func (dir *Directory) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	errs := make(chan error, 1)
+	go func() {
+		dir.pub.changed()
+		errs <- dir.pub.sync(ctx)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -429,8 +471,9 @@ func (dir *Directory) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Nod
 	if err != nil {
 		return nil, err
 	}
+	dir.pub.changed()
 
-	return &Directory{dir: child}, nil
+	return &Directory{dir: child, pub: dir.pub}, nil
 }
 
 func (fi *FileNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
@@ -446,7 +489,8 @@ func (fi *FileNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.
 		return nil, errors.New("unsupported flag type")
 	}
 
-	fd, err := fi.fi.Open(mfsflag, true)
+	// the writes are flushed to the root and published in batches
+	fd, err := fi.fi.Open(mfsflag, false)
 	if err != nil {
 		return nil, err
 	}
@@ -475,11 +519,34 @@ func (fi *FileNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.
 		}
 	}
 
-	return &File{fi: fd}, nil
+	return fi.newHandle(fd, !req.Flags.IsReadOnly()), nil
+}
+
+// newHandle returns a handle of fd, reporting it to the publisher if it is
+// writable.
+func (fi *FileNode) newHandle(fd mfs.FileDescriptor, writable bool) *File {
+	h := &File{fi: fd, node: fi, writable: writable}
+	if writable {
+		fi.lk.Lock()
+		if fi.handles == nil {
+			fi.handles = make(map[*File]struct{})
+		}
+		fi.handles[h] = struct{}{}
+		fi.lk.Unlock()
+		fi.pub.opened()
+	}
+	return h
 }
 
 func (fi *File) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
-	return fi.fi.Close()
+	err := fi.fi.Close()
+	if fi.writable {
+		fi.node.lk.Lock()
+		delete(fi.node.handles, fi)
+		fi.node.lk.Unlock()
+		fi.node.pub.released()
+	}
+	return err
 }
 
 func (dir *Directory) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
@@ -489,6 +556,7 @@ func (dir *Directory) Create(ctx context.Context, req *fuse.CreateRequest, resp
 	if err != nil {
 		return nil, nil, err
 	}
+	dir.pub.changed()
 
 	child, err := dir.dir.Child(req.Name)
 	if err != nil {
@@ -500,7 +568,7 @@ func (dir *Directory) Create(ctx context.Context, req *fuse.CreateRequest, resp
 		return nil, nil, errors.New("child creation failed")
 	}
 
-	nodechild := &FileNode{fi: fi}
+	nodechild := &FileNode{fi: fi, pub: dir.pub}
 
 	var openflag int
 	switch {
@@ -514,12 +582,12 @@ func (dir *Directory) Create(ctx context.Context, req *fuse.CreateRequest, resp
 		return nil, nil, errors.New("unsupported open mode")
 	}
 
-	fd, err := fi.Open(openflag, true)
+	fd, err := fi.Open(openflag, false)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return nodechild, &File{fi: fd}, nil
+	return nodechild, nodechild.newHandle(fd, !req.Flags.IsReadOnly()), nil
 }
 
 func (dir *Directory) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
@@ -527,6 +595,7 @@ func (dir *Directory) Remove(ctx context.Context, req *fuse.RemoveRequest) error
 	if err != nil {
 		return fuse.ENOENT
 	}
+	dir.pub.changed()
 	return nil
 }
 
@@ -553,6 +622,7 @@ func (dir *Directory) Rename(ctx context.Context, req *fuse.RenameRequest, newDi
 		if err != nil {
 			return err
 		}
+		dir.pub.changed()
 	case *FileNode:
 		log.Error("Cannot move node into a file!")
 		return fuse.EPERM
@@ -583,6 +653,7 @@ type ipnsDirectory interface {
 	fs.HandleReadDirAller
 	fs.Node
 	fs.NodeCreater
+	fs.NodeFsyncer
 	fs.NodeMkdirer
 	fs.NodeRemover
 	fs.NodeRenamer
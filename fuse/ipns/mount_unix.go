@@ -17,7 +17,12 @@ func Mount(ipfs *core.IpfsNode, ipnsmp, ipfsmp string) (mount.Mount, error) {
 
 	allow_other := cfg.Mounts.FuseAllowOther
 
-	fsys, err := NewFileSystem(ipfs, ipfs.PrivateKey, ipfsmp, ipnsmp)
+	delay, err := publishDelay(ipfs.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	fsys, err := NewFileSystem(ipfs, ipfs.PrivateKey, ipfsmp, ipnsmp, delay)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,188 @@
+// +build !nofuse
+
+package ipns
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	path "gx/ipfs/QmZErC2Ay6WuGi96CPg316PwitdwgLo6RxZRqVjJjRj2MR/go-path"
+)
+
+// DefaultPublishDelay is the time the mount must be quiet before its changes
+// are published, unless set by the Mounts.IPNSPublishDelay key.
+const DefaultPublishDelay = 10 * time.Second
+
+const publishDelayKey = "Mounts.IPNSPublishDelay"
+
+// publishDelay reads the optional Mounts.IPNSPublishDelay key.
+func publishDelay(r repo.Repo) (time.Duration, error) {
+	val, err := r.GetConfigKey(publishDelayKey)
+	if err != nil {
+		return DefaultPublishDelay, nil // not set
+	}
+
+	s, ok := val.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid value for %s: expected a duration, got %v", publishDelayKey, val)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for %s: %s", publishDelayKey, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid value for %s: the delay can't be negative", publishDelayKey)
+	}
+	return d, nil
+}
+
+// publisher batches the changes made to the root of a key: they are flushed
+// to the root and published once the mount has been quiet for the delay and
+// no file is open for writing, or at once on fsync. Publishing a record is
+// slow, publishing on each write made the mount unusable to edit sites.
+type publisher struct {
+	ipfs  *core.IpfsNode
+	k     ci.PrivKey
+	root  *mfs.Root
+	delay time.Duration
+
+	// publk serializes the publications
+	publk sync.Mutex
+
+	lk        sync.Mutex
+	timer     *time.Timer
+	dirty     bool
+	writers   int
+	published cid.Cid
+	closed    bool
+}
+
+func newPublisher(ipfs *core.IpfsNode, k ci.PrivKey, delay time.Duration) *publisher {
+	return &publisher{ipfs: ipfs, k: k, delay: delay}
+}
+
+// pubFunc is the function the root publishes with. It only schedules the
+// publication, the root of MFS calling it on its own changes.
+func (p *publisher) pubFunc(ctx context.Context, c cid.Cid) error {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if !c.Equals(p.published) {
+		p.scheduleLocked()
+	}
+	return nil
+}
+
+// changed reports a change of the mount, delaying the publication.
+func (p *publisher) changed() {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.dirty = true
+	p.scheduleLocked()
+}
+
+// opened reports a file opened for writing, the changes aren't published
+// while files are open for writing, unless on fsync.
+func (p *publisher) opened() {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.writers++
+}
+
+// released reports a file opened for writing closed.
+func (p *publisher) released() {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.writers--
+	p.dirty = true
+	p.scheduleLocked()
+}
+
+func (p *publisher) scheduleLocked() {
+	if p.closed {
+		return
+	}
+	if p.timer == nil {
+		p.timer = time.AfterFunc(p.delay, p.publishQuiet)
+		return
+	}
+	p.timer.Reset(p.delay)
+}
+
+// publishQuiet publishes the changes once the delay elapsed, trying again
+// after the delay on failure.
+func (p *publisher) publishQuiet() {
+	p.lk.Lock()
+	if p.closed || p.writers > 0 {
+		p.lk.Unlock()
+		return
+	}
+	p.lk.Unlock()
+
+	if err := p.sync(p.ipfs.Context()); err != nil {
+		log.Errorf("ipns: publishing the mount: %s", err)
+		p.lk.Lock()
+		p.scheduleLocked()
+		p.lk.Unlock()
+	}
+}
+
+// sync flushes the changes to the root and publishes it, if it changed since
+// its last publication.
+func (p *publisher) sync(ctx context.Context) error {
+	p.publk.Lock()
+	defer p.publk.Unlock()
+
+	p.lk.Lock()
+	dirty := p.dirty
+	p.dirty = false
+	p.lk.Unlock()
+
+	dir := p.root.GetDirectory()
+	if dirty {
+		if err := dir.Flush(); err != nil {
+			p.lk.Lock()
+			p.dirty = true
+			p.lk.Unlock()
+			return err
+		}
+	}
+	nd, err := dir.GetNode()
+	if err != nil {
+		return err
+	}
+
+	p.lk.Lock()
+	published := p.published
+	p.lk.Unlock()
+	if nd.Cid().Equals(published) {
+		return nil
+	}
+
+	if err := p.ipfs.Namesys.Publish(ctx, p.k, path.FromCid(nd.Cid())); err != nil {
+		return err
+	}
+	p.lk.Lock()
+	p.published = nd.Cid()
+	p.lk.Unlock()
+	return nil
+}
+
+// close publishes the last changes and stops the publications.
+func (p *publisher) close() error {
+	p.lk.Lock()
+	p.closed = true
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.lk.Unlock()
+
+	return p.sync(p.ipfs.Context())
+}
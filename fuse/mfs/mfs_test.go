@@ -0,0 +1,119 @@
+// +build !nofuse
+
+package mfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	core "github.com/ipfs/go-ipfs/core"
+
+	ci "gx/ipfs/QmPuhRE325DR8ChNcFtgd6F1eANCHy1oohXZPpYop4xsK6/go-testutil/ci"
+	fstest "gx/ipfs/QmSJBsmLP1XMjv8hxYg2rUMdPDB7YUpyBo9idjrJ6Cmq6F/fuse/fs/fstestutil"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+func maybeSkipFuseTests(t *testing.T) {
+	if ci.NoFuse() {
+		t.Skip("Skipping FUSE tests")
+	}
+}
+
+func setupMfsTest(t *testing.T) (*core.IpfsNode, *fstest.Mount) {
+	maybeSkipFuseTests(t)
+
+	node, err := core.NewNode(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := NewFileSystem(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mnt, err := fstest.MountedT(t, fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node, mnt
+}
+
+func TestMfsWriteRead(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	nd, mnt := setupMfsTest(t)
+	defer mnt.Close()
+
+	if err := os.MkdirAll(mnt.Dir+"/a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("hello mfs")
+	if err := ioutil.WriteFile(mnt.Dir+"/a/b/file", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the file shows up in MFS
+	fsn, err := mfs.Lookup(nd.FilesRoot, "/a/b/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := fsn.(*mfs.File).Open(mfs.OpenReadOnly, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(fd)
+	fd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("expected %q in MFS, got %q", data, out)
+	}
+
+	if err := os.Rename(mnt.Dir+"/a/b/file", mnt.Dir+"/a/moved"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = ioutil.ReadFile(mnt.Dir + "/a/moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("expected %q after the rename, got %q", data, out)
+	}
+
+	if err := os.Remove(mnt.Dir + "/a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(mnt.Dir + "/a"); err == nil {
+		t.Fatal("expected removing a directory with entries to fail")
+	}
+	if _, err := mfs.Lookup(nd.FilesRoot, "/a/b"); err != os.ErrNotExist {
+		t.Fatalf("expected /a/b to be removed from MFS, got %v", err)
+	}
+}
+
+func TestMfsChmod(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	_, mnt := setupMfsTest(t)
+	defer mnt.Close()
+
+	fname := mnt.Dir + "/file"
+	if err := ioutil.WriteFile(fname, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(fname, 0600); err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %o", st.Mode().Perm())
+	}
+}
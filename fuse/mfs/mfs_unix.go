@@ -0,0 +1,618 @@
+// +build !nofuse
+
+// package fuse/mfs implements a writable fuse filesystem exposing the mutable
+// filesystem of the node, MFS, as managed by 'ipfs files'.
+package mfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	gopath "path"
+	"syscall"
+
+	core "github.com/ipfs/go-ipfs/core"
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+
+	fuse "gx/ipfs/QmSJBsmLP1XMjv8hxYg2rUMdPDB7YUpyBo9idjrJ6Cmq6F/fuse"
+	fs "gx/ipfs/QmSJBsmLP1XMjv8hxYg2rUMdPDB7YUpyBo9idjrJ6Cmq6F/fuse/fs"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+)
+
+var log = logging.Logger("fuse/mfs")
+
+// The modes of the entries without a mode set by 'ipfs files chmod'.
+const (
+	defaultDirMode  = 0755
+	defaultFileMode = 0644
+)
+
+// FileSystem is the writable MFS Fuse Filesystem.
+//
+// Its nodes are looked up by path in MFS on each operation, so that they
+// follow the changes made with 'ipfs files' and the conversions of the
+// directories to HAMT shards.
+type FileSystem struct {
+	Ipfs *core.IpfsNode
+}
+
+// NewFileSystem constructs new fs using given core.IpfsNode instance.
+func NewFileSystem(ipfs *core.IpfsNode) (*FileSystem, error) {
+	if ipfs.FilesRoot == nil {
+		return nil, errors.New("fuse/mfs: the node has no MFS root")
+	}
+	return &FileSystem{Ipfs: ipfs}, nil
+}
+
+// Root constructs the Root of the filesystem, the root directory of MFS.
+func (f *FileSystem) Root() (fs.Node, error) {
+	return &Directory{fsys: f, path: "/"}, nil
+}
+
+// lockFilesRoot holds the lock of the changes of MFS shared during a change,
+// so that the root of a batch is never swapped in during it.
+func (f *FileSystem) lockFilesRoot() {
+	f.Ipfs.FilesLock.RLock()
+}
+
+func (f *FileSystem) unlockFilesRoot() {
+	f.Ipfs.FilesLock.RUnlock()
+}
+
+// writeBack returns true if the changes are left to the flusher of the node.
+func (f *FileSystem) writeBack() bool {
+	return f.Ipfs.FilesFlusher.WriteBack()
+}
+
+// lookup returns the entry of MFS at path.
+func (f *FileSystem) lookup(path string) (mfs.FSNode, error) {
+	fsn, err := mfs.Lookup(f.Ipfs.FilesRoot, path)
+	if err == os.ErrNotExist {
+		return nil, fuse.ENOENT
+	}
+	return fsn, err
+}
+
+func (f *FileSystem) lookupDir(path string) (*mfs.Directory, error) {
+	fsn, err := f.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := fsn.(*mfs.Directory)
+	if !ok {
+		return nil, fuse.Errno(syscall.ENOTDIR)
+	}
+	return dir, nil
+}
+
+func (f *FileSystem) lookupFile(path string) (*mfs.File, error) {
+	fsn, err := f.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, ok := fsn.(*mfs.File)
+	if !ok {
+		return nil, fuse.Errno(syscall.EISDIR)
+	}
+	return fi, nil
+}
+
+// flushDir flushes the changes of dir up to the root, unless they are left
+// to the flusher of the node.
+func (f *FileSystem) flushDir(dir *mfs.Directory) error {
+	if f.writeBack() {
+		return nil
+	}
+	return dir.Flush()
+}
+
+// changed reports the change of the entries at paths to the node: the
+// parents of the entries added or removed may be converted to or from HAMT
+// shards, the watchers of MFS are notified, and the flusher counts the
+// change.
+func (f *FileSystem) changed(ctx context.Context, op string, resized bool, path, from string) {
+	n := f.Ipfs
+	if resized {
+		paths := []string{path}
+		if from != "" {
+			paths = append(paths, from)
+		}
+		corefiles.AutoShardParents(ctx, n.FilesRoot, n.DAG, n.FilesShardSize, paths...)
+	}
+	n.FilesEvents.NotifyChange(n.FilesRoot, op, path, from)
+	n.FilesFlusher.Changed()
+}
+
+// setAttr applies the mode and the modification time of req to the entry at
+// path.
+func (f *FileSystem) setAttr(ctx context.Context, path string, req *fuse.SetattrRequest) error {
+	flush := !f.writeBack()
+	if req.Valid.Mode() {
+		err := corefiles.Chmod(f.Ipfs.FilesRoot, path, uint32(req.Mode.Perm()), flush)
+		if err != nil {
+			return err
+		}
+		f.changed(ctx, corefiles.OpChmod, false, path, "")
+	}
+	if req.Valid.Mtime() {
+		err := corefiles.Touch(f.Ipfs.FilesRoot, path, req.Mtime, flush)
+		if err != nil {
+			return err
+		}
+		f.changed(ctx, corefiles.OpTouch, false, path, "")
+	}
+	return nil
+}
+
+// setMetadataAttr sets the mode and the modification time of a, from the
+// metadata of nd or the defaults.
+func setMetadataAttr(a *fuse.Attr, nd ipld.Node, mode os.FileMode) error {
+	md, err := corefiles.ReadMetadata(nd)
+	if err != nil {
+		return err
+	}
+	if md.Mode != 0 {
+		mode = os.FileMode(md.Mode & 0777)
+	}
+	a.Mode |= mode
+	a.Mtime = md.Mtime
+	a.Uid = uint32(os.Getuid())
+	a.Gid = uint32(os.Getgid())
+	return nil
+}
+
+// Directory is a directory of MFS.
+type Directory struct {
+	fsys *FileSystem
+	path string
+}
+
+// Attr returns the attributes of a given node.
+func (d *Directory) Attr(ctx context.Context, a *fuse.Attr) error {
+	dir, err := d.fsys.lookupDir(d.path)
+	if err != nil {
+		return err
+	}
+	nd, err := dir.GetNode()
+	if err != nil {
+		return err
+	}
+	a.Mode = os.ModeDir
+	return setMetadataAttr(a, nd, defaultDirMode)
+}
+
+// Setattr sets the mode and the modification time of the directory.
+func (d *Directory) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	d.fsys.lockFilesRoot()
+	defer d.fsys.unlockFilesRoot()
+
+	if d.path == "/" {
+		return fuse.EPERM
+	}
+	return d.fsys.setAttr(ctx, d.path, req)
+}
+
+// Lookup performs a lookup under this node.
+func (d *Directory) Lookup(ctx context.Context, name string) (fs.Node, error) {
+	switch name {
+	case "mach_kernel", ".hidden", "._.":
+		// Just quiet some log noise on OS X.
+		return nil, fuse.ENOENT
+	}
+
+	path := gopath.Join(d.path, name)
+	child, err := d.fsys.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch child.(type) {
+	case *mfs.Directory:
+		return &Directory{fsys: d.fsys, path: path}, nil
+	case *mfs.File:
+		return &FileNode{fsys: d.fsys, path: path}, nil
+	default:
+		return nil, fuse.EIO
+	}
+}
+
+// ReadDirAll reads the entries of the directory.
+func (d *Directory) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	dir, err := d.fsys.lookupDir(d.path)
+	if err != nil {
+		return nil, err
+	}
+	listing, err := dir.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]fuse.Dirent, 0, len(listing))
+	for _, entry := range listing {
+		dirent := fuse.Dirent{Name: entry.Name}
+		switch mfs.NodeType(entry.Type) {
+		case mfs.TDir:
+			dirent.Type = fuse.DT_Dir
+		case mfs.TFile:
+			dirent.Type = fuse.DT_File
+		}
+		entries = append(entries, dirent)
+	}
+	return entries, nil
+}
+
+// Mkdir creates a directory under this node.
+func (d *Directory) Mkdir(ctx context.Context, req *fuse.MkdirRequest) (fs.Node, error) {
+	d.fsys.lockFilesRoot()
+	defer d.fsys.unlockFilesRoot()
+
+	dir, err := d.fsys.lookupDir(d.path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dir.Mkdir(req.Name); err != nil {
+		return nil, err
+	}
+	if err := d.fsys.flushDir(dir); err != nil {
+		return nil, err
+	}
+
+	path := gopath.Join(d.path, req.Name)
+	d.fsys.changed(ctx, corefiles.OpMkdir, true, path, "")
+	return &Directory{fsys: d.fsys, path: path}, nil
+}
+
+// Create creates an empty file under this node and opens it.
+func (d *Directory) Create(ctx context.Context, req *fuse.CreateRequest, resp *fuse.CreateResponse) (fs.Node, fs.Handle, error) {
+	d.fsys.lockFilesRoot()
+	defer d.fsys.unlockFilesRoot()
+
+	dir, err := d.fsys.lookupDir(d.path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nd := dag.NodeWithData(ft.FilePBData(nil, 0))
+	nd.SetCidBuilder(dir.GetCidBuilder())
+	if err := dir.AddChild(req.Name, nd); err != nil {
+		return nil, nil, err
+	}
+	if err := d.fsys.flushDir(dir); err != nil {
+		return nil, nil, err
+	}
+
+	path := gopath.Join(d.path, req.Name)
+	d.fsys.changed(ctx, corefiles.OpWrite, true, path, "")
+
+	node := &FileNode{fsys: d.fsys, path: path}
+	handle, err := node.open(req.Flags)
+	if err != nil {
+		return nil, nil, err
+	}
+	return node, handle, nil
+}
+
+// Remove removes the entry named req.Name from this node.
+func (d *Directory) Remove(ctx context.Context, req *fuse.RemoveRequest) error {
+	d.fsys.lockFilesRoot()
+	defer d.fsys.unlockFilesRoot()
+
+	dir, err := d.fsys.lookupDir(d.path)
+	if err != nil {
+		return err
+	}
+	child, err := dir.Child(req.Name)
+	if err != nil {
+		return fuse.ENOENT
+	}
+
+	switch child := child.(type) {
+	case *mfs.Directory:
+		if !req.Dir {
+			return fuse.Errno(syscall.EISDIR)
+		}
+		names, err := child.ListNames(ctx)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return fuse.Errno(syscall.ENOTEMPTY)
+		}
+	default:
+		if req.Dir {
+			return fuse.Errno(syscall.ENOTDIR)
+		}
+	}
+
+	if err := dir.Unlink(req.Name); err != nil {
+		return err
+	}
+	if err := d.fsys.flushDir(dir); err != nil {
+		return err
+	}
+	d.fsys.changed(ctx, corefiles.OpRemove, true, gopath.Join(d.path, req.Name), "")
+	return nil
+}
+
+// Rename moves the entry req.OldName of this node to req.NewName in newDir,
+// replacing the file or the empty directory found there.
+func (d *Directory) Rename(ctx context.Context, req *fuse.RenameRequest, newDir fs.Node) error {
+	d.fsys.lockFilesRoot()
+	defer d.fsys.unlockFilesRoot()
+
+	nd, ok := newDir.(*Directory)
+	if !ok {
+		return fuse.Errno(syscall.ENOTDIR)
+	}
+	src := gopath.Join(d.path, req.OldName)
+	dst := gopath.Join(nd.path, req.NewName)
+	if src == dst {
+		return nil
+	}
+
+	dstDir, err := d.fsys.lookupDir(nd.path)
+	if err != nil {
+		return err
+	}
+	existing, err := dstDir.Child(req.NewName)
+	switch err {
+	case nil:
+		if dir, ok := existing.(*mfs.Directory); ok {
+			names, err := dir.ListNames(ctx)
+			if err != nil {
+				return err
+			}
+			if len(names) > 0 {
+				return fuse.Errno(syscall.ENOTEMPTY)
+			}
+		}
+		// mfs.Mv would move the entry into an existing directory
+		if err := dstDir.Unlink(req.NewName); err != nil {
+			return err
+		}
+	case os.ErrNotExist:
+	default:
+		return err
+	}
+
+	if err := mfs.Mv(d.fsys.Ipfs.FilesRoot, src, dst); err != nil {
+		return err
+	}
+	for _, p := range []string{d.path, nd.path} {
+		dir, err := d.fsys.lookupDir(p)
+		if err != nil {
+			return err
+		}
+		if err := d.fsys.flushDir(dir); err != nil {
+			return err
+		}
+	}
+	d.fsys.changed(ctx, corefiles.OpMove, true, dst, src)
+	return nil
+}
+
+// FileNode is a file of MFS.
+type FileNode struct {
+	fsys *FileSystem
+	path string
+}
+
+// Attr returns the attributes of a given node.
+func (fi *FileNode) Attr(ctx context.Context, a *fuse.Attr) error {
+	file, err := fi.fsys.lookupFile(fi.path)
+	if err != nil {
+		return err
+	}
+	size, err := file.Size()
+	if err != nil {
+		// In this case, the dag node in question may not be unixfs
+		return fmt.Errorf("fuse/mfs: failed to get file.Size(): %s", err)
+	}
+	nd, err := file.GetNode()
+	if err != nil {
+		return err
+	}
+	a.Size = uint64(size)
+	return setMetadataAttr(a, nd, defaultFileMode)
+}
+
+// Setattr truncates the file and sets its mode and its modification time.
+func (fi *FileNode) Setattr(ctx context.Context, req *fuse.SetattrRequest, resp *fuse.SetattrResponse) error {
+	fi.fsys.lockFilesRoot()
+	defer fi.fsys.unlockFilesRoot()
+
+	if req.Valid.Size() {
+		file, err := fi.fsys.lookupFile(fi.path)
+		if err != nil {
+			return err
+		}
+		fd, err := file.Open(mfs.OpenWriteOnly, !fi.fsys.writeBack())
+		if err != nil {
+			return err
+		}
+		err = fd.Truncate(int64(req.Size))
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fi.fsys.changed(ctx, corefiles.OpWrite, false, fi.path, "")
+	}
+	return fi.fsys.setAttr(ctx, fi.path, req)
+}
+
+// Fsync flushes the file up to the root of MFS and waits for the root to be
+// published, even in write-back mode.
+func (fi *FileNode) Fsync(ctx context.Context, req *fuse.FsyncRequest) error {
+	fi.fsys.lockFilesRoot()
+	defer fi.fsys.unlockFilesRoot()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- mfs.FlushPath(fi.fsys.Ipfs.FilesRoot, fi.path)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Open opens the file.
+func (fi *FileNode) Open(ctx context.Context, req *fuse.OpenRequest, resp *fuse.OpenResponse) (fs.Handle, error) {
+	return fi.open(req.Flags)
+}
+
+func (fi *FileNode) open(flags fuse.OpenFlags) (*File, error) {
+	var mfsflag int
+	switch {
+	case flags.IsReadOnly():
+		mfsflag = mfs.OpenReadOnly
+	case flags.IsWriteOnly():
+		mfsflag = mfs.OpenWriteOnly
+	case flags.IsReadWrite():
+		mfsflag = mfs.OpenReadWrite
+	default:
+		return nil, errors.New("unsupported flag type")
+	}
+
+	file, err := fi.fsys.lookupFile(fi.path)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := file.Open(mfsflag, !fi.fsys.writeBack())
+	if err != nil {
+		return nil, err
+	}
+
+	h := &File{node: fi, fd: fd}
+	if flags&fuse.OpenTruncate != 0 && !flags.IsReadOnly() {
+		if err := fd.Truncate(0); err != nil {
+			fd.Close()
+			return nil, err
+		}
+		h.written = true
+	} else if flags&fuse.OpenAppend != 0 && !flags.IsReadOnly() {
+		if _, err := fd.Seek(0, io.SeekEnd); err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// File is an open file of MFS.
+type File struct {
+	node    *FileNode
+	fd      mfs.FileDescriptor
+	written bool
+}
+
+// Read reads the file at req.Offset.
+func (f *File) Read(ctx context.Context, req *fuse.ReadRequest, resp *fuse.ReadResponse) error {
+	if _, err := f.fd.Seek(req.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	size, err := f.fd.Size()
+	if err != nil {
+		return err
+	}
+	if req.Offset >= size {
+		resp.Data = resp.Data[:0]
+		return nil
+	}
+
+	readsize := req.Size
+	if rest := size - req.Offset; rest < int64(readsize) {
+		readsize = int(rest)
+	}
+	n, err := f.fd.CtxReadFull(ctx, resp.Data[:readsize])
+	resp.Data = resp.Data[:n]
+	return err
+}
+
+// Write writes req.Data to the file at req.Offset.
+func (f *File) Write(ctx context.Context, req *fuse.WriteRequest, resp *fuse.WriteResponse) error {
+	f.node.fsys.lockFilesRoot()
+	defer f.node.fsys.unlockFilesRoot()
+
+	wrote, err := f.fd.WriteAt(req.Data, req.Offset)
+	if err != nil {
+		return err
+	}
+	f.written = true
+	resp.Size = wrote
+	return nil
+}
+
+// Flush flushes the writes of the handle to the file.
+func (f *File) Flush(ctx context.Context, req *fuse.FlushRequest) error {
+	f.node.fsys.lockFilesRoot()
+	defer f.node.fsys.unlockFilesRoot()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- f.fd.Flush()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release closes the handle, reporting the change of the file if it was
+// written.
+func (f *File) Release(ctx context.Context, req *fuse.ReleaseRequest) error {
+	f.node.fsys.lockFilesRoot()
+	defer f.node.fsys.unlockFilesRoot()
+
+	if err := f.fd.Close(); err != nil {
+		return err
+	}
+	if f.written {
+		f.node.fsys.changed(ctx, corefiles.OpWrite, false, f.node.path, "")
+	}
+	return nil
+}
+
+// to check that out Node implements all the interfaces we want
+type mfsDirectory interface {
+	fs.HandleReadDirAller
+	fs.Node
+	fs.NodeCreater
+	fs.NodeMkdirer
+	fs.NodeRemover
+	fs.NodeRenamer
+	fs.NodeSetattrer
+	fs.NodeStringLookuper
+}
+
+var _ mfsDirectory = (*Directory)(nil)
+
+type mfsFileNode interface {
+	fs.Node
+	fs.NodeFsyncer
+	fs.NodeOpener
+	fs.NodeSetattrer
+}
+
+var _ mfsFileNode = (*FileNode)(nil)
+
+type mfsFile interface {
+	fs.HandleFlusher
+	fs.HandleReader
+	fs.HandleWriter
+	fs.HandleReleaser
+}
+
+var _ mfsFile = (*File)(nil)
@@ -11,3 +11,7 @@ import (
 func Mount(node *core.IpfsNode, fsdir, nsdir string) error {
 	return errors.New("not compiled in")
 }
+
+func MountMFS(node *core.IpfsNode, mfsdir string) error {
+	return errors.New("not compiled in")
+}
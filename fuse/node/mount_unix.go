@@ -10,6 +10,7 @@ import (
 
 	core "github.com/ipfs/go-ipfs/core"
 	ipns "github.com/ipfs/go-ipfs/fuse/ipns"
+	mfsfuse "github.com/ipfs/go-ipfs/fuse/mfs"
 	mount "github.com/ipfs/go-ipfs/fuse/mount"
 	rofs "github.com/ipfs/go-ipfs/fuse/readonly"
 
@@ -48,21 +49,40 @@ func Mount(node *core.IpfsNode, fsdir, nsdir string) error {
 	return doMount(node, fsdir, nsdir)
 }
 
-func doMount(node *core.IpfsNode, fsdir, nsdir string) error {
-	fmtFuseErr := func(err error, mountpoint string) error {
-		s := err.Error()
-		if strings.Contains(s, fuseNoDirectory) {
-			s = strings.Replace(s, `fusermount: "fusermount:`, "", -1)
-			s = strings.Replace(s, `\n", exit status 1`, "", -1)
-			return errors.New(s)
-		}
-		if s == fuseExitStatus1 {
-			s = fmt.Sprintf("fuse failed to access mountpoint %s", mountpoint)
-			return errors.New(s)
-		}
+// MountMFS mounts MFS, writable, at mfsdir.
+func MountMFS(node *core.IpfsNode, mfsdir string) error {
+	if node.Mounts.Mfs != nil && node.Mounts.Mfs.IsActive() {
+		node.Mounts.Mfs.Unmount()
+	}
+
+	if err := platformFuseChecks(node); err != nil {
 		return err
 	}
 
+	mfsmount, err := mfsfuse.Mount(node, mfsdir)
+	if err != nil {
+		log.Errorf("error mounting: %s", err)
+		return fmtFuseErr(err, mfsdir)
+	}
+	node.Mounts.Mfs = mfsmount
+	return nil
+}
+
+func fmtFuseErr(err error, mountpoint string) error {
+	s := err.Error()
+	if strings.Contains(s, fuseNoDirectory) {
+		s = strings.Replace(s, `fusermount: "fusermount:`, "", -1)
+		s = strings.Replace(s, `\n", exit status 1`, "", -1)
+		return errors.New(s)
+	}
+	if s == fuseExitStatus1 {
+		s = fmt.Sprintf("fuse failed to access mountpoint %s", mountpoint)
+		return errors.New(s)
+	}
+	return err
+}
+
+func doMount(node *core.IpfsNode, fsdir, nsdir string) error {
 	// this sync stuff is so that both can be mounted simultaneously.
 	var fsmount, nsmount mount.Mount
 	var err1, err2 error
@@ -9,3 +9,9 @@ func Mount(node *core.IpfsNode, fsdir, nsdir string) error {
 	// currently a no-op, but we don't want to return an error
 	return nil
 }
+
+func MountMFS(node *core.IpfsNode, mfsdir string) error {
+	// TODO
+	// currently a no-op, but we don't want to return an error
+	return nil
+}
@@ -1,12 +1,15 @@
 package keystore
 
 import (
+	"crypto/cipher"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 
+	encds "github.com/ipfs/go-ipfs/thirdparty/encds"
+
 	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
 	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
 )
@@ -31,9 +34,15 @@ type Keystore interface {
 var ErrNoSuchKey = fmt.Errorf("no key by the given name was found")
 var ErrKeyExists = fmt.Errorf("key by that name already exists, refusing to overwrite")
 
+// encryptedMarker is created in the directory of encrypted keystores.
+const encryptedMarker = ".encrypted"
+
 // FSKeystore is a keystore backed by files in a given directory stored on disk.
 type FSKeystore struct {
 	dir string
+
+	// aead encrypts the key files, if not nil
+	aead cipher.AEAD
 }
 
 func validateName(name string) error {
@@ -63,7 +72,68 @@ func NewFSKeystore(dir string) (*FSKeystore, error) {
 		}
 	}
 
-	return &FSKeystore{dir}, nil
+	return &FSKeystore{dir: dir}, nil
+}
+
+// NewEncryptedFSKeystore returns a keystore encrypting the key files in dir
+// with aead. Unencrypted keys found in dir the first time are encrypted.
+func NewEncryptedFSKeystore(dir string, aead cipher.AEAD) (*FSKeystore, error) {
+	ks, err := NewFSKeystore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	marker := filepath.Join(dir, encryptedMarker)
+	if _, err := os.Stat(marker); os.IsNotExist(err) {
+		if err := encryptKeys(ks, aead); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(marker, nil, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	ks.aead = aead
+	return ks, nil
+}
+
+// encryptKeys encrypts the unencrypted keys of a keystore. Keys already
+// encrypted, e.g. by an interrupted run, are left untouched.
+func encryptKeys(ks *FSKeystore, aead cipher.AEAD) error {
+	names, err := ks.List()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		kp := filepath.Join(ks.dir, name)
+		data, err := ioutil.ReadFile(kp)
+		if err != nil {
+			return err
+		}
+		if _, err := encds.Open(aead, data, []byte(name)); err == nil {
+			continue
+		}
+		if _, err := ci.UnmarshalPrivateKey(data); err != nil {
+			return fmt.Errorf("failed to encrypt key %s: %s", name, err)
+		}
+
+		sealed, err := encds.Seal(aead, data, []byte(name))
+		if err != nil {
+			return err
+		}
+		tmp := filepath.Join(ks.dir, "."+name+".tmp")
+		if err := ioutil.WriteFile(tmp, sealed, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, kp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return nil
 }
 
 // Has returns whether or not a key exist in the Keystore
@@ -97,6 +167,12 @@ func (ks *FSKeystore) Put(name string, k ci.PrivKey) error {
 	if err != nil {
 		return err
 	}
+	if ks.aead != nil {
+		b, err = encds.Seal(ks.aead, b, []byte(name))
+		if err != nil {
+			return err
+		}
+	}
 
 	kp := filepath.Join(ks.dir, name)
 
@@ -134,6 +210,12 @@ func (ks *FSKeystore) Get(name string) (ci.PrivKey, error) {
 		}
 		return nil, err
 	}
+	if ks.aead != nil {
+		data, err = encds.Open(ks.aead, data, []byte(name))
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return ci.UnmarshalPrivateKey(data)
 }
@@ -164,6 +246,9 @@ func (ks *FSKeystore) List() ([]string, error) {
 	list := make([]string, 0, len(dirs))
 
 	for _, name := range dirs {
+		if name == encryptedMarker {
+			continue
+		}
 		err := validateName(name)
 		if err == nil {
 			list = append(list, name)
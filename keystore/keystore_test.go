@@ -9,6 +9,8 @@ import (
 	"sort"
 	"testing"
 
+	encds "github.com/ipfs/go-ipfs/thirdparty/encds"
+
 	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
 )
 
@@ -271,3 +273,70 @@ func assertDirContents(dir string, exp []string) error {
 	}
 	return nil
 }
+
+func TestEncryptedKeystore(t *testing.T) {
+	tdir, err := ioutil.TempDir("", "keystore-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tdir)
+
+	key := make([]byte, encds.KeySize)
+	rand.Read(key)
+	aead, err := encds.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys stored before enabling encryption get encrypted.
+	ks, err := NewFSKeystore(tdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k1 := privKeyOrFatal(t)
+	if err := ks.Put("foo", k1); err != nil {
+		t.Fatal(err)
+	}
+
+	eks, err := NewEncryptedFSKeystore(tdir, aead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2 := privKeyOrFatal(t)
+	if err := eks.Put("bar", k2); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := eks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(l)
+	if len(l) != 2 || l[0] != "bar" || l[1] != "foo" {
+		t.Fatalf("expected keys bar and foo, got %v", l)
+	}
+
+	for name, k := range map[string]ci.PrivKey{"foo": k1, "bar": k2} {
+		if err := assertGetKey(eks, name, k); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.Get(name); err == nil {
+			t.Fatalf("key %s readable without the repo key", name)
+		}
+	}
+
+	// Reopening with another key fails to read the keys.
+	other := make([]byte, encds.KeySize)
+	rand.Read(other)
+	oaead, err := encds.NewCipher(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oks, err := NewEncryptedFSKeystore(tdir, oaead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oks.Get("foo"); err != encds.ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package namesys
 
 import (
+	"strings"
 	"time"
 
 	path "gx/ipfs/QmZErC2Ay6WuGi96CPg316PwitdwgLo6RxZRqVjJjRj2MR/go-path"
@@ -26,8 +27,8 @@ func (ns *mpns) cacheGet(name string) (path.Path, bool) {
 		return entry.val, true
 	}
 
-	ns.cache.Remove(name)
-
+	// The expired entries are kept for the time their value was first
+	// resolved, until replaced or evicted.
 	return "", false
 }
 
@@ -35,13 +36,43 @@ func (ns *mpns) cacheSet(name string, val path.Path, ttl time.Duration) {
 	if ns.cache == nil || ttl <= 0 {
 		return
 	}
+
+	now := time.Now()
+	modified := now
+	if ientry, ok := ns.cache.Peek(name); ok {
+		if entry, ok := ientry.(cacheEntry); ok && entry.val == val {
+			modified = entry.modified
+		}
+	}
 	ns.cache.Add(name, cacheEntry{
-		val: val,
-		eol: time.Now().Add(ttl),
+		val:      val,
+		eol:      now.Add(ttl),
+		modified: modified,
 	})
 }
 
+// LastModified implements ModTimeResolver.
+func (ns *mpns) LastModified(name string) (time.Time, bool) {
+	if ns.cache == nil {
+		return time.Time{}, false
+	}
+
+	ientry, ok := ns.cache.Peek(strings.TrimPrefix(name, ipnsPrefix))
+	if !ok {
+		return time.Time{}, false
+	}
+	entry, ok := ientry.(cacheEntry)
+	if !ok {
+		return time.Time{}, false
+	}
+	return entry.modified, true
+}
+
 type cacheEntry struct {
 	val path.Path
 	eol time.Time
+
+	// modified is the time the name was first resolved to, or published
+	// with, val
+	modified time.Time
 }
@@ -94,6 +94,16 @@ type Resolver interface {
 	ResolveAsync(ctx context.Context, name string, options ...opts.ResolveOpt) <-chan Result
 }
 
+// ModTimeResolver is implemented by the name systems which know when the
+// value of a name last changed. IPNS records don't carry the time they were
+// published at, so it is the time the value of the record was first resolved,
+// or published, by the node.
+type ModTimeResolver interface {
+	// LastModified returns the time the current value of name was first
+	// seen, false if the name hasn't been resolved recently.
+	LastModified(name string) (time.Time, bool)
+}
+
 // Publisher is an object capable of publishing particular names.
 type Publisher interface {
 
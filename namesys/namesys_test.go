@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	opts "github.com/ipfs/go-ipfs/namesys/opts"
 
 	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
 	ipns "gx/ipfs/QmPrt2JqvtFcgMBmYBjtZ5jFzq6HoFXy8PTwLb2Dpm2cGf/go-ipns"
+	lru "gx/ipfs/QmQjMHF8ptRgx4E57UFMiT4YM6kqaJeYxZ1MCDX23aw4rK/golang-lru"
 	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
 	pstoremem "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore/pstoremem"
 	path "gx/ipfs/QmZErC2Ay6WuGi96CPg316PwitdwgLo6RxZRqVjJjRj2MR/go-path"
@@ -107,3 +109,39 @@ func TestPublishWithCache0(t *testing.T) {
 	}
 	nsys.Publish(context.Background(), priv, p)
 }
+
+func TestCacheLastModified(t *testing.T) {
+	cache, err := lru.New(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := &mpns{cache: cache}
+
+	if _, ok := ns.LastModified("/ipns/QmName"); ok {
+		t.Fatal("expected no modification time for an unresolved name")
+	}
+
+	first := path.Path("/ipfs/QmFirst")
+	ns.cacheSet("QmName", first, time.Minute)
+	modified, ok := ns.LastModified("/ipns/QmName")
+	if !ok {
+		t.Fatal("expected a modification time")
+	}
+
+	// resolving the same value again keeps the time, even once expired
+	time.Sleep(10 * time.Millisecond)
+	ns.cacheSet("QmName", first, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := ns.cacheGet("QmName"); ok {
+		t.Fatal("expected the entry to be expired")
+	}
+	ns.cacheSet("QmName", first, time.Minute)
+	if m, _ := ns.LastModified("QmName"); !m.Equal(modified) {
+		t.Fatalf("expected the modification time to be kept, got %s instead of %s", m, modified)
+	}
+
+	ns.cacheSet("QmName", path.Path("/ipfs/QmSecond"), time.Minute)
+	if m, _ := ns.LastModified("QmName"); !m.After(modified) {
+		t.Fatalf("expected a new modification time, got %s", m)
+	}
+}
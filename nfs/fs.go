@@ -0,0 +1,359 @@
+package nfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	gopath "path"
+	"strings"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+	uio "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs/io"
+)
+
+// The modes of the entries without a mode set by 'ipfs files chmod'. The
+// entries of /ipfs are never writable.
+const (
+	defaultDirMode  = 0755
+	defaultFileMode = 0644
+	readOnlyMask    = 0555
+)
+
+// The types of the entries.
+const (
+	nf3Reg = 1
+	nf3Dir = 2
+	nf3Lnk = 5
+)
+
+// The file system ids of the exports.
+const (
+	filesFsid = 1
+	ipfsFsid  = 2
+)
+
+// maxName is the maximum length of the names of the entries.
+const maxName = 255
+
+// nfsError is an error answered with its NFS status.
+type nfsError uint32
+
+func (e nfsError) Error() string {
+	return fmt.Sprintf("nfs: status %d", uint32(e))
+}
+
+// The statuses of the NFS procedures.
+const (
+	nfs3OK             = 0
+	errPerm            = nfsError(1)
+	errNoEnt           = nfsError(2)
+	errIO              = nfsError(5)
+	errAccess          = nfsError(13)
+	errExist           = nfsError(17)
+	errNotDir          = nfsError(20)
+	errIsDir           = nfsError(21)
+	errInval           = nfsError(22)
+	errROFS            = nfsError(30)
+	errNameTooLong     = nfsError(63)
+	errNotEmpty        = nfsError(66)
+	errStale           = nfsError(70)
+	errBadHandle       = nfsError(10001)
+	errBadCookie       = nfsError(10003)
+	errNotSupp         = nfsError(10004)
+	errTooSmall        = nfsError(10005)
+	errServerFault     = nfsError(10006)
+	errUnsupportedType = nfsError(10007)
+)
+
+// status returns the NFS status of err.
+func status(err error) uint32 {
+	switch err {
+	case nil:
+		return nfs3OK
+	case os.ErrNotExist:
+		return uint32(errNoEnt)
+	case os.ErrExist:
+		return uint32(errExist)
+	}
+	if e, ok := err.(nfsError); ok {
+		return uint32(e)
+	}
+	log.Errorf("nfs: %s", err)
+	return uint32(errIO)
+}
+
+// mfsPath returns the path in MFS of the entry at p, if it is in /files.
+func mfsPath(p string) (string, bool) {
+	if p == filesExport {
+		return "/", true
+	}
+	if strings.HasPrefix(p, filesExport+"/") {
+		return p[len(filesExport):], true
+	}
+	return "", false
+}
+
+// exportOf returns the export holding the entry at p.
+func exportOf(p string) string {
+	if _, ok := mfsPath(p); ok {
+		return filesExport
+	}
+	return ipfsExport
+}
+
+// childPath returns the path of the entry name of the directory at dir,
+// "." and ".." not leaving the export.
+func childPath(dir, name string) (string, error) {
+	switch {
+	case name == "" || strings.Contains(name, "/"):
+		return "", errInval
+	case len(name) > maxName:
+		return "", errNameTooLong
+	case name == ".":
+		return dir, nil
+	case name == "..":
+		if dir == exportOf(dir) {
+			return dir, nil
+		}
+		return gopath.Dir(dir), nil
+	}
+	return gopath.Join(dir, name), nil
+}
+
+// writable returns the path in MFS of the entry at p, which must be in
+// /files.
+func writable(p string) (string, error) {
+	mp, ok := mfsPath(p)
+	if !ok {
+		return "", errROFS
+	}
+	return mp, nil
+}
+
+// attr holds the attributes of an entry.
+type attr struct {
+	typ    uint32
+	mode   uint32
+	size   uint64
+	fsid   uint64
+	fileid uint64
+	mtime  time.Time
+	ctime  time.Time
+}
+
+// lookupNode returns the node of the entry at p, nil for the root of /ipfs.
+func (s *Server) lookupNode(ctx context.Context, p string) (ipld.Node, error) {
+	if mp, ok := mfsPath(p); ok {
+		fsn, err := mfs.Lookup(s.node.FilesRoot, mp)
+		if err != nil {
+			return nil, err
+		}
+		return fsn.GetNode()
+	}
+	if p == ipfsExport {
+		return nil, nil
+	}
+
+	ip, err := coreiface.ParsePath(p)
+	if err != nil {
+		return nil, errNoEnt
+	}
+	nd, err := s.api.ResolveNode(ctx, ip)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errNoEnt
+	}
+	return nd, nil
+}
+
+// getattr returns the attributes of the entry at p.
+func (s *Server) getattr(ctx context.Context, p string) (*attr, error) {
+	nd, err := s.lookupNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return s.nodeAttr(p, nd)
+}
+
+// nodeAttr returns the attributes of the entry at p, of node nd.
+func (s *Server) nodeAttr(p string, nd ipld.Node) (*attr, error) {
+	a := &attr{fileid: s.handles.id(p), fsid: filesFsid}
+	if nd == nil {
+		a.typ = nf3Dir
+		a.mode = defaultDirMode & readOnlyMask
+		a.fsid = ipfsFsid
+		a.mtime, a.ctime = s.started, s.started
+		return a, nil
+	}
+
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return nil, err
+		}
+		switch fsn.Type() {
+		case ft.TDirectory, ft.THAMTShard:
+			a.typ = nf3Dir
+		case ft.TSymlink:
+			a.typ = nf3Lnk
+			a.size = uint64(len(fsn.Data()))
+		default:
+			a.typ = nf3Reg
+			a.size = fsn.FileSize()
+		}
+	case *dag.RawNode:
+		a.typ = nf3Reg
+		a.size = uint64(len(nd.RawData()))
+	default:
+		return nil, errUnsupportedType
+	}
+
+	md, err := corefiles.ReadMetadata(nd)
+	if err != nil {
+		return nil, err
+	}
+	a.mode = md.Mode
+	if a.mode == 0 {
+		switch a.typ {
+		case nf3Dir:
+			a.mode = defaultDirMode
+		case nf3Lnk:
+			a.mode = 0777
+		default:
+			a.mode = defaultFileMode
+		}
+	}
+	if _, ok := mfsPath(p); !ok {
+		a.mode &= readOnlyMask
+		a.fsid = ipfsFsid
+	}
+
+	// the clients detect the changes with the change time, it is the time
+	// the current version of the entry was first seen
+	a.ctime = s.handles.changeTime(a.fileid, nd.Cid(), time.Now())
+	a.mtime = md.Mtime
+	if a.mtime.IsZero() {
+		a.mtime = a.ctime
+	}
+	return a, nil
+}
+
+// lookupDir returns the directory of MFS at mp.
+func (s *Server) lookupDir(mp string) (*mfs.Directory, error) {
+	fsn, err := mfs.Lookup(s.node.FilesRoot, mp)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := fsn.(*mfs.Directory)
+	if !ok {
+		return nil, errNotDir
+	}
+	return dir, nil
+}
+
+// lookupFile returns the file of MFS at mp.
+func (s *Server) lookupFile(mp string) (*mfs.File, error) {
+	fsn, err := mfs.Lookup(s.node.FilesRoot, mp)
+	if err != nil {
+		return nil, err
+	}
+	fi, ok := fsn.(*mfs.File)
+	if !ok {
+		return nil, errIsDir
+	}
+	return fi, nil
+}
+
+// writeBack returns true if the changes are left to the flusher of the node.
+func (s *Server) writeBack() bool {
+	return s.node.FilesFlusher.WriteBack()
+}
+
+// flushDir flushes the changes of dir up to the root, unless they are left
+// to the flusher of the node.
+func (s *Server) flushDir(dir *mfs.Directory) error {
+	if s.writeBack() {
+		return nil
+	}
+	return dir.Flush()
+}
+
+// changed reports the change of the entry of MFS at mp to the node, see the
+// FUSE mount of MFS.
+func (s *Server) changed(ctx context.Context, op string, resized bool, mp, from string) {
+	n := s.node
+	if resized {
+		paths := []string{mp}
+		if from != "" {
+			paths = append(paths, from)
+		}
+		corefiles.AutoShardParents(ctx, n.FilesRoot, n.DAG, n.FilesShardSize, paths...)
+	}
+	n.FilesEvents.NotifyChange(n.FilesRoot, op, mp, from)
+	n.FilesFlusher.Changed()
+}
+
+// dirent is an entry of a directory listing.
+type dirent struct {
+	name string
+	path string
+}
+
+// list returns the entries of the directory at p, starting with "." and
+// "..".
+func (s *Server) list(ctx context.Context, p string) ([]dirent, error) {
+	parent, _ := childPath(p, "..")
+	out := []dirent{{name: ".", path: p}, {name: "..", path: parent}}
+
+	if mp, ok := mfsPath(p); ok {
+		dir, err := s.lookupDir(mp)
+		if err != nil {
+			return nil, err
+		}
+		names, err := dir.ListNames(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			out = append(out, dirent{name: name, path: gopath.Join(p, name)})
+		}
+		return out, nil
+	}
+	if p == ipfsExport {
+		return out, nil
+	}
+
+	nd, err := s.lookupNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.nodeAttr(p, nd)
+	if err != nil {
+		return nil, err
+	}
+	if a.typ != nf3Dir {
+		return nil, errNotDir
+	}
+	dir, err := uio.NewDirectoryFromNode(s.node.DAG, nd)
+	if err != nil {
+		return nil, err
+	}
+	links, err := dir.Links(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range links {
+		out = append(out, dirent{name: l.Name, path: gopath.Join(p, l.Name)})
+	}
+	return out, nil
+}
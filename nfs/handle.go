@@ -0,0 +1,254 @@
+package nfs
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+)
+
+// handleSize is the size of the file handles: the boot nonce of the server
+// followed by the id of the entry.
+const handleSize = 16
+
+// MaxHandles bounds the number of file handles remembered. The least
+// recently used ones are forgotten beyond it, with their descendants: the
+// clients get NFS3ERR_STALE, or NFS4ERR_FHEXPIRED, for them and look the
+// entries up again.
+var MaxHandles = 1 << 16
+
+// handleEntry is an entry of the tree of the paths handed out.
+type handleEntry struct {
+	id       uint64
+	name     string
+	parent   *handleEntry
+	children map[string]*handleEntry
+
+	// elem is the position of the entry in the LRU list, nil for the root,
+	// the pseudo filesystem of NFSv4, and the exports, which are never
+	// forgotten
+	elem *list.Element
+
+	// cid is the last version of the entry seen, and changed the time it was
+	// first seen
+	cid     cid.Cid
+	changed time.Time
+}
+
+func (e *handleEntry) path() string {
+	if e.parent == nil {
+		return "/"
+	}
+	var names []string
+	for ; e.parent != nil; e = e.parent {
+		names = append(names, e.name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+// handleTable maps the file handles given to the clients to the paths they
+// were looked up at, so that they follow the changes of MFS. The paths are
+// kept as a tree, so that renaming or removing an entry only visits its
+// descendants. The handles aren't persisted, the clients get stale handle
+// errors for the handles of a previous server, and of the entries forgotten
+// beyond MaxHandles.
+type handleTable struct {
+	lk      sync.Mutex
+	boot    [8]byte
+	next    uint64
+	root    *handleEntry
+	entries map[uint64]*handleEntry
+	lru     *list.List // of *handleEntry, the most recently used first
+}
+
+func newHandleTable() (*handleTable, error) {
+	t := &handleTable{
+		next:    2,
+		entries: make(map[uint64]*handleEntry),
+		lru:     list.New(),
+	}
+	t.root = &handleEntry{id: 1, children: make(map[string]*handleEntry)}
+	t.entries[t.root.id] = t.root
+	if _, err := rand.Read(t.boot[:]); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// lookupLocked returns the entry at path, created with its parents if create
+// is set, nil otherwise if there is none.
+func (t *handleTable) lookupLocked(path string, create bool) *handleEntry {
+	e := t.root
+	for _, name := range splitPath(path) {
+		child, ok := e.children[name]
+		if !ok {
+			if !create {
+				return nil
+			}
+			child = &handleEntry{id: t.next, name: name, parent: e}
+			t.next++
+			if e.children == nil {
+				e.children = make(map[string]*handleEntry)
+			}
+			e.children[name] = child
+			t.entries[child.id] = child
+			if e != t.root {
+				child.elem = t.lru.PushFront(child)
+			}
+		}
+		e = child
+	}
+	return e
+}
+
+// touchLocked marks e and its parents as used, so that the parents are
+// forgotten after their children.
+func (t *handleTable) touchLocked(e *handleEntry) {
+	for ; e != nil; e = e.parent {
+		if e.elem != nil {
+			t.lru.MoveToFront(e.elem)
+		}
+	}
+}
+
+// evictLocked forgets the least recently used entries beyond MaxHandles.
+func (t *handleTable) evictLocked() {
+	for t.lru.Len() > MaxHandles {
+		e := t.lru.Back().Value.(*handleEntry)
+		t.detachLocked(e)
+		t.forgetLocked(e)
+	}
+}
+
+// detachLocked removes e from the children of its parent.
+func (t *handleTable) detachLocked(e *handleEntry) {
+	if e.parent != nil {
+		delete(e.parent.children, e.name)
+		e.parent = nil
+	}
+}
+
+// forgetLocked forgets e and its descendants, whose handles become stale.
+func (t *handleTable) forgetLocked(e *handleEntry) {
+	for _, child := range e.children {
+		t.forgetLocked(child)
+	}
+	delete(t.entries, e.id)
+	if e.elem != nil {
+		t.lru.Remove(e.elem)
+		e.elem = nil
+	}
+}
+
+// id returns the id of the entry at path, the file id reported to the
+// clients.
+func (t *handleTable) id(path string) uint64 {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	e := t.lookupLocked(path, true)
+	t.touchLocked(e)
+	t.evictLocked()
+	return e.id
+}
+
+// handle returns the file handle of the entry at path.
+func (t *handleTable) handle(path string) []byte {
+	fh := make([]byte, handleSize)
+	copy(fh, t.boot[:])
+	binary.BigEndian.PutUint64(fh[8:], t.id(path))
+	return fh
+}
+
+// path returns the path of the entry of fh.
+func (t *handleTable) path(fh []byte) (string, error) {
+	if len(fh) != handleSize {
+		return "", errBadHandle
+	}
+	if string(fh[:8]) != string(t.boot[:]) {
+		return "", errStale
+	}
+	id := binary.BigEndian.Uint64(fh[8:])
+
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	e, ok := t.entries[id]
+	if !ok {
+		return "", errStale
+	}
+	t.touchLocked(e)
+	return e.path(), nil
+}
+
+// changeTime returns the time the entry id was first seen at the version c,
+// or at now if c is a new version.
+func (t *handleTable) changeTime(id uint64, c cid.Cid, now time.Time) time.Time {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	e, ok := t.entries[id]
+	if !ok {
+		return now
+	}
+	if !e.cid.Equals(c) {
+		e.cid = c
+		e.changed = now
+	}
+	return e.changed
+}
+
+// rename moves the handles of the entry at from and of its children to to,
+// the handles of the entries replaced at to become stale.
+func (t *handleTable) rename(from, to string) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.removeLocked(to)
+
+	e := t.lookupLocked(from, false)
+	if e == nil || e == t.root {
+		return
+	}
+	names := splitPath(to)
+	if len(names) == 0 {
+		return
+	}
+	parent := t.lookupLocked(strings.Join(names[:len(names)-1], "/"), true)
+	t.detachLocked(e)
+	e.name = names[len(names)-1]
+	e.parent = parent
+	if parent.children == nil {
+		parent.children = make(map[string]*handleEntry)
+	}
+	parent.children[e.name] = e
+	t.touchLocked(e)
+	t.evictLocked()
+}
+
+// remove makes the handles of the entry at path and of its children stale.
+func (t *handleTable) remove(path string) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.removeLocked(path)
+}
+
+func (t *handleTable) removeLocked(path string) {
+	e := t.lookupLocked(path, false)
+	if e == nil || e == t.root {
+		return
+	}
+	t.detachLocked(e)
+	t.forgetLocked(e)
+}
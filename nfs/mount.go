@@ -0,0 +1,84 @@
+package nfs
+
+import (
+	"context"
+	gopath "path"
+)
+
+// The MOUNT protocol, version 3, RFC 1813.
+
+// The procedures of the MOUNT program.
+const (
+	mountProcNull = iota
+	mountProcMnt
+	mountProcDump
+	mountProcUmnt
+	mountProcUmntall
+	mountProcExport
+)
+
+// The statuses of MNT.
+const (
+	mnt3OK       = 0
+	mnt3ErrNoEnt = 2
+)
+
+// exports are the paths served.
+var exports = []string{filesExport, ipfsExport}
+
+func (s *Server) mountProcs() []procFunc {
+	return []procFunc{
+		mountProcNull:    s.nfsNull,
+		mountProcMnt:     s.mountMnt,
+		mountProcDump:    s.mountDump,
+		mountProcUmnt:    s.mountUmnt,
+		mountProcUmntall: s.nfsNull,
+		mountProcExport:  s.mountExport,
+	}
+}
+
+// mountMnt gives the handle of the root of an export. The exports can't be
+// mounted below their root.
+func (s *Server) mountMnt(ctx context.Context, c *call, res *xdrWriter) error {
+	dirpath := c.args.string(maxPath)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p := gopath.Clean("/" + dirpath)
+	for _, export := range exports {
+		if p == export {
+			res.uint32(mnt3OK)
+			res.opaque(s.handles.handle(p))
+			// the flavors accepted
+			res.uint32(2)
+			res.uint32(authUnix)
+			res.uint32(authNone)
+			return nil
+		}
+	}
+	res.uint32(mnt3ErrNoEnt)
+	return nil
+}
+
+// mountDump lists the mounts of the clients, they aren't recorded.
+func (s *Server) mountDump(ctx context.Context, c *call, res *xdrWriter) error {
+	res.bool(false)
+	return nil
+}
+
+func (s *Server) mountUmnt(ctx context.Context, c *call, res *xdrWriter) error {
+	c.args.string(maxPath)
+	return c.args.check()
+}
+
+func (s *Server) mountExport(ctx context.Context, c *call, res *xdrWriter) error {
+	for _, export := range exports {
+		res.bool(true)
+		res.string(export)
+		// no groups, the exports are open to all the clients
+		res.bool(false)
+	}
+	res.bool(false)
+	return nil
+}
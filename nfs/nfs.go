@@ -0,0 +1,1156 @@
+package nfs
+
+import (
+	"context"
+	"io"
+	"math"
+	"os"
+	gopath "path"
+	"strings"
+	"time"
+
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+	uio "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs/io"
+)
+
+// The NFSv3 protocol, RFC 1813.
+
+// maxData is the maximum size of the data read and written by a call.
+const maxData = 1 << 20
+
+const (
+	// maxHandle is the maximum size of the file handles sent by the clients
+	maxHandle = 64
+
+	// maxPath is the maximum length of the names and the paths sent by the
+	// clients, the names longer than maxName are refused
+	maxPath = 1024
+
+	// replyOverhead is a bound of the size of the replies of READDIR and
+	// READDIRPLUS without their entries
+	replyOverhead = 128
+)
+
+// The procedures of the NFS program.
+const (
+	nfsProcNull = iota
+	nfsProcGetattr
+	nfsProcSetattr
+	nfsProcLookup
+	nfsProcAccess
+	nfsProcReadlink
+	nfsProcRead
+	nfsProcWrite
+	nfsProcCreate
+	nfsProcMkdir
+	nfsProcSymlink
+	nfsProcMknod
+	nfsProcRemove
+	nfsProcRmdir
+	nfsProcRename
+	nfsProcLink
+	nfsProcReaddir
+	nfsProcReaddirplus
+	nfsProcFsstat
+	nfsProcFsinfo
+	nfsProcPathconf
+	nfsProcCommit
+)
+
+// The stability of the writes.
+const (
+	unstable = 0
+	dataSync = 1
+	fileSync = 2
+)
+
+// The modes of CREATE.
+const (
+	createUnchecked = 0
+	createGuarded   = 1
+	createExclusive = 2
+)
+
+// The ways to set the times in SETATTR.
+const (
+	dontChange      = 0
+	setToServerTime = 1
+	setToClientTime = 2
+)
+
+// The permissions checked by ACCESS.
+const (
+	accessRead    = 0x1
+	accessLookup  = 0x2
+	accessModify  = 0x4
+	accessExtend  = 0x8
+	accessDelete  = 0x10
+	accessExecute = 0x20
+
+	accessReadOnly = accessRead | accessLookup | accessExecute
+	accessWritable = accessReadOnly | accessModify | accessExtend | accessDelete
+)
+
+// fsinfoProperties are the properties of the exports: FSF3_SYMLINK,
+// FSF3_HOMOGENEOUS and FSF3_CANSETTIME.
+const fsinfoProperties = 0x2 | 0x8 | 0x10
+
+// The size of the entries of READDIR without their name, and the size added
+// to them by READDIRPLUS: their attributes and their handle.
+const (
+	readdirEntrySize  = 4 + 8 + 4 + 8
+	readdirplusExtras = 4 + 84 + 4 + 4 + handleSize
+)
+
+func (s *Server) nfsProcs() []procFunc {
+	procs := []procFunc{
+		nfsProcNull:        s.nfsNull,
+		nfsProcGetattr:     s.nfsGetattr,
+		nfsProcSetattr:     s.nfsSetattr,
+		nfsProcLookup:      s.nfsLookup,
+		nfsProcAccess:      s.nfsAccess,
+		nfsProcReadlink:    s.nfsReadlink,
+		nfsProcRead:        s.nfsRead,
+		nfsProcWrite:       s.nfsWrite,
+		nfsProcCreate:      s.nfsCreate,
+		nfsProcMkdir:       s.nfsMkdir,
+		nfsProcSymlink:     s.nfsSymlink,
+		nfsProcMknod:       s.nfsMknod,
+		nfsProcRemove:      s.nfsRemove,
+		nfsProcRmdir:       s.nfsRemove,
+		nfsProcRename:      s.nfsRename,
+		nfsProcLink:        s.nfsLink,
+		nfsProcReaddir:     s.nfsReaddir,
+		nfsProcReaddirplus: s.nfsReaddir,
+		nfsProcFsstat:      s.nfsFsstat,
+		nfsProcFsinfo:      s.nfsFsinfo,
+		nfsProcPathconf:    s.nfsPathconf,
+		nfsProcCommit:      s.nfsCommit,
+	}
+	for i, proc := range procs {
+		procs[i] = s.lockFilesRoot(proc)
+	}
+	return procs
+}
+
+// lockFilesRoot holds the lock of the changes of MFS shared while proc runs,
+// so that the root of a batch is never swapped in during a call.
+func (s *Server) lockFilesRoot(proc procFunc) procFunc {
+	return func(ctx context.Context, c *call, res *xdrWriter) error {
+		s.node.FilesLock.RLock()
+		defer s.node.FilesLock.RUnlock()
+		return proc(ctx, c, res)
+	}
+}
+
+func writeTime(res *xdrWriter, t time.Time) {
+	res.uint32(uint32(t.Unix()))
+	res.uint32(uint32(t.Nanosecond()))
+}
+
+// writeFattr writes the attributes a, the caller of c owning the entries.
+func writeFattr(res *xdrWriter, c *call, a *attr) {
+	res.uint32(a.typ)
+	res.uint32(a.mode)
+	if a.typ == nf3Dir {
+		res.uint32(2)
+	} else {
+		res.uint32(1)
+	}
+	res.uint32(c.uid)
+	res.uint32(c.gid)
+	res.uint64(a.size)
+	res.uint64(a.size)
+	// rdev
+	res.uint32(0)
+	res.uint32(0)
+	res.uint64(a.fsid)
+	res.uint64(a.fileid)
+	writeTime(res, a.mtime)
+	writeTime(res, a.mtime)
+	writeTime(res, a.ctime)
+}
+
+// writePostOpAttr writes a, if any.
+func writePostOpAttr(res *xdrWriter, c *call, a *attr) {
+	res.bool(a != nil)
+	if a != nil {
+		writeFattr(res, c, a)
+	}
+}
+
+// postOpAttr writes the attributes of the entry at p, if it is found.
+func (s *Server) postOpAttr(ctx context.Context, res *xdrWriter, c *call, p string) {
+	var a *attr
+	if p != "" {
+		a, _ = s.getattr(ctx, p)
+	}
+	writePostOpAttr(res, c, a)
+}
+
+// wccData writes the attributes of the entry at p after a change, the
+// attributes before the change aren't given.
+func (s *Server) wccData(ctx context.Context, res *xdrWriter, c *call, p string) {
+	res.bool(false)
+	s.postOpAttr(ctx, res, c, p)
+}
+
+// dirAttr returns the attributes of the entry at p, which must be a
+// directory.
+func (s *Server) dirAttr(ctx context.Context, p string) (*attr, error) {
+	a, err := s.getattr(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if a.typ != nf3Dir {
+		return nil, errNotDir
+	}
+	return a, nil
+}
+
+// sattr holds the attributes to set. The owners and the access times aren't
+// stored, they are ignored.
+type sattr struct {
+	setMode  bool
+	mode     uint32
+	setSize  bool
+	size     uint64
+	setMtime bool
+	mtime    time.Time
+}
+
+func readSattr(r *xdrReader) sattr {
+	var sa sattr
+	if sa.setMode = r.bool(); sa.setMode {
+		sa.mode = r.uint32()
+	}
+	// uid and gid
+	if r.bool() {
+		r.uint32()
+	}
+	if r.bool() {
+		r.uint32()
+	}
+	if sa.setSize = r.bool(); sa.setSize {
+		sa.size = r.uint64()
+	}
+	readSetTime(r)
+	sa.setMtime, sa.mtime = readSetTime(r)
+	return sa
+}
+
+func readSetTime(r *xdrReader) (bool, time.Time) {
+	switch r.uint32() {
+	case setToServerTime:
+		return true, time.Now()
+	case setToClientTime:
+		sec, nsec := r.uint32(), r.uint32()
+		return true, time.Unix(int64(sec), int64(nsec))
+	}
+	return false, time.Time{}
+}
+
+// setattr applies sa to the entry at p.
+func (s *Server) setattr(ctx context.Context, p string, sa sattr) error {
+	if !sa.setMode && !sa.setSize && !sa.setMtime {
+		return nil
+	}
+	mp, err := writable(p)
+	if err != nil {
+		return err
+	}
+	flush := !s.writeBack()
+
+	if sa.setSize {
+		fi, err := s.lookupFile(mp)
+		if err != nil {
+			return err
+		}
+		fd, err := fi.Open(mfs.OpenWriteOnly, flush)
+		if err != nil {
+			return err
+		}
+		err = fd.Truncate(int64(sa.size))
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		s.changed(ctx, corefiles.OpWrite, false, mp, "")
+	}
+	if (sa.setMode || sa.setMtime) && mp == "/" {
+		return errPerm
+	}
+	if sa.setMode {
+		err := corefiles.Chmod(s.node.FilesRoot, mp, sa.mode&corefiles.ModeMask, flush)
+		if err != nil {
+			return err
+		}
+		s.changed(ctx, corefiles.OpChmod, false, mp, "")
+	}
+	if sa.setMtime {
+		err := corefiles.Touch(s.node.FilesRoot, mp, sa.mtime, flush)
+		if err != nil {
+			return err
+		}
+		s.changed(ctx, corefiles.OpTouch, false, mp, "")
+	}
+	return nil
+}
+
+func (s *Server) nfsNull(ctx context.Context, c *call, res *xdrWriter) error {
+	return nil
+}
+
+func (s *Server) nfsGetattr(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	var a *attr
+	if err == nil {
+		a, err = s.getattr(ctx, p)
+	}
+	res.uint32(status(err))
+	if err == nil {
+		writeFattr(res, c, a)
+	}
+	return nil
+}
+
+func (s *Server) nfsSetattr(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	sa := readSattr(c.args)
+	// the guard isn't checked
+	if c.args.bool() {
+		readSetTime(c.args)
+	}
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	if err == nil {
+		err = s.setattr(ctx, p, sa)
+	}
+	res.uint32(status(err))
+	s.wccData(ctx, res, c, p)
+	return nil
+}
+
+func (s *Server) nfsLookup(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	name := c.args.string(maxPath)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	dir, err := s.handles.path(fh)
+	if err == nil {
+		_, err = s.dirAttr(ctx, dir)
+	}
+	var p string
+	if err == nil {
+		p, err = childPath(dir, name)
+		if err == errInval {
+			err = errNoEnt
+		}
+	}
+	var a *attr
+	if err == nil {
+		a, err = s.getattr(ctx, p)
+	}
+	res.uint32(status(err))
+	if err == nil {
+		res.opaque(s.handles.handle(p))
+		writePostOpAttr(res, c, a)
+	}
+	s.postOpAttr(ctx, res, c, dir)
+	return nil
+}
+
+func (s *Server) nfsAccess(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	mask := c.args.uint32()
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	var a *attr
+	if err == nil {
+		a, err = s.getattr(ctx, p)
+	}
+	res.uint32(status(err))
+	writePostOpAttr(res, c, a)
+	if err != nil {
+		return nil
+	}
+	res.uint32(mask & accessAllowed(p, a))
+	return nil
+}
+
+// accessAllowed returns the permissions granted on the entry at p, of
+// attributes a.
+func accessAllowed(p string, a *attr) uint32 {
+	allowed := uint32(accessReadOnly)
+	if _, ok := mfsPath(p); ok {
+		allowed = accessWritable
+	}
+	if a.typ != nf3Dir && a.mode&0111 == 0 {
+		allowed &^= accessExecute
+	}
+	return allowed
+}
+
+func (s *Server) nfsReadlink(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	var target string
+	if err == nil {
+		target, err = s.readlink(ctx, p)
+	}
+	res.uint32(status(err))
+	s.postOpAttr(ctx, res, c, p)
+	if err == nil {
+		res.string(target)
+	}
+	return nil
+}
+
+func (s *Server) readlink(ctx context.Context, p string) (string, error) {
+	nd, err := s.lookupNode(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return "", errInval
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return "", err
+	}
+	if fsn.Type() != ft.TSymlink {
+		return "", errInval
+	}
+	return string(fsn.Data()), nil
+}
+
+func (s *Server) nfsRead(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	offset := c.args.uint64()
+	count := c.args.uint32()
+	if err := c.args.check(); err != nil {
+		return err
+	}
+	if count > maxData {
+		count = maxData
+	}
+
+	p, err := s.handles.path(fh)
+	var data []byte
+	var eof bool
+	if err == nil {
+		data, eof, err = s.read(ctx, p, offset, count)
+	}
+	res.uint32(status(err))
+	s.postOpAttr(ctx, res, c, p)
+	if err == nil {
+		res.uint32(uint32(len(data)))
+		res.bool(eof)
+		res.opaque(data)
+	}
+	return nil
+}
+
+func (s *Server) read(ctx context.Context, p string, offset uint64, count uint32) ([]byte, bool, error) {
+	if mp, ok := mfsPath(p); ok {
+		fi, err := s.lookupFile(mp)
+		if err != nil {
+			return nil, false, err
+		}
+		fd, err := fi.Open(mfs.OpenReadOnly, false)
+		if err != nil {
+			return nil, false, err
+		}
+		defer fd.Close()
+		size, err := fd.Size()
+		if err != nil {
+			return nil, false, err
+		}
+		return readAt(fd, uint64(size), offset, count)
+	}
+
+	nd, err := s.lookupNode(ctx, p)
+	if err != nil {
+		return nil, false, err
+	}
+	a, err := s.nodeAttr(p, nd)
+	if err != nil {
+		return nil, false, err
+	}
+	switch a.typ {
+	case nf3Dir:
+		return nil, false, errIsDir
+	case nf3Lnk:
+		return nil, false, errInval
+	}
+	r, err := uio.NewDagReader(ctx, nd, s.node.DAG)
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+	return readAt(r, a.size, offset, count)
+}
+
+// readAt reads at most count bytes at offset of r, of the given size. It
+// returns true if the end of r was reached.
+func readAt(r io.ReadSeeker, size, offset uint64, count uint32) ([]byte, bool, error) {
+	if offset >= size {
+		return nil, true, nil
+	}
+	n := uint64(count)
+	if rest := size - offset; rest < n {
+		n = rest
+	}
+	if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, err
+	}
+	return buf[:read], offset+uint64(read) >= size, nil
+}
+
+func (s *Server) nfsWrite(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	offset := c.args.uint64()
+	c.args.uint32() // count, the size of data
+	stable := c.args.uint32()
+	data := c.args.opaque(maxData)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	var committed uint32
+	if err == nil {
+		committed, err = s.write(ctx, p, offset, data, stable)
+	}
+	res.uint32(status(err))
+	s.wccData(ctx, res, c, p)
+	if err == nil {
+		res.uint32(uint32(len(data)))
+		res.uint32(committed)
+		res.fixed(s.verf[:])
+	}
+	return nil
+}
+
+// write writes data at offset of the file at p. The unstable writes, and all
+// the writes in write-back mode, aren't flushed up to the root of MFS until
+// they are committed.
+func (s *Server) write(ctx context.Context, p string, offset uint64, data []byte, stable uint32) (uint32, error) {
+	mp, err := writable(p)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := s.lookupFile(mp)
+	if err != nil {
+		return 0, err
+	}
+
+	flush := stable != unstable && !s.writeBack()
+	fd, err := fi.Open(mfs.OpenWriteOnly, flush)
+	if err != nil {
+		return 0, err
+	}
+	_, err = fd.WriteAt(data, int64(offset))
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.changed(ctx, corefiles.OpWrite, false, mp, "")
+
+	if flush {
+		return fileSync, nil
+	}
+	return unstable, nil
+}
+
+func (s *Server) nfsCreate(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	name := c.args.string(maxPath)
+	how := c.args.uint32()
+	var sa sattr
+	switch how {
+	case createUnchecked, createGuarded:
+		sa = readSattr(c.args)
+	case createExclusive:
+		// the verifier isn't stored, retried exclusive creations fail
+		c.args.fixed(8)
+	default:
+		return errGarbageArgs
+	}
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	dir, err := s.handles.path(fh)
+	var p string
+	if err == nil {
+		p, err = s.create(ctx, dir, name, mkFile(name, how == createUnchecked), corefiles.OpWrite)
+	}
+	if err == nil {
+		err = s.setattr(ctx, p, sa)
+	}
+	s.writeCreated(ctx, res, c, dir, p, err)
+	return nil
+}
+
+func (s *Server) nfsMkdir(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	name := c.args.string(maxPath)
+	sa := readSattr(c.args)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	dir, err := s.handles.path(fh)
+	var p string
+	if err == nil {
+		p, err = s.create(ctx, dir, name, mkDir(name), corefiles.OpMkdir)
+	}
+	if err == nil {
+		sa.setSize = false
+		err = s.setattr(ctx, p, sa)
+	}
+	s.writeCreated(ctx, res, c, dir, p, err)
+	return nil
+}
+
+func (s *Server) nfsSymlink(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	name := c.args.string(maxPath)
+	// the attributes of symbolic links aren't set
+	readSattr(c.args)
+	target := c.args.string(maxPath)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	dir, err := s.handles.path(fh)
+	var p string
+	if err == nil {
+		p, err = s.create(ctx, dir, name, mkSymlink(name, target), corefiles.OpWrite)
+	}
+	s.writeCreated(ctx, res, c, dir, p, err)
+	return nil
+}
+
+// mkFile returns the function creating the empty file name, an existing file
+// being kept if unchecked is set.
+func mkFile(name string, unchecked bool) func(d *mfs.Directory, existing mfs.FSNode) error {
+	return func(d *mfs.Directory, existing mfs.FSNode) error {
+		if existing != nil {
+			if !unchecked {
+				return errExist
+			}
+			if _, ok := existing.(*mfs.File); !ok {
+				return errIsDir
+			}
+			return nil
+		}
+		nd := dag.NodeWithData(ft.FilePBData(nil, 0))
+		nd.SetCidBuilder(d.GetCidBuilder())
+		return d.AddChild(name, nd)
+	}
+}
+
+// mkDir returns the function creating the directory name.
+func mkDir(name string) func(d *mfs.Directory, existing mfs.FSNode) error {
+	return func(d *mfs.Directory, existing mfs.FSNode) error {
+		if existing != nil {
+			return errExist
+		}
+		_, err := d.Mkdir(name)
+		return err
+	}
+}
+
+// mkSymlink returns the function creating the symbolic link name to target.
+func mkSymlink(name, target string) func(d *mfs.Directory, existing mfs.FSNode) error {
+	return func(d *mfs.Directory, existing mfs.FSNode) error {
+		if existing != nil {
+			return errExist
+		}
+		data, err := ft.SymlinkData(target)
+		if err != nil {
+			return err
+		}
+		nd := dag.NodeWithData(data)
+		nd.SetCidBuilder(d.GetCidBuilder())
+		return d.AddChild(name, nd)
+	}
+}
+
+// create creates the entry name of the directory at dir with mk, given the
+// existing entry, if any. It returns the path of the entry.
+func (s *Server) create(ctx context.Context, dir, name string, mk func(d *mfs.Directory, existing mfs.FSNode) error, op string) (string, error) {
+	mdir, err := writable(dir)
+	if err != nil {
+		return "", err
+	}
+	if name == "." || name == ".." {
+		return "", errExist
+	}
+	p, err := childPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	d, err := s.lookupDir(mdir)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := d.Child(name)
+	switch err {
+	case nil:
+		if err := mk(d, existing); err != nil {
+			return "", err
+		}
+		return p, nil
+	case os.ErrNotExist:
+	default:
+		return "", err
+	}
+
+	if err := mk(d, nil); err != nil {
+		return "", err
+	}
+	if err := s.flushDir(d); err != nil {
+		return "", err
+	}
+	s.changed(ctx, op, true, gopath.Join(mdir, name), "")
+	return p, nil
+}
+
+// writeCreated writes the results of the creation of the entry at p in the
+// directory at dir.
+func (s *Server) writeCreated(ctx context.Context, res *xdrWriter, c *call, dir, p string, err error) {
+	res.uint32(status(err))
+	if err == nil {
+		res.bool(true)
+		res.opaque(s.handles.handle(p))
+		s.postOpAttr(ctx, res, c, p)
+	}
+	s.wccData(ctx, res, c, dir)
+}
+
+func (s *Server) nfsMknod(ctx context.Context, c *call, res *xdrWriter) error {
+	res.uint32(uint32(errNotSupp))
+	s.wccData(ctx, res, c, "")
+	return nil
+}
+
+func (s *Server) nfsLink(ctx context.Context, c *call, res *xdrWriter) error {
+	res.uint32(uint32(errNotSupp))
+	writePostOpAttr(res, c, nil)
+	s.wccData(ctx, res, c, "")
+	return nil
+}
+
+// nfsRemove handles REMOVE and RMDIR.
+func (s *Server) nfsRemove(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	name := c.args.string(maxPath)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	dir, err := s.handles.path(fh)
+	if err == nil {
+		err = s.remove(ctx, dir, name, c.proc == nfsProcRmdir)
+	}
+	res.uint32(status(err))
+	s.wccData(ctx, res, c, dir)
+	return nil
+}
+
+func (s *Server) remove(ctx context.Context, dir, name string, rmdir bool) error {
+	mdir, err := writable(dir)
+	if err != nil {
+		return err
+	}
+	if name == "." || name == ".." {
+		return errInval
+	}
+	p, err := childPath(dir, name)
+	if err != nil {
+		return err
+	}
+	d, err := s.lookupDir(mdir)
+	if err != nil {
+		return err
+	}
+	child, err := d.Child(name)
+	if err != nil {
+		return err
+	}
+
+	switch child := child.(type) {
+	case *mfs.Directory:
+		if !rmdir {
+			return errIsDir
+		}
+		names, err := child.ListNames(ctx)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return errNotEmpty
+		}
+	default:
+		if rmdir {
+			return errNotDir
+		}
+	}
+
+	if err := d.Unlink(name); err != nil {
+		return err
+	}
+	if err := s.flushDir(d); err != nil {
+		return err
+	}
+	s.changed(ctx, corefiles.OpRemove, true, gopath.Join(mdir, name), "")
+	s.handles.remove(p)
+	return nil
+}
+
+func (s *Server) nfsRename(ctx context.Context, c *call, res *xdrWriter) error {
+	fromfh := c.args.opaque(maxHandle)
+	fromName := c.args.string(maxPath)
+	tofh := c.args.opaque(maxHandle)
+	toName := c.args.string(maxPath)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	fromDir, err := s.handles.path(fromfh)
+	toDir, terr := s.handles.path(tofh)
+	if err == nil {
+		err = terr
+	}
+	if err == nil {
+		err = s.rename(ctx, fromDir, fromName, toDir, toName)
+	}
+	res.uint32(status(err))
+	s.wccData(ctx, res, c, fromDir)
+	s.wccData(ctx, res, c, toDir)
+	return nil
+}
+
+// rename moves the entry fromName of the directory at fromDir to toName in
+// the directory at toDir, replacing the file or the empty directory found
+// there.
+func (s *Server) rename(ctx context.Context, fromDir, fromName, toDir, toName string) error {
+	mfrom, err := writable(fromDir)
+	if err != nil {
+		return err
+	}
+	mto, err := writable(toDir)
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{fromName, toName} {
+		if name == "." || name == ".." {
+			return errInval
+		}
+	}
+	src, err := childPath(fromDir, fromName)
+	if err != nil {
+		return err
+	}
+	dst, err := childPath(toDir, toName)
+	if err != nil {
+		return err
+	}
+	if src == dst {
+		return nil
+	}
+	if strings.HasPrefix(dst, src+"/") {
+		return errInval
+	}
+
+	srcDir, err := s.lookupDir(mfrom)
+	if err != nil {
+		return err
+	}
+	srcChild, err := srcDir.Child(fromName)
+	if err != nil {
+		return err
+	}
+	_, srcIsDir := srcChild.(*mfs.Directory)
+	dstDir, err := s.lookupDir(mto)
+	if err != nil {
+		return err
+	}
+	existing, err := dstDir.Child(toName)
+	switch err {
+	case nil:
+		if dir, ok := existing.(*mfs.Directory); ok {
+			if !srcIsDir {
+				return errIsDir
+			}
+			names, err := dir.ListNames(ctx)
+			if err != nil {
+				return err
+			}
+			if len(names) > 0 {
+				return errNotEmpty
+			}
+		} else if srcIsDir {
+			return errNotDir
+		}
+		// mfs.Mv would move the entry into an existing directory
+		if err := dstDir.Unlink(toName); err != nil {
+			return err
+		}
+	case os.ErrNotExist:
+	default:
+		return err
+	}
+
+	msrc, mdst := gopath.Join(mfrom, fromName), gopath.Join(mto, toName)
+	if err := mfs.Mv(s.node.FilesRoot, msrc, mdst); err != nil {
+		return err
+	}
+	for _, mp := range []string{mfrom, mto} {
+		d, err := s.lookupDir(mp)
+		if err != nil {
+			return err
+		}
+		if err := s.flushDir(d); err != nil {
+			return err
+		}
+	}
+	s.changed(ctx, corefiles.OpMove, true, mdst, msrc)
+	s.handles.rename(src, dst)
+	return nil
+}
+
+// nfsReaddir handles READDIR and READDIRPLUS. The cookie of an entry is its
+// position in the listing, plus one.
+func (s *Server) nfsReaddir(ctx context.Context, c *call, res *xdrWriter) error {
+	plus := c.proc == nfsProcReaddirplus
+	fh := c.args.opaque(maxHandle)
+	cookie := c.args.uint64()
+	c.args.fixed(8) // the cookie verifier, not checked
+	if plus {
+		c.args.uint32() // dircount
+	}
+	count := c.args.uint32()
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	var entries []dirent
+	if err == nil {
+		entries, err = s.list(ctx, p)
+	}
+	if err == nil && cookie > uint64(len(entries)) {
+		err = errBadCookie
+	}
+
+	// the entries fitting in the reply
+	var end int
+	if err == nil {
+		size := replyOverhead
+		for end = int(cookie); end < len(entries); end++ {
+			n := readdirEntrySize + pad(len(entries[end].name))
+			if plus {
+				n += readdirplusExtras
+			}
+			if size+n > int(count) {
+				break
+			}
+			size += n
+		}
+		if end == int(cookie) && end < len(entries) {
+			err = errTooSmall
+		}
+	}
+
+	res.uint32(status(err))
+	s.postOpAttr(ctx, res, c, p)
+	if err != nil {
+		return nil
+	}
+	res.fixed(make([]byte, 8))
+	for i := int(cookie); i < end; i++ {
+		e := entries[i]
+		res.bool(true)
+		res.uint64(s.handles.id(e.path))
+		res.string(e.name)
+		res.uint64(uint64(i + 1))
+		if plus {
+			a, err := s.getattr(ctx, e.path)
+			writePostOpAttr(res, c, a)
+			res.bool(err == nil)
+			if err == nil {
+				res.opaque(s.handles.handle(e.path))
+			}
+		}
+	}
+	res.bool(false)
+	res.bool(end == len(entries))
+	return nil
+}
+
+func (s *Server) nfsFsstat(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	var st corerepo.SizeStat
+	if err == nil {
+		st, err = corerepo.RepoSize(ctx, s.node)
+	}
+	res.uint32(status(err))
+	s.postOpAttr(ctx, res, c, p)
+	if err != nil {
+		return nil
+	}
+
+	total, free := space(st)
+	res.uint64(total)
+	res.uint64(free)
+	res.uint64(free)
+	// the number of entries isn't bounded
+	res.uint64(math.MaxUint32)
+	res.uint64(math.MaxUint32)
+	res.uint64(math.MaxUint32)
+	// invarsec
+	res.uint32(0)
+	return nil
+}
+
+// space returns the total and the free space of the repo of st, its size
+// when it is over its maximum.
+func space(st corerepo.SizeStat) (total, free uint64) {
+	total = st.StorageMax
+	if total < st.RepoSize {
+		return st.RepoSize, 0
+	}
+	return total, total - st.RepoSize
+}
+
+func (s *Server) nfsFsinfo(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	res.uint32(status(err))
+	s.postOpAttr(ctx, res, c, p)
+	if err != nil {
+		return nil
+	}
+
+	// the maximum, preferred and multiple sizes of the reads and the writes
+	for i := 0; i < 2; i++ {
+		res.uint32(maxData)
+		res.uint32(maxData)
+		res.uint32(4096)
+	}
+	// the preferred size of the READDIR requests
+	res.uint32(64 << 10)
+	res.uint64(math.MaxInt64)
+	// time_delta, the precision of the times set
+	res.uint32(0)
+	res.uint32(1)
+	res.uint32(fsinfoProperties)
+	return nil
+}
+
+func (s *Server) nfsPathconf(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	res.uint32(status(err))
+	s.postOpAttr(ctx, res, c, p)
+	if err != nil {
+		return nil
+	}
+
+	res.uint32(1) // linkmax
+	res.uint32(maxName)
+	res.bool(true)  // no_trunc
+	res.bool(true)  // chown_restricted
+	res.bool(false) // case_insensitive
+	res.bool(true)  // case_preserving
+	return nil
+}
+
+func (s *Server) nfsCommit(ctx context.Context, c *call, res *xdrWriter) error {
+	fh := c.args.opaque(maxHandle)
+	c.args.uint64() // offset
+	c.args.uint32() // count
+	if err := c.args.check(); err != nil {
+		return err
+	}
+
+	p, err := s.handles.path(fh)
+	if err == nil {
+		err = s.commit(ctx, p)
+	}
+	res.uint32(status(err))
+	s.wccData(ctx, res, c, p)
+	if err == nil {
+		res.fixed(s.verf[:])
+	}
+	return nil
+}
+
+// commit flushes the entry at p up to the root of MFS and waits for the root
+// to be published, even in write-back mode.
+func (s *Server) commit(ctx context.Context, p string) error {
+	mp, ok := mfsPath(p)
+	if !ok {
+		return nil
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- mfs.FlushPath(s.node.FilesRoot, mp)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,633 @@
+package nfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	core "github.com/ipfs/go-ipfs/core"
+	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+// testClient sends the calls of the tests, one at a time.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	xid  uint32
+}
+
+func (tc *testClient) call(prog, vers, proc uint32, args func(w *xdrWriter)) *xdrReader {
+	tc.t.Helper()
+	tc.xid++
+	w := &xdrWriter{}
+	w.uint32(tc.xid)
+	w.uint32(msgCall)
+	w.uint32(rpcVersion)
+	w.uint32(prog)
+	w.uint32(vers)
+	w.uint32(proc)
+	cred := &xdrWriter{}
+	cred.uint32(0)
+	cred.string("test")
+	cred.uint32(1000)
+	cred.uint32(1000)
+	cred.uint32(0)
+	w.uint32(authUnix)
+	w.opaque(cred.b)
+	w.uint32(authNone)
+	w.uint32(0)
+	if args != nil {
+		args(w)
+	}
+
+	if err := writeRecord(tc.conn, w.b); err != nil {
+		tc.t.Fatal(err)
+	}
+	rec, err := readRecord(tc.conn)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	r := &xdrReader{b: rec}
+	if xid := r.uint32(); xid != tc.xid {
+		tc.t.Fatalf("expected the reply to call %d, got %d", tc.xid, xid)
+	}
+	if r.uint32() != msgReply || r.uint32() != replyAccepted {
+		tc.t.Fatal("expected an accepted reply")
+	}
+	r.uint32()
+	r.opaque(maxAuth)
+	if stat := r.uint32(); stat != acceptSuccess {
+		tc.t.Fatalf("expected the call to succeed, got %d", stat)
+	}
+	return r
+}
+
+// nfs calls proc of the NFS program, checking the status of the reply.
+func (tc *testClient) nfs(proc uint32, expected nfsError, args func(w *xdrWriter)) *xdrReader {
+	tc.t.Helper()
+	r := tc.call(progNFS, nfsVersion, proc, args)
+	if st := r.uint32(); st != uint32(expected) {
+		tc.t.Fatalf("procedure %d: expected status %d, got %d", proc, expected, st)
+	}
+	return r
+}
+
+func (tc *testClient) mount(path string) []byte {
+	tc.t.Helper()
+	r := tc.call(progMount, mountVersion, mountProcMnt, func(w *xdrWriter) {
+		w.string(path)
+	})
+	if st := r.uint32(); st != mnt3OK {
+		tc.t.Fatalf("mounting %s: expected success, got %d", path, st)
+	}
+	return r.opaque(maxHandle)
+}
+
+func dirop(fh []byte, name string) func(w *xdrWriter) {
+	return func(w *xdrWriter) {
+		w.opaque(fh)
+		w.string(name)
+	}
+}
+
+// writeSattr writes attributes setting the mode, if it isn't negative.
+func writeSattr(w *xdrWriter, mode int) {
+	w.bool(mode >= 0)
+	if mode >= 0 {
+		w.uint32(uint32(mode))
+	}
+	w.bool(false)
+	w.bool(false)
+	w.bool(false)
+	w.uint32(dontChange)
+	w.uint32(dontChange)
+}
+
+// readFattr returns the type, the mode, the size and the file id of fattr3.
+func readFattr(r *xdrReader) (typ, mode uint32, size, fileid uint64) {
+	typ = r.uint32()
+	mode = r.uint32()
+	r.next(12)
+	size = r.uint64()
+	r.next(24)
+	fileid = r.uint64()
+	r.next(24)
+	return
+}
+
+func skipPostOpAttr(r *xdrReader) {
+	if r.bool() {
+		readFattr(r)
+	}
+}
+
+// readCreated returns the handle of the entry created.
+func readCreated(t *testing.T, r *xdrReader) []byte {
+	t.Helper()
+	if !r.bool() {
+		t.Fatal("expected the handle of the entry")
+	}
+	return r.opaque(maxHandle)
+}
+
+func readdirNames(r *xdrReader) []string {
+	skipPostOpAttr(r)
+	r.next(8)
+	var names []string
+	for r.bool() {
+		r.uint64()
+		names = append(names, r.string(maxName))
+		r.uint64()
+	}
+	return names
+}
+
+func setupServer(t *testing.T) (*core.IpfsNode, *testClient) {
+	node, err := core.NewNode(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node, &testClient{t: t, conn: conn}
+}
+
+func TestServeMFS(t *testing.T) {
+	nd, tc := setupServer(t)
+	defer nd.Close()
+	defer tc.conn.Close()
+
+	root := tc.mount("/files")
+	r := tc.call(progMount, mountVersion, mountProcMnt, func(w *xdrWriter) {
+		w.string("/nope")
+	})
+	if st := r.uint32(); st != mnt3ErrNoEnt {
+		t.Fatalf("expected mounting an unknown export to fail, got %d", st)
+	}
+
+	r = tc.nfs(nfsProcMkdir, nfs3OK, func(w *xdrWriter) {
+		dirop(root, "dir")(w)
+		writeSattr(w, 0700)
+	})
+	dir := readCreated(t, r)
+	if !r.bool() {
+		t.Fatal("expected the attributes of the directory")
+	}
+	if typ, mode, _, _ := readFattr(r); typ != nf3Dir || mode != 0700 {
+		t.Fatalf("expected a directory of mode 0700, got type %d and mode %o", typ, mode)
+	}
+
+	r = tc.nfs(nfsProcCreate, nfs3OK, func(w *xdrWriter) {
+		dirop(dir, "a")(w)
+		w.uint32(createGuarded)
+		writeSattr(w, -1)
+	})
+	file := readCreated(t, r)
+	tc.nfs(nfsProcCreate, errExist, func(w *xdrWriter) {
+		dirop(dir, "a")(w)
+		w.uint32(createGuarded)
+		writeSattr(w, -1)
+	})
+
+	data := []byte("hello nfs")
+	r = tc.nfs(nfsProcWrite, nfs3OK, func(w *xdrWriter) {
+		w.opaque(file)
+		w.uint64(0)
+		w.uint32(uint32(len(data)))
+		w.uint32(fileSync)
+		w.opaque(data)
+	})
+	r.next(4)
+	skipPostOpAttr(r)
+	if n, committed := r.uint32(), r.uint32(); n != uint32(len(data)) || committed != fileSync {
+		t.Fatalf("expected %d bytes written and committed, got %d and %d", len(data), n, committed)
+	}
+
+	r = tc.nfs(nfsProcRead, nfs3OK, func(w *xdrWriter) {
+		w.opaque(file)
+		w.uint64(6)
+		w.uint32(100)
+	})
+	skipPostOpAttr(r)
+	r.uint32()
+	if eof, out := r.bool(), r.opaque(maxData); !eof || string(out) != "nfs" {
+		t.Fatalf("expected to read the end of the file, got %q (eof: %t)", out, eof)
+	}
+
+	// the file shows up in MFS
+	fsn, err := mfs.Lookup(nd.FilesRoot, "/dir/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := fsn.(*mfs.File).Open(mfs.OpenReadOnly, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(fd)
+	fd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("expected %q in MFS, got %q", data, out)
+	}
+
+	r = tc.nfs(nfsProcLookup, nfs3OK, dirop(dir, "a"))
+	if fh := r.opaque(maxHandle); !bytes.Equal(fh, file) {
+		t.Fatal("expected the lookup to give the handle of the file")
+	}
+	tc.nfs(nfsProcLookup, errNoEnt, dirop(dir, "missing"))
+
+	r = tc.nfs(nfsProcReaddir, nfs3OK, func(w *xdrWriter) {
+		w.opaque(dir)
+		w.uint64(0)
+		w.fixed(make([]byte, 8))
+		w.uint32(4096)
+	})
+	if names := strings.Join(readdirNames(r), " "); names != ". .. a" {
+		t.Fatalf("expected the entries of the directory, got %q", names)
+	}
+
+	// the handles follow the renamed entries
+	tc.nfs(nfsProcRename, nfs3OK, func(w *xdrWriter) {
+		dirop(dir, "a")(w)
+		dirop(root, "b")(w)
+	})
+	r = tc.nfs(nfsProcGetattr, nfs3OK, func(w *xdrWriter) {
+		w.opaque(file)
+	})
+	if typ, _, size, _ := readFattr(r); typ != nf3Reg || size != uint64(len(data)) {
+		t.Fatalf("expected the file renamed, got type %d and size %d", typ, size)
+	}
+
+	tc.nfs(nfsProcRmdir, errNotDir, dirop(root, "b"))
+	tc.nfs(nfsProcRemove, nfs3OK, dirop(root, "b"))
+	tc.nfs(nfsProcGetattr, errStale, func(w *xdrWriter) {
+		w.opaque(file)
+	})
+	tc.nfs(nfsProcRmdir, nfs3OK, dirop(root, "dir"))
+	if _, err := mfs.Lookup(nd.FilesRoot, "/dir"); err == nil {
+		t.Fatal("expected the directory to be removed from MFS")
+	}
+}
+
+func TestServeIpfs(t *testing.T) {
+	nd, tc := setupServer(t)
+	defer nd.Close()
+	defer tc.conn.Close()
+
+	k, err := coreunix.Add(nd, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := tc.mount("/ipfs")
+	r := tc.nfs(nfsProcLookup, nfs3OK, dirop(root, k))
+	file := r.opaque(maxHandle)
+
+	r = tc.nfs(nfsProcRead, nfs3OK, func(w *xdrWriter) {
+		w.opaque(file)
+		w.uint64(0)
+		w.uint32(100)
+	})
+	skipPostOpAttr(r)
+	r.uint32()
+	if eof, out := r.bool(), r.opaque(maxData); !eof || string(out) != "fnord" {
+		t.Fatalf("expected to read the file, got %q (eof: %t)", out, eof)
+	}
+
+	tc.nfs(nfsProcWrite, errROFS, func(w *xdrWriter) {
+		w.opaque(file)
+		w.uint64(0)
+		w.uint32(1)
+		w.uint32(fileSync)
+		w.opaque([]byte("x"))
+	})
+	tc.nfs(nfsProcCreate, errROFS, func(w *xdrWriter) {
+		dirop(root, "new")(w)
+		w.uint32(createUnchecked)
+		writeSattr(w, -1)
+	})
+}
+
+func TestHandleTable(t *testing.T) {
+	defer func(max int) { MaxHandles = max }(MaxHandles)
+	MaxHandles = 3
+
+	handles, err := newHandleTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handles.id(filesExport)
+
+	dir := handles.handle("/files/dir")
+	file := handles.handle("/files/dir/file")
+	if p, err := handles.path(file); err != nil || p != "/files/dir/file" {
+		t.Fatalf("expected the path of the handle, got %q: %v", p, err)
+	}
+
+	// the handles follow the renamed entries, and those replaced are stale
+	other := handles.handle("/files/other")
+	handles.rename("/files/dir", "/files/other")
+	if p, err := handles.path(file); err != nil || p != "/files/other/file" {
+		t.Fatalf("expected the handle to follow the rename, got %q: %v", p, err)
+	}
+	if _, err := handles.path(other); err != errStale {
+		t.Fatalf("expected the handle of the entry replaced to be stale, got %v", err)
+	}
+
+	handles.remove("/files/other")
+	for _, fh := range [][]byte{dir, file} {
+		if _, err := handles.path(fh); err != errStale {
+			t.Fatalf("expected the handles of the entries removed to be stale, got %v", err)
+		}
+	}
+
+	// the least recently used handles are forgotten with their descendants,
+	// the exports are kept
+	a := handles.handle("/files/a")
+	b := handles.handle("/files/a/b")
+	handles.handle("/files/c")
+	handles.handle("/files/d")
+	handles.handle("/files/e")
+	for _, fh := range [][]byte{a, b} {
+		if _, err := handles.path(fh); err != errStale {
+			t.Fatalf("expected the handles beyond MaxHandles to be forgotten, got %v", err)
+		}
+	}
+	if p, err := handles.path(handles.handle(filesExport)); err != nil || p != filesExport {
+		t.Fatalf("expected the export to be kept, got %q: %v", p, err)
+	}
+}
+
+// op4 writes the operation op of a COMPOUND with its arguments.
+func op4(op uint32, args func(w *xdrWriter)) func(w *xdrWriter) {
+	return func(w *xdrWriter) {
+		w.uint32(op)
+		if args != nil {
+			args(w)
+		}
+	}
+}
+
+// compound sends a COMPOUND of ops, checking its status, and returns its
+// results.
+func (tc *testClient) compound(expected nfsError, ops ...func(w *xdrWriter)) *xdrReader {
+	tc.t.Helper()
+	r := tc.call(progNFS, nfs4Version, nfs4ProcCompound, func(w *xdrWriter) {
+		w.string("test")
+		w.uint32(0)
+		w.uint32(uint32(len(ops)))
+		for _, op := range ops {
+			op(w)
+		}
+	})
+	if st := r.uint32(); st != uint32(expected) {
+		tc.t.Fatalf("expected the COMPOUND to end with status %d, got %d", expected, st)
+	}
+	r.opaque(maxOpaque4)
+	r.uint32()
+	return r
+}
+
+// result reads the header of the result of op, checking its status.
+func (tc *testClient) result(r *xdrReader, op uint32, expected nfsError) {
+	tc.t.Helper()
+	if got, st := r.uint32(), r.uint32(); got != op || st != uint32(expected) {
+		tc.t.Fatalf("expected operation %d with status %d, got %d with status %d", op, expected, got, st)
+	}
+}
+
+func putfh(fh []byte) func(w *xdrWriter) {
+	return op4(op4Putfh, func(w *xdrWriter) { w.opaque(fh) })
+}
+
+func lookup(name string) func(w *xdrWriter) {
+	return op4(op4Lookup, func(w *xdrWriter) { w.string(name) })
+}
+
+// writeCreateattrs writes attributes setting the mode, if it isn't negative.
+func writeCreateattrs(w *xdrWriter, mode int) {
+	if mode < 0 {
+		writeBitmap(w, nil)
+		w.opaque(nil)
+		return
+	}
+	writeBitmap(w, newBitmap(attrMode))
+	vals := &xdrWriter{}
+	vals.uint32(uint32(mode))
+	w.opaque(vals.b)
+}
+
+// openOp opens the file name of the current directory, created if create is
+// set.
+func openOp(clientid uint64, name string, access uint32, create bool) func(w *xdrWriter) {
+	return op4(op4Open, func(w *xdrWriter) {
+		w.uint32(0)
+		w.uint32(access)
+		w.uint32(0)
+		w.uint64(clientid)
+		w.string("owner")
+		w.bool(create)
+		if create {
+			w.uint32(createGuarded)
+			writeCreateattrs(w, -1)
+		}
+		w.uint32(claimNull)
+		w.string(name)
+	})
+}
+
+// readOpen reads the results of OPEN and returns the state id.
+func readOpen(r *xdrReader) (uint32, [12]byte) {
+	seqid, other := readStateid(r)
+	r.next(20)
+	r.uint32()
+	readBitmap(r)
+	r.uint32()
+	return seqid, other
+}
+
+func TestServeNFSv4(t *testing.T) {
+	nd, tc := setupServer(t)
+	defer nd.Close()
+	defer tc.conn.Close()
+
+	r := tc.compound(nfs3OK, op4(op4Setclientid, func(w *xdrWriter) {
+		w.fixed(make([]byte, 8))
+		w.string("test client")
+		w.uint32(0)
+		w.string("tcp")
+		w.string("127.0.0.1.0.0")
+		w.uint32(0)
+	}))
+	tc.result(r, op4Setclientid, nfs3OK)
+	clientid, confirm := r.uint64(), r.fixed(8)
+	tc.compound(nfs3OK, op4(op4SetclientidConfirm, func(w *xdrWriter) {
+		w.uint64(clientid)
+		w.fixed(confirm)
+	}))
+	tc.compound(errStaleClientID, op4(op4Renew, func(w *xdrWriter) {
+		w.uint64(clientid + 1)
+	}))
+
+	// the exports are the entries of the root
+	r = tc.compound(nfs3OK, op4(op4Putrootfh, nil), op4(op4Readdir, func(w *xdrWriter) {
+		w.uint64(0)
+		w.fixed(make([]byte, 8))
+		w.uint32(4096)
+		w.uint32(4096)
+		writeBitmap(w, newBitmap(attrType))
+	}))
+	tc.result(r, op4Putrootfh, nfs3OK)
+	tc.result(r, op4Readdir, nfs3OK)
+	r.next(8)
+	var names []string
+	for r.bool() {
+		r.uint64()
+		names = append(names, r.string(maxName))
+		readBitmap(r)
+		r.opaque(maxAttrs)
+	}
+	if strings.Join(names, " ") != "files ipfs" {
+		t.Fatalf("expected the exports, got %q", names)
+	}
+
+	r = tc.compound(nfs3OK,
+		op4(op4Putrootfh, nil),
+		lookup("files"),
+		op4(op4Getfh, nil),
+		op4(op4Create, func(w *xdrWriter) {
+			w.uint32(nf3Dir)
+			w.string("dir")
+			writeCreateattrs(w, 0700)
+		}),
+		op4(op4Getfh, nil),
+		op4(op4Getattr, func(w *xdrWriter) {
+			writeBitmap(w, newBitmap(attrType, attrMode))
+		}),
+	)
+	tc.result(r, op4Putrootfh, nfs3OK)
+	tc.result(r, op4Lookup, nfs3OK)
+	tc.result(r, op4Getfh, nfs3OK)
+	root := r.opaque(maxHandle4)
+	tc.result(r, op4Create, nfs3OK)
+	r.next(20)
+	readBitmap(r)
+	tc.result(r, op4Getfh, nfs3OK)
+	dir := r.opaque(maxHandle4)
+	tc.result(r, op4Getattr, nfs3OK)
+	readBitmap(r)
+	vals := &xdrReader{b: r.opaque(maxAttrs)}
+	if typ, mode := vals.uint32(), vals.uint32(); typ != nf3Dir || mode != 0700 {
+		t.Fatalf("expected a directory of mode 0700, got type %d and mode %o", typ, mode)
+	}
+
+	data := []byte("hello nfs")
+	r = tc.compound(nfs3OK,
+		putfh(dir),
+		openOp(clientid, "a", open4ShareAccessWrite, true),
+		op4(op4Getfh, nil),
+		op4(op4Write, func(w *xdrWriter) {
+			writeStateid(w, 0, [12]byte{})
+			w.uint64(0)
+			w.uint32(fileSync)
+			w.opaque(data)
+		}),
+	)
+	tc.result(r, op4Putfh, nfs3OK)
+	tc.result(r, op4Open, nfs3OK)
+	seqid, other := readOpen(r)
+	tc.result(r, op4Getfh, nfs3OK)
+	file := r.opaque(maxHandle4)
+	tc.result(r, op4Write, nfs3OK)
+	if n, committed := r.uint32(), r.uint32(); n != uint32(len(data)) || committed != fileSync {
+		t.Fatalf("expected %d bytes written and committed, got %d and %d", len(data), n, committed)
+	}
+	tc.compound(errExist, putfh(dir), openOp(clientid, "a", open4ShareAccessWrite, true))
+	tc.compound(nfs3OK, putfh(file), op4(op4Close, func(w *xdrWriter) {
+		w.uint32(1)
+		writeStateid(w, seqid, other)
+	}))
+
+	r = tc.compound(nfs3OK, putfh(file), op4(op4Read, func(w *xdrWriter) {
+		writeStateid(w, 0, [12]byte{})
+		w.uint64(6)
+		w.uint32(100)
+	}))
+	tc.result(r, op4Putfh, nfs3OK)
+	tc.result(r, op4Read, nfs3OK)
+	if eof, out := r.bool(), r.opaque(maxData); !eof || string(out) != "nfs" {
+		t.Fatalf("expected to read the end of the file, got %q (eof: %t)", out, eof)
+	}
+	if _, err := mfs.Lookup(nd.FilesRoot, "/dir/a"); err != nil {
+		t.Fatalf("expected the file in MFS: %s", err)
+	}
+
+	// the handles follow the renamed entries, and LOOKUPP leads back to the
+	// export
+	tc.compound(nfs3OK, putfh(dir), op4(op4Savefh, nil), putfh(root), op4(op4Rename, func(w *xdrWriter) {
+		w.string("a")
+		w.string("b")
+	}))
+	r = tc.compound(nfs3OK, putfh(file), op4(op4Getattr, func(w *xdrWriter) {
+		writeBitmap(w, newBitmap(attrSize))
+	}), putfh(dir), op4(op4Lookupp, nil), op4(op4Getfh, nil))
+	tc.result(r, op4Putfh, nfs3OK)
+	tc.result(r, op4Getattr, nfs3OK)
+	readBitmap(r)
+	vals = &xdrReader{b: r.opaque(maxAttrs)}
+	if size := vals.uint64(); size != uint64(len(data)) {
+		t.Fatalf("expected the file renamed, got size %d", size)
+	}
+	tc.result(r, op4Putfh, nfs3OK)
+	tc.result(r, op4Lookupp, nfs3OK)
+	tc.result(r, op4Getfh, nfs3OK)
+	if fh := r.opaque(maxHandle4); !bytes.Equal(fh, root) {
+		t.Fatal("expected the parent of the directory to be the export")
+	}
+
+	tc.compound(nfs3OK, putfh(root), op4(op4Remove, func(w *xdrWriter) { w.string("b") }))
+	tc.compound(errFHExpired, putfh(file))
+	tc.compound(nfs3OK, putfh(root), op4(op4Remove, func(w *xdrWriter) { w.string("dir") }))
+	if _, err := mfs.Lookup(nd.FilesRoot, "/dir"); err == nil {
+		t.Fatal("expected the directory to be removed from MFS")
+	}
+
+	// /ipfs is read-only
+	k, err := coreunix.Add(nd, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.compound(nfs3OK, op4(op4Putrootfh, nil), lookup("ipfs"), openOp(clientid, k, 1, false))
+	tc.compound(errROFS, op4(op4Putrootfh, nil), lookup("ipfs"), openOp(clientid, k, open4ShareAccessWrite, false))
+
+	// the opens need a confirmed client id, and other minor versions are
+	// refused
+	tc.compound(errStaleClientID, op4(op4Putrootfh, nil), lookup("files"), openOp(clientid+1, "c", 1, true))
+	r = tc.call(progNFS, nfs4Version, nfs4ProcCompound, func(w *xdrWriter) {
+		w.string("")
+		w.uint32(1)
+		w.uint32(0)
+	})
+	if st := r.uint32(); st != uint32(errMinorVersMismatch) {
+		t.Fatalf("expected minor version 1 to be refused, got %d", st)
+	}
+}
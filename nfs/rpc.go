@@ -0,0 +1,235 @@
+package nfs
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+)
+
+// The ONC RPC protocol, RFC 5531, over TCP.
+const (
+	rpcVersion = 2
+
+	msgCall  = 0
+	msgReply = 1
+
+	replyAccepted = 0
+	replyDenied   = 1
+
+	acceptSuccess      = 0
+	acceptProgUnavail  = 1
+	acceptProgMismatch = 2
+	acceptProcUnavail  = 3
+	acceptGarbageArgs  = 4
+	acceptSystemErr    = 5
+
+	rejectRPCMismatch = 0
+
+	authNone = 0
+	authUnix = 1
+
+	// lastFragment marks the last fragment of a record in its header.
+	lastFragment = 1 << 31
+
+	// maxAuth is the maximum size of the credentials and the verifiers.
+	maxAuth = 400
+)
+
+// maxRecord bounds the size of the records read, the largest being the
+// WRITE calls.
+const maxRecord = maxData + 4096
+
+// callsPerConn bounds the number of calls of a connection handled at once.
+const callsPerConn = 16
+
+var errRecordTooLarge = errors.New("nfs: RPC record too large")
+
+// call is an RPC call to a procedure.
+type call struct {
+	xid  uint32
+	prog uint32
+	vers uint32
+	proc uint32
+
+	// uid and gid are the ids of the caller given by AUTH_UNIX credentials,
+	// reported as the owners of all the entries
+	uid uint32
+	gid uint32
+
+	args *xdrReader
+}
+
+// procFunc handles a call, writing its results to res. It returns
+// errGarbageArgs when the arguments of the call are malformed.
+type procFunc func(ctx context.Context, c *call, res *xdrWriter) error
+
+// program is an RPC program served, its procedures by version.
+type program map[uint32][]procFunc
+
+// versions returns the lowest and the highest versions of p.
+func (p program) versions() (low, high uint32) {
+	low = math.MaxUint32
+	for v := range p {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+	return low, high
+}
+
+// serveConn handles the calls sent on conn until it is closed.
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var wlk sync.Mutex
+	sem := make(chan struct{}, callsPerConn)
+	rd := bufio.NewReader(conn)
+	for {
+		rec, err := readRecord(rd)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.Debugf("nfs: reading from %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			reply := s.handle(ctx, rec)
+			if reply == nil {
+				cancel()
+				return
+			}
+			wlk.Lock()
+			defer wlk.Unlock()
+			if err := writeRecord(conn, reply); err != nil {
+				cancel()
+			}
+		}()
+	}
+}
+
+// readRecord reads a record, made of one or more fragments.
+func readRecord(rd io.Reader) ([]byte, error) {
+	var rec []byte
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+			return nil, err
+		}
+		h := binary.BigEndian.Uint32(hdr[:])
+		n := int(h &^ lastFragment)
+		if len(rec)+n > maxRecord {
+			return nil, errRecordTooLarge
+		}
+		start := len(rec)
+		rec = append(rec, make([]byte, n)...)
+		if _, err := io.ReadFull(rd, rec[start:]); err != nil {
+			return nil, err
+		}
+		if h&lastFragment != 0 {
+			return rec, nil
+		}
+	}
+}
+
+// writeRecord writes rec as a single fragment.
+func writeRecord(w io.Writer, rec []byte) error {
+	buf := make([]byte, 4+len(rec))
+	binary.BigEndian.PutUint32(buf, uint32(len(rec))|lastFragment)
+	copy(buf[4:], rec)
+	_, err := w.Write(buf)
+	return err
+}
+
+// handle answers the call in rec, returning nil when it isn't a valid call
+// and the connection should be closed.
+func (s *Server) handle(ctx context.Context, rec []byte) []byte {
+	args := &xdrReader{b: rec}
+	c := &call{xid: args.uint32(), args: args}
+	if args.uint32() != msgCall {
+		return nil
+	}
+	rpcvers := args.uint32()
+	c.prog = args.uint32()
+	c.vers = args.uint32()
+	c.proc = args.uint32()
+	flavor := args.uint32()
+	cred := args.opaque(maxAuth)
+	args.uint32()
+	args.opaque(maxAuth)
+	if args.check() != nil {
+		return nil
+	}
+	if flavor == authUnix {
+		// stamp, machine name, uid, gid and the other groups
+		cr := &xdrReader{b: cred}
+		cr.uint32()
+		cr.string(255)
+		uid, gid := cr.uint32(), cr.uint32()
+		if cr.check() == nil {
+			c.uid, c.gid = uid, gid
+		}
+	}
+
+	res := &xdrWriter{}
+	res.uint32(c.xid)
+	res.uint32(msgReply)
+	if rpcvers != rpcVersion {
+		res.uint32(replyDenied)
+		res.uint32(rejectRPCMismatch)
+		res.uint32(rpcVersion)
+		res.uint32(rpcVersion)
+		return res.b
+	}
+	res.uint32(replyAccepted)
+	// the verifier, no authentication is done
+	res.uint32(authNone)
+	res.uint32(0)
+
+	prog, ok := s.progs[c.prog]
+	procs, vok := prog[c.vers]
+	switch {
+	case !ok:
+		res.uint32(acceptProgUnavail)
+		return res.b
+	case !vok:
+		low, high := prog.versions()
+		res.uint32(acceptProgMismatch)
+		res.uint32(low)
+		res.uint32(high)
+		return res.b
+	case int(c.proc) >= len(procs) || procs[c.proc] == nil:
+		res.uint32(acceptProcUnavail)
+		return res.b
+	}
+
+	hdr := res.len()
+	res.uint32(acceptSuccess)
+	err := procs[c.proc](ctx, c, res)
+	if err != nil {
+		res.b = res.b[:hdr]
+		if err == errGarbageArgs {
+			res.uint32(acceptGarbageArgs)
+		} else {
+			log.Errorf("nfs: program %d procedure %d: %s", c.prog, c.proc, err)
+			res.uint32(acceptSystemErr)
+		}
+	}
+	return res.b
+}
@@ -0,0 +1,165 @@
+// Package nfs implements an NFSv3 and NFSv4.0 server exposing the content of
+// IPFS, read-only, and the mutable filesystem of the node, MFS, for the
+// machines where FUSE is unavailable.
+//
+// The MOUNT and the NFS programs are served on the same TCP port, without
+// registering with a portmapper, and the locking protocol (NLM) isn't
+// implemented: the NFSv3 clients must mount with the port, the mount port and
+// "nolock" set. The NFSv4 clients find the exports under the root of the
+// pseudo filesystem, the locks aren't implemented either. The clients aren't
+// authenticated, the credentials they send are only used as the owners of the
+// entries.
+package nfs
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("nfs")
+
+const addressesKey = "Addresses.NFS"
+
+// The RPC programs served.
+const (
+	progNFS   = 100003
+	progMount = 100005
+
+	nfsVersion   = 3
+	nfs4Version  = 4
+	mountVersion = 3
+)
+
+// The exports: MFS, writable, and the content of IPFS, read-only. The root
+// of /ipfs isn't listable, as with the FUSE mount.
+const (
+	filesExport = "/files"
+	ipfsExport  = "/ipfs"
+)
+
+// Server serves MFS and the content of IPFS over NFSv3 and NFSv4.0.
+type Server struct {
+	node *core.IpfsNode
+	api  coreiface.CoreAPI
+
+	handles *handleTable
+
+	// verf is the write verifier, it changes with each server so that the
+	// clients send again the uncommitted writes
+	verf [8]byte
+
+	// started is the time reported for the entries without one
+	started time.Time
+
+	progs map[uint32]program
+
+	ops4    map[uint32]op4Func
+	clients *clients4
+}
+
+// Addresses returns the multiaddrs to serve NFS on, set by the optional
+// Addresses.NFS key. NFS isn't served if none is set.
+func Addresses(r repo.Repo) ([]string, error) {
+	val, err := r.GetConfigKey(addressesKey)
+	if err != nil {
+		return nil, nil // not set
+	}
+
+	switch val := val.(type) {
+	case []string:
+		return val, nil
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, v := range val {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid value for %s: expected a list of strings, got %v", addressesKey, val)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("invalid value for %s: expected a list of strings, got %v", addressesKey, val)
+	}
+}
+
+// NewServer returns a server of the exports of n.
+func NewServer(n *core.IpfsNode) (*Server, error) {
+	if n.FilesRoot == nil {
+		return nil, errors.New("nfs: the node has no MFS root")
+	}
+
+	s := &Server{
+		node:    n,
+		api:     coreapi.NewCoreAPI(n),
+		started: time.Now(),
+	}
+	if _, err := rand.Read(s.verf[:]); err != nil {
+		return nil, err
+	}
+	handles, err := newHandleTable()
+	if err != nil {
+		return nil, err
+	}
+	s.handles = handles
+	// the exports get the first file ids
+	s.handles.id(filesExport)
+	s.handles.id(ipfsExport)
+
+	s.clients = newClients4(s.started)
+	s.ops4 = s.nfs4Ops()
+	s.progs = map[uint32]program{
+		progNFS:   {nfsVersion: s.nfsProcs(), nfs4Version: s.nfs4Procs()},
+		progMount: {mountVersion: s.mountProcs()},
+	}
+	return s, nil
+}
+
+// Serve accepts the connections of the clients on lis until it is closed or
+// the node is closed.
+func (s *Server) Serve(lis net.Listener) error {
+	// make sure we close this no matter what.
+	defer lis.Close()
+
+	proc := s.node.Process()
+	select {
+	case <-proc.Closing():
+		return fmt.Errorf("failed to start server, process closing")
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-proc.Closing():
+			log.Infof("server at %s terminating...", lis.Addr())
+			cancel()
+			lis.Close()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Infof("server at %s terminated", lis.Addr())
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(ctx, conn)
+	}
+}
@@ -0,0 +1,133 @@
+package nfs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errGarbageArgs is returned when the arguments of a call can't be decoded.
+var errGarbageArgs = errors.New("nfs: malformed XDR data")
+
+// xdrReader decodes XDR data, as specified by RFC 4506. The first error is
+// kept, the reads following it return zero values.
+type xdrReader struct {
+	b   []byte
+	err error
+}
+
+func (r *xdrReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b) {
+		r.err = errGarbageArgs
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *xdrReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *xdrReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *xdrReader) bool() bool {
+	return r.uint32() != 0
+}
+
+// fixed reads fixed-length opaque data of n bytes.
+func (r *xdrReader) fixed(n int) []byte {
+	b := r.next(pad(n))
+	if b == nil {
+		return nil
+	}
+	return b[:n]
+}
+
+// opaque reads variable-length opaque data of at most max bytes.
+func (r *xdrReader) opaque(max int) []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint32(max) {
+		r.err = errGarbageArgs
+		return nil
+	}
+	return r.fixed(int(n))
+}
+
+func (r *xdrReader) string(max int) string {
+	return string(r.opaque(max))
+}
+
+// check returns errGarbageArgs if the data read so far was malformed.
+func (r *xdrReader) check() error {
+	return r.err
+}
+
+// xdrWriter encodes XDR data.
+type xdrWriter struct {
+	b []byte
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	w.b = append(w.b, b[:]...)
+}
+
+func (w *xdrWriter) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	w.b = append(w.b, b[:]...)
+}
+
+func (w *xdrWriter) bool(v bool) {
+	if v {
+		w.uint32(1)
+	} else {
+		w.uint32(0)
+	}
+}
+
+// fixed writes fixed-length opaque data.
+func (w *xdrWriter) fixed(b []byte) {
+	w.b = append(w.b, b...)
+	for i := len(b); i < pad(len(b)); i++ {
+		w.b = append(w.b, 0)
+	}
+}
+
+// opaque writes variable-length opaque data.
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.fixed(b)
+}
+
+func (w *xdrWriter) string(s string) {
+	w.opaque([]byte(s))
+}
+
+// len returns the number of bytes written.
+func (w *xdrWriter) len() int {
+	return len(w.b)
+}
+
+// pad rounds n up to a multiple of 4, the XDR unit.
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
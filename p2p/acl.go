@@ -0,0 +1,144 @@
+package p2p
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+)
+
+// ErrNotAllowed is returned when the ACL of a protocol doesn't allow a
+// listener.
+var ErrNotAllowed = errors.New("p2p: not allowed by the ACL of the protocol")
+
+// ACL restricts the listeners of a protocol.
+type ACL struct {
+	// Peers are the peers the streams of the protocol are accepted from, and
+	// forwarded to, any peer if empty
+	Peers []peer.ID
+
+	// Ports are the TCP or UDP ports the streams of the protocol are
+	// forwarded to, any port if empty
+	Ports []int
+}
+
+// AllowsPeer tells whether the streams of the protocol can be exchanged with
+// p.
+func (a ACL) AllowsPeer(p peer.ID) bool {
+	if len(a.Peers) == 0 {
+		return true
+	}
+	for _, allowed := range a.Peers {
+		if allowed == p {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsTarget tells whether the streams of the protocol can be forwarded to
+// the address target.
+func (a ACL) AllowsTarget(target ma.Multiaddr) bool {
+	if len(a.Ports) == 0 {
+		return true
+	}
+	s, err := target.ValueForProtocol(ma.P_TCP)
+	if err != nil {
+		s, err = target.ValueForProtocol(ma.P_UDP)
+		if err != nil {
+			return false
+		}
+	}
+	port, err := strconv.Atoi(s)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range a.Ports {
+		if allowed == port {
+			return true
+		}
+	}
+	return false
+}
+
+// allows tells whether the ACL allows the listener l.
+func (a ACL) allows(l Listener) bool {
+	switch l := l.(type) {
+	case *localListener:
+		return a.AllowsPeer(l.peer)
+	case *remoteListener:
+		return a.AllowsTarget(l.addr)
+	}
+	return true
+}
+
+// acls are the ACLs of the protocols
+type acls struct {
+	sync.RWMutex
+
+	m map[protocol.ID]ACL
+}
+
+// acl returns the ACL of proto, which allows everything if it has none.
+func (p2p *P2P) acl(proto protocol.ID) ACL {
+	p2p.acls.RLock()
+	defer p2p.acls.RUnlock()
+	return p2p.acls.m[proto]
+}
+
+// SetACL restricts the listeners of proto with acl. The listeners it doesn't
+// allow are closed, and the streams of the peers it doesn't allow are no
+// longer accepted, but those being forwarded are left open.
+func (p2p *P2P) SetACL(proto protocol.ID, acl ACL) {
+	p2p.acls.Lock()
+	p2p.acls.m[proto] = acl
+	p2p.acls.Unlock()
+
+	p2p.closeNotAllowed(proto, acl)
+}
+
+// RemoveACL lifts the restrictions of the listeners of proto.
+func (p2p *P2P) RemoveACL(proto protocol.ID) {
+	p2p.acls.Lock()
+	defer p2p.acls.Unlock()
+	delete(p2p.acls.m, proto)
+}
+
+// SetACLs replaces all the ACLs with acls, as SetACL would.
+func (p2p *P2P) SetACLs(acls map[protocol.ID]ACL) {
+	m := make(map[protocol.ID]ACL, len(acls))
+	for proto, acl := range acls {
+		m[proto] = acl
+	}
+	p2p.acls.Lock()
+	p2p.acls.m = m
+	p2p.acls.Unlock()
+
+	for proto, acl := range m {
+		p2p.closeNotAllowed(proto, acl)
+	}
+}
+
+// ACLs returns the ACLs of the protocols.
+func (p2p *P2P) ACLs() map[protocol.ID]ACL {
+	p2p.acls.RLock()
+	defer p2p.acls.RUnlock()
+
+	out := make(map[protocol.ID]ACL, len(p2p.acls.m))
+	for proto, acl := range p2p.acls.m {
+		out[proto] = acl
+	}
+	return out
+}
+
+func (p2p *P2P) closeNotAllowed(proto protocol.ID, acl ACL) {
+	match := func(l Listener) bool {
+		return l.Protocol() == proto && !acl.allows(l)
+	}
+	if n := p2p.ListenersLocal.Close(match) + p2p.ListenersP2P.Close(match); n > 0 {
+		log.Infof("closed %d listener(s) of %s not allowed by its ACL", n, proto)
+	}
+}
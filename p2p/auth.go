@@ -0,0 +1,96 @@
+package p2p
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	manet "gx/ipfs/QmQVUtnrNGtCRkCMpXgpApfzQjc8FDaDVxHqWH8cnZQeh5/go-multiaddr-net"
+)
+
+// AuthTimeout bounds the time of the TLS handshakes and of reading the tokens
+// of the local clients.
+var AuthTimeout = 10 * time.Second
+
+// MaxTokenLength bounds the length of the tokens of the local clients.
+const MaxTokenLength = 1024
+
+// ErrBadToken is returned when a local client doesn't send the token of the
+// forward.
+var ErrBadToken = errors.New("p2p: invalid token")
+
+// LocalAuth restricts the local clients of a forward, so that the other
+// processes of the host can't ride it into the remote service.
+type LocalAuth struct {
+	// Token is the secret the clients send first, followed by a newline,
+	// empty if none is required
+	Token string
+
+	// TLS is the config of the TLS the clients connect with, which requires
+	// their certificates with ClientAuth, nil for plain connections
+	TLS *tls.Config
+}
+
+// authenticate checks the client of c, and returns the connection its data is
+// read from.
+func (a *LocalAuth) authenticate(c manet.Conn) (manet.Conn, error) {
+	c.SetDeadline(time.Now().Add(AuthTimeout))
+
+	if a.TLS != nil {
+		tc := tls.Server(c, a.TLS)
+		if err := tc.Handshake(); err != nil {
+			return nil, err
+		}
+		var err error
+		c, err = manet.WrapNetConn(tc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if a.Token != "" {
+		token, err := readToken(c)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+			return nil, ErrBadToken
+		}
+	}
+
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// readToken reads the line of the token of c, one byte at a time so that
+// the data following it is left to forward.
+func readToken(c manet.Conn) (string, error) {
+	var token []byte
+	b := make([]byte, 1)
+	for len(token) <= MaxTokenLength {
+		if _, err := c.Read(b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(token), nil
+		}
+		token = append(token, b[0])
+	}
+	return "", ErrBadToken
+}
+
+// LocalTokens returns the tokens required from the local clients of the
+// forwards, so that they can be kept out of the diagnostics of the node.
+func (p2p *P2P) LocalTokens() []string {
+	p2p.ListenersLocal.RLock()
+	defer p2p.ListenersLocal.RUnlock()
+
+	var tokens []string
+	for _, l := range p2p.ListenersLocal.Listeners {
+		if l, ok := l.(*localListener); ok && l.auth != nil && l.auth.Token != "" {
+			tokens = append(tokens, l.auth.Token)
+		}
+	}
+	return tokens
+}
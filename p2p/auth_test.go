@@ -0,0 +1,54 @@
+package p2p
+
+import (
+	"strings"
+	"testing"
+
+	manet "gx/ipfs/QmQVUtnrNGtCRkCMpXgpApfzQjc8FDaDVxHqWH8cnZQeh5/go-multiaddr-net"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+)
+
+func TestLocalAuthTokenLength(t *testing.T) {
+	maddr, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := manet.Listen(maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	for _, tc := range []struct {
+		length int
+		ok     bool
+	}{
+		{MaxTokenLength, true},
+		{MaxTokenLength + 1, false},
+	} {
+		auth := &LocalAuth{Token: strings.Repeat("a", tc.length)}
+
+		client, err := manet.Dial(lis.Multiaddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Write([]byte(auth.Token + "\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := lis.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = auth.authenticate(c)
+		c.Close()
+		client.Close()
+
+		switch {
+		case tc.ok && err != nil:
+			t.Errorf("token of %d bytes: %s", tc.length, err)
+		case !tc.ok && err != ErrBadToken:
+			t.Errorf("expected a token of %d bytes to be refused, got %v", tc.length, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package p2p
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	net "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+)
+
+// ErrProtocolInUse is returned when a protocol is already handled by the
+// node, or by a listener.
+var ErrProtocolInUse = errors.New("p2p: protocol already handled")
+
+// ErrNoHandler is returned when removing a handler which wasn't set with
+// SetStreamHandler.
+var ErrNoHandler = errors.New("p2p: no such handler")
+
+// handlers are the protocols whose streams are handled by the programs
+// embedding the node
+type handlers struct {
+	sync.Mutex
+
+	protos map[protocol.ID]struct{}
+}
+
+func (h *handlers) has(proto protocol.ID) bool {
+	h.Lock()
+	defer h.Unlock()
+	_, ok := h.protos[proto]
+	return ok
+}
+
+// SetStreamHandler handles the streams of proto with handler. The protocols
+// of the node and of the listeners can't be taken over, but the handler of
+// a protocol set with SetStreamHandler is replaced.
+func (p2p *P2P) SetStreamHandler(proto protocol.ID, handler net.StreamHandler) error {
+	p2p.handlers.Lock()
+	defer p2p.handlers.Unlock()
+
+	if _, ok := p2p.handlers.protos[proto]; !ok {
+		if p2p.CheckProtoExists(string(proto)) {
+			return ErrProtocolInUse
+		}
+		p2p.ListenersP2P.RLock()
+		_, ok := p2p.ListenersP2P.Listeners[string(proto)]
+		p2p.ListenersP2P.RUnlock()
+		if ok {
+			return ErrProtocolInUse
+		}
+	}
+
+	p2p.peerHost.SetStreamHandler(proto, handler)
+	p2p.handlers.protos[proto] = struct{}{}
+	return nil
+}
+
+// RemoveStreamHandler stops handling the streams of proto, set with
+// SetStreamHandler.
+func (p2p *P2P) RemoveStreamHandler(proto protocol.ID) error {
+	p2p.handlers.Lock()
+	defer p2p.handlers.Unlock()
+
+	if _, ok := p2p.handlers.protos[proto]; !ok {
+		return ErrNoHandler
+	}
+	p2p.peerHost.RemoveStreamHandler(proto)
+	delete(p2p.handlers.protos, proto)
+	return nil
+}
+
+// StreamHandlers returns the protocols handled with SetStreamHandler, sorted.
+func (p2p *P2P) StreamHandlers() []protocol.ID {
+	p2p.handlers.Lock()
+	defer p2p.handlers.Unlock()
+
+	out := make([]protocol.ID, 0, len(p2p.handlers.protos))
+	for proto := range p2p.handlers.protos {
+		out = append(out, proto)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
@@ -23,15 +23,24 @@ type localListener struct {
 	peer  peer.ID
 
 	listener manet.Listener
+
+	// auth restricts the local clients, nil to accept them all
+	auth *LocalAuth
 }
 
-// ForwardLocal creates new P2P stream to a remote listener
-func (p2p *P2P) ForwardLocal(ctx context.Context, peer peer.ID, proto protocol.ID, bindAddr ma.Multiaddr) (Listener, error) {
+// ForwardLocal creates new P2P stream to a remote listener. The local clients
+// are restricted by auth unless it is nil.
+func (p2p *P2P) ForwardLocal(ctx context.Context, peer peer.ID, proto protocol.ID, bindAddr ma.Multiaddr, auth *LocalAuth) (Listener, error) {
+	if !p2p.acl(proto).AllowsPeer(peer) {
+		return nil, ErrNotAllowed
+	}
+
 	listener := &localListener{
 		ctx:   ctx,
 		p2p:   p2p,
 		proto: proto,
 		peer:  peer,
+		auth:  auth,
 	}
 
 	maListener, err := manet.Listen(bindAddr)
@@ -73,6 +82,16 @@ func (l *localListener) acceptConns() {
 }
 
 func (l *localListener) setupStream(local manet.Conn) {
+	if l.auth != nil {
+		authed, err := l.auth.authenticate(local)
+		if err != nil {
+			local.Close()
+			log.Warningf("refused the local client %s of %s/%s: %s", local.RemoteMultiaddr(), l.peer.Pretty(), l.proto, err)
+			return
+		}
+		local = authed
+	}
+
 	remote, err := l.dial(l.ctx)
 	if err != nil {
 		local.Close()
@@ -3,6 +3,7 @@ package p2p
 import (
 	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
 	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
 	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
 	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
 )
@@ -15,6 +16,9 @@ type P2P struct {
 	ListenersP2P   *Listeners
 	Streams        *StreamRegistry
 
+	handlers handlers
+	acls     acls
+
 	identity  peer.ID
 	peerHost  p2phost.Host
 	peerstore pstore.Peerstore
@@ -35,6 +39,9 @@ func NewP2P(identity peer.ID, peerHost p2phost.Host, peerstore pstore.Peerstore)
 			ConnManager: peerHost.ConnManager(),
 			conns:       map[peer.ID]int{},
 		},
+
+		handlers: handlers{protos: map[protocol.ID]struct{}{}},
+		acls:     acls{m: map[protocol.ID]ACL{}},
 	}
 }
 
@@ -38,6 +38,13 @@ func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Mu
 		reportRemote: reportRemote,
 	}
 
+	if p2p.handlers.has(proto) {
+		return nil, ErrProtocolInUse
+	}
+	if !p2p.acl(proto).AllowsTarget(addr) {
+		return nil, ErrNotAllowed
+	}
+
 	if err := p2p.ListenersP2P.Register(listener); err != nil {
 		return nil, err
 	}
@@ -46,14 +53,19 @@ func (p2p *P2P) ForwardRemote(ctx context.Context, proto protocol.ID, addr ma.Mu
 }
 
 func (l *remoteListener) handleStream(remote net.Stream) {
+	peer := remote.Conn().RemotePeer()
+	if !l.p2p.acl(l.proto).AllowsPeer(peer) {
+		log.Debugf("refusing the stream of %s from %s, not allowed by its ACL", l.proto, peer.Pretty())
+		remote.Reset()
+		return
+	}
+
 	local, err := manet.Dial(l.addr)
 	if err != nil {
 		remote.Reset()
 		return
 	}
 
-	peer := remote.Conn().RemotePeer()
-
 	if l.reportRemote {
 		if _, err := fmt.Fprintf(local, "%s\n", peer.Pretty()); err != nil {
 			remote.Reset()
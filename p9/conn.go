@@ -0,0 +1,409 @@
+package p9
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+// reqsPerConn bounds the number of requests of a connection handled at once.
+const reqsPerConn = 16
+
+var (
+	errMessageSize = errors.New("p9: invalid message size")
+	errTagInUse    = errors.New("p9: tag already in use")
+)
+
+// conn is the session of a client.
+type conn struct {
+	s      *Server
+	rwc    net.Conn
+	cancel context.CancelFunc
+
+	// wlk serializes the replies
+	wlk sync.Mutex
+
+	// pending counts the requests being handled
+	pending sync.WaitGroup
+
+	lk    sync.Mutex
+	msize uint32
+	dotl  bool
+	fids  map[uint32]*fid
+	reqs  map[uint16]*request
+}
+
+// request is a request being handled, which Tflush cancels.
+type request struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// fid is a fid of the client, pointing to an entry by its id in the path
+// table.
+type fid struct {
+	id   uint64
+	user string
+	uid  uint32
+
+	lk       sync.Mutex
+	opened   bool
+	writable bool
+	// rclose is set for the fids opened with ORCLOSE, removed on clunk
+	rclose bool
+	// written is set once the fid was written to, the changes are flushed
+	// on clunk
+	written bool
+	// dir holds the stats of the entries of the directory read with Tread,
+	// dirOffset and dirIndex the position of the next read
+	dir       [][]byte
+	dirOffset uint64
+	dirIndex  int
+}
+
+// handler handles a request, writing its results to res.
+type handler func(c *conn, ctx context.Context, args *decoder, res *encoder) error
+
+// handlers are the handlers of the messages of 9P2000, dotlHandlers the ones
+// of the messages added by 9P2000.L. Tversion and Tflush are handled by the
+// connection.
+var (
+	handlers = map[uint8]handler{
+		msgTauth:   (*conn).auth,
+		msgTattach: (*conn).attach,
+		msgTwalk:   (*conn).walk,
+		msgTopen:   (*conn).open,
+		msgTcreate: (*conn).create,
+		msgTread:   (*conn).read,
+		msgTwrite:  (*conn).write,
+		msgTclunk:  (*conn).clunk,
+		msgTremove: (*conn).remove,
+		msgTstat:   (*conn).stat,
+		msgTwstat:  (*conn).wstat,
+	}
+
+	dotlHandlers = map[uint8]handler{
+		msgTstatfs:     (*conn).statfs,
+		msgTlopen:      (*conn).lopen,
+		msgTlcreate:    (*conn).lcreate,
+		msgTsymlink:    (*conn).symlink,
+		msgTmknod:      (*conn).notSupported,
+		msgTrename:     (*conn).rename,
+		msgTreadlink:   (*conn).readlink,
+		msgTgetattr:    (*conn).getattr,
+		msgTsetattr:    (*conn).setattr,
+		msgTxattrwalk:  (*conn).notSupported,
+		msgTxattrcreat: (*conn).notSupported,
+		msgTreaddir:    (*conn).readdir,
+		msgTfsync:      (*conn).fsync,
+		msgTlock:       (*conn).lock,
+		msgTgetlock:    (*conn).getlock,
+		msgTlink:       (*conn).notSupported,
+		msgTmkdir:      (*conn).mkdir,
+		msgTrenameat:   (*conn).renameat,
+		msgTunlinkat:   (*conn).unlinkat,
+	}
+)
+
+// serveConn handles the requests sent on rwc until it is closed.
+func (s *Server) serveConn(ctx context.Context, rwc net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer rwc.Close()
+	go func() {
+		<-ctx.Done()
+		rwc.Close()
+	}()
+
+	c := &conn{
+		s:      s,
+		rwc:    rwc,
+		cancel: cancel,
+		msize:  maxMsize,
+		fids:   make(map[uint32]*fid),
+		reqs:   make(map[uint16]*request),
+	}
+	defer func() {
+		c.pending.Wait()
+		c.clunkAll(context.Background())
+	}()
+
+	sem := make(chan struct{}, reqsPerConn)
+	rd := bufio.NewReader(rwc)
+	for {
+		typ, tag, body, err := c.readMsg(rd)
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				log.Debugf("p9: reading from %s: %s", rwc.RemoteAddr(), err)
+			}
+			return
+		}
+
+		switch typ {
+		case msgTversion:
+			// the session is reset once the requests are done
+			c.pending.Wait()
+			c.reply(tag, c.version(ctx, body))
+			continue
+		case msgTflush:
+			c.pending.Add(1)
+			go func() {
+				defer c.pending.Done()
+				c.reply(tag, c.flush(body))
+			}()
+			continue
+		}
+
+		rctx, rcancel := context.WithCancel(ctx)
+		req := &request{cancel: rcancel, done: make(chan struct{})}
+		c.lk.Lock()
+		if _, ok := c.reqs[tag]; ok || tag == noTag {
+			c.lk.Unlock()
+			rcancel()
+			log.Debugf("p9: %s from %s", errTagInUse, rwc.RemoteAddr())
+			return
+		}
+		c.reqs[tag] = req
+		c.lk.Unlock()
+
+		sem <- struct{}{}
+		c.pending.Add(1)
+		go func() {
+			defer c.pending.Done()
+			defer func() { <-sem }()
+			defer rcancel()
+			c.reply(tag, c.handle(rctx, typ, body))
+			close(req.done)
+		}()
+	}
+}
+
+// readMsg reads a message, returning its type, its tag and its body.
+func (c *conn) readMsg(rd io.Reader) (uint8, uint16, []byte, error) {
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(rd, hdr[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	size := binary.LittleEndian.Uint32(hdr[:4])
+	c.lk.Lock()
+	msize := c.msize
+	c.lk.Unlock()
+	if size < headerSize || size > msize {
+		return 0, 0, nil, errMessageSize
+	}
+	body := make([]byte, size-headerSize)
+	if _, err := io.ReadFull(rd, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return hdr[4], binary.LittleEndian.Uint16(hdr[5:]), body, nil
+}
+
+// msg is a reply, its type and its body.
+type msg struct {
+	typ  uint8
+	body []byte
+}
+
+// reply sends the reply to the request tag. The request is forgotten before
+// the reply is sent, so that the client can reuse the tag at once.
+func (c *conn) reply(tag uint16, m msg) {
+	c.wlk.Lock()
+	defer c.wlk.Unlock()
+	c.lk.Lock()
+	delete(c.reqs, tag)
+	c.lk.Unlock()
+
+	buf := make([]byte, headerSize+len(m.body))
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+	buf[4] = m.typ
+	binary.LittleEndian.PutUint16(buf[5:], tag)
+	copy(buf[headerSize:], m.body)
+	if _, err := c.rwc.Write(buf); err != nil {
+		c.cancel()
+	}
+}
+
+// handle handles the request of type typ, returning its reply.
+func (c *conn) handle(ctx context.Context, typ uint8, body []byte) msg {
+	c.lk.Lock()
+	dotl := c.dotl
+	c.lk.Unlock()
+
+	h, ok := handlers[typ]
+	if !ok && dotl {
+		h, ok = dotlHandlers[typ]
+	}
+	err := errNoSys
+	res := &encoder{}
+	if ok {
+		// the root of a batch is never swapped in during a request
+		c.s.node.FilesLock.RLock()
+		err = h(c, ctx, &decoder{b: body}, res)
+		c.s.node.FilesLock.RUnlock()
+	}
+	if err == nil {
+		return msg{typ: typ + 1, body: res.b}
+	}
+
+	e := toP9Error(err)
+	res = &encoder{}
+	if dotl {
+		res.uint32(e.errno)
+		return msg{typ: msgRlerror, body: res.b}
+	}
+	res.string(e.msg)
+	return msg{typ: msgRerror, body: res.b}
+}
+
+// toP9Error returns the error answered for err.
+func toP9Error(err error) *p9Error {
+	switch err {
+	case os.ErrNotExist:
+		return errNoEnt
+	case os.ErrExist, mfs.ErrDirExists:
+		return errExist
+	case context.Canceled:
+		return errIntr
+	case errShortMessage:
+		return errProto
+	}
+	if e, ok := err.(*p9Error); ok {
+		return e
+	}
+	log.Errorf("p9: %s", err)
+	return &p9Error{errno: errIO.errno, msg: err.Error()}
+}
+
+// version negotiates the size of the messages and the protocol, resetting the
+// session.
+func (c *conn) version(ctx context.Context, body []byte) msg {
+	args := &decoder{b: body}
+	msize := args.uint32()
+	version := args.string()
+	if args.check() != nil || msize < minMsize {
+		version = "unknown"
+	}
+	if msize > maxMsize {
+		msize = maxMsize
+	}
+
+	dotl := false
+	switch {
+	case version == "9P2000.L":
+		dotl = true
+	case len(version) >= 6 && version[:6] == "9P2000":
+		// the other extensions, such as 9P2000.u, aren't supported
+		version = "9P2000"
+	default:
+		version = "unknown"
+	}
+
+	c.clunkAll(ctx)
+	if version != "unknown" {
+		c.lk.Lock()
+		c.msize = msize
+		c.dotl = dotl
+		c.lk.Unlock()
+	}
+
+	res := &encoder{}
+	res.uint32(msize)
+	res.string(version)
+	return msg{typ: msgTversion + 1, body: res.b}
+}
+
+// flush cancels a request, replying once its reply was sent.
+func (c *conn) flush(body []byte) msg {
+	args := &decoder{b: body}
+	oldtag := args.uint16()
+	if args.check() == nil {
+		c.lk.Lock()
+		req, ok := c.reqs[oldtag]
+		c.lk.Unlock()
+		if ok {
+			req.cancel()
+			<-req.done
+		}
+	}
+	return msg{typ: msgTflush + 1}
+}
+
+// iounit returns the maximum size of the data of the reads and the writes.
+func (c *conn) iounit() uint32 {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.msize - ioHeaderSize
+}
+
+// isDotl returns true if the client speaks 9P2000.L.
+func (c *conn) isDotl() bool {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	return c.dotl
+}
+
+// fid returns the fid n.
+func (c *conn) fid(n uint32) (*fid, error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	f, ok := c.fids[n]
+	if !ok {
+		return nil, errBadFid
+	}
+	return f, nil
+}
+
+// addFid adds the fid n, which must be unused.
+func (c *conn) addFid(n uint32, f *fid) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if _, ok := c.fids[n]; ok || n == noFid {
+		return errFidInUse
+	}
+	c.fids[n] = f
+	return nil
+}
+
+// setFid sets the fid n, replacing the fid old it pointed to if any.
+func (c *conn) setFid(n uint32, old, f *fid) error {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if cur, ok := c.fids[n]; (ok && cur != old) || n == noFid {
+		return errFidInUse
+	}
+	c.fids[n] = f
+	return nil
+}
+
+// removeFid forgets the fid n and returns it.
+func (c *conn) removeFid(n uint32) (*fid, error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	f, ok := c.fids[n]
+	if !ok {
+		return nil, errBadFid
+	}
+	delete(c.fids, n)
+	return f, nil
+}
+
+// clunkAll releases all the fids of the session.
+func (c *conn) clunkAll(ctx context.Context) {
+	c.lk.Lock()
+	fids := c.fids
+	c.fids = make(map[uint32]*fid)
+	c.lk.Unlock()
+
+	for _, f := range fids {
+		if err := c.s.release(ctx, f); err != nil {
+			log.Errorf("p9: releasing a fid: %s", err)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package p9
+
+import (
+	"context"
+	"time"
+
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+// The messages added by 9P2000.L, with the flags and the modes of Linux.
+
+// The flags of Tlopen and Tlcreate.
+const (
+	lAccMode = 0x3
+	lTrunc   = 0x200
+)
+
+// The types of the entries in their mode.
+const (
+	sIFDir = 0040000
+	sIFReg = 0100000
+	sIFLnk = 0120000
+)
+
+// The types of the entries of Rreaddir.
+const (
+	dtDir = 4
+	dtReg = 8
+	dtLnk = 10
+)
+
+// getattrBasic is the mask of the attributes given by Rgetattr, all but the
+// creation time, the generation and the data version.
+const getattrBasic = 0x7ff
+
+// The attributes set by Tsetattr.
+const (
+	setattrMode     = 0x1
+	setattrSize     = 0x8
+	setattrMtime    = 0x20
+	setattrMtimeSet = 0x100
+)
+
+// atRemoveDir is the flag of Tunlinkat removing a directory.
+const atRemoveDir = 0x200
+
+const (
+	// v9fsMagic is the type of the filesystem given by Rstatfs
+	v9fsMagic = 0x01021997
+
+	blockSize = 4096
+)
+
+// The types of the locks.
+const lockUnlocked = 2
+
+func (c *conn) notSupported(ctx context.Context, args *decoder, res *encoder) error {
+	return errNotSupp
+}
+
+func (c *conn) statfs(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	if _, _, err := c.fidPath(n); err != nil {
+		return err
+	}
+	st, err := corerepo.RepoSize(ctx, c.s.node)
+	if err != nil {
+		return err
+	}
+	total, free := st.StorageMax, uint64(0)
+	if total < st.RepoSize {
+		total = st.RepoSize
+	} else {
+		free = total - st.RepoSize
+	}
+
+	res.uint32(v9fsMagic)
+	res.uint32(blockSize)
+	res.uint64(total / blockSize)
+	res.uint64(free / blockSize)
+	res.uint64(free / blockSize)
+	// the number of entries isn't bounded
+	res.uint64(0)
+	res.uint64(0)
+	res.uint64(0) // fsid
+	res.uint32(maxName)
+	return nil
+}
+
+func (c *conn) lopen(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	flags := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	a, err := c.s.getattr(ctx, p)
+	if err != nil {
+		return err
+	}
+	return c.openFid(ctx, f, p, a, flags&lAccMode != 0, flags&lTrunc != 0, false, res)
+}
+
+func (c *conn) lcreate(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	name := args.string()
+	flags := args.uint32()
+	mode := args.uint32()
+	args.uint32() // gid
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, dir, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	p, err := c.s.create(ctx, dir, name, func(d *mfs.Directory) error {
+		return createFile(d, name)
+	}, corefiles.OpWrite)
+	if err != nil {
+		return err
+	}
+	if err := c.s.setMode(ctx, p, qtFile, mode); err != nil {
+		return err
+	}
+	a, err := c.s.getattr(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	// the fid now points to the file created, opened
+	nf := &fid{id: c.s.paths.id(p), user: f.user, uid: f.uid}
+	if err := c.setFid(n, f, nf); err != nil {
+		return err
+	}
+	return c.openFid(ctx, nf, p, a, flags&lAccMode != 0, false, false, res)
+}
+
+func (c *conn) symlink(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	name := args.string()
+	target := args.string()
+	args.uint32() // gid
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, dir, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	p, err := c.s.create(ctx, dir, name, func(d *mfs.Directory) error {
+		return createSymlink(d, name, target)
+	}, corefiles.OpWrite)
+	if err != nil {
+		return err
+	}
+	return c.writeQid(ctx, res, p)
+}
+
+func (c *conn) mkdir(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	name := args.string()
+	mode := args.uint32()
+	args.uint32() // gid
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, dir, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	p, err := c.s.create(ctx, dir, name, func(d *mfs.Directory) error {
+		_, err := d.Mkdir(name)
+		return err
+	}, corefiles.OpMkdir)
+	if err != nil {
+		return err
+	}
+	if err := c.s.setMode(ctx, p, qtDir, mode); err != nil {
+		return err
+	}
+	return c.writeQid(ctx, res, p)
+}
+
+// writeQid writes the qid of the entry at p.
+func (c *conn) writeQid(ctx context.Context, res *encoder, p string) error {
+	a, err := c.s.getattr(ctx, p)
+	if err != nil {
+		return err
+	}
+	res.qid(c.s.qid(p, a))
+	return nil
+}
+
+func (c *conn) rename(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	dn := args.uint32()
+	name := args.string()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, src, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	_, dir, err := c.fidPath(dn)
+	if err != nil {
+		return err
+	}
+	return c.renameTo(ctx, src, dir, name)
+}
+
+func (c *conn) renameat(ctx context.Context, args *decoder, res *encoder) error {
+	olddn := args.uint32()
+	oldname := args.string()
+	newdn := args.uint32()
+	newname := args.string()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, olddir, err := c.fidPath(olddn)
+	if err != nil {
+		return err
+	}
+	_, newdir, err := c.fidPath(newdn)
+	if err != nil {
+		return err
+	}
+	if oldname == "." || oldname == ".." {
+		return errInval
+	}
+	src, err := childPath(olddir, oldname)
+	if err != nil {
+		return err
+	}
+	return c.renameTo(ctx, src, newdir, newname)
+}
+
+// renameTo moves the entry at src to name in the directory at dir.
+func (c *conn) renameTo(ctx context.Context, src, dir, name string) error {
+	if name == "." || name == ".." {
+		return errInval
+	}
+	dst, err := childPath(dir, name)
+	if err != nil {
+		return err
+	}
+	return c.s.rename(ctx, src, dst)
+}
+
+func (c *conn) unlinkat(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	name := args.string()
+	flags := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, dir, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	if name == "." || name == ".." {
+		return errInval
+	}
+	p, err := childPath(dir, name)
+	if err != nil {
+		return err
+	}
+	kind := removeFile
+	if flags&atRemoveDir != 0 {
+		kind = removeDir
+	}
+	return c.s.remove(ctx, p, kind)
+}
+
+func (c *conn) readlink(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	target, err := c.s.readlink(ctx, p)
+	if err != nil {
+		return err
+	}
+	res.string(target)
+	return nil
+}
+
+func writeTime(res *encoder, t time.Time) {
+	res.uint64(uint64(t.Unix()))
+	res.uint64(uint64(t.Nanosecond()))
+}
+
+// getattr gives the attributes of the entry of a fid. The entries are owned
+// by the user who attached, the group of the user being unknown, the group
+// of the same id is reported.
+func (c *conn) getattr(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	args.uint64() // the mask of the attributes requested
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	a, err := c.s.getattr(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	mode := a.mode & corefiles.ModeMask
+	nlink := uint64(1)
+	switch a.typ {
+	case qtDir:
+		mode |= sIFDir
+		nlink = 2
+	case qtSymlink:
+		mode |= sIFLnk
+	default:
+		mode |= sIFReg
+	}
+	res.uint64(getattrBasic)
+	res.qid(c.s.qid(p, a))
+	res.uint32(mode)
+	res.uint32(f.uid)
+	res.uint32(f.uid)
+	res.uint64(nlink)
+	res.uint64(0) // rdev
+	res.uint64(a.size)
+	res.uint64(blockSize)
+	res.uint64((a.size + 511) / 512)
+	writeTime(res, a.mtime) // atime
+	writeTime(res, a.mtime)
+	writeTime(res, a.mtime) // ctime
+	// btime, gen and data version, not given
+	for i := 0; i < 4; i++ {
+		res.uint64(0)
+	}
+	return nil
+}
+
+func (c *conn) setattr(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	valid := args.uint32()
+	mode := args.uint32()
+	args.uint32() // uid
+	args.uint32() // gid
+	size := args.uint64()
+	args.uint64() // atime
+	args.uint64()
+	mtimeSec := args.uint64()
+	mtimeNsec := args.uint64()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	sa := sattr{
+		setMode:  valid&setattrMode != 0,
+		mode:     mode,
+		setSize:  valid&setattrSize != 0,
+		size:     size,
+		setMtime: valid&setattrMtime != 0,
+	}
+	if sa.setMtime {
+		sa.mtime = time.Now()
+		if valid&setattrMtimeSet != 0 {
+			sa.mtime = time.Unix(int64(mtimeSec), int64(mtimeNsec))
+		}
+	}
+	return c.s.setattr(ctx, p, sa)
+}
+
+// readdir lists a directory, "." and ".." first. The offset of an entry is
+// its position in the listing, plus one.
+func (c *conn) readdir(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	offset := args.uint64()
+	count := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+	if iounit := c.iounit(); count > iounit {
+		count = iounit
+	}
+
+	_, p, err := c.openedFid(n, false)
+	if err != nil {
+		return err
+	}
+	names, err := c.s.list(ctx, p)
+	if err != nil {
+		return err
+	}
+	names = append([]string{".", ".."}, names...)
+
+	out := &encoder{}
+	for i := offset; i < uint64(len(names)); i++ {
+		name := names[i]
+		cp, err := childPath(p, name)
+		if err != nil {
+			return err
+		}
+		a, err := c.s.getattr(ctx, cp)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Debugf("p9: listing %s: %s", cp, err)
+			continue
+		}
+
+		e := &encoder{}
+		e.qid(c.s.qid(cp, a))
+		e.uint64(i + 1)
+		switch a.typ {
+		case qtDir:
+			e.uint8(dtDir)
+		case qtSymlink:
+			e.uint8(dtLnk)
+		default:
+			e.uint8(dtReg)
+		}
+		e.string(name)
+		if len(out.b)+len(e.b) > int(count) {
+			break
+		}
+		out.bytes(e.b)
+	}
+	res.uint32(uint32(len(out.b)))
+	res.bytes(out.b)
+	return nil
+}
+
+// fsync flushes the entry of a fid up to the root of MFS.
+func (c *conn) fsync(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	return c.s.sync(ctx, p)
+}
+
+// lock grants all the locks, they aren't enforced.
+func (c *conn) lock(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+	if _, err := c.fid(n); err != nil {
+		return err
+	}
+	res.uint8(0) // success
+	return nil
+}
+
+// getlock answers that no lock is held.
+func (c *conn) getlock(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	args.uint8() // type
+	start := args.uint64()
+	length := args.uint64()
+	procID := args.uint32()
+	clientID := args.string()
+	if err := args.check(); err != nil {
+		return err
+	}
+	if _, err := c.fid(n); err != nil {
+		return err
+	}
+	res.uint8(lockUnlocked)
+	res.uint64(start)
+	res.uint64(length)
+	res.uint32(procID)
+	res.string(clientID)
+	return nil
+}
@@ -0,0 +1,688 @@
+package p9
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"os"
+	gopath "path"
+	"strings"
+	"time"
+
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+	ft "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs"
+	uio "gx/ipfs/QmdYvDbHp7qAhZ7GsCj6e1cMo55ND6y2mjWVzwdvcv4f12/go-unixfs/io"
+)
+
+// The modes of the entries without a mode set by 'ipfs files chmod'. The
+// entries of /ipfs are never writable.
+const (
+	defaultDirMode  = 0755
+	defaultFileMode = 0644
+	readOnlyMask    = 0555
+)
+
+// The kinds of entries removed.
+const (
+	removeAny = iota
+	removeFile
+	removeDir
+)
+
+// mfsPath returns the path in MFS of the entry at p, if it is in /files.
+func mfsPath(p string) (string, bool) {
+	if p == filesTree {
+		return "/", true
+	}
+	if strings.HasPrefix(p, filesTree+"/") {
+		return p[len(filesTree):], true
+	}
+	return "", false
+}
+
+// treeOf returns the root of the tree holding the entry at p.
+func treeOf(p string) string {
+	if _, ok := mfsPath(p); ok {
+		return filesTree
+	}
+	return ipfsTree
+}
+
+// childPath returns the path of the entry name of the directory at dir,
+// "." and ".." not leaving the tree.
+func childPath(dir, name string) (string, error) {
+	switch {
+	case name == "" || strings.Contains(name, "/"):
+		return "", errInval
+	case len(name) > maxName:
+		return "", errNameTooLong
+	case name == ".":
+		return dir, nil
+	case name == "..":
+		if dir == treeOf(dir) {
+			return dir, nil
+		}
+		return gopath.Dir(dir), nil
+	}
+	return gopath.Join(dir, name), nil
+}
+
+// writable returns the path in MFS of the entry at p, which must be in
+// /files.
+func writable(p string) (string, error) {
+	mp, ok := mfsPath(p)
+	if !ok {
+		return "", errROFS
+	}
+	return mp, nil
+}
+
+// attr holds the attributes of an entry.
+type attr struct {
+	// typ is the type of its qid
+	typ   uint8
+	mode  uint32
+	size  uint64
+	mtime time.Time
+
+	// cid is the version of the entry, undefined for the root of /ipfs
+	cid cid.Cid
+}
+
+// isDir returns true if the entry is a directory.
+func (a *attr) isDir() bool {
+	return a.typ == qtDir
+}
+
+// lookupNode returns the node of the entry at p, nil for the root of /ipfs.
+func (s *Server) lookupNode(ctx context.Context, p string) (ipld.Node, error) {
+	if mp, ok := mfsPath(p); ok {
+		fsn, err := mfs.Lookup(s.node.FilesRoot, mp)
+		if err != nil {
+			return nil, err
+		}
+		return fsn.GetNode()
+	}
+	if p == ipfsTree {
+		return nil, nil
+	}
+
+	ip, err := coreiface.ParsePath(p)
+	if err != nil {
+		return nil, errNoEnt
+	}
+	nd, err := s.api.ResolveNode(ctx, ip)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errNoEnt
+	}
+	return nd, nil
+}
+
+// getattr returns the attributes of the entry at p.
+func (s *Server) getattr(ctx context.Context, p string) (*attr, error) {
+	nd, err := s.lookupNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return s.nodeAttr(p, nd)
+}
+
+// nodeAttr returns the attributes of the entry at p, of node nd.
+func (s *Server) nodeAttr(p string, nd ipld.Node) (*attr, error) {
+	a := &attr{}
+	if nd == nil {
+		a.typ = qtDir
+		a.mode = defaultDirMode & readOnlyMask
+		a.mtime = s.started
+		return a, nil
+	}
+	a.cid = nd.Cid()
+
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return nil, err
+		}
+		switch fsn.Type() {
+		case ft.TDirectory, ft.THAMTShard:
+			a.typ = qtDir
+		case ft.TSymlink:
+			a.typ = qtSymlink
+			a.size = uint64(len(fsn.Data()))
+		default:
+			a.typ = qtFile
+			a.size = fsn.FileSize()
+		}
+	case *dag.RawNode:
+		a.typ = qtFile
+		a.size = uint64(len(nd.RawData()))
+	default:
+		return nil, errNotSupp
+	}
+
+	md, err := corefiles.ReadMetadata(nd)
+	if err != nil {
+		return nil, err
+	}
+	a.mode = md.Mode
+	if a.mode == 0 {
+		switch a.typ {
+		case qtDir:
+			a.mode = defaultDirMode
+		case qtSymlink:
+			a.mode = 0777
+		default:
+			a.mode = defaultFileMode
+		}
+	}
+	if _, ok := mfsPath(p); !ok {
+		a.mode &= readOnlyMask
+	}
+	a.mtime = md.Mtime
+	if a.mtime.IsZero() {
+		a.mtime = s.started
+	}
+	return a, nil
+}
+
+// qid returns the qid of the entry at p, of attributes a. Its version is
+// derived from the CID of the entry.
+func (s *Server) qid(p string, a *attr) qid {
+	h := fnv.New32a()
+	h.Write(a.cid.Bytes())
+	return qid{typ: a.typ, version: h.Sum32(), path: s.paths.id(p)}
+}
+
+// lookupDir returns the directory of MFS at mp.
+func (s *Server) lookupDir(mp string) (*mfs.Directory, error) {
+	fsn, err := mfs.Lookup(s.node.FilesRoot, mp)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := fsn.(*mfs.Directory)
+	if !ok {
+		return nil, errNotDir
+	}
+	return dir, nil
+}
+
+// lookupFile returns the file of MFS at mp.
+func (s *Server) lookupFile(mp string) (*mfs.File, error) {
+	fsn, err := mfs.Lookup(s.node.FilesRoot, mp)
+	if err != nil {
+		return nil, err
+	}
+	fi, ok := fsn.(*mfs.File)
+	if !ok {
+		return nil, errIsDir
+	}
+	return fi, nil
+}
+
+// writeBack returns true if the changes are left to the flusher of the node.
+func (s *Server) writeBack() bool {
+	return s.node.FilesFlusher.WriteBack()
+}
+
+// flushDir flushes the changes of dir up to the root, unless they are left
+// to the flusher of the node.
+func (s *Server) flushDir(dir *mfs.Directory) error {
+	if s.writeBack() {
+		return nil
+	}
+	return dir.Flush()
+}
+
+// changed reports the change of the entry of MFS at mp to the node.
+func (s *Server) changed(ctx context.Context, op string, resized bool, mp, from string) {
+	n := s.node
+	if resized {
+		paths := []string{mp}
+		if from != "" {
+			paths = append(paths, from)
+		}
+		corefiles.AutoShardParents(ctx, n.FilesRoot, n.DAG, n.FilesShardSize, paths...)
+	}
+	n.FilesEvents.NotifyChange(n.FilesRoot, op, mp, from)
+	n.FilesFlusher.Changed()
+}
+
+// list returns the names of the entries of the directory at p.
+func (s *Server) list(ctx context.Context, p string) ([]string, error) {
+	if mp, ok := mfsPath(p); ok {
+		dir, err := s.lookupDir(mp)
+		if err != nil {
+			return nil, err
+		}
+		return dir.ListNames(ctx)
+	}
+	if p == ipfsTree {
+		return nil, nil
+	}
+
+	nd, err := s.lookupNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.nodeAttr(p, nd)
+	if err != nil {
+		return nil, err
+	}
+	if !a.isDir() {
+		return nil, errNotDir
+	}
+	dir, err := uio.NewDirectoryFromNode(s.node.DAG, nd)
+	if err != nil {
+		return nil, err
+	}
+	links, err := dir.Links(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(links))
+	for _, l := range links {
+		names = append(names, l.Name)
+	}
+	return names, nil
+}
+
+// read reads at most count bytes at offset of the file at p.
+func (s *Server) read(ctx context.Context, p string, offset uint64, count uint32) ([]byte, error) {
+	if mp, ok := mfsPath(p); ok {
+		fi, err := s.lookupFile(mp)
+		if err != nil {
+			return nil, err
+		}
+		fd, err := fi.Open(mfs.OpenReadOnly, false)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		size, err := fd.Size()
+		if err != nil {
+			return nil, err
+		}
+		return readAt(fd, uint64(size), offset, count)
+	}
+
+	nd, err := s.lookupNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.nodeAttr(p, nd)
+	if err != nil {
+		return nil, err
+	}
+	switch a.typ {
+	case qtDir:
+		return nil, errIsDir
+	case qtSymlink:
+		return nil, errInval
+	}
+	r, err := uio.NewDagReader(ctx, nd, s.node.DAG)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readAt(r, a.size, offset, count)
+}
+
+// readAt reads at most count bytes at offset of r, of the given size.
+func readAt(r io.ReadSeeker, size, offset uint64, count uint32) ([]byte, error) {
+	if offset >= size {
+		return nil, nil
+	}
+	n := uint64(count)
+	if rest := size - offset; rest < n {
+		n = rest
+	}
+	if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// write writes data at offset of the file at p. The writes aren't flushed up
+// to the root of MFS, the fids written to are flushed when clunked.
+func (s *Server) write(ctx context.Context, p string, offset uint64, data []byte) error {
+	mp, err := writable(p)
+	if err != nil {
+		return err
+	}
+	fi, err := s.lookupFile(mp)
+	if err != nil {
+		return err
+	}
+
+	fd, err := fi.Open(mfs.OpenWriteOnly, false)
+	if err != nil {
+		return err
+	}
+	_, err = fd.WriteAt(data, int64(offset))
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	s.changed(ctx, corefiles.OpWrite, false, mp, "")
+	return nil
+}
+
+// create creates the entry name of the directory at dir with mk, failing if
+// it exists. It returns the path of the entry.
+func (s *Server) create(ctx context.Context, dir, name string, mk func(d *mfs.Directory) error, op string) (string, error) {
+	mdir, err := writable(dir)
+	if err != nil {
+		return "", err
+	}
+	if name == "." || name == ".." {
+		return "", errExist
+	}
+	p, err := childPath(dir, name)
+	if err != nil {
+		return "", err
+	}
+	d, err := s.lookupDir(mdir)
+	if err != nil {
+		return "", err
+	}
+
+	switch _, err := d.Child(name); err {
+	case nil:
+		return "", errExist
+	case os.ErrNotExist:
+	default:
+		return "", err
+	}
+
+	if err := mk(d); err != nil {
+		return "", err
+	}
+	if err := s.flushDir(d); err != nil {
+		return "", err
+	}
+	s.changed(ctx, op, true, gopath.Join(mdir, name), "")
+	return p, nil
+}
+
+// createFile creates an empty file in d.
+func createFile(d *mfs.Directory, name string) error {
+	nd := dag.NodeWithData(ft.FilePBData(nil, 0))
+	nd.SetCidBuilder(d.GetCidBuilder())
+	return d.AddChild(name, nd)
+}
+
+// createSymlink creates a symbolic link to target in d.
+func createSymlink(d *mfs.Directory, name, target string) error {
+	data, err := ft.SymlinkData(target)
+	if err != nil {
+		return err
+	}
+	nd := dag.NodeWithData(data)
+	nd.SetCidBuilder(d.GetCidBuilder())
+	return d.AddChild(name, nd)
+}
+
+// remove removes the entry at p, of the given kind. The directories must be
+// empty.
+func (s *Server) remove(ctx context.Context, p string, kind int) error {
+	mp, err := writable(p)
+	if err != nil {
+		return err
+	}
+	if mp == "/" {
+		return errPerm
+	}
+	mdir, name := gopath.Split(mp)
+	d, err := s.lookupDir(mdir)
+	if err != nil {
+		return err
+	}
+	child, err := d.Child(name)
+	if err != nil {
+		return err
+	}
+
+	switch child := child.(type) {
+	case *mfs.Directory:
+		if kind == removeFile {
+			return errIsDir
+		}
+		names, err := child.ListNames(ctx)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return errNotEmpty
+		}
+	default:
+		if kind == removeDir {
+			return errNotDir
+		}
+	}
+
+	if err := d.Unlink(name); err != nil {
+		return err
+	}
+	if err := s.flushDir(d); err != nil {
+		return err
+	}
+	s.changed(ctx, corefiles.OpRemove, true, mp, "")
+	s.paths.remove(p)
+	return nil
+}
+
+// rename moves the entry at src to dst, replacing the file or the empty
+// directory found there.
+func (s *Server) rename(ctx context.Context, src, dst string) error {
+	msrc, err := writable(src)
+	if err != nil {
+		return err
+	}
+	mdst, err := writable(dst)
+	if err != nil {
+		return err
+	}
+	if src == dst {
+		return nil
+	}
+	if msrc == "/" || mdst == "/" || strings.HasPrefix(dst, src+"/") {
+		return errInval
+	}
+
+	fromDir, fromName := gopath.Split(msrc)
+	toDir, toName := gopath.Split(mdst)
+	srcDir, err := s.lookupDir(fromDir)
+	if err != nil {
+		return err
+	}
+	srcChild, err := srcDir.Child(fromName)
+	if err != nil {
+		return err
+	}
+	_, srcIsDir := srcChild.(*mfs.Directory)
+	dstDir, err := s.lookupDir(toDir)
+	if err != nil {
+		return err
+	}
+	existing, err := dstDir.Child(toName)
+	switch err {
+	case nil:
+		if dir, ok := existing.(*mfs.Directory); ok {
+			if !srcIsDir {
+				return errIsDir
+			}
+			names, err := dir.ListNames(ctx)
+			if err != nil {
+				return err
+			}
+			if len(names) > 0 {
+				return errNotEmpty
+			}
+		} else if srcIsDir {
+			return errNotDir
+		}
+		// mfs.Mv would move the entry into an existing directory
+		if err := dstDir.Unlink(toName); err != nil {
+			return err
+		}
+	case os.ErrNotExist:
+	default:
+		return err
+	}
+
+	if err := mfs.Mv(s.node.FilesRoot, msrc, mdst); err != nil {
+		return err
+	}
+	for _, mp := range []string{fromDir, toDir} {
+		d, err := s.lookupDir(mp)
+		if err != nil {
+			return err
+		}
+		if err := s.flushDir(d); err != nil {
+			return err
+		}
+	}
+	s.changed(ctx, corefiles.OpMove, true, mdst, msrc)
+	s.paths.rename(src, dst)
+	return nil
+}
+
+// sattr holds the attributes to set. The owners and the access times aren't
+// stored, they are ignored.
+type sattr struct {
+	setMode  bool
+	mode     uint32
+	setSize  bool
+	size     uint64
+	setMtime bool
+	mtime    time.Time
+}
+
+// setattr applies sa to the entry at p.
+func (s *Server) setattr(ctx context.Context, p string, sa sattr) error {
+	if !sa.setMode && !sa.setSize && !sa.setMtime {
+		return nil
+	}
+	mp, err := writable(p)
+	if err != nil {
+		return err
+	}
+	flush := !s.writeBack()
+
+	if sa.setSize {
+		fi, err := s.lookupFile(mp)
+		if err != nil {
+			return err
+		}
+		fd, err := fi.Open(mfs.OpenWriteOnly, flush)
+		if err != nil {
+			return err
+		}
+		err = fd.Truncate(int64(sa.size))
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		s.changed(ctx, corefiles.OpWrite, false, mp, "")
+	}
+	if (sa.setMode || sa.setMtime) && mp == "/" {
+		return errPerm
+	}
+	if sa.setMode {
+		err := corefiles.Chmod(s.node.FilesRoot, mp, sa.mode&corefiles.ModeMask, flush)
+		if err != nil {
+			return err
+		}
+		s.changed(ctx, corefiles.OpChmod, false, mp, "")
+	}
+	if sa.setMtime {
+		err := corefiles.Touch(s.node.FilesRoot, mp, sa.mtime, flush)
+		if err != nil {
+			return err
+		}
+		s.changed(ctx, corefiles.OpTouch, false, mp, "")
+	}
+	return nil
+}
+
+// readlink returns the target of the symbolic link at p.
+func (s *Server) readlink(ctx context.Context, p string) (string, error) {
+	nd, err := s.lookupNode(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return "", errInval
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return "", err
+	}
+	if fsn.Type() != ft.TSymlink {
+		return "", errInval
+	}
+	return string(fsn.Data()), nil
+}
+
+// sync flushes the entry at p up to the root of MFS and waits for the root to
+// be published, even in write-back mode.
+func (s *Server) sync(ctx context.Context, p string) error {
+	mp, ok := mfsPath(p)
+	if !ok {
+		return nil
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- mfs.FlushPath(s.node.FilesRoot, mp)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release releases the fid f once clunked: the fids opened with ORCLOSE are
+// removed, and the changes made through the fids written to are flushed,
+// unless they are left to the flusher of the node.
+func (s *Server) release(ctx context.Context, f *fid) error {
+	f.lk.Lock()
+	rclose, written := f.rclose, f.written
+	f.lk.Unlock()
+	if !rclose && !written {
+		return nil
+	}
+
+	p, err := s.paths.path(f.id)
+	if err != nil {
+		return nil // removed
+	}
+	if rclose {
+		return s.remove(ctx, p, removeAny)
+	}
+	if s.writeBack() {
+		return nil
+	}
+	return s.sync(ctx, p)
+}
@@ -0,0 +1,244 @@
+package p9
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The 9P2000 protocol, see intro(5) of Plan 9, and the messages added by
+// 9P2000.L. The type of a reply is the type of its request plus one.
+const (
+	msgRlerror     = 7
+	msgTstatfs     = 8
+	msgTlopen      = 12
+	msgTlcreate    = 14
+	msgTsymlink    = 16
+	msgTmknod      = 18
+	msgTrename     = 20
+	msgTreadlink   = 22
+	msgTgetattr    = 24
+	msgTsetattr    = 26
+	msgTxattrwalk  = 30
+	msgTxattrcreat = 32
+	msgTreaddir    = 40
+	msgTfsync      = 50
+	msgTlock       = 52
+	msgTgetlock    = 54
+	msgTlink       = 70
+	msgTmkdir      = 72
+	msgTrenameat   = 74
+	msgTunlinkat   = 76
+
+	msgTversion = 100
+	msgTauth    = 102
+	msgTattach  = 104
+	msgRerror   = 107
+	msgTflush   = 108
+	msgTwalk    = 110
+	msgTopen    = 112
+	msgTcreate  = 114
+	msgTread    = 116
+	msgTwrite   = 118
+	msgTclunk   = 120
+	msgTremove  = 122
+	msgTstat    = 124
+	msgTwstat   = 126
+)
+
+const (
+	// headerSize is the size of the header of the messages: their size, type
+	// and tag
+	headerSize = 4 + 1 + 2
+
+	// ioHeaderSize is the size of Twrite and Rread without their data, the
+	// iounit given to the clients being the message size without it
+	ioHeaderSize = 24
+
+	// minMsize is the smallest message size accepted
+	minMsize = 512
+
+	// maxMsize is the largest message size negotiated
+	maxMsize = 1<<20 + ioHeaderSize
+
+	noTag = 0xffff
+	noFid = 0xffffffff
+
+	// maxWalk is the maximum number of names of a walk
+	maxWalk = 16
+
+	// maxName is the maximum length of the names of the entries
+	maxName = 255
+)
+
+// The types of the qids.
+const (
+	qtDir     = 0x80
+	qtSymlink = 0x02
+	qtFile    = 0x00
+)
+
+// The bits of the modes of 9P2000.
+const (
+	dmDir     = 0x80000000
+	dmSymlink = 0x02000000
+)
+
+// The modes of Topen.
+const (
+	oRead   = 0
+	oWrite  = 1
+	oRdwr   = 2
+	oExec   = 3
+	oTrunc  = 0x10
+	oRclose = 0x40
+)
+
+// noChange is the value of the integers of Twstat left unchanged.
+const noChange = ^uint32(0)
+
+var errShortMessage = errors.New("p9: short message")
+
+// qid identifies an entry and its version.
+type qid struct {
+	typ     uint8
+	version uint32
+	path    uint64
+}
+
+// decoder reads the fields of a message, little-endian. Reading past the end
+// of the message sets its error, and zero values are returned.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShortMessage
+		return nil
+	}
+	out := d.b[:n]
+	d.b = d.b[n:]
+	return out
+}
+
+func (d *decoder) uint8() uint8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (d *decoder) string() string {
+	return string(d.next(int(d.uint16())))
+}
+
+func (d *decoder) qid() qid {
+	return qid{typ: d.uint8(), version: d.uint32(), path: d.uint64()}
+}
+
+// check returns errShortMessage if the message was too short for the fields
+// read.
+func (d *decoder) check() error {
+	return d.err
+}
+
+// encoder writes the fields of a message.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) uint8(v uint8) {
+	e.b = append(e.b, v)
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.b = append(e.b, byte(v), byte(v>>8))
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.b = append(e.b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.uint32(uint32(v))
+	e.uint32(uint32(v >> 32))
+}
+
+func (e *encoder) string(s string) {
+	if len(s) > 0xffff {
+		s = s[:0xffff]
+	}
+	e.uint16(uint16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.b = append(e.b, b...)
+}
+
+func (e *encoder) qid(q qid) {
+	e.uint8(q.typ)
+	e.uint32(q.version)
+	e.uint64(q.path)
+}
+
+// p9Error is an error answered with its Linux error number to the 9P2000.L
+// clients, and with its message to the others.
+type p9Error struct {
+	errno uint32
+	msg   string
+}
+
+func (e *p9Error) Error() string {
+	return e.msg
+}
+
+var (
+	errPerm        = &p9Error{1, "permission denied"}
+	errNoEnt       = &p9Error{2, "file does not exist"}
+	errIntr        = &p9Error{4, "interrupted"}
+	errIO          = &p9Error{5, "i/o error"}
+	errBadFid      = &p9Error{9, "unknown fid"}
+	errExist       = &p9Error{17, "file exists"}
+	errNotDir      = &p9Error{20, "not a directory"}
+	errIsDir       = &p9Error{21, "is a directory"}
+	errInval       = &p9Error{22, "bad arg in system call"}
+	errFidInUse    = &p9Error{22, "fid already in use"}
+	errBadOffset   = &p9Error{22, "bad offset in directory read"}
+	errROFS        = &p9Error{30, "read-only file system"}
+	errNameTooLong = &p9Error{36, "file name too long"}
+	errNoSys       = &p9Error{38, "function not implemented"}
+	errNotEmpty    = &p9Error{39, "directory not empty"}
+	errProto       = &p9Error{71, "malformed message"}
+	errNotSupp     = &p9Error{95, "operation not supported"}
+	errNoAuth      = &p9Error{95, "authentication not required"}
+)
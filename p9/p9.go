@@ -0,0 +1,535 @@
+package p9
+
+import (
+	"context"
+	gopath "path"
+	"time"
+
+	corefiles "github.com/ipfs/go-ipfs/core/corefiles"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+// The messages of 9P2000, some of them being used by the 9P2000.L clients
+// too.
+
+// fidPath returns the fid n and the path of its entry.
+func (c *conn) fidPath(n uint32) (*fid, string, error) {
+	f, err := c.fid(n)
+	if err != nil {
+		return nil, "", err
+	}
+	p, err := c.s.paths.path(f.id)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, p, nil
+}
+
+// openedFid returns the fid n, which must be open, and the path of its
+// entry.
+func (c *conn) openedFid(n uint32, write bool) (*fid, string, error) {
+	f, p, err := c.fidPath(n)
+	if err != nil {
+		return nil, "", err
+	}
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	if !f.opened || (write && !f.writable) {
+		return nil, "", errBadFid
+	}
+	return f, p, nil
+}
+
+// entryName returns the name of the entry at p in its stat.
+func entryName(p string) string {
+	if p == treeOf(p) {
+		return "/"
+	}
+	return gopath.Base(p)
+}
+
+// writeStat writes the stat of the entry at p, of attributes a, owned by
+// user.
+func (s *Server) writeStat(res *encoder, p string, a *attr, user string) {
+	if user == "" {
+		user = "none"
+	}
+	mode := a.mode & 0777
+	size := a.size
+	switch a.typ {
+	case qtDir:
+		mode |= dmDir
+		size = 0
+	case qtSymlink:
+		mode |= dmSymlink
+	}
+	mtime := uint32(a.mtime.Unix())
+
+	st := &encoder{}
+	st.uint16(0) // type
+	st.uint32(0) // dev
+	st.qid(s.qid(p, a))
+	st.uint32(mode)
+	st.uint32(mtime) // atime
+	st.uint32(mtime)
+	st.uint64(size)
+	st.string(entryName(p))
+	st.string(user)
+	st.string(user)
+	st.string(user)
+	res.uint16(uint16(len(st.b)))
+	res.bytes(st.b)
+}
+
+// defaultMode returns the mode of the new entries of the given type.
+func defaultMode(typ uint8) uint32 {
+	if typ == qtDir {
+		return defaultDirMode
+	}
+	return defaultFileMode
+}
+
+// setMode sets the mode of the entry created at p, of the given type, when
+// it isn't the default one.
+func (s *Server) setMode(ctx context.Context, p string, typ uint8, mode uint32) error {
+	mode &= corefiles.ModeMask
+	if mode == defaultMode(typ) {
+		return nil
+	}
+	return s.setattr(ctx, p, sattr{setMode: true, mode: mode})
+}
+
+func (c *conn) auth(ctx context.Context, args *decoder, res *encoder) error {
+	return errNoAuth
+}
+
+func (c *conn) attach(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	afid := args.uint32()
+	uname := args.string()
+	aname := args.string()
+	var uid uint32
+	if c.isDotl() {
+		if uid = args.uint32(); uid == noFid {
+			uid = 0
+		}
+	}
+	if err := args.check(); err != nil {
+		return err
+	}
+	if afid != noFid {
+		return errNoAuth
+	}
+
+	root := filesTree
+	if aname != "" {
+		root = gopath.Clean("/" + aname)
+	}
+	if root != filesTree && root != ipfsTree {
+		return errNoEnt
+	}
+	a, err := c.s.getattr(ctx, root)
+	if err != nil {
+		return err
+	}
+	f := &fid{id: c.s.paths.id(root), user: uname, uid: uid}
+	if err := c.addFid(n, f); err != nil {
+		return err
+	}
+	res.qid(c.s.qid(root, a))
+	return nil
+}
+
+func (c *conn) walk(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	newn := args.uint32()
+	nwname := int(args.uint16())
+	if nwname > maxWalk {
+		return errInval
+	}
+	names := make([]string, nwname)
+	for i := range names {
+		names[i] = args.string()
+	}
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+
+	// the walk stops at the first name not found, failing if it is the
+	// first one
+	var a *attr
+	if len(names) > 0 {
+		if a, err = c.s.getattr(ctx, p); err != nil {
+			return err
+		}
+	}
+	qids := make([]qid, 0, len(names))
+	for i, name := range names {
+		var np string
+		err := errNotDir
+		if a.isDir() {
+			np, err = childPath(p, name)
+			if err == nil {
+				a, err = c.s.getattr(ctx, np)
+			}
+		}
+		if err != nil {
+			if i == 0 {
+				return err
+			}
+			break
+		}
+		p = np
+		qids = append(qids, c.s.qid(p, a))
+	}
+
+	if len(qids) == len(names) {
+		nf := &fid{id: c.s.paths.id(p), user: f.user, uid: f.uid}
+		if newn == n {
+			err = c.setFid(n, f, nf)
+		} else {
+			err = c.addFid(newn, nf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	res.uint16(uint16(len(qids)))
+	for _, q := range qids {
+		res.qid(q)
+	}
+	return nil
+}
+
+// openFid opens f, at p of attributes a, answering its qid and the iounit.
+func (c *conn) openFid(ctx context.Context, f *fid, p string, a *attr, write, trunc, rclose bool, res *encoder) error {
+	f.lk.Lock()
+	opened := f.opened
+	f.lk.Unlock()
+	if opened {
+		return errInval
+	}
+
+	if write || trunc || rclose {
+		if a.isDir() && (write || trunc) {
+			return errIsDir
+		}
+		if _, err := writable(p); err != nil {
+			return err
+		}
+	}
+	if trunc {
+		if err := c.s.setattr(ctx, p, sattr{setSize: true}); err != nil {
+			return err
+		}
+		var err error
+		if a, err = c.s.getattr(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	f.lk.Lock()
+	f.opened = true
+	f.writable = write
+	f.rclose = rclose
+	f.lk.Unlock()
+	res.qid(c.s.qid(p, a))
+	res.uint32(c.iounit())
+	return nil
+}
+
+func (c *conn) open(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	mode := args.uint8()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	a, err := c.s.getattr(ctx, p)
+	if err != nil {
+		return err
+	}
+	write := mode&3 == oWrite || mode&3 == oRdwr
+	return c.openFid(ctx, f, p, a, write, mode&oTrunc != 0, mode&oRclose != 0, res)
+}
+
+func (c *conn) create(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	name := args.string()
+	perm := args.uint32()
+	mode := args.uint8()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, dir, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	f.lk.Lock()
+	opened := f.opened
+	f.lk.Unlock()
+	if opened {
+		return errInval
+	}
+
+	var p string
+	typ := uint8(qtFile)
+	switch {
+	case perm&dmSymlink != 0:
+		// the symbolic links are created by 9P2000.u, not supported
+		return errNotSupp
+	case perm&dmDir != 0:
+		typ = qtDir
+		p, err = c.s.create(ctx, dir, name, func(d *mfs.Directory) error {
+			_, err := d.Mkdir(name)
+			return err
+		}, corefiles.OpMkdir)
+	default:
+		p, err = c.s.create(ctx, dir, name, func(d *mfs.Directory) error {
+			return createFile(d, name)
+		}, corefiles.OpWrite)
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.s.setMode(ctx, p, typ, perm&0777); err != nil {
+		return err
+	}
+	a, err := c.s.getattr(ctx, p)
+	if err != nil {
+		return err
+	}
+
+	// the fid now points to the entry created, opened
+	nf := &fid{id: c.s.paths.id(p), user: f.user, uid: f.uid}
+	if err := c.setFid(n, f, nf); err != nil {
+		return err
+	}
+	write := mode&3 == oWrite || mode&3 == oRdwr
+	return c.openFid(ctx, nf, p, a, write, false, mode&oRclose != 0, res)
+}
+
+func (c *conn) read(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	offset := args.uint64()
+	count := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+	if iounit := c.iounit(); count > iounit {
+		count = iounit
+	}
+
+	f, p, err := c.openedFid(n, false)
+	if err != nil {
+		return err
+	}
+	a, err := c.s.getattr(ctx, p)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch {
+	case !a.isDir():
+		data, err = c.s.read(ctx, p, offset, count)
+	case c.isDotl():
+		// the directories are read with Treaddir
+		err = errIsDir
+	default:
+		data, err = c.readDir(ctx, f, p, offset, count)
+	}
+	if err != nil {
+		return err
+	}
+	res.uint32(uint32(len(data)))
+	res.bytes(data)
+	return nil
+}
+
+// readDir reads the stats of the entries of the directory at p, from the
+// start at offset 0, or from where the previous read of f ended.
+func (c *conn) readDir(ctx context.Context, f *fid, p string, offset uint64, count uint32) ([]byte, error) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	if offset == 0 {
+		names, err := c.s.list(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		stats := make([][]byte, 0, len(names))
+		for _, name := range names {
+			cp := gopath.Join(p, name)
+			a, err := c.s.getattr(ctx, cp)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				log.Debugf("p9: listing %s: %s", cp, err)
+				continue
+			}
+			st := &encoder{}
+			c.s.writeStat(st, cp, a, f.user)
+			stats = append(stats, st.b)
+		}
+		f.dir, f.dirOffset, f.dirIndex = stats, 0, 0
+	} else if offset != f.dirOffset {
+		return nil, errBadOffset
+	}
+
+	var out []byte
+	for f.dirIndex < len(f.dir) && len(out)+len(f.dir[f.dirIndex]) <= int(count) {
+		out = append(out, f.dir[f.dirIndex]...)
+		f.dirIndex++
+	}
+	if len(out) == 0 && f.dirIndex < len(f.dir) {
+		// the next stat doesn't fit
+		return nil, errInval
+	}
+	f.dirOffset += uint64(len(out))
+	return out, nil
+}
+
+func (c *conn) write(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	offset := args.uint64()
+	count := args.uint32()
+	data := args.next(int(count))
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, p, err := c.openedFid(n, true)
+	if err != nil {
+		return err
+	}
+	if err := c.s.write(ctx, p, offset, data); err != nil {
+		return err
+	}
+	f.lk.Lock()
+	f.written = true
+	f.lk.Unlock()
+	res.uint32(uint32(len(data)))
+	return nil
+}
+
+func (c *conn) clunk(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, err := c.removeFid(n)
+	if err != nil {
+		return err
+	}
+	return c.s.release(ctx, f)
+}
+
+// remove removes the entry of a fid, clunking the fid even if the removal
+// fails.
+func (c *conn) remove(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, err := c.removeFid(n)
+	if err != nil {
+		return err
+	}
+	p, err := c.s.paths.path(f.id)
+	if err != nil {
+		return err
+	}
+	return c.s.remove(ctx, p, removeAny)
+}
+
+func (c *conn) stat(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	f, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+	a, err := c.s.getattr(ctx, p)
+	if err != nil {
+		return err
+	}
+	// the stat is prefixed by its size, as a field of the message
+	st := &encoder{}
+	c.s.writeStat(st, p, a, f.user)
+	res.uint16(uint16(len(st.b)))
+	res.bytes(st.b)
+	return nil
+}
+
+// wstat renames the entry in its directory, and sets its mode, its
+// modification time and its length. A stat changing nothing syncs the entry.
+func (c *conn) wstat(ctx context.Context, args *decoder, res *encoder) error {
+	n := args.uint32()
+	args.uint16() // the size of the field
+	args.uint16() // the size of the stat
+	args.uint16() // type
+	args.uint32() // dev
+	args.qid()
+	mode := args.uint32()
+	args.uint32() // atime
+	mtime := args.uint32()
+	length := args.uint64()
+	name := args.string()
+	args.string() // uid
+	args.string() // gid
+	args.string() // muid
+	if err := args.check(); err != nil {
+		return err
+	}
+
+	_, p, err := c.fidPath(n)
+	if err != nil {
+		return err
+	}
+
+	var sa sattr
+	if mode != noChange {
+		sa.setMode, sa.mode = true, mode&0777
+	}
+	if mtime != noChange {
+		sa.setMtime, sa.mtime = true, time.Unix(int64(mtime), 0)
+	}
+	if length != ^uint64(0) {
+		sa.setSize, sa.size = true, length
+	}
+	if name == "" && !sa.setMode && !sa.setMtime && !sa.setSize {
+		return c.s.sync(ctx, p)
+	}
+
+	if name != "" && name != entryName(p) {
+		if name == "." || name == ".." {
+			return errInval
+		}
+		dst, err := childPath(gopath.Dir(p), name)
+		if err != nil {
+			return err
+		}
+		if err := c.s.rename(ctx, p, dst); err != nil {
+			return err
+		}
+		p = dst
+	}
+	return c.s.setattr(ctx, p, sa)
+}
@@ -0,0 +1,342 @@
+package p9
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	core "github.com/ipfs/go-ipfs/core"
+	coreunix "github.com/ipfs/go-ipfs/core/coreunix"
+
+	mfs "gx/ipfs/QmYnp3EVZqLjzm8NYigcB3aHqDLFmAVUvtaUdYb3nFDtK6/go-mfs"
+)
+
+// testClient sends the requests of the tests, one at a time.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	tag  uint16
+}
+
+func (tc *testClient) rpc(typ uint8, args func(e *encoder)) (uint8, *decoder) {
+	tc.t.Helper()
+	e := &encoder{}
+	if args != nil {
+		args(e)
+	}
+	tc.tag++
+	buf := make([]byte, headerSize, headerSize+len(e.b))
+	binary.LittleEndian.PutUint32(buf, uint32(headerSize+len(e.b)))
+	buf[4] = typ
+	binary.LittleEndian.PutUint16(buf[5:], tc.tag)
+	if _, err := tc.conn.Write(append(buf, e.b...)); err != nil {
+		tc.t.Fatal(err)
+	}
+
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(tc.conn, hdr[:]); err != nil {
+		tc.t.Fatal(err)
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(hdr[:4])-headerSize)
+	if _, err := io.ReadFull(tc.conn, body); err != nil {
+		tc.t.Fatal(err)
+	}
+	if tag := binary.LittleEndian.Uint16(hdr[5:]); tag != tc.tag {
+		tc.t.Fatalf("expected the reply to tag %d, got %d", tc.tag, tag)
+	}
+	return hdr[4], &decoder{b: body}
+}
+
+// call sends a request expected to succeed.
+func (tc *testClient) call(typ uint8, args func(e *encoder)) *decoder {
+	tc.t.Helper()
+	rtyp, d := tc.rpc(typ, args)
+	switch rtyp {
+	case typ + 1:
+		return d
+	case msgRlerror:
+		tc.t.Fatalf("message %d: error %d", typ, d.uint32())
+	case msgRerror:
+		tc.t.Fatalf("message %d: %s", typ, d.string())
+	default:
+		tc.t.Fatalf("message %d: unexpected reply %d", typ, rtyp)
+	}
+	return nil
+}
+
+// fail sends a request expected to fail with expected.
+func (tc *testClient) fail(typ uint8, expected *p9Error, args func(e *encoder)) {
+	tc.t.Helper()
+	rtyp, d := tc.rpc(typ, args)
+	switch rtyp {
+	case msgRlerror:
+		if errno := d.uint32(); errno != expected.errno {
+			tc.t.Fatalf("message %d: expected error %d, got %d", typ, expected.errno, errno)
+		}
+	case msgRerror:
+		if msg := d.string(); msg != expected.msg {
+			tc.t.Fatalf("message %d: expected %q, got %q", typ, expected.msg, msg)
+		}
+	default:
+		tc.t.Fatalf("message %d: expected an error, got reply %d", typ, rtyp)
+	}
+}
+
+func (tc *testClient) version(version string) {
+	tc.t.Helper()
+	r := tc.call(msgTversion, func(e *encoder) {
+		e.uint32(8192)
+		e.string(version)
+	})
+	if msize, v := r.uint32(), r.string(); msize != 8192 || v != version {
+		tc.t.Fatalf("expected %s with messages of 8192 bytes, got %s and %d", version, v, msize)
+	}
+}
+
+func walkArgs(n, newn uint32, names ...string) func(e *encoder) {
+	return func(e *encoder) {
+		e.uint32(n)
+		e.uint32(newn)
+		e.uint16(uint16(len(names)))
+		for _, name := range names {
+			e.string(name)
+		}
+	}
+}
+
+func fidArgs(n uint32) func(e *encoder) {
+	return func(e *encoder) {
+		e.uint32(n)
+	}
+}
+
+func setupServer(t *testing.T) (*core.IpfsNode, *testClient) {
+	node, err := core.NewNode(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node, &testClient{t: t, conn: conn}
+}
+
+func TestServeMFS(t *testing.T) {
+	nd, tc := setupServer(t)
+	defer nd.Close()
+	defer tc.conn.Close()
+
+	tc.version("9P2000.L")
+	tc.call(msgTattach, func(e *encoder) {
+		e.uint32(0)
+		e.uint32(noFid)
+		e.string("user")
+		e.string("")
+		e.uint32(1000)
+	})
+
+	// create and write a file
+	tc.call(msgTwalk, walkArgs(0, 1))
+	tc.call(msgTlcreate, func(e *encoder) {
+		e.uint32(1)
+		e.string("a")
+		e.uint32(2) // O_RDWR
+		e.uint32(0600)
+		e.uint32(0)
+	})
+	data := []byte("hello 9p")
+	r := tc.call(msgTwrite, func(e *encoder) {
+		e.uint32(1)
+		e.uint64(0)
+		e.uint32(uint32(len(data)))
+		e.bytes(data)
+	})
+	if n := r.uint32(); n != uint32(len(data)) {
+		t.Fatalf("expected %d bytes written, got %d", len(data), n)
+	}
+	r = tc.call(msgTread, func(e *encoder) {
+		e.uint32(1)
+		e.uint64(6)
+		e.uint32(100)
+	})
+	if out := r.next(int(r.uint32())); string(out) != "9p" {
+		t.Fatalf("expected to read the end of the file, got %q", out)
+	}
+	tc.call(msgTclunk, fidArgs(1))
+
+	// the file shows up in MFS
+	fsn, err := mfs.Lookup(nd.FilesRoot, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := fsn.(*mfs.File).Open(mfs.OpenReadOnly, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(fd)
+	fd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("expected %q in MFS, got %q", data, out)
+	}
+
+	tc.call(msgTwalk, walkArgs(0, 1, "a"))
+	r = tc.call(msgTgetattr, func(e *encoder) {
+		e.uint32(1)
+		e.uint64(getattrBasic)
+	})
+	r.uint64()
+	if q := r.qid(); q.typ != qtFile {
+		t.Fatalf("expected the qid of a file, got type %d", q.typ)
+	}
+	if mode, uid := r.uint32(), r.uint32(); mode != sIFReg|0600 || uid != 1000 {
+		t.Fatalf("expected a file of mode 0600 owned by 1000, got mode %o and uid %d", mode, uid)
+	}
+	r.next(20) // gid, nlink and rdev
+	if size := r.uint64(); size != uint64(len(data)) {
+		t.Fatalf("expected a size of %d, got %d", len(data), size)
+	}
+	tc.call(msgTclunk, fidArgs(1))
+	tc.fail(msgTwalk, errNoEnt, walkArgs(0, 1, "missing"))
+
+	// the fids follow the renamed entries
+	tc.call(msgTmkdir, func(e *encoder) {
+		e.uint32(0)
+		e.string("dir")
+		e.uint32(0700)
+		e.uint32(0)
+	})
+	tc.call(msgTwalk, walkArgs(0, 2, "dir"))
+	tc.call(msgTwalk, walkArgs(0, 3, "a"))
+	tc.call(msgTrenameat, func(e *encoder) {
+		e.uint32(0)
+		e.string("a")
+		e.uint32(2)
+		e.string("b")
+	})
+	r = tc.call(msgTwalk, walkArgs(0, 4, "dir", "b"))
+	if n := r.uint16(); n != 2 {
+		t.Fatalf("expected to walk to the file renamed, got %d qids", n)
+	}
+	tc.fail(msgTreadlink, errInval, fidArgs(3))
+
+	tc.call(msgTlopen, func(e *encoder) {
+		e.uint32(2)
+		e.uint32(0)
+	})
+	r = tc.call(msgTreaddir, func(e *encoder) {
+		e.uint32(2)
+		e.uint64(0)
+		e.uint32(4096)
+	})
+	r = &decoder{b: r.next(int(r.uint32()))}
+	var names []string
+	for len(r.b) > 0 {
+		r.qid()
+		r.uint64()
+		r.uint8()
+		names = append(names, r.string())
+	}
+	if got := strings.Join(names, " "); got != ". .. b" {
+		t.Fatalf("expected the entries of the directory, got %q", got)
+	}
+
+	unlink := func(n uint32, name string, flags uint32) func(e *encoder) {
+		return func(e *encoder) {
+			e.uint32(n)
+			e.string(name)
+			e.uint32(flags)
+		}
+	}
+	tc.fail(msgTunlinkat, errNotEmpty, unlink(0, "dir", atRemoveDir))
+	tc.fail(msgTunlinkat, errIsDir, unlink(0, "dir", 0))
+	tc.call(msgTunlinkat, unlink(2, "b", 0))
+	tc.fail(msgTgetattr, errNoEnt, func(e *encoder) {
+		e.uint32(3)
+		e.uint64(getattrBasic)
+	})
+	tc.call(msgTunlinkat, unlink(0, "dir", atRemoveDir))
+	if _, err := mfs.Lookup(nd.FilesRoot, "/dir"); err == nil {
+		t.Fatal("expected the directory to be removed from MFS")
+	}
+}
+
+func TestServeIpfs(t *testing.T) {
+	nd, tc := setupServer(t)
+	defer nd.Close()
+	defer tc.conn.Close()
+
+	k, err := coreunix.Add(nd, strings.NewReader("fnord"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc.version("9P2000")
+	tc.call(msgTattach, func(e *encoder) {
+		e.uint32(0)
+		e.uint32(noFid)
+		e.string("glenda")
+		e.string("ipfs")
+	})
+	tc.call(msgTwalk, walkArgs(0, 1, k))
+
+	r := tc.call(msgTstat, fidArgs(1))
+	r.uint16()
+	r.uint16()
+	r.next(6)
+	r.qid()
+	mode := r.uint32()
+	r.next(8)
+	length := r.uint64()
+	if name, uid := r.string(), r.string(); name != k || uid != "glenda" || mode != 0444 || length != 5 {
+		t.Fatalf("expected the stat of the file, got %s of %s, mode %o and length %d", name, uid, mode, length)
+	}
+
+	tc.fail(msgTopen, errROFS, func(e *encoder) {
+		e.uint32(1)
+		e.uint8(oWrite)
+	})
+	tc.call(msgTopen, func(e *encoder) {
+		e.uint32(1)
+		e.uint8(oRead)
+	})
+	r = tc.call(msgTread, func(e *encoder) {
+		e.uint32(1)
+		e.uint64(0)
+		e.uint32(100)
+	})
+	if out := r.next(int(r.uint32())); string(out) != "fnord" {
+		t.Fatalf("expected to read the file, got %q", out)
+	}
+	tc.call(msgTclunk, fidArgs(1))
+
+	tc.fail(msgTcreate, errROFS, func(e *encoder) {
+		e.uint32(0)
+		e.string("new")
+		e.uint32(0644)
+		e.uint8(oWrite)
+	})
+	// the messages of 9P2000.L aren't served to the 9P2000 clients
+	tc.fail(msgTgetattr, errNoSys, func(e *encoder) {
+		e.uint32(0)
+		e.uint64(getattrBasic)
+	})
+}
@@ -0,0 +1,87 @@
+package p9
+
+import (
+	"strings"
+	"sync"
+)
+
+// pathTable gives ids to the paths of the entries looked up: the paths of
+// the qids, and the paths the fids point to, so that the fids follow the
+// entries renamed. The ids aren't persisted.
+type pathTable struct {
+	lk    sync.Mutex
+	next  uint64
+	paths map[uint64]string
+	ids   map[string]uint64
+}
+
+func newPathTable() *pathTable {
+	return &pathTable{
+		next:  1,
+		paths: make(map[uint64]string),
+		ids:   make(map[string]uint64),
+	}
+}
+
+// id returns the id of the entry at path.
+func (t *pathTable) id(path string) uint64 {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if id, ok := t.ids[path]; ok {
+		return id
+	}
+	id := t.next
+	t.next++
+	t.ids[path] = id
+	t.paths[id] = path
+	return id
+}
+
+// path returns the path of the entry id, or errNoEnt if it was removed.
+func (t *pathTable) path(id uint64) (string, error) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	p, ok := t.paths[id]
+	if !ok {
+		return "", errNoEnt
+	}
+	return p, nil
+}
+
+// rename moves the ids of the entry at from and of its children to to, the
+// ids of the entries replaced at to are forgotten.
+func (t *pathTable) rename(from, to string) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.removeLocked(to)
+
+	var moved []string
+	for p := range t.ids {
+		if p == from || strings.HasPrefix(p, from+"/") {
+			moved = append(moved, p)
+		}
+	}
+	for _, p := range moved {
+		id := t.ids[p]
+		delete(t.ids, p)
+		np := to + p[len(from):]
+		t.ids[np] = id
+		t.paths[id] = np
+	}
+}
+
+// remove forgets the ids of the entry at path and of its children.
+func (t *pathTable) remove(path string) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.removeLocked(path)
+}
+
+func (t *pathTable) removeLocked(path string) {
+	for p, id := range t.ids {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(t.ids, p)
+			delete(t.paths, id)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package p9 implements a 9P server exposing the content of IPFS, read-only,
+// and the mutable filesystem of the node, MFS, to the clients without FUSE:
+// Plan 9, the 9p filesystem of Linux, used by WSL and by the QEMU guests, and
+// the other 9P clients.
+//
+// The server speaks 9P2000 and its 9P2000.L extension, negotiated with the
+// clients, over TCP. The clients aren't authenticated, the user names they
+// attach with are only reported as the owners of the entries.
+package p9
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	coreiface "github.com/ipfs/go-ipfs/core/coreapi/interface"
+	repo "github.com/ipfs/go-ipfs/repo"
+
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+)
+
+var log = logging.Logger("p9")
+
+const addressesKey = "Addresses.9P"
+
+// The trees the clients attach to: MFS, writable, and the content of IPFS,
+// read-only. The root of /ipfs isn't listable, as with the FUSE mount. The
+// clients attaching without a tree name get MFS.
+const (
+	filesTree = "/files"
+	ipfsTree  = "/ipfs"
+)
+
+// Server serves MFS and the content of IPFS over 9P.
+type Server struct {
+	node *core.IpfsNode
+	api  coreiface.CoreAPI
+
+	paths *pathTable
+
+	// started is the time reported for the entries without one
+	started time.Time
+}
+
+// Addresses returns the multiaddrs to serve 9P on, set by the optional
+// Addresses.9P key. 9P isn't served if none is set.
+func Addresses(r repo.Repo) ([]string, error) {
+	val, err := r.GetConfigKey(addressesKey)
+	if err != nil {
+		return nil, nil // not set
+	}
+
+	switch val := val.(type) {
+	case []string:
+		return val, nil
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, v := range val {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid value for %s: expected a list of strings, got %v", addressesKey, val)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("invalid value for %s: expected a list of strings, got %v", addressesKey, val)
+	}
+}
+
+// NewServer returns a server of the trees of n.
+func NewServer(n *core.IpfsNode) (*Server, error) {
+	if n.FilesRoot == nil {
+		return nil, errors.New("p9: the node has no MFS root")
+	}
+
+	s := &Server{
+		node:    n,
+		api:     coreapi.NewCoreAPI(n),
+		paths:   newPathTable(),
+		started: time.Now(),
+	}
+	return s, nil
+}
+
+// Serve accepts the connections of the clients on lis until it is closed or
+// the node is closed.
+func (s *Server) Serve(lis net.Listener) error {
+	// make sure we close this no matter what.
+	defer lis.Close()
+
+	proc := s.node.Process()
+	select {
+	case <-proc.Closing():
+		return fmt.Errorf("failed to start server, process closing")
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-proc.Closing():
+			log.Infof("server at %s terminating...", lis.Addr())
+			cancel()
+			lis.Close()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Infof("server at %s terminated", lis.Addr())
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(ctx, conn)
+	}
+}
@@ -0,0 +1,476 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	dstore "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+)
+
+// TrackingBlockstore is a GCBlockstore allowing garbage collections to run
+// concurrently with adds, pins and reads, see ConcurrentGC.
+//
+// Instead of a global lock, the adds and pins holding PinLock are counted in
+// the epoch in which they started. A collection starts a new epoch and only
+// waits for the operations of the previous epochs, which may pin blocks it
+// would not see, to finish. The blocks written and read after that are
+// recorded and kept by the collection.
+//
+// GCLock still excludes adds, pins and collections, for the operations
+// needing the blockstore to stay put, e.g. backups.
+//
+// The blocks written less than a grace period ago are kept by the
+// collections too, see SetGracePeriod.
+type TrackingBlockstore struct {
+	bstore.GCBlockstore
+
+	// running is held by the collection in progress, and collecting is set
+	// while it records the blocks used, so that the reads don't take lk
+	// otherwise
+	running    sync.Mutex
+	collecting int32
+
+	lk   sync.Mutex
+	cond *sync.Cond
+
+	// epoch is the current epoch, inflight counts the PinLock holders of
+	// each epoch
+	epoch    uint64
+	inflight map[uint64]int
+
+	// exclusive is set while GCLock is held, gcWaiting counts the callers
+	// of GCLock waiting for it
+	exclusive bool
+	gcWaiting int
+
+	used     *cid.Set // nil unless a collection runs
+	deleting cid.Cid  // the block being removed by the collection
+
+	// grace is the grace period, written the time at which the blocks
+	// were last written during it
+	grace     time.Duration
+	written   map[cid.Cid]time.Time
+	lastPrune time.Time
+}
+
+// NewTrackingBlockstore wraps bs to allow concurrent garbage collections. The
+// locks of bs are not used anymore.
+func NewTrackingBlockstore(bs bstore.GCBlockstore) *TrackingBlockstore {
+	tbs := &TrackingBlockstore{
+		GCBlockstore: bs,
+		inflight:     make(map[uint64]int),
+		written:      make(map[cid.Cid]time.Time),
+	}
+	tbs.cond = sync.NewCond(&tbs.lk)
+	return tbs
+}
+
+type unlocker func()
+
+func (u unlocker) Unlock() {
+	u()
+}
+
+// PinLock registers an add or pin in the current epoch. It only waits for
+// the holders of GCLock, not for garbage collections.
+func (bs *TrackingBlockstore) PinLock() bstore.Unlocker {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	for bs.exclusive || bs.gcWaiting > 0 {
+		bs.cond.Wait()
+	}
+	epoch := bs.epoch
+	bs.inflight[epoch]++
+
+	return unlocker(func() {
+		bs.lk.Lock()
+		defer bs.lk.Unlock()
+
+		bs.inflight[epoch]--
+		if bs.inflight[epoch] == 0 {
+			delete(bs.inflight, epoch)
+		}
+		bs.cond.Broadcast()
+	})
+}
+
+// GCLock waits for all adds, pins and the removal in progress to finish, and
+// excludes them until unlocked.
+func (bs *TrackingBlockstore) GCLock() bstore.Unlocker {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	bs.gcWaiting++
+	for bs.exclusive || len(bs.inflight) > 0 || bs.deleting.Defined() {
+		bs.cond.Wait()
+	}
+	bs.gcWaiting--
+	bs.exclusive = true
+
+	return unlocker(func() {
+		bs.lk.Lock()
+		defer bs.lk.Unlock()
+
+		bs.exclusive = false
+		bs.cond.Broadcast()
+	})
+}
+
+// GCRequested returns whether GCLock is held or wanted. Garbage collections
+// don't request it.
+func (bs *TrackingBlockstore) GCRequested() bool {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	return bs.exclusive || bs.gcWaiting > 0
+}
+
+// Collecting returns whether a garbage collection is in progress.
+func (bs *TrackingBlockstore) Collecting() bool {
+	return atomic.LoadInt32(&bs.collecting) != 0
+}
+
+// SetGracePeriod makes the collections keep the blocks written less than d
+// ago, even if they are not pinned, giving applications the time to pin the
+// blocks they put. Zero, the default, disables the grace period.
+//
+// The write times are only kept in memory: the blocks written before the
+// node started aren't protected.
+func (bs *TrackingBlockstore) SetGracePeriod(d time.Duration) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	bs.grace = d
+	bs.pruneWritten(time.Now())
+}
+
+// pruneWritten forgets the write times older than the grace period.
+func (bs *TrackingBlockstore) pruneWritten(now time.Time) {
+	for c, t := range bs.written {
+		if now.Sub(t) >= bs.grace {
+			delete(bs.written, c)
+		}
+	}
+	bs.lastPrune = now
+}
+
+// inGrace returns whether c was written during the grace period.
+func (bs *TrackingBlockstore) inGrace(c cid.Cid) bool {
+	t, ok := bs.written[c]
+	return ok && time.Since(t) < bs.grace
+}
+
+// InGracePeriod returns whether c was written less than the grace period
+// ago.
+func (bs *TrackingBlockstore) InGracePeriod(c cid.Cid) bool {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	return bs.inGrace(c)
+}
+
+// trackWrite records the write of c for the grace period, and tracks it.
+func (bs *TrackingBlockstore) trackWrite(c cid.Cid) {
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	if bs.grace > 0 {
+		now := time.Now()
+		bs.written[c] = now
+		if now.Sub(bs.lastPrune) >= bs.grace {
+			bs.pruneWritten(now)
+		}
+	}
+	bs.trackLocked(c)
+}
+
+// track records c as used by the collection in progress, if any. If the
+// collection is removing c, it waits for the removal to be over, so that the
+// block is written again or reported missing.
+func (bs *TrackingBlockstore) track(c cid.Cid) {
+	if atomic.LoadInt32(&bs.collecting) == 0 {
+		return
+	}
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+	bs.trackLocked(c)
+}
+
+func (bs *TrackingBlockstore) trackLocked(c cid.Cid) {
+	if bs.used == nil {
+		return
+	}
+	bs.used.Add(c)
+	for bs.deleting.Defined() && bs.deleting.Equals(c) {
+		bs.cond.Wait()
+	}
+}
+
+// startCollection waits for the collection in progress, if any, starts
+// recording the blocks used and a new epoch, and waits for the adds and pins
+// of the previous epochs.
+func (bs *TrackingBlockstore) startCollection() {
+	bs.running.Lock()
+
+	bs.lk.Lock()
+	defer bs.lk.Unlock()
+
+	bs.used = cid.NewSet()
+	atomic.StoreInt32(&bs.collecting, 1)
+	last := bs.epoch
+	bs.epoch++
+	for bs.inflightUntil(last) {
+		bs.cond.Wait()
+	}
+}
+
+func (bs *TrackingBlockstore) inflightUntil(epoch uint64) bool {
+	for e := range bs.inflight {
+		if e <= epoch {
+			return true
+		}
+	}
+	return false
+}
+
+func (bs *TrackingBlockstore) stopCollection() {
+	bs.lk.Lock()
+	bs.used = nil
+	atomic.StoreInt32(&bs.collecting, 0)
+	bs.lk.Unlock()
+	bs.running.Unlock()
+}
+
+// remove removes c unless it was used since the collection started or
+// written during the grace period, and returns its size if withSize is set.
+// It waits for the holders of GCLock.
+func (bs *TrackingBlockstore) remove(c cid.Cid, withSize bool) (bool, int, error) {
+	bs.lk.Lock()
+	for bs.exclusive {
+		bs.cond.Wait()
+	}
+	if bs.used.Has(c) || bs.inGrace(c) {
+		bs.lk.Unlock()
+		return false, 0, nil
+	}
+	bs.deleting = c
+	bs.lk.Unlock()
+
+	size := -1
+	if withSize {
+		size, _ = bs.GCBlockstore.GetSize(c)
+	}
+	err := bs.DeleteBlock(c)
+
+	bs.lk.Lock()
+	bs.deleting = cid.Cid{}
+	bs.cond.Broadcast()
+	bs.lk.Unlock()
+
+	return true, size, err
+}
+
+func (bs *TrackingBlockstore) Has(c cid.Cid) (bool, error) {
+	bs.track(c)
+	return bs.GCBlockstore.Has(c)
+}
+
+func (bs *TrackingBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	bs.track(c)
+	return bs.GCBlockstore.Get(c)
+}
+
+func (bs *TrackingBlockstore) GetSize(c cid.Cid) (int, error) {
+	bs.track(c)
+	return bs.GCBlockstore.GetSize(c)
+}
+
+func (bs *TrackingBlockstore) Put(blk blocks.Block) error {
+	bs.trackWrite(blk.Cid())
+	return bs.GCBlockstore.Put(blk)
+}
+
+func (bs *TrackingBlockstore) PutMany(blks []blocks.Block) error {
+	for _, blk := range blks {
+		bs.trackWrite(blk.Cid())
+	}
+	return bs.GCBlockstore.PutMany(blks)
+}
+
+// Wrap returns a GCBlockstore writing to and reading from other, a
+// blockstore underlying bs, e.g. bypassing the filestore, whose blocks are
+// tracked and which shares the locks of bs.
+func (bs *TrackingBlockstore) Wrap(other bstore.Blockstore) bstore.GCBlockstore {
+	return &trackedBlockstore{Blockstore: other, tbs: bs}
+}
+
+type trackedBlockstore struct {
+	bstore.Blockstore
+	tbs *TrackingBlockstore
+}
+
+func (bs *trackedBlockstore) Has(c cid.Cid) (bool, error) {
+	bs.tbs.track(c)
+	return bs.Blockstore.Has(c)
+}
+
+func (bs *trackedBlockstore) Get(c cid.Cid) (blocks.Block, error) {
+	bs.tbs.track(c)
+	return bs.Blockstore.Get(c)
+}
+
+func (bs *trackedBlockstore) GetSize(c cid.Cid) (int, error) {
+	bs.tbs.track(c)
+	return bs.Blockstore.GetSize(c)
+}
+
+func (bs *trackedBlockstore) Put(blk blocks.Block) error {
+	bs.tbs.trackWrite(blk.Cid())
+	return bs.Blockstore.Put(blk)
+}
+
+func (bs *trackedBlockstore) PutMany(blks []blocks.Block) error {
+	for _, blk := range blks {
+		bs.tbs.trackWrite(blk.Cid())
+	}
+	return bs.Blockstore.PutMany(blks)
+}
+
+func (bs *trackedBlockstore) GCLock() bstore.Unlocker {
+	return bs.tbs.GCLock()
+}
+
+func (bs *trackedBlockstore) PinLock() bstore.Unlocker {
+	return bs.tbs.PinLock()
+}
+
+func (bs *trackedBlockstore) GCRequested() bool {
+	return bs.tbs.GCRequested()
+}
+
+// ConcurrentGC performs the same collection as GC without a global lock:
+// adds, pins and reads proceed while it runs.
+//
+// It only waits for the adds and pins which started before it, see
+// TrackingBlockstore. The blocks written or read while it runs, from adds,
+// pins, the network or the API, are kept until the next collection, as are
+// the blocks written during the grace period.
+func ConcurrentGC(ctx context.Context, bs *TrackingBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+	return concurrentGC(ctx, bs, dstor, pn, bestEffortRoots, false)
+}
+
+func concurrentGC(ctx context.Context, bs *TrackingBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, progress bool) <-chan Result {
+	elock := log.EventBegin(ctx, "GC.epochWait")
+	bs.startCollection()
+	elock.Done()
+
+	output := make(chan Result, 128)
+	tracker := newProgressTracker(ctx, output, progress)
+
+	go func() {
+		defer close(output)
+		defer bs.stopCollection()
+
+		tracker.phase(PhaseMark)
+		emark := log.EventBegin(ctx, "GC.mark")
+		// reads of the collection itself aren't tracked
+		untracked := bs.GCBlockstore
+		ds := dag.NewDAGService(bserv.New(untracked, offline.Exchange(untracked)))
+
+		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		if err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+		emark.Append(logging.LoggableMap{
+			"blackSetSize": fmt.Sprintf("%d", gcs.Len()),
+		})
+		emark.Done()
+		tracker.marked(gcs.Len())
+		tracker.phase(PhaseSweep)
+
+		esweep := log.EventBegin(ctx, "GC.sweep")
+		keychan, err := untracked.AllKeysChan(ctx)
+		if err != nil {
+			select {
+			case output <- Result{Error: err}:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		var removed uint64
+		errors := false
+	loop:
+		for {
+			select {
+			case k, ok := <-keychan:
+				if !ok {
+					break loop
+				}
+				tracker.scanned()
+				if gcs.Has(k) {
+					continue
+				}
+				rmed, size, err := bs.remove(k, tracker != nil)
+				if !rmed {
+					continue
+				}
+				removed++
+				if err != nil {
+					errors = true
+					select {
+					case output <- Result{Error: &CannotDeleteBlockError{k, err}}:
+					case <-ctx.Done():
+						break loop
+					}
+					// continue as error is non-fatal
+					continue
+				}
+				tracker.removed(size)
+				select {
+				case output <- Result{KeyRemoved: k}:
+				case <-ctx.Done():
+					break loop
+				}
+			case <-ctx.Done():
+				break loop
+			}
+		}
+		esweep.Append(logging.LoggableMap{
+			"whiteSetSize": fmt.Sprintf("%d", removed),
+		})
+		esweep.Done()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if errors {
+			select {
+			case output <- Result{Error: ErrCannotDeleteSomeBlocks}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		tracker.phase(PhaseDatastore)
+		collectDatastoreGarbage(ctx, dstor, output)
+		tracker.phase(PhaseDone)
+	}()
+
+	return output
+}
@@ -0,0 +1,141 @@
+package gc
+
+import (
+	"context"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
+)
+
+// BlockCount is a number of blocks and their total size.
+type BlockCount struct {
+	Blocks uint64
+	Bytes  uint64
+}
+
+func (c *BlockCount) add(size int) {
+	c.Blocks++
+	if size > 0 {
+		c.Bytes += uint64(size)
+	}
+}
+
+// DryRunReport predicts the effect of a garbage collection.
+type DryRunReport struct {
+	// Unreferenced are the blocks to remove which no other block of the
+	// repo links to: unpinned files and the roots of unpinned DAGs.
+	Unreferenced BlockCount
+
+	// Linked are the blocks to remove which are linked to by other blocks
+	// of the repo, all of them unpinned: the insides of unpinned DAGs.
+	Linked BlockCount
+
+	// MFS are the unpinned blocks kept as they are reachable from the
+	// best-effort roots, i.e. the MFS root.
+	MFS BlockCount
+
+	// Recent are the unpinned blocks kept as they were written during the
+	// grace period, see TrackingBlockstore.SetGracePeriod.
+	Recent BlockCount
+
+	// Pinned are the blocks kept as they are pinned, directly, recursively
+	// or internally by the pinner.
+	Pinned BlockCount
+}
+
+// DryRun computes what GC would remove from bs, without removing anything.
+// It doesn't take the GC lock: the blocks added while it runs may be reported
+// as garbage.
+//
+// bs must not be the TrackingBlockstore of the node, whose reads would keep
+// the blocks read from the collection in progress, if any: tbs, which may be
+// nil, only tells which blocks are in the grace period.
+func DryRun(ctx context.Context, bs bstore.Blockstore, tbs *TrackingBlockstore, pn pin.Pinner, bestEffortRoots []cid.Cid) (*DryRunReport, error) {
+	ds := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	// ColoredSet reports the detailed errors on the output channel and
+	// returns a summary, keep the first detailed error
+	output := make(chan Result)
+	errc := make(chan error, 1)
+	go func() {
+		var first error
+		for res := range output {
+			if first == nil {
+				first = res.Error
+			}
+		}
+		errc <- first
+	}()
+	pinned, err := ColoredSet(ctx, pn, ds, nil, output)
+	close(output)
+	if first := <-errc; first != nil {
+		return nil, first
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mfs := cid.NewSet()
+	bestEffortGetLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		links, err := ipld.GetLinks(ctx, ds, c)
+		if err != nil && err != ipld.ErrNotFound {
+			return nil, &CannotFetchLinksError{c, err}
+		}
+		return links, nil
+	}
+	if err := Descendants(ctx, bestEffortGetLinks, mfs, bestEffortRoots); err != nil {
+		return nil, err
+	}
+
+	keychan, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(DryRunReport)
+	garbage := make(map[cid.Cid]int)
+	linked := cid.NewSet()
+	for k := range keychan {
+		size, err := bs.GetSize(k)
+		if err == bstore.ErrNotFound {
+			continue // removed since listed
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case pinned.Has(k):
+			report.Pinned.add(size)
+		case mfs.Has(k):
+			report.MFS.add(size)
+		case tbs != nil && tbs.InGracePeriod(k):
+			report.Recent.add(size)
+		default:
+			garbage[k] = size
+			// blocks which can't be decoded have no links we know of
+			links, _ := ipld.GetLinks(ctx, ds, k)
+			for _, l := range links {
+				linked.Add(l.Cid)
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	for k, size := range garbage {
+		if linked.Has(k) {
+			report.Linked.add(size)
+		} else {
+			report.Unreferenced.add(size)
+		}
+	}
+	return report, nil
+}
@@ -23,10 +23,12 @@ import (
 var log = logging.Logger("gc")
 
 // Result represents an incremental output from a garbage collection
-// run.  It contains either an error, or the cid of a removed object.
+// run.  It contains either an error, or the cid of a removed object, or the
+// progress of the collection when requested with GCWithProgress.
 type Result struct {
 	KeyRemoved cid.Cid
 	Error      error
+	Progress   *Progress
 }
 
 // GC performs a mark and sweep garbage collection of the blocks in the blockstore
@@ -38,7 +40,25 @@ type Result struct {
 //
 // The routine then iterates over every block in the blockstore and
 // deletes any block that is not found in the marked set.
+//
+// If bs is a TrackingBlockstore, the collection runs concurrently with adds
+// and pins, see ConcurrentGC. Otherwise the GC lock is held for the whole
+// collection.
 func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+	return collectGarbage(ctx, bs, dstor, pn, bestEffortRoots, false)
+}
+
+// GCWithProgress performs the same collection as GC, and also sends results
+// reporting its Progress at the start of each phase and periodically while
+// sweeping.
+func GCWithProgress(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+	return collectGarbage(ctx, bs, dstor, pn, bestEffortRoots, true)
+}
+
+func collectGarbage(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid, progress bool) <-chan Result {
+	if tbs, ok := bs.(*TrackingBlockstore); ok {
+		return concurrentGC(ctx, tbs, dstor, pn, bestEffortRoots, progress)
+	}
 
 	elock := log.EventBegin(ctx, "GC.lockWait")
 	unlocker := bs.GCLock()
@@ -50,12 +70,14 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 	ds := dag.NewDAGService(bsrv)
 
 	output := make(chan Result, 128)
+	tracker := newProgressTracker(ctx, output, progress)
 
 	go func() {
 		defer close(output)
 		defer unlocker.Unlock()
 		defer elock.Done()
 
+		tracker.phase(PhaseMark)
 		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
 		if err != nil {
 			select {
@@ -68,6 +90,8 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 			"blackSetSize": fmt.Sprintf("%d", gcs.Len()),
 		})
 		emark.Done()
+		tracker.marked(gcs.Len())
+		tracker.phase(PhaseSweep)
 		esweep := log.EventBegin(ctx, "GC.sweep")
 
 		keychan, err := bs.AllKeysChan(ctx)
@@ -89,7 +113,12 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 				if !ok {
 					break loop
 				}
+				tracker.scanned()
 				if !gcs.Has(k) {
+					size := -1
+					if tracker != nil {
+						size, _ = bs.GetSize(k)
+					}
 					err := bs.DeleteBlock(k)
 					removed++
 					if err != nil {
@@ -99,6 +128,7 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 						// continue as error is non-fatal
 						continue loop
 					}
+					tracker.removed(size)
 					select {
 					case output <- Result{KeyRemoved: k}:
 					case <-ctx.Done():
@@ -121,25 +151,31 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 			}
 		}
 
-		defer log.EventBegin(ctx, "GC.datastore").Done()
-		gds, ok := dstor.(dstore.GCDatastore)
-		if !ok {
-			return
-		}
-
-		err = gds.CollectGarbage()
-		if err != nil {
-			select {
-			case output <- Result{Error: err}:
-			case <-ctx.Done():
-			}
-			return
-		}
+		tracker.phase(PhaseDatastore)
+		collectDatastoreGarbage(ctx, dstor, output)
+		tracker.phase(PhaseDone)
 	}()
 
 	return output
 }
 
+// collectDatastoreGarbage runs the garbage collection of the datastore, if
+// it has one.
+func collectDatastoreGarbage(ctx context.Context, dstor dstore.Datastore, output chan<- Result) {
+	defer log.EventBegin(ctx, "GC.datastore").Done()
+	gds, ok := dstor.(dstore.GCDatastore)
+	if !ok {
+		return
+	}
+
+	if err := gds.CollectGarbage(); err != nil {
+		select {
+		case output <- Result{Error: err}:
+		case <-ctx.Done():
+		}
+	}
+}
+
 // Descendants recursively finds all the descendants of the given roots and
 // adds them to the given cid.Set, using the provided dag.GetLinks function
 // to walk the tree.
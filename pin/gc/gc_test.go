@@ -0,0 +1,196 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs/pin"
+	bserv "gx/ipfs/QmPoh3SrQzFBWtdGK6qmHDV4EanKR6kYPj4DD3J2NLoEmZ/go-blockservice"
+	dag "gx/ipfs/QmdV35UHnL1FM52baPkeUo6u7Fxm2CRUkPTLRPxeF8a4Ap/go-merkledag"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	offline "gx/ipfs/QmYZwey1thDTynSrvd6qQkX24UpTka6TFhQ2v569UpoqxD/go-ipfs-exchange-offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func TestConcurrentGC(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := NewTrackingBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	pinned := dag.NodeWithData([]byte("pinned"))
+	garbage := dag.NodeWithData([]byte("garbage"))
+	for _, nd := range []*dag.ProtoNode{pinned, garbage} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pn.Pin(ctx, pinned, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	output := ConcurrentGC(ctx, bs, dstore, pn, nil)
+
+	// Blocks written while the collection runs are kept, whether the
+	// sweep reaches them or not.
+	added := dag.NodeWithData([]byte("added during the collection"))
+	if err := dserv.Add(ctx, added); err != nil {
+		t.Fatal(err)
+	}
+
+	var removed int
+	for res := range output {
+		if res.Error != nil {
+			t.Fatal(res.Error)
+		}
+		if !res.KeyRemoved.Equals(garbage.Cid()) {
+			t.Fatalf("expected only the garbage to be removed, removed %s", res.KeyRemoved)
+		}
+		removed++
+	}
+	if removed != 1 {
+		t.Fatalf("expected the garbage to be removed once, got %d", removed)
+	}
+
+	for _, nd := range []*dag.ProtoNode{pinned, added} {
+		if has, err := bs.Has(nd.Cid()); err != nil || !has {
+			t.Fatalf("expected %s to be kept: %v", nd.Cid(), err)
+		}
+	}
+}
+
+func TestPinLockDuringGC(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := NewTrackingBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	before := bs.PinLock()
+
+	started := make(chan (<-chan Result))
+	go func() {
+		started <- ConcurrentGC(ctx, bs, dstore, pn, nil)
+	}()
+
+	// the collection waits for the add which started before it, but not
+	// the ones starting after it
+	select {
+	case <-started:
+		t.Fatal("expected the collection to wait for the add in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	bs.PinLock().Unlock()
+	if bs.GCRequested() {
+		t.Fatal("expected the collection not to request the GC lock")
+	}
+
+	before.Unlock()
+	select {
+	case output := <-started:
+		for res := range output {
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the collection to start once the add is done")
+	}
+}
+
+func TestGracePeriod(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := NewTrackingBlockstore(bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker()))
+	bs.SetGracePeriod(time.Hour)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	recent := dag.NodeWithData([]byte("not pinned yet"))
+	if err := dserv.Add(ctx, recent); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := DryRun(ctx, bs, bs, pn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Recent.Blocks != 1 || report.Unreferenced.Blocks != 0 {
+		t.Fatalf("expected the block to be kept as recent, got %+v", report)
+	}
+
+	collect := func() {
+		for res := range ConcurrentGC(ctx, bs, dstore, pn, nil) {
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+		}
+	}
+
+	collect()
+	if has, err := bs.Has(recent.Cid()); err != nil || !has {
+		t.Fatalf("expected the block written during the grace period to be kept: %v", err)
+	}
+
+	bs.SetGracePeriod(0)
+	collect()
+	if has, _ := bs.Has(recent.Cid()); has {
+		t.Fatal("expected the block to be removed once the grace period is over")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewBlockstore(dstore)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pn := pin.NewPinner(dstore, dserv, dserv)
+
+	pinned := dag.NodeWithData([]byte("pinned"))
+	mfsRoot := dag.NodeWithData([]byte("mfs root"))
+	child := dag.NodeWithData([]byte("garbage child"))
+	parent := dag.NodeWithData([]byte("garbage parent"))
+	if err := parent.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []*dag.ProtoNode{pinned, mfsRoot, child, parent} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pn.Pin(ctx, pinned, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := DryRun(ctx, bs, nil, pn, []cid.Cid{mfsRoot.Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Unreferenced.Blocks != 1 || report.Linked.Blocks != 1 || report.MFS.Blocks != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Pinned.Blocks == 0 {
+		t.Fatal("expected the pinned block to be kept")
+	}
+
+	for _, nd := range []*dag.ProtoNode{child, parent} {
+		if has, err := bs.Has(nd.Cid()); err != nil || !has {
+			t.Fatalf("expected %s not to be removed: %v", nd.Cid(), err)
+		}
+	}
+}
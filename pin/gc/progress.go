@@ -0,0 +1,99 @@
+package gc
+
+import (
+	"context"
+	"time"
+)
+
+// Phases of a garbage collection, see Progress.
+const (
+	PhaseMark      = "mark"
+	PhaseSweep     = "sweep"
+	PhaseDatastore = "datastore"
+	PhaseDone      = "done"
+)
+
+// ProgressInterval is the minimum interval between two progress results of
+// the same phase.
+var ProgressInterval = 500 * time.Millisecond
+
+// Progress describes a garbage collection in progress.
+type Progress struct {
+	// Phase is the current phase of the collection
+	Phase string
+
+	// Marked is the number of blocks kept, known once marking is over
+	Marked uint64
+
+	// Scanned is the number of blocks of the blockstore examined by the
+	// sweep
+	Scanned uint64
+
+	// Removed and BytesRemoved are the number and total size of the blocks
+	// removed
+	Removed      uint64
+	BytesRemoved uint64
+}
+
+// progressTracker sends the progress results of a collection. A nil tracker
+// sends nothing.
+type progressTracker struct {
+	ctx    context.Context
+	output chan<- Result
+	p      Progress
+	last   time.Time
+}
+
+func newProgressTracker(ctx context.Context, output chan<- Result, enabled bool) *progressTracker {
+	if !enabled {
+		return nil
+	}
+	return &progressTracker{ctx: ctx, output: output}
+}
+
+func (t *progressTracker) send() {
+	if t == nil {
+		return
+	}
+	p := t.p
+	select {
+	case t.output <- Result{Progress: &p}:
+	case <-t.ctx.Done():
+	}
+	t.last = time.Now()
+}
+
+func (t *progressTracker) phase(phase string) {
+	if t == nil {
+		return
+	}
+	t.p.Phase = phase
+	t.send()
+}
+
+func (t *progressTracker) marked(n int) {
+	if t == nil {
+		return
+	}
+	t.p.Marked = uint64(n)
+}
+
+func (t *progressTracker) scanned() {
+	if t == nil {
+		return
+	}
+	t.p.Scanned++
+	if time.Since(t.last) >= ProgressInterval {
+		t.send()
+	}
+}
+
+func (t *progressTracker) removed(size int) {
+	if t == nil {
+		return
+	}
+	t.p.Removed++
+	if size > 0 {
+		t.p.BytesRemoved += uint64(size)
+	}
+}
@@ -0,0 +1,15 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/core"
+)
+
+// PluginExchange is an interface that can be implemented to add exchanges
+// fetching the blocks of online nodes, selected by the Exchange.Type config
+// key
+type PluginExchange interface {
+	Plugin
+
+	ExchangeTypeName() string
+	ExchangeConstructor() core.ExchangeConstructor
+}
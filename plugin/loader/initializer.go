@@ -1,11 +1,12 @@
 package loader
 
 import (
+	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/coredag"
+	"github.com/ipfs/go-ipfs/core/tracing"
 	"github.com/ipfs/go-ipfs/plugin"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
 
-	"gx/ipfs/QmWLWmRVSiagqP15jczsGME1qpob6HDbtbHAY2he9W5iUo/opentracing-go"
 	ipld "gx/ipfs/QmcKKBwfz6FyQdHR2jsXrrF6XeSBXYL86anmWNewpFpoF5/go-ipld-format"
 )
 
@@ -38,6 +39,18 @@ func run(plugins []plugin.Plugin) error {
 			if err != nil {
 				return err
 			}
+		case plugin.PluginExchange:
+			err := core.AddExchangeConstructor(pl.ExchangeTypeName(), pl.ExchangeConstructor())
+			if err != nil {
+				return err
+			}
+		case plugin.PluginRouting:
+			err := core.AddRouterConstructor(pl.RouterTypeName(), pl.RouterConstructor())
+			if err != nil {
+				return err
+			}
+		case plugin.PluginRoutingWrapper:
+			core.AddRoutingWrapper(pl.RoutingWrapper())
 		default:
 			panic(pl)
 		}
@@ -58,6 +71,6 @@ func runTracerPlugin(pl plugin.PluginTracer) error {
 	if err != nil {
 		return err
 	}
-	opentracing.SetGlobalTracer(tracer)
+	tracing.SetTracer(tracer)
 	return nil
 }
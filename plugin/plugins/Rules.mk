@@ -1,6 +1,13 @@
 include mk/header.mk
 
 $(d)_plugins:=$(d)/git $(d)/badgerds $(d)/flatfs $(d)/levelds
+# plugins with dependencies outside of gx, built with their tag
+ifneq ($(filter pebble,$(GOTAGS)),)
+$(d)_plugins+=$(d)/pebbleds
+endif
+ifneq ($(filter postgres sqlite,$(GOTAGS)),)
+$(d)_plugins+=$(d)/sqlds
+endif
 $(d)_plugins_so:=$(addsuffix .so,$($(d)_plugins))
 $(d)_plugins_main:=$(addsuffix /main/main.go,$($(d)_plugins))
 
@@ -11,6 +11,7 @@ import (
 
 	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
 	badgerds "gx/ipfs/QmVoK2ivqzp5ZgWiEdBNFbKH7nzf9C4wPYr8cH7CGPMHtC/go-ds-badger"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
 )
 
 // Plugins is exported list of plugins that will be loaded
@@ -125,3 +126,22 @@ func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
 
 	return badgerds.NewDatastore(p, &defopts)
 }
+
+var _ fsrepo.CompactableConfig = (*datastoreConfig)(nil)
+
+// Compact runs the garbage collection of the value log of badger, which
+// reclaims the space of deleted values.
+func (c *datastoreConfig) Compact(path string, progress func(string)) error {
+	d, err := c.Create(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	gds, ok := d.(ds.GCDatastore)
+	if !ok {
+		return fmt.Errorf("badger datastore doesn't support garbage collection")
+	}
+	progress("badgerds: collecting value log garbage")
+	return gds.CollectGarbage()
+}
@@ -2,7 +2,9 @@ package flatfs
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/ipfs/go-ipfs/plugin"
 	"github.com/ipfs/go-ipfs/repo"
@@ -88,3 +90,70 @@ func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
 
 	return flatfs.CreateOrOpen(p, c.shardFun, c.syncField)
 }
+
+var _ fsrepo.ReadOnlyConfig = (*datastoreConfig)(nil)
+
+// CreateReadOnly opens the datastore without creating it. flatfs writes
+// blocks atomically and doesn't lock the datastore, so it can be read while
+// another process writes to it.
+func (c *datastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	p := c.path
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(path, p)
+	}
+
+	return flatfs.Open(p, c.syncField)
+}
+
+var _ fsrepo.CompactableConfig = (*datastoreConfig)(nil)
+
+// Compact re-shards the datastore when its shardFunc was changed in the
+// config. The blocks are moved to a datastore created next to the current
+// one, which then replaces it.
+func (c *datastoreConfig) Compact(path string, progress func(string)) error {
+	p := c.path
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(path, p)
+	}
+
+	cur, err := flatfs.ReadShardFunc(p)
+	if err != nil {
+		return err
+	}
+	if cur.String() == c.shardFun.String() {
+		progress(fmt.Sprintf("flatfs: %s is sharded with %s, nothing to do", c.path, cur))
+		return nil
+	}
+
+	progress(fmt.Sprintf("flatfs: re-sharding %s from %s to %s", c.path, cur, c.shardFun))
+
+	// An interrupted re-sharding is resumed, as the blocks left are moved.
+	tmp := p + "-reshard"
+	d, err := flatfs.CreateOrOpen(tmp, c.shardFun, false)
+	if err != nil {
+		return err
+	}
+	d.Close()
+
+	if err := flatfs.Move(p, tmp, progressWriter(progress)); err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// progressWriter reports the lines written by flatfs.Move as progress.
+type progressWriter func(string)
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	for _, line := range strings.FieldsFunc(string(b), func(r rune) bool {
+		return r == '\r' || r == '\n'
+	}) {
+		if line = strings.TrimSpace(line); line != "" {
+			w("flatfs: " + line)
+		}
+	}
+	return len(b), nil
+}
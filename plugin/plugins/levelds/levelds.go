@@ -9,7 +9,9 @@ import (
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	levelds "gx/ipfs/QmUhiHo586S2XpAFvkL1xDxeNwVHVQg7sDTxzS8ituQawr/go-ds-leveldb"
+	leveldb "gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb"
 	ldbopts "gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb/opt"
+	ldbutil "gx/ipfs/QmbBhyDKsY4mbY6xsKt3qu9Y7FPvMJ6qbD8AMjYYvPRw1g/goleveldb/leveldb/util"
 )
 
 // Plugins is exported list of plugins that will be loaded
@@ -86,3 +88,25 @@ func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
 		Compression: c.compression,
 	})
 }
+
+var _ fsrepo.CompactableConfig = (*datastoreConfig)(nil)
+
+// Compact compacts the whole key range of the database, dropping deleted
+// entries.
+func (c *datastoreConfig) Compact(path string, progress func(string)) error {
+	p := c.path
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(path, p)
+	}
+
+	db, err := leveldb.OpenFile(p, &ldbopts.Options{
+		Compression: c.compression,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	progress("levelds: compacting " + c.path)
+	return db.CompactRange(ldbutil.Range{})
+}
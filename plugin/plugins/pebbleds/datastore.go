@@ -0,0 +1,176 @@
+// +build pebble
+
+package pebbleds
+
+import (
+	"github.com/cockroachdb/pebble"
+
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// datastore stores its entries in a pebble database, keyed by the strings of
+// their keys.
+type datastore struct {
+	db    *pebble.DB
+	write *pebble.WriteOptions
+}
+
+var _ ds.Batching = (*datastore)(nil)
+var _ ds.PersistentDatastore = (*datastore)(nil)
+
+func newDatastore(path string, syncWrites bool) (*datastore, error) {
+	db, err := pebble.Open(path, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+	d := &datastore{db: db, write: pebble.NoSync}
+	if syncWrites {
+		d.write = pebble.Sync
+	}
+	return d, nil
+}
+
+func (d *datastore) Put(key ds.Key, value []byte) error {
+	return d.db.Set(key.Bytes(), value, d.write)
+}
+
+func (d *datastore) Get(key ds.Key) ([]byte, error) {
+	val, closer, err := d.db.Get(key.Bytes())
+	if err == pebble.ErrNotFound {
+		return nil, ds.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	// the value is only valid until the closer is closed
+	out := make([]byte, len(val))
+	copy(out, val)
+	return out, nil
+}
+
+func (d *datastore) Has(key ds.Key) (bool, error) {
+	_, closer, err := d.db.Get(key.Bytes())
+	if err == pebble.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	closer.Close()
+	return true, nil
+}
+
+func (d *datastore) GetSize(key ds.Key) (int, error) {
+	val, closer, err := d.db.Get(key.Bytes())
+	if err == pebble.ErrNotFound {
+		return -1, ds.ErrNotFound
+	}
+	if err != nil {
+		return -1, err
+	}
+	defer closer.Close()
+	return len(val), nil
+}
+
+func (d *datastore) Delete(key ds.Key) error {
+	has, err := d.Has(key)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return ds.ErrNotFound
+	}
+	return d.db.Delete(key.Bytes(), d.write)
+}
+
+// Query iterates over the entries matching the prefix of q in the database,
+// the rest of the query is applied to the results.
+func (d *datastore) Query(q dsq.Query) (dsq.Results, error) {
+	opts := &pebble.IterOptions{}
+	if q.Prefix != "" {
+		opts.LowerBound = []byte(q.Prefix)
+		opts.UpperBound = prefixEnd(opts.LowerBound)
+	}
+	it := d.db.NewIter(opts)
+
+	res := dsq.ResultsWithProcess(q, func(proc goprocess.Process, out chan<- dsq.Result) {
+		defer it.Close()
+
+		for it.First(); it.Valid(); it.Next() {
+			// the key and the value are only valid until the iterator moves
+			e := dsq.Entry{Key: string(it.Key())}
+			if !q.KeysOnly {
+				e.Value = make([]byte, len(it.Value()))
+				copy(e.Value, it.Value())
+			}
+
+			select {
+			case out <- dsq.Result{Entry: e}:
+			case <-proc.Closing():
+				return
+			}
+		}
+
+		if err := it.Error(); err != nil {
+			select {
+			case out <- dsq.Result{Error: err}:
+			case <-proc.Closing():
+			}
+		}
+	})
+	return dsq.NaiveQueryApply(q, res), nil
+}
+
+// prefixEnd returns the smallest key greater than all the keys starting with
+// prefix, nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		end[i]++
+		if end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// DiskUsage returns the size of the files of the database.
+func (d *datastore) DiskUsage() (uint64, error) {
+	return d.db.Metrics().DiskSpaceUsage(), nil
+}
+
+func (d *datastore) Batch() (ds.Batch, error) {
+	return &batch{d: d, b: d.db.NewBatch()}, nil
+}
+
+func (d *datastore) Close() error {
+	return d.db.Close()
+}
+
+// batch buffers operations in a pebble batch, applied atomically on Commit.
+type batch struct {
+	d *datastore
+	b *pebble.Batch
+}
+
+func (b *batch) Put(key ds.Key, value []byte) error {
+	return b.b.Set(key.Bytes(), value, nil)
+}
+
+func (b *batch) Delete(key ds.Key) error {
+	return b.b.Delete(key.Bytes(), nil)
+}
+
+func (b *batch) Commit() error {
+	if err := b.b.Commit(b.d.write); err != nil {
+		return err
+	}
+	b.b.Close()
+	b.b = b.d.db.NewBatch()
+	return nil
+}
@@ -0,0 +1,143 @@
+// +build pebble
+
+package pebbleds
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+func newTestDatastore(t *testing.T) (*datastore, func()) {
+	dir, err := ioutil.TempDir("", "pebbleds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDatastore(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, func() {
+		d.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDatastore(t *testing.T) {
+	d, cleanup := newTestDatastore(t)
+	defer cleanup()
+
+	k := ds.NewKey("/a/b")
+	if _, err := d.Get(k); err != ds.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := d.Put(k, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := d.Get(k)
+	if err != nil || !bytes.Equal(v, []byte("value")) {
+		t.Fatalf("expected the value put, got %q, %v", v, err)
+	}
+	if has, err := d.Has(k); err != nil || !has {
+		t.Fatalf("expected the key to exist, got %v, %v", has, err)
+	}
+	if size, err := d.GetSize(k); err != nil || size != len("value") {
+		t.Fatalf("expected the size of the value, got %d, %v", size, err)
+	}
+
+	if err := d.Delete(k); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := d.Has(k); err != nil || has {
+		t.Fatalf("expected the key to be deleted, got %v, %v", has, err)
+	}
+	if err := d.Delete(k); err != ds.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDatastoreQuery(t *testing.T) {
+	d, cleanup := newTestDatastore(t)
+	defer cleanup()
+
+	for _, k := range []string{"/a/1", "/a/2", "/ab", "/b/1"} {
+		if err := d.Put(ds.NewKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := d.Query(dsq.Query{Prefix: "/a/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Key != "/a/1" || entries[1].Key != "/a/2" {
+		t.Fatalf("expected the entries under /a, got %v", entries)
+	}
+	if !bytes.Equal(entries[1].Value, []byte("/a/2")) {
+		t.Errorf("expected the value of /a/2, got %q", entries[1].Value)
+	}
+
+	res, err = d.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected all the keys, got %v", entries)
+	}
+}
+
+func TestDatastoreBatch(t *testing.T) {
+	d, cleanup := newTestDatastore(t)
+	defer cleanup()
+
+	if err := d.Put(ds.NewKey("/old"), []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := d.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Put(ds.NewKey("/new"), []byte("new"))
+	b.Delete(ds.NewKey("/old"))
+	if has, _ := d.Has(ds.NewKey("/new")); has {
+		t.Fatal("expected the batch to be applied on commit")
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if has, _ := d.Has(ds.NewKey("/new")); !has {
+		t.Error("expected the put of the batch to be applied")
+	}
+	if has, _ := d.Has(ds.NewKey("/old")); has {
+		t.Error("expected the delete of the batch to be applied")
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	for _, tc := range []struct {
+		prefix, end []byte
+	}{
+		{[]byte("/a/"), []byte("/a0")},
+		{[]byte{'a', 0xff}, []byte("b")},
+		{[]byte{0xff}, nil},
+	} {
+		if end := prefixEnd(tc.prefix); !bytes.Equal(end, tc.end) {
+			t.Errorf("prefixEnd(%q): expected %q, got %q", tc.prefix, tc.end, end)
+		}
+	}
+}
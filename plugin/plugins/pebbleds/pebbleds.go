@@ -0,0 +1,108 @@
+// +build pebble
+
+package pebbleds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-ipfs/plugin"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+// Plugins is exported list of plugins that will be loaded
+var Plugins = []plugin.Plugin{
+	&pebbledsPlugin{},
+}
+
+type pebbledsPlugin struct{}
+
+var _ plugin.PluginDatastore = (*pebbledsPlugin)(nil)
+
+func (*pebbledsPlugin) Name() string {
+	return "ds-pebble"
+}
+
+func (*pebbledsPlugin) Version() string {
+	return "0.1.0"
+}
+
+func (*pebbledsPlugin) Init() error {
+	return nil
+}
+
+func (*pebbledsPlugin) DatastoreTypeName() string {
+	return "pebbleds"
+}
+
+type datastoreConfig struct {
+	path       string
+	syncWrites bool
+}
+
+// DatastoreConfigParser returns a configuration stub for a pebble datastore
+// from the given parameters
+func (*pebbledsPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
+	return func(params map[string]interface{}) (fsrepo.DatastoreConfig, error) {
+		var c datastoreConfig
+		var ok bool
+
+		c.path, ok = params["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("'path' field is missing or not string")
+		}
+
+		sw, ok := params["syncWrites"]
+		if !ok {
+			c.syncWrites = true
+		} else {
+			if swb, ok := sw.(bool); ok {
+				c.syncWrites = swb
+			} else {
+				return nil, fmt.Errorf("'syncWrites' field was not a boolean")
+			}
+		}
+
+		return &c, nil
+	}
+}
+
+func (c *datastoreConfig) DiskSpec() fsrepo.DiskSpec {
+	return map[string]interface{}{
+		"type": "pebbleds",
+		"path": c.path,
+	}
+}
+
+func (c *datastoreConfig) dir(path string) string {
+	if filepath.IsAbs(c.path) {
+		return c.path
+	}
+	return filepath.Join(path, c.path)
+}
+
+func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
+	p := c.dir(path)
+	if err := os.MkdirAll(p, 0755); err != nil {
+		return nil, err
+	}
+	return newDatastore(p, c.syncWrites)
+}
+
+var _ fsrepo.CompactableConfig = (*datastoreConfig)(nil)
+
+// Compact compacts the whole key range of the database, dropping deleted
+// entries.
+func (c *datastoreConfig) Compact(path string, progress func(string)) error {
+	d, err := newDatastore(c.dir(path), c.syncWrites)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	progress("pebbleds: compacting " + c.path)
+	// the keys of the datastore all start with /, which 0xff sorts after
+	return d.db.Compact([]byte{}, []byte{0xff})
+}
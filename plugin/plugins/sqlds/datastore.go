@@ -0,0 +1,214 @@
+// +build postgres sqlite
+
+package sqlds
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	goprocess "gx/ipfs/QmSF8fPo3jgVBAy8fpdjjYqgG87dkJgUprRBHRd2tmfgpP/goprocess"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// queries holds the statements used by the datastore. They work with both
+// PostgreSQL and SQLite.
+type queries struct {
+	create   string
+	get      string
+	has      string
+	getSize  string
+	put      string
+	delete   string
+	query    string
+	queryKey string
+}
+
+func newQueries(table string) queries {
+	return queries{
+		create:   fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (key TEXT PRIMARY KEY, data BYTEA NOT NULL)", table),
+		get:      fmt.Sprintf("SELECT data FROM %s WHERE key = $1", table),
+		has:      fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE key = $1)", table),
+		getSize:  fmt.Sprintf("SELECT length(data) FROM %s WHERE key = $1", table),
+		put:      fmt.Sprintf("INSERT INTO %s (key, data) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET data = excluded.data", table),
+		delete:   fmt.Sprintf("DELETE FROM %s WHERE key = $1", table),
+		query:    fmt.Sprintf(`SELECT key, data FROM %s WHERE key LIKE $1 ESCAPE '\' ORDER BY key`, table),
+		queryKey: fmt.Sprintf(`SELECT key FROM %s WHERE key LIKE $1 ESCAPE '\' ORDER BY key`, table),
+	}
+}
+
+// datastore stores its entries in a single table of a SQL database.
+type datastore struct {
+	db *sql.DB
+	q  queries
+}
+
+var _ ds.Batching = (*datastore)(nil)
+
+func newDatastore(db *sql.DB, table string) (*datastore, error) {
+	d := &datastore{db: db, q: newQueries(table)}
+	if _, err := db.Exec(d.q.create); err != nil {
+		return nil, fmt.Errorf("sqlds: failed to create table %s: %s", table, err)
+	}
+	return d, nil
+}
+
+func (d *datastore) Put(key ds.Key, value []byte) error {
+	_, err := d.db.Exec(d.q.put, key.String(), notNull(value))
+	return err
+}
+
+func (d *datastore) Get(key ds.Key) ([]byte, error) {
+	var out []byte
+	err := d.db.QueryRow(d.q.get, key.String()).Scan(&out)
+	if err == sql.ErrNoRows {
+		return nil, ds.ErrNotFound
+	}
+	return out, err
+}
+
+func (d *datastore) Has(key ds.Key) (bool, error) {
+	var exists bool
+	err := d.db.QueryRow(d.q.has, key.String()).Scan(&exists)
+	return exists, err
+}
+
+func (d *datastore) GetSize(key ds.Key) (int, error) {
+	var size int
+	err := d.db.QueryRow(d.q.getSize, key.String()).Scan(&size)
+	if err == sql.ErrNoRows {
+		return -1, ds.ErrNotFound
+	}
+	return size, err
+}
+
+func (d *datastore) Delete(key ds.Key) error {
+	res, err := d.db.Exec(d.q.delete, key.String())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ds.ErrNotFound
+	}
+	return nil
+}
+
+// Query selects the entries matching the prefix of q in the database, the
+// rest of the query is applied to the results.
+func (d *datastore) Query(q dsq.Query) (dsq.Results, error) {
+	stmt := d.q.query
+	if q.KeysOnly {
+		stmt = d.q.queryKey
+	}
+
+	rows, err := d.db.Query(stmt, likePrefix(q.Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	res := dsq.ResultsWithProcess(q, func(proc goprocess.Process, out chan<- dsq.Result) {
+		defer rows.Close()
+
+		for rows.Next() {
+			var e dsq.Entry
+			var err error
+			if q.KeysOnly {
+				err = rows.Scan(&e.Key)
+			} else {
+				err = rows.Scan(&e.Key, &e.Value)
+			}
+
+			select {
+			case out <- dsq.Result{Entry: e, Error: err}:
+			case <-proc.Closing():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			select {
+			case out <- dsq.Result{Error: err}:
+			case <-proc.Closing():
+			}
+		}
+	})
+	return dsq.NaiveQueryApply(q, res), nil
+}
+
+// notNull returns value, empty rather than nil: the drivers store nil as NULL.
+func notNull(value []byte) []byte {
+	if value == nil {
+		return []byte{}
+	}
+	return value
+}
+
+// likePrefix returns a LIKE pattern matching the keys starting with prefix.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(prefix) + "%"
+}
+
+func (d *datastore) Batch() (ds.Batch, error) {
+	return &batch{d: d}, nil
+}
+
+func (d *datastore) Close() error {
+	return d.db.Close()
+}
+
+// batch buffers operations and applies them in a single transaction on
+// Commit.
+type batch struct {
+	d   *datastore
+	ops []batchOp
+}
+
+type batchOp struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+func (b *batch) Put(key ds.Key, value []byte) error {
+	b.ops = append(b.ops, batchOp{key: key.String(), value: value})
+	return nil
+}
+
+func (b *batch) Delete(key ds.Key) error {
+	b.ops = append(b.ops, batchOp{key: key.String(), delete: true})
+	return nil
+}
+
+func (b *batch) Commit() error {
+	tx, err := b.d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, op := range b.ops {
+		if op.delete {
+			_, err = tx.Exec(b.d.q.delete, op.key)
+		} else {
+			_, err = tx.Exec(b.d.q.put, op.key, notNull(op.value))
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	b.ops = nil
+	return nil
+}
@@ -0,0 +1,149 @@
+// +build sqlite
+
+package sqlds
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+func newTestDatastore(t *testing.T) (*datastore, func()) {
+	dir, err := ioutil.TempDir("", "sqlds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "ds.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDatastore(db, defaultTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, func() {
+		d.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDatastore(t *testing.T) {
+	d, cleanup := newTestDatastore(t)
+	defer cleanup()
+
+	k := ds.NewKey("/a/b")
+	if _, err := d.Get(k); err != ds.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := d.Put(k, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Put(k, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := d.Get(k)
+	if err != nil || !bytes.Equal(v, []byte("value")) {
+		t.Fatalf("expected the value put last, got %q, %v", v, err)
+	}
+	if has, err := d.Has(k); err != nil || !has {
+		t.Fatalf("expected the key to exist, got %v, %v", has, err)
+	}
+	if size, err := d.GetSize(k); err != nil || size != len("value") {
+		t.Fatalf("expected the size of the value, got %d, %v", size, err)
+	}
+
+	if err := d.Put(ds.NewKey("/empty"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.Get(ds.NewKey("/empty")); err != nil || len(v) != 0 {
+		t.Fatalf("expected an empty value, got %q, %v", v, err)
+	}
+
+	if err := d.Delete(k); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := d.Has(k); err != nil || has {
+		t.Fatalf("expected the key to be deleted, got %v, %v", has, err)
+	}
+	if err := d.Delete(k); err != ds.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDatastoreQuery(t *testing.T) {
+	d, cleanup := newTestDatastore(t)
+	defer cleanup()
+
+	for _, k := range []string{"/a/1", "/a/2", "/A/3", "/a_b", "/axb"} {
+		if err := d.Put(ds.NewKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := query(t, d, dsq.Query{Prefix: "/a/"})
+	if len(entries) != 2 || entries[0].Key != "/a/1" || entries[1].Key != "/a/2" {
+		t.Fatalf("expected the entries under /a, got %v", entries)
+	}
+	if !bytes.Equal(entries[0].Value, []byte("/a/1")) {
+		t.Errorf("expected the value of /a/1, got %q", entries[0].Value)
+	}
+
+	// _ isn't a wildcard
+	entries = query(t, d, dsq.Query{Prefix: "/a_"})
+	if len(entries) != 1 || entries[0].Key != "/a_b" {
+		t.Fatalf("expected only /a_b, got %v", entries)
+	}
+
+	entries = query(t, d, dsq.Query{KeysOnly: true})
+	if len(entries) != 5 || entries[0].Value != nil {
+		t.Fatalf("expected all the keys only, got %v", entries)
+	}
+}
+
+func query(t *testing.T, d *datastore, q dsq.Query) []dsq.Entry {
+	res, err := d.Query(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestDatastoreBatch(t *testing.T) {
+	d, cleanup := newTestDatastore(t)
+	defer cleanup()
+
+	if err := d.Put(ds.NewKey("/old"), []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := d.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Put(ds.NewKey("/new"), []byte("new"))
+	b.Delete(ds.NewKey("/old"))
+	if has, _ := d.Has(ds.NewKey("/new")); has {
+		t.Fatal("expected the batch to be applied on commit")
+	}
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if has, _ := d.Has(ds.NewKey("/new")); !has {
+		t.Error("expected the put of the batch to be applied")
+	}
+	if has, _ := d.Has(ds.NewKey("/old")); has {
+		t.Error("expected the delete of the batch to be applied")
+	}
+}
@@ -0,0 +1,8 @@
+// +build postgres
+
+package sqlds
+
+import (
+	// the PostgreSQL driver, "postgres"
+	_ "github.com/lib/pq"
+)
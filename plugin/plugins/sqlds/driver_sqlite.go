@@ -0,0 +1,8 @@
+// +build sqlite
+
+package sqlds
+
+import (
+	// the SQLite driver, "sqlite3", built with the sqlite tag as it needs cgo
+	_ "github.com/mattn/go-sqlite3"
+)
@@ -0,0 +1,165 @@
+// +build postgres sqlite
+
+package sqlds
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ipfs/go-ipfs/plugin"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+// Plugins is exported list of plugins that will be loaded
+var Plugins = []plugin.Plugin{
+	&sqldsPlugin{},
+}
+
+type sqldsPlugin struct{}
+
+var _ plugin.PluginDatastore = (*sqldsPlugin)(nil)
+
+func (*sqldsPlugin) Name() string {
+	return "ds-sql"
+}
+
+func (*sqldsPlugin) Version() string {
+	return "0.1.0"
+}
+
+func (*sqldsPlugin) Init() error {
+	return nil
+}
+
+func (*sqldsPlugin) DatastoreTypeName() string {
+	return "sqlds"
+}
+
+const (
+	defaultDriver = "postgres"
+	defaultTable  = "ipfs_datastore"
+)
+
+var tableNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// datastoreConfig is the config of a SQL datastore. The DSN holds the
+// credentials of the database, so it isn't kept in the config: it is read
+// from the environment variable dsnEnv, or from the file dsnFile.
+type datastoreConfig struct {
+	driver  string
+	dsnEnv  string
+	dsnFile string
+	table   string
+}
+
+// DatastoreConfigParser returns a configuration stub for a SQL datastore
+// from the given parameters
+func (*sqldsPlugin) DatastoreConfigParser() fsrepo.ConfigFromMap {
+	return func(params map[string]interface{}) (fsrepo.DatastoreConfig, error) {
+		c := datastoreConfig{
+			driver: defaultDriver,
+			table:  defaultTable,
+		}
+		var ok bool
+
+		if _, ok := params["dsn"]; ok {
+			return nil, fmt.Errorf("'dsn' field is not supported, the DSN must be read from 'dsnEnv' or 'dsnFile'")
+		}
+
+		if e, ok := params["dsnEnv"]; ok {
+			c.dsnEnv, ok = e.(string)
+			if !ok {
+				return nil, fmt.Errorf("'dsnEnv' field was not a string")
+			}
+		}
+		if f, ok := params["dsnFile"]; ok {
+			c.dsnFile, ok = f.(string)
+			if !ok {
+				return nil, fmt.Errorf("'dsnFile' field was not a string")
+			}
+		}
+		if (c.dsnEnv == "") == (c.dsnFile == "") {
+			return nil, fmt.Errorf("exactly one of 'dsnEnv' and 'dsnFile' must be set")
+		}
+
+		if d, ok := params["driver"]; ok {
+			c.driver, ok = d.(string)
+			if !ok {
+				return nil, fmt.Errorf("'driver' field was not a string")
+			}
+		}
+
+		if t, ok := params["table"]; ok {
+			c.table, ok = t.(string)
+			if !ok {
+				return nil, fmt.Errorf("'table' field was not a string")
+			}
+		}
+		if !tableNameRe.MatchString(c.table) {
+			return nil, fmt.Errorf("invalid table name %q", c.table)
+		}
+
+		return &c, nil
+	}
+}
+
+// DiskSpec doesn't include the DSN: it may change (e.g., to point to a
+// replica after a failover) while the data stays the same.
+func (c *datastoreConfig) DiskSpec() fsrepo.DiskSpec {
+	return map[string]interface{}{
+		"type":   "sqlds",
+		"driver": c.driver,
+		"table":  c.table,
+	}
+}
+
+// dsn reads the DSN of the database. A relative dsnFile is relative to the
+// repo at path.
+func (c *datastoreConfig) dsn(path string) (string, error) {
+	if c.dsnEnv != "" {
+		dsn := os.Getenv(c.dsnEnv)
+		if dsn == "" {
+			return "", fmt.Errorf("sqlds: the environment variable %s is not set", c.dsnEnv)
+		}
+		return dsn, nil
+	}
+
+	file := c.dsnFile
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(path, file)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("sqlds: reading the DSN: %s", err)
+	}
+	dsn := strings.TrimSpace(string(b))
+	if dsn == "" {
+		return "", fmt.Errorf("sqlds: %s is empty", file)
+	}
+	return dsn, nil
+}
+
+func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
+	dsn, err := c.dsn(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(c.driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sqlds: %s (the drivers available are %s)", err, strings.Join(sql.Drivers(), ", "))
+	}
+
+	d, err := newDatastore(db, c.table)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
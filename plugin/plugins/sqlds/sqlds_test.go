@@ -0,0 +1,53 @@
+// +build postgres sqlite
+
+package sqlds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigDSN(t *testing.T) {
+	parse := (&sqldsPlugin{}).DatastoreConfigParser()
+
+	for _, params := range []map[string]interface{}{
+		{"dsn": "postgres://user:password@db/ipfs"},
+		{},
+		{"dsnEnv": "IPFS_SQLDS_DSN", "dsnFile": "dsn"},
+	} {
+		if _, err := parse(params); err == nil {
+			t.Errorf("expected %v to be refused", params)
+		}
+	}
+
+	os.Setenv("IPFS_SQLDS_DSN", "postgres://db/ipfs")
+	defer os.Unsetenv("IPFS_SQLDS_DSN")
+	c, err := parse(map[string]interface{}{"dsnEnv": "IPFS_SQLDS_DSN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn, err := c.(*datastoreConfig).dsn(""); err != nil || dsn != "postgres://db/ipfs" {
+		t.Errorf("expected the DSN of the environment, got %q, %v", dsn, err)
+	}
+
+	dir, err := ioutil.TempDir("", "sqlds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "dsn"), []byte("postgres://file/ipfs\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err = parse(map[string]interface{}{"dsnFile": "dsn"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn, err := c.(*datastoreConfig).dsn(dir); err != nil || dsn != "postgres://file/ipfs" {
+		t.Errorf("expected the DSN of the file in the repo, got %q, %v", dsn, err)
+	}
+	if _, ok := c.DiskSpec()["dsnFile"]; ok {
+		t.Error("expected the DSN file not to be part of the disk spec")
+	}
+}
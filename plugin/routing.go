@@ -0,0 +1,23 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/core"
+)
+
+// PluginRouting is an interface that can be implemented to add router types,
+// selected by the Routing.Type config key or composed with the other routers
+// in Routing.Routers
+type PluginRouting interface {
+	Plugin
+
+	RouterTypeName() string
+	RouterConstructor() core.RouterConstructor
+}
+
+// PluginRoutingWrapper is an interface that can be implemented to wrap the
+// routing system of the online nodes, whatever it is
+type PluginRoutingWrapper interface {
+	Plugin
+
+	RoutingWrapper() core.RoutingWrapper
+}
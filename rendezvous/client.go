@@ -0,0 +1,281 @@
+package rendezvous
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/rendezvous/pb"
+
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+// ErrNoPoints is returned by the clients knowing no rendezvous point.
+var ErrNoPoints = errors.New("rendezvous: no rendezvous point")
+
+// Client registers and discovers peers at rendezvous points.
+type Client struct {
+	host   p2phost.Host
+	points []pstore.PeerInfo
+}
+
+// NewClient returns a client of the rendezvous points, which are added to
+// the peerstore of host.
+func NewClient(host p2phost.Host, points []pstore.PeerInfo) *Client {
+	for _, pi := range points {
+		host.Peerstore().AddAddrs(pi.ID, pi.Addrs, pstore.PermanentAddrTTL)
+	}
+	return &Client{host: host, points: points}
+}
+
+// Points returns the rendezvous points of the client.
+func (c *Client) Points() []pstore.PeerInfo {
+	return c.points
+}
+
+// request sends req to the rendezvous point p and returns its response.
+func (c *Client) request(ctx context.Context, p peer.ID, req *pb.Message) (*pb.Message, error) {
+	s, err := c.host.NewStream(ctx, p, ProtocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Reset()
+		case <-done:
+		}
+	}()
+
+	if err := writeMessage(s, req); err != nil {
+		s.Reset()
+		return nil, err
+	}
+	res, err := readMessage(bufio.NewReader(s))
+	if err != nil {
+		s.Reset()
+		return nil, err
+	}
+	return res, nil
+}
+
+// each calls f with all the rendezvous points at once, and returns nil if it
+// succeeded with one of them, the first error otherwise.
+func (c *Client) each(f func(peer.ID) error) error {
+	if len(c.points) == 0 {
+		return ErrNoPoints
+	}
+	errs := make(chan error, len(c.points))
+	for _, pi := range c.points {
+		go func(p peer.ID) {
+			err := f(p)
+			if err != nil {
+				log.Debugf("rendezvous point %s: %s", p.Pretty(), err)
+			}
+			errs <- err
+		}(pi.ID)
+	}
+
+	var first error
+	succeeded := false
+	for range c.points {
+		if err := <-errs; err == nil {
+			succeeded = true
+		} else if first == nil {
+			first = err
+		}
+	}
+	if succeeded {
+		return nil
+	}
+	return first
+}
+
+// Register registers the node under ns at the rendezvous points, for ttl or
+// DefaultTTL if ttl is 0. It returns the time the registration lasts, the
+// shortest the points granted, and succeeds if a point accepted it.
+func (c *Client) Register(ctx context.Context, ns string, ttl time.Duration) (time.Duration, error) {
+	addrs := c.host.Addrs()
+	if len(addrs) == 0 {
+		return 0, errors.New("rendezvous: the node has no address to register")
+	}
+	info := &pb.Message_PeerInfo{Id: []byte(c.host.ID())}
+	for _, a := range addrs {
+		info.Addrs = append(info.Addrs, a.Bytes())
+	}
+	typ := pb.Message_REGISTER
+	secs := int64(ttl / time.Second)
+	req := &pb.Message{
+		Type: &typ,
+		Register: &pb.Message_Register{
+			Ns:   &ns,
+			Peer: info,
+			Ttl:  &secs,
+		},
+	}
+
+	granted := make(chan time.Duration, len(c.points))
+	err := c.each(func(p peer.ID) error {
+		res, err := c.request(ctx, p, req)
+		if err != nil {
+			return err
+		}
+		r := res.RegisterResponse
+		if res.GetType() != pb.Message_REGISTER_RESPONSE || r == nil {
+			return errors.New("rendezvous: unexpected response")
+		}
+		if r.GetStatus() != pb.Message_OK {
+			return &StatusError{Status: r.GetStatus(), Text: r.GetStatusText()}
+		}
+		granted <- time.Duration(r.GetTtl()) * time.Second
+		return nil
+	})
+	close(granted)
+	if err != nil {
+		return 0, err
+	}
+
+	var shortest time.Duration
+	for d := range granted {
+		if shortest == 0 || (d > 0 && d < shortest) {
+			shortest = d
+		}
+	}
+	if shortest == 0 {
+		shortest = ttl
+	}
+	if shortest == 0 {
+		shortest = DefaultTTL
+	}
+	return shortest, nil
+}
+
+// Unregister removes the registration of the node under ns from the
+// rendezvous points. The points don't answer, so it succeeds once the
+// request is sent to one of them.
+func (c *Client) Unregister(ctx context.Context, ns string) error {
+	typ := pb.Message_UNREGISTER
+	req := &pb.Message{
+		Type: &typ,
+		Unregister: &pb.Message_Unregister{
+			Ns: &ns,
+			Id: []byte(c.host.ID()),
+		},
+	}
+	return c.each(func(p peer.ID) error {
+		s, err := c.host.NewStream(ctx, p, ProtocolID)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		if err := writeMessage(s, req); err != nil {
+			s.Reset()
+			return err
+		}
+		return nil
+	})
+}
+
+// Discover returns the peers registered under ns at the rendezvous points,
+// up to limit if it isn't 0, but the node itself. An empty ns returns the
+// peers of all the namespaces.
+func (c *Client) Discover(ctx context.Context, ns string, limit int) ([]pstore.PeerInfo, error) {
+	typ := pb.Message_DISCOVER
+	lim := int64(limit)
+	req := &pb.Message{
+		Type: &typ,
+		Discover: &pb.Message_Discover{
+			Ns:    &ns,
+			Limit: &lim,
+		},
+	}
+
+	found := make(chan []pstore.PeerInfo, len(c.points))
+	err := c.each(func(p peer.ID) error {
+		res, err := c.request(ctx, p, req)
+		if err != nil {
+			return err
+		}
+		r := res.DiscoverResponse
+		if res.GetType() != pb.Message_DISCOVER_RESPONSE || r == nil {
+			return errors.New("rendezvous: unexpected response")
+		}
+		if r.GetStatus() != pb.Message_OK {
+			return &StatusError{Status: r.GetStatus(), Text: r.GetStatusText()}
+		}
+		var peers []pstore.PeerInfo
+		for _, reg := range r.Registrations {
+			if pi, ok := peerInfo(reg.Peer); ok {
+				peers = append(peers, pi)
+			}
+		}
+		found <- peers
+		return nil
+	})
+	close(found)
+	if err != nil {
+		return nil, err
+	}
+
+	// the same peer may be registered at several points, and under several
+	// namespaces
+	var out []pstore.PeerInfo
+	index := make(map[peer.ID]int)
+	for peers := range found {
+		for _, pi := range peers {
+			if pi.ID == c.host.ID() {
+				continue
+			}
+			if i, ok := index[pi.ID]; ok {
+				out[i].Addrs = mergeAddrs(out[i].Addrs, pi.Addrs)
+				continue
+			}
+			if limit > 0 && len(out) >= limit {
+				continue
+			}
+			index[pi.ID] = len(out)
+			out = append(out, pi)
+		}
+	}
+	return out, nil
+}
+
+// peerInfo decodes info, and returns false if its peer or all its addresses
+// are invalid.
+func peerInfo(info *pb.Message_PeerInfo) (pstore.PeerInfo, bool) {
+	if info == nil {
+		return pstore.PeerInfo{}, false
+	}
+	id, err := peer.IDFromBytes(info.Id)
+	if err != nil {
+		return pstore.PeerInfo{}, false
+	}
+	pi := pstore.PeerInfo{ID: id}
+	for _, b := range info.Addrs {
+		if a, err := ma.NewMultiaddrBytes(b); err == nil {
+			pi.Addrs = append(pi.Addrs, a)
+		}
+	}
+	return pi, len(pi.Addrs) > 0
+}
+
+func mergeAddrs(addrs, more []ma.Multiaddr) []ma.Multiaddr {
+next:
+	for _, a := range more {
+		for _, known := range addrs {
+			if a.Equal(known) {
+				continue next
+			}
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs
+}
@@ -0,0 +1,217 @@
+// Package rendezvous_pb holds the messages of the libp2p rendezvous protocol,
+// as described by rendezvous.proto. They are encoded through the struct tags
+// by the proto package.
+package rendezvous_pb
+
+import (
+	proto "gx/ipfs/QmdxUuburamoF6zF9qjeQC4WYcWGbWuRmdLacMEsW8ioD8/gogo-protobuf/proto"
+)
+
+type MessageType int32
+
+const (
+	Message_REGISTER          MessageType = 0
+	Message_REGISTER_RESPONSE MessageType = 1
+	Message_UNREGISTER        MessageType = 2
+	Message_DISCOVER          MessageType = 3
+	Message_DISCOVER_RESPONSE MessageType = 4
+)
+
+type ResponseStatus int32
+
+const (
+	Message_OK                  ResponseStatus = 0
+	Message_E_INVALID_NAMESPACE ResponseStatus = 100
+	Message_E_INVALID_PEER_INFO ResponseStatus = 101
+	Message_E_INVALID_TTL       ResponseStatus = 102
+	Message_E_INVALID_COOKIE    ResponseStatus = 103
+	Message_E_NOT_AUTHORIZED    ResponseStatus = 200
+	Message_E_INTERNAL_ERROR    ResponseStatus = 300
+	Message_E_UNAVAILABLE       ResponseStatus = 400
+)
+
+func (s ResponseStatus) String() string {
+	switch s {
+	case Message_OK:
+		return "OK"
+	case Message_E_INVALID_NAMESPACE:
+		return "invalid namespace"
+	case Message_E_INVALID_PEER_INFO:
+		return "invalid peer info"
+	case Message_E_INVALID_TTL:
+		return "invalid ttl"
+	case Message_E_INVALID_COOKIE:
+		return "invalid cookie"
+	case Message_E_NOT_AUTHORIZED:
+		return "not authorized"
+	case Message_E_INTERNAL_ERROR:
+		return "internal error"
+	case Message_E_UNAVAILABLE:
+		return "unavailable"
+	default:
+		return "unknown status"
+	}
+}
+
+type Message struct {
+	Type             *MessageType              `protobuf:"varint,1,opt,name=type"`
+	Register         *Message_Register         `protobuf:"bytes,2,opt,name=register"`
+	RegisterResponse *Message_RegisterResponse `protobuf:"bytes,3,opt,name=registerResponse"`
+	Unregister       *Message_Unregister       `protobuf:"bytes,4,opt,name=unregister"`
+	Discover         *Message_Discover         `protobuf:"bytes,5,opt,name=discover"`
+	DiscoverResponse *Message_DiscoverResponse `protobuf:"bytes,6,opt,name=discoverResponse"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+func (m *Message) GetType() MessageType {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return Message_REGISTER
+}
+
+type Message_PeerInfo struct {
+	Id    []byte   `protobuf:"bytes,1,opt,name=id"`
+	Addrs [][]byte `protobuf:"bytes,2,rep,name=addrs"`
+}
+
+func (m *Message_PeerInfo) Reset()         { *m = Message_PeerInfo{} }
+func (m *Message_PeerInfo) String() string { return proto.CompactTextString(m) }
+func (*Message_PeerInfo) ProtoMessage()    {}
+
+type Message_Register struct {
+	Ns   *string           `protobuf:"bytes,1,opt,name=ns"`
+	Peer *Message_PeerInfo `protobuf:"bytes,2,opt,name=peer"`
+	Ttl  *int64            `protobuf:"varint,3,opt,name=ttl"`
+}
+
+func (m *Message_Register) Reset()         { *m = Message_Register{} }
+func (m *Message_Register) String() string { return proto.CompactTextString(m) }
+func (*Message_Register) ProtoMessage()    {}
+
+func (m *Message_Register) GetNs() string {
+	if m != nil && m.Ns != nil {
+		return *m.Ns
+	}
+	return ""
+}
+
+func (m *Message_Register) GetPeer() *Message_PeerInfo {
+	if m != nil {
+		return m.Peer
+	}
+	return nil
+}
+
+func (m *Message_Register) GetTtl() int64 {
+	if m != nil && m.Ttl != nil {
+		return *m.Ttl
+	}
+	return 0
+}
+
+type Message_RegisterResponse struct {
+	Status     *ResponseStatus `protobuf:"varint,1,opt,name=status"`
+	StatusText *string         `protobuf:"bytes,2,opt,name=statusText"`
+	Ttl        *int64          `protobuf:"varint,3,opt,name=ttl"`
+}
+
+func (m *Message_RegisterResponse) Reset()         { *m = Message_RegisterResponse{} }
+func (m *Message_RegisterResponse) String() string { return proto.CompactTextString(m) }
+func (*Message_RegisterResponse) ProtoMessage()    {}
+
+func (m *Message_RegisterResponse) GetStatus() ResponseStatus {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return Message_OK
+}
+
+func (m *Message_RegisterResponse) GetStatusText() string {
+	if m != nil && m.StatusText != nil {
+		return *m.StatusText
+	}
+	return ""
+}
+
+func (m *Message_RegisterResponse) GetTtl() int64 {
+	if m != nil && m.Ttl != nil {
+		return *m.Ttl
+	}
+	return 0
+}
+
+type Message_Unregister struct {
+	Ns *string `protobuf:"bytes,1,opt,name=ns"`
+	Id []byte  `protobuf:"bytes,2,opt,name=id"`
+}
+
+func (m *Message_Unregister) Reset()         { *m = Message_Unregister{} }
+func (m *Message_Unregister) String() string { return proto.CompactTextString(m) }
+func (*Message_Unregister) ProtoMessage()    {}
+
+func (m *Message_Unregister) GetNs() string {
+	if m != nil && m.Ns != nil {
+		return *m.Ns
+	}
+	return ""
+}
+
+type Message_Discover struct {
+	Ns     *string `protobuf:"bytes,1,opt,name=ns"`
+	Limit  *int64  `protobuf:"varint,2,opt,name=limit"`
+	Cookie []byte  `protobuf:"bytes,3,opt,name=cookie"`
+}
+
+func (m *Message_Discover) Reset()         { *m = Message_Discover{} }
+func (m *Message_Discover) String() string { return proto.CompactTextString(m) }
+func (*Message_Discover) ProtoMessage()    {}
+
+func (m *Message_Discover) GetNs() string {
+	if m != nil && m.Ns != nil {
+		return *m.Ns
+	}
+	return ""
+}
+
+func (m *Message_Discover) GetLimit() int64 {
+	if m != nil && m.Limit != nil {
+		return *m.Limit
+	}
+	return 0
+}
+
+func (m *Message_Discover) GetCookie() []byte {
+	if m != nil {
+		return m.Cookie
+	}
+	return nil
+}
+
+type Message_DiscoverResponse struct {
+	Registrations []*Message_Register `protobuf:"bytes,1,rep,name=registrations"`
+	Cookie        []byte              `protobuf:"bytes,2,opt,name=cookie"`
+	Status        *ResponseStatus     `protobuf:"varint,3,opt,name=status"`
+	StatusText    *string             `protobuf:"bytes,4,opt,name=statusText"`
+}
+
+func (m *Message_DiscoverResponse) Reset()         { *m = Message_DiscoverResponse{} }
+func (m *Message_DiscoverResponse) String() string { return proto.CompactTextString(m) }
+func (*Message_DiscoverResponse) ProtoMessage()    {}
+
+func (m *Message_DiscoverResponse) GetStatus() ResponseStatus {
+	if m != nil && m.Status != nil {
+		return *m.Status
+	}
+	return Message_OK
+}
+
+func (m *Message_DiscoverResponse) GetStatusText() string {
+	if m != nil && m.StatusText != nil {
+		return *m.StatusText
+	}
+	return ""
+}
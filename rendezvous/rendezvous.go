@@ -0,0 +1,95 @@
+// Package rendezvous implements the libp2p rendezvous protocol: the peers
+// register under namespaces at rendezvous points, peers everyone knows, and
+// discover there the peers registered under the same namespaces.
+//
+// It lets the peers of an application find each other where the DHT isn't
+// reachable and mDNS doesn't reach them, such as private networks spanning
+// several sites.
+package rendezvous
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/rendezvous/pb"
+
+	protocol "gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	proto "gx/ipfs/QmdxUuburamoF6zF9qjeQC4WYcWGbWuRmdLacMEsW8ioD8/gogo-protobuf/proto"
+)
+
+var log = logging.Logger("rendezvous")
+
+// ProtocolID is the protocol of the rendezvous points.
+const ProtocolID = protocol.ID("/rendezvous/1.0.0")
+
+var (
+	// DefaultTTL is the time a registration lasts when no TTL is asked for
+	DefaultTTL = 2 * time.Hour
+
+	// MaxTTL is the longest time a registration lasts
+	MaxTTL = 72 * time.Hour
+
+	// MaxNamespaceLength is the longest namespace accepted
+	MaxNamespaceLength = 255
+
+	// DefaultLimit is the number of registrations returned by a discovery
+	// when no limit is asked for, and the most returned
+	DefaultLimit = 1000
+)
+
+// maxMessageSize bounds the size of the messages read, a full response to a
+// discovery included.
+const maxMessageSize = 4 << 20
+
+// StatusError is the error of a request the rendezvous point rejected.
+type StatusError struct {
+	Status pb.ResponseStatus
+	Text   string
+}
+
+func (e *StatusError) Error() string {
+	if e.Text != "" {
+		return fmt.Sprintf("rendezvous: %s: %s", e.Status, e.Text)
+	}
+	return fmt.Sprintf("rendezvous: %s", e.Status)
+}
+
+func writeMessage(w io.Writer, m *pb.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], uint64(len(b)))
+	if _, err := w.Write(prefix[:n]); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func readMessage(r *bufio.Reader) (*pb.Message, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes over the limit of %d", size, maxMessageSize)
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	m := new(pb.Message)
+	if err := proto.Unmarshal(b, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,80 @@
+package rendezvous
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/rendezvous/pb"
+
+	mocknet "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/net/mock"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+)
+
+func TestRendezvous(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn, err := mocknet.FullMeshConnected(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+
+	NewService(hosts[0])
+	point := []pstore.PeerInfo{{ID: hosts[0].ID(), Addrs: hosts[0].Addrs()}}
+	a := NewClient(hosts[1], point)
+	b := NewClient(hosts[2], point)
+
+	ttl, err := a.Register(ctx, "app", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != time.Hour {
+		t.Fatalf("expected the ttl asked for, got %s", ttl)
+	}
+	if _, err := b.Register(ctx, "other", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := b.Discover(ctx, "app", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].ID != hosts[1].ID() || len(peers[0].Addrs) == 0 {
+		t.Fatalf("expected the peer registered under the namespace, got %v", peers)
+	}
+
+	// the node itself isn't returned
+	peers, err = b.Discover(ctx, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].ID != hosts[1].ID() {
+		t.Fatalf("expected the peers of all the namespaces but the node, got %v", peers)
+	}
+
+	if err := a.Unregister(ctx, "app"); err != nil {
+		t.Fatal(err)
+	}
+	// the unregistration isn't answered, give it time to be handled
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		peers, err = b.Discover(ctx, "app", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(peers) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the peer to be unregistered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = a.Register(ctx, "app", MaxTTL+time.Hour)
+	if serr, ok := err.(*StatusError); !ok || serr.Status != pb.Message_E_INVALID_TTL {
+		t.Fatalf("expected the ttl to be rejected, got %v", err)
+	}
+}
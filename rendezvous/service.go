@@ -0,0 +1,238 @@
+package rendezvous
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/ipfs/go-ipfs/rendezvous/pb"
+
+	inet "gx/ipfs/QmPtFaR7BWHLAjSwLh9kXcyrgTzDpuhcWLkx8ioa9RMYnx/go-libp2p-net"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	p2phost "gx/ipfs/QmfD51tKgJiTMnW9JEiDiPwsCY4mqUoxkhKhBfyW12spTC/go-libp2p-host"
+)
+
+// MaxRegistrations bounds the number of namespaces a peer is registered
+// under at a rendezvous point.
+var MaxRegistrations = 1000
+
+// registration is a peer registered under a namespace.
+type registration struct {
+	ns      string
+	info    *pb.Message_PeerInfo
+	expires time.Time
+
+	// seq orders the registrations, the cookies of the discoveries being
+	// the last seq returned
+	seq uint64
+}
+
+// Service is a rendezvous point, keeping the registrations in memory.
+type Service struct {
+	host p2phost.Host
+
+	lk     sync.Mutex
+	regs   map[string]map[peer.ID]*registration
+	counts map[peer.ID]int
+	seq    uint64
+}
+
+// NewService serves the rendezvous protocol on host.
+func NewService(host p2phost.Host) *Service {
+	s := &Service{
+		host:   host,
+		regs:   make(map[string]map[peer.ID]*registration),
+		counts: make(map[peer.ID]int),
+	}
+	host.SetStreamHandler(ProtocolID, s.handleStream)
+	return s
+}
+
+// Close stops serving the rendezvous protocol.
+func (s *Service) Close() error {
+	s.host.RemoveStreamHandler(ProtocolID)
+	return nil
+}
+
+func (s *Service) handleStream(st inet.Stream) {
+	defer st.Close()
+	p := st.Conn().RemotePeer()
+	r := bufio.NewReader(st)
+	for {
+		req, err := readMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				log.Debugf("reading rendezvous request from %s: %s", p.Pretty(), err)
+				st.Reset()
+			}
+			return
+		}
+
+		var res *pb.Message
+		switch req.GetType() {
+		case pb.Message_REGISTER:
+			typ := pb.Message_REGISTER_RESPONSE
+			res = &pb.Message{Type: &typ, RegisterResponse: s.register(p, req.Register)}
+		case pb.Message_UNREGISTER:
+			s.unregister(p, req.Unregister)
+			continue
+		case pb.Message_DISCOVER:
+			typ := pb.Message_DISCOVER_RESPONSE
+			res = &pb.Message{Type: &typ, DiscoverResponse: s.discover(req.Discover)}
+		default:
+			log.Debugf("unexpected rendezvous message from %s: %d", p.Pretty(), req.GetType())
+			st.Reset()
+			return
+		}
+		if err := writeMessage(st, res); err != nil {
+			log.Debugf("answering %s: %s", p.Pretty(), err)
+			st.Reset()
+			return
+		}
+	}
+}
+
+func registerError(status pb.ResponseStatus, text string) *pb.Message_RegisterResponse {
+	return &pb.Message_RegisterResponse{Status: &status, StatusText: &text}
+}
+
+func validNamespace(ns string) bool {
+	return ns != "" && len(ns) <= MaxNamespaceLength
+}
+
+// register registers p as req asks, only p being allowed to register itself.
+func (s *Service) register(p peer.ID, req *pb.Message_Register) *pb.Message_RegisterResponse {
+	ns := req.GetNs()
+	if !validNamespace(ns) {
+		return registerError(pb.Message_E_INVALID_NAMESPACE, "")
+	}
+	info, ok := peerInfo(req.GetPeer())
+	if !ok {
+		return registerError(pb.Message_E_INVALID_PEER_INFO, "")
+	}
+	if info.ID != p {
+		return registerError(pb.Message_E_NOT_AUTHORIZED, "peers register themselves only")
+	}
+	ttl := time.Duration(req.GetTtl()) * time.Second
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < 0 || ttl > MaxTTL {
+		return registerError(pb.Message_E_INVALID_TTL, "")
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	peers := s.regs[ns]
+	if peers == nil {
+		peers = make(map[peer.ID]*registration)
+		s.regs[ns] = peers
+	}
+	if _, ok := peers[p]; !ok {
+		if s.counts[p] >= MaxRegistrations {
+			return registerError(pb.Message_E_NOT_AUTHORIZED, "too many registrations")
+		}
+		s.counts[p]++
+	}
+	s.seq++
+	peers[p] = &registration{
+		ns:      ns,
+		info:    req.GetPeer(),
+		expires: time.Now().Add(ttl),
+		seq:     s.seq,
+	}
+
+	status := pb.Message_OK
+	secs := int64(ttl / time.Second)
+	return &pb.Message_RegisterResponse{Status: &status, Ttl: &secs}
+}
+
+func (s *Service) unregister(p peer.ID, req *pb.Message_Unregister) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.remove(req.GetNs(), p)
+}
+
+// remove removes the registration of p under ns. s.lk must be held.
+func (s *Service) remove(ns string, p peer.ID) {
+	peers := s.regs[ns]
+	if _, ok := peers[p]; !ok {
+		return
+	}
+	delete(peers, p)
+	if len(peers) == 0 {
+		delete(s.regs, ns)
+	}
+	if s.counts[p]--; s.counts[p] <= 0 {
+		delete(s.counts, p)
+	}
+}
+
+func discoverError(status pb.ResponseStatus, text string) *pb.Message_DiscoverResponse {
+	return &pb.Message_DiscoverResponse{Status: &status, StatusText: &text}
+}
+
+// discover returns the registrations under the namespace of req, or all of
+// them if it is empty, newer than its cookie.
+func (s *Service) discover(req *pb.Message_Discover) *pb.Message_DiscoverResponse {
+	ns := req.GetNs()
+	if ns != "" && !validNamespace(ns) {
+		return discoverError(pb.Message_E_INVALID_NAMESPACE, "")
+	}
+	var after uint64
+	if cookie := req.GetCookie(); cookie != nil {
+		if len(cookie) != 8 {
+			return discoverError(pb.Message_E_INVALID_COOKIE, "")
+		}
+		after = binary.BigEndian.Uint64(cookie)
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 || limit > DefaultLimit {
+		limit = DefaultLimit
+	}
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	now := time.Now()
+	var found []*registration
+	for name, peers := range s.regs {
+		if ns != "" && name != ns {
+			continue
+		}
+		for p, reg := range peers {
+			if now.After(reg.expires) {
+				s.remove(name, p)
+				continue
+			}
+			if reg.seq > after {
+				found = append(found, reg)
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].seq < found[j].seq
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	status := pb.Message_OK
+	res := &pb.Message_DiscoverResponse{Status: &status}
+	last := after
+	for _, reg := range found {
+		ns := reg.ns
+		secs := int64(reg.expires.Sub(now) / time.Second)
+		res.Registrations = append(res.Registrations, &pb.Message_Register{
+			Ns:   &ns,
+			Peer: reg.info,
+			Ttl:  &secs,
+		})
+		last = reg.seq
+	}
+	res.Cookie = make([]byte, 8)
+	binary.BigEndian.PutUint64(res.Cookie, last)
+	return res
+}
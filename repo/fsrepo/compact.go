@@ -0,0 +1,167 @@
+package fsrepo
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+
+	lockfile "gx/ipfs/QmcWjZkQxyPMkgZRpda4hqWwaD6E1yqCvcxZfxbt98CEAK/go-fs-lock"
+)
+
+// CompactableConfig is implemented by the configs of datastores that can be
+// compacted to reclaim disk space, e.g. after large deletions.
+type CompactableConfig interface {
+	DatastoreConfig
+
+	// Compact compacts the datastore of the repo at path. The datastore
+	// isn't open while compacting. progress reports what is being done.
+	Compact(path string, progress func(msg string)) error
+}
+
+// compactChild compacts a datastore if it supports it.
+func compactChild(c DatastoreConfig, path string, progress func(string)) error {
+	cc, ok := c.(CompactableConfig)
+	if !ok {
+		return nil
+	}
+	return cc.Compact(path, progress)
+}
+
+func (c *mountDatastoreConfig) Compact(path string, progress func(string)) error {
+	for _, m := range c.mounts {
+		progress(fmt.Sprintf("compacting %s", m.prefix))
+		if err := compactChild(m.ds, path, progress); err != nil {
+			return fmt.Errorf("compacting %s: %s", m.prefix, err)
+		}
+	}
+	return nil
+}
+
+func (c *logDatastoreConfig) Compact(path string, progress func(string)) error {
+	return compactChild(c.child, path, progress)
+}
+
+func (c *measureDatastoreConfig) Compact(path string, progress func(string)) error {
+	return compactChild(c.child, path, progress)
+}
+
+func (c *encryptedDatastoreConfig) Compact(path string, progress func(string)) error {
+	return compactChild(c.child, path, progress)
+}
+
+// CompactDatastore runs the backend specific compaction of the datastores of
+// the repo at repoPath: value log garbage collection for badger, compaction
+// of the whole key range for leveldb, and re-sharding for flatfs datastores
+// whose shardFunc was changed in the config. progress, if not nil, is called
+// with messages describing the compaction.
+//
+// The repo must not be in use while compacting.
+func CompactDatastore(repoPath string, progress func(msg string)) error {
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	r, err := newFSRepo(repoPath)
+	if err != nil {
+		return err
+	}
+	if err := checkInitialized(r.path); err != nil {
+		return err
+	}
+
+	lk, err := lockfile.Lock(r.path, LockFile)
+	if err != nil {
+		return err
+	}
+	defer lk.Close()
+
+	slk, err := lockShared(r.path, true)
+	if err != nil {
+		return err
+	}
+	defer slk.Close()
+
+	ver, err := mfsr.RepoPath(r.path).Version()
+	if err != nil {
+		return err
+	}
+	if ver != RepoVersion {
+		return ErrNeedMigration
+	}
+
+	if err := r.openConfig(); err != nil {
+		return err
+	}
+	dsc, err := AnyDatastoreConfig(r.config.Datastore.Spec)
+	if err != nil {
+		return err
+	}
+
+	// Changing the shardFunc of a flatfs datastore is the only change of
+	// the datastore spec compaction can apply.
+	oldSpec, err := r.readSpec()
+	if err != nil {
+		return err
+	}
+	spec := dsc.DiskSpec()
+	respec := oldSpec != spec.String()
+	if respec {
+		same, err := sameSpecIgnoring(oldSpec, spec, "shardFunc")
+		if err != nil {
+			return err
+		}
+		if !same {
+			return fmt.Errorf("datastore configuration of '%s' does not match what is on disk '%s', use 'ipfs repo convert' to change datastores",
+				oldSpec, spec.String())
+		}
+	}
+
+	if err := compactChild(dsc, r.path, progress); err != nil {
+		return err
+	}
+
+	if respec {
+		if err := r.writeSpec(spec); err != nil {
+			return err
+		}
+	}
+	progress("datastore compacted")
+	return nil
+}
+
+// sameSpecIgnoring compares two disk specs, ignoring the given key.
+func sameSpecIgnoring(a string, b DiskSpec, key string) (bool, error) {
+	var am, bm interface{}
+	if err := json.Unmarshal([]byte(a), &am); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b.Bytes(), &bm); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(withoutKey(am, key), withoutKey(bm, key)), nil
+}
+
+func withoutKey(v interface{}, key string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			if k != key {
+				out[k] = withoutKey(e, key)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = withoutKey(e, key)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,37 @@
+package fsrepo
+
+import (
+	"testing"
+)
+
+func TestSameSpecIgnoring(t *testing.T) {
+	old := `{"mounts":[{"mountpoint":"/blocks","path":"blocks","shardFunc":"/repo/flatfs/shard/v1/next-to-last/2","type":"flatfs"},{"mountpoint":"/","path":"datastore","type":"levelds"}],"type":"mount"}`
+
+	for _, tc := range []struct {
+		spec DiskSpec
+		same bool
+	}{
+		{
+			spec: DiskSpec{"type": "mount", "mounts": []interface{}{
+				map[string]interface{}{"mountpoint": "/blocks", "path": "blocks", "shardFunc": "/repo/flatfs/shard/v1/next-to-last/3", "type": "flatfs"},
+				map[string]interface{}{"mountpoint": "/", "path": "datastore", "type": "levelds"},
+			}},
+			same: true,
+		},
+		{
+			spec: DiskSpec{"type": "mount", "mounts": []interface{}{
+				map[string]interface{}{"mountpoint": "/blocks", "path": "blocks2", "shardFunc": "/repo/flatfs/shard/v1/next-to-last/2", "type": "flatfs"},
+				map[string]interface{}{"mountpoint": "/", "path": "datastore", "type": "levelds"},
+			}},
+			same: false,
+		},
+	} {
+		same, err := sameSpecIgnoring(old, tc.spec, "shardFunc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same != tc.same {
+			t.Errorf("expected %t comparing with %s", tc.same, tc.spec)
+		}
+	}
+}
@@ -74,6 +74,24 @@ var measureConfig = []byte(`{
           "type": "measure"
 }`)
 
+var tieredConfig = []byte(`{
+          "hot": {
+            "path": "blocks",
+            "shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+            "sync": true,
+            "type": "flatfs"
+          },
+          "cold": {
+            "path": "blocks-cold",
+            "shardFunc": "/repo/flatfs/shard/v1/next-to-last/2",
+            "sync": false,
+            "type": "flatfs"
+          },
+          "hotMaxSize": "10GB",
+          "promoteAfter": 2,
+          "type": "tiered"
+}`)
+
 func TestDefaultDatastoreConfig(t *testing.T) {
 	loader.LoadPlugins("")
 
@@ -222,3 +240,42 @@ func TestMeasureConfig(t *testing.T) {
 		t.Errorf("expected '*measure.measure' got '%s'", typ)
 	}
 }
+
+func TestTieredConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-datastore-config-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // clean up
+
+	spec := make(map[string]interface{})
+	err = json.Unmarshal(tieredConfig, &spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dsc, err := fsrepo.AnyDatastoreConfig(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"cold":{"path":"blocks-cold","shardFunc":"/repo/flatfs/shard/v1/next-to-last/2","type":"flatfs"},"hot":{"path":"blocks","shardFunc":"/repo/flatfs/shard/v1/next-to-last/2","type":"flatfs"},"type":"tiered"}`
+	if dsc.DiskSpec().String() != expected {
+		t.Errorf("expected '%s' got '%s' as DiskId", expected, dsc.DiskSpec().String())
+	}
+
+	ds, err := dsc.Create(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	if typ := reflect.TypeOf(ds).String(); typ != "*tieredds.Datastore" {
+		t.Errorf("expected '*tieredds.Datastore' got '%s'", typ)
+	}
+
+	delete(spec, "hotMaxSize")
+	if _, err := fsrepo.AnyDatastoreConfig(spec); err == nil {
+		t.Error("expected a tiered datastore without hotMaxSize to be refused")
+	}
+}
@@ -0,0 +1,246 @@
+package fsrepo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+
+	util "gx/ipfs/QmNohiVssaPw3KVLZik59DBVGTSm2dGvYT9eoXt5DQ36Yz/go-ipfs-util"
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	lockfile "gx/ipfs/QmcWjZkQxyPMkgZRpda4hqWwaD6E1yqCvcxZfxbt98CEAK/go-fs-lock"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+const (
+	// convertStagingDir is where the new datastore is built during a
+	// conversion, relative to the repo.
+	convertStagingDir = "datastore-convert"
+
+	// convertBackupDir holds the files of the old datastore that had the
+	// same name as files of the new one.
+	convertBackupDir = "datastore-convert-old"
+
+	convertBatchSize = 1000
+)
+
+// ConvertDatastore copies the content of the datastore of the repo at
+// repoPath to a new datastore created from spec, and makes the repo use it.
+// progress, if not nil, is called with the number of entries copied so far.
+//
+// The new datastore is built next to the current one, which is left
+// untouched until all the entries were copied. Files of the old datastore
+// that would be overwritten by the new one are moved to the
+// datastore-convert-old directory of the repo; other files of the old
+// datastore are left in place and can be removed once the repo works with
+// the new datastore.
+//
+// The repo must not be in use while converting.
+func ConvertDatastore(repoPath string, spec map[string]interface{}, progress func(copied int)) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	r, err := newFSRepo(repoPath)
+	if err != nil {
+		return err
+	}
+	if err := checkInitialized(r.path); err != nil {
+		return err
+	}
+
+	lk, err := lockfile.Lock(r.path, LockFile)
+	if err != nil {
+		return err
+	}
+	defer lk.Close()
+
+	slk, err := lockShared(r.path, true)
+	if err != nil {
+		return err
+	}
+	defer slk.Close()
+
+	ver, err := mfsr.RepoPath(r.path).Version()
+	if err != nil {
+		return err
+	}
+	if ver != RepoVersion {
+		return ErrNeedMigration
+	}
+
+	if err := r.openConfig(); err != nil {
+		return err
+	}
+
+	oldDsc, err := AnyDatastoreConfig(r.config.Datastore.Spec)
+	if err != nil {
+		return err
+	}
+	newDsc, err := AnyDatastoreConfig(spec)
+	if err != nil {
+		return err
+	}
+
+	oldSpec, err := r.readSpec()
+	if err != nil {
+		return err
+	}
+	if oldSpec != oldDsc.DiskSpec().String() {
+		return fmt.Errorf("datastore configuration of '%s' does not match what is on disk '%s'",
+			oldSpec, oldDsc.DiskSpec().String())
+	}
+	if newDsc.DiskSpec().String() == oldSpec {
+		return fmt.Errorf("the repo already uses this datastore configuration")
+	}
+
+	stage := filepath.Join(r.path, convertStagingDir)
+	backup := filepath.Join(r.path, convertBackupDir)
+	for _, p := range []string{stage, backup} {
+		if util.FileExists(p) {
+			return fmt.Errorf("%s exists, a previous conversion may have been interrupted", p)
+		}
+	}
+
+	if err := os.Mkdir(stage, 0755); err != nil {
+		return err
+	}
+	if err := copyToNewDatastore(r.path, stage, oldDsc, newDsc, progress); err != nil {
+		os.RemoveAll(stage)
+		return err
+	}
+
+	undo, err := moveConvertedFiles(r.path, stage, backup)
+	if err != nil {
+		undo()
+		return err
+	}
+
+	fn, err := config.Path(r.path, specFn)
+	if err != nil {
+		undo()
+		return err
+	}
+	if err := ioutil.WriteFile(fn, newDsc.DiskSpec().Bytes(), 0600); err != nil {
+		undo()
+		return err
+	}
+
+	updated := *r.config
+	updated.Datastore.Spec = spec
+	if err := r.setConfigUnsynced(&updated); err != nil {
+		ioutil.WriteFile(fn, []byte(oldSpec), 0600)
+		undo()
+		return err
+	}
+	return os.Remove(stage)
+}
+
+func copyToNewDatastore(repoPath, stage string, oldDsc, newDsc DatastoreConfig, progress func(int)) error {
+	src, err := oldDsc.Create(repoPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := newDsc.Create(stage)
+	if err != nil {
+		return err
+	}
+
+	err = copyDatastore(src, dst, progress)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func copyDatastore(src, dst ds.Batching, progress func(int)) error {
+	res, err := src.Query(dsq.Query{})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	batch, err := dst.Batch()
+	if err != nil {
+		return err
+	}
+
+	copied := 0
+	for e := range res.Next() {
+		if e.Error != nil {
+			return e.Error
+		}
+		if err := batch.Put(ds.NewKey(e.Key), e.Value); err != nil {
+			return err
+		}
+
+		copied++
+		if copied%convertBatchSize == 0 {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			if batch, err = dst.Batch(); err != nil {
+				return err
+			}
+			if progress != nil {
+				progress(copied)
+			}
+		}
+	}
+
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(copied)
+	}
+	return nil
+}
+
+// moveConvertedFiles moves the files of the new datastore from the staging
+// directory to the repo, moving files with the same name to the backup
+// directory. The returned function undoes the moves done so far.
+func moveConvertedFiles(repoPath, stage, backup string) (undo func(), err error) {
+	type move struct{ from, to string }
+	var done []move
+
+	undo = func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := os.Rename(done[i].to, done[i].from); err != nil {
+				log.Errorf("failed to restore %s: %s", done[i].from, err)
+			}
+		}
+		os.RemoveAll(stage)
+		os.Remove(backup)
+	}
+
+	entries, err := ioutil.ReadDir(stage)
+	if err != nil {
+		return undo, err
+	}
+
+	for _, e := range entries {
+		dst := filepath.Join(repoPath, e.Name())
+		if util.FileExists(dst) {
+			if err := os.MkdirAll(backup, 0755); err != nil {
+				return undo, err
+			}
+			old := filepath.Join(backup, e.Name())
+			if err := os.Rename(dst, old); err != nil {
+				return undo, err
+			}
+			done = append(done, move{dst, old})
+		}
+
+		if err := os.Rename(filepath.Join(stage, e.Name()), dst); err != nil {
+			return undo, err
+		}
+		done = append(done, move{filepath.Join(stage, e.Name()), dst})
+	}
+
+	return undo, nil
+}
@@ -56,10 +56,12 @@ var datastores map[string]ConfigFromMap
 
 func init() {
 	datastores = map[string]ConfigFromMap{
-		"mount":   MountDatastoreConfig,
-		"mem":     MemDatastoreConfig,
-		"log":     LogDatastoreConfig,
-		"measure": MeasureDatastoreConfig,
+		"mount":     MountDatastoreConfig,
+		"mem":       MemDatastoreConfig,
+		"log":       LogDatastoreConfig,
+		"measure":   MeasureDatastoreConfig,
+		"encrypted": EncryptedDatastoreConfig,
+		"tiered":    TieredDatastoreConfig,
 	}
 }
 
@@ -14,6 +14,8 @@
 //   │   └── ipfs-daemon.memprof
 //   ├── datastore/
 //   ├── repo.lock                <------ protects datastore/ and config
+//   ├── repo.shared.lock         <------ held by read-only processes
+//   ├── repos/                   <------ named repos served by the daemon
 //   └── version
 package fsrepo
 
@@ -0,0 +1,177 @@
+package fsrepo
+
+import (
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+	common "github.com/ipfs/go-ipfs/repo/common"
+	encds "github.com/ipfs/go-ipfs/thirdparty/encds"
+
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+)
+
+const (
+	// EnvRepoKey holds the key of encrypted repos, hex encoded.
+	EnvRepoKey = "IPFS_REPO_KEY"
+
+	// EnvRepoKeyFile is the path of a file holding the key of encrypted
+	// repos, hex encoded. It's used when EnvRepoKey isn't set.
+	EnvRepoKeyFile = "IPFS_REPO_KEY_FILE"
+)
+
+// repoCipher returns the cipher built from the repo key supplied in the
+// environment.
+func repoCipher() (cipher.AEAD, error) {
+	encoded := os.Getenv(EnvRepoKey)
+	if encoded == "" {
+		fn := os.Getenv(EnvRepoKeyFile)
+		if fn == "" {
+			return nil, fmt.Errorf("the repo is encrypted, set %s or %s to its key", EnvRepoKey, EnvRepoKeyFile)
+		}
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(b)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid repo key: %s", err)
+	}
+	return encds.NewCipher(key)
+}
+
+// isEncrypted reports whether a datastore spec encrypts some of the
+// datastore.
+func isEncrypted(spec map[string]interface{}) bool {
+	if spec["type"] == "encrypted" {
+		return true
+	}
+	for _, field := range []string{"child", "hot", "cold"} {
+		if child, ok := spec[field].(map[string]interface{}); ok && isEncrypted(child) {
+			return true
+		}
+	}
+	mounts, _ := spec["mounts"].([]interface{})
+	for _, m := range mounts {
+		if m, ok := m.(map[string]interface{}); ok && isEncrypted(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptedPrivKeyPrefix prefixes the private key of the identity in the
+// config file of encrypted repos, where it's stored sealed with the repo key.
+const encryptedPrivKeyPrefix = "encrypted:"
+
+func isPrivKeyEncrypted(privKey string) bool {
+	return strings.HasPrefix(privKey, encryptedPrivKeyPrefix)
+}
+
+// sealPrivKey encrypts the private key of the identity, as stored in the
+// config. The key is authenticated as the one of the identity, it can't be
+// moved to another field of the config.
+func sealPrivKey(aead cipher.AEAD, privKey string) (string, error) {
+	if privKey == "" || isPrivKeyEncrypted(privKey) {
+		return privKey, nil
+	}
+	sealed, err := encds.Seal(aead, []byte(privKey), []byte(config.PrivKeySelector))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrivKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openPrivKey decrypts the private key of the identity sealed by
+// sealPrivKey, and returns the other keys unchanged.
+func openPrivKey(aead cipher.AEAD, privKey string) (string, error) {
+	if !isPrivKeyEncrypted(privKey) {
+		return privKey, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(privKey, encryptedPrivKeyPrefix))
+	if err != nil {
+		return "", encds.ErrDecrypt
+	}
+	data, err := encds.Open(aead, sealed, []byte(config.PrivKeySelector))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// sealConfigMap encrypts the private key of the identity of a config read as
+// a map.
+func sealConfigMap(aead cipher.AEAD, mapconf map[string]interface{}) error {
+	return mapPrivKey(mapconf, func(privKey string) (string, error) {
+		return sealPrivKey(aead, privKey)
+	})
+}
+
+// openConfigMap decrypts the private key of the identity of a config read as
+// a map.
+func openConfigMap(aead cipher.AEAD, mapconf map[string]interface{}) error {
+	return mapPrivKey(mapconf, func(privKey string) (string, error) {
+		return openPrivKey(aead, privKey)
+	})
+}
+
+func mapPrivKey(mapconf map[string]interface{}, f func(string) (string, error)) error {
+	v, err := common.MapGetKV(mapconf, config.PrivKeySelector)
+	if err != nil {
+		// no identity
+		return nil
+	}
+	privKey, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("%s is not a string", config.PrivKeySelector)
+	}
+	privKey, err = f(privKey)
+	if err != nil {
+		return err
+	}
+	return common.MapSetKV(mapconf, config.PrivKeySelector, privKey)
+}
+
+type encryptedDatastoreConfig struct {
+	child DatastoreConfig
+}
+
+// EncryptedDatastoreConfig returns an encrypted DatastoreConfig from a spec
+func EncryptedDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	childField, ok := params["child"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'child' field is missing or not a map")
+	}
+	child, err := AnyDatastoreConfig(childField)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedDatastoreConfig{child}, nil
+}
+
+func (c *encryptedDatastoreConfig) DiskSpec() DiskSpec {
+	return map[string]interface{}{
+		"type":  "encrypted",
+		"child": map[string]interface{}(c.child.DiskSpec()),
+	}
+}
+
+func (c *encryptedDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	aead, err := repoCipher()
+	if err != nil {
+		return nil, err
+	}
+	child, err := c.child.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return encds.New(child, aead), nil
+}
@@ -0,0 +1,80 @@
+package fsrepo
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+)
+
+func TestEncryptedPrivKey(t *testing.T) {
+	os.Setenv(EnvRepoKey, strings.Repeat("01", 32))
+	defer os.Unsetenv(EnvRepoKey)
+
+	path := testRepoPath("encrypted", t)
+	defer os.RemoveAll(path)
+
+	const privKey = "cHJpdmF0ZSBrZXk="
+	conf := &config.Config{
+		Identity: config.Identity{PeerID: "QmPeer", PrivKey: privKey},
+		Datastore: config.Datastore{
+			Spec: map[string]interface{}{
+				"type":  "encrypted",
+				"child": map[string]interface{}{"type": "mem"},
+			},
+		},
+	}
+	if err := Init(path, conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.Identity.PrivKey != privKey {
+		t.Fatal("expected Init to leave the config given unchanged")
+	}
+
+	configFilename, err := config.Filename(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSealed := func() {
+		data, err := ioutil.ReadFile(configFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), privKey) || !strings.Contains(string(data), encryptedPrivKeyPrefix) {
+			t.Fatalf("expected the private key to be encrypted in the config file:\n%s", data)
+		}
+	}
+	checkSealed()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Identity.PrivKey != privKey {
+		t.Fatalf("expected the private key to be decrypted, got %q", cfg.Identity.PrivKey)
+	}
+	if v, err := r.GetConfigKey(config.PrivKeySelector); err != nil || v != privKey {
+		t.Fatalf("expected the private key to be decrypted, got %v, %v", v, err)
+	}
+
+	if err := r.SetConfigKey("Gateway.RootRedirect", "/ipfs/QmRoot"); err != nil {
+		t.Fatal(err)
+	}
+	checkSealed()
+	if cfg, _ := r.Config(); cfg.Identity.PrivKey != privKey {
+		t.Fatalf("expected the private key to stay decrypted, got %q", cfg.Identity.PrivKey)
+	}
+
+	if err := r.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkSealed()
+}
@@ -0,0 +1,18 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package fsrepo
+
+import (
+	"errors"
+	"io"
+)
+
+// Shared locks aren't implemented on this platform, so repos can't be opened
+// read-only.
+const supportsSharedLock = false
+
+var errWouldBlock = errors.New("file is locked")
+
+func flock(fn string, exclusive bool) (io.Closer, error) {
+	return nil, errors.New("file locking isn't supported on this platform")
+}
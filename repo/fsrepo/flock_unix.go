@@ -0,0 +1,36 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package fsrepo
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+const supportsSharedLock = true
+
+var errWouldBlock = errors.New("file is locked")
+
+// flock locks the file fn, creating it if needed. The lock is released when
+// the returned closer is closed.
+func flock(fn string, exclusive bool) (io.Closer, error) {
+	f, err := os.OpenFile(fn, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errWouldBlock
+		}
+		return nil, err
+	}
+	return f, nil
+}
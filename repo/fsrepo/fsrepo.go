@@ -1,6 +1,7 @@
 package fsrepo
 
 import (
+	"crypto/cipher"
 	"errors"
 	"fmt"
 	"io"
@@ -17,6 +18,7 @@ import (
 	"github.com/ipfs/go-ipfs/repo/common"
 	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 	dir "github.com/ipfs/go-ipfs/thirdparty/dir"
+	dsmetrics "github.com/ipfs/go-ipfs/thirdparty/dsmetrics"
 
 	util "gx/ipfs/QmNohiVssaPw3KVLZik59DBVGTSm2dGvYT9eoXt5DQ36Yz/go-ipfs-util"
 	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
@@ -99,10 +101,16 @@ type FSRepo struct {
 	// lockfile is the file system lock to prevent others from opening
 	// the same fsrepo path concurrently
 	lockfile io.Closer
+	// readOnly is set when the repo was opened with OpenReadOnly
+	readOnly bool
 	config   *config.Config
 	ds       repo.Datastore
 	keystore keystore.Keystore
 	filemgr  *filestore.FileManager
+
+	// aead encrypts the private key in the config and the keystore of
+	// encrypted repos, nil for the others
+	aead cipher.AEAD
 }
 
 var _ repo.Repo = (*FSRepo)(nil)
@@ -111,12 +119,12 @@ var _ repo.Repo = (*FSRepo)(nil)
 // initialized.
 func Open(repoPath string) (repo.Repo, error) {
 	fn := func() (repo.Repo, error) {
-		return open(repoPath)
+		return open(repoPath, false)
 	}
 	return onlyOne.Open(repoPath, fn)
 }
 
-func open(repoPath string) (repo.Repo, error) {
+func open(repoPath string, readOnly bool) (repo.Repo, error) {
 	packageLock.Lock()
 	defer packageLock.Unlock()
 
@@ -130,10 +138,15 @@ func open(repoPath string) (repo.Repo, error) {
 		return nil, err
 	}
 
-	r.lockfile, err = lockfile.Lock(r.path, LockFile)
+	if readOnly {
+		r.lockfile, err = lockShared(r.path, false)
+	} else {
+		r.lockfile, err = lockfile.Lock(r.path, LockFile)
+	}
 	if err != nil {
 		return nil, err
 	}
+	r.readOnly = readOnly
 	keepLocked := false
 	defer func() {
 		// unlock on error, leave it locked on success
@@ -159,8 +172,10 @@ func open(repoPath string) (repo.Repo, error) {
 	}
 
 	// check repo path, then check all constituent parts.
-	if err := dir.Writable(r.path); err != nil {
-		return nil, err
+	if !readOnly {
+		if err := dir.Writable(r.path); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := r.openConfig(); err != nil {
@@ -242,6 +257,20 @@ func initConfig(path string, conf *config.Config) error {
 	if err != nil {
 		return err
 	}
+	// The private key is encrypted with the datastore.
+	if isEncrypted(conf.Datastore.Spec) {
+		aead, err := repoCipher()
+		if err != nil {
+			return err
+		}
+		sealed := *conf
+		sealed.Identity.PrivKey, err = sealPrivKey(aead, conf.Identity.PrivKey)
+		if err != nil {
+			return err
+		}
+		conf = &sealed
+	}
+
 	// initialization is the one time when it's okay to write to the config
 	// without reading the config from disk and merging any user-provided keys
 	// that may exist.
@@ -359,6 +388,10 @@ func (r *FSRepo) Path() string {
 
 // SetAPIAddr writes the API Addr to the /api file.
 func (r *FSRepo) SetAPIAddr(addr ma.Multiaddr) error {
+	if r.readOnly {
+		return repo.ErrReadOnly
+	}
+
 	f, err := os.Create(filepath.Join(r.path, apiFile))
 	if err != nil {
 		return err
@@ -379,17 +412,85 @@ func (r *FSRepo) openConfig() error {
 	if err != nil {
 		return err
 	}
+
+	// The private key is encrypted with the datastore. It's encrypted, or
+	// decrypted, the first time the repo is opened after its datastore was.
+	encrypted := isEncrypted(conf.Datastore.Spec)
+	if encrypted || isPrivKeyEncrypted(conf.Identity.PrivKey) {
+		aead, err := repoCipher()
+		if err != nil {
+			return err
+		}
+		if encrypted {
+			r.aead = aead
+		}
+		if encrypted != isPrivKeyEncrypted(conf.Identity.PrivKey) && !r.readOnly {
+			var mapconf map[string]interface{}
+			if err := serialize.ReadConfigFile(configFilename, &mapconf); err != nil {
+				return err
+			}
+			if encrypted {
+				err = sealConfigMap(aead, mapconf)
+			} else {
+				err = openConfigMap(aead, mapconf)
+			}
+			if err != nil {
+				return err
+			}
+			if err := serialize.WriteConfigFile(configFilename, mapconf); err != nil {
+				return err
+			}
+		}
+		conf.Identity.PrivKey, err = openPrivKey(aead, conf.Identity.PrivKey)
+		if err != nil {
+			return err
+		}
+	}
 	r.config = conf
 	return nil
 }
 
+// openPrivKey decrypts the private key of the identity of conf, read from
+// the config file, if it's encrypted.
+func (r *FSRepo) openPrivKey(conf *config.Config) error {
+	if !isPrivKeyEncrypted(conf.Identity.PrivKey) {
+		return nil
+	}
+	aead := r.aead
+	if aead == nil {
+		var err error
+		aead, err = repoCipher()
+		if err != nil {
+			return err
+		}
+	}
+	privKey, err := openPrivKey(aead, conf.Identity.PrivKey)
+	if err != nil {
+		return err
+	}
+	conf.Identity.PrivKey = privKey
+	return nil
+}
+
 func (r *FSRepo) openKeystore() error {
 	ksp := filepath.Join(r.path, "keystore")
-	ks, err := keystore.NewFSKeystore(ksp)
+
+	// The keystore is encrypted with the datastore.
+	var ks *keystore.FSKeystore
+	var err error
+	if isEncrypted(r.config.Datastore.Spec) {
+		ks, err = keystore.NewEncryptedFSKeystore(ksp, r.aead)
+	} else {
+		ks, err = keystore.NewFSKeystore(ksp)
+	}
 	if err != nil {
 		return err
 	}
 
+	if r.readOnly {
+		r.keystore = readOnlyKeystore{ks}
+		return nil
+	}
 	r.keystore = ks
 
 	return nil
@@ -421,7 +522,15 @@ func (r *FSRepo) openDatastore() error {
 			oldSpec, spec.String())
 	}
 
-	d, err := dsc.Create(r.path)
+	var d repo.Datastore
+	if r.readOnly {
+		d, err = createReadOnly(dsc, r.path)
+		if err == nil {
+			d = readOnlyDatastore{d}
+		}
+	} else {
+		d, err = dsc.Create(r.path)
+	}
 	if err != nil {
 		return err
 	}
@@ -431,6 +540,14 @@ func (r *FSRepo) openDatastore() error {
 	prefix := "ipfs.fsrepo.datastore"
 	r.ds = measure.New(prefix, r.ds)
 
+	// and with metrics by key namespace
+	mds, err := dsmetrics.New(r.ds)
+	if err != nil {
+		r.ds.Close()
+		return err
+	}
+	r.ds = mds
+
 	return nil
 }
 
@@ -446,6 +563,14 @@ func (r *FSRepo) readSpec() (string, error) {
 	return strings.TrimSpace(string(b)), nil
 }
 
+func (r *FSRepo) writeSpec(spec DiskSpec) error {
+	fn, err := config.Path(r.path, specFn)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, spec.Bytes(), 0600)
+}
+
 // Close closes the FSRepo, releasing held resources.
 func (r *FSRepo) Close() error {
 	packageLock.Lock()
@@ -455,9 +580,13 @@ func (r *FSRepo) Close() error {
 		return errors.New("repo is closed")
 	}
 
-	err := os.Remove(filepath.Join(r.path, apiFile))
-	if err != nil && !os.IsNotExist(err) {
-		log.Warning("error removing api file: ", err)
+	// The api file belongs to the process which has the repo open for
+	// writing.
+	if !r.readOnly {
+		err := os.Remove(filepath.Join(r.path, apiFile))
+		if err != nil && !os.IsNotExist(err) {
+			log.Warning("error removing api file: ", err)
+		}
 	}
 
 	if err := r.ds.Close(); err != nil {
@@ -498,6 +627,10 @@ func (r *FSRepo) FileManager() *filestore.FileManager {
 }
 
 func (r *FSRepo) BackupConfig(prefix string) (string, error) {
+	if r.readOnly {
+		return "", repo.ErrReadOnly
+	}
+
 	temp, err := ioutil.TempFile(r.path, "config-"+prefix)
 	if err != nil {
 		return "", err
@@ -525,6 +658,9 @@ func (r *FSRepo) BackupConfig(prefix string) (string, error) {
 
 // setConfigUnsynced is for private use.
 func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
+	if r.readOnly {
+		return repo.ErrReadOnly
+	}
 	configFilename, err := config.Filename(r.path)
 	if err != nil {
 		return err
@@ -540,8 +676,11 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	if err != nil {
 		return err
 	}
-	for k, v := range m {
-		mapconf[k] = v
+	mergeConfigMap(mapconf, m)
+	if r.aead != nil {
+		if err := sealConfigMap(r.aead, mapconf); err != nil {
+			return err
+		}
 	}
 	if err := serialize.WriteConfigFile(configFilename, mapconf); err != nil {
 		return err
@@ -550,6 +689,25 @@ func (r *FSRepo) setConfigUnsynced(updated *config.Config) error {
 	return nil
 }
 
+// mergeConfigMap writes the values of src to dst. The sections present in
+// both are merged recursively, so that the keys of dst unknown to the config
+// struct src was made from are kept.
+func mergeConfigMap(dst, src map[string]interface{}) {
+	for k, v := range src {
+		vm, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dm, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		mergeConfigMap(dm, vm)
+	}
+}
+
 // SetConfig updates the FSRepo's config.
 func (r *FSRepo) SetConfig(updated *config.Config) error {
 
@@ -560,6 +718,33 @@ func (r *FSRepo) SetConfig(updated *config.Config) error {
 	return r.setConfigUnsynced(updated)
 }
 
+// ReloadConfig re-reads the config file, picking up changes made to it since
+// the repo was opened. The config is swapped in whole, so that the configs
+// returned before are left as they were rather than changed under their
+// readers.
+func (r *FSRepo) ReloadConfig() error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	if r.closed {
+		return errors.New("repo is closed")
+	}
+
+	configFilename, err := config.Filename(r.path)
+	if err != nil {
+		return err
+	}
+	conf, err := serialize.Load(configFilename)
+	if err != nil {
+		return err
+	}
+	if err := r.openPrivKey(conf); err != nil {
+		return err
+	}
+	r.config = conf
+	return nil
+}
+
 // GetConfigKey retrieves only the value of a particular key.
 func (r *FSRepo) GetConfigKey(key string) (interface{}, error) {
 	packageLock.Lock()
@@ -577,6 +762,11 @@ func (r *FSRepo) GetConfigKey(key string) (interface{}, error) {
 	if err := serialize.ReadConfigFile(filename, &cfg); err != nil {
 		return nil, err
 	}
+	if r.aead != nil {
+		if err := openConfigMap(r.aead, cfg); err != nil {
+			return nil, err
+		}
+	}
 	return common.MapGetKV(cfg, key)
 }
 
@@ -588,6 +778,9 @@ func (r *FSRepo) SetConfigKey(key string, value interface{}) error {
 	if r.closed {
 		return errors.New("repo is closed")
 	}
+	if r.readOnly {
+		return repo.ErrReadOnly
+	}
 
 	filename, err := config.Filename(r.path)
 	if err != nil {
@@ -660,6 +853,9 @@ func (r *FSRepo) SetConfigKey(key string, value interface{}) error {
 	if err := serialize.WriteConfigFile(filename, mapconf); err != nil {
 		return err
 	}
+	if err := r.openPrivKey(conf); err != nil {
+		return err
+	}
 	return r.setConfigUnsynced(conf) // TODO roll this into this method
 }
 
@@ -693,6 +889,25 @@ func (r *FSRepo) SwarmKey() ([]byte, error) {
 	return ioutil.ReadAll(f)
 }
 
+// SetSwarmKey replaces the shared key of the private network of the repo.
+// The key is written to a temporary file first, so the repo keeps the old
+// key or the new one whatever happens.
+func (r *FSRepo) SetSwarmKey(key []byte) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	spath := filepath.Join(filepath.Clean(r.path), swarmKeyFile)
+	tmp := spath + ".tmp"
+	if err := ioutil.WriteFile(tmp, key, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, spath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
 var _ io.Closer = &FSRepo{}
 var _ repo.Repo = &FSRepo{}
 
@@ -116,3 +116,66 @@ func TestOpenMoreThanOnceInSameProcess(t *testing.T) {
 	assert.Nil(r1.Close(), t)
 	assert.Nil(r2.Close(), t)
 }
+
+func TestOpenReadOnlyWhileLocked(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("", t)
+	assert.Nil(Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}), t)
+
+	r, err := Open(path)
+	assert.Nil(err, t, "repo should open successfully")
+
+	k := datastore.NewKey("/blocks/KEY")
+	expected := []byte("value")
+	assert.Nil(r.Datastore().Put(k, expected), t, "Put should be successful")
+
+	ro1, err := OpenReadOnly(path)
+	assert.Nil(err, t, "repo should open read-only while locked")
+	ro2, err := OpenReadOnly(path)
+	assert.Nil(err, t, "repo should open read-only twice")
+
+	actual, err := ro1.Datastore().Get(k)
+	assert.Nil(err, t, "Get should be successful")
+	assert.True(bytes.Equal(expected, actual), t, "data should match")
+
+	assert.Err(ro1.Datastore().Put(k, expected), t, "Put should fail")
+	assert.Err(ro1.SetConfigKey("Datastore.StorageMax", "1GB"), t, "SetConfigKey should fail")
+
+	assert.Nil(r.Close(), t)
+	assert.Err(CompactDatastore(path, nil), t, "compaction should fail while open read-only")
+
+	assert.Nil(ro1.Close(), t)
+	assert.Nil(ro2.Close(), t)
+	assert.Nil(CompactDatastore(path, nil), t, "compaction should succeed once closed")
+}
+
+func TestSetConfigKeepsUnknownKeys(t *testing.T) {
+	t.Parallel()
+	path := testRepoPath("", t)
+	defer os.RemoveAll(path)
+	assert.Nil(Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}), t)
+	r, err := Open(path)
+	assert.Nil(err, t)
+	defer r.Close()
+
+	// a key the config struct doesn't know about, in a known section
+	assert.Nil(r.SetConfigKey("Gateway.RateLimit.Burst", 10), t)
+
+	// as done by 'ipfs bootstrap add'
+	cfg, err := r.Config()
+	assert.Nil(err, t)
+	updated := *cfg
+	updated.Bootstrap = append(updated.Bootstrap, "/ip4/127.0.0.1/tcp/4001/ipfs/QmSoLnSGccFuZQJzRadHn95W2CrSFmZuTdDWP8HXaHca9z")
+	assert.Nil(r.SetConfig(&updated), t)
+
+	burst, err := r.GetConfigKey("Gateway.RateLimit.Burst")
+	assert.Nil(err, t)
+	if burst != float64(10) {
+		t.Fatalf("expected Gateway.RateLimit.Burst to be kept, got %v", burst)
+	}
+	bootstrap, err := r.GetConfigKey("Bootstrap")
+	assert.Nil(err, t)
+	if peers, ok := bootstrap.([]interface{}); !ok || len(peers) != len(updated.Bootstrap) {
+		t.Fatalf("expected the bootstrap peer to be added, got %v", bootstrap)
+	}
+}
@@ -0,0 +1,117 @@
+package fsrepo
+
+import (
+	"fmt"
+
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	serialize "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config/serialize"
+	lockfile "gx/ipfs/QmcWjZkQxyPMkgZRpda4hqWwaD6E1yqCvcxZfxbt98CEAK/go-fs-lock"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// CanMigrate reports whether the repo at repoPath can be upgraded to
+// RepoVersion by Migrate, i.e., without the fs-repo-migrations binary.
+func CanMigrate(repoPath string) bool {
+	r, err := newFSRepo(repoPath)
+	if err != nil {
+		return false
+	}
+	ver, err := mfsr.RepoPath(r.path).Version()
+	if err != nil {
+		return false
+	}
+	return ver < RepoVersion && mfsr.HasEmbedded(ver, RepoVersion)
+}
+
+// Migrate upgrades the repo at repoPath to RepoVersion in-process, with the
+// migrations embedded in go-ipfs. If a migration fails, the repo is rolled
+// back to its original version. progress, if not nil, is called with
+// messages describing the migrations being run.
+//
+// Programs embedding go-ipfs can call it when Open returns
+// ErrNeedMigration, before opening the repo again.
+func Migrate(repoPath string, progress func(string)) error {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	r, err := newFSRepo(repoPath)
+	if err != nil {
+		return err
+	}
+	if err := checkInitialized(r.path); err != nil {
+		return err
+	}
+
+	lk, err := lockfile.Lock(r.path, LockFile)
+	if err != nil {
+		return err
+	}
+	defer lk.Close()
+
+	slk, err := lockShared(r.path, true)
+	if err != nil {
+		return err
+	}
+	defer slk.Close()
+
+	return mfsr.RunEmbedded(r.path, RepoVersion, progress)
+}
+
+func init() {
+	mfsr.Register(&mfsr.Migration{From: 6, Apply: dropProviderRecords})
+}
+
+// providersPrefix is the namespace of the provider records the DHT keeps in
+// the datastore.
+const providersPrefix = "/providers/"
+
+// dropProviderRecords is the 6-to-7 migration: the DHT of repo version 7
+// keys its provider records differently, so those of version 6 are dropped.
+// They only cache the records published by other peers, which republish them
+// at least every 24 hours, so the migration isn't reverted.
+func dropProviderRecords(repoPath string, progress func(string)) error {
+	configFilename, err := config.Filename(repoPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := serialize.Load(configFilename)
+	if err != nil {
+		return err
+	}
+	dsc, err := AnyDatastoreConfig(cfg.Datastore.Spec)
+	if err != nil {
+		return err
+	}
+	d, err := dsc.Create(repoPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	res, err := d.Query(dsq.Query{Prefix: providersPrefix, KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+
+	b, err := d.Batch()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := b.Delete(ds.NewKey(e.Key)); err != nil {
+			return err
+		}
+	}
+	if err := b.Commit(); err != nil {
+		return err
+	}
+	progress(fmt.Sprintf("dropped %d provider records", len(entries)))
+	return nil
+}
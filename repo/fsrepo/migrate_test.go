@@ -0,0 +1,56 @@
+package fsrepo
+
+import (
+	"os"
+	"testing"
+
+	mfsr "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+
+	config "gx/ipfs/QmYyzmMnhNTtoXx5ttgUaRdHHckYnQWjPL98hgLAR2QLDD/go-ipfs-config"
+	datastore "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+)
+
+func TestMigrateDropsProviderRecords(t *testing.T) {
+	path := testRepoPath("migrate", t)
+	defer os.RemoveAll(path)
+
+	if err := Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := datastore.NewKey("/providers/CIQA/CIQB")
+	kept := datastore.NewKey("/local/filesroot")
+	for _, k := range []datastore.Key{provider, kept} {
+		if err := r.Datastore().Put(k, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mfsr.RepoPath(path).WriteVersion(6); err != nil {
+		t.Fatal(err)
+	}
+	if !CanMigrate(path) {
+		t.Fatal("expected the repo of version 6 to be migrated in-process")
+	}
+	if err := Migrate(path, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if has, err := r.Datastore().Has(provider); err != nil || has {
+		t.Errorf("expected the provider record to be dropped, got %v, %v", has, err)
+	}
+	if has, err := r.Datastore().Has(kept); err != nil || !has {
+		t.Errorf("expected the other keys to be kept, got %v, %v", has, err)
+	}
+}
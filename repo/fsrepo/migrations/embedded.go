@@ -0,0 +1,194 @@
+package mfsr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Migration upgrades a repo by one version, in-process. Migrations embedded
+// in go-ipfs don't need the fs-repo-migrations binary.
+type Migration struct {
+	// From is the version the migration applies to. It upgrades the repo to
+	// version From+1.
+	From int
+
+	// Apply upgrades the repo at repoPath, reporting its progress with
+	// progress.
+	Apply func(repoPath string, progress func(string)) error
+
+	// Revert undoes Apply. It is also called when Apply fails, so it must
+	// cope with a partially applied migration. Migrations only changing
+	// the files restored by RunEmbedded (see rollbackFiles) don't need it.
+	Revert func(repoPath string, progress func(string)) error
+}
+
+var (
+	embeddedLk sync.Mutex
+	embedded   = make(map[int]*Migration)
+)
+
+// rollbackFiles are saved before running migrations, and restored if they
+// fail.
+var rollbackFiles = []string{VersionFile, "config", "datastore_spec"}
+
+// Register adds an embedded migration. It's meant to be called from init
+// functions, and panics if a migration from the same version exists.
+func Register(m *Migration) {
+	embeddedLk.Lock()
+	defer embeddedLk.Unlock()
+
+	if _, ok := embedded[m.From]; ok {
+		panic(fmt.Sprintf("migration %d-to-%d registered twice", m.From, m.From+1))
+	}
+	embedded[m.From] = m
+}
+
+// HasEmbedded reports whether the repo can be upgraded from version from to
+// version to with embedded migrations only.
+func HasEmbedded(from, to int) bool {
+	embeddedLk.Lock()
+	defer embeddedLk.Unlock()
+
+	for v := from; v < to; v++ {
+		if _, ok := embedded[v]; !ok {
+			return false
+		}
+	}
+	return from <= to
+}
+
+// EmbeddedVersions returns the versions embedded migrations upgrade from.
+func EmbeddedVersions() []int {
+	embeddedLk.Lock()
+	defer embeddedLk.Unlock()
+
+	var out []int
+	for v := range embedded {
+		out = append(out, v)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// RunEmbedded upgrades the repo at repoPath to version to with the embedded
+// migrations. If a migration fails, the migrations applied so far are
+// reverted and the repo is left at its original version.
+//
+// The caller must make sure the repo isn't used while migrating.
+func RunEmbedded(repoPath string, to int, progress func(string)) error {
+	if progress == nil {
+		progress = func(string) {}
+	}
+
+	rp := RepoPath(repoPath)
+	from, err := rp.Version()
+	if err != nil {
+		return err
+	}
+	if from > to {
+		return fmt.Errorf("repo version %d is newer than %d, reverting it isn't supported", from, to)
+	}
+	if !HasEmbedded(from, to) {
+		return fmt.Errorf("no embedded migrations from version %d to %d", from, to)
+	}
+
+	saved, err := saveFiles(repoPath, rollbackFiles)
+	if err != nil {
+		return err
+	}
+
+	embeddedLk.Lock()
+	var steps []*Migration
+	for v := from; v < to; v++ {
+		steps = append(steps, embedded[v])
+	}
+	embeddedLk.Unlock()
+
+	for i, m := range steps {
+		progress(fmt.Sprintf("running migration %d-to-%d", m.From, m.From+1))
+
+		err := m.Apply(repoPath, progress)
+		if err == nil {
+			err = rp.WriteVersion(m.From + 1)
+		}
+		if err != nil {
+			progress(fmt.Sprintf("migration %d-to-%d failed: %s", m.From, m.From+1, err))
+			rollback(repoPath, steps[:i+1], saved, progress)
+			return fmt.Errorf("migration %d-to-%d failed: %s", m.From, m.From+1, err)
+		}
+	}
+
+	progress(fmt.Sprintf("repo migrated to version %d", to))
+	return nil
+}
+
+// rollback reverts the given migrations, most recent first, and restores the
+// files saved before migrating.
+func rollback(repoPath string, steps []*Migration, saved map[string]*savedFile, progress func(string)) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		m := steps[i]
+		if m.Revert == nil {
+			continue
+		}
+		progress(fmt.Sprintf("reverting migration %d-to-%d", m.From, m.From+1))
+		if err := m.Revert(repoPath, progress); err != nil {
+			progress(fmt.Sprintf("failed to revert migration %d-to-%d: %s", m.From, m.From+1, err))
+		}
+	}
+
+	if err := restoreFiles(repoPath, saved); err != nil {
+		progress(fmt.Sprintf("failed to restore repo files: %s", err))
+	}
+}
+
+type savedFile struct {
+	data []byte
+	mode os.FileMode
+}
+
+// saveFiles reads the given files of the repo. Missing files are recorded as
+// nil, so that restoreFiles removes them.
+func saveFiles(repoPath string, names []string) (map[string]*savedFile, error) {
+	saved := make(map[string]*savedFile, len(names))
+	for _, name := range names {
+		fn := filepath.Join(repoPath, name)
+		fi, err := os.Stat(fn)
+		if os.IsNotExist(err) {
+			saved[name] = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		saved[name] = &savedFile{data: b, mode: fi.Mode()}
+	}
+	return saved, nil
+}
+
+func restoreFiles(repoPath string, saved map[string]*savedFile) error {
+	for name, f := range saved {
+		fn := filepath.Join(repoPath, name)
+		var err error
+		if f == nil {
+			err = os.Remove(fn)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = ioutil.WriteFile(fn, f.data, f.mode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
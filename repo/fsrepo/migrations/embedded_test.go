@@ -0,0 +1,138 @@
+package mfsr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withMigrations replaces the embedded migrations, until the returned
+// function is called.
+func withMigrations(ms ...*Migration) (restore func()) {
+	embeddedLk.Lock()
+	old := embedded
+	embedded = make(map[int]*Migration)
+	embeddedLk.Unlock()
+
+	for _, m := range ms {
+		Register(m)
+	}
+
+	return func() {
+		embeddedLk.Lock()
+		embedded = old
+		embeddedLk.Unlock()
+	}
+}
+
+func setConfig(data string) func(string, func(string)) error {
+	return func(repoPath string, _ func(string)) error {
+		return ioutil.WriteFile(filepath.Join(repoPath, "config"), []byte(data), 0600)
+	}
+}
+
+func readConfig(t *testing.T, repoPath string) string {
+	b, err := ioutil.ReadFile(filepath.Join(repoPath, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRunEmbedded(t *testing.T) {
+	rp := testVersionFile("embedded", t)
+	defer os.RemoveAll(string(rp))
+
+	if err := rp.WriteVersion(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(string(rp), "config"), []byte("v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer withMigrations(
+		&Migration{From: 1, Apply: setConfig("v2")},
+		&Migration{From: 2, Apply: setConfig("v3")},
+	)()
+
+	if HasEmbedded(1, 4) {
+		t.Fatal("expected no migration path to version 4")
+	}
+	if err := RunEmbedded(string(rp), 4, nil); err == nil {
+		t.Fatal("expected an error without a migration path")
+	}
+
+	var msgs []string
+	if err := RunEmbedded(string(rp), 3, func(m string) { msgs = append(msgs, m) }); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rp.Version(); v != 3 {
+		t.Fatalf("expected version 3, got %d", v)
+	}
+	if c := readConfig(t, string(rp)); c != "v3" {
+		t.Fatalf("expected config v3, got %q", c)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("unexpected progress messages: %q", msgs)
+	}
+}
+
+func TestRunEmbeddedRollback(t *testing.T) {
+	rp := testVersionFile("embedded", t)
+	defer os.RemoveAll(string(rp))
+
+	if err := rp.WriteVersion(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(string(rp), "config"), []byte("v1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	marker := filepath.Join(string(rp), "marker")
+	var reverted []int
+	defer withMigrations(
+		&Migration{
+			From: 1,
+			Apply: func(repoPath string, _ func(string)) error {
+				if err := ioutil.WriteFile(marker, nil, 0600); err != nil {
+					return err
+				}
+				return setConfig("v2")(repoPath, nil)
+			},
+			Revert: func(string, func(string)) error {
+				reverted = append(reverted, 1)
+				return os.Remove(marker)
+			},
+		},
+		&Migration{
+			From: 2,
+			Apply: func(repoPath string, _ func(string)) error {
+				setConfig("broken")(repoPath, nil)
+				return errors.New("boom")
+			},
+			Revert: func(string, func(string)) error {
+				reverted = append(reverted, 2)
+				return nil
+			},
+		},
+	)()
+
+	if err := RunEmbedded(string(rp), 3, nil); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+
+	if v, _ := rp.Version(); v != 1 {
+		t.Fatalf("expected version 1 after rollback, got %d", v)
+	}
+	if c := readConfig(t, string(rp)); c != "v1" {
+		t.Fatalf("expected config v1 after rollback, got %q", c)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatal("expected migration 1-to-2 to be reverted")
+	}
+	if len(reverted) != 2 || reverted[0] != 2 || reverted[1] != 1 {
+		t.Fatalf("expected migrations to be reverted in reverse order, got %v", reverted)
+	}
+}
@@ -0,0 +1,50 @@
+package fsrepo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// NamedReposDir is the directory holding the named repos served by the
+// daemon of a repo in addition to its own, relative to config dir. Each named
+// repo is an FSRepo of its own, with its own datastore, keys and config.
+const NamedReposDir = "repos"
+
+var validRepoName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// NamedRepoPath returns the path of the repo named name served along with the
+// repo at repoPath.
+func NamedRepoPath(repoPath, name string) (string, error) {
+	if !validRepoName.MatchString(name) {
+		return "", fmt.Errorf("invalid repo name %q: names are made of up to 64 letters, digits, '_', '-' and '.'", name)
+	}
+	return filepath.Join(repoPath, NamedReposDir, name), nil
+}
+
+// NamedRepos returns the sorted names of the initialized repos served along
+// with the repo at repoPath.
+func NamedRepos(repoPath string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(repoPath, NamedReposDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, fi := range infos {
+		if !fi.IsDir() || !validRepoName.MatchString(fi.Name()) {
+			continue
+		}
+		if IsInitialized(filepath.Join(repoPath, NamedReposDir, fi.Name())) {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,156 @@
+package fsrepo
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+
+	keystore "github.com/ipfs/go-ipfs/keystore"
+	repo "github.com/ipfs/go-ipfs/repo"
+	encds "github.com/ipfs/go-ipfs/thirdparty/encds"
+
+	ci "gx/ipfs/QmNiJiXwWE3kRhZrC5ej3kSjWHm337pYfhjLGSCDNKJP2s/go-libp2p-crypto"
+	measure "gx/ipfs/QmdCQgMgoMjur6D15ZB3z1LodiSP3L6EBHMyVx4ekqzRWA/go-ds-measure"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	mount "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/mount"
+)
+
+// SharedLockFile is the filename of the lock shared by the processes having
+// the repo open read-only, relative to config dir. Operations rewriting the
+// datastore (migrations, conversions and compaction) lock it exclusively.
+const SharedLockFile = "repo.shared.lock"
+
+// ReadOnlyConfig is implemented by the configs of datastores that can be
+// opened read-only while another process writes to them.
+type ReadOnlyConfig interface {
+	DatastoreConfig
+
+	// CreateReadOnly opens the existing datastore without writing to it or
+	// taking locks conflicting with the process using it.
+	CreateReadOnly(path string) (repo.Datastore, error)
+}
+
+// OpenReadOnly opens the FSRepo at path without taking the repo lock, so
+// that it can be used while another process, e.g. the daemon, has it open.
+// Any number of processes can open a repo read-only at the same time.
+//
+// Modifying the returned repo fails with repo.ErrReadOnly. Datastores which
+// can't be opened while another process uses them, such as leveldb and
+// badger, are replaced by empty in-memory datastores: the pins, IPNS records
+// and MFS root they hold aren't visible to read-only processes.
+func OpenReadOnly(repoPath string) (repo.Repo, error) {
+	return open(repoPath, true)
+}
+
+// lockShared takes the shared lock of the repo at repoPath, exclusively for
+// operations rewriting the datastore.
+func lockShared(repoPath string, exclusive bool) (io.Closer, error) {
+	if !supportsSharedLock {
+		if exclusive {
+			return nopCloser{}, nil
+		}
+		return nil, errors.New("opening the repo read-only isn't supported on this platform")
+	}
+
+	lk, err := flock(filepath.Join(repoPath, SharedLockFile), exclusive)
+	if err == errWouldBlock {
+		if exclusive {
+			return nil, errors.New("the repo is open read-only by another process, please close it first")
+		}
+		return nil, errors.New("the repo is being migrated or compacted, please try again later")
+	}
+	return lk, err
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// createReadOnly opens the datastore described by c read-only.
+func createReadOnly(c DatastoreConfig, path string) (repo.Datastore, error) {
+	if rc, ok := c.(ReadOnlyConfig); ok {
+		return rc.CreateReadOnly(path)
+	}
+
+	log.Warningf("datastore %s can't be shared with other processes, using an empty datastore in its place", c.DiskSpec())
+	return ds.NewMapDatastore(), nil
+}
+
+func (c *mountDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	mounts := make([]mount.Mount, len(c.mounts))
+	for i, m := range c.mounts {
+		ds, err := createReadOnly(m.ds, path)
+		if err != nil {
+			return nil, err
+		}
+		mounts[i].Datastore = ds
+		mounts[i].Prefix = m.prefix
+	}
+	return mount.New(mounts), nil
+}
+
+func (c *memDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	return c.Create(path)
+}
+
+func (c *logDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	child, err := createReadOnly(c.child, path)
+	if err != nil {
+		return nil, err
+	}
+	return ds.NewLogDatastore(child, c.name), nil
+}
+
+func (c *measureDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	child, err := createReadOnly(c.child, path)
+	if err != nil {
+		return nil, err
+	}
+	return measure.New(c.prefix, child), nil
+}
+
+func (c *encryptedDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	aead, err := repoCipher()
+	if err != nil {
+		return nil, err
+	}
+	child, err := createReadOnly(c.child, path)
+	if err != nil {
+		return nil, err
+	}
+	return encds.New(child, aead), nil
+}
+
+// readOnlyDatastore rejects the writes to a datastore.
+type readOnlyDatastore struct {
+	repo.Datastore
+}
+
+func (d readOnlyDatastore) Put(ds.Key, []byte) error {
+	return repo.ErrReadOnly
+}
+
+func (d readOnlyDatastore) Delete(ds.Key) error {
+	return repo.ErrReadOnly
+}
+
+func (d readOnlyDatastore) Batch() (ds.Batch, error) {
+	return nil, repo.ErrReadOnly
+}
+
+func (d readOnlyDatastore) DiskUsage() (uint64, error) {
+	return ds.DiskUsage(d.Datastore)
+}
+
+// readOnlyKeystore rejects the changes to a keystore.
+type readOnlyKeystore struct {
+	keystore.Keystore
+}
+
+func (ks readOnlyKeystore) Put(string, ci.PrivKey) error {
+	return repo.ErrReadOnly
+}
+
+func (ks readOnlyKeystore) Delete(string) error {
+	return repo.ErrReadOnly
+}
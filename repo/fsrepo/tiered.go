@@ -0,0 +1,103 @@
+package fsrepo
+
+import (
+	"fmt"
+
+	repo "github.com/ipfs/go-ipfs/repo"
+	tieredds "github.com/ipfs/go-ipfs/thirdparty/tieredds"
+
+	humanize "gx/ipfs/QmPSBJL4momYnE7DcUyk2DVhD6rH488ZmHBGLbxNdhU44K/go-humanize"
+)
+
+type tieredDatastoreConfig struct {
+	hot  DatastoreConfig
+	cold DatastoreConfig
+	opts tieredds.Options
+}
+
+// TieredDatastoreConfig returns a tiered DatastoreConfig from a spec
+func TieredDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	var c tieredDatastoreConfig
+	for _, tier := range []struct {
+		name string
+		conf *DatastoreConfig
+	}{{"hot", &c.hot}, {"cold", &c.cold}} {
+		field, ok := params[tier.name].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("'%s' field is missing or not a map", tier.name)
+		}
+		conf, err := AnyDatastoreConfig(field)
+		if err != nil {
+			return nil, err
+		}
+		*tier.conf = conf
+	}
+
+	maxSize, ok := params["hotMaxSize"].(string)
+	if !ok {
+		return nil, fmt.Errorf("'hotMaxSize' field is missing or not a string")
+	}
+	max, err := humanize.ParseBytes(maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'hotMaxSize': %s", err)
+	}
+	c.opts.HotMaxSize = max
+
+	c.opts.PromoteAfter = 1
+	if pa, ok := params["promoteAfter"]; ok {
+		n, ok := pa.(float64)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("'promoteAfter' field was not a positive number")
+		}
+		c.opts.PromoteAfter = int(n)
+	}
+
+	return &c, nil
+}
+
+func (c *tieredDatastoreConfig) DiskSpec() DiskSpec {
+	return map[string]interface{}{
+		"type": "tiered",
+		"hot":  map[string]interface{}(c.hot.DiskSpec()),
+		"cold": map[string]interface{}(c.cold.DiskSpec()),
+	}
+}
+
+func (c *tieredDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	hot, err := c.hot.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := c.cold.Create(path)
+	if err != nil {
+		hot.Close()
+		return nil, err
+	}
+	return tieredds.New(hot, cold, c.opts), nil
+}
+
+// CreateReadOnly opens both datastores without moving values between them.
+func (c *tieredDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	hot, err := createReadOnly(c.hot, path)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := createReadOnly(c.cold, path)
+	if err != nil {
+		hot.Close()
+		return nil, err
+	}
+	return tieredds.New(hot, cold, tieredds.Options{}), nil
+}
+
+func (c *tieredDatastoreConfig) Compact(path string, progress func(string)) error {
+	progress("compacting the hot datastore")
+	if err := compactChild(c.hot, path, progress); err != nil {
+		return fmt.Errorf("compacting the hot datastore: %s", err)
+	}
+	progress("compacting the cold datastore")
+	if err := compactChild(c.cold, path, progress); err != nil {
+		return fmt.Errorf("compacting the cold datastore: %s", err)
+	}
+	return nil
+}
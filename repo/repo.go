@@ -14,6 +14,9 @@ import (
 
 var (
 	ErrApiNotRunning = errors.New("api not running")
+
+	// ErrReadOnly is returned when modifying a repo opened read-only.
+	ErrReadOnly = errors.New("repo is opened read-only")
 )
 
 // Repo represents all persistent data of a given ipfs node.
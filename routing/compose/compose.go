@@ -0,0 +1,355 @@
+// Package compose composes routing systems: queried all at once, one after
+// the other until one answers, or by tiers each given some time to answer
+// before the next is queried too.
+//
+// The records and announcements are put to all the routing systems whatever
+// the mode, only the lookups depend on it.
+package compose
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	ropts "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing/options"
+	discovery "gx/ipfs/QmRBaUEQEeFWywfrZJ64QgsmvcqgLSK3VbvGMR2NM2Edpf/go-libp2p/p2p/discovery"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	record "gx/ipfs/QmfARXVCzpwFXQdepAJZuqyNDgV9doEsMnVCo1ssmuSe1U/go-libp2p-record"
+)
+
+var log = logging.Logger("routing/compose")
+
+// Mode is how the routing systems composed are queried.
+type Mode int
+
+const (
+	// Parallel queries all the routing systems at once
+	Parallel Mode = iota
+
+	// Sequential queries the routing systems one after the other, until one
+	// answers
+	Sequential
+
+	// Tiered queries the routing systems one after the other, each being
+	// queried once the previous ones answered nothing, or didn't answer in
+	// time
+	Tiered
+)
+
+// DefaultDelay is the time the tiers are given to answer when Router.Delay
+// isn't set.
+var DefaultDelay = time.Second
+
+// Router is a routing system composing several others.
+type Router struct {
+	Routers []routing.IpfsRouting
+	Mode    Mode
+
+	// Delay is the time each tier is given to answer in the Tiered mode
+	Delay time.Duration
+
+	// Validator selects the best of the records found by several routing
+	// systems
+	Validator record.Validator
+}
+
+func (r *Router) delay() time.Duration {
+	if r.Delay > 0 {
+		return r.Delay
+	}
+	return DefaultDelay
+}
+
+// run queries the routing systems with query, as the mode tells, and returns
+// once the queries are over. query returns true if the routing system
+// answered, which stops the next ones from being queried but in the Parallel
+// mode.
+func (r *Router) run(ctx context.Context, query func(context.Context, routing.IpfsRouting) bool) {
+	if r.Mode == Sequential {
+		for _, rt := range r.Routers {
+			if query(ctx, rt) || ctx.Err() != nil {
+				return
+			}
+		}
+		return
+	}
+
+	done := make(chan bool, len(r.Routers))
+	running := 0
+	answered := false
+launch:
+	for i, rt := range r.Routers {
+		running++
+		go func(rt routing.IpfsRouting) {
+			done <- query(ctx, rt)
+		}(rt)
+		if r.Mode != Tiered || i == len(r.Routers)-1 {
+			continue
+		}
+
+		timer := time.NewTimer(r.delay())
+	tier:
+		for {
+			select {
+			case ok := <-done:
+				running--
+				answered = answered || ok
+				if answered {
+					timer.Stop()
+					break launch
+				}
+				if running == 0 {
+					timer.Stop()
+					break tier
+				}
+			case <-timer.C:
+				break tier
+			case <-ctx.Done():
+				timer.Stop()
+				break launch
+			}
+		}
+	}
+	for ; running > 0; running-- {
+		<-done
+	}
+}
+
+// all calls f with all the routing systems at once, and returns nil if one
+// succeeded, the first error otherwise.
+func (r *Router) all(f func(routing.IpfsRouting) error) error {
+	errs := make(chan error, len(r.Routers))
+	for _, rt := range r.Routers {
+		go func(rt routing.IpfsRouting) {
+			errs <- f(rt)
+		}(rt)
+	}
+
+	var first firstError
+	succeeded := false
+	for range r.Routers {
+		if err := <-errs; err == nil {
+			succeeded = true
+		} else {
+			first.add(err)
+		}
+	}
+	if succeeded {
+		return nil
+	}
+	return first.err(routing.ErrNotSupported)
+}
+
+// firstError keeps the first error of the routing systems queried, but those
+// of the systems not supporting the query.
+type firstError struct {
+	lk    sync.Mutex
+	first error
+}
+
+func (e *firstError) add(err error) {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	if e.first == nil && err != routing.ErrNotSupported {
+		e.first = err
+	}
+}
+
+// err returns the first error kept, def if none was.
+func (e *firstError) err(def error) error {
+	e.lk.Lock()
+	defer e.lk.Unlock()
+	if e.first == nil {
+		return def
+	}
+	return e.first
+}
+
+// PutValue puts the record to all the routing systems.
+func (r *Router) PutValue(ctx context.Context, key string, val []byte, opts ...ropts.Option) error {
+	return r.all(func(rt routing.IpfsRouting) error {
+		return rt.PutValue(ctx, key, val, opts...)
+	})
+}
+
+// GetValue returns the best record of key the routing systems queried found.
+func (r *Router) GetValue(ctx context.Context, key string, opts ...ropts.Option) ([]byte, error) {
+	var lk sync.Mutex
+	var vals [][]byte
+	var errs firstError
+	r.run(ctx, func(ctx context.Context, rt routing.IpfsRouting) bool {
+		val, err := rt.GetValue(ctx, key, opts...)
+		if err != nil {
+			if err != routing.ErrNotFound {
+				errs.add(err)
+			}
+			return false
+		}
+		lk.Lock()
+		vals = append(vals, val)
+		lk.Unlock()
+		return true
+	})
+
+	switch len(vals) {
+	case 0:
+		return nil, errs.err(routing.ErrNotFound)
+	case 1:
+		return vals[0], nil
+	}
+	i, err := r.Validator.Select(key, vals)
+	if err != nil {
+		return nil, err
+	}
+	return vals[i], nil
+}
+
+// SearchValue returns the records of key the routing systems queried find,
+// each better than the previous one.
+func (r *Router) SearchValue(ctx context.Context, key string, opts ...ropts.Option) (<-chan []byte, error) {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+
+		// held while sending, so that the records are sent in order
+		var lk sync.Mutex
+		var best []byte
+		r.run(ctx, func(ctx context.Context, rt routing.IpfsRouting) bool {
+			vals, err := rt.SearchValue(ctx, key, opts...)
+			if err != nil {
+				log.Debugf("searching %s: %s", key, err)
+				return false
+			}
+
+			found := false
+			for val := range vals {
+				found = true
+				lk.Lock()
+				if best != nil {
+					if bytes.Equal(best, val) {
+						lk.Unlock()
+						continue
+					}
+					i, err := r.Validator.Select(key, [][]byte{best, val})
+					if err != nil || i == 0 {
+						lk.Unlock()
+						continue
+					}
+				}
+				best = val
+				select {
+				case out <- val:
+				case <-ctx.Done():
+				}
+				lk.Unlock()
+			}
+			return found
+		})
+	}()
+	return out, nil
+}
+
+// Provide announces c to all the routing systems.
+func (r *Router) Provide(ctx context.Context, c cid.Cid, brdcst bool) error {
+	return r.all(func(rt routing.IpfsRouting) error {
+		return rt.Provide(ctx, c, brdcst)
+	})
+}
+
+// FindProvidersAsync returns the providers of k the routing systems queried
+// find, up to count if it isn't 0.
+func (r *Router) FindProvidersAsync(ctx context.Context, k cid.Cid, count int) <-chan pstore.PeerInfo {
+	out := make(chan pstore.PeerInfo)
+	go func() {
+		defer close(out)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var lk sync.Mutex
+		seen := make(map[peer.ID]bool)
+		r.run(ctx, func(ctx context.Context, rt routing.IpfsRouting) bool {
+			found := false
+			for pi := range rt.FindProvidersAsync(ctx, k, count) {
+				found = true
+				lk.Lock()
+				if seen[pi.ID] || (count > 0 && len(seen) >= count) {
+					lk.Unlock()
+					continue
+				}
+				seen[pi.ID] = true
+				full := count > 0 && len(seen) >= count
+				lk.Unlock()
+
+				select {
+				case out <- pi:
+				case <-ctx.Done():
+					return found
+				}
+				if full {
+					cancel()
+				}
+			}
+			return found
+		})
+	}()
+	return out
+}
+
+// FindPeer returns the addresses of the peer id the first routing system
+// finding it found.
+func (r *Router) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lk sync.Mutex
+	var found *pstore.PeerInfo
+	var errs firstError
+	r.run(ctx, func(ctx context.Context, rt routing.IpfsRouting) bool {
+		pi, err := rt.FindPeer(ctx, id)
+		lk.Lock()
+		defer lk.Unlock()
+		if found != nil {
+			return true
+		}
+		if err != nil {
+			if err != routing.ErrNotFound {
+				errs.add(err)
+			}
+			return false
+		}
+		found = &pi
+		// the other queries are over
+		cancel()
+		return true
+	})
+
+	if found == nil {
+		return pstore.PeerInfo{}, errs.err(routing.ErrNotFound)
+	}
+	return *found, nil
+}
+
+// Bootstrap bootstraps all the routing systems.
+func (r *Router) Bootstrap(ctx context.Context) error {
+	return r.all(func(rt routing.IpfsRouting) error {
+		return rt.Bootstrap(ctx)
+	})
+}
+
+// HandlePeerFound tells the routing systems composed which keep track of the
+// peers found by a discovery service about p.
+func (r *Router) HandlePeerFound(p pstore.PeerInfo) {
+	for _, rt := range r.Routers {
+		if n, ok := rt.(discovery.Notifee); ok {
+			n.HandlePeerFound(p)
+		}
+	}
+}
+
+var _ routing.IpfsRouting = (*Router)(nil)
+var _ discovery.Notifee = (*Router)(nil)
@@ -0,0 +1,170 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	testutil "gx/ipfs/QmPuhRE325DR8ChNcFtgd6F1eANCHy1oohXZPpYop4xsK6/go-testutil"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	ropts "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing/options"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+)
+
+// testRouter knows a record and peers, and counts the lookups of records.
+type testRouter struct {
+	*Static
+	record  []byte
+	delay   time.Duration
+	lookups int32
+}
+
+func newTestRouter(t *testing.T, record string, peers int) *testRouter {
+	var infos []pstore.PeerInfo
+	for i := 0; i < peers; i++ {
+		infos = append(infos, pstore.PeerInfo{ID: testutil.RandPeerIDFatal(t)})
+	}
+	r := &testRouter{Static: NewStatic(infos)}
+	if record != "" {
+		r.record = []byte(record)
+	}
+	return r
+}
+
+func (r *testRouter) GetValue(ctx context.Context, key string, opts ...ropts.Option) ([]byte, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if r.record == nil {
+		return nil, routing.ErrNotFound
+	}
+	return r.record, nil
+}
+
+func (r *testRouter) PutValue(ctx context.Context, key string, val []byte, opts ...ropts.Option) error {
+	if r.record == nil {
+		return errors.New("read only")
+	}
+	r.record = val
+	return nil
+}
+
+// longest selects the longest record.
+type longest struct{}
+
+func (longest) Validate(key string, value []byte) error {
+	return nil
+}
+
+func (longest) Select(key string, values [][]byte) (int, error) {
+	best := 0
+	for i, v := range values {
+		if len(v) > len(values[best]) {
+			best = i
+		}
+	}
+	return best, nil
+}
+
+func routers(rs ...*testRouter) []routing.IpfsRouting {
+	out := make([]routing.IpfsRouting, len(rs))
+	for i, r := range rs {
+		out[i] = r
+	}
+	return out
+}
+
+func TestParallel(t *testing.T) {
+	ctx := context.Background()
+	a := newTestRouter(t, "short", 2)
+	b := newTestRouter(t, "the longest", 3)
+	c := newTestRouter(t, "", 0)
+	r := &Router{Routers: routers(a, b, c), Validator: longest{}}
+
+	val, err := r.GetValue(ctx, "/test/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "the longest" {
+		t.Fatalf("expected the best record, got %q", val)
+	}
+
+	k := blocks.NewBlock([]byte("key")).Cid()
+	n := 0
+	for range r.FindProvidersAsync(ctx, k, 0) {
+		n++
+	}
+	if n != 5 {
+		t.Fatalf("expected the providers of all the routers, got %d", n)
+	}
+	n = 0
+	for range r.FindProvidersAsync(ctx, k, 3) {
+		n++
+	}
+	if n != 3 {
+		t.Fatalf("expected 3 providers, got %d", n)
+	}
+
+	if err := r.PutValue(ctx, "/test/key", []byte("new")); err != nil {
+		t.Fatalf("expected the record to be put, as some routers accept it: %s", err)
+	}
+	if string(a.record) != "new" || string(b.record) != "new" {
+		t.Fatal("expected the record to be put to all the routers")
+	}
+}
+
+func TestSequential(t *testing.T) {
+	ctx := context.Background()
+	empty := newTestRouter(t, "", 0)
+	a := newTestRouter(t, "first", 1)
+	b := newTestRouter(t, "the second", 1)
+	r := &Router{Routers: routers(empty, a, b), Mode: Sequential, Validator: longest{}}
+
+	val, err := r.GetValue(ctx, "/test/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "first" {
+		t.Fatalf("expected the record of the first router knowing it, got %q", val)
+	}
+	if b.lookups != 0 {
+		t.Fatal("expected the routers after the first answering not to be queried")
+	}
+
+	none := &Router{Routers: routers(empty), Mode: Sequential, Validator: longest{}}
+	if _, err := none.GetValue(ctx, "/test/key"); err != routing.ErrNotFound {
+		t.Fatalf("expected %s, got %v", routing.ErrNotFound, err)
+	}
+}
+
+func TestTiered(t *testing.T) {
+	ctx := context.Background()
+	slow := newTestRouter(t, "slow but long", 0)
+	slow.delay = time.Second
+	fast := newTestRouter(t, "fast", 0)
+	unused := newTestRouter(t, "unused", 0)
+	r := &Router{
+		Routers:   routers(slow, fast, unused),
+		Mode:      Tiered,
+		Delay:     50 * time.Millisecond,
+		Validator: longest{},
+	}
+
+	val, err := r.GetValue(ctx, "/test/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the slow tier still answered, with the best record
+	if string(val) != "slow but long" {
+		t.Fatalf("expected the best record, got %q", val)
+	}
+	if fast.lookups != 1 || unused.lookups != 0 {
+		t.Fatalf("expected the second tier only to be queried after the delay, got %d and %d lookups", fast.lookups, unused.lookups)
+	}
+}
@@ -0,0 +1,127 @@
+package compose
+
+import (
+	"context"
+	"sync"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	ropts "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing/options"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+)
+
+// noValues is the part of the routing systems below which stores no record.
+type noValues struct{}
+
+func (noValues) PutValue(context.Context, string, []byte, ...ropts.Option) error {
+	return routing.ErrNotSupported
+}
+
+func (noValues) GetValue(context.Context, string, ...ropts.Option) ([]byte, error) {
+	return nil, routing.ErrNotSupported
+}
+
+func (noValues) SearchValue(context.Context, string, ...ropts.Option) (<-chan []byte, error) {
+	return nil, routing.ErrNotSupported
+}
+
+// Static is a routing system knowing a fixed set of peers, returned as the
+// providers of every key, for the nodes of a cluster whose peers hold the
+// content they look for.
+type Static struct {
+	noValues
+	peers map[peer.ID]pstore.PeerInfo
+	order []peer.ID
+}
+
+// NewStatic returns a routing system knowing peers.
+func NewStatic(peers []pstore.PeerInfo) *Static {
+	s := &Static{peers: make(map[peer.ID]pstore.PeerInfo, len(peers))}
+	for _, pi := range peers {
+		if known, ok := s.peers[pi.ID]; ok {
+			known.Addrs = append(known.Addrs, pi.Addrs...)
+			s.peers[pi.ID] = known
+			continue
+		}
+		s.peers[pi.ID] = pi
+		s.order = append(s.order, pi.ID)
+	}
+	return s
+}
+
+// Provide announces nothing, the peers are known to provide everything.
+func (s *Static) Provide(context.Context, cid.Cid, bool) error {
+	return nil
+}
+
+// FindProvidersAsync returns the peers, up to count if it isn't 0.
+func (s *Static) FindProvidersAsync(ctx context.Context, k cid.Cid, count int) <-chan pstore.PeerInfo {
+	n := len(s.order)
+	if count > 0 && count < n {
+		n = count
+	}
+	out := make(chan pstore.PeerInfo, n)
+	for _, id := range s.order[:n] {
+		out <- s.peers[id]
+	}
+	close(out)
+	return out
+}
+
+func (s *Static) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, error) {
+	pi, ok := s.peers[id]
+	if !ok {
+		return pstore.PeerInfo{}, routing.ErrNotFound
+	}
+	return pi, nil
+}
+
+func (s *Static) Bootstrap(context.Context) error {
+	return nil
+}
+
+// Peers is a peer routing answering with the peers found by a discovery
+// service such as mDNS. It finds no providers and announces nothing.
+type Peers struct {
+	noValues
+
+	lk    sync.Mutex
+	peers map[peer.ID]pstore.PeerInfo
+}
+
+// NewPeers returns a peer routing knowing no peer until they are found.
+func NewPeers() *Peers {
+	return &Peers{peers: make(map[peer.ID]pstore.PeerInfo)}
+}
+
+// HandlePeerFound records p, with the addresses it was last found at.
+func (p *Peers) HandlePeerFound(pi pstore.PeerInfo) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.peers[pi.ID] = pi
+}
+
+func (p *Peers) Provide(context.Context, cid.Cid, bool) error {
+	return nil
+}
+
+func (p *Peers) FindProvidersAsync(context.Context, cid.Cid, int) <-chan pstore.PeerInfo {
+	out := make(chan pstore.PeerInfo)
+	close(out)
+	return out
+}
+
+func (p *Peers) FindPeer(ctx context.Context, id peer.ID) (pstore.PeerInfo, error) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	pi, ok := p.peers[id]
+	if !ok {
+		return pstore.PeerInfo{}, routing.ErrNotFound
+	}
+	return pi, nil
+}
+
+func (p *Peers) Bootstrap(context.Context) error {
+	return nil
+}
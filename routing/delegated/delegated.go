@@ -0,0 +1,382 @@
+// Package delegated answers the routing queries of the node with remote HTTP
+// endpoints, so that the light or firewalled nodes can find content and
+// resolve names without running full DHT lookups.
+//
+// The endpoints answer two queries, with a 404 status when they know nothing
+// of the key asked:
+//
+//	GET <url>/providers/<cid>
+//	  {"Providers": [{"ID": "<peer id>", "Addrs": ["<multiaddr>", ...]}, ...]}
+//
+//	GET <url>/records/<key>
+//	  the record, the key being encoded in unpadded base64url
+package delegated
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	routing "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing"
+	ropts "gx/ipfs/QmRASJXJUFygM5qU4YrH7k7jD6S4Hg8nJmgqJ4bYJvLatd/go-libp2p-routing/options"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	record "gx/ipfs/QmfARXVCzpwFXQdepAJZuqyNDgV9doEsMnVCo1ssmuSe1U/go-libp2p-record"
+)
+
+var log = logging.Logger("routing/delegated")
+
+// Timeout bounds the time of a query to an endpoint.
+var Timeout = 30 * time.Second
+
+// Namespaces are the namespaces of the records queried from the endpoints,
+// the others are only looked up with the routing wrapped.
+var Namespaces = []string{"ipns", "pk"}
+
+// MaxRecordSize bounds the size of the records read from the endpoints.
+const MaxRecordSize = 1 << 20
+
+// maxProvidersSize bounds the size of the provider lists read.
+const maxProvidersSize = 4 << 20
+
+// Provider is a peer providing a key, as listed by the endpoints.
+type Provider struct {
+	ID    string
+	Addrs []string
+}
+
+// Providers is the body of the answers to the provider queries.
+type Providers struct {
+	Providers []Provider
+}
+
+// Client queries an endpoint.
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// NewClient returns a client querying the endpoint at url.
+func NewClient(url string) *Client {
+	return &Client{
+		url:  strings.TrimRight(url, "/"),
+		http: &http.Client{Timeout: Timeout},
+	}
+}
+
+// get queries path, and returns the body of the answer, nil if the endpoint
+// answered with a 404 status.
+func (c *Client) get(ctx context.Context, path string, max int64) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		// drained so that the connection is reused
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+		return nil, nil
+	}
+	if resp.StatusCode/100 != 2 {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+		return nil, fmt.Errorf("delegated: %s answered %s", c.url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > max {
+		return nil, fmt.Errorf("delegated: the answer of %s exceeds %d bytes", c.url, max)
+	}
+	if body == nil {
+		body = []byte{}
+	}
+	return body, nil
+}
+
+// FindProviders returns the providers of k the endpoint knows. The providers
+// which can't be decoded are skipped.
+func (c *Client) FindProviders(ctx context.Context, k cid.Cid) ([]pstore.PeerInfo, error) {
+	body, err := c.get(ctx, "/providers/"+k.String(), maxProvidersSize)
+	if err != nil || body == nil {
+		return nil, err
+	}
+	var provs Providers
+	if err := json.Unmarshal(body, &provs); err != nil {
+		return nil, fmt.Errorf("delegated: decoding the providers of %s: %s", k, err)
+	}
+
+	out := make([]pstore.PeerInfo, 0, len(provs.Providers))
+	for _, p := range provs.Providers {
+		id, err := peer.IDB58Decode(p.ID)
+		if err != nil {
+			log.Debugf("invalid provider %q from %s: %s", p.ID, c.url, err)
+			continue
+		}
+		pi := pstore.PeerInfo{ID: id}
+		for _, s := range p.Addrs {
+			a, err := ma.NewMultiaddr(s)
+			if err != nil {
+				log.Debugf("invalid address %q of %s from %s: %s", s, p.ID, c.url, err)
+				continue
+			}
+			pi.Addrs = append(pi.Addrs, a)
+		}
+		out = append(out, pi)
+	}
+	return out, nil
+}
+
+// GetRecord returns the record of key the endpoint knows, nil if it knows
+// none. The record isn't validated.
+func (c *Client) GetRecord(ctx context.Context, key string) ([]byte, error) {
+	return c.get(ctx, "/records/"+base64.RawURLEncoding.EncodeToString([]byte(key)), MaxRecordSize)
+}
+
+// Routing is a routing system looking the providers up with the endpoints
+// first, and with the routing it wraps when they know none. The records are
+// looked up with both, the best one is returned. The other queries are
+// answered by the routing wrapped.
+type Routing struct {
+	routing.IpfsRouting
+	clients   []*Client
+	validator record.Validator
+}
+
+// Wrap returns a routing system querying the endpoints of clients before r.
+// The records found are validated with validator.
+func Wrap(r routing.IpfsRouting, clients []*Client, validator record.Validator) *Routing {
+	return &Routing{
+		IpfsRouting: r,
+		clients:     clients,
+		validator:   validator,
+	}
+}
+
+// FindProvidersAsync returns the providers of k the endpoints know, and those
+// the routing wrapped finds if they know none. A count of 0 doesn't limit the
+// number of providers.
+func (r *Routing) FindProvidersAsync(ctx context.Context, k cid.Cid, count int) <-chan pstore.PeerInfo {
+	out := make(chan pstore.PeerInfo)
+	go func() {
+		defer close(out)
+
+		found := make(chan []pstore.PeerInfo, len(r.clients))
+		for _, c := range r.clients {
+			go func(c *Client) {
+				provs, err := c.FindProviders(ctx, k)
+				if err != nil {
+					log.Debugf("finding the providers of %s: %s", k, err)
+				}
+				found <- provs
+			}(c)
+		}
+
+		seen := make(map[peer.ID]bool)
+		for range r.clients {
+			for _, pi := range <-found {
+				if seen[pi.ID] {
+					continue
+				}
+				seen[pi.ID] = true
+				select {
+				case out <- pi:
+				case <-ctx.Done():
+					return
+				}
+				if count > 0 && len(seen) >= count {
+					return
+				}
+			}
+		}
+		if len(seen) > 0 {
+			return
+		}
+
+		for pi := range r.IpfsRouting.FindProvidersAsync(ctx, k, count) {
+			select {
+			case out <- pi:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// delegated returns true if the records of key are queried from the
+// endpoints.
+func delegated(key string) bool {
+	ns, _, err := record.SplitKey(key)
+	if err != nil {
+		return false
+	}
+	for _, n := range Namespaces {
+		if n == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// getRecords returns the valid records of key the endpoints know.
+func (r *Routing) getRecords(ctx context.Context, key string) [][]byte {
+	var lk sync.Mutex
+	var records [][]byte
+	var wg sync.WaitGroup
+	for _, c := range r.clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			rec, err := c.GetRecord(ctx, key)
+			if err != nil {
+				log.Debugf("getting the record of %s: %s", key, err)
+				return
+			}
+			if rec == nil {
+				return
+			}
+			if err := r.validator.Validate(key, rec); err != nil {
+				log.Debugf("invalid record of %s from %s: %s", key, c.url, err)
+				return
+			}
+			lk.Lock()
+			records = append(records, rec)
+			lk.Unlock()
+		}(c)
+	}
+	wg.Wait()
+	return records
+}
+
+// best returns the best of the valid records of key, nil if there are none.
+func (r *Routing) best(key string, records [][]byte) []byte {
+	switch len(records) {
+	case 0:
+		return nil
+	case 1:
+		return records[0]
+	}
+	i, err := r.validator.Select(key, records)
+	if err != nil {
+		log.Debugf("selecting the record of %s: %s", key, err)
+		return records[0]
+	}
+	return records[i]
+}
+
+// GetValue returns the best of the records of key the endpoints know and the
+// routing wrapped finds, both queried at once. An endpoint serving an old
+// record doesn't hide the newer records of the routing wrapped.
+func (r *Routing) GetValue(ctx context.Context, key string, opts ...ropts.Option) ([]byte, error) {
+	if !delegated(key) {
+		return r.IpfsRouting.GetValue(ctx, key, opts...)
+	}
+
+	type result struct {
+		rec []byte
+		err error
+	}
+	wrapped := make(chan result, 1)
+	go func() {
+		rec, err := r.IpfsRouting.GetValue(ctx, key, opts...)
+		wrapped <- result{rec, err}
+	}()
+
+	records := r.getRecords(ctx, key)
+	res := <-wrapped
+	if res.err == nil {
+		records = append(records, res.rec)
+	}
+	if len(records) == 0 {
+		return nil, res.err
+	}
+	return r.best(key, records), nil
+}
+
+// SearchValue searches the records of key with the endpoints and the routing
+// wrapped at once, and returns the records found which are better than those
+// returned before.
+func (r *Routing) SearchValue(ctx context.Context, key string, opts ...ropts.Option) (<-chan []byte, error) {
+	if !delegated(key) {
+		return r.IpfsRouting.SearchValue(ctx, key, opts...)
+	}
+
+	in, err := r.IpfsRouting.SearchValue(ctx, key, opts...)
+	if err != nil {
+		rec := r.best(key, r.getRecords(ctx, key))
+		if rec == nil {
+			return nil, err
+		}
+		out := make(chan []byte, 1)
+		out <- rec
+		close(out)
+		return out, nil
+	}
+
+	endpoints := make(chan []byte, 1)
+	go func() {
+		endpoints <- r.best(key, r.getRecords(ctx, key))
+	}()
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+
+		var best []byte
+		// offer sends rec if it's better than the records sent, and returns
+		// false once ctx is done
+		offer := func(rec []byte) bool {
+			if rec == nil {
+				return true
+			}
+			if best != nil {
+				i, err := r.validator.Select(key, [][]byte{best, rec})
+				if err != nil || i == 0 {
+					return true
+				}
+			}
+			best = rec
+			select {
+			case out <- rec:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for endpoints != nil || in != nil {
+			select {
+			case rec := <-endpoints:
+				endpoints = nil
+				if !offer(rec) {
+					return
+				}
+			case rec, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				if !offer(rec) {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
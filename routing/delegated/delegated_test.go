@@ -0,0 +1,171 @@
+package delegated
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	testutil "gx/ipfs/QmPuhRE325DR8ChNcFtgd6F1eANCHy1oohXZPpYop4xsK6/go-testutil"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	mockrouting "gx/ipfs/QmdmWkx54g7VfVyxeG8ic84uf4G6Eq1GohuyKA3XDuJ8oC/go-ipfs-routing/mock"
+	offline "gx/ipfs/QmdmWkx54g7VfVyxeG8ic84uf4G6Eq1GohuyKA3XDuJ8oC/go-ipfs-routing/offline"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+	record "gx/ipfs/QmfARXVCzpwFXQdepAJZuqyNDgV9doEsMnVCo1ssmuSe1U/go-libp2p-record"
+)
+
+// endpoint answers with the providers and records it's given.
+type endpoint struct {
+	providers map[string]Providers
+	records   map[string][]byte
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/providers/"):
+		provs, ok := e.providers[strings.TrimPrefix(r.URL.Path, "/providers/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&provs)
+	case strings.HasPrefix(r.URL.Path, "/records/"):
+		key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(r.URL.Path, "/records/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rec, ok := e.records[string(key)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(rec)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	ctx := context.Background()
+	known := blocks.NewBlock([]byte("known")).Cid()
+	unknown := blocks.NewBlock([]byte("unknown")).Cid()
+	prov := testutil.RandPeerIDFatal(t)
+
+	srv := httptest.NewServer(&endpoint{
+		providers: map[string]Providers{
+			known.String(): {Providers: []Provider{
+				{ID: prov.Pretty(), Addrs: []string{"/ip4/1.2.3.4/tcp/4001", "invalid"}},
+				{ID: "invalid"},
+			}},
+		},
+		records: map[string][]byte{"/ipns/delegated": []byte("from the endpoint")},
+	})
+	defer srv.Close()
+
+	validator := record.NamespacedValidator{"ipns": mockrouting.MockValidator{}}
+	wrapped := offline.NewOfflineRouter(dssync.MutexWrap(ds.NewMapDatastore()), validator)
+	r := Wrap(wrapped, []*Client{NewClient(srv.URL + "/")}, validator)
+
+	var found []string
+	for pi := range r.FindProvidersAsync(ctx, known, 0) {
+		found = append(found, pi.ID.Pretty())
+		if len(pi.Addrs) != 1 {
+			t.Fatalf("expected the valid address only, got %v", pi.Addrs)
+		}
+	}
+	if len(found) != 1 || found[0] != prov.Pretty() {
+		t.Fatalf("expected %s to be found, got %v", prov, found)
+	}
+	for pi := range r.FindProvidersAsync(ctx, unknown, 0) {
+		t.Fatalf("expected no provider of an unknown key, got %s", pi.ID)
+	}
+
+	val, err := r.GetValue(ctx, "/ipns/delegated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "from the endpoint" {
+		t.Fatalf("expected the record of the endpoint, got %q", val)
+	}
+
+	if err := wrapped.PutValue(ctx, "/ipns/local", []byte("local")); err != nil {
+		t.Fatal(err)
+	}
+	vals, err := r.SearchValue(ctx, "/ipns/local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for v := range vals {
+		got = append(got, string(v))
+	}
+	if len(got) != 1 || got[0] != "local" {
+		t.Fatalf("expected the record of the routing wrapped, got %q", got)
+	}
+}
+
+// greatestValidator accepts any record, and selects the greatest.
+type greatestValidator struct{}
+
+func (greatestValidator) Validate(string, []byte) error { return nil }
+
+func (greatestValidator) Select(_ string, vals [][]byte) (int, error) {
+	best := 0
+	for i, v := range vals {
+		if string(v) > string(vals[best]) {
+			best = i
+		}
+	}
+	return best, nil
+}
+
+func TestRoutingSelect(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(&endpoint{
+		records: map[string][]byte{
+			"/ipns/old": []byte("1"),
+			"/ipns/new": []byte("3"),
+		},
+	})
+	defer srv.Close()
+
+	validator := record.NamespacedValidator{"ipns": greatestValidator{}}
+	wrapped := offline.NewOfflineRouter(dssync.MutexWrap(ds.NewMapDatastore()), validator)
+	r := Wrap(wrapped, []*Client{NewClient(srv.URL)}, validator)
+	for _, key := range []string{"/ipns/old", "/ipns/new"} {
+		if err := wrapped.PutValue(ctx, key, []byte("2")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for key, expected := range map[string]string{"/ipns/old": "2", "/ipns/new": "3"} {
+		val, err := r.GetValue(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(val) != expected {
+			t.Fatalf("expected the best record of %s, %q, got %q", key, expected, val)
+		}
+
+		vals, err := r.SearchValue(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var last string
+		for v := range vals {
+			if last != "" && string(v) <= last {
+				t.Fatalf("expected the records of %s to improve, got %q after %q", key, v, last)
+			}
+			last = string(v)
+		}
+		if last != expected {
+			t.Fatalf("expected the search of %s to end with %q, got %q", key, expected, last)
+		}
+	}
+}
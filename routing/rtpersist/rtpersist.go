@@ -0,0 +1,155 @@
+// Package rtpersist saves the peers of the routing table of the DHT, with
+// their addresses, to the datastore, so that a restarted node can reconnect
+// to them and rejoin the DHT without rebuilding its routing table from the
+// bootstrap peers.
+package rtpersist
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	peer "gx/ipfs/QmY5Grm8pJdiSSVsYxx4uNRgweY72EmYwuSDbRnbFok3iY/go-libp2p-peer"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+)
+
+var log = logging.Logger("rtpersist")
+
+// Key is the key of the routing table in the datastore.
+var Key = ds.NewKey("/local/routingtable")
+
+var (
+	// Interval is the time between two saves of the routing table
+	Interval = 10 * time.Minute
+
+	// MaxPeers bounds the number of peers saved
+	MaxPeers = 256
+)
+
+// savedPeer is a peer as saved in the datastore.
+type savedPeer struct {
+	ID    string
+	Addrs []string
+}
+
+// Save saves peers to d, up to MaxPeers of them. The peers without addresses
+// are skipped.
+func Save(d ds.Datastore, peers []pstore.PeerInfo) error {
+	saved := make([]savedPeer, 0, len(peers))
+	for _, pi := range peers {
+		if len(saved) >= MaxPeers {
+			break
+		}
+		if len(pi.Addrs) == 0 {
+			continue
+		}
+		sp := savedPeer{ID: pi.ID.Pretty()}
+		for _, a := range pi.Addrs {
+			sp.Addrs = append(sp.Addrs, a.String())
+		}
+		saved = append(saved, sp)
+	}
+
+	b, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return d.Put(Key, b)
+}
+
+// Load returns the peers saved to d, none if the routing table was never
+// saved. The peers and addresses which can't be decoded are skipped.
+func Load(d ds.Datastore) ([]pstore.PeerInfo, error) {
+	val, err := d.Get(Key)
+	if err == ds.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []savedPeer
+	if err := json.Unmarshal(val, &saved); err != nil {
+		log.Warningf("discarding the saved routing table: %s", err)
+		return nil, nil
+	}
+	peers := make([]pstore.PeerInfo, 0, len(saved))
+	for _, sp := range saved {
+		id, err := peer.IDB58Decode(sp.ID)
+		if err != nil {
+			continue
+		}
+		pi := pstore.PeerInfo{ID: id}
+		for _, s := range sp.Addrs {
+			if a, err := ma.NewMultiaddr(s); err == nil {
+				pi.Addrs = append(pi.Addrs, a)
+			}
+		}
+		if len(pi.Addrs) > 0 {
+			peers = append(peers, pi)
+		}
+	}
+	return peers, nil
+}
+
+// Saver saves the routing table periodically.
+type Saver struct {
+	d     ds.Datastore
+	peers func() []pstore.PeerInfo
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Start saves the peers returned by peers to d every Interval, and once more
+// when the saver is closed.
+func Start(d ds.Datastore, peers func() []pstore.PeerInfo) *Saver {
+	s := &Saver{
+		d:     d,
+		peers: peers,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Saver) run() {
+	defer close(s.done)
+	t := time.NewTicker(Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.save()
+		case <-s.stop:
+			s.save()
+			return
+		}
+	}
+}
+
+func (s *Saver) save() {
+	peers := s.peers()
+	if len(peers) == 0 {
+		// keep the last table saved rather than the table of a node which
+		// lost its connections
+		return
+	}
+	if err := Save(s.d, peers); err != nil {
+		log.Errorf("saving the routing table: %s", err)
+	}
+}
+
+// Close saves the routing table a last time and stops the saver.
+func (s *Saver) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+	return nil
+}
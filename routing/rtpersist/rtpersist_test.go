@@ -0,0 +1,64 @@
+package rtpersist
+
+import (
+	"testing"
+	"time"
+
+	testutil "gx/ipfs/QmPuhRE325DR8ChNcFtgd6F1eANCHy1oohXZPpYop4xsK6/go-testutil"
+	ma "gx/ipfs/QmRKLtwMw131aK7ugC3G7ybpumMz78YrJe5dzneyindvG1/go-multiaddr"
+	pstore "gx/ipfs/QmZ9zH2FnLcxv1xyzFeUpDUeo55xEhZQHgveZijcxr7TLj/go-libp2p-peerstore"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func TestSaveLoad(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	if peers, err := Load(d); err != nil || len(peers) != 0 {
+		t.Fatalf("expected no peers before the first save, got %v, %v", peers, err)
+	}
+
+	addr, err := ma.NewMultiaddr("/ip4/1.2.3.4/tcp/4001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withAddr := pstore.PeerInfo{ID: testutil.RandPeerIDFatal(t), Addrs: []ma.Multiaddr{addr}}
+	noAddr := pstore.PeerInfo{ID: testutil.RandPeerIDFatal(t)}
+	if err := Save(d, []pstore.PeerInfo{withAddr, noAddr}); err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := Load(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].ID != withAddr.ID {
+		t.Fatalf("expected the peer with an address only, got %v", peers)
+	}
+	if len(peers[0].Addrs) != 1 || !peers[0].Addrs[0].Equal(addr) {
+		t.Fatalf("expected %s, got %v", addr, peers[0].Addrs)
+	}
+}
+
+func TestSaver(t *testing.T) {
+	defer func(i time.Duration) { Interval = i }(Interval)
+	Interval = time.Hour
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	addr, err := ma.NewMultiaddr("/ip4/1.2.3.4/tcp/4001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pi := pstore.PeerInfo{ID: testutil.RandPeerIDFatal(t), Addrs: []ma.Multiaddr{addr}}
+	s := Start(d, func() []pstore.PeerInfo {
+		return []pstore.PeerInfo{pi}
+	})
+	s.Close()
+
+	peers, err := Load(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].ID != pi.ID {
+		t.Fatalf("expected the table to be saved on close, got %v", peers)
+	}
+}
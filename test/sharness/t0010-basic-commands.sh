@@ -41,6 +41,18 @@ test_expect_success "ipfs version --all has all required fields" '
   grep "Golang version" version_all.txt
 '
 
+test_expect_success "'ipfs version --enc=ndjson' outputs a line of JSON" '
+  ipfs version --enc=ndjson >version.ndjson &&
+  test $(wc -l <version.ndjson) -eq 1 &&
+  grep "\"Version\":" version.ndjson
+'
+
+test_expect_success "'ipfs version --enc=cbor' outputs CBOR" '
+  ipfs version --enc=cbor >version.cbor &&
+  test -s version.cbor &&
+  grep -a "Version" version.cbor
+'
+
 test_expect_success "'ipfs commands' succeeds" '
   ipfs commands >commands.txt
 '
@@ -51,6 +63,36 @@ test_expect_success "'ipfs commands' output looks good" '
   grep "ipfs update" commands.txt
 '
 
+test_expect_success "'ipfs commands completion bash' generates a valid script" '
+  ipfs commands completion bash >completion.bash &&
+  bash -n completion.bash &&
+  grep "complete -o filenames -F _ipfs ipfs" completion.bash &&
+  grep "\"ipfs pin rm\") echo \"pins\"" completion.bash
+'
+
+test_expect_success "'ipfs commands completion' completes subcommands" '
+  bash -c "source completion.bash &&
+    COMP_WORDS=(ipfs pi) && COMP_CWORD=1 && _ipfs &&
+    echo \${COMPREPLY[*]}" >completion_out &&
+  echo "pin ping" >completion_exp &&
+  test_cmp completion_exp completion_out
+'
+
+test_expect_success "'ipfs commands completion zsh' generates a compdef script" '
+  ipfs commands completion zsh >completion.zsh &&
+  head -n 1 completion.zsh >completion_first &&
+  echo "#compdef ipfs" >completion_first_exp &&
+  test_cmp completion_first_exp completion_first &&
+  grep "^__ipfs_cmd_ipfs_pin_rm()" completion.zsh &&
+  grep "__ipfs_pins" completion.zsh &&
+  test_must_fail grep "^_ipfs()" completion.zsh
+'
+
+test_expect_success "'ipfs commands completion' rejects unknown shells" '
+  test_must_fail ipfs commands completion tcsh 2>completion_err &&
+  grep "unsupported shell" completion_err
+'
+
 test_expect_success "All sub-commands accept help" '
   echo 0 > fail
   while read -r cmd
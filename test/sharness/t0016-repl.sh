@@ -0,0 +1,52 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs repl"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_repl() {
+  test_expect_success "'ipfs repl' runs commands" '
+    PEERID=$(ipfs config Identity.PeerID) &&
+    printf "config Identity.PeerID\n\nipfs version -n\n" | ipfs repl >repl_out 2>repl_err &&
+    echo "$PEERID" >expected &&
+    ipfs version -n >>expected &&
+    test_cmp expected repl_out
+  '
+
+  test_expect_success "'ipfs repl' shares state between commands" '
+    printf "files mkdir /repl-dir\nfiles ls /\n" | ipfs repl >repl_out &&
+    grep "^repl-dir$" repl_out
+  '
+
+  test_expect_success "'ipfs repl' stops at exit" '
+    printf "exit\nversion\n" | ipfs repl >repl_out &&
+    test_must_be_empty repl_out
+  '
+
+  test_expect_success "'ipfs repl' reports errors and continues" '
+    printf "block stat invalid\n\"unterminated\nversion -n\n" | ipfs repl >repl_out 2>repl_err &&
+    grep "Error" repl_err &&
+    grep "unterminated quote" repl_err &&
+    ipfs version -n >expected &&
+    test_cmp expected repl_out
+  '
+
+  test_expect_success "'ipfs repl' refuses nested sessions" '
+    echo "repl" | ipfs repl 2>repl_err &&
+    grep "can.t be run from the repl" repl_err
+  '
+}
+
+# without a daemon, the repl runs its own node
+test_repl
+
+test_launch_ipfs_daemon
+test_repl
+test_kill_ipfs_daemon
+
+test_done
@@ -190,6 +190,21 @@ test_config_cmd() {
     test_cmp replace_out replace_expected
   '
 
+  test_expect_success "'ipfs config show' doesn't include the webhook secrets" '
+    ipfs config --json Webhooks "[{\"URL\": \"http://127.0.0.1:1/hook\", \"Secret\": \"hooksecret\"}]" &&
+    ipfs config show > show_config &&
+    test_expect_code 1 grep hooksecret show_config &&
+    grep "127.0.0.1:1/hook" show_config
+  '
+
+  test_expect_success "'ipfs config Webhooks' doesn't include the secrets" '
+    ipfs config Webhooks > hooks_config &&
+    test_expect_code 1 grep hooksecret hooks_config &&
+    grep "127.0.0.1:1/hook" hooks_config &&
+    grep hooksecret "$IPFS_PATH/config" &&
+    ipfs config --json Webhooks "[]"
+  '
+
   test_expect_success "'ipfs config Swarm.AddrFilters' looks good" '
     ipfs config Swarm.AddrFilters > actual_config &&
     test $(cat actual_config | wc -l) = 1
@@ -286,9 +301,36 @@ test_init_ipfs
 # should work offline
 test_config_cmd
 
+test_expect_success "'ipfs config profile apply --live' fails without a daemon" '
+  test_must_fail ipfs config profile apply lowpower --live 2> live_err &&
+  grep "daemon not running" live_err
+'
+
 # should work online
 test_launch_ipfs_daemon
 test_config_cmd
+
+test_expect_success "'ipfs config profile apply --live' can't be a dry run" '
+  test_must_fail ipfs config profile apply lowpower --live --dry-run
+'
+
+test_expect_success "'ipfs config profile apply lowpower --live' succeeds" '
+  ipfs config profile apply lowpower --live > live_out
+'
+
+test_expect_success "reprovider interval was applied live" '
+  grep "applied live: Reprovider.Interval" live_out
+'
+
+test_expect_success "connection manager limits require a restart" '
+  grep "restart required: Swarm.ConnMgr.HighWater" live_out
+'
+
+test_expect_success "lowpower profile was written to the config" '
+  echo 0 > expected_interval &&
+  ipfs config Reprovider.Interval > actual_interval &&
+  test_cmp expected_interval actual_interval
+'
 test_kill_ipfs_daemon
 
 
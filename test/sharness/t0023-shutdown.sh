@@ -37,4 +37,42 @@ test_expect_success "daemon no longer running" '
     ! kill -0 $IPFS_PID 2>/dev/null && return
   done
 '
+
+test_launch_ipfs_daemon
+
+test_expect_success "daemon reload succeeds" '
+  ipfs config --json Gateway.Hosts "{\"example.com\": {\"Root\": \"/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn\"}}" &&
+  ipfs daemon reload >reload_out &&
+  grep "reloaded Gateway.Hosts" reload_out &&
+  grep "reloaded Gateway.RateLimit" reload_out
+'
+
+test_expect_success "shutdown --wait-timeout must be a duration" '
+  test_must_fail ipfs shutdown --wait --wait-timeout=soon &&
+  kill -0 $IPFS_PID
+'
+
+test_expect_success "shutdown --wait flushes MFS" '
+  ipfs files mkdir /shutdown-test &&
+  ipfs files stat --hash / >mfs_root_expected &&
+  ipfs shutdown --wait --wait-timeout=1m
+'
+
+test_expect_success "daemon no longer running" '
+  for i in $(test_seq 1 100)
+  do
+    go-sleep 100ms
+    ! kill -0 $IPFS_PID 2>/dev/null && return
+  done
+'
+
+test_expect_success "MFS changes were persisted" '
+  ipfs files stat --hash / >mfs_root_actual &&
+  test_cmp mfs_root_expected mfs_root_actual
+'
+
+test_expect_success "daemon reload fails without a daemon" '
+  test_must_fail ipfs daemon reload
+'
+
 test_done
@@ -13,4 +13,59 @@ test_expect_success "'ipfs pin ls' works" '
   ipfs pin ls | wc -l | grep 9
 '
 
+test_expect_success "'ipfs repo compact' works with badger" '
+  ipfs repo compact > compact_out &&
+  grep "badgerds: collecting value log garbage" compact_out &&
+  grep "datastore compacted" compact_out
+'
+
+test_expect_success "add a file before converting" '
+  echo "convert me" > afile &&
+  HASH=$(ipfs add -q afile)
+'
+
+test_expect_success "'ipfs repo convert' requires a spec" '
+  test_must_fail ipfs repo convert
+'
+
+test_expect_success "'ipfs repo convert --profile=default-datastore' succeeds" '
+  ipfs repo convert --profile=default-datastore > convert_out &&
+  grep "converted datastore" convert_out
+'
+
+test_expect_success "datastore spec was updated" '
+  grep flatfs "$IPFS_PATH/datastore_spec" &&
+  ipfs config Datastore.Spec | grep flatfs
+'
+
+test_expect_success "content is still there after converting" '
+  ipfs cat "$HASH" > afile_out &&
+  test_cmp afile afile_out &&
+  ipfs pin ls | wc -l | grep 10
+'
+
+test_expect_success "converting to the same datastore fails" '
+  test_must_fail ipfs repo convert --profile=default-datastore
+'
+
+test_expect_success "'ipfs repo compact' re-shards flatfs after a shardFunc change" '
+  sed -i.bak "s|next-to-last/2|next-to-last/3|" "$IPFS_PATH/config" &&
+  ipfs repo compact > compact_out &&
+  grep "re-sharding blocks" compact_out &&
+  grep "next-to-last/3" "$IPFS_PATH/blocks/SHARDING" &&
+  grep "next-to-last/3" "$IPFS_PATH/datastore_spec"
+'
+
+test_expect_success "content is still there after re-sharding" '
+  ipfs cat "$HASH" > afile_out &&
+  test_cmp afile afile_out
+'
+
+test_expect_success "'ipfs repo compact' refuses other datastore changes" '
+  sed -i.bak "s|\"path\": \"datastore\"|\"path\": \"datastore2\"|" "$IPFS_PATH/config" &&
+  test_must_fail ipfs repo compact 2> compact_err &&
+  grep "ipfs repo convert" compact_err &&
+  mv "$IPFS_PATH/config.bak" "$IPFS_PATH/config"
+'
+
 test_done
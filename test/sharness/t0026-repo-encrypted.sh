@@ -0,0 +1,59 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test encrypted repos"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+export IPFS_REPO_KEY=000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f
+
+test_expect_success "add a file and a key before encrypting" '
+  PEERID=$(ipfs config Identity.PeerID) &&
+  echo "secret content" > afile &&
+  HASH=$(ipfs add -q afile) &&
+  ipfs key gen --type=ed25519 mykey > mykey_id
+'
+
+test_expect_success "'ipfs repo convert' to an encrypted datastore succeeds" '
+  ENCRYPTED_SPEC="{\"type\": \"encrypted\", \"child\": $(ipfs config Datastore.Spec)}" &&
+  ipfs repo convert "$ENCRYPTED_SPEC" > convert_out &&
+  grep "converted datastore" convert_out
+'
+
+test_expect_success "blocks are encrypted on disk" '
+  test_must_fail grep -r "secret content" "$IPFS_PATH/blocks"
+'
+
+test_expect_success "content is readable with the key" '
+  ipfs cat "$HASH" > afile_out &&
+  test_cmp afile afile_out
+'
+
+test_expect_success "the private key of the identity is encrypted in the config" '
+  grep "\"PrivKey\": \"encrypted:" "$IPFS_PATH/config"
+'
+
+test_expect_success "the peer id is unchanged" '
+  ipfs id -f="<id>" > id_out &&
+  test "$(cat id_out)" = "$PEERID"
+'
+
+test_expect_success "keys are readable with the key" '
+  ipfs key list -l | grep mykey > key_out &&
+  grep "$(cat mykey_id)" key_out
+'
+
+test_expect_success "the repo can't be opened without the key" '
+  test_must_fail env -u IPFS_REPO_KEY ipfs cat "$HASH" 2> no_key_err &&
+  grep "the repo is encrypted" no_key_err
+'
+
+test_expect_success "the repo can't be read with another key" '
+  test_must_fail env IPFS_REPO_KEY=1f1e1d1c1b1a191817161514131211100f0e0d0c0b0a09080706050403020100 ipfs cat "$HASH"
+'
+
+test_done
@@ -0,0 +1,66 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test ipfs repo backup and restore"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add content, pins, keys and files" '
+  echo "pinned content" > pinned &&
+  PINNED=$(ipfs add -q pinned) &&
+  echo "mfs content" > mfsfile &&
+  MFS=$(ipfs add -q --pin=false mfsfile) &&
+  ipfs files cp /ipfs/$MFS /mfsfile &&
+  ipfs key gen --type=ed25519 backupkey > key_id
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs repo backup --blocks' succeeds while the daemon runs" '
+  ipfs repo backup --blocks > backup.tar
+'
+
+test_expect_success "backup holds the expected entries" '
+  tar tf backup.tar > entries &&
+  head -n 1 entries | grep backup.json &&
+  grep "^config$" entries &&
+  grep "keystore/backupkey" entries &&
+  grep "blocks/$PINNED" entries &&
+  grep "blocks/$MFS" entries
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "restore into a new repo" '
+  export IPFS_PATH="$(pwd)/.ipfs-restored" &&
+  ipfs init --bits=1024 --profile=test > /dev/null &&
+  ipfs repo restore backup.tar > restore_out &&
+  grep "restored key backupkey" restore_out &&
+  grep "restored file /mfsfile" restore_out
+'
+
+test_expect_success "restored content is there" '
+  ipfs pin ls --type=recursive | grep "$PINNED" &&
+  ipfs files read /mfsfile > mfsfile_out &&
+  test_cmp mfsfile mfsfile_out &&
+  ipfs key list -l | grep "$(cat key_id)"
+'
+
+test_expect_success "restoring again skips existing entries" '
+  ipfs repo restore backup.tar > restore_again &&
+  grep "skipped existing key backupkey" restore_again &&
+  grep "skipped existing file /mfsfile" restore_again
+'
+
+test_expect_success "'ipfs repo restore --config' restores the identity" '
+  ipfs repo restore --config backup.tar &&
+  ipfs config Identity.PeerID > restored_id &&
+  IPFS_PATH="$(pwd)/.ipfs" ipfs config Identity.PeerID > orig_id &&
+  test_cmp orig_id restored_id
+'
+
+test_done
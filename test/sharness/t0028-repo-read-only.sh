@@ -0,0 +1,56 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test read-only commands sharing the repo with the daemon"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add some content" '
+  echo "read-only content" > file &&
+  HASH=$(ipfs add -q file)
+'
+
+test_launch_ipfs_daemon
+
+# Without the api file, commands run locally while the daemon holds the repo
+# lock.
+test_expect_success "hide the api file from the commands" '
+  mv "$IPFS_PATH/api" api.bak
+'
+
+test_expect_success "'ipfs cat' reads the repo locked by the daemon" '
+  ipfs cat $HASH > actual &&
+  test_cmp file actual
+'
+
+test_expect_success "'ipfs block stat' and 'ipfs refs' work too" '
+  ipfs block stat $HASH > stat_out &&
+  grep "Key: $HASH" stat_out &&
+  ipfs refs -r $HASH
+'
+
+test_expect_success "commands writing to the repo still fail" '
+  echo "more content" | test_must_fail ipfs add -q 2> add_err &&
+  grep -i "lock" add_err
+'
+
+test_expect_success "restore the api file" '
+  mv api.bak "$IPFS_PATH/api"
+'
+
+test_expect_success "'ipfs repo compact' fails while the daemon runs" '
+  test_must_fail ipfs repo compact
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "'ipfs cat' works with the unlocked repo" '
+  ipfs cat $HASH > actual &&
+  test_cmp file actual
+'
+
+test_done
@@ -0,0 +1,82 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test named repos served by one daemon"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create a named repo offline" '
+  ipfs repo named create --bits=1024 alice > create_out &&
+  grep "created repo alice" create_out &&
+  test -f "$IPFS_PATH/repos/alice/config"
+'
+
+test_expect_success "invalid names are refused" '
+  test_must_fail ipfs repo named create ../bob
+'
+
+test_expect_success "named repos can be used without the daemon" '
+  echo "alice content" > alice_file &&
+  ALICE_HASH=$(ipfs --repo-name=alice add -q alice_file) &&
+  ipfs --repo-name=alice pin ls --type=recursive > alice_pins &&
+  grep $ALICE_HASH alice_pins
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the daemon serves the named repo" '
+  ipfs repo named ls > ls_out &&
+  grep "^alice  *Qm" ls_out
+'
+
+test_expect_success "create another named repo on the daemon" '
+  ipfs repo named create --bits=1024 bob &&
+  ipfs repo named ls > ls_out &&
+  grep "^bob  *Qm" ls_out
+'
+
+test_expect_success "the pins of the repos are separate" '
+  echo "bob content" > bob_file &&
+  BOB_HASH=$(ipfs --repo-name=bob add -q bob_file) &&
+  ipfs --repo-name=bob pin ls --type=recursive > bob_pins &&
+  grep $BOB_HASH bob_pins &&
+  test_must_fail grep $ALICE_HASH bob_pins &&
+  ipfs pin ls --type=recursive > main_pins &&
+  test_must_fail grep $BOB_HASH main_pins
+'
+
+test_expect_success "the blocks of the repos are separate" '
+  ipfs refs local > main_refs &&
+  test_must_fail grep $BOB_HASH main_refs &&
+  ipfs --repo-name=bob refs local > bob_refs &&
+  grep $BOB_HASH bob_refs
+'
+
+test_expect_success "the MFS roots of the repos are separate" '
+  ipfs --repo-name=bob files cp /ipfs/$BOB_HASH /bob_file &&
+  ipfs --repo-name=bob files ls / > bob_files &&
+  grep bob_file bob_files &&
+  ipfs files ls / > main_files &&
+  test_must_fail grep bob_file main_files
+'
+
+test_expect_success "the keys of the repos are separate" '
+  ipfs --repo-name=bob key gen --type=rsa --size=1024 bobkey &&
+  ipfs --repo-name=bob key list > bob_keys &&
+  grep bobkey bob_keys &&
+  ipfs key list > main_keys &&
+  test_must_fail grep bobkey main_keys
+'
+
+test_expect_success "unknown repos are refused" '
+  test_must_fail ipfs --repo-name=carol pin ls 2> carol_err &&
+  grep "no repo named" carol_err
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -702,6 +702,17 @@ test_add_pwd_is_symlink
 
 test_add_cat_raw
 
+test_expect_success "ipfs add --progress-format=json succeeds" '
+  echo "json progress" > jsonprogress.txt &&
+  ipfs add --progress-format=json jsonprogress.txt > json_progress_out
+'
+
+test_expect_success "ipfs add --progress-format=json output looks good" '
+  HASH=$(ipfs add -q --only-hash jsonprogress.txt) &&
+  grep "\"Type\":\"progress\",\"Name\":\"jsonprogress.txt\",\"Bytes\":14" json_progress_out &&
+  grep "\"Type\":\"added\",\"Name\":\"jsonprogress.txt\",\"Hash\":\"$HASH\"" json_progress_out
+'
+
 test_expect_success "ipfs add --cid-version=9 fails" '
   echo "context" > afile.txt &&
   test_must_fail ipfs add --cid-version=9 afile.txt 2>&1 | tee add_out &&
@@ -25,6 +25,16 @@ test_expect_success "test ping other" '
   ipfsi 1 ping -n2 -- "$PEERID_0"
 '
 
+test_expect_success "test ping with interval" '
+  ipfsi 0 ping -n3 --interval=100ms -- "$PEERID_1" > ping_out &&
+  test $(grep -c "Pong received" ping_out) -eq 3 &&
+  grep "Average latency" ping_out
+'
+
+test_expect_success "test ping with invalid interval" '
+  test_must_fail ipfsi 0 ping -n1 --interval=never -- "$PEERID_1"
+'
+
 test_expect_success "test ping unreachable peer" '
   printf "Looking up peer %s\n" "$BAD_PEER" > bad_ping_exp &&
   printf "Peer lookup error: routing: not found\n" >> bad_ping_exp &&
@@ -49,5 +49,26 @@ test_expect_success "command shows up as inactive" '
   grep "log/tail" cmd_out3 | grep "false"
 '
 
+test_expect_success "log tail rejects an invalid level" '
+  test_must_fail ipfs log tail --level=loud 2> tail_err &&
+  grep "invalid log level" tail_err
+'
+
+test_expect_success "start filtered log tail" '
+  ipfs log tail --subsystem=core,bitswap --level=error > tail_out &
+  LOGPID=$!
+  go-sleep 100ms
+'
+
+test_expect_success "filtered log tail shows up in output" '
+  ipfs diag cmds > cmd_out4 &&
+  grep "log/tail" cmd_out4 | grep "true" > /dev/null
+'
+
+test_expect_success "kill filtered log cmd" '
+  kill $LOGPID
+  wait $LOGPID || true
+'
+
 test_kill_ipfs_daemon
 test_done
@@ -48,6 +48,24 @@ test_expect_success "'ipfs pin rm' output looks good" '
   test_cmp expected1 actual1
 '
 
+test_expect_success "'ipfs repo gc --dry-run' reports the unpinned file" '
+  ipfs repo gc --dry-run >dry_run_out &&
+  grep "^would remove  *1 blocks" dry_run_out &&
+  grep "^  unreferenced  *1 blocks" dry_run_out &&
+  ipfs repo gc --dry-run --quiet >dry_run_quiet &&
+  test "$(cut -f1 dry_run_quiet)" = 1
+'
+
+test_expect_success "'ipfs repo gc --dry-run' doesnt remove the file" '
+  ipfs block stat "$HASH"
+'
+
+test_expect_success "'ipfs repo gc --progress' reports the totals" '
+  ipfs repo gc --progress >progress_out &&
+  grep "^mark:" progress_out &&
+  grep "^done: scanned [0-9]*, removed 1 (.*), kept [0-9]*, 0 errors" progress_out
+'
+
 test_expect_success "ipfs repo gc fully reverse ipfs add (part 1)" '
   ipfs repo gc &&
   random 100000 41 >gcfile &&
@@ -227,6 +245,33 @@ test_expect_success "'ipfs refs --unique --recursive (bigger)'" '
   test_sort_cmp expected actual || test_fsh cat refs_output
 '
 
+test_expect_success "'ipfs refs --unique-edges --recursive (bigger)'" '
+  ipfs refs -r --format="<src> <dst> <linkname>" "$hash" >edges_output &&
+  sort edges_output | uniq >expected &&
+  ipfs refs -r --unique-edges --format="<src> <dst> <linkname>" "$hash" >actual &&
+  test_sort_cmp expected actual || test_fsh cat edges_output
+'
+
+test_expect_success "'ipfs refs --max-depth' limits the output" '
+  ipfs refs -r --max-depth=1 "$hash" >expected &&
+  ipfs refs "$hash" >actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs refs --codec' filters the output" '
+  ipfs refs -r --codec=dag-pb "$hash" >actual &&
+  test_cmp refs_output actual &&
+  ipfs refs -r --codec=protobuf "$hash" >actual &&
+  test_cmp refs_output actual &&
+  ipfs refs -r --codec=raw "$hash" >actual &&
+  test_must_be_empty actual
+'
+
+test_expect_success "'ipfs refs --codec' rejects unknown codecs" '
+  test_must_fail ipfs refs --codec=nope "$hash" 2>err &&
+  grep "unknown codec" err
+'
+
 get_field_num() {
   field=$1
   file=$2
@@ -266,6 +311,20 @@ test_expect_success "repo stats came out correct for --size-only" '
   grep -v "Version" repo-stats-size-only
 '
 
+test_expect_success "'ipfs stats all' succeeds" '
+  ipfs stats all --enc=json > stats-all
+'
+
+test_expect_success "'ipfs stats all' includes the repo stats" '
+  grep "\"NumObjects\"" stats-all &&
+  grep "\"RepoSize\"" stats-all
+'
+
+test_expect_success "'ipfs stats all' has no network stats offline" '
+  test_must_fail grep "\"Bitswap\"" stats-all &&
+  test_must_fail grep "\"ConnMgr\"" stats-all
+'
+
 test_expect_success "'ipfs repo version' succeeds" '
   ipfs repo version > repo-version
 '
@@ -281,6 +340,26 @@ test_expect_success "repo version came out correct" '
   egrep "^fs-repo@[0-9]+" repo-version-q >/dev/null
 '
 
+test_expect_success "'ipfs repo cache' shows the default cache sizes" '
+  ipfs repo cache > repo-cache &&
+  grep "ARCCacheSize: *65536" repo-cache &&
+  grep "HitRate:" repo-cache
+'
+
+test_expect_success "'ipfs repo cache' resizes the caches" '
+  ipfs repo cache --arc-size=0 --bloom-size=4096 > repo-cache &&
+  grep "ARCCacheSize: *0" repo-cache &&
+  grep "BloomFilterSize: *4096" repo-cache &&
+  grep "BloomFilterHashes: *7" repo-cache &&
+  CACHEHASH=$(echo "cached" | ipfs add -q) &&
+  ipfs cat "$CACHEHASH" > /dev/null
+'
+
+test_expect_success "'ipfs repo cache' counts the requests" '
+  ipfs repo cache --enc=json > repo-cache.json &&
+  test_must_fail grep "\"Requests\":0," repo-cache.json
+'
+
 test_kill_ipfs_daemon
 
 test_expect_success "remove Datastore.StorageMax from config" '
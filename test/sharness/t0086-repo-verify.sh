@@ -57,4 +57,41 @@ do
   check_random_corruption
 done
 
+test_expect_success "'ipfs repo verify --check-pins' passes" '
+  ipfs repo verify --check-pins
+'
+
+# a single raw leaf, whose block holds the content of the file
+test_expect_success "add a known block" '
+  echo "the block to corrupt" > known &&
+  KNOWN=$(ipfs add -q --raw-leaves known) &&
+  to_break=$(grep -rlx "the block to corrupt" "$IPFS_PATH/blocks") &&
+  test_path_is_file "$to_break"
+'
+
+test_expect_success "corrupt it" '
+  echo "this is super broken" > "$to_break"
+'
+
+test_expect_success "'ipfs repo verify --delete-corrupt' removes it" '
+  test_expect_code 0 ipfs repo verify --delete-corrupt > verify_out &&
+  grep "was removed" verify_out &&
+  test_path_is_missing "$to_break" &&
+  test_must_fail ipfs block stat "$KNOWN"
+'
+
+test_expect_success "'ipfs repo verify' passes without the block" '
+  ipfs repo verify
+'
+
+test_expect_success "'ipfs repo verify --check-pins' reports the missing block" '
+  test_expect_code 1 ipfs repo verify --check-pins > pins_out &&
+  grep "pinned content is incomplete" pins_out
+'
+
+test_expect_success "'ipfs repo verify --refetch' requires the daemon" '
+  test_must_fail ipfs repo verify --refetch 2> refetch_err &&
+  grep "requires a running daemon" refetch_err
+'
+
 test_done
@@ -0,0 +1,46 @@
+#!/usr/bin/env bash
+#
+# MIT Licensed; see the LICENSE file in this repository.
+#
+
+test_description="Test enforcing Datastore.StorageMax"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "generate a 10 kB file and a 2 MB file" '
+  random 10k 41 >10k &&
+  random 2M 42 >2M
+'
+
+test_expect_success "set a 1MB storage max" '
+  test_config_set Datastore.StorageMax "1MB"
+'
+
+test_launch_ipfs_daemon --enforce-storage-max
+
+test_expect_success "stats report the storage usage" '
+  ipfs stats all >stats &&
+  grep "StorageUsage" stats &&
+  grep "StorageMaxEnforced: true" stats
+'
+
+test_expect_success "adding data below storage max works" '
+  ipfs add -q 10k >hash
+'
+
+test_expect_success "adding data beyond storage max fails" '
+  test_must_fail ipfs add 2M 2>add_err &&
+  grep "storage quota exceeded" add_err
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "enforcing storage max requires it to be set" '
+  test_config_set Datastore.StorageMax "" &&
+  test_must_fail ipfs daemon --enforce-storage-max 2>daemon_err &&
+  grep "requires Datastore.StorageMax" daemon_err
+'
+
+test_done
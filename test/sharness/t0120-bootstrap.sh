@@ -167,6 +167,15 @@ test_bootstrap_cmd() {
 # should work offline
 test_bootstrap_cmd
 
+test_expect_success "'ipfs bootstrap add' keeps the config keys it doesn't know" '
+  ipfs config --json Gateway.RateLimit.Burst 10 &&
+  ipfs bootstrap add "$BP1" &&
+  echo 10 >burst_expected &&
+  ipfs config Gateway.RateLimit.Burst >burst_actual &&
+  test_cmp burst_expected burst_actual &&
+  ipfs bootstrap rm --all
+'
+
 # should work online
 test_launch_ipfs_daemon
 test_bootstrap_cmd
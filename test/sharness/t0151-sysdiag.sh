@@ -45,4 +45,16 @@ test_expect_success "output is similar to uname" '
   esac
 '
 
+test_expect_success "ipfs diag profile succeeds" '
+  ipfs diag profile --profile-time=1s -o profile.zip > profile_out &&
+  grep "Wrote profiles to: profile.zip" profile_out
+'
+
+test_expect_success "profile contains the expected files" '
+  test -s profile.zip &&
+  for f in goroutines.stacks heap.pprof cpu.pprof version.json config.json; do
+    grep -a "$f" profile.zip >/dev/null || return 1
+  done
+'
+
 test_done
@@ -77,6 +77,18 @@ test_expect_success "'ipfs bitswap wantlist -p' output looks good" '
   test_cmp wantlist_out wantlist_p_out
 '
 
+test_expect_success "'ipfs bitswap ledger' without partners succeeds" '
+  ipfs bitswap ledger >ledger_out &&
+  test_must_be_empty ledger_out
+'
+
+test_expect_success "'ipfs bitswap ledger' for a peer succeeds" '
+  ipfs bitswap ledger QmbBHw1Xx9pUpAbrVZUKTPL5Rsph5Q9GQhRvcWVBPFgGtC >ledger_out &&
+  grep "Debt ratio:" ledger_out &&
+  grep "Blocks sent:.0" ledger_out &&
+  grep "Messages received:.0" ledger_out
+'
+
 test_kill_ipfs_daemon
 
 test_done
@@ -623,10 +623,43 @@ test_files_api() {
     ipfs files stat "/parents/foo/bar/baz/qux/quux/garply/ipfs2.txt" | grep -q "^Type: file"
   '
 
+  test_expect_success "should fail to copy into missing directories with no --parents flag set $EXTRA" '
+    test_must_fail ipfs files cp /foobar /cp-parents/a/b/foobar
+  '
+
+  test_expect_success "can copy and create intermediate directories $EXTRA" '
+    ipfs files cp --parents /foobar /cp-parents/a/b/foobar &&
+    ipfs files read /cp-parents/a/b/foobar > cp_parents_out &&
+    echo "blah" > cp_parents_exp &&
+    test_cmp cp_parents_exp cp_parents_out
+  '
+
+  test_expect_success "can copy from an /ipld/ path $EXTRA" '
+    FOOBAR=$(ipfs files stat --hash /foobar) &&
+    ipfs files cp /ipld/$FOOBAR /cp-parents/ipld-foobar &&
+    ipfs files stat --hash /cp-parents/ipld-foobar > cp_ipld_out &&
+    echo $FOOBAR > cp_ipld_exp &&
+    test_cmp cp_ipld_exp cp_ipld_out
+  '
+
+  test_expect_success "can copy from an /ipns/ path $EXTRA" '
+    PEERID=$(ipfs config Identity.PeerID) &&
+    ipfs name publish --allow-offline /ipfs/$FOOBAR &&
+    ipfs files cp -p /ipns/$PEERID /cp-parents/ipns/foobar &&
+    ipfs files stat --hash /cp-parents/ipns/foobar > cp_ipns_out &&
+    test_cmp cp_ipld_exp cp_ipns_out
+  '
+
+  test_expect_success "should fail to copy a non unixfs node $EXTRA" '
+    CBOR=$(echo "{\"a\": 1}" | ipfs dag put) &&
+    test_must_fail ipfs files cp /ipld/$CBOR /cp-parents/cbor
+  '
+
   test_expect_success "clean up $EXTRA" '
     ipfs files rm -r /foobar &&
     ipfs files rm -r /adir &&
-    ipfs files rm -r /parents
+    ipfs files rm -r /parents &&
+    ipfs files rm -r /cp-parents
   '
 
   test_expect_success "root mfs entry is empty $EXTRA" '
@@ -725,6 +758,80 @@ tests_for_files_api() {
 
 tests_for_files_api "online"
 
+test_expect_success "can set the mode and mtime of a file" '
+  ipfs files mkdir /meta &&
+  echo hello | ipfs files write --create /meta/file &&
+  ipfs files chmod 0640 /meta/file &&
+  ipfs files touch --mtime=1500000000 /meta/file &&
+  ipfs files stat /meta/file > meta_stat &&
+  grep "^Mode: 0640$" meta_stat &&
+  grep "^Mtime: 2017-07-14T02:40:00Z$" meta_stat
+'
+
+test_expect_success "setting the metadata keeps the content" '
+  echo hello > meta_expect &&
+  ipfs files read /meta/file > meta_actual &&
+  test_cmp meta_expect meta_actual
+'
+
+test_expect_success "touch creates missing files" '
+  ipfs files touch /meta/new &&
+  ipfs files read /meta/new > new_actual &&
+  test_must_be_empty new_actual
+'
+
+test_expect_success "chmod rejects invalid modes" '
+  test_must_fail ipfs files chmod 99 /meta/file &&
+  test_must_fail ipfs files chmod 010000 /meta/file
+'
+
+test_expect_success "cleanup metadata tests" '
+  ipfs files rm -r /meta
+'
+
+test_expect_success "can apply a batch of operations" '
+  echo "{\"Op\": \"write\", \"Path\": \"/batch/a\", \"Data\": \"aGVsbG8K\"}" > ops.json &&
+  echo "{\"Op\": \"mv\", \"From\": \"/batch/a\", \"Path\": \"/batch/b\"}" >> ops.json &&
+  ipfs files batch ops.json > batch_root &&
+  ipfs files stat --hash / > root_actual &&
+  test_cmp batch_root root_actual &&
+  echo hello > batch_expect &&
+  ipfs files read /batch/b > batch_actual &&
+  test_cmp batch_expect batch_actual &&
+  test_must_fail ipfs files stat /batch/a
+'
+
+test_expect_success "a failing batch changes nothing" '
+  echo "{\"Op\": \"rm\", \"Path\": \"/batch/b\"}" > ops.json &&
+  echo "{\"Op\": \"rm\", \"Path\": \"/batch/missing\"}" >> ops.json &&
+  test_must_fail ipfs files batch ops.json &&
+  ipfs files stat /batch/b
+'
+
+test_expect_success "cleanup batch tests" '
+  ipfs files rm -r /batch
+'
+
+test_expect_success "can export a directory" '
+  echo foo | ipfs files write --create --parents /exp/sub/foo &&
+  echo bar | ipfs files write --create /exp/bar &&
+  ipfs files export /exp exported &&
+  echo foo > foo_expect &&
+  test_cmp foo_expect exported/sub/foo &&
+  echo bar > bar_expect &&
+  test_cmp bar_expect exported/bar
+'
+
+test_expect_success "can export a file" '
+  ipfs files export /exp/bar exported_bar &&
+  test_cmp bar_expect exported_bar
+'
+
+test_expect_success "cleanup export tests" '
+  ipfs files rm -r /exp &&
+  rm -rf exported exported_bar
+'
+
 test_launch_ipfs_daemon --offline
 
 ONLINE=1 # set online flag so tests can easily tell
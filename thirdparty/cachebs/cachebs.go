@@ -0,0 +1,178 @@
+// Package cachebs implements a blockstore whose caches can be resized while
+// it's in use, and which counts the requests its caches answer.
+package cachebs
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	metrics "gx/ipfs/QmekzFM3hPZjTjUFGTABdQkEnQ3PTiMstY198PwSFr5w1Q/go-metrics-interface"
+)
+
+// Stats counts the Has, Get and GetSize requests made to the blockstore.
+type Stats struct {
+	// Requests is the number of requests made
+	Requests uint64
+
+	// Misses is the number of requests the caches couldn't answer
+	Misses uint64
+}
+
+// HitRate returns the fraction of the requests answered by the caches.
+func (s Stats) HitRate() float64 {
+	if s.Requests == 0 || s.Misses > s.Requests {
+		return 0
+	}
+	return float64(s.Requests-s.Misses) / float64(s.Requests)
+}
+
+// Blockstore wraps a blockstore with the bloom filter and ARC caches of
+// go-ipfs-blockstore. Resizing the caches replaces them with empty ones.
+type Blockstore struct {
+	// accessed atomically, keep first for alignment
+	requests uint64
+
+	base *counting
+	ctx  context.Context
+
+	requestsTotal metrics.Counter
+
+	lk     sync.RWMutex
+	cached bstore.Blockstore
+	opts   bstore.CacheOpts
+	cancel context.CancelFunc
+}
+
+var _ bstore.Blockstore = (*Blockstore)(nil)
+
+// New returns a Blockstore caching bs with the given options. Caches with a
+// size of 0 are disabled. ctx bounds the building of the bloom filter, and
+// holds the metrics scope.
+func New(ctx context.Context, bs bstore.Blockstore, opts bstore.CacheOpts) (*Blockstore, error) {
+	mctx := metrics.CtxSubScope(ctx, "bs.cache")
+	b := &Blockstore{
+		base: &counting{
+			Blockstore: bs,
+			missesTotal: metrics.NewCtx(mctx, "misses_total",
+				"Number of blockstore requests not answered by the caches").Counter(),
+		},
+		ctx: ctx,
+		requestsTotal: metrics.NewCtx(mctx, "requests_total",
+			"Number of blockstore requests made to the caches").Counter(),
+	}
+	if err := b.Resize(opts); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Resize replaces the caches with empty ones of the given sizes. The bloom
+// filter is built in the background, as when creating the blockstore.
+func (b *Blockstore) Resize(opts bstore.CacheOpts) error {
+	ctx, cancel := context.WithCancel(b.ctx)
+	cached, err := bstore.CachedBlockstore(ctx, b.base, opts)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	b.lk.Lock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.cached, b.opts, b.cancel = cached, opts, cancel
+	b.lk.Unlock()
+	return nil
+}
+
+// Options returns the current cache options.
+func (b *Blockstore) Options() bstore.CacheOpts {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	return b.opts
+}
+
+// Stats returns the requests counted since the blockstore was created.
+func (b *Blockstore) Stats() Stats {
+	return Stats{
+		Requests: atomic.LoadUint64(&b.requests),
+		Misses:   atomic.LoadUint64(&b.base.misses),
+	}
+}
+
+func (b *Blockstore) current() bstore.Blockstore {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	return b.cached
+}
+
+func (b *Blockstore) request() bstore.Blockstore {
+	atomic.AddUint64(&b.requests, 1)
+	b.requestsTotal.Inc()
+	return b.current()
+}
+
+func (b *Blockstore) Has(c cid.Cid) (bool, error) {
+	return b.request().Has(c)
+}
+
+func (b *Blockstore) Get(c cid.Cid) (blocks.Block, error) {
+	return b.request().Get(c)
+}
+
+func (b *Blockstore) GetSize(c cid.Cid) (int, error) {
+	return b.request().GetSize(c)
+}
+
+func (b *Blockstore) Put(blk blocks.Block) error {
+	return b.current().Put(blk)
+}
+
+func (b *Blockstore) PutMany(blks []blocks.Block) error {
+	return b.current().PutMany(blks)
+}
+
+func (b *Blockstore) DeleteBlock(c cid.Cid) error {
+	return b.current().DeleteBlock(c)
+}
+
+func (b *Blockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	return b.current().AllKeysChan(ctx)
+}
+
+func (b *Blockstore) HashOnRead(enabled bool) {
+	b.current().HashOnRead(enabled)
+}
+
+// counting counts the requests reaching the cached blockstore.
+type counting struct {
+	// accessed atomically, keep first for alignment
+	misses uint64
+
+	bstore.Blockstore
+	missesTotal metrics.Counter
+}
+
+func (c *counting) miss() {
+	atomic.AddUint64(&c.misses, 1)
+	c.missesTotal.Inc()
+}
+
+func (c *counting) Has(k cid.Cid) (bool, error) {
+	c.miss()
+	return c.Blockstore.Has(k)
+}
+
+func (c *counting) Get(k cid.Cid) (blocks.Block, error) {
+	c.miss()
+	return c.Blockstore.Get(k)
+}
+
+func (c *counting) GetSize(k cid.Cid) (int, error) {
+	c.miss()
+	return c.Blockstore.GetSize(k)
+}
@@ -0,0 +1,70 @@
+package cachebs
+
+import (
+	"context"
+	"testing"
+
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func checkStats(t *testing.T, bs *Blockstore, requests, misses uint64) {
+	t.Helper()
+	st := bs.Stats()
+	if st.Requests != requests || st.Misses != misses {
+		t.Fatalf("expected %d requests and %d misses, got %d and %d",
+			requests, misses, st.Requests, st.Misses)
+	}
+}
+
+func TestStatsAndResize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	base := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	bs, err := New(ctx, base, bstore.CacheOpts{HasARCCacheSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := blocks.NewBlock([]byte("foo"))
+	b := blocks.NewBlock([]byte("bar"))
+	if err := bs.Put(a); err != nil {
+		t.Fatal(err)
+	}
+
+	// The block just stored is in the ARC cache.
+	if has, err := bs.Has(a.Cid()); err != nil || !has {
+		t.Fatal("expected to have a", err)
+	}
+	checkStats(t, bs, 1, 0)
+
+	// Missing blocks are looked up once.
+	for i := 0; i < 2; i++ {
+		if has, err := bs.Has(b.Cid()); err != nil || has {
+			t.Fatal("expected not to have b", err)
+		}
+	}
+	checkStats(t, bs, 3, 1)
+
+	if err := bs.Resize(bstore.CacheOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if bs.Options().HasARCCacheSize != 0 {
+		t.Fatal("expected the ARC cache to be disabled")
+	}
+	if _, err := bs.Get(a.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	checkStats(t, bs, 4, 2)
+
+	if r := bs.Stats().HitRate(); r != 0.5 {
+		t.Fatalf("expected a hit rate of 0.5, got %f", r)
+	}
+
+	if err := bs.Resize(bstore.CacheOpts{HasARCCacheSize: -1}); err == nil {
+		t.Fatal("expected invalid options to be refused")
+	}
+}
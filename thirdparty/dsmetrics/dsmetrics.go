@@ -0,0 +1,319 @@
+// Package dsmetrics implements a datastore exporting prometheus metrics on
+// the latency, throughput and errors of its operations, by operation and by
+// namespace, i.e., the first component of the keys.
+package dsmetrics
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	prometheus "gx/ipfs/QmTQuFQWHAWy4wMH6ZyPfGiawA5u9T8rs79FENoV8yXaoS/client_golang/prometheus"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// Operations reported by the metrics.
+const (
+	opGet         = "get"
+	opPut         = "put"
+	opHas         = "has"
+	opGetSize     = "get_size"
+	opDelete      = "delete"
+	opQuery       = "query"
+	opBatchCommit = "batch_commit"
+)
+
+// Namespaces which aren't a short lowercase word, e.g. the base32 encoded
+// keys of DHT records, are reported as "other", and the operations of a batch
+// spanning several namespaces as "mixed". The number of namespaces reported
+// is capped, to bound the number of metrics.
+const (
+	nsOther = "other"
+	nsMixed = "mixed"
+
+	maxNamespaces = 32
+	maxNsLength   = 32
+)
+
+type metrics struct {
+	duration *prometheus.HistogramVec
+	bytes    *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+}
+
+func newMetrics() (*metrics, error) {
+	duration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "ipfs",
+			Subsystem: "fsrepo_datastore",
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of the datastore operations by operation and key namespace, in seconds.",
+			Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 12),
+		},
+		[]string{"op", "namespace"},
+	)
+	if err := prometheus.Register(duration); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			duration = are.ExistingCollector.(*prometheus.HistogramVec)
+		} else {
+			return nil, err
+		}
+	}
+
+	bytes := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ipfs",
+			Subsystem: "fsrepo_datastore",
+			Name:      "bytes_total",
+			Help:      "Number of bytes read and written by the datastore operations by operation and key namespace.",
+		},
+		[]string{"op", "namespace"},
+	)
+	if err := prometheus.Register(bytes); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			bytes = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			return nil, err
+		}
+	}
+
+	errs := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ipfs",
+			Subsystem: "fsrepo_datastore",
+			Name:      "errors_total",
+			Help:      "Number of failed datastore operations by operation and key namespace. Missing keys aren't counted.",
+		},
+		[]string{"op", "namespace"},
+	)
+	if err := prometheus.Register(errs); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			errs = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			return nil, err
+		}
+	}
+
+	return &metrics{duration: duration, bytes: bytes, errors: errs}, nil
+}
+
+// Datastore wraps a datastore to record the metrics of its operations.
+type Datastore struct {
+	child ds.Batching
+	m     *metrics
+
+	nsLk sync.RWMutex
+	ns   map[string]struct{}
+}
+
+var (
+	_ ds.Batching          = (*Datastore)(nil)
+	_ ds.GCDatastore       = (*Datastore)(nil)
+	_ ds.CheckedDatastore  = (*Datastore)(nil)
+	_ ds.ScrubbedDatastore = (*Datastore)(nil)
+)
+
+// New wraps d, registering the metrics with the default prometheus registry
+// if needed.
+func New(d ds.Batching) (*Datastore, error) {
+	m, err := newMetrics()
+	if err != nil {
+		return nil, err
+	}
+	return &Datastore{
+		child: d,
+		m:     m,
+		ns:    make(map[string]struct{}),
+	}, nil
+}
+
+// namespace returns the namespace of key reported in the metrics.
+func (d *Datastore) namespace(key string) string {
+	ns := key
+	if strings.HasPrefix(ns, "/") {
+		ns = ns[1:]
+	}
+	if i := strings.IndexByte(ns, '/'); i >= 0 {
+		ns = ns[:i]
+	}
+	if !validNamespace(ns) {
+		return nsOther
+	}
+
+	d.nsLk.RLock()
+	_, ok := d.ns[ns]
+	d.nsLk.RUnlock()
+	if ok {
+		return ns
+	}
+
+	d.nsLk.Lock()
+	defer d.nsLk.Unlock()
+	if _, ok := d.ns[ns]; !ok {
+		if len(d.ns) >= maxNamespaces {
+			return nsOther
+		}
+		d.ns[ns] = struct{}{}
+	}
+	return ns
+}
+
+func validNamespace(ns string) bool {
+	if ns == "" || len(ns) > maxNsLength {
+		return false
+	}
+	for _, c := range ns {
+		if (c < 'a' || c > 'z') && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// observe records an operation which started at start. Missing keys aren't
+// errors.
+func (d *Datastore) observe(op, ns string, start time.Time, size int, err error) {
+	d.m.duration.WithLabelValues(op, ns).Observe(time.Since(start).Seconds())
+	if size > 0 {
+		d.m.bytes.WithLabelValues(op, ns).Add(float64(size))
+	}
+	if err != nil && err != ds.ErrNotFound {
+		d.m.errors.WithLabelValues(op, ns).Inc()
+	}
+}
+
+func (d *Datastore) Put(key ds.Key, value []byte) error {
+	start := time.Now()
+	err := d.child.Put(key, value)
+	d.observe(opPut, d.namespace(key.String()), start, len(value), err)
+	return err
+}
+
+func (d *Datastore) Get(key ds.Key) ([]byte, error) {
+	start := time.Now()
+	value, err := d.child.Get(key)
+	d.observe(opGet, d.namespace(key.String()), start, len(value), err)
+	return value, err
+}
+
+func (d *Datastore) Has(key ds.Key) (bool, error) {
+	start := time.Now()
+	has, err := d.child.Has(key)
+	d.observe(opHas, d.namespace(key.String()), start, 0, err)
+	return has, err
+}
+
+func (d *Datastore) GetSize(key ds.Key) (int, error) {
+	start := time.Now()
+	size, err := d.child.GetSize(key)
+	d.observe(opGetSize, d.namespace(key.String()), start, 0, err)
+	return size, err
+}
+
+func (d *Datastore) Delete(key ds.Key) error {
+	start := time.Now()
+	err := d.child.Delete(key)
+	d.observe(opDelete, d.namespace(key.String()), start, 0, err)
+	return err
+}
+
+// Query records the time taken to start the query, not to iterate over its
+// results.
+func (d *Datastore) Query(q dsq.Query) (dsq.Results, error) {
+	start := time.Now()
+	res, err := d.child.Query(q)
+	d.observe(opQuery, d.namespace(q.Prefix), start, 0, err)
+	return res, err
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	b, err := d.child.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &batch{Batch: b, d: d}, nil
+}
+
+func (d *Datastore) DiskUsage() (uint64, error) {
+	return ds.DiskUsage(d.child)
+}
+
+// CollectGarbage collects the garbage of the wrapped datastore, e.g. the
+// value log of badger, if it has any.
+func (d *Datastore) CollectGarbage() error {
+	if gc, ok := d.child.(ds.GCDatastore); ok {
+		return gc.CollectGarbage()
+	}
+	return nil
+}
+
+// Check checks the wrapped datastore, if it can be checked.
+func (d *Datastore) Check() error {
+	if c, ok := d.child.(ds.CheckedDatastore); ok {
+		return c.Check()
+	}
+	return nil
+}
+
+// Scrub scrubs the wrapped datastore, if it can be scrubbed.
+func (d *Datastore) Scrub() error {
+	if s, ok := d.child.(ds.ScrubbedDatastore); ok {
+		return s.Scrub()
+	}
+	return nil
+}
+
+func (d *Datastore) Close() error {
+	if c, ok := d.child.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// batch records the namespace and the size of the batched writes.
+type batch struct {
+	ds.Batch
+	d *Datastore
+
+	ns   string
+	size int
+}
+
+func (b *batch) add(key ds.Key, size int) {
+	ns := b.d.namespace(key.String())
+	switch b.ns {
+	case "":
+		b.ns = ns
+	case ns:
+	default:
+		b.ns = nsMixed
+	}
+	b.size += size
+}
+
+func (b *batch) Put(key ds.Key, value []byte) error {
+	b.add(key, len(value))
+	return b.Batch.Put(key, value)
+}
+
+func (b *batch) Delete(key ds.Key) error {
+	b.add(key, 0)
+	return b.Batch.Delete(key)
+}
+
+func (b *batch) Commit() error {
+	ns := b.ns
+	if ns == "" {
+		ns = nsOther
+	}
+
+	start := time.Now()
+	err := b.Batch.Commit()
+	b.d.observe(opBatchCommit, ns, start, b.size, err)
+	if err == nil {
+		b.ns, b.size = "", 0
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package dsmetrics
+
+import (
+	"fmt"
+	"testing"
+
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+)
+
+func newDatastore(t *testing.T) *Datastore {
+	d, err := New(ds.NewMapDatastore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestNamespace(t *testing.T) {
+	d := newDatastore(t)
+
+	for key, ns := range map[string]string{
+		"/blocks/CIQFOO":                  "blocks",
+		"/local/filesroot":                "local",
+		"/pins":                           "pins",
+		"/":                               nsOther,
+		"/F5UXA3TTF4JCB3SBCVTCCMRSMHVM4Y": nsOther,
+	} {
+		if got := d.namespace(key); got != ns {
+			t.Errorf("expected namespace %q for %s, got %q", ns, key, got)
+		}
+	}
+
+	// The number of namespaces is capped.
+	d = newDatastore(t)
+	for i := 0; i < maxNamespaces; i++ {
+		d.namespace(fmt.Sprintf("/ns%c%c/key", 'a'+i/26, 'a'+i%26))
+	}
+	if got := d.namespace("/blocks/CIQFOO"); got != nsOther {
+		t.Errorf("expected namespace %q over the cap, got %q", nsOther, got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	d := newDatastore(t)
+	if err := d.Put(ds.NewKey("/pins/C"), []byte("pin")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := d.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb := b.(*batch)
+
+	if err := b.Put(ds.NewKey("/blocks/A"), []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(ds.NewKey("/blocks/B"), []byte("barbaz")); err != nil {
+		t.Fatal(err)
+	}
+	if mb.ns != "blocks" || mb.size != 9 {
+		t.Fatalf("expected 9 bytes in blocks, got %d in %s", mb.size, mb.ns)
+	}
+
+	if err := b.Delete(ds.NewKey("/pins/C")); err != nil {
+		t.Fatal(err)
+	}
+	if mb.ns != nsMixed {
+		t.Fatalf("expected namespace %q, got %q", nsMixed, mb.ns)
+	}
+
+	if err := b.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := d.Get(ds.NewKey("/blocks/B")); err != nil || string(v) != "barbaz" {
+		t.Fatal("expected the batched value", err)
+	}
+}
+
+// maintainedDatastore counts the calls of the maintenance operations.
+type maintainedDatastore struct {
+	*ds.MapDatastore
+	gc, check, scrub int
+}
+
+func (d *maintainedDatastore) CollectGarbage() error {
+	d.gc++
+	return nil
+}
+
+func (d *maintainedDatastore) Check() error {
+	d.check++
+	return nil
+}
+
+func (d *maintainedDatastore) Scrub() error {
+	d.scrub++
+	return nil
+}
+
+func TestMaintenance(t *testing.T) {
+	child := &maintainedDatastore{MapDatastore: ds.NewMapDatastore()}
+	d, err := New(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wrapped ds.Datastore = d
+	gcd, ok := wrapped.(ds.GCDatastore)
+	if !ok {
+		t.Fatal("expected the datastore to collect garbage")
+	}
+	checked, ok := wrapped.(ds.CheckedDatastore)
+	if !ok {
+		t.Fatal("expected the datastore to be checked")
+	}
+	scrubbed, ok := wrapped.(ds.ScrubbedDatastore)
+	if !ok {
+		t.Fatal("expected the datastore to be scrubbed")
+	}
+
+	if err := gcd.CollectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+	if err := checked.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if err := scrubbed.Scrub(); err != nil {
+		t.Fatal(err)
+	}
+	if child.gc != 1 || child.check != 1 || child.scrub != 1 {
+		t.Fatalf("expected the operations to reach the wrapped datastore, got %+v", child)
+	}
+
+	// the datastores without them are left alone
+	d = newDatastore(t)
+	if err := d.CollectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+}
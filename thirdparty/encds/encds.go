@@ -0,0 +1,215 @@
+// Package encds implements a datastore encrypting the values it stores.
+package encds
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+// KeySize is the size of the keys, in bytes. Values are encrypted with
+// AES-256 in GCM mode.
+const KeySize = 32
+
+// ErrDecrypt is returned when a value can't be decrypted, because it was
+// encrypted with another key or was tampered with.
+var ErrDecrypt = errors.New("encds: failed to decrypt value, wrong key or corrupted data")
+
+// NewCipher returns the cipher encrypting values with key.
+func NewCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encds: key must be %d bytes long, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts data with a random nonce, which is prepended to the output.
+// ad is authenticated with data, and must be given to Open.
+func Seal(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, ad), nil
+}
+
+// Open decrypts data sealed with Seal.
+func Open(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	out, err := aead.Open(nil, nonce, sealed, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return out, nil
+}
+
+// Datastore encrypts the values stored in a child datastore. Keys are stored
+// in the clear, so that the child datastore can still be queried by prefix.
+// Each value is authenticated with its key: a value can't be moved to
+// another key without being detected.
+type Datastore struct {
+	child ds.Batching
+	aead  cipher.AEAD
+}
+
+var (
+	_ ds.Batching          = (*Datastore)(nil)
+	_ ds.GCDatastore       = (*Datastore)(nil)
+	_ ds.CheckedDatastore  = (*Datastore)(nil)
+	_ ds.ScrubbedDatastore = (*Datastore)(nil)
+)
+
+// New returns a Datastore encrypting the values stored in child with aead.
+func New(child ds.Batching, aead cipher.AEAD) *Datastore {
+	return &Datastore{child: child, aead: aead}
+}
+
+// Children implements the Shim interface of go-datastore.
+func (d *Datastore) Children() []ds.Datastore {
+	return []ds.Datastore{d.child}
+}
+
+func (d *Datastore) Put(key ds.Key, value []byte) error {
+	sealed, err := Seal(d.aead, value, key.Bytes())
+	if err != nil {
+		return err
+	}
+	return d.child.Put(key, sealed)
+}
+
+func (d *Datastore) Get(key ds.Key) ([]byte, error) {
+	sealed, err := d.child.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return Open(d.aead, sealed, key.Bytes())
+}
+
+func (d *Datastore) Has(key ds.Key) (bool, error) {
+	return d.child.Has(key)
+}
+
+// GetSize returns the size of the decrypted value.
+func (d *Datastore) GetSize(key ds.Key) (int, error) {
+	size, err := d.child.GetSize(key)
+	if err != nil {
+		return size, err
+	}
+	size -= d.aead.NonceSize() + d.aead.Overhead()
+	if size < 0 {
+		return -1, ErrDecrypt
+	}
+	return size, nil
+}
+
+func (d *Datastore) Delete(key ds.Key) error {
+	return d.child.Delete(key)
+}
+
+// Query runs the prefix part of q on the child datastore. Filters, orders,
+// limit and offset are applied to the decrypted entries.
+func (d *Datastore) Query(q dsq.Query) (dsq.Results, error) {
+	res, err := d.child.Query(dsq.Query{
+		Prefix:   q.Prefix,
+		KeysOnly: q.KeysOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !q.KeysOnly {
+		res = dsq.ResultsFromIterator(dsq.Query{Prefix: q.Prefix}, dsq.Iterator{
+			Next: func() (dsq.Result, bool) {
+				r, ok := res.NextSync()
+				if !ok || r.Error != nil {
+					return r, ok
+				}
+				r.Value, r.Error = Open(d.aead, r.Value, []byte(r.Key))
+				return r, true
+			},
+			Close: res.Close,
+		})
+	}
+
+	q.Prefix = ""
+	return dsq.NaiveQueryApply(q, res), nil
+}
+
+// DiskUsage returns the disk usage of the child datastore.
+func (d *Datastore) DiskUsage() (uint64, error) {
+	return ds.DiskUsage(d.child)
+}
+
+// CollectGarbage collects the garbage of the child datastore, e.g. the value
+// log of badger, if it has any.
+func (d *Datastore) CollectGarbage() error {
+	if gc, ok := d.child.(ds.GCDatastore); ok {
+		return gc.CollectGarbage()
+	}
+	return nil
+}
+
+// Check checks the child datastore, if it can be checked.
+func (d *Datastore) Check() error {
+	if c, ok := d.child.(ds.CheckedDatastore); ok {
+		return c.Check()
+	}
+	return nil
+}
+
+// Scrub scrubs the child datastore, if it can be scrubbed.
+func (d *Datastore) Scrub() error {
+	if s, ok := d.child.(ds.ScrubbedDatastore); ok {
+		return s.Scrub()
+	}
+	return nil
+}
+
+func (d *Datastore) Close() error {
+	if c, ok := d.child.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	b, err := d.child.Batch()
+	if err != nil {
+		return nil, err
+	}
+	return &batch{child: b, aead: d.aead}, nil
+}
+
+type batch struct {
+	child ds.Batch
+	aead  cipher.AEAD
+}
+
+func (b *batch) Put(key ds.Key, value []byte) error {
+	sealed, err := Seal(b.aead, value, key.Bytes())
+	if err != nil {
+		return err
+	}
+	return b.child.Put(key, sealed)
+}
+
+func (b *batch) Delete(key ds.Key) error {
+	return b.child.Delete(key)
+}
+
+func (b *batch) Commit() error {
+	return b.child.Commit()
+}
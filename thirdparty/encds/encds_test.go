@@ -0,0 +1,132 @@
+package encds
+
+import (
+	"bytes"
+	"testing"
+
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+func newDatastore(t *testing.T, child ds.Batching, key byte) *Datastore {
+	aead, err := NewCipher(bytes.Repeat([]byte{key}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(child, aead)
+}
+
+func TestEncrypt(t *testing.T) {
+	child := ds.NewMapDatastore()
+	d := newDatastore(t, child, 1)
+
+	k := ds.NewKey("/blocks/A")
+	if err := d.Put(k, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := child.Get(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatal("expected the value to be encrypted in the child datastore")
+	}
+
+	v, err := d.Get(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(v) != "secret" {
+		t.Fatalf("expected the decrypted value, got %q", v)
+	}
+	if size, err := d.GetSize(k); err != nil || size != len("secret") {
+		t.Fatalf("expected the size of the decrypted value, got %d, %v", size, err)
+	}
+
+	// another key can't decrypt the value
+	if _, err := newDatastore(t, child, 2).Get(k); err != ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt with another key, got %v", err)
+	}
+
+	// and the value can't be moved to another key
+	moved := ds.NewKey("/blocks/B")
+	if err := child.Put(moved, sealed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Get(moved); err != ErrDecrypt {
+		t.Fatalf("expected ErrDecrypt for a moved value, got %v", err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	d := newDatastore(t, ds.NewMapDatastore(), 1)
+	for k, v := range map[string]string{
+		"/blocks/A": "a",
+		"/blocks/B": "bb",
+		"/pins/C":   "c",
+	} {
+		if err := d.Put(ds.NewKey(k), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := d.Query(dsq.Query{
+		Prefix:  "/blocks",
+		Filters: []dsq.Filter{dsq.FilterValueCompare{Op: dsq.Equal, Value: []byte("bb")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != "/blocks/B" || string(entries[0].Value) != "bb" {
+		t.Fatalf("expected the decrypted entry of /blocks/B, got %v", entries)
+	}
+}
+
+// maintainedDatastore counts the maintenance operations run on it.
+type maintainedDatastore struct {
+	*ds.MapDatastore
+	gc, checks, scrubs int
+}
+
+func (d *maintainedDatastore) CollectGarbage() error {
+	d.gc++
+	return nil
+}
+
+func (d *maintainedDatastore) Check() error {
+	d.checks++
+	return nil
+}
+
+func (d *maintainedDatastore) Scrub() error {
+	d.scrubs++
+	return nil
+}
+
+func TestMaintenance(t *testing.T) {
+	child := &maintainedDatastore{MapDatastore: ds.NewMapDatastore()}
+	d := newDatastore(t, child, 1)
+
+	if err := d.CollectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Scrub(); err != nil {
+		t.Fatal(err)
+	}
+	if child.gc != 1 || child.checks != 1 || child.scrubs != 1 {
+		t.Fatalf("expected the child datastore to be maintained, got %d, %d and %d runs", child.gc, child.checks, child.scrubs)
+	}
+
+	// datastores without maintenance are fine
+	d = newDatastore(t, ds.NewMapDatastore(), 1)
+	if err := d.CollectGarbage(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,170 @@
+// Package quotabs implements a blockstore keeping track of the storage used
+// by the blocks it stores, to enforce a storage quota.
+package quotabs
+
+import (
+	"errors"
+	"sync"
+
+	cid "gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+)
+
+// ErrQuotaExceeded is returned when storing blocks would make the storage
+// used go over the quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded (Datastore.StorageMax), run 'ipfs repo gc' or unpin some files")
+
+// Blockstore tracks the storage used by a blockstore. The usage starts at
+// the size of the repo, and is updated as blocks are added and removed.
+//
+// When enforcing the quota, writes that would make the usage exceed the
+// maximum fail with ErrQuotaExceeded. Crossing the high watermark is
+// signaled on the HighWater channel, e.g. to start a garbage collection.
+type Blockstore struct {
+	bstore.Blockstore
+
+	max       uint64
+	highWater uint64
+	highc     chan struct{}
+
+	lk      sync.Mutex
+	usage   uint64
+	enforce bool
+}
+
+var _ bstore.Blockstore = (*Blockstore)(nil)
+
+// New returns a Blockstore tracking the storage used by bs, starting at
+// usage bytes.
+func New(bs bstore.Blockstore, usage, max, highWater uint64) *Blockstore {
+	return &Blockstore{
+		Blockstore: bs,
+		max:        max,
+		highWater:  highWater,
+		highc:      make(chan struct{}, 1),
+		usage:      usage,
+	}
+}
+
+// Usage returns the current estimate of the storage used, in bytes.
+func (b *Blockstore) Usage() uint64 {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.usage
+}
+
+// SetUsage resets the storage used, e.g. to the size of the repo measured
+// after a garbage collection.
+func (b *Blockstore) SetUsage(usage uint64) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.usage = usage
+}
+
+// Limits returns the maximum storage and the high watermark, in bytes.
+func (b *Blockstore) Limits() (max, highWater uint64) {
+	return b.max, b.highWater
+}
+
+// SetEnforce sets whether writes exceeding the maximum are refused.
+func (b *Blockstore) SetEnforce(enforce bool) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.enforce = enforce
+}
+
+// Enforced returns whether writes exceeding the maximum are refused.
+func (b *Blockstore) Enforced() bool {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return b.enforce
+}
+
+// HighWater returns a channel receiving a value when the usage goes above
+// the high watermark. Signals are dropped while one is pending.
+func (b *Blockstore) HighWater() <-chan struct{} {
+	return b.highc
+}
+
+// reserve accounts for size new bytes, failing if the quota is enforced and
+// they don't fit.
+func (b *Blockstore) reserve(size uint64) error {
+	b.lk.Lock()
+	if b.enforce && b.usage+size > b.max {
+		b.lk.Unlock()
+		return ErrQuotaExceeded
+	}
+	b.usage += size
+	high := b.usage > b.highWater
+	b.lk.Unlock()
+
+	if high {
+		select {
+		case b.highc <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (b *Blockstore) release(size uint64) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if size > b.usage {
+		size = b.usage
+	}
+	b.usage -= size
+}
+
+// newSize returns the size of the blocks that aren't stored yet.
+func (b *Blockstore) newSize(blks []blocks.Block) (uint64, error) {
+	var size uint64
+	for _, blk := range blks {
+		has, err := b.Blockstore.Has(blk.Cid())
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			size += uint64(len(blk.RawData()))
+		}
+	}
+	return size, nil
+}
+
+func (b *Blockstore) Put(blk blocks.Block) error {
+	return b.PutMany([]blocks.Block{blk})
+}
+
+func (b *Blockstore) PutMany(blks []blocks.Block) error {
+	size, err := b.newSize(blks)
+	if err != nil {
+		return err
+	}
+	if err := b.reserve(size); err != nil {
+		return err
+	}
+
+	if len(blks) == 1 {
+		err = b.Blockstore.Put(blks[0])
+	} else {
+		err = b.Blockstore.PutMany(blks)
+	}
+	if err != nil {
+		b.release(size)
+	}
+	return err
+}
+
+func (b *Blockstore) DeleteBlock(c cid.Cid) error {
+	size, err := b.Blockstore.GetSize(c)
+	if err != nil {
+		return b.Blockstore.DeleteBlock(c)
+	}
+
+	if err := b.Blockstore.DeleteBlock(c); err != nil {
+		return err
+	}
+	b.release(uint64(size))
+	return nil
+}
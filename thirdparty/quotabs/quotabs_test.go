@@ -0,0 +1,106 @@
+package quotabs
+
+import (
+	"testing"
+
+	bstore "gx/ipfs/QmS2aqUZLJp8kF1ihE5rvDGE5LvmKDPnx32w9Z1BW9xLV5/go-ipfs-blockstore"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dssync "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/sync"
+)
+
+func newBlockstore(usage, max, highWater uint64) *Blockstore {
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	return New(bs, usage, max, highWater)
+}
+
+func TestUsage(t *testing.T) {
+	bs := newBlockstore(10, 1000, 900)
+
+	a := blocks.NewBlock([]byte("foo"))
+	b := blocks.NewBlock([]byte("barbaz"))
+	if err := bs.PutMany([]blocks.Block{a, b}); err != nil {
+		t.Fatal(err)
+	}
+	if u := bs.Usage(); u != 19 {
+		t.Fatalf("expected usage 19, got %d", u)
+	}
+
+	// Blocks already stored don't count twice.
+	if err := bs.Put(a); err != nil {
+		t.Fatal(err)
+	}
+	if u := bs.Usage(); u != 19 {
+		t.Fatalf("expected usage 19 after storing a block twice, got %d", u)
+	}
+
+	if err := bs.DeleteBlock(a.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if u := bs.Usage(); u != 16 {
+		t.Fatalf("expected usage 16 after deleting a block, got %d", u)
+	}
+
+	bs.SetUsage(3)
+	if u := bs.Usage(); u != 3 {
+		t.Fatalf("expected usage 3 after reset, got %d", u)
+	}
+}
+
+func TestEnforce(t *testing.T) {
+	bs := newBlockstore(0, 10, 8)
+	big := blocks.NewBlock([]byte("0123456789a"))
+
+	// Not enforced: the write goes through.
+	if err := bs.Put(big); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.DeleteBlock(big.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	bs.SetEnforce(true)
+	if err := bs.Put(big); err != ErrQuotaExceeded {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if has, _ := bs.Has(big.Cid()); has {
+		t.Fatal("refused block was stored")
+	}
+	if u := bs.Usage(); u != 0 {
+		t.Fatalf("expected usage 0, got %d", u)
+	}
+
+	if err := bs.Put(blocks.NewBlock([]byte("0123456789"))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHighWater(t *testing.T) {
+	bs := newBlockstore(0, 100, 5)
+
+	if err := bs.Put(blocks.NewBlock([]byte("foo"))); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-bs.HighWater():
+		t.Fatal("signaled below the watermark")
+	default:
+	}
+
+	// Crossing the watermark several times signals once.
+	for _, s := range []string{"bar", "baz"} {
+		if err := bs.Put(blocks.NewBlock([]byte(s))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-bs.HighWater():
+	default:
+		t.Fatal("expected a signal over the watermark")
+	}
+	select {
+	case <-bs.HighWater():
+		t.Fatal("expected a single pending signal")
+	default:
+	}
+}
@@ -0,0 +1,437 @@
+// Package tieredds implements a datastore keeping the recently used values in
+// a fast, hot datastore and moving the least recently used ones to a slower,
+// cold datastore, e.g. on a second disk, once the hot datastore is full.
+//
+// Values read from the cold datastore are moved back to the hot one. The
+// datastore is meant for content addressed values, such as blocks: a value
+// rewritten while being moved between the datastores may be lost.
+package tieredds
+
+import (
+	"container/list"
+	"io"
+	"sync"
+
+	logging "gx/ipfs/QmcuXC5cxs79ro2cUuHs4HQ2bkDLJUYokwL8aivcX6HW3C/go-log"
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+var log = logging.Logger("tieredds")
+
+// maxReads bounds the number of cold values whose reads are counted before
+// being promoted.
+const maxReads = 100000
+
+// Options are the policy of a tiered datastore.
+type Options struct {
+	// HotMaxSize is the total size of the values of the hot datastore
+	// above which the least recently used ones are moved to the cold
+	// datastore, until they take 90% of it. 0 disables the demotion of
+	// values.
+	HotMaxSize uint64
+
+	// PromoteAfter is the number of reads of a value of the cold datastore
+	// after which it's moved back to the hot datastore. 0 disables the
+	// promotion of values.
+	PromoteAfter int
+}
+
+// Datastore stores values in a hot and a cold datastore, see the package
+// documentation.
+type Datastore struct {
+	hot  ds.Batching
+	cold ds.Batching
+	opts Options
+
+	lk      sync.Mutex
+	lru     *list.List // of *entry, most recently used first
+	entries map[ds.Key]*list.Element
+	used    uint64
+	gen     uint64
+	reads   map[ds.Key]int
+
+	demoteCh chan struct{}
+	closing  chan struct{}
+	done     sync.WaitGroup
+}
+
+// entry is a value of the hot datastore. gen changes when it's rewritten.
+type entry struct {
+	key  ds.Key
+	size int
+	gen  uint64
+}
+
+var _ ds.Batching = (*Datastore)(nil)
+
+// New returns a datastore moving values between hot and cold according to
+// opts. The values already in the hot datastore are indexed in the
+// background, as if they were the least recently used.
+func New(hot, cold ds.Batching, opts Options) *Datastore {
+	d := &Datastore{
+		hot:      hot,
+		cold:     cold,
+		opts:     opts,
+		lru:      list.New(),
+		entries:  make(map[ds.Key]*list.Element),
+		reads:    make(map[ds.Key]int),
+		demoteCh: make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+	}
+	d.done.Add(1)
+	go d.run()
+	return d
+}
+
+// Children implements the Shim interface of go-datastore.
+func (d *Datastore) Children() []ds.Datastore {
+	return []ds.Datastore{d.hot, d.cold}
+}
+
+// HotSize returns the total size of the values of the hot datastore indexed
+// so far.
+func (d *Datastore) HotSize() uint64 {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	return d.used
+}
+
+func (d *Datastore) run() {
+	defer d.done.Done()
+
+	if err := d.index(); err != nil {
+		log.Errorf("indexing the hot datastore: %s", err)
+	}
+	for {
+		d.demoteAll()
+		select {
+		case <-d.demoteCh:
+		case <-d.closing:
+			return
+		}
+	}
+}
+
+// index adds the values of the hot datastore to the LRU list.
+func (d *Datastore) index() error {
+	res, err := d.hot.Query(dsq.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		select {
+		case <-d.closing:
+			return nil
+		default:
+		}
+		if r.Error != nil {
+			return r.Error
+		}
+
+		key := ds.NewKey(r.Key)
+		size, err := d.hot.GetSize(key)
+		if err == ds.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		d.lk.Lock()
+		if _, ok := d.entries[key]; !ok {
+			d.entries[key] = d.lru.PushBack(&entry{key: key, size: size})
+			d.used += uint64(size)
+		}
+		d.lk.Unlock()
+	}
+	return nil
+}
+
+// touch marks the value at key as the most recently used. written tells
+// whether the value was just written to the hot datastore.
+func (d *Datastore) touch(key ds.Key, size int, written bool) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	el, ok := d.entries[key]
+	if !ok {
+		if !written {
+			// not indexed yet
+			return
+		}
+		el = d.lru.PushFront(&entry{key: key})
+		d.entries[key] = el
+	} else {
+		d.lru.MoveToFront(el)
+	}
+	if !written {
+		return
+	}
+
+	e := el.Value.(*entry)
+	d.used = d.used - uint64(e.size) + uint64(size)
+	d.gen++
+	e.size, e.gen = size, d.gen
+	delete(d.reads, key)
+
+	if d.opts.HotMaxSize > 0 && d.used > d.opts.HotMaxSize {
+		select {
+		case d.demoteCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// forget removes the value at key from the LRU list.
+func (d *Datastore) forget(key ds.Key) {
+	d.lk.Lock()
+	defer d.lk.Unlock()
+	if el, ok := d.entries[key]; ok {
+		d.remove(el)
+	}
+	delete(d.reads, key)
+}
+
+func (d *Datastore) remove(el *list.Element) {
+	e := d.lru.Remove(el).(*entry)
+	delete(d.entries, e.key)
+	d.used -= uint64(e.size)
+}
+
+// demoteAll moves the least recently used values to the cold datastore until
+// the hot one is at 90% of its maximum size.
+func (d *Datastore) demoteAll() {
+	if d.opts.HotMaxSize == 0 {
+		return
+	}
+	target := d.opts.HotMaxSize / 10 * 9
+
+	for {
+		select {
+		case <-d.closing:
+			return
+		default:
+		}
+
+		d.lk.Lock()
+		el := d.lru.Back()
+		if d.used <= target || el == nil {
+			d.lk.Unlock()
+			return
+		}
+		e := *el.Value.(*entry)
+		d.lk.Unlock()
+
+		if err := d.demote(e); err != nil {
+			log.Errorf("moving %s to the cold datastore: %s", e.key, err)
+			return
+		}
+	}
+}
+
+// demote moves the value of e to the cold datastore, unless it's used or
+// deleted in the meantime.
+func (d *Datastore) demote(e entry) error {
+	value, err := d.hot.Get(e.key)
+	switch err {
+	case nil:
+	case ds.ErrNotFound:
+		d.forget(e.key)
+		return nil
+	default:
+		return err
+	}
+
+	if err := d.cold.Put(e.key, value); err != nil {
+		return err
+	}
+
+	d.lk.Lock()
+	defer d.lk.Unlock()
+
+	el, ok := d.entries[e.key]
+	if !ok || el != d.lru.Back() || el.Value.(*entry).gen != e.gen {
+		// deleted, used or rewritten meanwhile
+		if err := d.cold.Delete(e.key); err != nil && err != ds.ErrNotFound {
+			return err
+		}
+		return nil
+	}
+
+	if err := d.hot.Delete(e.key); err != nil && err != ds.ErrNotFound {
+		return err
+	}
+	d.remove(el)
+	return nil
+}
+
+// promote counts a read of the cold value at key, and moves it to the hot
+// datastore once read often enough.
+func (d *Datastore) promote(key ds.Key, value []byte) {
+	if d.opts.PromoteAfter <= 0 {
+		return
+	}
+
+	d.lk.Lock()
+	if len(d.reads) >= maxReads {
+		d.reads = make(map[ds.Key]int)
+	}
+	d.reads[key]++
+	n := d.reads[key]
+	d.lk.Unlock()
+	if n < d.opts.PromoteAfter {
+		return
+	}
+
+	if err := d.hot.Put(key, value); err != nil {
+		log.Errorf("moving %s to the hot datastore: %s", key, err)
+		return
+	}
+	d.touch(key, len(value), true)
+	if err := d.cold.Delete(key); err != nil && err != ds.ErrNotFound {
+		log.Errorf("moving %s to the hot datastore: %s", key, err)
+	}
+}
+
+func (d *Datastore) Put(key ds.Key, value []byte) error {
+	if err := d.hot.Put(key, value); err != nil {
+		return err
+	}
+	d.touch(key, len(value), true)
+	return nil
+}
+
+func (d *Datastore) Get(key ds.Key) ([]byte, error) {
+	value, err := d.hot.Get(key)
+	if err == nil {
+		d.touch(key, len(value), false)
+		return value, nil
+	}
+	if err != ds.ErrNotFound {
+		return nil, err
+	}
+
+	value, err = d.cold.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	d.promote(key, value)
+	return value, nil
+}
+
+func (d *Datastore) Has(key ds.Key) (bool, error) {
+	has, err := d.hot.Has(key)
+	if err != nil || has {
+		return has, err
+	}
+	return d.cold.Has(key)
+}
+
+func (d *Datastore) GetSize(key ds.Key) (int, error) {
+	size, err := d.hot.GetSize(key)
+	if err != ds.ErrNotFound {
+		return size, err
+	}
+	return d.cold.GetSize(key)
+}
+
+// Delete deletes the value at key from both datastores.
+func (d *Datastore) Delete(key ds.Key) error {
+	d.forget(key)
+
+	herr := d.hot.Delete(key)
+	cerr := d.cold.Delete(key)
+	for _, err := range []error{herr, cerr} {
+		if err != nil && err != ds.ErrNotFound {
+			return err
+		}
+	}
+	if herr == ds.ErrNotFound && cerr == ds.ErrNotFound {
+		return ds.ErrNotFound
+	}
+	return nil
+}
+
+// Query returns the entries of the hot datastore, then the ones of the cold
+// datastore not in the hot one.
+func (d *Datastore) Query(q dsq.Query) (dsq.Results, error) {
+	cq := dsq.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly}
+	hot, err := d.hot.Query(cq)
+	if err != nil {
+		return nil, err
+	}
+	cold, err := d.cold.Query(cq)
+	if err != nil {
+		hot.Close()
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	res := dsq.ResultsFromIterator(cq, dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			if hot != nil {
+				r, ok := hot.NextSync()
+				if ok {
+					seen[r.Key] = struct{}{}
+					return r, true
+				}
+				hot.Close()
+				hot = nil
+			}
+			for {
+				r, ok := cold.NextSync()
+				if !ok {
+					return r, false
+				}
+				if _, dup := seen[r.Key]; !dup || r.Error != nil {
+					return r, true
+				}
+			}
+		},
+		Close: func() error {
+			if hot != nil {
+				hot.Close()
+			}
+			return cold.Close()
+		},
+	})
+
+	q.Prefix = ""
+	return dsq.NaiveQueryApply(q, res), nil
+}
+
+func (d *Datastore) Batch() (ds.Batch, error) {
+	return ds.NewBasicBatch(d), nil
+}
+
+// DiskUsage returns the disk usage of both datastores.
+func (d *Datastore) DiskUsage() (uint64, error) {
+	hot, err := ds.DiskUsage(d.hot)
+	if err != nil {
+		return 0, err
+	}
+	cold, err := ds.DiskUsage(d.cold)
+	if err != nil {
+		return 0, err
+	}
+	return hot + cold, nil
+}
+
+// Close stops moving values and closes both datastores.
+func (d *Datastore) Close() error {
+	close(d.closing)
+	d.done.Wait()
+
+	var err error
+	for _, child := range []ds.Batching{d.hot, d.cold} {
+		if c, ok := child.(io.Closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
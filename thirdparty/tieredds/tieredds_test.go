@@ -0,0 +1,104 @@
+package tieredds
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	ds "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore"
+	dsq "gx/ipfs/Qmf4xQhNomPNhrtZc67qSnfJSjxjXs9LWvknJtSXwimPrM/go-datastore/query"
+)
+
+func checkTier(t *testing.T, d ds.Datastore, key ds.Key, expected bool) {
+	t.Helper()
+	has, err := d.Has(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has != expected {
+		t.Fatalf("expected %s to be in the datastore: %t", key, expected)
+	}
+}
+
+func TestDemoteAndPromote(t *testing.T) {
+	hot, cold := ds.NewMapDatastore(), ds.NewMapDatastore()
+	d := New(hot, cold, Options{HotMaxSize: 100, PromoteAfter: 2})
+	defer d.Close()
+
+	value := make([]byte, 20)
+	for i := 0; i < 10; i++ {
+		if err := d.Put(ds.NewKey(fmt.Sprintf("/a%d", i)), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.HotSize() > 90 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the hot datastore to shrink, still %d bytes", d.HotSize())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The least recently used values were moved.
+	a0, a9 := ds.NewKey("/a0"), ds.NewKey("/a9")
+	checkTier(t, hot, a0, false)
+	checkTier(t, cold, a0, true)
+	checkTier(t, hot, a9, true)
+	checkTier(t, cold, a9, false)
+
+	// Cold values are promoted on their second read.
+	for i, promoted := range []bool{false, true} {
+		if v, err := d.Get(a0); err != nil || len(v) != 20 {
+			t.Fatalf("read %d: expected the value of a0: %v", i, err)
+		}
+		checkTier(t, hot, a0, promoted)
+		checkTier(t, cold, a0, !promoted)
+	}
+}
+
+func TestQueryAndDelete(t *testing.T) {
+	hot, cold := ds.NewMapDatastore(), ds.NewMapDatastore()
+	d := New(hot, cold, Options{})
+	defer d.Close()
+
+	for _, k := range []string{"/a", "/b"} {
+		if err := d.Put(ds.NewKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, k := range []string{"/b", "/c"} {
+		if err := cold.Put(ds.NewKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := d.Query(dsq.Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	sort.Strings(keys)
+	if fmt.Sprint(keys) != "[/a /b /c]" {
+		t.Fatalf("expected each key once, got %v", keys)
+	}
+
+	if err := d.Delete(ds.NewKey("/b")); err != nil {
+		t.Fatal(err)
+	}
+	checkTier(t, d, ds.NewKey("/b"), false)
+	if err := d.Delete(ds.NewKey("/c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete(ds.NewKey("/c")); err != ds.ErrNotFound {
+		t.Fatalf("expected ErrNotFound deleting a missing key, got %v", err)
+	}
+}